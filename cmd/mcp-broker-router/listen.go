@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixAddressPrefix marks an address flag as the path of a unix domain socket rather than a TCP address
+const unixAddressPrefix = "unix://"
+
+// listen listens on a TCP address or, when the address has the unix:// prefix, on a unix domain socket.
+// A socket left behind by a process that did not shut down cleanly is removed first. The socket is removed
+// again when the listener is closed.
+func listen(ctx context.Context, address string) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	socketPath, isUnix := strings.CutPrefix(address, unixAddressPrefix)
+	if !isUnix {
+		return lc.Listen(ctx, "tcp", address)
+	}
+	if socketPath == "" {
+		return nil, fmt.Errorf("invalid address %q: missing socket path", address)
+	}
+	if err := removeStaleSocket(ctx, socketPath); err != nil {
+		return nil, err
+	}
+	return lc.Listen(ctx, "unix", socketPath)
+}
+
+// removeStaleSocket removes the socket at path if nothing is accepting connections on it.
+// Files that are not sockets are never removed.
+func removeStaleSocket(ctx context.Context, path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	dialer := net.Dialer{}
+	if conn, err := dialer.DialContext(dialCtx, "unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot listen on %s: socket is in use", path)
+	}
+	return os.Remove(path)
+}
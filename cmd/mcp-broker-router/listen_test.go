@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	t.Run("http over the socket", func(t *testing.T) {
+		socketPath := filepath.Join(dir, "broker.sock")
+		lis, err := listen(ctx, unixAddressPrefix+socketPath)
+		require.NoError(t, err)
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		})}
+		go func() { _ = srv.Serve(lis) }()
+
+		httpClient := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				dialer := net.Dialer{}
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		resp, err := httpClient.Get("http://broker/status")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, "ok", string(body))
+
+		// the socket is removed on shutdown
+		require.NoError(t, srv.Shutdown(ctx))
+		_, err = os.Stat(socketPath)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("grpc over the socket", func(t *testing.T) {
+		address := unixAddressPrefix + filepath.Join(dir, "router.sock")
+		lis, err := listen(ctx, address)
+		require.NoError(t, err)
+		grpcSrv := grpc.NewServer()
+		healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+		go func() { _ = grpcSrv.Serve(lis) }()
+		defer grpcSrv.Stop()
+
+		// the flag value is also a valid grpc target so envoy and grpc clients can use it as is
+		conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+
+	t.Run("stale socket is replaced", func(t *testing.T) {
+		socketPath := filepath.Join(dir, "stale.sock")
+		stale, err := net.Listen("unix", socketPath)
+		require.NoError(t, err)
+		// leave the socket file behind as a process that was killed would
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		lis, err := listen(ctx, unixAddressPrefix+socketPath)
+		require.NoError(t, err)
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("socket in use", func(t *testing.T) {
+		socketPath := filepath.Join(dir, "inuse.sock")
+		lis, err := listen(ctx, unixAddressPrefix+socketPath)
+		require.NoError(t, err)
+		defer func() { _ = lis.Close() }()
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}()
+
+		_, err = listen(ctx, unixAddressPrefix+socketPath)
+		require.ErrorContains(t, err, "socket is in use")
+	})
+
+	t.Run("existing file is not removed", func(t *testing.T) {
+		path := filepath.Join(dir, "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("servers: []"), 0o600))
+		_, err := listen(ctx, unixAddressPrefix+path)
+		require.ErrorContains(t, err, "not a socket")
+		_, err = os.Stat(path)
+		require.NoError(t, err)
+	})
+
+	t.Run("missing socket path", func(t *testing.T) {
+		_, err := listen(ctx, unixAddressPrefix)
+		require.Error(t, err)
+	})
+}
+
+func TestListenTCP(t *testing.T) {
+	lis, err := listen(context.Background(), "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = lis.Close() }()
+	require.Equal(t, "tcp", lis.Addr().Network())
+}
@@ -3,35 +3,42 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	goenv "github.com/caitlinelfring/go-env-default"
 	extProcV3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/fsnotify/fsnotify"
 	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	"github.com/kagenti/mcp-gateway/internal/clients"
 	config "github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/logging"
 	mcpRouter "github.com/kagenti/mcp-gateway/internal/mcp-router"
 	"github.com/kagenti/mcp-gateway/internal/session"
 	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
 	"github.com/kagenti/mcp-gateway/pkg/controller"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
@@ -53,6 +60,8 @@ func init() {
 var (
 	mcpRouterAddrFlag         string
 	mcpBrokerAddrFlag         string
+	brokerTLSCertFileFlag     string
+	brokerTLSKeyFileFlag      string
 	mcpRoutePublicHost        string
 	mcpRoutePrivateHost       string
 	mcpRouterKey              string
@@ -61,26 +70,82 @@ var (
 	jwtSigningKeyFlag         string
 	sessionDurationInMins     int64
 	brokerWriteTimeoutSecs    int64
+	brokerReadTimeoutSecs     int64
+	brokerIdleTimeoutSecs     int64
+	notificationTimeoutSecs   int64
 	managerTickerIntervalSecs int64
+	maxToolsFlag              int
+	initializeAttemptsFlag    int
+	listenerBackoff           upstream.ListenerBackoff
+	toolPollInterval          time.Duration
+	toolsListChangedFlag      bool
+	toolDescriptionSuffixFlag string
+	toolPrefixSeparator       string
 	loglevel                  int
 	logFormat                 string
 	controllerMode            bool
 	enforceToolFilteringFlag  bool
+	debugUpstreamSessionFlag  bool
+	warmUpstreamSessionsFlag  string
+	propagateResponseHeaders  string
+	maxConcurrentToolCalls    int
+	toolCallQueueTimeout      time.Duration
+	toolCallTimeout           time.Duration
+	discoveryWaitTimeout      time.Duration
+	sessionReinitBackoff      time.Duration
+	keepAliveInterval         time.Duration
+	unknownToolStatus         int
+	toolResultCacheTTL        time.Duration
+	forwardCancellations      bool
+	verifyResponseIDs         bool
+	rateLimitBackpressure     bool
+	toolCallQuota             int64
+	toolCallQuotaWindow       time.Duration
+	toolCallQuotaHeader       string
+	toolCallQuotaPer          string
+	sessionKeyCheckURL        string
+	sessionIDStrategyFlag     string
+	duplicateSessionIDFlag    string
+	identityChangeFlag        string
+	pprofFlag                 bool
+	pprofAddrFlag             string
+	brokerStatusURLFlag       string
+	serverSelectorFlag        string
+	configSecretNameFlag      string
+	configSecretNamespaceFlag string
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == validateCommand {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == replayCommand {
+		os.Exit(runReplay(os.Args[2:], os.Stdout, os.Stderr))
+	}
 
 	flag.StringVar(
 		&mcpRouterAddrFlag,
 		"mcp-router-address",
 		"0.0.0.0:50051",
-		"The address for MCP router",
+		"The address for MCP router. Use unix:///path/to/socket to listen on a unix domain socket",
 	)
 	flag.StringVar(
 		&mcpBrokerAddrFlag,
 		"mcp-broker-public-address",
 		"0.0.0.0:8080",
-		"The public address for MCP broker",
+		"The public address for MCP broker. Use unix:///path/to/socket to listen on a unix domain socket",
+	)
+	flag.StringVar(
+		&brokerTLSCertFileFlag,
+		"mcp-broker-tls-cert-file",
+		goenv.GetDefault("MCP_BROKER_TLS_CERT_FILE", ""),
+		"PEM certificate the public broker serves HTTPS with, for TLS terminated by the broker rather than Envoy (env: MCP_BROKER_TLS_CERT_FILE). Reloaded when the file changes. Requires --mcp-broker-tls-key-file. Default serves HTTP",
+	)
+	flag.StringVar(
+		&brokerTLSKeyFileFlag,
+		"mcp-broker-tls-key-file",
+		goenv.GetDefault("MCP_BROKER_TLS_KEY_FILE", ""),
+		"PEM private key of --mcp-broker-tls-cert-file (env: MCP_BROKER_TLS_KEY_FILE)",
 	)
 	flag.StringVar(
 		&mcpRoutePublicHost,
@@ -112,51 +177,112 @@ func main() {
 		&loglevel,
 		"log-level",
 		int(slog.LevelInfo),
-		"set the log level 0=info, 4=warn , 8=error and -4=debug",
+		"set the log level for all components 0=info, 4=warn , 8=error and -4=debug",
 	)
 	flag.StringVar(&jwtSigningKeyFlag,
 		"session-signing-key",
 		goenv.GetDefault("JWT_SESSION_SIGNING_KEY", defaultJWTSigningKey),
 		"JWT signing key for session tokens (env: JWT_SESSION_SIGNING_KEY)",
 	)
+	flag.StringVar(&sessionIDStrategyFlag,
+		"session-id-strategy",
+		goenv.GetDefault("SESSION_ID_STRATEGY", session.StrategyJWT),
+		"how gateway session ids are generated: jwt for self-contained signed tokens or opaque for random ids kept in the session cache (env: SESSION_ID_STRATEGY)",
+	)
+	flag.StringVar(&identityChangeFlag,
+		"upstream-identity-change",
+		goenv.GetDefault("UPSTREAM_IDENTITY_CHANGE", upstream.IdentityChangeLog),
+		"what happens when an upstream MCP server reports a different serverInfo name or version after reconnecting: log only logs it or reregister discovers its tools again and flushes the upstream sessions held with it (env: UPSTREAM_IDENTITY_CHANGE)",
+	)
+	flag.StringVar(&duplicateSessionIDFlag,
+		"duplicate-session-id",
+		goenv.GetDefault("DUPLICATE_SESSION_ID", session.DuplicateSessionIDShare),
+		"what happens when a generated opaque session id is already in use: share gives the new client the existing session or reject refuses its initialize (env: DUPLICATE_SESSION_ID)",
+	)
 	//"redis://redis.mcp-system.svc.cluster.local:6379
 	flag.StringVar(&cacheConnectionStringFlag,
 		"cache-connection-string",
 		goenv.GetDefault("CACHE_CONNECTION_STRING", ""),
 		"redis based cache connection string redis://<user>:<pass>@localhost:6379/<db> (env: CACHE_CONNECTION_STRING). If not set defaults to  in memory storage",
 	)
-	flag.StringVar(&logFormat, "log-format", "txt", "switch to json logs with --log-format=json")
+	flag.StringVar(&logFormat, "log-format", logging.FormatText, "log format for all components. Switch to json logs with --log-format=json")
 
 	flag.Int64Var(&sessionDurationInMins, "session-length", 60*24, "default session length with the gateway in minutes. Default 24h")
-	flag.Int64Var(&brokerWriteTimeoutSecs, "mcp-broker-write-timeout", 0, "HTTP write timeout in seconds for the broker. Default 0 (disabled) for SSE notification support. Set > 0 to enable timeout.")
+	flag.Int64Var(&brokerWriteTimeoutSecs, "mcp-broker-write-timeout", 0, "HTTP write timeout in seconds for the broker. Responses streamed as events use --notification-write-timeout for each write instead. Default 0 (disabled). Set > 0 to enable timeout.")
+	flag.Int64Var(&brokerReadTimeoutSecs, "mcp-broker-read-timeout", 5, "HTTP read timeout in seconds for requests to the broker, including the body. 0 disables it. Default 5 seconds.")
+	flag.Int64Var(&brokerIdleTimeoutSecs, "mcp-broker-idle-timeout", 0, "time in seconds an idle keep-alive connection to the broker is kept open. Default 0 uses the read timeout.")
+	flag.Int64Var(&notificationTimeoutSecs, "notification-write-timeout", int64(broker.DefaultNotificationWriteTimeout/time.Second), "time in seconds writing a notification to a client's GET /mcp stream may take before the slow client is disconnected. Default 30 seconds.")
 	flag.Int64Var(&managerTickerIntervalSecs, "mcp-check-interval", 60, "interval in seconds for MCP manager backend health checks. Default 60 seconds.")
+	flag.IntVar(&initializeAttemptsFlag, "upstream-initialize-attempts", upstream.DefaultInitializeAttempts, "number of times the broker sends initialize to an upstream MCP server before waiting for the next health check. Covers upstreams that are momentarily unavailable. Default 3")
+	flag.DurationVar(&listenerBackoff.InitialDelay, "notification-reconnect-initial-delay", upstream.DefaultListenerBackoff.InitialDelay, "first delay before the broker reopens the stream an upstream MCP server sends notifications on after it drops. The delay doubles with each failed attempt")
+	flag.DurationVar(&listenerBackoff.MaxDelay, "notification-reconnect-max-delay", upstream.DefaultListenerBackoff.MaxDelay, "longest delay between attempts to reopen an upstream MCP server's notification stream")
+	flag.StringVar(&toolDescriptionSuffixFlag, "tool-description-suffix", "", "template appended to the description of each advertised tool, e.g. ' (via {{.Server}})'. {{.Server}} is the server name and {{.Prefix}} its tool prefix. Default none")
+	flag.StringVar(&toolPrefixSeparator, "tool-prefix-separator", goenv.GetDefault("TOOL_PREFIX_SEPARATOR", ""), "separator put between each server's tool prefix and its tool names, e.g. __ advertises weather__get for the prefix weather (env: TOOL_PREFIX_SEPARATOR). Servers with tools whose names contain it are not added. Default none, the prefix is joined directly to the tool name")
+	flag.DurationVar(&toolPollInterval, "tool-poll-interval", 0, "interval at which the broker lists the tools of upstream MCP servers that do not send tool list changed notifications. 0 lists them on each health check")
+	flag.BoolVar(&toolsListChangedFlag, "tools-list-changed-notifications", true, "send notifications/tools/list_changed to connected clients when the gateway's tools change. Disable for clients that poll tools/list, which is kept up to date either way. Default true")
+	flag.IntVar(&listenerBackoff.MaxAttempts, "notification-reconnect-max-attempts", upstream.DefaultListenerBackoff.MaxAttempts, "attempts to reopen an upstream MCP server's notification stream before its connection is made again on the next health check. 0 retries until the server is removed")
+	flag.IntVar(&maxToolsFlag, "max-tools", 0, "maximum number of tools advertised by the gateway. Tools from lower priority servers are left out once reached. Default 0 (no limit)")
 	flag.BoolVar(&controllerMode, "controller", false, "Run in controller mode")
+	flag.StringVar(&brokerStatusURLFlag, "broker-status-url", "", "controller mode only. URL of the broker's /status endpoint used to validate MCPServers, e.g. http://mcp-broker.mcp-system.svc:8080/status. Default discovers the broker pods from the broker service")
+	flag.StringVar(&serverSelectorFlag, "mcp-server-selector", "", "controller mode only. Label selector, e.g. mcp.kagenti.com/tenant=team-a, limiting the MCPServers and MCPVirtualServers written to the config. Default all")
+	flag.StringVar(&configSecretNameFlag, "config-secret-name", goenv.GetDefault("CONFIG_SECRET_NAME", controller.ConfigName), "controller mode only. Name of the Secret the aggregated config is written to (env: CONFIG_SECRET_NAME). Give each --mcp-server-selector or gateway instance its own Secret")
+	flag.StringVar(&configSecretNamespaceFlag, "config-secret-namespace", goenv.GetDefault("CONFIG_SECRET_NAMESPACE", ""), "controller mode only. Namespace of the Secret the aggregated config is written to (env: CONFIG_SECRET_NAMESPACE). Default the NAMESPACE env var or mcp-system")
 	flag.BoolVar(&enforceToolFilteringFlag, "enforce-tool-filtering", false, "when enabled an x-authorized-tools header will be needed to return any tools")
+	flag.BoolVar(&debugUpstreamSessionFlag, "debug-upstream-session", false, "when enabled the x-mcp-debug-upstream-session header can pin the upstream session used for tool calls. For debugging only, do not enable in production")
+	flag.StringVar(&warmUpstreamSessionsFlag, "warm-upstream-sessions", "", "comma separated names (namespace/name) of the MCP servers an upstream session is created for as soon as a client initializes, or * for all servers. Reduces the latency of the first tool call at the cost of an upstream session per client. Default none, sessions are created on the first tool call")
+	flag.IntVar(&maxConcurrentToolCalls, "max-concurrent-tool-calls", 0, "maximum tool calls in flight to each MCP server without its own spec.maxConcurrentToolCalls. Calls over the limit wait for --tool-call-queue-timeout and are then rejected with a 429. Default 0 (no limit)")
+	flag.DurationVar(&toolCallTimeout, "tool-call-timeout", 0, "upstream timeout of tool calls to tools without their own spec.toolTimeouts entry. It also caps the deadline clients set in the x-mcp-timeout-ms header. Default 0 (the timeout of the gateway's route)")
+	flag.DurationVar(&discoveryWaitTimeout, "discovery-wait-timeout", mcpRouter.DefaultDiscoveryWaitTimeout, "how long a tool call to an MCP server whose tools are still being discovered, for example while the gateway starts, waits before being rejected with a retryable 503")
+	flag.DurationVar(&toolCallQueueTimeout, "tool-call-queue-timeout", mcpRouter.DefaultToolCallQueueTimeout, "how long a tool call over its MCP server's concurrency limit waits for another call to complete before being rejected with a 429")
+	flag.DurationVar(&sessionReinitBackoff, "session-reinit-backoff", mcpRouter.DefaultSessionReinitBackoff, "first delay before a new upstream session is created with an MCP server that keeps losing them. Tool calls during the delay are rejected with a 503 and retry-after. The delay doubles with each further loss up to 30s. 0 disables the backoff")
+	flag.StringVar(&propagateResponseHeaders, "propagate-response-headers", "", "comma separated upstream response headers forwarded to clients for tool calls, e.g. cache-control,x-ratelimit-*. A trailing * matches any header with that prefix. Headers MCP needs such as content-type are always forwarded and hop-by-hop headers never are. Default forwards every header that is not hop-by-hop")
+	flag.DurationVar(&keepAliveInterval, "keep-alive-interval", broker.DefaultKeepAliveInterval, "how long a client's GET /mcp notification stream may be idle before the broker writes a keep-alive to it. A client whose stream is lost and not reopened within the interval has its upstream sessions closed. 0 disables keep-alives and closing upstream sessions")
+	flag.IntVar(&unknownToolStatus, "unknown-tool-status", mcpRouter.DefaultUnknownToolStatus, "HTTP status of the JSON-RPC method not found error returned for a tools/call to a tool no MCP server provides. Avoid 404, MCP clients treat it as their session having ended")
+	flag.Int64Var(&toolCallQuota, "tool-call-quota", 0, "tool calls each subject may make in each --tool-call-quota-window. Calls over the quota are rejected with a retryable 429 until the window resets. Counted in the session cache so the quota is shared by all replicas when redis is used. Default 0 (no quota)")
+	flag.DurationVar(&toolCallQuotaWindow, "tool-call-quota-window", mcpRouter.DefaultToolCallQuotaWindow, "window tool call quotas are counted over. Windows are aligned to UTC so the default of 24h resets at midnight UTC")
+	flag.StringVar(&toolCallQuotaHeader, "tool-call-quota-header", mcpRouter.DefaultToolCallQuotaHeader, "request header the gateway's authentication sets to the subject of the client. The broker records it for the session when the client initializes and the router removes it from client requests, so clients cannot set it themselves")
+	flag.StringVar(&toolCallQuotaPer, "tool-call-quota-per", mcpRouter.ToolCallQuotaPerSubject, "subject gives each subject its own tool call quota. tenant gives each tenant of a valid x-mcp-tenant header one quota shared by its subjects. Sessions without the identity share one quota")
+	flag.BoolVar(&rateLimitBackpressure, "upstream-rate-limit-backpressure", false, "answer requests to an MCP server that rate limited a request with a 429 and its retry-after until that time has passed, rather than sending them on. A 429 from an MCP server is always answered with a retryable JSON-RPC error keeping its retry-after")
+	flag.DurationVar(&toolResultCacheTTL, "tool-result-cache-ttl", 0, "how long results of tools annotated as both read-only and idempotent are answered from a cache rather than their MCP server. Calls with the same tool and arguments by the same subject and tenant share a result, see --tool-call-quota-header. Cached results are counted against the tool call quota. Default 0 (no caching)")
+	flag.BoolVar(&forwardCancellations, "forward-cancellations", true, "forward notifications/cancelled for a tool call in flight to the MCP server handling it so the server can stop working on the call. When disabled cancellations are sent to the broker which ignores them")
+	flag.BoolVar(&verifyResponseIDs, "verify-response-ids", false, "send the body of every response from an MCP server to the router to log responses whose JSON-RPC id does not match the request. Adds latency to every routed call and buffers JSON responses, for debugging only. Default only sends response bodies when the result cache or a maximum response size needs them")
+	flag.StringVar(&sessionKeyCheckURL, "session-key-check-url", "", "URL of another broker's session key fingerprint endpoint, e.g. http://mcp-gateway-broker.mcp-system.svc:8080/session-key/fingerprint. On startup the gateway exits if that broker signs sessions with a different --session-signing-key. Default no check")
+	flag.BoolVar(&pprofFlag, "pprof", false, "serve net/http/pprof profiles on the pprof address. For debugging only")
+	flag.StringVar(&pprofAddrFlag, "pprof-address", "127.0.0.1:6060", "address for the pprof endpoint when --pprof is set. Keep this bound to localhost and use kubectl port-forward to reach it")
 	flag.Parse()
 
-	loggerOpts := &slog.HandlerOptions{}
+	configuredLogger, err := logging.New(os.Stdout, logFormat, loglevel)
+	if err != nil {
+		fatal("invalid logging flags", "error", err)
+	}
+	logger = configuredLogger
+	slog.SetDefault(logger)
 
-	switch loglevel {
-	case 0:
-		loggerOpts.Level = slog.LevelInfo
-	case 8:
-		loggerOpts.Level = slog.LevelError
-	case -4:
-		loggerOpts.Level = slog.LevelDebug
-	default:
-		loggerOpts.Level = slog.LevelDebug
+	if unknownToolStatus < 100 || unknownToolStatus > 599 {
+		fatal("invalid --unknown-tool-status, must be an HTTP status code", "status", unknownToolStatus)
 	}
 
-	logger = slog.New(slog.NewTextHandler(os.Stdout, loggerOpts))
+	if toolCallQuotaPer != mcpRouter.ToolCallQuotaPerSubject && toolCallQuotaPer != mcpRouter.ToolCallQuotaPerTenant {
+		fatal("invalid --tool-call-quota-per, must be subject or tenant", "per", toolCallQuotaPer)
+	}
 
-	if logFormat == "json" {
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, loggerOpts))
+	if err := config.ValidateToolPrefixSeparator(toolPrefixSeparator); err != nil {
+		fatal("invalid --tool-prefix-separator", "error", err)
 	}
+
+	if (brokerTLSCertFileFlag == "") != (brokerTLSKeyFileFlag == "") {
+		fatal("--mcp-broker-tls-cert-file and --mcp-broker-tls-key-file must be set together")
+	}
+
+	if pprofFlag {
+		startPprof(pprofAddrFlag)
+	}
+
 	if controllerMode {
 		logger.Info("Starting in controller mode...")
 		go func() {
 			if err := runController(); err != nil {
-				log.Fatalf("Controller failed: %v", err)
+				fatal("controller failed", "error", err)
 			}
 		}()
 		// Controller doesn't need to run broker/router
@@ -189,15 +315,67 @@ func main() {
 		logger.Warn("jwt session signing key is set to the default value. This is not recommended for production")
 	}
 
-	jwtmgr, err := session.NewJWTManager(jwtSigningKeyFlag, sessionDurationInMins, logger, sessionCache)
+	var sessionIDOpts []func(*session.JWTManager)
+	switch sessionIDStrategyFlag {
+	case session.StrategyJWT:
+	case session.StrategyOpaque:
+		if cacheConnectionStringFlag == "" {
+			logger.Warn("opaque session ids are kept in memory and are only valid on this replica. Set --cache-connection-string when running more than one")
+		}
+		sessionIDOpts = append(sessionIDOpts, session.WithOpaqueSessionIDs(sessionCache))
+	default:
+		fatal("invalid --session-id-strategy, must be jwt or opaque", "strategy", sessionIDStrategyFlag)
+	}
+	switch duplicateSessionIDFlag {
+	case session.DuplicateSessionIDShare, session.DuplicateSessionIDReject:
+		sessionIDOpts = append(sessionIDOpts, session.WithDuplicateSessionIDBehavior(duplicateSessionIDFlag))
+	default:
+		fatal("invalid --duplicate-session-id, must be share or reject", "behavior", duplicateSessionIDFlag)
+	}
+	jwtmgr, err := session.NewJWTManager(jwtSigningKeyFlag, sessionDurationInMins, logger, sessionCache, sessionIDOpts...)
 	if err != nil {
 		panic("failed to setup jwt manager " + err.Error())
 	}
 	jwtSessionMgr = jwtmgr
+	if sessionKeyCheckURL != "" {
+		checkSessionKey(ctx, sessionKeyCheckURL, jwtSessionMgr.KeyFingerprint())
+	}
 
 	managerTickerInterval := time.Duration(managerTickerIntervalSecs) * time.Second
-	brokerServer, mcpBroker, mcpServer := setUpBroker(mcpBrokerAddrFlag, enforceToolFilteringFlag, jwtSessionMgr, brokerWriteTimeoutSecs, managerTickerInterval)
+	notificationWriteTimeout := time.Duration(notificationTimeoutSecs) * time.Second
+	var sessionReaper *broker.SessionReaper
+	if keepAliveInterval > 0 {
+		sessionReaper = broker.NewSessionReaper(keepAliveInterval, logger.With("component", "broker"))
+	}
+	var toolDescriptionSuffix *template.Template
+	if toolDescriptionSuffixFlag != "" {
+		toolDescriptionSuffix, err = template.New("tool-description-suffix").Parse(toolDescriptionSuffixFlag)
+		if err != nil {
+			fatal("invalid --tool-description-suffix", "error", err)
+		}
+	}
+	switch identityChangeFlag {
+	case upstream.IdentityChangeLog, upstream.IdentityChangeReregister:
+	default:
+		fatal("invalid --upstream-identity-change, must be log or reregister", "behavior", identityChangeFlag)
+	}
+	flushSessionsHandler := broker.NewFlushSessionsHandler(mcpRouterKey, logger.With("component", "broker"))
+	snapshotHandler := broker.NewSnapshotHandler(mcpRouterKey, logger.With("component", "broker"))
+	// the broker, reached after the gateway's authentication, records the identity of each session that the router
+	// counts its tool calls against, caches their results for and isolates its tenant by. It is always recorded as
+	// tenancy can be enabled by a config change
+	brokerServer, mcpBroker, mcpServer := setUpBroker(mcpBrokerAddrFlag, enforceToolFilteringFlag, jwtSessionMgr, brokerTimeouts{
+		read:  time.Duration(brokerReadTimeoutSecs) * time.Second,
+		write: time.Duration(brokerWriteTimeoutSecs) * time.Second,
+		idle:  time.Duration(brokerIdleTimeoutSecs) * time.Second,
+	}, notificationWriteTimeout, keepAliveInterval, sessionReaper, managerTickerInterval, maxToolsFlag, initializeAttemptsFlag, listenerBackoff, toolPollInterval, toolsListChangedFlag, toolDescriptionSuffix, flushSessionsHandler, snapshotHandler, identityChangeFlag, sessionCache, sessionCache)
 	routerGRPCServer, router := setUpRouter(mcpBroker, logger, jwtSessionMgr, sessionCache)
+	if sessionReaper != nil {
+		// the upstream sessions of clients that are gone are closed rather than held until the gateway session expires
+		sessionReaper.Reap = router.CloseGatewaySession
+	}
+	flushSessionsHandler.Flush = router.FlushServerSessions
+	snapshotHandler.UpstreamSessions = router.UpstreamSessionCount
 	mcpConfig.RegisterObserver(router)
 	mcpConfig.RegisterObserver(mcpBroker)
 	if mcpRoutePublicHost == "" {
@@ -210,8 +388,10 @@ func main() {
 
 	// Only load config and run broker/router in standalone mode
 	mutex.Lock()
-	// will panic if fails
-	LoadConfig(mcpConfigFile)
+	// the gateway cannot start without a config it can read
+	if err := loadConfig(mcpConfigFile); err != nil {
+		fatal("failed to load config", "error", err)
+	}
 	mutex.Unlock()
 	mcpConfig.Notify(ctx)
 
@@ -221,29 +401,54 @@ func main() {
 		logger.Info("OnConfigChange mcp servers config changed ", "config file", in.Name)
 		mutex.Lock()
 		defer mutex.Unlock()
-		LoadConfig(mcpConfigFile)
+		// the servers already applied keep running rather than the gateway exiting on a bad config
+		if err := loadConfig(mcpConfigFile); err != nil {
+			logger.Error("failed to load changed config, keeping the current config", "error", err)
+			return
+		}
 		logger.Info("OnConfigChange: notifying observers of config change")
 		mcpConfig.Notify(ctx)
 	})
+	// SIGTERM is handled as well so unix domain sockets are removed when the pod is stopped
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	grpcAddr := mcpRouterAddrFlag
-	lc := net.ListenConfig{}
-	lis, err := lc.Listen(ctx, "tcp", grpcAddr)
+	lis, err := listen(ctx, grpcAddr)
+	if err != nil {
+		fatal("[grpc] listen error", "error", err)
+	}
+	brokerLis, err := listen(ctx, brokerServer.Addr)
 	if err != nil {
-		log.Fatalf("[grpc] listen error: %v", err)
+		fatal("[http] listen error", "error", err)
+	}
+	if brokerTLSCertFileFlag != "" {
+		certReloader, err := newCertReloader(brokerTLSCertFileFlag, brokerTLSKeyFileFlag, logger.With("component", "broker"))
+		if err != nil {
+			fatal("[http] invalid broker tls certificate", "error", err)
+		}
+		if err := certReloader.Watch(ctx); err != nil {
+			fatal("[http] cannot watch broker tls certificate", "error", err)
+		}
+		brokerServer.TLSConfig = certReloader.TLSConfig()
 	}
 
 	go func() {
 		logger.Info("[grpc] starting MCP Router", "listening", grpcAddr)
-		log.Fatal(routerGRPCServer.Serve(lis))
+		if err := routerGRPCServer.Serve(lis); err != nil {
+			fatal("[grpc] MCP Router stopped", "error", err)
+		}
 	}()
 
 	go func() {
-		logger.Info("[http] starting MCP Broker (public)", "listening", brokerServer.Addr)
-		if err := brokerServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("[http] Cannot start public broker: %v", err)
+		logger.Info("[http] starting MCP Broker (public)", "listening", brokerServer.Addr, "tls", brokerServer.TLSConfig != nil)
+		serve := brokerServer.Serve
+		if brokerServer.TLSConfig != nil {
+			// the certificate comes from the tls config so it can be reloaded
+			serve = func(lis net.Listener) error { return brokerServer.ServeTLS(lis, "", "") }
+		}
+		if err := serve(brokerLis); err != nil && err != http.ErrServerClosed {
+			fatal("[http] cannot start public broker", "error", err)
 		}
 	}()
 
@@ -254,16 +459,21 @@ func main() {
 	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownRelease()
 	if err := brokerServer.Shutdown(shutdownCtx); err != nil {
-		log.Fatalf("HTTP shutdown error: %v", err)
+		fatal("HTTP shutdown error", "error", err)
 	}
 	if err := mcpServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("MCP shutdown error: %v; ignoring", err)
+		logger.Warn("MCP shutdown error, ignoring", "error", err)
 	}
 
 	routerGRPCServer.GracefulStop()
 }
 
-func setUpBroker(address string, toolFiltering bool, sessionManager *session.JWTManager, writeTimeoutSecs int64, managerTickerInterval time.Duration) (*http.Server, broker.MCPBroker, *server.StreamableHTTPServer) {
+// brokerTimeouts are the timeouts of the broker's HTTP server. 0 disables a timeout
+type brokerTimeouts struct {
+	read, write, idle time.Duration
+}
+
+func setUpBroker(address string, toolFiltering bool, sessionManager *session.JWTManager, timeouts brokerTimeouts, notificationWriteTimeout, keepAliveInterval time.Duration, sessionReaper *broker.SessionReaper, managerTickerInterval time.Duration, maxTools int, initializeAttempts int, listenerBackoff upstream.ListenerBackoff, toolPollInterval time.Duration, toolsListChanged bool, toolDescriptionSuffix *template.Template, flushSessionsHandler *broker.FlushSessionsHandler, snapshotHandler *broker.SnapshotHandler, identityChange string, sessionIdentities broker.SessionIdentityStore, toolOwners upstream.ToolOwnerStore) (*http.Server, broker.MCPBroker, *server.StreamableHTTPServer) {
 
 	mux := http.NewServeMux()
 
@@ -274,26 +484,50 @@ func setUpBroker(address string, toolFiltering bool, sessionManager *session.JWT
 	// Add OAuth protected resource endpoint
 	oauthHandler := broker.ProtectedResourceHandler{Logger: logger}
 	mux.HandleFunc("/.well-known/oauth-protected-resource", oauthHandler.Handle)
+	if metadataHandler := broker.NewAuthorizationServerMetadataHandlerFromEnv(logger); metadataHandler != nil {
+		logger.Info("proxying oauth authorization server metadata", "issuer", metadataHandler.IssuerURL, "ttl", metadataHandler.CacheTTL)
+		mux.Handle(broker.AuthorizationServerMetadataPath, metadataHandler)
+	}
 
-	// WriteTimeout of 0 (disabled) is important for SSE connections (GET /mcp).
-	// SSE streams notifications indefinitely - any write timeout would kill the connection.
-	// Connection lifecycle is managed by the application (client disconnect, session expiry, etc.)
-	writeTimeout := time.Duration(writeTimeoutSecs) * time.Second
-
+	// The WriteTimeout does not cut off event streams, such as the notification stream (GET /mcp) which stays open
+	// indefinitely or a response sent with progress notifications. The notification stream handler replaces it with
+	// a deadline on each write to the stream. Connection lifecycle is managed by the application (client disconnect,
+	// session expiry, etc.)
 	httpSrv := &http.Server{
 		Addr:         address,
-		Handler:      mux,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: writeTimeout,
+		Handler:      logging.RequestIDHandler(mux),
+		ReadTimeout:  timeouts.read,
+		WriteTimeout: timeouts.write,
+		IdleTimeout:  timeouts.idle,
 	}
 
 	if managerTickerInterval <= 0 {
 		panic("flag mcp-check-interval cannot be 0 or less seconds")
 	}
+	toolCatalog := broker.NewToolCatalogFromEnv(logger.With("component", "tool-catalog"))
+	if toolCatalog != nil {
+		logger.Info("enriching listed tools from the tool catalog", "url", toolCatalog.URL, "ttl", toolCatalog.CacheTTL)
+	}
 	mcpBroker := broker.NewBroker(logger.With("component", "broker"),
 		broker.WithEnforceToolFilter(toolFiltering),
 		broker.WithTrustedHeadersPublicKey(os.Getenv("TRUSTED_HEADER_PUBLIC_KEY")),
 		broker.WithManagerTickerInterval(managerTickerInterval),
+		broker.WithMaxTools(maxTools),
+		broker.WithInitializeAttempts(initializeAttempts),
+		broker.WithListenerBackoff(listenerBackoff),
+		broker.WithToolPollInterval(toolPollInterval),
+		broker.WithToolsListChangedNotifications(toolsListChanged),
+		broker.WithToolDescriptionSuffix(toolDescriptionSuffix),
+		broker.WithToolCatalog(toolCatalog),
+		broker.WithSessionIdentity(sessionIdentities, toolCallQuotaHeader),
+		broker.WithToolOwners(toolOwners),
+		// the router is created after the broker so its flush is looked up when an upstream is replaced
+		broker.WithUpstreamIdentityChange(identityChange, func(ctx context.Context, serverName string) (int, error) {
+			if flushSessionsHandler.Flush == nil {
+				return 0, nil
+			}
+			return flushSessionsHandler.Flush(ctx, serverName)
+		}),
 	)
 
 	var streamableHTTPServer = server.NewStreamableHTTPServer(
@@ -305,12 +539,36 @@ func setUpBroker(address string, toolFiltering bool, sessionManager *session.JWT
 		streamableHTTPServer = server.NewStreamableHTTPServer(
 			mcpBroker.MCPServer(),
 			server.WithStreamableHTTPServer(httpSrv),
-			server.WithSessionIdManager(sessionManager),
+			// resolved for each request so the session id store is called with the request's context
+			server.WithSessionIdManagerResolver(sessionManager),
 		)
 	}
+	mux.Handle("/readyz", broker.NewReadinessHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "ok")
+	}), mcpBroker.Ready()))
+	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/status", mcpBroker.HandleStatusRequest)
 	mux.HandleFunc("/status/", mcpBroker.HandleStatusRequest)
-	mux.Handle("/mcp", streamableHTTPServer)
+	mux.Handle(broker.ToolsPath, broker.NewToolsHandler(mcpBroker, mcpRouterKey, logger.With("component", "broker")))
+	if sessionManager != nil {
+		mux.Handle(broker.SessionKeyFingerprintPath, broker.NewSessionKeyFingerprintHandler(sessionManager.KeyFingerprint(), mcpRouterKey, logger.With("component", "broker")))
+	}
+	mux.Handle(broker.ToolManifestPath, broker.NewToolManifestHandler(mcpBroker, mcpRouterKey, logger.With("component", "broker")))
+	mux.Handle(broker.FlushSessionsPath, flushSessionsHandler)
+	snapshotHandler.Snapshot = mcpBroker.Snapshot
+	mux.Handle(broker.SnapshotPath, snapshotHandler)
+	// resource subscriptions are relayed to the upstreams by the broker rather than the MCP server
+	// slow clients are disconnected rather than holding their notification stream open indefinitely
+	streamHandler := broker.NewNotificationStreamHandler(streamableHTTPServer, notificationWriteTimeout, keepAliveInterval, logger.With("component", "broker"))
+	if sessionReaper != nil {
+		streamHandler.WithSessionReaper(sessionReaper)
+	}
+	var mcpHandler http.Handler = broker.NewResourceSubscriptionHandler(streamHandler, mcpBroker, logger.With("component", "broker"))
+	// clients are asked to retry until the first config is loaded and its servers discovered
+	mcpHandler = broker.NewReadinessHandler(mcpHandler, mcpBroker.Ready())
+	mux.Handle("/mcp", mcpHandler)
+	// virtual servers can also be selected by path for clients that cannot set custom headers
+	mux.Handle(broker.VirtualServerPathPrefix, broker.NewVirtualServerHandler(mcpHandler, logger.With("component", "broker")))
 
 	return httpSrv, mcpBroker, streamableHTTPServer
 }
@@ -327,6 +585,55 @@ func setUpRouter(broker broker.MCPBroker, logger *slog.Logger, jwtManager *sessi
 		SessionCache:  sessionCache,
 		Broker:        broker, // TODO we shouldn't need a handle to broker in the router
 
+		DebugUpstreamSession: debugUpstreamSessionFlag,
+		WarmUpstreamSessions: splitList(warmUpstreamSessionsFlag),
+
+		PropagateResponseHeaders: splitList(propagateResponseHeaders),
+
+		MaxConcurrentToolCalls: maxConcurrentToolCalls,
+		ToolCallQueueTimeout:   toolCallQueueTimeout,
+		ToolCallTimeout:        toolCallTimeout,
+		DiscoveryWaitTimeout:   discoveryWaitTimeout,
+
+		SessionReinitBackoff: sessionReinitBackoff,
+		UnknownToolStatus:    unknownToolStatus,
+		ToolResultCacheTTL:   toolResultCacheTTL,
+		ForwardCancellations: forwardCancellations,
+		VerifyResponseIDs:    verifyResponseIDs,
+
+		UpstreamRateLimitBackpressure: rateLimitBackpressure,
+
+		ToolCallQuota:       toolCallQuota,
+		ToolCallQuotaWindow: toolCallQuotaWindow,
+		ToolCallQuotaHeader: toolCallQuotaHeader,
+		ToolCallQuotaPer:    toolCallQuotaPer,
+		QuotaStore:          sessionCache,
+		SessionIdentities:   sessionCache,
+	}
+	if debugUpstreamSessionFlag {
+		logger.Warn("debug upstream session pinning is enabled. This should not be used in production")
+	}
+	if len(server.WarmUpstreamSessions) > 0 {
+		logger.Info("warming upstream sessions on initialize", "servers", server.WarmUpstreamSessions)
+	}
+	if server.ToolCallQuota > 0 {
+		logger.Info("limiting tool calls", "quota", server.ToolCallQuota, "per", toolCallQuotaPer, "window", toolCallQuotaWindow, "subject header", toolCallQuotaHeader)
+	}
+	if len(server.PropagateResponseHeaders) > 0 {
+		logger.Info("only forwarding allowed upstream response headers", "headers", server.PropagateResponseHeaders)
+	}
+	requestLogSampleRate, err := mcpRouter.RequestLogSampleRateFromEnv()
+	if err != nil {
+		fatal("invalid request log sample rate", "error", err)
+	}
+	server.RequestLogSampleRate = requestLogSampleRate
+	faultInjector, err := mcpRouter.NewFaultInjectorFromEnv()
+	if err != nil {
+		fatal("invalid fault injection config", "error", err)
+	}
+	if faultInjector != nil {
+		logger.Warn("fault injection is enabled, tool calls will fail. This should not be used in production", "faults", faultInjector.String())
+		server.FaultInjector = faultInjector
 	}
 
 	extProcV3.RegisterExternalProcessorServer(grpcSrv, server)
@@ -335,31 +642,60 @@ func setUpRouter(broker broker.MCPBroker, logger *slog.Logger, jwtManager *sessi
 
 // config
 
-func LoadConfig(path string) {
+// loadConfig reads the config file into mcpConfig. Server entries with problems are left out and reported so the
+// other servers are still applied. Any other problem is returned and leaves mcpConfig unchanged
+func loadConfig(path string) error {
 	viper.SetConfigFile(path)
 	logger.Debug("loading config", "path", viper.ConfigFileUsed())
-	err := viper.ReadInConfig()
-	if err != nil {
-		log.Fatalf("Error reading config file: %s", err)
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
 	}
-	// reset the servers to avoid old configs being written to
-	mcpConfig.Servers = []*config.MCPServer{}
-	err = viper.UnmarshalKey("servers", &mcpConfig.Servers)
-	if err != nil {
-		log.Fatalf("Unable to decode server config into struct: %s", err)
+	var entries []any
+	if viper.IsSet("servers") {
+		var ok bool
+		if entries, ok = viper.Get("servers").([]any); !ok {
+			return fmt.Errorf("servers must be a list")
+		}
 	}
-	mcpConfig.VirtualServers = []*config.VirtualServer{}
+	servers, skipped := config.LoadServers(entries)
+	virtualServers := []*config.VirtualServer{}
 	// Load virtualServers if present - this is optional
 	if viper.IsSet("virtualServers") {
-		err = viper.UnmarshalKey("virtualServers", &mcpConfig.VirtualServers)
-		if err != nil {
-			log.Fatal("Failed to parse virtualServers configuration", "error", err)
+		if err := viper.UnmarshalKey("virtualServers", &virtualServers); err != nil {
+			return fmt.Errorf("failed to parse virtualServers configuration: %w", err)
 		}
 	} else {
 		logger.Debug("No virtualServers section found in configuration")
 	}
+	clientToolFilters := []*config.ClientToolFilter{}
+	if viper.IsSet("clientToolFilters") {
+		if err := viper.UnmarshalKey("clientToolFilters", &clientToolFilters); err != nil {
+			return fmt.Errorf("failed to parse clientToolFilters configuration: %w", err)
+		}
+	}
+	var tenancy *config.Tenancy
+	if viper.IsSet("tenancy") {
+		tenancy = &config.Tenancy{}
+		if err := viper.UnmarshalKey("tenancy", tenancy); err != nil {
+			return fmt.Errorf("failed to parse tenancy configuration: %w", err)
+		}
+	}
 
+	for _, server := range servers {
+		server.ToolPrefixSeparator = toolPrefixSeparator
+	}
+	mcpConfig.Servers = servers
+	mcpConfig.SkippedServers = skipped
+	mcpConfig.VirtualServers = virtualServers
+	mcpConfig.ClientToolFilters = clientToolFilters
+	mcpConfig.Tenancy = tenancy
 	logger.Debug("config successfully loaded", "# servers", len(mcpConfig.Servers))
+	for _, fieldErr := range skipped {
+		logger.Error("skipped invalid server", "field", fieldErr.Field, "value", fieldErr.Value, "error", fieldErr.Message)
+	}
+	for _, fieldErr := range mcpConfig.Validate() {
+		logger.Error("invalid config", "field", fieldErr.Field, "value", fieldErr.Value, "error", fieldErr.Message)
+	}
 
 	for _, s := range mcpConfig.Servers {
 		logger.Debug(
@@ -376,12 +712,13 @@ func LoadConfig(path string) {
 			s.Hostname,
 		)
 	}
+	return nil
 }
 
 func runController() error {
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	ctrl.SetLogger(logging.Logr(logger.With("component", "controller")))
 
-	fmt.Println("Controller starting (health: :8081, metrics: :8082)...")
+	logger.Info("controller starting", "health", ":8081", "metrics", ":8082")
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: ":8082"},
@@ -392,10 +729,24 @@ func runController() error {
 		return fmt.Errorf("unable to start manager: %w", err)
 	}
 
+	var serverSelector labels.Selector
+	if serverSelectorFlag != "" {
+		serverSelector, err = labels.Parse(serverSelectorFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --mcp-server-selector: %w", err)
+		}
+		logger.Info("controller scoped to selected servers", "selector", serverSelector.String(), "config secret", configSecretNameFlag)
+	}
+
 	if err = (&controller.MCPReconciler{
 		Client:    mgr.GetClient(),
 		Scheme:    mgr.GetScheme(),
 		APIReader: mgr.GetAPIReader(),
+
+		BrokerStatusURL:       brokerStatusURLFlag,
+		ServerSelector:        serverSelector,
+		ConfigSecretName:      configSecretNameFlag,
+		ConfigSecretNamespace: configSecretNamespaceFlag,
 	}).SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create controller: %w", err)
 	}
@@ -407,10 +758,64 @@ func runController() error {
 		return fmt.Errorf("unable to set up ready check: %w", err)
 	}
 
-	fmt.Println("Starting controller manager...")
+	logger.Info("starting controller manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		return fmt.Errorf("problem running manager: %w", err)
 	}
 
 	return nil
 }
+
+// startPprof serves the pprof profiles on their own mux so they are never exposed on the public broker address
+func startPprof(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	pprofSrv := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Warn("[http] starting pprof endpoint. This should not be used in production", "listening", address)
+		if err := pprofSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("[http] pprof endpoint stopped", "error", err)
+		}
+	}()
+}
+
+// fatal logs the error with the configured logger and exits
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkSessionKey exits when the broker at url signs sessions with a different key, as session ids minted by one
+// would be rejected by the other. The check is skipped with a warning when the fingerprint cannot be fetched, for
+// example when no other broker is running yet
+func checkSessionKey(ctx context.Context, url, fingerprint string) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	err := broker.CheckSessionKeyFingerprint(ctx, client, url, mcpRouterKey, fingerprint)
+	switch {
+	case errors.Is(err, broker.ErrSessionKeyMismatch):
+		fatal("session signing key check failed", "error", err)
+	case err != nil:
+		logger.Warn("could not check the session signing key, skipping the check", "url", url, "error", err)
+	default:
+		logger.Info("session signing key matches", "url", url, "fingerprint", fingerprint)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/replay"
+)
+
+// replayCommand is the subcommand that replays recorded MCP sessions against a running gateway
+const replayCommand = "replay"
+
+// runReplay implements the replay subcommand. It returns the process exit code: 0 when every response matched, 1
+// when a response did not match and 2 when a session could not be read.
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(replayCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	url := flags.String("url", "http://mcp.127-0-0-1.sslip.io:8001/mcp", "MCP endpoint of the gateway")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each session")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: mcp-broker-router %s [--url URL] FILE ...\n\n", replayCommand)
+		_, _ = fmt.Fprintln(stderr, "Sends the requests of recorded MCP sessions to a gateway and checks the responses match the recorded expectations.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	sessions := make([]*replay.Session, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		session, err := replay.Load(path)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			return 2
+		}
+		sessions = append(sessions, session)
+	}
+
+	replayer := &replay.Replayer{URL: *url, Client: &http.Client{}}
+	failed := 0
+	for i, session := range sessions {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		err := replayer.Replay(ctx, session)
+		cancel()
+		if err != nil {
+			failed++
+			_, _ = fmt.Fprintf(stdout, "FAIL %s: %v\n", flags.Arg(i), err)
+			continue
+		}
+		_, _ = fmt.Fprintf(stdout, "ok   %s\n", flags.Arg(i))
+	}
+	if failed > 0 {
+		_, _ = fmt.Fprintf(stdout, "%d of %d sessions failed\n", failed, len(sessions))
+		return 1
+	}
+	return 0
+}
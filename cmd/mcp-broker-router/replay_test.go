@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReplay(t *testing.T) {
+	mcpServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	mcpServer.AddTool(mcp.NewTool("test1_time"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("noon"), nil
+	})
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	defer srv.Close()
+
+	session := func(tool string) string {
+		return `{"steps": [
+			{"request": {"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "replay", "version": "0.0.1"}}}},
+			{"request": {"jsonrpc": "2.0", "id": 2, "method": "tools/list"}, "expect": {"result": {"tools": [{"name": "` + tool + `"}]}}}
+		]}`
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pass.json"), []byte(session("test1_time")), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fail.json"), []byte(session("test1_greet")), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{"steps": []}`), 0o600))
+
+	testCases := []struct {
+		Name         string
+		Args         []string
+		ExpectCode   int
+		ExpectStdout string
+		ExpectStderr string
+	}{
+		{
+			Name:         "responses match",
+			Args:         []string{"--url", srv.URL + "/mcp", filepath.Join(dir, "pass.json")},
+			ExpectStdout: "ok   " + filepath.Join(dir, "pass.json"),
+		},
+		{
+			Name:         "response does not match",
+			Args:         []string{"--url", srv.URL + "/mcp", filepath.Join(dir, "pass.json"), filepath.Join(dir, "fail.json")},
+			ExpectCode:   1,
+			ExpectStdout: "1 of 2 sessions failed",
+		},
+		{
+			Name:         "invalid session",
+			Args:         []string{"--url", srv.URL + "/mcp", filepath.Join(dir, "empty.json")},
+			ExpectCode:   2,
+			ExpectStderr: "invalid session: no steps",
+		},
+		{
+			Name:         "no sessions",
+			ExpectCode:   2,
+			ExpectStderr: "Usage: mcp-broker-router replay",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := runReplay(tc.Args, stdout, stderr)
+			require.Equal(t, tc.ExpectCode, code, "stdout: %s stderr: %s", stdout, stderr)
+			require.Contains(t, stdout.String(), tc.ExpectStdout)
+			require.Contains(t, stderr.String(), tc.ExpectStderr)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// certReloader serves the certificate in a pair of PEM files and loads it again when the files change, so a rotated
+// certificate is used for new connections without restarting the broker
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the certificate and key. An error is returned if they cannot be loaded
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate %s and key %s: %w", r.certFile, r.keyFile, err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+// GetCertificate returns the current certificate. It is used as the GetCertificate of a tls.Config
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server tls.Config serving the current certificate
+func (r *certReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Watch reloads the certificate whenever a file in the directories of the certificate or key changes until the
+// context is done. The directories are watched rather than the files as a mounted Kubernetes Secret is updated by
+// swapping a symlink. A certificate that fails to load, such as one only partly written, is logged and the current
+// certificate is kept
+func (r *certReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch tls certificate: %w", err)
+	}
+	dirs := map[string]bool{filepath.Dir(r.certFile): true, filepath.Dir(r.keyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("failed to watch tls certificate directory %s: %w", dir, err)
+		}
+	}
+	go func() {
+		defer func() { _ = watcher.Close() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Chmod) {
+					continue
+				}
+				if err := r.reload(); err != nil {
+					r.logger.Error("failed to reload tls certificate, keeping the current certificate", "error", err)
+					continue
+				}
+				r.logger.Info("reloaded tls certificate", "cert", r.certFile, "changed", event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger.Error("error watching tls certificate", "error", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self signed certificate for 127.0.0.1 with the serial number to the files. The files are
+// written then renamed into place so the certificate is never read half written
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "mcp-broker"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	write := func(path string, block *pem.Block) {
+		tmp := path + ".tmp"
+		require.NoError(t, os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write(keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	write(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestBrokerTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	_, err := newCertReloader(certFile, keyFile, logger)
+	require.Error(t, err, "a missing certificate is an error")
+
+	first := writeCert(t, certFile, keyFile, 1)
+	reloader, err := newCertReloader(certFile, keyFile, logger)
+	require.NoError(t, err)
+	require.NoError(t, reloader.Watch(ctx))
+
+	lis, err := listen(ctx, "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}),
+		TLSConfig:         reloader.TLSConfig(),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() { _ = srv.ServeTLS(lis, "", "") }()
+	defer func() { _ = srv.Shutdown(ctx) }()
+
+	// get returns the serial number of the certificate the server presents to a client trusting the certificate
+	get := func(trusted *x509.Certificate) (int64, error) {
+		pool := x509.NewCertPool()
+		pool.AddCert(trusted)
+		httpClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			DisableKeepAlives: true,
+		}}
+		resp, err := httpClient.Get("https://" + lis.Addr().String() + "/mcp")
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "ok", string(body))
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+	}
+
+	serial, err := get(first)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), serial)
+
+	// a rotated certificate is served to new connections
+	second := writeCert(t, certFile, keyFile, 2)
+	require.Eventually(t, func() bool {
+		serial, err := get(second)
+		return err == nil && serial == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	_, err = get(first)
+	require.Error(t, err, "clients trusting only the old certificate reject the new one")
+
+	// a certificate that cannot be loaded keeps the current one
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	serial, err = get(second)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), serial)
+}
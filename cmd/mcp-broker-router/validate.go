@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kagenti/mcp-gateway/pkg/controller"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// validateCommand is the subcommand that checks MCPServer, MCPVirtualServer and HTTPRoute manifests without a cluster
+const validateCommand = "validate"
+
+// runValidate implements the validate subcommand. It returns the process exit code: 0 when the manifests are valid,
+// 1 when problems were found and 2 when the manifests could not be read.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	namespace := flags.String("namespace", "default", "namespace of the objects in the manifests without one")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: mcp-broker-router %s [--namespace NAMESPACE] FILE|DIR|- ...\n\n", validateCommand)
+		_, _ = fmt.Fprintln(stderr, "Checks MCPServer and MCPVirtualServer manifests with the controller's validation without a cluster.")
+		_, _ = fmt.Fprintln(stderr, "The HTTPRoutes, Services and BackendTLSPolicies the MCPServers reference must be included. Directories are read recursively.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	scheme, err := controller.ManifestScheme()
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to set up scheme: %v\n", err)
+		return 2
+	}
+	var objects []client.Object
+	for _, path := range flags.Args() {
+		decoded, err := readManifests(scheme, path, *namespace)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			return 2
+		}
+		objects = append(objects, decoded...)
+	}
+
+	problems, err := controller.ValidateManifests(context.Background(), scheme, objects)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to validate manifests: %v\n", err)
+		return 2
+	}
+	for _, problem := range problems {
+		_, _ = fmt.Fprintln(stdout, problem.String())
+	}
+	if len(problems) > 0 {
+		_, _ = fmt.Fprintf(stdout, "%d problems found\n", len(problems))
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "%d objects are valid\n", len(objects))
+	return 0
+}
+
+// readManifests decodes the manifests in a file, the YAML files under a directory or stdin when path is -
+func readManifests(scheme *runtime.Scheme, path, namespace string) ([]client.Object, error) {
+	if path == "-" {
+		return controller.DecodeManifests(scheme, os.Stdin, namespace)
+	}
+	var objects []client.Object
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		// a file named on the command line is read whatever its extension
+		if ext := filepath.Ext(file); file != path && ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		decoded, err := controller.DecodeManifests(scheme, f, namespace)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		objects = append(objects, decoded...)
+		return nil
+	})
+	return objects, err
+}
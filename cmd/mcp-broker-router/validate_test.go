@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	route := `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: weather
+spec:
+  hostnames:
+  - weather.mcp.local
+  rules:
+  - backendRefs:
+    - name: weather
+      port: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: weather
+spec:
+  ports:
+  - port: 8080
+`
+	server := `apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: weather
+spec:
+  toolPrefix: weather_
+  targetRef:
+    name: weather
+`
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "routes"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "routes", "weather.yaml"), []byte(route), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "routes", "README.md"), []byte("# not a manifest"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "server.yaml"), []byte(server), 0o600))
+
+	testCases := []struct {
+		Name         string
+		Args         []string
+		ExpectCode   int
+		ExpectStdout string
+		ExpectStderr string
+	}{
+		{
+			Name:         "valid",
+			Args:         []string{"--namespace", "mcp-test", filepath.Join(dir, "server.yaml"), filepath.Join(dir, "routes")},
+			ExpectStdout: "3 objects are valid",
+		},
+		{
+			Name:         "problems found",
+			Args:         []string{filepath.Join(dir, "server.yaml")},
+			ExpectCode:   1,
+			ExpectStdout: "MCPServer default/weather: HTTPRoute default/weather not found",
+		},
+		{
+			Name:         "missing file",
+			Args:         []string{filepath.Join(dir, "missing.yaml")},
+			ExpectCode:   2,
+			ExpectStderr: "no such file or directory",
+		},
+		{
+			Name:         "no manifests",
+			ExpectCode:   2,
+			ExpectStderr: "Usage: mcp-broker-router validate",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			require.Equal(t, tc.ExpectCode, runValidate(tc.Args, &stdout, &stderr))
+			require.Contains(t, stdout.String(), tc.ExpectStdout)
+			require.Contains(t, stderr.String(), tc.ExpectStderr)
+		})
+	}
+}
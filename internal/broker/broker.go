@@ -3,11 +3,16 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"slices"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
@@ -18,12 +23,32 @@ import (
 
 var _ config.Observer = &mcpBrokerImpl{}
 
+// ErrServerNotFound is returned for requests about a server the broker does not know
+var ErrServerNotFound = errors.New("server not found")
+
+// errSessionNotCreated is returned to a client initializing when no gateway session id could be generated for it
+var errSessionNotCreated = errors.New("the gateway could not create a session, for example because the generated session id is already in use. Retry initialize")
+
 // MCPBroker manages a set of MCP servers and their sessions
 type MCPBroker interface {
 
 	// Returns tool annotations for a given tool name
 	ToolAnnotations(serverID config.UpstreamMCPID, tool string) (mcp.ToolAnnotation, bool)
 
+	// UpstreamToolName returns the upstream name of a tool advertised by the gateway for the given server
+	UpstreamToolName(serverID config.UpstreamMCPID, tool string) (string, bool)
+
+	// ToolInputSchema returns the input schema of an upstream tool of the given server
+	ToolInputSchema(serverID config.UpstreamMCPID, tool string) (mcp.ToolInputSchema, bool)
+
+	// ServingFallbackTools returns true while the given server is unavailable and its fallback tools are advertised in
+	// its place
+	ServingFallbackTools(serverID config.UpstreamMCPID) bool
+
+	// WaitForDiscovery waits until the first discovery of the given server's tools has finished. It returns false if
+	// ctx is done first
+	WaitForDiscovery(ctx context.Context, serverID config.UpstreamMCPID) bool
+
 	// MCPServer gets an MCP server that federates the upstreams known to this MCPBroker
 	MCPServer() *server.MCPServer
 
@@ -36,9 +61,32 @@ type MCPBroker interface {
 	// ValidateAllServers performs comprehensive validation of all registered servers and returns status
 	ValidateAllServers() StatusResponse
 
+	// ProbeServer checks the given server now rather than on its next health check and returns once its status is updated
+	ProbeServer(ctx context.Context, serverID config.UpstreamMCPID) error
+
 	// HandleStatusRequest handles HTTP status endpoint requests
 	HandleStatusRequest(w http.ResponseWriter, r *http.Request)
 
+	// Snapshot returns the state of the broker, with credentials redacted, for support bundles
+	Snapshot() Snapshot
+
+	// SubscribeResource subscribes a gateway session to updates of a resource on the upstream that accepts the subscription
+	SubscribeResource(ctx context.Context, sessionID, uri string) error
+
+	// UnsubscribeResource removes a gateway session's subscription to a resource
+	UnsubscribeResource(ctx context.Context, sessionID, uri string) error
+
+	// ResourceTemplateServer returns the name of the server with a resource template matching the uri and the uri
+	// to read from that server
+	ResourceTemplateServer(uri string) (serverName string, upstreamURI string, ok bool)
+
+	// RemoveSession removes any state held for a gateway session that has ended
+	RemoveSession(ctx context.Context, sessionID string)
+
+	// Ready returns a channel that is closed once the first config has been applied and the first discovery of the
+	// servers in it has finished
+	Ready() <-chan struct{}
+
 	// Shutdown closes any resources associated with this Broker
 	Shutdown(ctx context.Context) error
 
@@ -68,6 +116,72 @@ type mcpBrokerImpl struct {
 
 	// managerTickerInterval is the interval for MCP manager backend health checks
 	managerTickerInterval time.Duration
+
+	// maxTools is the maximum number of tools advertised by the gateway. 0 means no limit
+	maxTools int
+
+	// initializeAttempts is the number of times managers send initialize to an upstream before connecting fails
+	initializeAttempts int
+
+	// listenerBackoff controls how managers reopen the notification stream of an upstream when it drops
+	listenerBackoff upstream.ListenerBackoff
+
+	// toolPollInterval is how often managers list the tools of upstreams that do not send tool list changed
+	// notifications. 0 lists them on each health check
+	toolPollInterval time.Duration
+
+	// identityChangeBehavior is how managers react to an upstream reporting a different serverInfo when reconnected
+	identityChangeBehavior string
+	// flushServerSessions drops the upstream sessions held with a server that is reregistered
+	flushServerSessions func(ctx context.Context, serverName string) (int, error)
+
+	// toolDescriptionSuffix when set is rendered for each server and appended to the descriptions of its tools
+	toolDescriptionSuffix *template.Template
+
+	// toolCatalog when set enriches the _meta of listed tools
+	toolCatalog *ToolCatalog
+	// toolsListChangedNotifications sends notifications/tools/list_changed to clients when the advertised tools change
+	toolsListChangedNotifications bool
+	// toolBudget is what the managers add tools to. It enforces maxTools in front of the listening MCP server
+	toolBudget *toolBudget
+	// toolOwners when set records the server owning each tool name so conflicts between servers are settled the
+	// same way across restarts and config reloads
+	toolOwners upstream.ToolOwnerStore
+	// serverNames are the names of the servers in the last config received. protected by serverNamesLock
+	serverNames     map[string]struct{}
+	serverNamesLock sync.RWMutex
+
+	// configErrors are the problems found in the last config received. protected by mcpLock
+	configErrors config.ValidationErrors
+	// skippedServers are the server entries left out of the last config received. protected by mcpLock
+	skippedServers config.ValidationErrors
+
+	// resourceSubscriptions tracks which gateway sessions are subscribed to which upstream resources
+	resourceSubscriptions *resourceSubscriptions
+
+	// clientInfo is the clientInfo each gateway session sent in initialize. protected by clientLock
+	clientInfo map[string]mcp.Implementation
+	// clientToolFilters limit the tools listed to matching clients. protected by clientLock
+	clientToolFilters []*config.ClientToolFilter
+	clientLock        sync.RWMutex
+
+	// tenancy isolates the tools of servers owned by different tenants. protected by tenancyLock
+	tenancy *config.Tenancy
+	// serverTenants is the tenant owning each server. protected by tenancyLock
+	serverTenants map[config.UpstreamMCPID]string
+	tenancyLock   sync.RWMutex
+
+	// sessionIdentities stores the subject and tenant of each client that initializes. nil records none
+	sessionIdentities SessionIdentityStore
+	// subjectHeader is the request header holding the subject the gateway's authentication identified the client as
+	subjectHeader string
+
+	// notificationRetries resends list changed notifications dropped for slow clients
+	notificationRetries *notificationRetries
+
+	// ready is closed once the first config has been applied and its servers discovered
+	ready     chan struct{}
+	readyOnce sync.Once
 }
 
 // this ensures that mcpBrokerImpl implements the MCPBroker interface
@@ -94,13 +208,103 @@ func WithManagerTickerInterval(interval time.Duration) func(mb *mcpBrokerImpl) {
 	}
 }
 
+// WithMaxTools sets the maximum number of tools advertised by the gateway. 0 means no limit
+func WithMaxTools(maxTools int) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.maxTools = maxTools
+	}
+}
+
+// WithInitializeAttempts sets the number of times initialize is sent to an upstream before the connection attempt
+// fails and is retried on the next health check
+func WithInitializeAttempts(attempts int) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.initializeAttempts = attempts
+	}
+}
+
+// WithListenerBackoff sets how the stream an upstream sends notifications on is reopened when it drops
+func WithListenerBackoff(backoff upstream.ListenerBackoff) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.listenerBackoff = backoff
+	}
+}
+
+// WithToolPollInterval sets how often the tools of upstreams that do not send tool list changed notifications are
+// listed. 0 lists them on each health check
+func WithToolPollInterval(interval time.Duration) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.toolPollInterval = interval
+	}
+}
+
+// WithUpstreamIdentityChange sets how the broker reacts to an upstream reporting a different serverInfo name or
+// version when it is reconnected, which means another server has replaced it behind the same URL. With
+// upstream.IdentityChangeReregister the server's tools are discovered again and flush, when set, is called to drop
+// the upstream sessions clients hold with the server it replaced. It defaults to upstream.IdentityChangeLog
+func WithUpstreamIdentityChange(behavior string, flush func(ctx context.Context, serverName string) (int, error)) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.identityChangeBehavior = behavior
+		mb.flushServerSessions = flush
+	}
+}
+
+// ToolDescriptionSuffixData is what the tool description suffix template is rendered with for each server
+type ToolDescriptionSuffixData struct {
+	// Server is the name of the server
+	Server string
+	// Prefix is the tool prefix of the server
+	Prefix string
+}
+
+// WithToolDescriptionSuffix sets a template rendered with ToolDescriptionSuffixData for each server and appended to
+// the descriptions of its tools, e.g. " (via {{.Server}})"
+func WithToolDescriptionSuffix(suffix *template.Template) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.toolDescriptionSuffix = suffix
+	}
+}
+
+// WithToolCatalog sets the catalog the _meta of listed tools is enriched from
+func WithToolCatalog(catalog *ToolCatalog) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.toolCatalog = catalog
+	}
+}
+
+// WithToolsListChangedNotifications sets whether clients are sent notifications/tools/list_changed when the
+// advertised tools change. When disabled the gateway does not advertise listChanged for tools and clients poll
+// tools/list, which is still kept up to date
+func WithToolsListChangedNotifications(enabled bool) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.toolsListChangedNotifications = enabled
+	}
+}
+
+// WithToolOwners sets the store recording which server owns each tool name. When two servers advertise a tool with
+// the same name the server that registered it first keeps it after a restart or config reload, whichever connects
+// first. The store should be shared by the broker's replicas
+func WithToolOwners(store upstream.ToolOwnerStore) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.toolOwners = store
+	}
+}
+
 // NewBroker creates a new MCPBroker accepts optional config functions such as WithEnforceToolFilter
 func NewBroker(logger *slog.Logger, opts ...func(*mcpBrokerImpl)) MCPBroker {
 	mcpBkr := &mcpBrokerImpl{
-		mcpServers:            map[config.UpstreamMCPID]*upstream.MCPManager{},
-		logger:                logger,
-		virtualServers:        map[string]*config.VirtualServer{},
-		managerTickerInterval: time.Second * 60,
+		mcpServers:             map[config.UpstreamMCPID]*upstream.MCPManager{},
+		logger:                 logger,
+		virtualServers:         map[string]*config.VirtualServer{},
+		managerTickerInterval:  time.Second * 60,
+		initializeAttempts:     upstream.DefaultInitializeAttempts,
+		identityChangeBehavior: upstream.IdentityChangeLog,
+		listenerBackoff:        upstream.DefaultListenerBackoff,
+		resourceSubscriptions:  newResourceSubscriptions(),
+		clientInfo:             map[string]mcp.Implementation{},
+		ready:                  make(chan struct{}),
+
+		toolsListChangedNotifications: true,
 	}
 
 	for _, option := range opts {
@@ -128,69 +332,259 @@ func NewBroker(logger *slog.Logger, opts ...func(*mcpBrokerImpl)) MCPBroker {
 		slog.Info("MCP server error", "method", method, "error", err)
 	})
 
+	// notifications are queued per session without blocking, a full queue is reported here
+	hooks.AddOnError(func(_ context.Context, _ any, _ mcp.MCPMethod, message any, err error) {
+		if !errors.Is(err, server.ErrNotificationChannelBlocked) {
+			return
+		}
+		fields, _ := message.(map[string]any)
+		sessionID, _ := fields["sessionID"].(string)
+		notificationMethod, _ := fields["method"].(string)
+		mcpBkr.notificationRetries.dropped(sessionID, notificationMethod)
+	})
+
+	// a client the gateway could not generate a session id for, for example because the generated id was already in
+	// use and duplicates are rejected, is refused rather than initialized without a session
+	hooks.AddOnRequestInitialization(func(ctx context.Context, _ any, _ any) error {
+		if session := server.ClientSessionFromContext(ctx); session != nil && session.SessionID() == "" {
+			return errSessionNotCreated
+		}
+		return nil
+	})
+
+	hooks.AddAfterInitialize(func(ctx context.Context, _ any, message *mcp.InitializeRequest, result *mcp.InitializeResult) {
+		mcpBkr.recordClientInfo(ctx, message.Params.ClientInfo)
+		mcpBkr.recordSessionIdentity(ctx, message.Header)
+		mcpBkr.negotiateProtocolVersion(message.Params.ProtocolVersion, result)
+		mcpBkr.applyVirtualServerInfo(message.Header, result)
+		mcpBkr.applyUpstreamCapabilities(result)
+	})
+
 	hooks.AddAfterListTools(func(ctx context.Context, id any, message *mcp.ListToolsRequest, result *mcp.ListToolsResult) {
 		mcpBkr.FilterTools(ctx, id, message, result)
 	})
 
+	hooks.AddAfterListResourceTemplates(func(_ context.Context, _ any, _ *mcp.ListResourceTemplatesRequest, result *mcp.ListResourceTemplatesResult) {
+		mcpBkr.listResourceTemplates(result)
+	})
+
 	mcpBkr.listeningMCPServer = server.NewMCPServer(
 		"Kagenti MCP Broker",
 		"0.0.1",
 		server.WithHooks(hooks),
-		server.WithToolCapabilities(true),
+		// tools list changed notifications are sent to every client by the server whenever tools are added or deleted
+		server.WithToolCapabilities(mcpBkr.toolsListChangedNotifications),
+		// concrete resources are not federated but resource templates are and subscriptions are relayed to the
+		// upstream that serves the resource
+		server.WithResourceCapabilities(true, false),
 	)
+	mcpBkr.notificationRetries = newNotificationRetries(func(sessionID, method string) error {
+		return mcpBkr.listeningMCPServer.SendNotificationToSpecificClient(sessionID, method, nil)
+	}, logger.With("sub-component", "notifications"))
+	mcpBkr.toolBudget = newToolBudget(mcpBkr.listeningMCPServer, mcpBkr.maxTools, logger.With("sub-component", "tool-budget"))
 	return mcpBkr
 }
 
 func (m *mcpBrokerImpl) OnConfigChange(ctx context.Context, conf *config.MCPServersConfig) {
-	m.logger.Debug("Broker OnConfigChange start", "Total managers for upstream mcp servers", len(m.mcpServers), "total servers", len(conf.Servers))
-	// unregister decommissioned servers
 	m.mcpLock.Lock()
 	defer m.mcpLock.Unlock()
+	m.logger.Debug("Broker OnConfigChange start", "Total managers for upstream mcp servers", len(m.mcpServers), "total servers", len(conf.Servers))
+	// invalid servers are still registered so their connection errors are also reported
+	m.configErrors = conf.Validate()
+	m.skippedServers = conf.SkippedServers
 
-	for serverID := range m.mcpServers {
-		if !slices.ContainsFunc(conf.Servers, func(s *config.MCPServer) bool {
-			return serverID == s.ID()
-		}) {
-			m.logger.Info("un-register upstream server", "server id", serverID)
-			if man, ok := m.mcpServers[serverID]; ok {
-				m.logger.Info("stopping manager for unregistered server", "server id", serverID)
-				man.Stop()
-				delete(m.mcpServers, serverID)
-			}
+	registered := make(map[config.UpstreamMCPID]config.MCPServer, len(m.mcpServers))
+	for serverID, man := range m.mcpServers {
+		registered[serverID] = man.MCP.GetConfig()
+	}
+	changes := diffServers(registered, conf.Servers)
+	serverNames := make(map[string]struct{}, len(conf.Servers))
+	for _, mcpServer := range conf.Servers {
+		if mcpServer != nil {
+			serverNames[mcpServer.Name] = struct{}{}
 		}
 	}
-	// ensure new servers registered
+	m.serverNamesLock.Lock()
+	m.serverNames = serverNames
+	m.serverNamesLock.Unlock()
+	// managers of unchanged servers are left running so their connection and tools are not disturbed
+	for _, serverID := range changes.removed {
+		m.logger.Info("stopping manager for unregistered server", "server id", serverID)
+		m.stopManager(serverID)
+	}
+	for _, mcpServer := range changes.changed {
+		m.logger.Info("server config changed, replacing manager", "server id", mcpServer.ID())
+		m.stopManager(mcpServer.ID())
+		m.startManager(ctx, mcpServer)
+	}
+	for _, mcpServer := range changes.added {
+		m.startManager(ctx, mcpServer)
+	}
+	m.logger.Info("applied server config", "added", len(changes.added), "changed", len(changes.changed), "removed", len(changes.removed), "unchanged", changes.unchanged)
 
+	m.toolBudget.setPriorities(budgetPriorities(conf.Servers))
+
+	m.clientLock.Lock()
+	m.clientToolFilters = conf.ClientToolFilters
+	m.clientLock.Unlock()
+	serverTenants := make(map[config.UpstreamMCPID]string, len(conf.Servers))
 	for _, mcpServer := range conf.Servers {
-		man, ok := m.mcpServers[mcpServer.ID()]
-		if ok {
-			m.logger.Info("Server is registered", "mcpID", mcpServer.ID())
-			// already have a manger
-			if mcpServer.ConfigChanged(man.MCP.GetConfig()) {
-				// todo prob could look at just updating the config
-				m.logger.Info("Server Config Changed removing manager", "mcpID", mcpServer.ID())
-				man.Stop()
-				delete(m.mcpServers, mcpServer.ID())
-			}
-		}
-		// check if we need to setup a new manager
-		if _, ok := m.mcpServers[mcpServer.ID()]; !ok {
-			m.logger.Info("starting new manager", "server id", mcpServer.ID())
-			manager := upstream.NewUpstreamMCPManager(upstream.NewUpstreamMCP(mcpServer), m.listeningMCPServer, m.logger.With("sub-component", "mcp-manager"), m.managerTickerInterval)
-			m.mcpServers[mcpServer.ID()] = manager
-			go func() {
-				m.logger.Info("Starting manager for", "mcpID", mcpServer.ID())
-				manager.Start(ctx)
-			}()
+		if mcpServer != nil {
+			serverTenants[mcpServer.ID()] = mcpServer.Tenant
 		}
 	}
+	m.tenancyLock.Lock()
+	m.tenancy = conf.Tenancy
+	m.serverTenants = serverTenants
+	m.tenancyLock.Unlock()
 	// register virtual servers
-	m.vsLock.Lock()
+	// virtual servers are replaced so those removed from the config are no longer served
+	virtualServers := make(map[string]*config.VirtualServer, len(conf.VirtualServers))
 	for _, vs := range conf.VirtualServers {
-		m.virtualServers[vs.Name] = vs
+		if vs != nil {
+			virtualServers[vs.Name] = vs
+		}
 	}
+	m.vsLock.Lock()
+	m.virtualServers = virtualServers
 	m.vsLock.Unlock()
 	m.logger.Debug("Broker OnConfigChange done", "Total managers for upstream mcp servers", len(m.mcpServers), "total servers", len(conf.Servers))
+	m.readyOnce.Do(func() {
+		m.awaitDiscovery(slices.Collect(maps.Values(m.mcpServers)))
+	})
+}
+
+// awaitDiscovery closes ready once the first discovery of each of the managers has finished, whether or not it succeeded
+func (m *mcpBrokerImpl) awaitDiscovery(managers []*upstream.MCPManager) {
+	go func() {
+		for _, man := range managers {
+			<-man.Discovered()
+		}
+		m.logger.Info("initial discovery finished, the gateway is ready", "servers", len(managers))
+		close(m.ready)
+	}()
+}
+
+// Ready returns a channel that is closed once the first config has been applied and the first discovery of the
+// servers in it has finished
+func (m *mcpBrokerImpl) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// serverChanges is the difference between the registered servers and the servers in a new config
+type serverChanges struct {
+	added     []*config.MCPServer
+	changed   []*config.MCPServer
+	removed   []config.UpstreamMCPID
+	unchanged int
+}
+
+// diffServers compares the config of the registered servers with the servers in a new config. A server is changed
+// when ConfigChanged reports a difference that needs a new connection, anything else leaves it unchanged.
+// Servers with a duplicate id are only considered once.
+func diffServers(registered map[config.UpstreamMCPID]config.MCPServer, servers []*config.MCPServer) serverChanges {
+	var changes serverChanges
+	seen := make(map[config.UpstreamMCPID]struct{}, len(servers))
+	for _, mcpServer := range servers {
+		if mcpServer == nil {
+			continue
+		}
+		serverID := mcpServer.ID()
+		if _, ok := seen[serverID]; ok {
+			continue
+		}
+		seen[serverID] = struct{}{}
+		existing, ok := registered[serverID]
+		switch {
+		case !ok:
+			changes.added = append(changes.added, mcpServer)
+		case mcpServer.ConfigChanged(existing):
+			changes.changed = append(changes.changed, mcpServer)
+		default:
+			changes.unchanged++
+		}
+	}
+	for serverID := range registered {
+		if _, ok := seen[serverID]; !ok {
+			changes.removed = append(changes.removed, serverID)
+		}
+	}
+	slices.Sort(changes.removed)
+	return changes
+}
+
+// startManager starts a manager for the server. It must be called with the mcpLock held
+func (m *mcpBrokerImpl) startManager(ctx context.Context, mcpServer *config.MCPServer) {
+	m.logger.Info("starting new manager", "server id", mcpServer.ID())
+	var upstreamMCP upstream.MCP
+	if mcpServer.IsSynthetic() {
+		upstreamMCP = upstream.NewSyntheticMCP(mcpServer)
+	} else {
+		realMCP := upstream.NewUpstreamMCP(mcpServer)
+		realMCP.InitializeAttempts = m.initializeAttempts
+		realMCP.ListenerBackoff = m.listenerBackoff
+		upstreamMCP = realMCP
+	}
+	manager := upstream.NewUpstreamMCPManager(upstreamMCP, m.toolBudget, m.logger.With("sub-component", "mcp-manager"), m.managerTickerInterval)
+	manager.SetToolPollInterval(m.toolPollInterval)
+	if suffix, err := m.renderToolDescriptionSuffix(mcpServer); err != nil {
+		m.logger.Error("failed to render the tool description suffix, descriptions are left unchanged", "server id", mcpServer.ID(), "error", err)
+	} else {
+		manager.SetToolDescriptionSuffix(suffix)
+	}
+	manager.OnResourceUpdated(m.relayResourceUpdated)
+	manager.SetIdentityChangeBehavior(m.identityChangeBehavior, m.upstreamReplaced)
+	if m.toolOwners != nil {
+		manager.SetToolOwners(m.toolOwners, m.serverConfigured)
+	}
+	m.mcpServers[mcpServer.ID()] = manager
+	go manager.Start(ctx)
+}
+
+// serverConfigured reports whether a server with the name is in the last config received
+func (m *mcpBrokerImpl) serverConfigured(serverName string) bool {
+	m.serverNamesLock.RLock()
+	defer m.serverNamesLock.RUnlock()
+	_, ok := m.serverNames[serverName]
+	return ok
+}
+
+// upstreamReplaced drops the upstream sessions held with a server that reported a different identity so clients
+// initialize again with the server now behind its URL
+func (m *mcpBrokerImpl) upstreamReplaced(ctx context.Context, serverName string) {
+	if m.flushServerSessions == nil {
+		return
+	}
+	flushed, err := m.flushServerSessions(ctx, serverName)
+	if err != nil {
+		m.logger.Error("failed to flush the sessions of a replaced upstream", "server", serverName, "error", err)
+		return
+	}
+	m.logger.Info("flushed the sessions of a replaced upstream", "server", serverName, "sessions", flushed)
+}
+
+// renderToolDescriptionSuffix returns the suffix appended to the descriptions of the server's tools. It is empty
+// when no suffix is configured
+func (m *mcpBrokerImpl) renderToolDescriptionSuffix(mcpServer *config.MCPServer) (string, error) {
+	if m.toolDescriptionSuffix == nil {
+		return "", nil
+	}
+	var suffix strings.Builder
+	if err := m.toolDescriptionSuffix.Execute(&suffix, ToolDescriptionSuffixData{Server: mcpServer.Name, Prefix: mcpServer.ToolPrefix}); err != nil {
+		return "", err
+	}
+	return suffix.String(), nil
+}
+
+// stopManager stops the server's manager and drops its resource subscriptions. It must be called with the mcpLock held
+func (m *mcpBrokerImpl) stopManager(serverID config.UpstreamMCPID) {
+	man, ok := m.mcpServers[serverID]
+	if !ok {
+		return
+	}
+	man.Stop()
+	delete(m.mcpServers, serverID)
+	m.dropResourceSubscriptions(serverID)
 }
 
 func (m *mcpBrokerImpl) RegisteredMCPServers() map[config.UpstreamMCPID]*upstream.MCPManager {
@@ -210,6 +604,89 @@ func (m *mcpBrokerImpl) GetVirtualSeverByHeader(namespaceName string) (config.Vi
 	return config.VirtualServer{}, fmt.Errorf("virtual server %s not found", namespaceName)
 }
 
+// applyVirtualServerInfo sets the title and description of the virtual server selected by the x-mcp-virtualserver
+// header as the serverInfo title and instructions of the initialize result, so agents know what the curated tools are for
+func (m *mcpBrokerImpl) applyVirtualServerInfo(headers http.Header, result *mcp.InitializeResult) {
+	headerValues, ok := headers[virtualMCPHeader]
+	if !ok || len(headerValues) != 1 || result == nil {
+		return
+	}
+	vs, err := m.GetVirtualSeverByHeader(headerValues[0])
+	if err != nil {
+		m.logger.Debug("initialize for unknown virtual server", "virtualServer", headerValues[0], "error", err)
+		return
+	}
+	if vs.Title != "" {
+		result.ServerInfo.Title = vs.Title
+	}
+	if vs.Description != "" {
+		result.Instructions = vs.Description
+	}
+}
+
+// SupportedProtocolVersions are the MCP protocol versions the gateway negotiates with clients, newest first. They are
+// listed here rather than taken from the MCP library so a library upgrade does not change what clients are offered
+var SupportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// negotiateProtocolVersion sets the protocol version of the initialize result. A version the gateway supports is
+// accepted as the client requested it. Otherwise the gateway answers with its latest version and, as the spec has it,
+// the client decides whether it can continue with that version
+func (m *mcpBrokerImpl) negotiateProtocolVersion(requested string, result *mcp.InitializeResult) {
+	if result == nil {
+		return
+	}
+	if slices.Contains(SupportedProtocolVersions, requested) {
+		result.ProtocolVersion = requested
+		return
+	}
+	m.logger.Debug("client requested an unsupported protocol version, offering the latest", "requested", requested, "offered", SupportedProtocolVersions[0])
+	result.ProtocolVersion = SupportedProtocolVersions[0]
+}
+
+// applyUpstreamCapabilities adds the capabilities advertised by any of the ready upstreams to those of the gateway
+// so clients learn what the servers behind it support. Each initialize sees the servers registered at the time
+func (m *mcpBrokerImpl) applyUpstreamCapabilities(result *mcp.InitializeResult) {
+	if result == nil {
+		return
+	}
+	m.mcpLock.RLock()
+	defer m.mcpLock.RUnlock()
+	for _, man := range m.mcpServers {
+		capabilities, ready := man.Capabilities()
+		if !ready {
+			continue
+		}
+		mergeCapabilities(&result.Capabilities, capabilities)
+	}
+}
+
+// mergeCapabilities adds the capabilities of an upstream to the gateway's. The gateway keeps its own tools and
+// resources capabilities as it serves those itself
+func mergeCapabilities(gateway *mcp.ServerCapabilities, upstream mcp.ServerCapabilities) {
+	if upstream.Logging != nil && gateway.Logging == nil {
+		gateway.Logging = &struct{}{}
+	}
+	if upstream.Prompts != nil && gateway.Prompts == nil {
+		gateway.Prompts = &struct {
+			ListChanged bool `json:"listChanged,omitempty"`
+		}{}
+	}
+	if upstream.Resources != nil && gateway.Resources == nil {
+		gateway.Resources = &struct {
+			Subscribe   bool `json:"subscribe,omitempty"`
+			ListChanged bool `json:"listChanged,omitempty"`
+		}{}
+	}
+	if upstream.Sampling != nil && gateway.Sampling == nil {
+		gateway.Sampling = &struct{}{}
+	}
+	if upstream.Tools != nil && gateway.Tools == nil {
+		gateway.Tools = &struct {
+			ListChanged bool `json:"listChanged,omitempty"`
+		}{}
+	}
+}
+
 func (m *mcpBrokerImpl) ToolAnnotations(serverID config.UpstreamMCPID, tool string) (mcp.ToolAnnotation, bool) {
 	upstream, ok := m.mcpServers[serverID]
 	if !ok {
@@ -222,6 +699,81 @@ func (m *mcpBrokerImpl) ToolAnnotations(serverID config.UpstreamMCPID, tool stri
 	return mcp.ToolAnnotation{}, false
 }
 
+// ToolInputSchema returns the input schema of the server's tool, by its upstream name. ok is false if the server is
+// not registered, does not have the tool or the tool's schema cannot be decoded
+func (m *mcpBrokerImpl) ToolInputSchema(serverID config.UpstreamMCPID, tool string) (mcp.ToolInputSchema, bool) {
+	m.mcpLock.RLock()
+	upstream, ok := m.mcpServers[serverID]
+	m.mcpLock.RUnlock()
+	if !ok {
+		return mcp.ToolInputSchema{}, false
+	}
+	t := upstream.GetManagedTool(tool)
+	if t == nil {
+		return mcp.ToolInputSchema{}, false
+	}
+	if len(t.RawInputSchema) == 0 {
+		return t.InputSchema, true
+	}
+	var schema mcp.ToolInputSchema
+	if err := json.Unmarshal(t.RawInputSchema, &schema); err != nil {
+		return mcp.ToolInputSchema{}, false
+	}
+	return schema, true
+}
+
+// UpstreamToolName returns the upstream name of a tool advertised by the gateway. ok is false if the server is not
+// registered or does not advertise the tool
+func (m *mcpBrokerImpl) UpstreamToolName(serverID config.UpstreamMCPID, tool string) (string, bool) {
+	m.mcpLock.RLock()
+	upstream, ok := m.mcpServers[serverID]
+	m.mcpLock.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return upstream.UpstreamToolName(tool)
+}
+
+// ServingFallbackTools returns true while the server is unavailable and the fallback tools of its config are advertised
+// in its place. It is false for servers that are not registered
+func (m *mcpBrokerImpl) ServingFallbackTools(serverID config.UpstreamMCPID) bool {
+	m.mcpLock.RLock()
+	upstream, ok := m.mcpServers[serverID]
+	m.mcpLock.RUnlock()
+	if !ok {
+		return false
+	}
+	return upstream.ServingFallbackTools()
+}
+
+// WaitForDiscovery waits until the manager of the server has finished its first attempt to discover the server's
+// tools, whether or not it succeeded. Servers without a manager are not waited for
+func (m *mcpBrokerImpl) WaitForDiscovery(ctx context.Context, serverID config.UpstreamMCPID) bool {
+	m.mcpLock.RLock()
+	upstream, ok := m.mcpServers[serverID]
+	m.mcpLock.RUnlock()
+	if !ok || upstream == nil {
+		return true
+	}
+	select {
+	case <-upstream.Discovered():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ProbeServer checks the given server now rather than on its next health check and returns once its status is updated
+func (m *mcpBrokerImpl) ProbeServer(ctx context.Context, serverID config.UpstreamMCPID) error {
+	m.mcpLock.RLock()
+	upstream, ok := m.mcpServers[serverID]
+	m.mcpLock.RUnlock()
+	if !ok || upstream == nil {
+		return ErrServerNotFound
+	}
+	return upstream.Probe(ctx)
+}
+
 func (m *mcpBrokerImpl) Shutdown(_ context.Context) error {
 	// Close the long-running notification channel
 	for _, mcpServer := range m.mcpServers {
@@ -232,6 +784,27 @@ func (m *mcpBrokerImpl) Shutdown(_ context.Context) error {
 	return nil
 }
 
+// RemoveSession removes the client info, pending notifications and resource subscriptions held for the session
+func (m *mcpBrokerImpl) RemoveSession(ctx context.Context, sessionID string) {
+	m.clientLock.Lock()
+	delete(m.clientInfo, sessionID)
+	m.clientLock.Unlock()
+	m.notificationRetries.removeSession(sessionID)
+	m.removeSessionSubscriptions(ctx, sessionID)
+}
+
+// recordClientInfo keeps the clientInfo sent in initialize as the streamable sessions only last for a request
+func (m *mcpBrokerImpl) recordClientInfo(ctx context.Context, clientInfo mcp.Implementation) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil || session.SessionID() == "" {
+		return
+	}
+	m.logger.DebugContext(ctx, "client initialized", "gatewaySessionID", session.SessionID(), "clientName", clientInfo.Name, "clientVersion", clientInfo.Version)
+	m.clientLock.Lock()
+	defer m.clientLock.Unlock()
+	m.clientInfo[session.SessionID()] = clientInfo
+}
+
 // MCPServer is a listening MCP server that federates the endpoints
 func (m *mcpBrokerImpl) MCPServer() *server.MCPServer {
 	return m.listeningMCPServer
@@ -257,8 +830,22 @@ func (m *mcpBrokerImpl) ValidateAllServers() StatusResponse {
 
 	m.logger.Debug("ValidateAllServers: checking servers", "# servers", len(m.mcpServers))
 
+	m.mcpLock.RLock()
+	response.ConfigErrors = m.configErrors
+	response.SkippedServers = m.skippedServers
+	m.mcpLock.RUnlock()
+	if len(response.ConfigErrors) > 0 || len(response.SkippedServers) > 0 {
+		response.OverallValid = false
+	}
+
 	for _, upstream := range m.RegisteredMCPServers() {
 		status := upstream.GetStatus()
+		status.DroppedTools = m.toolBudget.droppedTools(string(upstream.MCP.ID()))
+		status.TruncatedTools = len(status.DroppedTools)
+		status.AdvertisedTools = m.toolBudget.advertisedTools(string(upstream.MCP.ID()))
+		if status.TruncatedTools > 0 {
+			response.TruncatedServers = append(response.TruncatedServers, upstream.MCPName())
+		}
 		response.Servers = append(response.Servers, status)
 
 		if !status.Ready {
@@ -273,6 +860,9 @@ func (m *mcpBrokerImpl) ValidateAllServers() StatusResponse {
 		"totalServers", response.TotalServers,
 		"healthyServers", response.HealthyServers,
 		"unhealthyServers", response.UnHealthyServers,
+		"truncatedServers", response.TruncatedServers,
+		"configErrors", len(response.ConfigErrors),
+		"skippedServers", len(response.SkippedServers),
 		"overallValid", response.OverallValid)
 
 	return response
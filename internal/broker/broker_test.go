@@ -4,16 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"text/template"
 	"time"
 
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/tests/server1"
 	"github.com/kagenti/mcp-gateway/internal/tests/server2"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,14 +36,21 @@ const (
 
 	// MCPAddrForgetAddr is the URL the client will use to force the server to forget a session
 	MCPAddrForgetAddr = "http://localhost:8088/admin/forget"
+
+	// SDKMCPPort is the port the test server built with the official go-sdk listens on
+	SDKMCPPort = "8089"
+
+	// SDKMCPAddr is the URL the client will use to contact the go-sdk test server
+	SDKMCPAddr = "http://localhost:8089/mcp"
 )
 
 var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-// TestMain starts an MCP server that we will run actual tests against
+// TestMain starts the MCP servers that we will run actual tests against, one built with each MCP SDK
 func TestMain(m *testing.M) {
-	// Start an MCP server to test our broker client logic
-	startFunc, shutdownFunc, err := server2.RunServer("http", MCPPort)
+	// Start an MCP server to test our broker client logic. It tracks its sessions so, like the go-sdk server, it
+	// answers requests for a session it has ended with a 404
+	startFunc, shutdownFunc, err := server2.RunServer("http", MCPPort, server.WithSessionIdManager(&server.InsecureStatefulSessionIdManager{}))
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Server setup error: %v\n", err)
@@ -45,6 +62,16 @@ func TestMain(m *testing.M) {
 		_ = startFunc()
 	}()
 
+	sdkStartFunc, sdkShutdownFunc, err := server1.RunServer(SDKMCPPort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Server setup error: %v\n", err)
+		os.Exit(1)
+	}
+
+	go func() {
+		_ = sdkStartFunc()
+	}()
+
 	// wait for server to be ready
 	time.Sleep(100 * time.Millisecond)
 
@@ -56,6 +83,9 @@ func TestMain(m *testing.M) {
 		// Don't fail if the server doesn't shut down; it might have open clients
 		// os.Exit(1)
 	}
+	if err := sdkShutdownFunc(); err != nil {
+		fmt.Fprintf(os.Stderr, "Server shutdown error: %v\n", err)
+	}
 
 	os.Exit(code)
 }
@@ -108,6 +138,156 @@ func TestOnConfigChange(t *testing.T) {
 	_ = b.Shutdown(context.Background())
 }
 
+func TestDiffServers(t *testing.T) {
+	server1 := &config.MCPServer{Name: "test/server1", URL: "http://server1:8080/mcp", ToolPrefix: "s1_", Hostname: "server1.mcp.local"}
+	server2 := &config.MCPServer{Name: "test/server2", URL: "http://server2:8080/mcp", ToolPrefix: "s2_", Hostname: "server2.mcp.local"}
+	server3 := &config.MCPServer{Name: "test/server3", URL: "http://server3:8080/mcp", ToolPrefix: "s3_", Hostname: "server3.mcp.local"}
+	modified := func(mutate func(s *config.MCPServer)) *config.MCPServer {
+		s := *server1
+		mutate(&s)
+		return &s
+	}
+	registered := map[config.UpstreamMCPID]config.MCPServer{
+		server1.ID(): *server1,
+		server2.ID(): *server2,
+	}
+
+	testCases := []struct {
+		Name            string
+		Servers         []*config.MCPServer
+		ExpectAdded     []*config.MCPServer
+		ExpectChanged   []*config.MCPServer
+		ExpectRemoved   []config.UpstreamMCPID
+		ExpectUnchanged int
+	}{
+		{
+			Name:            "no changes",
+			Servers:         []*config.MCPServer{server1, server2},
+			ExpectUnchanged: 2,
+		},
+		{
+			Name:            "server added",
+			Servers:         []*config.MCPServer{server1, server2, server3},
+			ExpectAdded:     []*config.MCPServer{server3},
+			ExpectUnchanged: 2,
+		},
+		{
+			Name:            "server removed",
+			Servers:         []*config.MCPServer{server2},
+			ExpectRemoved:   []config.UpstreamMCPID{server1.ID()},
+			ExpectUnchanged: 1,
+		},
+		{
+			Name:            "url changed",
+			Servers:         []*config.MCPServer{modified(func(s *config.MCPServer) { s.URL = "http://server1:8080/v2/mcp" }), server2},
+			ExpectChanged:   []*config.MCPServer{modified(func(s *config.MCPServer) { s.URL = "http://server1:8080/v2/mcp" })},
+			ExpectUnchanged: 1,
+		},
+		{
+			Name:            "credential changed",
+			Servers:         []*config.MCPServer{modified(func(s *config.MCPServer) { s.Credential = "token" }), server2},
+			ExpectChanged:   []*config.MCPServer{modified(func(s *config.MCPServer) { s.Credential = "token" })},
+			ExpectUnchanged: 1,
+		},
+		{
+			Name: "routing only settings do not change the server",
+			Servers: []*config.MCPServer{modified(func(s *config.MCPServer) {
+				s.Priority = 10
+				s.PathRewrite = "/proxy/mcp"
+				s.ToolTimeouts = map[string]time.Duration{"slow": time.Minute}
+			}), server2},
+			ExpectUnchanged: 2,
+		},
+		{
+			Name:            "duplicate and empty servers are ignored",
+			Servers:         []*config.MCPServer{server1, nil, server1, server2},
+			ExpectUnchanged: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			changes := diffServers(registered, tc.Servers)
+			require.Equal(t, tc.ExpectAdded, changes.added)
+			require.Equal(t, tc.ExpectChanged, changes.changed)
+			require.Equal(t, tc.ExpectRemoved, changes.removed)
+			require.Equal(t, tc.ExpectUnchanged, changes.unchanged)
+		})
+	}
+}
+
+// initializeCounter counts the initialize requests an upstream MCP server receives
+type initializeCounter struct {
+	next  http.Handler
+	count atomic.Int32
+}
+
+func (c *initializeCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"method":"initialize"`) {
+			c.count.Add(1)
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+	}
+	c.next.ServeHTTP(w, r)
+}
+
+func TestOnConfigChangeLeavesUnchangedServersConnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newUpstream := func(tool string) (*initializeCounter, string) {
+		mcpServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(true))
+		mcpServer.AddTool(mcp.NewTool(tool), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(tool), nil
+		})
+		counter := &initializeCounter{next: server.NewStreamableHTTPServer(mcpServer)}
+		srv := httptest.NewServer(counter)
+		t.Cleanup(srv.Close)
+		return counter, srv.URL + "/mcp"
+	}
+	counter1, url1 := newUpstream("one")
+	counter2, url2 := newUpstream("two")
+
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	server1 := &config.MCPServer{Name: "test/server1", URL: url1, ToolPrefix: "s1_", Hostname: "server1.mcp.local"}
+	waitForTools := func(expected ...string) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			tools := slices.Collect(maps.Keys(b.MCPServer().ListTools()))
+			slices.Sort(tools)
+			return slices.Equal(expected, tools)
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{server1}})
+	waitForTools("s1_one")
+	manager1 := b.RegisteredMCPServers()[server1.ID()]
+	require.Equal(t, int32(1), counter1.count.Load())
+
+	// adding a server does not reconnect the existing one. The config is reloaded as a new copy as it is from the config file
+	server1Copy := *server1
+	server2 := &config.MCPServer{Name: "test/server2", URL: url2, ToolPrefix: "s2_", Hostname: "server2.mcp.local"}
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{&server1Copy, server2}})
+	waitForTools("s1_one", "s2_two")
+	require.Same(t, manager1, b.RegisteredMCPServers()[server1.ID()])
+	require.Equal(t, int32(1), counter2.count.Load())
+	// let the managers run a few health checks, these reuse the existing connection
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(1), counter1.count.Load())
+
+	// changing a server only reconnects that server
+	server2Changed := *server2
+	server2Changed.Credential = "token"
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{&server1Copy, &server2Changed}})
+	require.Eventually(t, func() bool {
+		return counter2.count.Load() == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	waitForTools("s1_one", "s2_two")
+	require.Same(t, manager1, b.RegisteredMCPServers()[server1.ID()])
+	require.Equal(t, int32(1), counter1.count.Load())
+}
+
 var _ http.ResponseWriter = &simpleResponseWriter{}
 
 type simpleResponseWriter struct {
@@ -176,3 +356,239 @@ func TestOauthResourceHandler(t *testing.T) {
 	}
 
 }
+
+func TestRenderToolDescriptionSuffix(t *testing.T) {
+	mcpServer := &config.MCPServer{Name: "mcp-test/weather", ToolPrefix: "weather_"}
+
+	b := NewBroker(slog.Default()).(*mcpBrokerImpl)
+	suffix, err := b.renderToolDescriptionSuffix(mcpServer)
+	require.NoError(t, err)
+	require.Empty(t, suffix)
+
+	b = NewBroker(slog.Default(), WithToolDescriptionSuffix(template.Must(template.New("suffix").Parse(" (via {{.Server}}, prefix {{.Prefix}})")))).(*mcpBrokerImpl)
+	suffix, err = b.renderToolDescriptionSuffix(mcpServer)
+	require.NoError(t, err)
+	require.Equal(t, " (via mcp-test/weather, prefix weather_)", suffix)
+
+	b = NewBroker(slog.Default(), WithToolDescriptionSuffix(template.Must(template.New("suffix").Option("missingkey=error").Parse(" {{.Missing}}")))).(*mcpBrokerImpl)
+	_, err = b.renderToolDescriptionSuffix(mcpServer)
+	require.Error(t, err)
+}
+
+func TestReadOnlyServerHidesToolsThatAreNotReadOnly(t *testing.T) {
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	readOnlyServer := &config.MCPServer{Name: "test/server2", URL: MCPAddr, ToolPrefix: "s2_", Hostname: "server2.mcp.local", Enabled: true, ReadOnly: true}
+	b.OnConfigChange(context.Background(), &config.MCPServersConfig{Servers: []*config.MCPServer{readOnlyServer}})
+
+	var status upstream.ServerValidationStatus
+	require.Eventually(t, func() bool {
+		manager, ok := b.RegisteredMCPServers()[readOnlyServer.ID()]
+		if !ok {
+			return false
+		}
+		status = manager.GetStatus()
+		return status.Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// server2's set_time and pour_chocolate_into_mold tools are annotated as destructive rather than read-only
+	advertised := []string{}
+	for name := range b.MCPServer().ListTools() {
+		advertised = append(advertised, name)
+	}
+	require.ElementsMatch(t, []string{"s2_hello_world", "s2_time", "s2_headers", "s2_auth1234", "s2_slow"}, advertised)
+	require.True(t, status.ReadOnly)
+	require.Equal(t, 2, status.HiddenTools)
+	require.Equal(t, 5, status.TotalTools)
+
+	_, ok := b.ToolAnnotations(readOnlyServer.ID(), "set_time")
+	require.False(t, ok)
+	annotations, ok := b.ToolAnnotations(readOnlyServer.ID(), "time")
+	require.True(t, ok)
+	require.True(t, config.IsReadOnly(annotations))
+}
+
+func TestInitializeAdvertisesUpstreamCapabilities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newUpstream := func(opts ...server.ServerOption) string {
+		mcpServer := server.NewMCPServer("upstream", "0.0.1", append(opts, server.WithToolCapabilities(true))...)
+		mcpServer.AddTool(mcp.NewTool("echo"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("echo"), nil
+		})
+		srv := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+		t.Cleanup(srv.Close)
+		return srv.URL + "/mcp"
+	}
+	toolsOnly := &config.MCPServer{Name: "test/tools", URL: newUpstream(), ToolPrefix: "t_", Hostname: "tools.mcp.local", Enabled: true}
+	withPrompts := &config.MCPServer{Name: "test/prompts", URL: newUpstream(server.WithPromptCapabilities(true), server.WithLogging()), ToolPrefix: "p_", Hostname: "prompts.mcp.local", Enabled: true}
+
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	waitForReady := func(servers ...*config.MCPServer) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			registered := b.RegisteredMCPServers()
+			for _, mcpServer := range servers {
+				man, ok := registered[mcpServer.ID()]
+				if !ok || !man.GetStatus().Ready {
+					return false
+				}
+			}
+			return len(registered) == len(servers)
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+	initialize := func() mcp.ServerCapabilities {
+		t.Helper()
+		response := b.MCPServer().HandleMessage(ctx, json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`))
+		result, ok := response.(mcp.JSONRPCResponse)
+		require.True(t, ok, "unexpected response %v", response)
+		initializeResult, ok := result.Result.(mcp.InitializeResult)
+		require.True(t, ok)
+		return initializeResult.Capabilities
+	}
+
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{toolsOnly, withPrompts}})
+	waitForReady(toolsOnly, withPrompts)
+	capabilities := initialize()
+	require.NotNil(t, capabilities.Tools)
+	require.True(t, capabilities.Tools.ListChanged)
+	require.NotNil(t, capabilities.Resources)
+	require.NotNil(t, capabilities.Prompts)
+	require.NotNil(t, capabilities.Logging)
+
+	// the capabilities follow the servers registered when the client initializes
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{toolsOnly}})
+	waitForReady(toolsOnly)
+	capabilities = initialize()
+	require.NotNil(t, capabilities.Tools)
+	require.Nil(t, capabilities.Prompts)
+	require.Nil(t, capabilities.Logging)
+}
+
+func TestInitializeNegotiatesProtocolVersion(t *testing.T) {
+	b := NewBroker(logger)
+	defer func() { _ = b.Shutdown(context.Background()) }()
+
+	testCases := []struct {
+		Name          string
+		Requested     string
+		ExpectVersion string
+	}{
+		{Name: "latest", Requested: "2025-06-18", ExpectVersion: "2025-06-18"},
+		{Name: "older supported version", Requested: "2025-03-26", ExpectVersion: "2025-03-26"},
+		{Name: "oldest supported version", Requested: "2024-11-05", ExpectVersion: "2024-11-05"},
+		{Name: "newer than supported", Requested: "2099-01-01", ExpectVersion: SupportedProtocolVersions[0]},
+		{Name: "unknown version", Requested: "1.0", ExpectVersion: SupportedProtocolVersions[0]},
+		{Name: "no version", Requested: "", ExpectVersion: SupportedProtocolVersions[0]},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			request, err := json.Marshal(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"method":  "initialize",
+				"params": map[string]any{
+					"protocolVersion": tc.Requested,
+					"capabilities":    map[string]any{},
+					"clientInfo":      map[string]any{"name": "test", "version": "1"},
+				},
+			})
+			require.NoError(t, err)
+			response := b.MCPServer().HandleMessage(context.Background(), request)
+			result, ok := response.(mcp.JSONRPCResponse)
+			require.True(t, ok, "unexpected response %v", response)
+			initializeResult, ok := result.Result.(mcp.InitializeResult)
+			require.True(t, ok)
+			require.Equal(t, tc.ExpectVersion, initializeResult.ProtocolVersion)
+		})
+	}
+
+	// every version offered to clients is one the MCP library can speak
+	for _, version := range SupportedProtocolVersions {
+		require.Contains(t, mcp.ValidProtocolVersions, version)
+	}
+}
+
+func TestSyntheticServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	synthetic := &config.MCPServer{Name: "test/synthetic", ToolPrefix: "mock_", Enabled: true, SyntheticTools: []config.SyntheticTool{
+		{Name: "weather", Description: "the weather", InputSchema: `{"type":"object","properties":{"city":{"type":"string"}}}`, Response: "sunny"},
+		{Name: "broken", Response: "the tool is broken", IsError: true},
+	}}
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{synthetic}})
+	require.Eventually(t, func() bool {
+		manager, ok := b.RegisteredMCPServers()[synthetic.ID()]
+		return ok && manager.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	gateway := httptest.NewServer(server.NewStreamableHTTPServer(b.MCPServer()))
+	defer gateway.Close()
+	gatewayClient, err := client.NewStreamableHttpClient(gateway.URL + "/mcp")
+	require.NoError(t, err)
+	defer func() { _ = gatewayClient.Close() }()
+	require.NoError(t, gatewayClient.Start(ctx))
+	_, err = gatewayClient.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+
+	tools, err := gatewayClient.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	toolsByName := map[string]mcp.Tool{}
+	for _, tool := range tools.Tools {
+		toolsByName[tool.Name] = tool
+	}
+	require.Len(t, toolsByName, 2)
+	require.Contains(t, toolsByName, "mock_weather")
+	require.Contains(t, toolsByName, "mock_broken")
+	require.Equal(t, "the weather", toolsByName["mock_weather"].Description)
+	require.Contains(t, toolsByName["mock_weather"].InputSchema.Properties, "city")
+
+	callTool := func(name string) *mcp.CallToolResult {
+		t.Helper()
+		request := mcp.CallToolRequest{}
+		request.Params.Name = name
+		request.Params.Arguments = map[string]any{"city": "Waterford"}
+		result, err := gatewayClient.CallTool(ctx, request)
+		require.NoError(t, err)
+		require.Len(t, result.Content, 1)
+		return result
+	}
+	result := callTool("mock_weather")
+	require.False(t, result.IsError)
+	require.Equal(t, "sunny", result.Content[0].(mcp.TextContent).Text)
+
+	result = callTool("mock_broken")
+	require.True(t, result.IsError)
+	require.Equal(t, "the tool is broken", result.Content[0].(mcp.TextContent).Text)
+}
+
+// failingSessionIDManager cannot generate session ids, as when a duplicate id is rejected
+type failingSessionIDManager struct{}
+
+func (failingSessionIDManager) Generate() string               { return "" }
+func (failingSessionIDManager) Validate(string) (bool, error)  { return false, nil }
+func (failingSessionIDManager) Terminate(string) (bool, error) { return false, nil }
+
+func TestInitializeRejectedWithoutSessionID(t *testing.T) {
+	b := NewBroker(logger)
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	gateway := httptest.NewServer(server.NewStreamableHTTPServer(b.MCPServer(), server.WithSessionIdManager(failingSessionIDManager{})))
+	defer gateway.Close()
+
+	resp, err := http.Post(gateway.URL+"/mcp", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Empty(t, resp.Header.Get("Mcp-Session-Id"))
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, mcp.INVALID_REQUEST, body.Error.Code)
+	require.Contains(t, body.Error.Message, "the gateway could not create a session")
+}
@@ -7,22 +7,29 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"maps"
 	"net/http"
 	"slices"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 )
 
 var authorizedToolsHeader = http.CanonicalHeaderKey("x-authorized-tools")
 var virtualMCPHeader = http.CanonicalHeaderKey("x-mcp-virtualserver")
+var tenantHeader = http.CanonicalHeaderKey("x-mcp-tenant")
 
 const allowedToolsClaimKey = "allowed-tools"
 
-// FilterTools reduces the tool set based on authorization headers.
-// Priority: x-authorized-tools JWT filtering, then x-mcp-virtualserver filtering.
-func (broker *mcpBrokerImpl) FilterTools(_ context.Context, _ any, mcpReq *mcp.ListToolsRequest, mcpRes *mcp.ListToolsResult) {
+// DegradedToolMetaKey is set in a tool's _meta when it is returned even though its server is unavailable
+const DegradedToolMetaKey = "degraded"
+
+// FilterTools reduces the tool set based on authorization headers and the client.
+// Priority: x-authorized-tools JWT filtering, then x-mcp-virtualserver filtering, then client filtering, then tenant isolation.
+func (broker *mcpBrokerImpl) FilterTools(ctx context.Context, _ any, mcpReq *mcp.ListToolsRequest, mcpRes *mcp.ListToolsResult) {
 	tools := mcpRes.Tools
 
 	// step 1: apply x-authorized-tools filtering (JWT-based)
@@ -31,6 +38,15 @@ func (broker *mcpBrokerImpl) FilterTools(_ context.Context, _ any, mcpReq *mcp.L
 	// step 2: apply virtual server filtering
 	tools = broker.applyVirtualServerFilter(mcpReq.Header, tools)
 
+	// step 3: apply client filtering
+	tools = broker.applyClientToolFilter(ctx, tools)
+
+	// step 4: apply tenant isolation
+	tools = broker.applyTenancyFilter(mcpReq.Header, tools)
+
+	// the catalog only enriches the tools left after filtering
+	tools = broker.applyToolCatalog(ctx, tools)
+
 	mcpRes.Tools = tools
 }
 
@@ -130,8 +146,12 @@ func (broker *mcpBrokerImpl) filterToolsByServerMap(allowedTools map[string][]st
 			broker.logger.Debug("checking access", "tool", tool.Name, "against", toolNames)
 			if slices.Contains(toolNames, tool.Name) {
 				broker.logger.Debug("access granted", "tool", tool.Name)
-				tool.Name = fmt.Sprintf("%s%s", upstream.MCP.GetPrefix(), tool.Name)
-				filtered = append(filtered, tool)
+				tool.Description = upstream.GatewayToolDescription(tool.Description)
+				for _, name := range upstream.GatewayToolNames(tool.Name) {
+					aliased := tool
+					aliased.Name = name
+					filtered = append(filtered, aliased)
+				}
 			}
 		}
 	}
@@ -168,9 +188,144 @@ func (broker *mcpBrokerImpl) applyVirtualServerFilter(headers http.Header, tools
 		}
 	}
 
+	return broker.applyUnavailableBehavior(vs, filtered)
+}
+
+// applyClientToolFilter filters tools to those of the first client tool filter matching the session's client.
+// Clients matching no filter are listed the tools unchanged. A session whose client is not known, for example one
+// initialized on another broker replica, is matched as a client with an empty name and version. Only tools/list is
+// filtered, calls to the removed tools are still routed as the client's name and version are not verified.
+func (broker *mcpBrokerImpl) applyClientToolFilter(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return tools
+	}
+	broker.clientLock.RLock()
+	defer broker.clientLock.RUnlock()
+	if len(broker.clientToolFilters) == 0 {
+		return tools
+	}
+	client := broker.clientInfo[session.SessionID()]
+	for _, filter := range broker.clientToolFilters {
+		if !filter.Matches(client.Name, client.Version) {
+			continue
+		}
+		broker.logger.Debug("applying client tool filter", "clientName", client.Name, "clientVersion", client.Version, "filter", filter.ClientName)
+		filtered := []mcp.Tool{}
+		for _, tool := range tools {
+			if slices.Contains(filter.Tools, tool.Name) {
+				filtered = append(filtered, tool)
+			}
+		}
+		return filtered
+	}
+	return tools
+}
+
+// applyTenancyFilter removes the tools of servers owned by other tenants unless they are shared with the client's tenant.
+// The client's tenant is read from the signed x-mcp-tenant header. A client without a valid header has no tenant and
+// is only listed tools shared with all tenants.
+func (broker *mcpBrokerImpl) applyTenancyFilter(headers http.Header, tools []mcp.Tool) []mcp.Tool {
+	broker.tenancyLock.RLock()
+	tenancy, serverTenants := broker.tenancy, broker.serverTenants
+	broker.tenancyLock.RUnlock()
+	if tenancy == nil || !tenancy.Enabled {
+		return tools
+	}
+
+	clientTenant, err := broker.parseTenantJWT(headers[tenantHeader], tenancy.TenantClaim())
+	if err != nil {
+		broker.logger.Debug("no valid tenant for client, only listing tools shared with all tenants", "error", err)
+	}
+
+	broker.mcpLock.RLock()
+	defer broker.mcpLock.RUnlock()
+	filtered := []mcp.Tool{}
+	for _, tool := range tools {
+		for id, upstream := range broker.mcpServers {
+			if _, ok := upstream.UpstreamToolName(tool.Name); !ok {
+				continue
+			}
+			if tenancy.Visible(clientTenant, upstream.MCPName(), serverTenants[id], tool.Name) {
+				filtered = append(filtered, tool)
+			}
+			break
+		}
+	}
+	broker.logger.Debug("applied tenant isolation", "tenant", clientTenant, "tools", len(tools), "visible", len(filtered))
 	return filtered
 }
 
+// parseTenantJWT validates the tenant header and returns the tenant held in the claim.
+func (broker *mcpBrokerImpl) parseTenantJWT(headerValues []string, claim string) (string, error) {
+	if len(headerValues) != 1 || headerValues[0] == "" {
+		return "", fmt.Errorf("expected exactly 1 %s header value, got %d", tenantHeader, len(headerValues))
+	}
+	if broker.trustedHeadersPublicKey == "" {
+		return "", fmt.Errorf("no public key configured to validate JWT")
+	}
+
+	token, err := validateJWTHeader(headerValues[0], broker.trustedHeadersPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("JWT validation failed: %w", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("failed to extract claims from JWT")
+	}
+	tenant, ok := claims[claim].(string)
+	if !ok || tenant == "" {
+		return "", fmt.Errorf("missing %s claim in JWT", claim)
+	}
+	return tenant, nil
+}
+
+// applyUnavailableBehavior handles the case where every server backing the virtual server's tools is unhealthy.
+// Depending on the virtual server configuration either no tools are returned or the tools are marked as degraded.
+func (broker *mcpBrokerImpl) applyUnavailableBehavior(vs config.VirtualServer, tools []mcp.Tool) []mcp.Tool {
+	if !broker.allBackingServersUnavailable(tools) {
+		return tools
+	}
+
+	broker.logger.Debug("all servers for virtual server unavailable", "virtualServer", vs.Name, "behavior", vs.UnavailableBehavior)
+	if vs.UnavailableBehavior == config.UnavailableBehaviorEmpty {
+		return []mcp.Tool{}
+	}
+
+	degraded := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		// the meta is shared with the registered tool so copy before marking
+		meta := &mcp.Meta{AdditionalFields: map[string]any{}}
+		if tool.Meta != nil {
+			meta.ProgressToken = tool.Meta.ProgressToken
+			maps.Copy(meta.AdditionalFields, tool.Meta.AdditionalFields)
+		}
+		meta.AdditionalFields[DegradedToolMetaKey] = true
+		tool.Meta = meta
+		degraded = append(degraded, tool)
+	}
+	return degraded
+}
+
+// allBackingServersUnavailable returns true if the upstream servers providing the tools are known and none of them are ready
+func (broker *mcpBrokerImpl) allBackingServersUnavailable(tools []mcp.Tool) bool {
+	broker.mcpLock.RLock()
+	defer broker.mcpLock.RUnlock()
+	backingServers := 0
+	for _, tool := range tools {
+		for _, upstream := range broker.mcpServers {
+			if _, ok := upstream.UpstreamToolName(tool.Name); !ok {
+				continue
+			}
+			if upstream.GetStatus().Ready {
+				return false
+			}
+			backingServers++
+		}
+	}
+	return backingServers > 0
+}
+
 // validateJWTHeader validates the JWT header using ES256 algorithm.
 func validateJWTHeader(token string, publicKey string) (*jwt.Token, error) {
 	block, _ := pem.Decode([]byte(publicKey))
@@ -0,0 +1,82 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// FlushSessionsPath is the pattern of the internal endpoint flushing the upstream sessions of an MCP server
+const FlushSessionsPath = "/servers/{namespace}/{name}/flush-sessions"
+
+// ErrUnknownServer is returned when flushing the sessions of a server that is not configured
+var ErrUnknownServer = errors.New("unknown server")
+
+// FlushSessionsResponse reports the upstream sessions closed by a flush
+type FlushSessionsResponse struct {
+	Server string `json:"server"`
+	Closed int    `json:"closed"`
+}
+
+// FlushSessionsHandler serves POST /servers/{namespace}/{name}/flush-sessions so operators can drop every upstream
+// session with a server after it is redeployed, rather than each gateway session finding out from a 404. Requests
+// must carry the router key as a bearer token.
+type FlushSessionsHandler struct {
+	// Flush forgets the upstream sessions with the server and returns how many were closed. It is set once the
+	// router is created, until then requests are rejected as unavailable
+	Flush  func(ctx context.Context, serverName string) (int, error)
+	apiKey string
+	logger *slog.Logger
+}
+
+// NewFlushSessionsHandler returns a handler for the flush sessions endpoint. An empty apiKey rejects every request
+func NewFlushSessionsHandler(apiKey string, logger *slog.Logger) *FlushSessionsHandler {
+	return &FlushSessionsHandler{
+		apiKey: apiKey,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *FlushSessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: POST")
+		return
+	}
+	if !hasBearerToken(r, h.apiKey) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if h.Flush == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "the router is not running")
+		return
+	}
+	serverName := r.PathValue("namespace") + "/" + r.PathValue("name")
+	closed, err := h.Flush(r.Context(), serverName)
+	if errors.Is(err, ErrUnknownServer) {
+		h.sendError(w, http.StatusNotFound, "Server '"+serverName+"' not found. Check available servers at /status")
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "failed to flush sessions", "server", serverName, "error", err)
+		h.sendError(w, http.StatusInternalServerError, "failed to flush sessions")
+		return
+	}
+	h.logger.InfoContext(r.Context(), "flushed sessions", "server", serverName, "closed", closed)
+	h.sendJSON(w, http.StatusOK, FlushSessionsResponse{Server: serverName, Closed: closed})
+}
+
+func (h *FlushSessionsHandler) sendJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to encode flush sessions response", "error", err)
+	}
+}
+
+func (h *FlushSessionsHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendJSON(w, statusCode, map[string]string{"error": message})
+}
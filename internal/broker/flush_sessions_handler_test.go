@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushSessionsHandler(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	var flushed []string
+	handler := NewFlushSessionsHandler("secret", logger)
+	handler.Flush = func(_ context.Context, serverName string) (int, error) {
+		switch serverName {
+		case "mcp-test/server1":
+			flushed = append(flushed, serverName)
+			return 2, nil
+		case "mcp-test/broken":
+			return 0, errors.New("cache unavailable")
+		default:
+			return 0, fmt.Errorf("%w: %s", ErrUnknownServer, serverName)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(FlushSessionsPath, handler)
+
+	testCases := []struct {
+		Name         string
+		Method       string
+		Target       string
+		Token        string
+		ExpectStatus int
+	}{
+		{
+			Name:         "flush a server",
+			Method:       http.MethodPost,
+			Target:       "/servers/mcp-test/server1/flush-sessions",
+			Token:        "secret",
+			ExpectStatus: http.StatusOK,
+		},
+		{
+			Name:         "unknown server",
+			Method:       http.MethodPost,
+			Target:       "/servers/mcp-test/missing/flush-sessions",
+			Token:        "secret",
+			ExpectStatus: http.StatusNotFound,
+		},
+		{
+			Name:         "flush fails",
+			Method:       http.MethodPost,
+			Target:       "/servers/mcp-test/broken/flush-sessions",
+			Token:        "secret",
+			ExpectStatus: http.StatusInternalServerError,
+		},
+		{
+			Name:         "missing token",
+			Method:       http.MethodPost,
+			Target:       "/servers/mcp-test/server1/flush-sessions",
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:         "wrong token",
+			Method:       http.MethodPost,
+			Target:       "/servers/mcp-test/server1/flush-sessions",
+			Token:        "not-the-secret",
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:         "not post",
+			Method:       http.MethodGet,
+			Target:       "/servers/mcp-test/server1/flush-sessions",
+			Token:        "secret",
+			ExpectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			flushed = nil
+			req := httptest.NewRequest(tc.Method, tc.Target, nil)
+			if tc.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.Token)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			res := w.Result()
+			require.Equal(t, tc.ExpectStatus, res.StatusCode)
+			if tc.ExpectStatus != http.StatusOK {
+				require.Empty(t, flushed)
+				return
+			}
+			var response FlushSessionsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.Equal(t, FlushSessionsResponse{Server: "mcp-test/server1", Closed: 2}, response)
+			require.Equal(t, []string{"mcp-test/server1"}, flushed)
+		})
+	}
+}
+
+func TestFlushSessionsHandlerWithoutRouter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle(FlushSessionsPath, NewFlushSessionsHandler("secret", slog.New(slog.DiscardHandler)))
+
+	req := httptest.NewRequest(http.MethodPost, "/servers/mcp-test/server1/flush-sessions", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+}
@@ -0,0 +1,359 @@
+package broker_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/clients"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	mcprouter "github.com/kagenti/mcp-gateway/internal/mcp-router"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+var interopLogger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+// interopServer is a test server built with one of the MCP SDKs and what its tools are expected to do
+type interopServer struct {
+	Name           string
+	URL            string
+	GreetTool      string
+	ExpectGreeting string
+	TimeTitle      string
+	// ChangeTools changes the tools of the server so it notifies its clients the tool list changed. It returns the
+	// upstream name of a tool the server now has
+	ChangeTools func(t *testing.T, gw *interopGateway) string
+}
+
+// TestSDKInterop checks the gateway works the same with MCP servers built with each SDK. Tools are discovered by the
+// broker and tool calls are routed by the router, which sends the upstream the request it would have envoy send. The
+// request is then sent to the server and its response is handled by the router as envoy would have it
+func TestSDKInterop(t *testing.T) {
+	servers := []interopServer{
+		{
+			Name:           "mcp-go",
+			URL:            broker.MCPAddr,
+			GreetTool:      "hello_world",
+			ExpectGreeting: "Hello, gateway!",
+			TimeTitle:      "Clock",
+			ChangeTools: func(t *testing.T, gw *interopGateway) string {
+				// the tool is removed and added again so the shared server is left as it was
+				admin := strings.TrimSuffix(broker.MCPAddr, "/mcp") + "/admin"
+				adminRequest(t, http.MethodDelete, admin+"/deleteTool", "pour_chocolate_into_mold")
+				require.Eventually(t, func() bool { return !gw.listsTool(t, "interop_pour_chocolate_into_mold") }, 5*time.Second, 20*time.Millisecond)
+				adminRequest(t, http.MethodPost, admin+"/addTool", "pour_chocolate_into_mold")
+				return "pour_chocolate_into_mold"
+			},
+		},
+		{
+			Name:           "go-sdk",
+			URL:            broker.SDKMCPAddr,
+			GreetTool:      "greet",
+			ExpectGreeting: "Hi gateway",
+			TimeTitle:      "time",
+			ChangeTools: func(t *testing.T, gw *interopGateway) string {
+				response := gw.callTool(t, "interop_add_tool", map[string]any{"name": "interop_added"}, nil)
+				require.Equal(t, "Added new tool: interop_added", response.text(t))
+				return "interop_added"
+			},
+		},
+	}
+	for _, sdk := range servers {
+		t.Run(sdk.Name, func(t *testing.T) {
+			gw := newInteropGateway(t, sdk)
+
+			t.Run("discovery", func(t *testing.T) {
+				for _, tool := range []string{sdk.GreetTool, "time", "slow", "headers"} {
+					require.True(t, gw.listsTool(t, "interop_"+tool), "tool %s not discovered", tool)
+				}
+				annotations, ok := gw.broker.ToolAnnotations(gw.config.ID(), "time")
+				require.True(t, ok)
+				require.Equal(t, sdk.TimeTitle, annotations.Title)
+			})
+
+			t.Run("tool call routing", func(t *testing.T) {
+				response := gw.callTool(t, "interop_"+sdk.GreetTool, map[string]any{"name": "gateway"}, nil)
+				require.Equal(t, sdk.ExpectGreeting, response.text(t))
+				// the client only ever sees its gateway session, whatever header the upstream answered with
+				require.Equal(t, gw.gatewaySession, response.clientSession)
+			})
+
+			t.Run("progress notifications", func(t *testing.T) {
+				response := gw.callTool(t, "interop_slow", map[string]any{"seconds": 1}, map[string]any{"progressToken": "interop"})
+				require.Equal(t, "done", response.text(t))
+				require.True(t, response.eventStream, "progress must be streamed to the client")
+				require.NotEmpty(t, response.notifications)
+				progress := response.notifications[0]
+				require.Equal(t, "notifications/progress", progress.Method)
+				require.Equal(t, "interop", progress.Params.AdditionalFields["progressToken"])
+			})
+
+			t.Run("tool list changed", func(t *testing.T) {
+				added := sdk.ChangeTools(t, gw)
+				require.Eventually(t, func() bool { return gw.listsTool(t, "interop_"+added) }, 5*time.Second, 20*time.Millisecond)
+			})
+
+			t.Run("upstream session lost", func(t *testing.T) {
+				lost := gw.upstreamSession(t)
+				require.NotEmpty(t, lost)
+				gw.terminateUpstreamSession(t, lost)
+
+				req := gw.routeToolCall(t, "interop_time", nil, nil)
+				response := gw.send(t, req)
+				require.Equal(t, http.StatusNotFound, response.status)
+				require.Empty(t, gw.upstreamSession(t), "session lost by the upstream was not removed")
+
+				// the next call initializes a new upstream session
+				response = gw.callTool(t, "interop_time", nil, nil)
+				require.NotEmpty(t, response.text(t))
+				require.NotEqual(t, lost, gw.upstreamSession(t))
+			})
+		})
+	}
+}
+
+// interopGateway is a broker discovering a single server and a router routing tool calls to it for one client
+type interopGateway struct {
+	config         *config.MCPServer
+	broker         broker.MCPBroker
+	router         *mcprouter.ExtProcServer
+	cache          *session.Cache
+	client         *client.Client
+	gatewaySession string
+}
+
+func newInteropGateway(t *testing.T, sdk interopServer) *interopGateway {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	host := strings.TrimSuffix(strings.TrimPrefix(sdk.URL, "http://"), "/mcp")
+	serverConfig := &config.MCPServer{Name: "interop/" + sdk.Name, URL: sdk.URL, ToolPrefix: "interop_", Hostname: host, Enabled: true}
+	routingConfig := &config.MCPServersConfig{Servers: []*config.MCPServer{serverConfig}, MCPGatewayInternalHostname: host}
+
+	b := broker.NewBroker(interopLogger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	t.Cleanup(func() { _ = b.Shutdown(context.Background()) })
+	b.OnConfigChange(ctx, routingConfig)
+	require.Eventually(t, func() bool {
+		manager, ok := b.RegisteredMCPServers()[serverConfig.ID()]
+		return ok && manager.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	gateway := httptest.NewServer(server.NewStreamableHTTPServer(b.MCPServer()))
+	t.Cleanup(gateway.Close)
+	gatewayClient, err := client.NewStreamableHttpClient(gateway.URL + "/mcp")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = gatewayClient.Close() })
+	require.NoError(t, gatewayClient.Start(ctx))
+	_, err = gatewayClient.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, interopLogger, cache)
+	require.NoError(t, err)
+	return &interopGateway{
+		config: serverConfig,
+		broker: b,
+		router: &mcprouter.ExtProcServer{
+			RoutingConfig: routingConfig,
+			JWTManager:    jwtManager,
+			Logger:        interopLogger,
+			InitForClient: clients.Initialize,
+			SessionCache:  cache,
+			Broker:        b,
+		},
+		cache:          cache,
+		client:         gatewayClient,
+		gatewaySession: jwtManager.Generate(ctx),
+	}
+}
+
+// listsTool returns true if the client is listed the tool by the broker
+func (gw *interopGateway) listsTool(t *testing.T, name string) bool {
+	t.Helper()
+	tools, err := gw.client.ListTools(context.Background(), mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	return slices.ContainsFunc(tools.Tools, func(tool mcp.Tool) bool { return tool.Name == name })
+}
+
+// upstreamSession returns the upstream session the router holds with the server for the client
+func (gw *interopGateway) upstreamSession(t *testing.T) string {
+	t.Helper()
+	sessions, err := gw.cache.GetSession(context.Background(), gw.gatewaySession)
+	require.NoError(t, err)
+	return sessions[gw.config.Name]
+}
+
+// terminateUpstreamSession ends the upstream session on the server, as a server that restarted would have lost it
+func (gw *interopGateway) terminateUpstreamSession(t *testing.T, upstreamSession string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodDelete, gw.config.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Mcp-Session-Id", upstreamSession)
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Less(t, resp.StatusCode, 300)
+}
+
+// routedRequest is a tool call as routed by the router: the request the client sent and the headers and body envoy
+// would send the upstream
+type routedRequest struct {
+	mcpRequest *mcprouter.MCPRequest
+	headers    []*corev3.HeaderValueOption
+	body       []byte
+}
+
+// routeToolCall has the router route a tool call from the client
+func (gw *interopGateway) routeToolCall(t *testing.T, tool string, arguments, meta map[string]any) *routedRequest {
+	t.Helper()
+	params := map[string]any{"name": tool, "arguments": arguments}
+	if meta != nil {
+		params["_meta"] = meta
+	}
+	req := &mcprouter.MCPRequest{
+		ID:      ptr.To(7),
+		JSONRPC: "2.0",
+		Method:  "tools/call",
+		Params:  params,
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gw.gatewaySession)}}},
+	}
+	responses := gw.router.RouteMCPRequest(context.Background(), req)
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].GetImmediateResponse(), "tool call was not routed")
+	mutation := responses[0].GetRequestBody().GetResponse()
+	require.NotNil(t, mutation)
+	return &routedRequest{mcpRequest: req, headers: mutation.GetHeaderMutation().GetSetHeaders(), body: mutation.GetBodyMutation().GetBody()}
+}
+
+// interopResponse is the response to a routed tool call as the client receives it
+type interopResponse struct {
+	status        int
+	clientSession string
+	eventStream   bool
+	result        *mcp.CallToolResult
+	notifications []mcp.JSONRPCNotification
+}
+
+// text returns the text of the first content of the tool call's result
+func (r *interopResponse) text(t *testing.T) string {
+	t.Helper()
+	require.Equal(t, http.StatusOK, r.status)
+	require.NotNil(t, r.result)
+	require.False(t, r.result.IsError)
+	require.NotEmpty(t, r.result.Content)
+	content, ok := r.result.Content[0].(mcp.TextContent)
+	require.True(t, ok, "unexpected content %v", r.result.Content[0])
+	return content.Text
+}
+
+// callTool routes a tool call and sends it to the server
+func (gw *interopGateway) callTool(t *testing.T, tool string, arguments, meta map[string]any) *interopResponse {
+	t.Helper()
+	return gw.send(t, gw.routeToolCall(t, tool, arguments, meta))
+}
+
+// send sends a routed tool call to the server and has the router handle its response headers
+func (gw *interopGateway) send(t *testing.T, routed *routedRequest) *interopResponse {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, gw.config.URL, bytes.NewReader(routed.body))
+	require.NoError(t, err)
+	for _, header := range routed.headers {
+		key := header.GetHeader().GetKey()
+		// pseudo headers and the content length are set by the HTTP client
+		if strings.HasPrefix(key, ":") || key == "content-length" {
+			continue
+		}
+		req.Header.Set(key, string(header.GetHeader().GetRawValue()))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	// envoy sends the processor the response headers lowercased with the status as a pseudo header
+	upstreamHeaders := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: ":status", RawValue: []byte(strconv.Itoa(resp.StatusCode))}}}
+	for name, values := range resp.Header {
+		upstreamHeaders.Headers = append(upstreamHeaders.Headers, &corev3.HeaderValue{Key: strings.ToLower(name), RawValue: []byte(values[0])})
+	}
+	responses, err := gw.router.HandleResponseHeaders(context.Background(), &eppb.HttpHeaders{Headers: upstreamHeaders}, &eppb.HttpHeaders{Headers: routed.mcpRequest.Headers}, routed.mcpRequest)
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+
+	response := &interopResponse{status: resp.StatusCode, eventStream: strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")}
+	for _, header := range responses[0].GetResponseHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		if header.GetHeader().GetKey() == "mcp-session-id" {
+			response.clientSession = string(header.GetHeader().GetRawValue())
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return response
+	}
+
+	var messages [][]byte
+	if response.eventStream {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data:"); ok {
+				messages = append(messages, []byte(strings.TrimSpace(data)))
+			}
+		}
+		require.NoError(t, scanner.Err())
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		messages = append(messages, body)
+	}
+	for _, message := range messages {
+		var rpc struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(message, &rpc))
+		if rpc.Method != "" {
+			var notification mcp.JSONRPCNotification
+			require.NoError(t, json.Unmarshal(message, &notification))
+			response.notifications = append(response.notifications, notification)
+			continue
+		}
+		require.NotNil(t, rpc.ID)
+		require.Equal(t, *routed.mcpRequest.ID, *rpc.ID, "the response does not answer the request")
+		result, err := mcp.ParseCallToolResult(ptr.To(rpc.Result))
+		require.NoError(t, err)
+		response.result = result
+	}
+	return response
+}
+
+// adminRequest calls an admin endpoint of the mcp-go test server
+func adminRequest(t *testing.T, method, url, body string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,308 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultNotificationWriteTimeout is how long writing a notification to a client's stream may take before the client is disconnected
+	DefaultNotificationWriteTimeout = 30 * time.Second
+
+	listChangedSuffix = "/list_changed"
+
+	defaultNotificationRetryInterval = time.Second
+	maxNotificationRetries           = 5
+)
+
+var droppedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_broker_dropped_notifications_total",
+	Help: "Notifications not delivered to a gateway session because its notification queue was full",
+}, []string{"method"})
+
+func init() {
+	prometheus.MustRegister(droppedNotifications)
+}
+
+// pendingNotification is a list changed notification that is sent again to a session after it was dropped
+type pendingNotification struct {
+	sessionID string
+	method    string
+}
+
+type retryState struct {
+	attempts  int
+	givenUpAt time.Time
+}
+
+// notificationRetries resends list changed notifications that were dropped because a session's queue was full.
+// Each session's queue is bounded and delivery never waits on a session, so a slow client only delays its own
+// notifications. List changed notifications carry no data so only one retry per session and method is kept.
+// A session that is not reading its stream is given up on after a few attempts.
+type notificationRetries struct {
+	lock     sync.Mutex
+	pending  map[pendingNotification]*retryState
+	interval time.Duration
+	send     func(sessionID, method string) error
+	logger   *slog.Logger
+}
+
+func newNotificationRetries(send func(sessionID, method string) error, logger *slog.Logger) *notificationRetries {
+	return &notificationRetries{
+		pending:  map[pendingNotification]*retryState{},
+		interval: defaultNotificationRetryInterval,
+		send:     send,
+		logger:   logger,
+	}
+}
+
+// dropped records a notification that could not be queued for a session and schedules list changed notifications to be sent again
+func (nr *notificationRetries) dropped(sessionID, method string) {
+	droppedNotifications.WithLabelValues(method).Inc()
+	nr.logger.Debug("dropped notification for slow client", "gatewaySessionID", sessionID, "method", method)
+	if !strings.HasSuffix(method, listChangedSuffix) {
+		return
+	}
+	key := pendingNotification{sessionID: sessionID, method: method}
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+	if state, ok := nr.pending[key]; ok {
+		// a retry is scheduled or the session was given up on recently. Failed retries are also reported here
+		if state.givenUpAt.IsZero() || time.Since(state.givenUpAt) < maxNotificationRetries*nr.interval {
+			return
+		}
+	}
+	nr.pending[key] = &retryState{}
+	nr.schedule(key)
+}
+
+func (nr *notificationRetries) schedule(key pendingNotification) {
+	time.AfterFunc(nr.interval, func() {
+		err := nr.send(key.sessionID, key.method)
+		nr.lock.Lock()
+		defer nr.lock.Unlock()
+		state, ok := nr.pending[key]
+		if !ok {
+			return
+		}
+		if !errors.Is(err, server.ErrNotificationChannelBlocked) {
+			delete(nr.pending, key)
+			return
+		}
+		state.attempts++
+		if state.attempts >= maxNotificationRetries {
+			nr.logger.Warn("client is not reading notifications, giving up resending", "gatewaySessionID", key.sessionID, "method", key.method)
+			state.givenUpAt = time.Now()
+			return
+		}
+		nr.schedule(key)
+	})
+}
+
+// removeSession forgets the notifications pending for a session that has ended
+func (nr *notificationRetries) removeSession(sessionID string) {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+	for key := range nr.pending {
+		if key.sessionID == sessionID {
+			delete(nr.pending, key)
+		}
+	}
+}
+
+// NotificationStreamHandler limits how long each write to a client's notification stream (GET /mcp) may take.
+// The stream has no overall write timeout as it stays open indefinitely, so without this a client that stops
+// reading holds its stream open forever. Once a write times out the stream is closed. Notifications for the
+// session are dropped until the client opens a new stream and drains its queue.
+// Idle streams are sent keep-alives so intermediaries do not close them and a dead client is noticed when the
+// keep-alive cannot be written.
+// Responses to other requests that are streamed as events, such as a request answered with progress notifications,
+// get the same per write timeout in place of the server's WriteTimeout so a long stream is not cut off.
+type NotificationStreamHandler struct {
+	next              http.Handler
+	writeTimeout      time.Duration
+	keepAliveInterval time.Duration
+	reaper            *SessionReaper
+	logger            *slog.Logger
+}
+
+// NewNotificationStreamHandler returns a handler that applies the write timeout to notification streams before passing requests to next.
+// A timeout of 0 or less uses the default. A keep-alive interval of 0 or less sends no keep-alives
+func NewNotificationStreamHandler(next http.Handler, writeTimeout, keepAliveInterval time.Duration, logger *slog.Logger) *NotificationStreamHandler {
+	if writeTimeout <= 0 {
+		writeTimeout = DefaultNotificationWriteTimeout
+	}
+	return &NotificationStreamHandler{
+		next:              next,
+		writeTimeout:      writeTimeout,
+		keepAliveInterval: keepAliveInterval,
+		logger:            logger,
+	}
+}
+
+// WithSessionReaper tells the reaper when the notification streams of each session are opened and closed
+func (h *NotificationStreamHandler) WithSessionReaper(reaper *SessionReaper) *NotificationStreamHandler {
+	h.reaper = reaper
+	return h
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *NotificationStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.next.ServeHTTP(&deadlineWriter{ResponseWriter: w, controller: http.NewResponseController(w), timeout: h.writeTimeout, eventStreamOnly: true}, r)
+		return
+	}
+	sessionID := r.Header.Get(server.HeaderKeySessionID)
+	if h.reaper != nil && sessionID != "" {
+		h.reaper.streamOpened(sessionID)
+		defer h.reaper.streamClosed(sessionID)
+	}
+	// cancelling the request ends the stream when a keep-alive cannot be written
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	dw := &deadlineWriter{ResponseWriter: w, controller: http.NewResponseController(w), timeout: h.writeTimeout}
+	if h.keepAliveInterval > 0 {
+		go dw.keepAlive(ctx, h.keepAliveInterval, cancel)
+	}
+	h.next.ServeHTTP(dw, r.WithContext(ctx))
+	dw.close()
+	if dw.timedOut {
+		h.logger.WarnContext(r.Context(), "closed notification stream of slow client", "gatewaySessionID", sessionID, "writeTimeout", h.writeTimeout)
+	} else if dw.keepAliveFailed {
+		h.logger.DebugContext(r.Context(), "closed notification stream as a keep-alive could not be written", "gatewaySessionID", sessionID)
+	}
+}
+
+// keepAliveComment is an SSE comment. Clients ignore it but it keeps the connection from being idle
+var keepAliveComment = []byte(": keep-alive\n\n")
+
+// deadlineWriter sets a write deadline before each write so a single write cannot block for longer than the timeout.
+// Writes are serialized so keep-alives can be written between the events of the stream
+type deadlineWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+	// eventStreamOnly sets the deadlines only once the response is known to be an event stream. Other responses keep
+	// the server's WriteTimeout
+	eventStreamOnly bool
+
+	lock            sync.Mutex
+	status          int
+	eventStream     bool
+	lastWrite       time.Time
+	closed          bool
+	timedOut        bool
+	keepAliveFailed bool
+}
+
+func (dw *deadlineWriter) WriteHeader(status int) {
+	dw.lock.Lock()
+	defer dw.lock.Unlock()
+	dw.status = status
+	dw.eventStream = strings.HasPrefix(dw.Header().Get("Content-Type"), "text/event-stream")
+	dw.ResponseWriter.WriteHeader(status)
+}
+
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	dw.lock.Lock()
+	defer dw.lock.Unlock()
+	return dw.write(b)
+}
+
+func (dw *deadlineWriter) Flush() {
+	dw.lock.Lock()
+	defer dw.lock.Unlock()
+	_ = dw.flush()
+}
+
+// write and flush must be called with the lock held
+func (dw *deadlineWriter) write(b []byte) (int, error) {
+	dw.setDeadline()
+	n, err := dw.ResponseWriter.Write(b)
+	dw.checkTimeout(err)
+	dw.lastWrite = time.Now()
+	return n, err
+}
+
+func (dw *deadlineWriter) flush() error {
+	dw.setDeadline()
+	err := dw.controller.Flush()
+	dw.checkTimeout(err)
+	return err
+}
+
+func (dw *deadlineWriter) setDeadline() {
+	if dw.eventStreamOnly && !dw.eventStream {
+		return
+	}
+	_ = dw.controller.SetWriteDeadline(time.Now().Add(dw.timeout))
+}
+
+func (dw *deadlineWriter) checkTimeout(err error) {
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		dw.timedOut = true
+	}
+}
+
+// close stops keep-alives being written once the handler has returned
+func (dw *deadlineWriter) close() {
+	dw.lock.Lock()
+	defer dw.lock.Unlock()
+	dw.closed = true
+}
+
+// keepAlive writes a keep-alive to the stream whenever nothing was written to it for the interval. If one cannot be
+// written the client is gone and stop is called to end the stream
+func (dw *deadlineWriter) keepAlive(ctx context.Context, interval time.Duration, stop func()) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		wait, err := dw.writeKeepAlive(interval)
+		if err != nil {
+			stop()
+			return
+		}
+		timer.Reset(wait)
+	}
+}
+
+// writeKeepAlive writes a keep-alive if the stream has been idle for the interval and returns how long to wait before the next one
+func (dw *deadlineWriter) writeKeepAlive(interval time.Duration) (time.Duration, error) {
+	dw.lock.Lock()
+	defer dw.lock.Unlock()
+	// nothing is written before the stream is opened or after it has ended
+	if dw.closed || dw.status != http.StatusOK {
+		return interval, nil
+	}
+	if idle := time.Since(dw.lastWrite); idle < interval {
+		return interval - idle, nil
+	}
+	_, err := dw.write(keepAliveComment)
+	if err == nil {
+		err = dw.flush()
+	}
+	if err != nil {
+		dw.keepAliveFailed = true
+		return 0, err
+	}
+	return interval, nil
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
@@ -0,0 +1,285 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationRetries(t *testing.T) {
+	var lock sync.Mutex
+	var sent []string
+	retries := newNotificationRetries(func(sessionID, method string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		sent = append(sent, sessionID+" "+method)
+		return nil
+	}, slog.Default())
+	retries.interval = 10 * time.Millisecond
+
+	listChanged := "notifications/tools/list_changed"
+	before := testutil.ToFloat64(droppedNotifications.WithLabelValues(listChanged))
+	retries.dropped("session1", listChanged)
+	retries.dropped("session1", listChanged)
+	retries.dropped("session2", listChanged)
+	retries.dropped("session1", "notifications/progress")
+	require.Equal(t, before+3, testutil.ToFloat64(droppedNotifications.WithLabelValues(listChanged)))
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(sent) == 2
+	}, time.Second, 5*time.Millisecond)
+	// only list changed notifications are resent and only once per session
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	require.ElementsMatch(t, []string{"session1 " + listChanged, "session2 " + listChanged}, sent)
+}
+
+func TestNotificationRetriesGiveUp(t *testing.T) {
+	var attempts atomic.Int32
+	var retries *notificationRetries
+	retries = newNotificationRetries(func(sessionID, method string) error {
+		attempts.Add(1)
+		// a blocked send is reported through the error hook as well as returned
+		go retries.dropped(sessionID, method)
+		return server.ErrNotificationChannelBlocked
+	}, slog.Default())
+	retries.interval = 5 * time.Millisecond
+
+	retries.dropped("session1", "notifications/tools/list_changed")
+	require.Eventually(t, func() bool {
+		return attempts.Load() == maxNotificationRetries
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(10 * retries.interval)
+	require.Equal(t, int32(maxNotificationRetries), attempts.Load(), "retries should stop once given up")
+
+	retries.removeSession("session1")
+	retries.lock.Lock()
+	defer retries.lock.Unlock()
+	require.Empty(t, retries.pending)
+}
+
+// smallBufferListener shrinks the send buffer of accepted connections so a client that stops reading stalls writes quickly
+type smallBufferListener struct {
+	net.Listener
+}
+
+func (l smallBufferListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetWriteBuffer(4096)
+	}
+	return conn, nil
+}
+
+func TestSlowClientDoesNotBlockNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBroker(logger)
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	mcpServer := b.MCPServer()
+
+	gateway := httptest.NewUnstartedServer(NewNotificationStreamHandler(server.NewStreamableHTTPServer(mcpServer), 200*time.Millisecond, 0, logger))
+	gateway.Listener = smallBufferListener{gateway.Listener}
+	gateway.Start()
+	defer gateway.Close()
+
+	received := make(chan int, 1)
+	healthy, err := client.NewStreamableHttpClient(gateway.URL+"/mcp", transport.WithContinuousListening())
+	require.NoError(t, err)
+	defer func() { _ = healthy.Close() }()
+	healthy.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if seq, ok := notification.Params.AdditionalFields["seq"].(float64); ok {
+			received <- int(seq)
+		}
+	})
+	require.NoError(t, healthy.Start(ctx))
+	_, err = healthy.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+
+	stalled, err := client.NewStreamableHttpClient(gateway.URL + "/mcp")
+	require.NoError(t, err)
+	defer func() { _ = stalled.Close() }()
+	require.NoError(t, stalled.Start(ctx))
+	_, err = stalled.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+	stalledSession := stalled.GetSessionId()
+
+	// open the stalled client's notification stream with a small receive buffer and never read from it
+	dialer := net.Dialer{Control: func(_, _ string, c syscall.RawConn) error {
+		return c.Control(func(fd uintptr) {
+			_ = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, 4096)
+		})
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", gateway.Listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_, err = fmt.Fprintf(conn, "GET /mcp HTTP/1.1\r\nHost: %s\r\nAccept: text/event-stream\r\n%s: %s\r\n\r\n", gateway.Listener.Addr(), server.HeaderKeySessionID, stalledSession)
+	require.NoError(t, err)
+
+	for _, sessionID := range []string{healthy.GetSessionId(), stalledSession} {
+		require.Eventually(t, func() bool {
+			return mcpServer.SendNotificationToSpecificClient(sessionID, "notifications/test/ready", nil) == nil
+		}, 5*time.Second, 10*time.Millisecond, "notification stream was not opened")
+	}
+
+	// the healthy client keeps receiving every notification while the stalled client's stream backs up
+	payload := strings.Repeat("x", 64*1024)
+	for i := range 300 {
+		mcpServer.SendNotificationToAllClients("notifications/test", map[string]any{"seq": i, "data": payload})
+		select {
+		case seq := <-received:
+			require.Equal(t, i, seq)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("healthy client did not receive notification %d", i)
+		}
+	}
+
+	// the stalled client's stream is closed once a write to it times out
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.Copy(io.Discard, conn)
+	require.NoError(t, err, "stalled client's stream should be closed")
+}
+
+func TestStreamedResponseNotCutOffByWriteTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const steps = 5
+	mcpServer := server.NewMCPServer("slow", "0.0.1", server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool("slow"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// the progress notifications turn the response into an event stream that outlasts the write timeout
+		for i := range steps {
+			time.Sleep(100 * time.Millisecond)
+			err := server.ServerFromContext(ctx).SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+				"progressToken": req.Params.Meta.ProgressToken,
+				"progress":      i + 1,
+				"total":         steps,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return mcp.NewToolResultText("done"), nil
+	})
+
+	gateway := httptest.NewUnstartedServer(NewNotificationStreamHandler(server.NewStreamableHTTPServer(mcpServer), time.Second, 0, logger))
+	gateway.Config.WriteTimeout = 250 * time.Millisecond
+	gateway.Start()
+	defer gateway.Close()
+
+	c, err := client.NewStreamableHttpClient(gateway.URL + "/mcp")
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+	var progress atomic.Int32
+	c.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == "notifications/progress" {
+			progress.Add(1)
+		}
+	})
+	require.NoError(t, c.Start(ctx))
+	_, err = c.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+
+	result, err := c.CallTool(ctx, mcp.CallToolRequest{Params: mcp.CallToolParams{
+		Name: "slow",
+		Meta: &mcp.Meta{ProgressToken: "slow-1"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	require.Equal(t, "done", result.Content[0].(mcp.TextContent).Text)
+	// the response was streamed rather than held until the tool finished
+	require.Positive(t, progress.Load())
+}
+
+func TestToolsListChangedNotifications(t *testing.T) {
+	testCases := []struct {
+		Name               string
+		Enabled            bool
+		ExpectNotification bool
+	}{
+		{Name: "enabled", Enabled: true, ExpectNotification: true},
+		{Name: "disabled", Enabled: false, ExpectNotification: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b := NewBroker(logger, WithToolsListChangedNotifications(tc.Enabled))
+			defer func() { _ = b.Shutdown(context.Background()) }()
+			mcpServer := b.MCPServer()
+			gateway := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+			defer gateway.Close()
+
+			received := make(chan string, 10)
+			gatewayClient, err := client.NewStreamableHttpClient(gateway.URL+"/mcp", transport.WithContinuousListening())
+			require.NoError(t, err)
+			defer func() { _ = gatewayClient.Close() }()
+			gatewayClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+				received <- notification.Method
+			})
+			require.NoError(t, gatewayClient.Start(ctx))
+			initResult, err := gatewayClient.Initialize(ctx, mcp.InitializeRequest{})
+			require.NoError(t, err)
+			require.NotNil(t, initResult.Capabilities.Tools)
+			require.Equal(t, tc.Enabled, initResult.Capabilities.Tools.ListChanged)
+			require.Eventually(t, func() bool {
+				return mcpServer.SendNotificationToSpecificClient(gatewayClient.GetSessionId(), "notifications/test/ready", nil) == nil
+			}, 5*time.Second, 10*time.Millisecond, "notification stream was not opened")
+			select {
+			case method := <-received:
+				require.Equal(t, "notifications/test/ready", method)
+			case <-time.After(5 * time.Second):
+				t.Fatal("client did not receive the ready notification")
+			}
+
+			b.(*mcpBrokerImpl).toolBudget.AddTools(budgetTestTools("mcp-test/server1", "s1_added")...)
+			// notifications are delivered in order so the marker arrives after any list changed notification
+			require.NoError(t, mcpServer.SendNotificationToSpecificClient(gatewayClient.GetSessionId(), "notifications/test/marker", nil))
+			var methods []string
+			for done := false; !done; {
+				select {
+				case method := <-received:
+					if method == "notifications/test/marker" {
+						done = true
+						break
+					}
+					methods = append(methods, method)
+				case <-time.After(5 * time.Second):
+					t.Fatal("client did not receive the marker notification")
+				}
+			}
+			if tc.ExpectNotification {
+				require.Equal(t, []string{mcp.MethodNotificationToolsListChanged}, methods)
+			} else {
+				require.Empty(t, methods)
+			}
+
+			// clients polling tools/list see the change either way
+			tools, err := gatewayClient.ListTools(ctx, mcp.ListToolsRequest{})
+			require.NoError(t, err)
+			require.Len(t, tools.Tools, 1)
+			require.Equal(t, "s1_added", tools.Tools[0].Name)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	envOAuthIssuerURL                      = "OAUTH_ISSUER_URL"
+	envOAuthProxyAuthorizationServer       = "OAUTH_PROXY_AUTHORIZATION_SERVER"
+	envOAuthAuthorizationServerMetadataTTL = "OAUTH_AUTHORIZATION_SERVER_METADATA_TTL"
+
+	// AuthorizationServerMetadataPath is the well known path the authorization server metadata is served on
+	AuthorizationServerMetadataPath = "/.well-known/oauth-authorization-server"
+
+	// DefaultAuthorizationServerMetadataTTL is how long fetched metadata is cached when no ttl is configured
+	DefaultAuthorizationServerMetadataTTL = 5 * time.Minute
+
+	maxAuthorizationServerMetadataBytes = 1 << 20
+)
+
+// AuthorizationServerMetadataHandler is the HTTP handler for the oauth authorization server metadata.
+// It fetches the metadata from the configured issuer and caches it so clients can complete discovery
+// through the gateway.
+type AuthorizationServerMetadataHandler struct {
+	Logger    *slog.Logger
+	IssuerURL string
+	CacheTTL  time.Duration
+	Client    *http.Client
+
+	lock      sync.Mutex
+	metadata  []byte
+	fetchedAt time.Time
+	now       func() time.Time
+}
+
+// NewAuthorizationServerMetadataHandler returns a handler serving the metadata of the issuer. A ttl of 0 or less uses the default
+func NewAuthorizationServerMetadataHandler(logger *slog.Logger, issuerURL string, ttl time.Duration) *AuthorizationServerMetadataHandler {
+	if ttl <= 0 {
+		ttl = DefaultAuthorizationServerMetadataTTL
+	}
+	return &AuthorizationServerMetadataHandler{
+		Logger:    logger,
+		IssuerURL: strings.TrimSuffix(issuerURL, "/"),
+		CacheTTL:  ttl,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+	}
+}
+
+// NewAuthorizationServerMetadataHandlerFromEnv returns a handler configured from environment variables or nil
+// if proxying the authorization server metadata is not enabled
+func NewAuthorizationServerMetadataHandlerFromEnv(logger *slog.Logger) *AuthorizationServerMetadataHandler {
+	if !proxyAuthorizationServer() {
+		return nil
+	}
+	issuer := os.Getenv(envOAuthIssuerURL)
+	if issuer == "" {
+		logger.Warn("authorization server proxy is enabled but no issuer is set, not serving metadata", "env", envOAuthIssuerURL)
+		return nil
+	}
+	var ttl time.Duration
+	if configured := os.Getenv(envOAuthAuthorizationServerMetadataTTL); configured != "" {
+		parsed, err := time.ParseDuration(configured)
+		if err != nil {
+			logger.Warn("invalid authorization server metadata ttl, using default", "value", configured, "default", DefaultAuthorizationServerMetadataTTL, "error", err)
+		}
+		ttl = parsed
+	}
+	return NewAuthorizationServerMetadataHandler(logger, issuer, ttl)
+}
+
+// proxyAuthorizationServer reports whether the gateway serves the authorization server metadata itself
+func proxyAuthorizationServer() bool {
+	return strings.EqualFold(os.Getenv(envOAuthProxyAuthorizationServer), "true")
+}
+
+// ServeHTTP handles the /.well-known/oauth-authorization-server endpoint
+func (h *AuthorizationServerMetadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS, HEAD")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept, Origin, X-Requested-With")
+	w.Header().Set("Access-Control-Max-Age", "3600")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata, err := h.getMetadata(r.Context())
+	if err != nil {
+		h.Logger.Error("failed to fetch authorization server metadata", "issuer", h.IssuerURL, "error", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(metadata); err != nil {
+		h.Logger.Error("failed to write authorization server metadata", "error", err)
+	}
+}
+
+// getMetadata returns the cached metadata, fetching it from the issuer once the ttl has passed.
+// If the fetch fails the previously cached metadata is returned so a brief issuer outage does not break discovery.
+func (h *AuthorizationServerMetadataHandler) getMetadata(ctx context.Context) ([]byte, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.metadata != nil && h.now().Sub(h.fetchedAt) < h.CacheTTL {
+		return h.metadata, nil
+	}
+	metadata, err := h.fetchMetadata(ctx)
+	if err != nil {
+		if h.metadata != nil {
+			h.Logger.Warn("failed to refresh authorization server metadata, serving cached copy", "issuer", h.IssuerURL, "error", err)
+			return h.metadata, nil
+		}
+		return nil, err
+	}
+	h.metadata = metadata
+	h.fetchedAt = h.now()
+	return metadata, nil
+}
+
+// fetchMetadata tries each of the issuer's metadata urls in turn and returns the first valid document
+func (h *AuthorizationServerMetadataHandler) fetchMetadata(ctx context.Context) ([]byte, error) {
+	metadataURLs, err := authorizationServerMetadataURLs(h.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for _, metadataURL := range metadataURLs {
+		metadata, err := h.fetch(ctx, metadataURL)
+		if err == nil {
+			h.Logger.Debug("fetched authorization server metadata", "url", metadataURL)
+			return metadata, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("no authorization server metadata found for issuer %s: %s", h.IssuerURL, strings.Join(errs, "; "))
+}
+
+func (h *AuthorizationServerMetadataHandler) fetch(ctx context.Context, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metadataURL, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metadataURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", metadataURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthorizationServerMetadataBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metadataURL, err)
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, fmt.Errorf("%s: invalid metadata: %w", metadataURL, err)
+	}
+	if _, ok := metadata["issuer"]; !ok {
+		return nil, fmt.Errorf("%s: metadata has no issuer", metadataURL)
+	}
+	return body, nil
+}
+
+// authorizationServerMetadataURLs returns the urls the issuer's metadata may be served on. RFC 8414 inserts the
+// well known path before the issuer path, some servers such as Keycloak append it to the issuer instead.
+func authorizationServerMetadataURLs(issuer string) ([]string, error) {
+	parsed, err := url.Parse(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer url %s: %w", issuer, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid issuer url %s: scheme and host are required", issuer)
+	}
+	issuerPath := strings.TrimSuffix(parsed.Path, "/")
+	origin := parsed.Scheme + "://" + parsed.Host
+	if issuerPath == "" {
+		return []string{origin + AuthorizationServerMetadataPath}, nil
+	}
+	return []string{
+		origin + AuthorizationServerMetadataPath + issuerPath,
+		origin + issuerPath + AuthorizationServerMetadataPath,
+	}, nil
+}
+
+// gatewayOrigin returns the origin the client used to reach the gateway
+func gatewayOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + r.Host
+}
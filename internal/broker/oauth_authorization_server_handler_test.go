@@ -0,0 +1,161 @@
+package broker
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newIssuer returns a test issuer serving metadata on the given path, a count of requests made to that path
+// and a switch that makes the issuer fail those requests
+func newIssuer(t *testing.T, metadataPath string) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+	var requests atomic.Int32
+	var failing atomic.Bool
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != metadataPath {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 srv.URL + "/realms/mcp",
+			"authorization_endpoint": srv.URL + "/realms/mcp/auth",
+			"token_endpoint":         srv.URL + "/realms/mcp/token",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &failing
+}
+
+func getMetadataDocument(t *testing.T, handler http.Handler) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, AuthorizationServerMetadataPath, nil))
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	return rec.Code, doc
+}
+
+func TestAuthorizationServerMetadataHandler(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		MetadataPath string
+	}{
+		{Name: "rfc 8414 well known path", MetadataPath: "/.well-known/oauth-authorization-server/realms/mcp"},
+		{Name: "well known path appended to issuer", MetadataPath: "/realms/mcp/.well-known/oauth-authorization-server"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			issuer, requests, _ := newIssuer(t, tc.MetadataPath)
+			handler := NewAuthorizationServerMetadataHandler(slog.Default(), issuer.URL+"/realms/mcp/", time.Minute)
+
+			code, doc := getMetadataDocument(t, handler)
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, issuer.URL+"/realms/mcp", doc["issuer"])
+			require.Equal(t, issuer.URL+"/realms/mcp/token", doc["token_endpoint"])
+			require.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
+
+func TestAuthorizationServerMetadataHandlerCache(t *testing.T) {
+	issuer, requests, failing := newIssuer(t, "/realms/mcp/.well-known/oauth-authorization-server")
+	handler := NewAuthorizationServerMetadataHandler(slog.Default(), issuer.URL+"/realms/mcp", time.Minute)
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+
+	code, _ := getMetadataDocument(t, handler)
+	require.Equal(t, http.StatusOK, code)
+	code, _ = getMetadataDocument(t, handler)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int32(1), requests.Load(), "metadata should be served from the cache within the ttl")
+
+	now = now.Add(2 * time.Minute)
+	code, _ = getMetadataDocument(t, handler)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int32(2), requests.Load(), "metadata should be fetched again once the ttl has passed")
+
+	// a failed refresh keeps serving the cached copy
+	failing.Store(true)
+	now = now.Add(2 * time.Minute)
+	code, doc := getMetadataDocument(t, handler)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, issuer.URL+"/realms/mcp", doc["issuer"])
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestAuthorizationServerMetadataHandlerUnavailable(t *testing.T) {
+	issuer, _, failing := newIssuer(t, "/.well-known/oauth-authorization-server")
+	failing.Store(true)
+	handler := NewAuthorizationServerMetadataHandler(slog.Default(), issuer.URL, 0)
+	require.Equal(t, DefaultAuthorizationServerMetadataTTL, handler.CacheTTL)
+
+	code, _ := getMetadataDocument(t, handler)
+	require.Equal(t, http.StatusBadGateway, code)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, AuthorizationServerMetadataPath, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestProtectedResourceAuthorizationServers(t *testing.T) {
+	testCases := []struct {
+		Name                string
+		Env                 map[string]string
+		ExpectedAuthServers []string
+	}{
+		{
+			Name:                "explicit authorization servers",
+			Env:                 map[string]string{envOAuthAuthorizationServers: "https://a.example.com, https://b.example.com", envOAuthIssuerURL: "https://issuer.example.com/realms/mcp"},
+			ExpectedAuthServers: []string{"https://a.example.com", "https://b.example.com"},
+		},
+		{
+			Name:                "derived from issuer",
+			Env:                 map[string]string{envOAuthIssuerURL: "https://issuer.example.com/realms/mcp/"},
+			ExpectedAuthServers: []string{"https://issuer.example.com/realms/mcp"},
+		},
+		{
+			Name:                "gateway when proxying the metadata",
+			Env:                 map[string]string{envOAuthIssuerURL: "https://issuer.example.com/realms/mcp", envOAuthProxyAuthorizationServer: "true"},
+			ExpectedAuthServers: []string{"https://mcp.example.com"},
+		},
+		{
+			Name:                "none configured",
+			ExpectedAuthServers: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			for _, env := range []string{envOAuthAuthorizationServers, envOAuthIssuerURL, envOAuthProxyAuthorizationServer} {
+				t.Setenv(env, tc.Env[env])
+			}
+			req := httptest.NewRequest(http.MethodGet, "http://mcp.example.com/.well-known/oauth-protected-resource", nil)
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+			handler := ProtectedResourceHandler{Logger: slog.Default()}
+			handler.Handle(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var resource OAuthProtectedResource
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resource))
+			require.Equal(t, tc.ExpectedAuthServers, resource.AuthorizationServers)
+		})
+	}
+}
@@ -30,8 +30,9 @@ type OAuthProtectedResource struct {
 	ScopesSupported        []string `json:"scopes_supported"`
 }
 
-// getOAuthConfig parses OAuth configuration from environment variables
-func getOAuthConfig() *OAuthProtectedResource {
+// getOAuthConfig parses OAuth configuration from environment variables. When the authorization servers are not
+// set they are derived from the issuer, or the gateway itself when it proxies the authorization server metadata.
+func getOAuthConfig(r *http.Request) *OAuthProtectedResource {
 	// Set defaults
 	oauthConfig := &OAuthProtectedResource{
 		ResourceName:           "MCP Server",
@@ -57,6 +58,13 @@ func getOAuthConfig() *OAuthProtectedResource {
 		for i, server := range servers {
 			oauthConfig.AuthorizationServers[i] = strings.TrimSpace(server)
 		}
+	} else if issuer := os.Getenv(envOAuthIssuerURL); issuer != "" {
+		// when proxied clients discover the authorization server metadata through the gateway
+		if proxyAuthorizationServer() {
+			oauthConfig.AuthorizationServers = []string{gatewayOrigin(r)}
+		} else {
+			oauthConfig.AuthorizationServers = []string{strings.TrimSuffix(issuer, "/")}
+		}
 	}
 
 	if bearerMethods := os.Getenv(envOAuthBearerMethodsSupported); bearerMethods != "" {
@@ -83,7 +91,7 @@ func getOAuthConfig() *OAuthProtectedResource {
 // Handle handles the /.well-known/oauth-protected-resource endpoint
 func (prh *ProtectedResourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	prh.Logger.Info("service protected resource endpoint")
-	oauthConfig := getOAuthConfig()
+	oauthConfig := getOAuthConfig(r)
 	// Set CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, HEAD")
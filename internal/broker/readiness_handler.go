@@ -0,0 +1,32 @@
+package broker
+
+import (
+	"net/http"
+)
+
+// ReadinessHandler rejects requests with a 503 until the broker is ready, that is once it has applied its first config
+// and finished the first discovery of the servers in it. Clients connecting while the gateway starts are asked to
+// retry rather than being served an empty gateway
+type ReadinessHandler struct {
+	next  http.Handler
+	ready <-chan struct{}
+}
+
+// NewReadinessHandler returns a handler that passes requests to next once ready is closed
+func NewReadinessHandler(next http.Handler, ready <-chan struct{}) *ReadinessHandler {
+	return &ReadinessHandler{
+		next:  next,
+		ready: ready,
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-h.ready:
+		h.next.ServeHTTP(w, r)
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "gateway is loading its config, retry shortly", http.StatusServiceUnavailable)
+	}
+}
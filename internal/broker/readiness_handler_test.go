@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(true))
+	upstreamServer.AddTool(mcp.NewTool("echo"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	mcpHandler := server.NewStreamableHTTPServer(upstreamServer)
+	// the upstream holds every request until released so the first discovery is still running when checked
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	b := NewBroker(logger, WithManagerTickerInterval(time.Minute))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	handler := NewReadinessHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), b.Ready())
+	request := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+		return recorder
+	}
+
+	// no config has been loaded yet
+	response := request()
+	require.Equal(t, http.StatusServiceUnavailable, response.Code)
+	require.Equal(t, "1", response.Header().Get("Retry-After"))
+
+	// the config is loaded but the server is still being discovered
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{
+		{Name: "test/server", URL: srv.URL + "/mcp", ToolPrefix: "s_", Hostname: "server.mcp.local", Enabled: true},
+	}})
+	require.Equal(t, http.StatusServiceUnavailable, request().Code)
+
+	close(release)
+	require.Eventually(t, func() bool { return request().Code == http.StatusOK }, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, b.MCPServer().ListTools(), "s_echo")
+}
+
+func TestReadyWithoutServers(t *testing.T) {
+	b := NewBroker(logger)
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	b.OnConfigChange(context.Background(), &config.MCPServersConfig{})
+	select {
+	case <-b.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("broker without servers did not become ready")
+	}
+}
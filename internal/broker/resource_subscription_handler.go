@@ -0,0 +1,106 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	methodResourcesSubscribe   = "resources/subscribe"
+	methodResourcesUnsubscribe = "resources/unsubscribe"
+
+	maxSubscriptionRequestBytes = 1 << 20
+)
+
+// ResourceSubscriptionHandler handles resources/subscribe and resources/unsubscribe requests before they reach the
+// MCP server as the MCP server has no way to relay them to the upstreams. Every other request is passed to next.
+// Ending a session with DELETE also removes its subscriptions.
+type ResourceSubscriptionHandler struct {
+	next   http.Handler
+	broker MCPBroker
+	logger *slog.Logger
+}
+
+// NewResourceSubscriptionHandler returns a handler that handles resource subscriptions using the broker before passing other requests to next
+func NewResourceSubscriptionHandler(next http.Handler, broker MCPBroker, logger *slog.Logger) *ResourceSubscriptionHandler {
+	return &ResourceSubscriptionHandler{
+		next:   next,
+		broker: broker,
+		logger: logger,
+	}
+}
+
+type subscriptionMessage struct {
+	ID     mcp.RequestId `json:"id"`
+	Method string        `json:"method"`
+	Params struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *ResourceSubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get(server.HeaderKeySessionID)
+	if r.Method == http.MethodDelete && sessionID != "" {
+		h.next.ServeHTTP(w, r)
+		h.broker.RemoveSession(r.Context(), sessionID)
+		return
+	}
+	if r.Method != http.MethodPost || r.Body == nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSubscriptionRequestBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	var msg subscriptionMessage
+	if len(body) > maxSubscriptionRequestBytes || json.Unmarshal(body, &msg) != nil ||
+		(msg.Method != methodResourcesSubscribe && msg.Method != methodResourcesUnsubscribe) {
+		// not a subscription request, batches and invalid messages are left to the MCP server to reject
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if sessionID == "" {
+		http.Error(w, "Bad Request: Mcp-Session-Id header must be provided", http.StatusBadRequest)
+		return
+	}
+	if msg.Params.URI == "" {
+		h.writeResponse(w, mcp.NewJSONRPCError(msg.ID, mcp.INVALID_PARAMS, "uri is required", nil))
+		return
+	}
+
+	if msg.Method == methodResourcesSubscribe {
+		err = h.broker.SubscribeResource(r.Context(), sessionID, msg.Params.URI)
+	} else {
+		err = h.broker.UnsubscribeResource(r.Context(), sessionID, msg.Params.URI)
+	}
+	switch {
+	case errors.Is(err, ErrNoResourceSubscriber):
+		h.writeResponse(w, mcp.NewJSONRPCError(msg.ID, mcp.RESOURCE_NOT_FOUND, err.Error(), nil))
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "failed to update resource subscription", "method", msg.Method, "uri", msg.Params.URI, "gatewaySessionID", sessionID, "error", err)
+		h.writeResponse(w, mcp.NewJSONRPCError(msg.ID, mcp.INTERNAL_ERROR, err.Error(), nil))
+	default:
+		h.writeResponse(w, mcp.NewJSONRPCResultResponse(msg.ID, mcp.EmptyResult{}))
+	}
+}
+
+func (h *ResourceSubscriptionHandler) writeResponse(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("failed to write resource subscription response", "error", err)
+	}
+}
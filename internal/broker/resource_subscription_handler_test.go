@@ -0,0 +1,194 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribableUpstream is an upstream MCP server that accepts resource subscriptions and records them
+type subscribableUpstream struct {
+	mcpServer *server.MCPServer
+	lock      sync.Mutex
+	requests  []string
+}
+
+func newSubscribableUpstream(t *testing.T) (*subscribableUpstream, *httptest.Server) {
+	t.Helper()
+	up := &subscribableUpstream{mcpServer: server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false), server.WithResourceCapabilities(true, false))}
+	up.mcpServer.AddTool(mcp.NewTool("read"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("read"), nil
+	})
+	mcpHandler := server.NewStreamableHTTPServer(up.mcpServer)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			var msg subscriptionMessage
+			if json.Unmarshal(body, &msg) == nil && (msg.Method == methodResourcesSubscribe || msg.Method == methodResourcesUnsubscribe) {
+				up.lock.Lock()
+				up.requests = append(up.requests, msg.Method+" "+msg.Params.URI)
+				up.lock.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(mcp.NewJSONRPCResultResponse(msg.ID, mcp.EmptyResult{}))
+				return
+			}
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+		}
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return up, srv
+}
+
+func (up *subscribableUpstream) received() []string {
+	up.lock.Lock()
+	defer up.lock.Unlock()
+	return append([]string{}, up.requests...)
+}
+
+func TestResourceSubscriptionRelaysUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	upstreamServer, upstreamSrv := newSubscribableUpstream(t)
+
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	mcpServer := &config.MCPServer{Name: "resources", URL: upstreamSrv.URL + "/mcp"}
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{mcpServer}})
+	require.Eventually(t, func() bool {
+		man, ok := b.RegisteredMCPServers()[mcpServer.ID()]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	gateway := httptest.NewServer(NewResourceSubscriptionHandler(server.NewStreamableHTTPServer(b.MCPServer()), b, logger))
+	defer gateway.Close()
+
+	mcpClient, err := client.NewStreamableHttpClient(gateway.URL+"/mcp", transport.WithContinuousListening())
+	require.NoError(t, err)
+	defer func() { _ = mcpClient.Close() }()
+	updates := make(chan string, 10)
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == notificationResourcesUpdated {
+			uri, _ := notification.Params.AdditionalFields["uri"].(string)
+			updates <- uri
+		}
+	})
+	require.NoError(t, mcpClient.Start(ctx))
+	initResult, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+	require.NotNil(t, initResult.Capabilities.Resources)
+	require.True(t, initResult.Capabilities.Resources.Subscribe)
+
+	subscribe := mcp.SubscribeRequest{}
+	subscribe.Params.URI = "test://doc"
+	require.NoError(t, mcpClient.Subscribe(ctx, subscribe))
+	require.Equal(t, []string{"resources/subscribe test://doc"}, upstreamServer.received())
+
+	// the gateway's listening stream is opened asynchronously so keep notifying until the update is relayed
+	require.Eventually(t, func() bool {
+		upstreamServer.mcpServer.SendNotificationToAllClients(notificationResourcesUpdated, map[string]any{"uri": "test://doc"})
+		select {
+		case uri := <-updates:
+			return uri == "test://doc"
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	unsubscribe := mcp.UnsubscribeRequest{}
+	unsubscribe.Params.URI = "test://doc"
+	require.NoError(t, mcpClient.Unsubscribe(ctx, unsubscribe))
+	require.Equal(t, []string{"resources/subscribe test://doc", "resources/unsubscribe test://doc"}, upstreamServer.received())
+}
+
+func TestResourceSubscriptionHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Next", string(body))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := NewResourceSubscriptionHandler(next, NewBroker(logger), logger)
+
+	testCases := []struct {
+		Name           string
+		Body           string
+		SessionID      string
+		ExpectedStatus int
+		ExpectedCode   int
+	}{
+		{
+			Name:           "other methods are passed on with the body intact",
+			Body:           `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			SessionID:      "session",
+			ExpectedStatus: http.StatusAccepted,
+		},
+		{
+			Name:           "subscribe without a session",
+			Body:           `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"test://doc"}}`,
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "subscribe without a uri",
+			Body:           `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{}}`,
+			SessionID:      "session",
+			ExpectedStatus: http.StatusOK,
+			ExpectedCode:   mcp.INVALID_PARAMS,
+		},
+		{
+			Name:           "subscribe with no upstream accepting",
+			Body:           `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"test://doc"}}`,
+			SessionID:      "session",
+			ExpectedStatus: http.StatusOK,
+			ExpectedCode:   mcp.RESOURCE_NOT_FOUND,
+		},
+		{
+			Name:           "unsubscribe from a resource never subscribed to",
+			Body:           `{"jsonrpc":"2.0","id":1,"method":"resources/unsubscribe","params":{"uri":"test://doc"}}`,
+			SessionID:      "session",
+			ExpectedStatus: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(tc.Body))
+			if tc.SessionID != "" {
+				req.Header.Set(server.HeaderKeySessionID, tc.SessionID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tc.ExpectedStatus, rec.Code)
+			if rec.Code == http.StatusAccepted {
+				require.Equal(t, tc.Body, rec.Header().Get("X-Next"))
+				return
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var response struct {
+				Error *struct {
+					Code int `json:"code"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			if tc.ExpectedCode == 0 {
+				require.Nil(t, response.Error)
+				return
+			}
+			require.NotNil(t, response.Error)
+			require.Equal(t, tc.ExpectedCode, response.Error.Code)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+)
+
+const notificationResourcesUpdated = "notifications/resources/updated"
+
+// ErrNoResourceSubscriber is returned when no upstream accepts a subscription to a resource
+var ErrNoResourceSubscriber = errors.New("no upstream server accepted the resource subscription")
+
+// resourceSubscriptions tracks the downstream sessions subscribed to each resource and the upstream server the
+// subscription was made on. Resources are not federated so the gateway does not know which upstream serves a uri,
+// the first upstream to accept the subscription owns it.
+type resourceSubscriptions struct {
+	// updateLock serializes subscribe and unsubscribe so a resource is only subscribed to once per upstream
+	updateLock sync.Mutex
+	// lock protects owners and sessions. It is not held while talking to upstreams so relaying updates never waits on them
+	lock sync.RWMutex
+	// owners maps a resource uri to the upstream server it is subscribed on
+	owners map[string]config.UpstreamMCPID
+	// sessions maps a resource uri to the downstream sessions subscribed to it
+	sessions map[string]map[string]struct{}
+}
+
+func newResourceSubscriptions() *resourceSubscriptions {
+	return &resourceSubscriptions{
+		owners:   map[string]config.UpstreamMCPID{},
+		sessions: map[string]map[string]struct{}{},
+	}
+}
+
+func (rs *resourceSubscriptions) owner(uri string) (config.UpstreamMCPID, bool) {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	id, ok := rs.owners[uri]
+	return id, ok
+}
+
+func (rs *resourceSubscriptions) add(sessionID, uri string, owner config.UpstreamMCPID) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.owners[uri] = owner
+	if rs.sessions[uri] == nil {
+		rs.sessions[uri] = map[string]struct{}{}
+	}
+	rs.sessions[uri][sessionID] = struct{}{}
+}
+
+// remove removes the session's subscription. If it was the last session subscribed to the resource the owner is
+// returned so the upstream subscription can be removed
+func (rs *resourceSubscriptions) remove(sessionID, uri string) (config.UpstreamMCPID, bool) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	delete(rs.sessions[uri], sessionID)
+	if len(rs.sessions[uri]) > 0 {
+		return "", false
+	}
+	owner, ok := rs.owners[uri]
+	delete(rs.sessions, uri)
+	delete(rs.owners, uri)
+	return owner, ok
+}
+
+// sessionResources returns the uris the session is subscribed to
+func (rs *resourceSubscriptions) sessionResources(sessionID string) []string {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	var uris []string
+	for uri, sessions := range rs.sessions {
+		if _, ok := sessions[sessionID]; ok {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// subscribers returns the sessions subscribed to the resource if the subscription is owned by the server
+func (rs *resourceSubscriptions) subscribers(serverID config.UpstreamMCPID, uri string) []string {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	if rs.owners[uri] != serverID {
+		return nil
+	}
+	sessions := make([]string, 0, len(rs.sessions[uri]))
+	for sessionID := range rs.sessions[uri] {
+		sessions = append(sessions, sessionID)
+	}
+	return sessions
+}
+
+// removeServer drops every subscription owned by the server and returns the uris dropped
+func (rs *resourceSubscriptions) removeServer(serverID config.UpstreamMCPID) []string {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	var uris []string
+	for uri, owner := range rs.owners {
+		if owner == serverID {
+			uris = append(uris, uri)
+			delete(rs.owners, uri)
+			delete(rs.sessions, uri)
+		}
+	}
+	return uris
+}
+
+// SubscribeResource subscribes the session to updates of the resource. The upstream servers that support resource
+// subscriptions are tried in order of id and the first to accept the subscription owns the resource.
+func (m *mcpBrokerImpl) SubscribeResource(ctx context.Context, sessionID, uri string) error {
+	m.resourceSubscriptions.updateLock.Lock()
+	defer m.resourceSubscriptions.updateLock.Unlock()
+	if owner, ok := m.resourceSubscriptions.owner(uri); ok {
+		m.resourceSubscriptions.add(sessionID, uri, owner)
+		return nil
+	}
+
+	for _, manager := range m.sortedManagers() {
+		err := manager.SubscribeResource(ctx, uri)
+		if err == nil {
+			m.logger.DebugContext(ctx, "subscribed to resource", "uri", uri, "upstream mcp server", manager.MCP.ID(), "gatewaySessionID", sessionID)
+			m.resourceSubscriptions.add(sessionID, uri, manager.MCP.ID())
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, upstream.ErrResourceSubscribeUnsupported) {
+			m.logger.DebugContext(ctx, "upstream did not accept resource subscription", "uri", uri, "upstream mcp server", manager.MCP.ID(), "error", err)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNoResourceSubscriber, uri)
+}
+
+// UnsubscribeResource removes the session's subscription to the resource. The upstream subscription is removed once
+// no session is subscribed.
+func (m *mcpBrokerImpl) UnsubscribeResource(ctx context.Context, sessionID, uri string) error {
+	m.resourceSubscriptions.updateLock.Lock()
+	defer m.resourceSubscriptions.updateLock.Unlock()
+	return m.unsubscribeResource(ctx, sessionID, uri)
+}
+
+// removeSessionSubscriptions removes every resource subscription held by the session
+func (m *mcpBrokerImpl) removeSessionSubscriptions(ctx context.Context, sessionID string) {
+	m.resourceSubscriptions.updateLock.Lock()
+	defer m.resourceSubscriptions.updateLock.Unlock()
+	for _, uri := range m.resourceSubscriptions.sessionResources(sessionID) {
+		if err := m.unsubscribeResource(ctx, sessionID, uri); err != nil {
+			m.logger.Warn("failed to remove resource subscription for session", "uri", uri, "gatewaySessionID", sessionID, "error", err)
+		}
+	}
+}
+
+// unsubscribeResource must be called with the subscriptions updateLock held
+func (m *mcpBrokerImpl) unsubscribeResource(ctx context.Context, sessionID, uri string) error {
+	owner, last := m.resourceSubscriptions.remove(sessionID, uri)
+	if !last {
+		return nil
+	}
+	m.mcpLock.RLock()
+	manager, ok := m.mcpServers[owner]
+	m.mcpLock.RUnlock()
+	if !ok {
+		return nil
+	}
+	m.logger.Debug("unsubscribing from resource", "uri", uri, "upstream mcp server", owner)
+	return manager.UnsubscribeResource(ctx, uri)
+}
+
+// relayResourceUpdated sends a resources updated notification from an upstream server to the subscribed sessions.
+// It is called as notifications are read from the upstream so it does not wait on the downstream sessions.
+func (m *mcpBrokerImpl) relayResourceUpdated(serverID config.UpstreamMCPID, uri string) {
+	for _, sessionID := range m.resourceSubscriptions.subscribers(serverID, uri) {
+		err := m.listeningMCPServer.SendNotificationToSpecificClient(sessionID, notificationResourcesUpdated, map[string]any{"uri": uri})
+		if err != nil {
+			// the session may not have a listening stream open, the client is expected to read the resource once it does
+			m.logger.Debug("failed to relay resource updated notification", "uri", uri, "gatewaySessionID", sessionID, "error", err)
+		}
+	}
+}
+
+// dropResourceSubscriptions drops the subscriptions owned by a server that is being removed. Subscribed sessions
+// stop receiving updates for these resources and need to subscribe again.
+func (m *mcpBrokerImpl) dropResourceSubscriptions(serverID config.UpstreamMCPID) {
+	if uris := m.resourceSubscriptions.removeServer(serverID); len(uris) > 0 {
+		m.logger.Info("dropped resource subscriptions for removed server", "server id", serverID, "uris", uris)
+	}
+}
@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// sortedManagers returns the managers of the registered servers in order of server id
+func (m *mcpBrokerImpl) sortedManagers() []*upstream.MCPManager {
+	m.mcpLock.RLock()
+	managers := make([]*upstream.MCPManager, 0, len(m.mcpServers))
+	for _, manager := range m.mcpServers {
+		managers = append(managers, manager)
+	}
+	m.mcpLock.RUnlock()
+	slices.SortFunc(managers, func(a, b *upstream.MCPManager) int {
+		return cmp.Compare(a.MCP.ID(), b.MCP.ID())
+	})
+	return managers
+}
+
+// listResourceTemplates replaces the templates listed by the broker's MCP server with the resource templates of the
+// ready upstream servers. The templates of all servers are returned in a single page
+func (m *mcpBrokerImpl) listResourceTemplates(result *mcp.ListResourceTemplatesResult) {
+	templates := []mcp.ResourceTemplate{}
+	for _, manager := range m.sortedManagers() {
+		if !manager.GetStatus().Ready {
+			continue
+		}
+		templates = append(templates, manager.ResourceTemplates()...)
+	}
+	result.ResourceTemplates = templates
+	result.NextCursor = ""
+}
+
+// ResourceTemplateServer returns the name of the server with a resource template matching the uri and the uri to
+// read from that server. Servers are checked in order of id so a uri matching the templates of several servers,
+// such as servers without a tool prefix, is read from the same server each time
+func (m *mcpBrokerImpl) ResourceTemplateServer(uri string) (string, string, bool) {
+	for _, manager := range m.sortedManagers() {
+		if !manager.GetStatus().Ready {
+			continue
+		}
+		if upstreamURI, ok := manager.UpstreamResourceURI(uri); ok {
+			return manager.MCPName(), upstreamURI, true
+		}
+	}
+	return "", "", false
+}
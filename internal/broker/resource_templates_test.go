@@ -0,0 +1,74 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceTemplatesAreFederated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newUpstream := func(opts ...server.ServerOption) (*server.MCPServer, string) {
+		mcpServer := server.NewMCPServer("upstream", "0.0.1", append(opts, server.WithToolCapabilities(true))...)
+		mcpServer.AddTool(mcp.NewTool("echo"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("echo"), nil
+		})
+		srv := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+		t.Cleanup(srv.Close)
+		return mcpServer, srv.URL + "/mcp"
+	}
+	// the files server has a resource template but no concrete resources
+	filesServer, filesURL := newUpstream(server.WithResourceCapabilities(false, false))
+	filesServer.AddResourceTemplate(mcp.NewResourceTemplate("file:///{path}", "file", mcp.WithTemplateMIMEType("text/plain")),
+		func(_ context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, Text: "content"}}, nil
+		})
+	_, toolsURL := newUpstream()
+
+	files := &config.MCPServer{Name: "test/files", URL: filesURL, ToolPrefix: "files_", Hostname: "files.mcp.local", Enabled: true}
+	toolsOnly := &config.MCPServer{Name: "test/tools", URL: toolsURL, ToolPrefix: "t_", Hostname: "tools.mcp.local", Enabled: true}
+	b := NewBroker(logger, WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{files, toolsOnly}})
+	require.Eventually(t, func() bool {
+		registered := b.RegisteredMCPServers()
+		for _, mcpServer := range []*config.MCPServer{files, toolsOnly} {
+			man, ok := registered[mcpServer.ID()]
+			if !ok || !man.GetStatus().Ready {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 20*time.Millisecond)
+
+	response := b.MCPServer().HandleMessage(ctx, json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"resources/templates/list"}`))
+	result, ok := response.(mcp.JSONRPCResponse)
+	require.True(t, ok, "unexpected response %v", response)
+	listResult, ok := result.Result.(mcp.ListResourceTemplatesResult)
+	require.True(t, ok, "unexpected result %T", result.Result)
+	require.Len(t, listResult.ResourceTemplates, 1)
+	require.Equal(t, "files_file:///{path}", listResult.ResourceTemplates[0].URITemplate.Raw())
+	require.Equal(t, "text/plain", listResult.ResourceTemplates[0].MIMEType)
+
+	serverName, upstreamURI, ok := b.ResourceTemplateServer("files_file:///readme.md")
+	require.True(t, ok)
+	require.Equal(t, "test/files", serverName)
+	require.Equal(t, "file:///readme.md", upstreamURI)
+
+	// a uri without the prefix is not read from the server
+	_, _, ok = b.ResourceTemplateServer("file:///readme.md")
+	require.False(t, ok)
+
+	// the templates are removed with the server
+	b.OnConfigChange(ctx, &config.MCPServersConfig{Servers: []*config.MCPServer{toolsOnly}})
+	_, _, ok = b.ResourceTemplateServer("files_file:///readme.md")
+	require.False(t, ok)
+}
@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManyServers federates many servers to guard against discovery and tool registration that grow with the square
+// of the number of servers. The discovery time and heap are logged to compare runs, run with -v to see them
+func TestManyServers(t *testing.T) {
+	const (
+		servers        = 100
+		toolsPerServer = 5
+		// discoveryLimit is far above the time discovery takes so the test only fails when it no longer scales
+		discoveryLimit = 30 * time.Second
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(true))
+	for i := range toolsPerServer {
+		upstreamServer.AddTool(mcp.NewTool(fmt.Sprintf("tool_%d", i)), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+	}
+	// every server is the same upstream under its own name and prefix
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer srv.Close()
+	serversConfig := func(count int) *config.MCPServersConfig {
+		conf := &config.MCPServersConfig{}
+		for i := range count {
+			conf.Servers = append(conf.Servers, &config.MCPServer{
+				Name:       fmt.Sprintf("test/server-%d", i),
+				URL:        srv.URL + "/mcp",
+				ToolPrefix: fmt.Sprintf("s%d_", i),
+				Hostname:   fmt.Sprintf("server-%d.mcp.local", i),
+				Enabled:    true,
+			})
+		}
+		return conf
+	}
+	// requireTools requires the gateway to list each tool of the first count servers once and no other tools
+	requireTools := func(t *testing.T, b MCPBroker, count int) {
+		t.Helper()
+		tools := b.MCPServer().ListTools()
+		require.Len(t, tools, count*toolsPerServer)
+		for i := range count {
+			for j := range toolsPerServer {
+				require.Contains(t, tools, fmt.Sprintf("s%d_tool_%d", i, j))
+			}
+		}
+	}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b := NewBroker(logger, WithManagerTickerInterval(time.Minute))
+	defer func() { _ = b.Shutdown(context.Background()) }()
+	start := time.Now()
+	b.OnConfigChange(ctx, serversConfig(servers))
+	select {
+	case <-b.Ready():
+	case <-time.After(discoveryLimit):
+		t.Fatalf("discovery of %d servers took longer than %s", servers, discoveryLimit)
+	}
+	discovery := time.Since(start)
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	t.Logf("discovered %d servers with %d tools in %s, heap grew %d KiB", servers, servers*toolsPerServer, discovery, (int64(after.HeapAlloc)-int64(before.HeapAlloc))/1024)
+
+	for _, status := range b.ValidateAllServers().Servers {
+		require.True(t, status.Ready, "server %s is not ready: %s", status.Name, status.Message)
+	}
+	requireTools(t, b, servers)
+
+	// removing servers leaves the tools of the others
+	b.OnConfigChange(ctx, serversConfig(servers/2))
+	require.Eventually(t, func() bool { return len(b.MCPServer().ListTools()) == servers/2*toolsPerServer }, 10*time.Second, 20*time.Millisecond)
+	requireTools(t, b, servers/2)
+}
@@ -0,0 +1,57 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// SessionIdentityStore stores the verified identity of a gateway session's client so the router can count the tool
+// calls of the session against a quota and refuse calls to the tools of other tenants
+type SessionIdentityStore interface {
+	SetSessionIdentity(ctx context.Context, id, kind, value string) error
+}
+
+// WithSessionIdentity records the identity of each client that initializes in the store. The subject is the value of
+// the subjectHeader, which the router removes from client requests so only the gateway's authentication sets it. The
+// tenant is the tenant of a valid x-mcp-tenant header when tenant isolation is enabled
+func WithSessionIdentity(store SessionIdentityStore, subjectHeader string) func(mb *mcpBrokerImpl) {
+	return func(mb *mcpBrokerImpl) {
+		mb.sessionIdentities = store
+		mb.subjectHeader = subjectHeader
+	}
+}
+
+// recordSessionIdentity stores the subject and tenant of the client initializing the session in the context. Nothing
+// is stored for a client without either, so its tool calls share the quota of the clients without an identity
+func (m *mcpBrokerImpl) recordSessionIdentity(ctx context.Context, headers http.Header) {
+	if m.sessionIdentities == nil {
+		return
+	}
+	clientSession := server.ClientSessionFromContext(ctx)
+	if clientSession == nil || clientSession.SessionID() == "" {
+		return
+	}
+	identity := map[string]string{}
+	if m.subjectHeader != "" {
+		if subject := headers.Get(m.subjectHeader); subject != "" {
+			identity[session.IdentitySubject] = subject
+		}
+	}
+	m.tenancyLock.RLock()
+	tenancy := m.tenancy
+	m.tenancyLock.RUnlock()
+	if tenancy != nil && tenancy.Enabled {
+		if tenant, err := m.parseTenantJWT(headers[tenantHeader], tenancy.TenantClaim()); err == nil {
+			identity[session.IdentityTenant] = tenant
+		}
+	}
+	for kind, value := range identity {
+		if err := m.sessionIdentities.SetSessionIdentity(ctx, clientSession.SessionID(), kind, value); err != nil {
+			m.logger.ErrorContext(ctx, "failed to store session identity", "gatewaySessionID", clientSession.SessionID(), "kind", kind, "error", err)
+		}
+	}
+	m.logger.DebugContext(ctx, "recorded session identity", "gatewaySessionID", clientSession.SessionID(), "identities", len(identity))
+}
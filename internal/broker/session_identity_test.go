@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+// identityStore records the identities stored for each session
+type identityStore map[string]map[string]string
+
+func (s identityStore) SetSessionIdentity(_ context.Context, id, kind, value string) error {
+	if s[id] == nil {
+		s[id] = map[string]string{}
+	}
+	s[id][kind] = value
+	return nil
+}
+
+func TestRecordSessionIdentity(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Tenancy        *config.Tenancy
+		Headers        map[string]string
+		ExpectIdentity map[string]string
+	}{
+		{
+			Name:           "subject set by the gateway's authentication",
+			Headers:        map[string]string{"X-Mcp-Subject": "alice"},
+			ExpectIdentity: map[string]string{session.IdentitySubject: "alice"},
+		},
+		{
+			Name:    "client without a subject",
+			Headers: map[string]string{},
+		},
+		{
+			Name:           "tenant of a signed tenant header",
+			Tenancy:        &config.Tenancy{Enabled: true},
+			Headers:        map[string]string{"X-Mcp-Subject": "alice", tenantHeader: signTestJWT(t, jwt.MapClaims{"tenant": "team-a"})},
+			ExpectIdentity: map[string]string{session.IdentitySubject: "alice", session.IdentityTenant: "team-a"},
+		},
+		{
+			Name:    "unsigned tenant header is ignored",
+			Tenancy: &config.Tenancy{Enabled: true},
+			Headers: map[string]string{tenantHeader: "team-a"},
+		},
+		{
+			Name:    "tenant is not recorded without tenant isolation",
+			Headers: map[string]string{tenantHeader: signTestJWT(t, jwt.MapClaims{"tenant": "team-a"})},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			store := identityStore{}
+			mcpBroker := &mcpBrokerImpl{
+				trustedHeadersPublicKey: testPublicKey,
+				logger:                  slog.New(slog.DiscardHandler),
+				tenancy:                 tc.Tenancy,
+			}
+			WithSessionIdentity(store, "x-mcp-subject")(mcpBroker)
+			headers := http.Header{}
+			for name, value := range tc.Headers {
+				headers.Set(name, value)
+			}
+			ctx := server.NewMCPServer("test", "0.0.1").WithContext(context.Background(), server.NewInProcessSession("gateway-session", nil))
+			mcpBroker.recordSessionIdentity(ctx, headers)
+			require.Equal(t, tc.ExpectIdentity, store["gateway-session"])
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// SessionKeyFingerprintPath is the path of the internal endpoint serving the fingerprint of the session signing key
+const SessionKeyFingerprintPath = "/session-key/fingerprint"
+
+// ErrSessionKeyMismatch is returned when another gateway component signs sessions with a different key
+var ErrSessionKeyMismatch = errors.New("session signing key mismatch")
+
+// SessionKeyFingerprint is the document served by the fingerprint endpoint
+type SessionKeyFingerprint struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SessionKeyFingerprintHandler serves GET /session-key/fingerprint so components can check they sign and validate
+// gateway session ids with the same key. Requests must carry the router key as a bearer token.
+type SessionKeyFingerprintHandler struct {
+	fingerprint string
+	apiKey      string
+	logger      *slog.Logger
+}
+
+// NewSessionKeyFingerprintHandler returns a handler serving the fingerprint. An empty apiKey rejects every request
+func NewSessionKeyFingerprintHandler(fingerprint, apiKey string, logger *slog.Logger) *SessionKeyFingerprintHandler {
+	return &SessionKeyFingerprintHandler{
+		fingerprint: fingerprint,
+		apiKey:      apiKey,
+		logger:      logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *SessionKeyFingerprintHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed. Supported methods: GET"})
+		return
+	}
+	if !hasBearerToken(r, h.apiKey) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		h.sendJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	h.sendJSON(w, http.StatusOK, SessionKeyFingerprint{Fingerprint: h.fingerprint})
+}
+
+func (h *SessionKeyFingerprintHandler) sendJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to encode session key fingerprint response", "error", err)
+	}
+}
+
+// CheckSessionKeyFingerprint fetches the fingerprint served at url and compares it with the local one. It returns an
+// error wrapping ErrSessionKeyMismatch when they differ and another error when the fingerprint cannot be fetched
+func CheckSessionKeyFingerprint(ctx context.Context, client *http.Client, url, apiKey, fingerprint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching session key fingerprint from %s", resp.StatusCode, url)
+	}
+	var remote SessionKeyFingerprint
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&remote); err != nil {
+		return fmt.Errorf("invalid session key fingerprint from %s: %w", url, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(remote.Fingerprint), []byte(fingerprint)) != 1 {
+		return fmt.Errorf("%w: %s signs gateway sessions with a different key (fingerprint %s, local %s). Every broker and router must use the same --session-signing-key", ErrSessionKeyMismatch, url, remote.Fingerprint, fingerprint)
+	}
+	return nil
+}
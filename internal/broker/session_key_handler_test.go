@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionKeyFingerprintHandler(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		Method            string
+		APIKey            string
+		Token             string
+		ExpectStatus      int
+		ExpectFingerprint string
+	}{
+		{Name: "serves fingerprint", Method: http.MethodGet, APIKey: "secret", Token: "secret", ExpectStatus: http.StatusOK, ExpectFingerprint: "abc123"},
+		{Name: "missing token", Method: http.MethodGet, APIKey: "secret", ExpectStatus: http.StatusUnauthorized},
+		{Name: "wrong token", Method: http.MethodGet, APIKey: "secret", Token: "not-the-secret", ExpectStatus: http.StatusUnauthorized},
+		{Name: "no key configured", Method: http.MethodGet, ExpectStatus: http.StatusUnauthorized},
+		{Name: "not get", Method: http.MethodPost, APIKey: "secret", Token: "secret", ExpectStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			handler := NewSessionKeyFingerprintHandler("abc123", tc.APIKey, logger)
+			req := httptest.NewRequest(tc.Method, SessionKeyFingerprintPath, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.Token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tc.ExpectStatus, w.Result().StatusCode)
+			if tc.ExpectFingerprint != "" {
+				var doc SessionKeyFingerprint
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+				require.Equal(t, tc.ExpectFingerprint, doc.Fingerprint)
+			}
+		})
+	}
+}
+
+func TestCheckSessionKeyFingerprint(t *testing.T) {
+	peer := httptest.NewServer(NewSessionKeyFingerprintHandler("abc123", "secret", logger))
+	defer peer.Close()
+	url := peer.URL + SessionKeyFingerprintPath
+	ctx := context.Background()
+
+	t.Run("matching key", func(t *testing.T) {
+		require.NoError(t, CheckSessionKeyFingerprint(ctx, peer.Client(), url, "secret", "abc123"))
+	})
+
+	t.Run("different key", func(t *testing.T) {
+		err := CheckSessionKeyFingerprint(ctx, peer.Client(), url, "secret", "def456")
+		require.ErrorIs(t, err, ErrSessionKeyMismatch)
+		require.ErrorContains(t, err, "--session-signing-key")
+	})
+
+	t.Run("fingerprint not readable", func(t *testing.T) {
+		err := CheckSessionKeyFingerprint(ctx, peer.Client(), url, "wrong-router-key", "abc123")
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrSessionKeyMismatch)
+	})
+}
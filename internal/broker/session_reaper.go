@@ -0,0 +1,93 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultKeepAliveInterval is how long a client's notification stream may be idle before the broker writes a keep-alive to it
+const DefaultKeepAliveInterval = 30 * time.Second
+
+var reapedSessions = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "mcp_gateway_broker_reaped_sessions_total",
+	Help: "Gateway sessions whose notification stream was lost and not reopened, so their upstream sessions were closed",
+})
+
+func init() {
+	prometheus.MustRegister(reapedSessions)
+}
+
+// SessionReaper cleans up after gateway sessions whose client has gone away. Keep-alives make a write to a dead
+// client's notification stream fail so the stream is closed. A session whose streams are all closed and none is
+// reopened within the grace period is reaped. Clients that never open a notification stream are not reaped.
+type SessionReaper struct {
+	// Reap is called with each reaped gateway session, for example to close its upstream sessions
+	Reap func(ctx context.Context, sessionID string)
+
+	grace  time.Duration
+	logger *slog.Logger
+
+	lock sync.Mutex
+	// streams is the number of open notification streams of each session
+	streams map[string]int
+	// pending are the sessions without an open stream that are reaped once their timer fires
+	pending map[string]*time.Timer
+}
+
+// NewSessionReaper returns a reaper that reaps sessions once they have had no notification stream open for grace
+func NewSessionReaper(grace time.Duration, logger *slog.Logger) *SessionReaper {
+	return &SessionReaper{
+		grace:   grace,
+		logger:  logger,
+		streams: map[string]int{},
+		pending: map[string]*time.Timer{},
+	}
+}
+
+// streamOpened is called when a notification stream of the session is opened. A session waiting to be reaped is kept
+func (sr *SessionReaper) streamOpened(sessionID string) {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.streams[sessionID]++
+	if timer, ok := sr.pending[sessionID]; ok {
+		timer.Stop()
+		delete(sr.pending, sessionID)
+	}
+}
+
+// streamClosed is called when a notification stream of the session is closed. Once the last one is closed the
+// session is reaped unless a stream is opened again within the grace period
+func (sr *SessionReaper) streamClosed(sessionID string) {
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	sr.streams[sessionID]--
+	if sr.streams[sessionID] > 0 {
+		return
+	}
+	delete(sr.streams, sessionID)
+	var timer *time.Timer
+	timer = time.AfterFunc(sr.grace, func() {
+		sr.lock.Lock()
+		// a stream was opened and closed again since so a newer timer reaps the session
+		if sr.pending[sessionID] != timer {
+			sr.lock.Unlock()
+			return
+		}
+		delete(sr.pending, sessionID)
+		sr.lock.Unlock()
+		sr.reap(sessionID)
+	})
+	sr.pending[sessionID] = timer
+}
+
+func (sr *SessionReaper) reap(sessionID string) {
+	sr.logger.Info("client's notification stream was not reopened, closing its upstream sessions", "gatewaySessionID", sessionID, "grace", sr.grace)
+	reapedSessions.Inc()
+	if sr.Reap != nil {
+		sr.Reap(context.Background(), sessionID)
+	}
+}
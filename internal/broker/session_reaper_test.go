@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionReaper(t *testing.T) {
+	reaped := make(chan string, 1)
+	reaper := NewSessionReaper(50*time.Millisecond, logger)
+	reaper.Reap = func(_ context.Context, sessionID string) {
+		reaped <- sessionID
+	}
+
+	// a session that reopens its stream within the grace period is kept
+	reaper.streamOpened("reconnects")
+	reaper.streamOpened("reconnects")
+	reaper.streamClosed("reconnects")
+	reaper.streamClosed("reconnects")
+	reaper.streamOpened("reconnects")
+	select {
+	case sessionID := <-reaped:
+		t.Fatalf("session %s was reaped while its stream was open", sessionID)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// a session is reaped once its last stream is closed for the grace period
+	reaper.streamClosed("reconnects")
+	select {
+	case sessionID := <-reaped:
+		require.Equal(t, "reconnects", sessionID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not reaped")
+	}
+}
+
+func TestNotificationStreamKeepAlive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBroker(logger)
+	defer func() { _ = b.Shutdown(context.Background()) }()
+
+	reaped := make(chan string, 1)
+	reaper := NewSessionReaper(50*time.Millisecond, logger)
+	reaper.Reap = func(_ context.Context, sessionID string) {
+		reaped <- sessionID
+	}
+	handler := NewNotificationStreamHandler(server.NewStreamableHTTPServer(b.MCPServer()), time.Second, 50*time.Millisecond, logger).WithSessionReaper(reaper)
+	gateway := httptest.NewServer(handler)
+	defer gateway.Close()
+
+	mcpClient, err := client.NewStreamableHttpClient(gateway.URL + "/mcp")
+	require.NoError(t, err)
+	defer func() { _ = mcpClient.Close() }()
+	require.NoError(t, mcpClient.Start(ctx))
+	_, err = mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+	sessionID := mcpClient.GetSessionId()
+
+	streamCtx, closeStream := context.WithCancel(ctx)
+	defer closeStream()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, gateway.URL+"/mcp", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(server.HeaderKeySessionID, sessionID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the idle stream is sent keep-alives
+	keepAlives := make(chan struct{}, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), ": keep-alive") {
+				select {
+				case keepAlives <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	for range 2 {
+		select {
+		case <-keepAlives:
+		case <-time.After(5 * time.Second):
+			t.Fatal("idle stream was not sent a keep-alive")
+		}
+	}
+	select {
+	case <-reaped:
+		t.Fatal("session was reaped while its stream was open")
+	default:
+	}
+
+	// the session is reaped once the client is gone
+	closeStream()
+	select {
+	case reapedSession := <-reaped:
+		require.Equal(t, sessionID, reapedSession)
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not reaped after its client was gone")
+	}
+}
@@ -0,0 +1,179 @@
+package broker
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+)
+
+// SnapshotPath is the path of the internal endpoint serving a snapshot of the broker's state for support bundles
+const SnapshotPath = "/debug/snapshot"
+
+// redactedValue replaces the credentials in a snapshot
+const redactedValue = "REDACTED"
+
+// Snapshot is the state of the broker at a point in time. Credentials in it are redacted
+type Snapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	// GatewaySessions is the number of gateway sessions initialized with this replica that have not ended
+	GatewaySessions int              `json:"gatewaySessions"`
+	Servers         []ServerSnapshot `json:"servers"`
+	// Status is the result of the last validation of each server
+	Status StatusResponse `json:"status"`
+}
+
+// ServerSnapshot is the state of a registered server
+type ServerSnapshot struct {
+	ID string `json:"id"`
+	// Config is the server's config with its credentials redacted
+	Config               config.MCPServer `json:"config"`
+	Tools                []ToolMapping    `json:"tools"`
+	ServingFallbackTools bool             `json:"servingFallbackTools"`
+	// UpstreamSessions is the number of upstream sessions the router of this replica holds with the server. It is
+	// not set until the router is running
+	UpstreamSessions *int `json:"upstreamSessions,omitempty"`
+}
+
+// ToolMapping maps a tool listed by an upstream to the names the gateway advertises it as
+type ToolMapping struct {
+	UpstreamName string   `json:"upstreamName"`
+	GatewayNames []string `json:"gatewayNames"`
+}
+
+// Snapshot returns the state of the broker with the credentials of the servers redacted. Servers are sorted by id
+func (m *mcpBrokerImpl) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Timestamp: time.Now(),
+		Servers:   []ServerSnapshot{},
+		Status:    m.ValidateAllServers(),
+	}
+	m.clientLock.RLock()
+	snapshot.GatewaySessions = len(m.clientInfo)
+	m.clientLock.RUnlock()
+	credentials := map[string][]string{}
+	for id, manager := range m.RegisteredMCPServers() {
+		serverConfig := manager.MCP.GetConfig()
+		credentials[string(id)] = serverCredentials(serverConfig)
+		server := ServerSnapshot{
+			ID:                   string(id),
+			Config:               redactServerConfig(serverConfig),
+			Tools:                []ToolMapping{},
+			ServingFallbackTools: manager.ServingFallbackTools(),
+		}
+		for _, tool := range manager.GetManagedTools() {
+			server.Tools = append(server.Tools, ToolMapping{UpstreamName: tool.Name, GatewayNames: manager.GatewayToolNames(tool.Name)})
+		}
+		snapshot.Servers = append(snapshot.Servers, server)
+	}
+	slices.SortFunc(snapshot.Servers, func(a, b ServerSnapshot) int { return strings.Compare(a.ID, b.ID) })
+	// errors connecting to a server sending its credential in the query may include the url it was sent in
+	for i, status := range snapshot.Status.Servers {
+		for _, credential := range credentials[status.ID] {
+			snapshot.Status.Servers[i].Message = strings.ReplaceAll(snapshot.Status.Servers[i].Message, credential, redactedValue)
+		}
+	}
+	return snapshot
+}
+
+// serverCredentials returns the credential values of the server
+func serverCredentials(server config.MCPServer) []string {
+	var credentials []string
+	if server.Credential != "" {
+		credentials = append(credentials, server.Credential)
+	}
+	for _, credential := range server.AdditionalCredentials {
+		if credential.Value != "" {
+			credentials = append(credentials, credential.Value)
+		}
+	}
+	return credentials
+}
+
+// redactServerConfig returns the config with its credential, additional credential values and any password in its
+// URL replaced. Where credentials are sent is kept as it is often what is misconfigured
+func redactServerConfig(server config.MCPServer) config.MCPServer {
+	if server.Credential != "" {
+		server.Credential = redactedValue
+	}
+	if len(server.AdditionalCredentials) > 0 {
+		credentials := make([]config.AdditionalCredential, 0, len(server.AdditionalCredentials))
+		for _, credential := range server.AdditionalCredentials {
+			credentials = append(credentials, config.AdditionalCredential{Value: redactedValue, Location: credential.Location})
+		}
+		server.AdditionalCredentials = credentials
+	}
+	if parsed, err := url.Parse(server.URL); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redactedValue)
+			server.URL = parsed.String()
+		}
+	}
+	return server
+}
+
+// SnapshotHandler serves GET /debug/snapshot with a single JSON document of the broker's state: the registered
+// servers with their redacted config, tool mappings and session counts and the last validation of each. It is meant
+// to be attached to support escalations so problems can be diagnosed without shell access. Requests must carry the
+// router key as a bearer token.
+type SnapshotHandler struct {
+	// Snapshot returns the broker's state. It is set once the broker is created, until then requests are rejected as
+	// unavailable
+	Snapshot func() Snapshot
+	// UpstreamSessions returns the number of upstream sessions the router holds with the server. It is set once the
+	// router is created, until then the snapshot has no upstream session counts
+	UpstreamSessions func(serverName string) int
+	apiKey           string
+	logger           *slog.Logger
+}
+
+// NewSnapshotHandler returns a handler for the snapshot endpoint. An empty apiKey rejects every request
+func NewSnapshotHandler(apiKey string, logger *slog.Logger) *SnapshotHandler {
+	return &SnapshotHandler{
+		apiKey: apiKey,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *SnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: GET")
+		return
+	}
+	if !hasBearerToken(r, h.apiKey) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if h.Snapshot == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "the broker is not running")
+		return
+	}
+	snapshot := h.Snapshot()
+	if h.UpstreamSessions != nil {
+		for i := range snapshot.Servers {
+			sessions := h.UpstreamSessions(snapshot.Servers[i].Config.Name)
+			snapshot.Servers[i].UpstreamSessions = &sessions
+		}
+	}
+	h.logger.InfoContext(r.Context(), "serving broker snapshot", "servers", len(snapshot.Servers))
+	h.sendJSON(w, http.StatusOK, snapshot)
+}
+
+func (h *SnapshotHandler) sendJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to encode snapshot response", "error", err)
+	}
+}
+
+func (h *SnapshotHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendJSON(w, statusCode, map[string]string{"error": message})
+}
@@ -3,6 +3,7 @@ package broker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
 )
 
 // ServerValidationStatus contains the validation status of a single MCP server
@@ -61,6 +63,9 @@ type StatusResponse struct {
 	HealthyServers   int                               `json:"healthyServers"`
 	UnHealthyServers int                               `json:"unHealthyServers"`
 	ToolConflicts    int                               `json:"toolConflicts"`
+	TruncatedServers []string                          `json:"truncatedServers,omitempty"`
+	ConfigErrors     []config.FieldError               `json:"configErrors,omitempty"`
+	SkippedServers   []config.FieldError               `json:"skippedServers,omitempty"`
 	Timestamp        time.Time                         `json:"timestamp"`
 }
 
@@ -82,18 +87,20 @@ func NewStatusHandler(broker MCPBroker, logger slog.Logger) *StatusHandler {
 func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.setResponseHeaders(w, r)
 
-	switch r.Method {
-	case http.MethodGet:
+	switch {
+	case r.Method == http.MethodGet:
 		h.handleGetStatus(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == probePath:
+		h.handleProbe(w, r)
 	default:
-		h.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: GET")
+		h.sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: GET, and POST to "+probePath)
 	}
 }
 
 func (h *StatusHandler) setResponseHeaders(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 }
 
@@ -113,6 +120,30 @@ func (h *StatusHandler) handleGetStatus(w http.ResponseWriter, r *http.Request)
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
+// probePath checks the server with the id given in the server query parameter now and responds with the status of
+// all servers once it is done
+const probePath = "/status/probe"
+
+func (h *StatusHandler) handleProbe(w http.ResponseWriter, r *http.Request) {
+	serverID := r.URL.Query().Get("server")
+	if serverID == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "the server query parameter must be set to the id of the server to probe")
+		return
+	}
+	err := h.broker.ProbeServer(r.Context(), config.UpstreamMCPID(serverID))
+	switch {
+	case errors.Is(err, ErrServerNotFound):
+		h.sendErrorResponse(w, http.StatusNotFound, fmt.Sprintf("Server '%s' not found. Check the ids of the available servers at /status", serverID))
+		return
+	case err != nil:
+		h.logger.Error("Failed to probe server", "serverID", serverID, "error", err)
+		h.sendErrorResponse(w, http.StatusServiceUnavailable, fmt.Sprintf("Failed to probe server '%s': %v", serverID, err))
+		return
+	}
+	h.logger.Info("Probed server", "serverID", serverID)
+	h.sendJSONResponse(w, http.StatusOK, h.broker.ValidateAllServers())
+}
+
 func (h *StatusHandler) handleSingleServerByName(_ context.Context, w http.ResponseWriter, serverName string) {
 	//TODO(craig) this should not need to call validate all servers
 	statusResponse := h.broker.ValidateAllServers()
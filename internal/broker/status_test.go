@@ -1,17 +1,21 @@
 package broker
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	"github.com/kagenti/mcp-gateway/internal/config"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/require"
 )
 
@@ -90,3 +94,169 @@ func TestStatusHandlerGetAll(t *testing.T) {
 	err = json.Unmarshal(data, &m)
 	require.NoError(t, err)
 }
+
+func TestStatusHandlerReportsTruncatedServers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger, WithMaxTools(1))
+	sh := NewStatusHandler(mcpBroker, *logger)
+
+	brokerImpl, ok := mcpBroker.(*mcpBrokerImpl)
+	require.True(t, ok)
+	manager := createTestManagerForStatus(t,
+		"dummyServer",
+		[]mcp.Tool{{Name: "one"}, {Name: "two"}},
+	)
+	brokerImpl.mcpServers[manager.MCP.ID()] = manager
+	brokerImpl.toolBudget.AddTools(budgetTestTools(string(manager.MCP.ID()), "test_one", "test_two")...)
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	res := w.Result()
+	require.Equal(t, 200, res.StatusCode)
+	var status StatusResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	require.Equal(t, []string{"dummyServer"}, status.TruncatedServers)
+	require.Len(t, status.Servers, 1)
+	require.Equal(t, 1, status.Servers[0].TruncatedTools)
+	require.Equal(t, 1, status.Servers[0].AdvertisedTools)
+	require.Len(t, mcpBroker.MCPServer().ListTools(), 1)
+}
+
+func TestStatusHandlerReportsDroppedTools(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger, WithMaxTools(3))
+	sh := NewStatusHandler(mcpBroker, *logger)
+
+	brokerImpl, ok := mcpBroker.(*mcpBrokerImpl)
+	require.True(t, ok)
+	high := createTestManagerForStatus(t, "mcp-test/high", nil)
+	low := createTestManagerForStatus(t, "mcp-test/low", nil)
+	brokerImpl.mcpServers[high.MCP.ID()] = high
+	brokerImpl.mcpServers[low.MCP.ID()] = low
+	brokerImpl.toolBudget.setPriorities(budgetPriorities([]*config.MCPServer{
+		{Name: "mcp-test/high", ToolPrefix: "test_", URL: "http://test.local/mcp", Priority: 10},
+		{Name: "mcp-test/low", ToolPrefix: "test_", URL: "http://test.local/mcp", ToolWeights: map[string]int{"l_two": 5}},
+	}))
+	brokerImpl.toolBudget.AddTools(budgetTestTools(string(low.MCP.ID()), "test_l_one", "test_l_two", "test_l_three")...)
+	brokerImpl.toolBudget.AddTools(budgetTestTools(string(high.MCP.ID()), "test_h_one", "test_h_two")...)
+
+	// the higher priority server's tools survive and the weighted tool of the other server is kept
+	require.Equal(t, []string{"test_h_one", "test_h_two", "test_l_two"}, advertisedToolNames(mcpBroker.MCPServer()))
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	res := w.Result()
+	require.Equal(t, 200, res.StatusCode)
+	var status StatusResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	require.Equal(t, []string{"mcp-test/low"}, status.TruncatedServers)
+	dropped := map[string][]string{}
+	advertised := map[string]int{}
+	for _, server := range status.Servers {
+		dropped[server.Name] = server.DroppedTools
+		advertised[server.Name] = server.AdvertisedTools
+		require.Equal(t, len(server.DroppedTools), server.TruncatedTools)
+	}
+	require.Equal(t, map[string][]string{"mcp-test/high": nil, "mcp-test/low": {"test_l_one", "test_l_three"}}, dropped)
+	require.Equal(t, map[string]int{"mcp-test/high": 2, "mcp-test/low": 1}, advertised)
+}
+
+func TestStatusHandlerReportsConfigErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger)
+	sh := NewStatusHandler(mcpBroker, *logger)
+
+	mcpBroker.OnConfigChange(context.Background(), &config.MCPServersConfig{
+		VirtualServers: []*config.VirtualServer{{Name: "mcp-test/vs", UnavailableBehavior: "Fail"}},
+	})
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	res := w.Result()
+	require.Equal(t, 200, res.StatusCode)
+	var status map[string]any
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	require.Equal(t, false, status["overallValid"])
+	require.Equal(t, []any{
+		map[string]any{
+			"field":   "virtualServers[0].unavailableBehavior",
+			"value":   "Fail",
+			"message": "unavailableBehavior must be Empty or Degraded",
+		},
+	}, status["configErrors"])
+}
+
+func TestStatusHandlerReportsSkippedServers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger)
+	sh := NewStatusHandler(mcpBroker, *logger)
+
+	mcpBroker.OnConfigChange(context.Background(), &config.MCPServersConfig{
+		SkippedServers: config.ValidationErrors{{Field: "servers[1].url", Message: "url is required"}},
+	})
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	res := w.Result()
+	require.Equal(t, 200, res.StatusCode)
+	var status map[string]any
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	require.Equal(t, false, status["overallValid"])
+	require.Nil(t, status["configErrors"])
+	require.Equal(t, []any{
+		map[string]any{
+			"field":   "servers[1].url",
+			"message": "url is required",
+		},
+	}, status["skippedServers"])
+}
+
+func TestStatusHandlerProbe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	addTool := func(name string) {
+		upstreamServer.AddTool(mcp.NewTool(name), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name), nil
+		})
+	}
+	addTool("one")
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer srv.Close()
+
+	// the health check interval is long enough that only the probe checks the server again
+	mcpBroker := NewBroker(logger, WithManagerTickerInterval(time.Hour))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	upstreamConfig := &config.MCPServer{Name: "mcp-test/probed", URL: srv.URL + "/mcp", ToolPrefix: "p_", Hostname: "probed.mcp.local"}
+	mcpBroker.OnConfigChange(context.Background(), &config.MCPServersConfig{Servers: []*config.MCPServer{upstreamConfig}})
+	require.True(t, mcpBroker.WaitForDiscovery(context.Background(), upstreamConfig.ID()))
+	addTool("two")
+	sh := NewStatusHandler(mcpBroker, *logger)
+
+	testCases := []struct {
+		Name         string
+		Path         string
+		ExpectStatus int
+		ExpectTools  int
+	}{
+		{Name: "server is required", Path: "/status/probe", ExpectStatus: http.StatusBadRequest},
+		{Name: "unknown server", Path: "/status/probe?server=unknown", ExpectStatus: http.StatusNotFound},
+		{Name: "probed server reports its current tools", Path: "/status/probe?server=" + url.QueryEscape(string(upstreamConfig.ID())), ExpectStatus: http.StatusOK, ExpectTools: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sh.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.Path, nil))
+			res := w.Result()
+			require.Equal(t, tc.ExpectStatus, res.StatusCode)
+			if tc.ExpectStatus != http.StatusOK {
+				return
+			}
+			var status StatusResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+			require.Len(t, status.Servers, 1)
+			require.True(t, status.Servers[0].Ready)
+			require.Equal(t, tc.ExpectTools, status.Servers[0].TotalTools)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package broker
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var _ upstream.ToolsAdderDeleter = &toolBudget{}
+
+// toolBudget sits between the upstream managers and the listening gateway server.
+// It keeps every tool the managers register but only advertises up to maxTools of them.
+// Servers are admitted in priority order and the tools of each server in weight order so
+// when the limit is reached it is the lowest weighted tools of the lowest priority servers
+// that are left out. Ties are broken by name so the selection is deterministic.
+type toolBudget struct {
+	gatewayServer upstream.ToolsAdderDeleter
+	// maxTools is the maximum number of tools advertised. 0 means no limit
+	maxTools int
+	logger   *slog.Logger
+
+	lock sync.Mutex
+	// registered holds every tool added by the managers keyed by the prefixed tool name
+	registered map[string]server.ServerTool
+	// advertised is the set of tool names currently added to the gateway server
+	advertised map[string]struct{}
+	// priorities is keyed by upstream server id
+	priorities map[string]int
+	// weights is keyed by upstream server id then by the prefixed tool name
+	weights map[string]map[string]int
+	// dropped holds the sorted names of the tools not advertised for each upstream server id
+	dropped map[string][]string
+}
+
+func newToolBudget(gatewayServer upstream.ToolsAdderDeleter, maxTools int, logger *slog.Logger) *toolBudget {
+	return &toolBudget{
+		gatewayServer: gatewayServer,
+		maxTools:      maxTools,
+		logger:        logger,
+		registered:    map[string]server.ServerTool{},
+		advertised:    map[string]struct{}{},
+		priorities:    map[string]int{},
+		weights:       map[string]map[string]int{},
+		dropped:       map[string][]string{},
+	}
+}
+
+// AddTools registers the tools and advertises those that fit within the limit
+func (b *toolBudget) AddTools(tools ...server.ServerTool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	updated := map[string]struct{}{}
+	for _, tool := range tools {
+		b.registered[tool.Tool.Name] = tool
+		updated[tool.Tool.Name] = struct{}{}
+	}
+	b.rebalance(updated)
+}
+
+// DeleteTools removes the tools and advertises any tools that now fit within the limit
+func (b *toolBudget) DeleteTools(tools ...string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, tool := range tools {
+		delete(b.registered, tool)
+	}
+	b.rebalance(nil)
+}
+
+// ListTools returns every registered tool including those not advertised so conflicts are still detected
+func (b *toolBudget) ListTools() map[string]*server.ServerTool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	tools := make(map[string]*server.ServerTool, len(b.registered))
+	for name, tool := range b.registered {
+		tools[name] = &tool
+	}
+	return tools
+}
+
+// GetTool returns the registered tool with the name, whether or not it is advertised, or nil if there is none
+func (b *toolBudget) GetTool(name string) *server.ServerTool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	tool, ok := b.registered[name]
+	if !ok {
+		return nil
+	}
+	return &tool
+}
+
+// setPriorities replaces the upstream server priorities and tool weights and re-evaluates which tools are advertised.
+// weights are keyed by upstream server id then by the prefixed tool name
+func (b *toolBudget) setPriorities(priorities map[string]int, weights map[string]map[string]int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if maps.Equal(b.priorities, priorities) && maps.EqualFunc(b.weights, weights, maps.Equal) {
+		return
+	}
+	b.priorities = priorities
+	b.weights = weights
+	b.rebalance(nil)
+}
+
+// truncatedTools returns the number of tools of the upstream server that are not advertised
+func (b *toolBudget) truncatedTools(serverID string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.dropped[serverID])
+}
+
+// droppedTools returns the sorted names of the tools of the upstream server that are not advertised
+func (b *toolBudget) droppedTools(serverID string) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return slices.Clone(b.dropped[serverID])
+}
+
+// advertisedTools returns the number of tools of the upstream server that are advertised. Fallback tools stand in
+// for a server that is unavailable so they are not counted
+func (b *toolBudget) advertisedTools(serverID string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	count := 0
+	for name := range b.advertised {
+		tool := b.registered[name]
+		if toolServerID(tool) != serverID {
+			continue
+		}
+		if fallback, _ := tool.Tool.Meta.AdditionalFields[upstream.FallbackToolMetaKey].(bool); fallback {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// rebalance works out the tools that fit within the limit and syncs the difference to the gateway server.
+// Tools in updated are added again even if already advertised so changes to their definition are picked up.
+// It must be called with the lock held.
+func (b *toolBudget) rebalance(updated map[string]struct{}) {
+	byServer := map[string][]string{}
+	for name, tool := range b.registered {
+		id := toolServerID(tool)
+		byServer[id] = append(byServer[id], name)
+	}
+	serverIDs := slices.Collect(maps.Keys(byServer))
+	sort.Slice(serverIDs, func(i, j int) bool {
+		if b.priorities[serverIDs[i]] != b.priorities[serverIDs[j]] {
+			return b.priorities[serverIDs[i]] > b.priorities[serverIDs[j]]
+		}
+		return serverIDs[i] < serverIDs[j]
+	})
+
+	admitted := map[string]struct{}{}
+	dropped := map[string][]string{}
+	for _, id := range serverIDs {
+		names := byServer[id]
+		weights := b.weights[id]
+		sort.Slice(names, func(i, j int) bool {
+			if weights[names[i]] != weights[names[j]] {
+				return weights[names[i]] > weights[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		for _, name := range names {
+			if b.maxTools > 0 && len(admitted) >= b.maxTools {
+				dropped[id] = append(dropped[id], name)
+				continue
+			}
+			admitted[name] = struct{}{}
+		}
+		slices.Sort(dropped[id])
+	}
+
+	var toDelete []string
+	for name := range b.advertised {
+		if _, ok := admitted[name]; !ok {
+			toDelete = append(toDelete, name)
+		}
+	}
+	var toAdd []server.ServerTool
+	for name := range admitted {
+		_, advertised := b.advertised[name]
+		_, changed := updated[name]
+		if !advertised || changed {
+			toAdd = append(toAdd, b.registered[name])
+		}
+	}
+	if len(toDelete) > 0 {
+		b.gatewayServer.DeleteTools(toDelete...)
+	}
+	if len(toAdd) > 0 {
+		b.gatewayServer.AddTools(toAdd...)
+	}
+	b.advertised = admitted
+
+	if len(dropped) > 0 && !maps.EqualFunc(dropped, b.dropped, slices.Equal) {
+		b.logger.Warn("tool limit reached, not all tools are advertised", "maxTools", b.maxTools, "registeredTools", len(b.registered), "droppedTools", dropped)
+	}
+	b.dropped = dropped
+}
+
+// budgetPriorities returns the priority of each server and the weights of its tools keyed by upstream server id.
+// The weights are configured by upstream tool name and keyed by the advertised tool name the budget works with
+func budgetPriorities(servers []*config.MCPServer) (map[string]int, map[string]map[string]int) {
+	priorities := make(map[string]int, len(servers))
+	weights := map[string]map[string]int{}
+	for _, mcpServer := range servers {
+		if mcpServer == nil {
+			continue
+		}
+		priorities[string(mcpServer.ID())] = mcpServer.Priority
+		if len(mcpServer.ToolWeights) == 0 {
+			continue
+		}
+		naming := upstream.NewUpstreamMCP(mcpServer)
+		toolWeights := make(map[string]int, len(mcpServer.ToolWeights))
+		for tool, weight := range mcpServer.ToolWeights {
+			for _, name := range naming.ToolNames(tool) {
+				toolWeights[name] = weight
+			}
+		}
+		weights[string(mcpServer.ID())] = toolWeights
+	}
+	return priorities, weights
+}
+
+// toolServerID returns the id of the upstream server that registered the tool
+func toolServerID(tool server.ServerTool) string {
+	if tool.Tool.Meta == nil {
+		return ""
+	}
+	id, _ := tool.Tool.Meta.AdditionalFields["id"].(string)
+	return id
+}
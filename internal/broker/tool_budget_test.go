@@ -0,0 +1,208 @@
+package broker
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func budgetTestTools(serverID string, names ...string) []server.ServerTool {
+	tools := make([]server.ServerTool, 0, len(names))
+	for _, name := range names {
+		tool := mcp.NewTool(name)
+		tool.Meta = mcp.NewMetaFromMap(map[string]any{"id": serverID})
+		tools = append(tools, server.ServerTool{Tool: tool})
+	}
+	return tools
+}
+
+func advertisedToolNames(gatewayServer *server.MCPServer) []string {
+	var names []string
+	for name := range gatewayServer.ListTools() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestToolBudget(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		Name             string
+		MaxTools         int
+		Register         [][]server.ServerTool
+		Weights          map[string]map[string]int
+		Delete           []string
+		ExpectAdvertised []string
+		ExpectTruncated  map[string]int
+		ExpectDropped    map[string][]string
+	}{
+		{
+			Name:     "no limit advertises everything",
+			MaxTools: 0,
+			Register: [][]server.ServerTool{
+				budgetTestTools("low", "low_a", "low_b", "low_c"),
+				budgetTestTools("high", "high_a", "high_b"),
+			},
+			ExpectAdvertised: []string{"high_a", "high_b", "low_a", "low_b", "low_c"},
+			ExpectTruncated:  map[string]int{},
+		},
+		{
+			Name:     "registration beyond the limit is bounded",
+			MaxTools: 3,
+			Register: [][]server.ServerTool{
+				budgetTestTools("low", "low_a", "low_b", "low_c"),
+				budgetTestTools("high", "high_a", "high_b"),
+			},
+			ExpectAdvertised: []string{"high_a", "high_b", "low_a"},
+			ExpectTruncated:  map[string]int{"low": 2},
+			ExpectDropped:    map[string][]string{"low": {"low_b", "low_c"}},
+		},
+		{
+			Name:     "weights keep the most important tools of a truncated server",
+			MaxTools: 3,
+			Register: [][]server.ServerTool{
+				budgetTestTools("low", "low_a", "low_b", "low_c"),
+				budgetTestTools("high", "high_a", "high_b"),
+			},
+			Weights:          map[string]map[string]int{"low": {"low_c": 5, "low_a": -1}},
+			ExpectAdvertised: []string{"high_a", "high_b", "low_c"},
+			ExpectTruncated:  map[string]int{"low": 2},
+			ExpectDropped:    map[string][]string{"low": {"low_a", "low_b"}},
+		},
+		{
+			Name:     "server priority comes before tool weight",
+			MaxTools: 2,
+			Register: [][]server.ServerTool{
+				budgetTestTools("low", "low_a", "low_b", "low_c"),
+				budgetTestTools("high", "high_a", "high_b"),
+			},
+			Weights:          map[string]map[string]int{"low": {"low_a": 100}, "high": {"high_b": 1}},
+			ExpectAdvertised: []string{"high_a", "high_b"},
+			ExpectTruncated:  map[string]int{"low": 3},
+			ExpectDropped:    map[string][]string{"low": {"low_a", "low_b", "low_c"}},
+		},
+		{
+			Name:     "deleting tools admits truncated tools",
+			MaxTools: 3,
+			Register: [][]server.ServerTool{
+				budgetTestTools("low", "low_a", "low_b", "low_c"),
+				budgetTestTools("high", "high_a", "high_b"),
+			},
+			Delete:           []string{"high_a", "high_b"},
+			ExpectAdvertised: []string{"low_a", "low_b", "low_c"},
+			ExpectTruncated:  map[string]int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+			budget := newToolBudget(gatewayServer, tc.MaxTools, logger)
+			budget.setPriorities(map[string]int{"high": 10}, tc.Weights)
+			for _, tools := range tc.Register {
+				budget.AddTools(tools...)
+			}
+			budget.DeleteTools(tc.Delete...)
+
+			require.Equal(t, tc.ExpectAdvertised, advertisedToolNames(gatewayServer))
+			for _, id := range []string{"low", "high"} {
+				require.Equal(t, tc.ExpectTruncated[id], budget.truncatedTools(id))
+				require.Equal(t, tc.ExpectDropped[id], budget.droppedTools(id))
+			}
+			// every registered tool is still listed for conflict detection
+			registered := 0
+			for _, tools := range tc.Register {
+				registered += len(tools)
+			}
+			require.Len(t, budget.ListTools(), registered-len(tc.Delete))
+			for name := range budget.ListTools() {
+				require.NotNil(t, budget.GetTool(name), "tool %s is looked up for conflict detection whether or not it is advertised", name)
+			}
+			for _, name := range tc.Delete {
+				require.Nil(t, budget.GetTool(name))
+			}
+		})
+	}
+}
+
+func TestToolBudgetPriorityChange(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	budget := newToolBudget(gatewayServer, 2, logger)
+	budget.AddTools(budgetTestTools("a", "a_one", "a_two")...)
+	budget.AddTools(budgetTestTools("b", "b_one", "b_two")...)
+	require.Equal(t, []string{"a_one", "a_two"}, advertisedToolNames(gatewayServer))
+	require.Equal(t, 2, budget.truncatedTools("b"))
+
+	budget.setPriorities(map[string]int{"b": 1}, nil)
+	require.Equal(t, []string{"b_one", "b_two"}, advertisedToolNames(gatewayServer))
+	require.Equal(t, 2, budget.truncatedTools("a"))
+	require.Equal(t, 0, budget.truncatedTools("b"))
+}
+
+func TestToolBudgetWeightChange(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	budget := newToolBudget(gatewayServer, 1, logger)
+	budget.AddTools(budgetTestTools("a", "a_one", "a_two")...)
+	require.Equal(t, []string{"a_one"}, advertisedToolNames(gatewayServer))
+
+	budget.setPriorities(nil, map[string]map[string]int{"a": {"a_two": 1}})
+	require.Equal(t, []string{"a_two"}, advertisedToolNames(gatewayServer))
+	require.Equal(t, []string{"a_one"}, budget.droppedTools("a"))
+}
+
+func TestToolBudgetAdvertisedTools(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	budget := newToolBudget(gatewayServer, 3, logger)
+	budget.setPriorities(map[string]int{"a": 1}, nil)
+	budget.AddTools(budgetTestTools("a", "a_one", "a_two")...)
+	fallback := budgetTestTools("b", "b_one", "b_two")
+	for _, tool := range fallback {
+		tool.Tool.Meta.AdditionalFields[upstream.FallbackToolMetaKey] = true
+	}
+	budget.AddTools(fallback...)
+
+	require.Equal(t, 2, budget.advertisedTools("a"))
+	// the fallback tool that fits within the limit is listed but is not one of the server's tools
+	require.Equal(t, []string{"a_one", "a_two", "b_one"}, advertisedToolNames(gatewayServer))
+	require.Equal(t, 0, budget.advertisedTools("b"))
+
+	// tools left out by the limit are not counted
+	budget.AddTools(budgetTestTools("c", "c_one", "c_two")...)
+	budget.setPriorities(map[string]int{"a": 1, "c": 2}, nil)
+	require.Equal(t, 2, budget.advertisedTools("c"))
+	require.Equal(t, 1, budget.advertisedTools("a"))
+	require.Equal(t, 0, budget.advertisedTools("unknown"))
+}
+
+func TestBudgetPriorities(t *testing.T) {
+	servers := []*config.MCPServer{
+		{Name: "mcp-test/weather", ToolPrefix: "w_", Hostname: "weather.mcp.local", Priority: 10, ToolWeights: map[string]int{"get_forecast": 5}},
+		{
+			Name:        "mcp-test/search",
+			ToolPrefix:  "s_",
+			Hostname:    "search.mcp.local",
+			ToolRenames: []config.ToolRename{{Match: "^query$", Replace: "search"}},
+			ToolWeights: map[string]int{"query": 3},
+		},
+		nil,
+	}
+	priorities, weights := budgetPriorities(servers)
+	require.Equal(t, map[string]int{string(servers[0].ID()): 10, string(servers[1].ID()): 0}, priorities)
+	// weights are configured by upstream tool name and keyed by the advertised name
+	require.Equal(t, map[string]map[string]int{
+		string(servers[0].ID()): {"w_get_forecast": 5},
+		string(servers[1].ID()): {"s_search": 3},
+	}, weights)
+}
@@ -0,0 +1,183 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	envToolCatalogURL = "TOOL_CATALOG_URL"
+	envToolCatalogTTL = "TOOL_CATALOG_TTL"
+
+	// DefaultToolCatalogTTL is how long the fetched catalog is cached when no ttl is configured
+	DefaultToolCatalogTTL = 5 * time.Minute
+
+	maxToolCatalogBytes = 4 << 20
+)
+
+// toolCatalogDocument is the document served by the catalog endpoint
+type toolCatalogDocument struct {
+	Tools []toolCatalogEntry `json:"tools"`
+}
+
+// toolCatalogEntry is the metadata the catalog holds for a tool. Server is the namespace/name of the MCPServer and
+// Tool the name of the tool on the upstream server, before the prefix is added
+type toolCatalogEntry struct {
+	Server string         `json:"server"`
+	Tool   string         `json:"tool"`
+	Meta   map[string]any `json:"meta"`
+}
+
+type toolCatalogKey struct {
+	server string
+	tool   string
+}
+
+// ToolCatalog enriches the _meta of listed tools with metadata, such as ownership, cost and compliance tags, from
+// an external catalog. The catalog is fetched from URL and cached. If it cannot be fetched the tools are listed with
+// the metadata last fetched or without enrichment.
+type ToolCatalog struct {
+	Logger   *slog.Logger
+	URL      string
+	CacheTTL time.Duration
+	Client   *http.Client
+
+	lock      sync.Mutex
+	entries   map[toolCatalogKey]map[string]any
+	fetchedAt time.Time
+	now       func() time.Time
+}
+
+// NewToolCatalog returns a catalog fetched from url. A ttl of 0 or less uses the default
+func NewToolCatalog(logger *slog.Logger, url string, ttl time.Duration) *ToolCatalog {
+	if ttl <= 0 {
+		ttl = DefaultToolCatalogTTL
+	}
+	return &ToolCatalog{
+		Logger:   logger,
+		URL:      url,
+		CacheTTL: ttl,
+		// tools/list waits on the fetch so an unresponsive catalog is given up on quickly
+		Client: &http.Client{Timeout: 2 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// NewToolCatalogFromEnv returns a catalog configured from environment variables or nil if no catalog url is set
+func NewToolCatalogFromEnv(logger *slog.Logger) *ToolCatalog {
+	catalogURL := os.Getenv(envToolCatalogURL)
+	if catalogURL == "" {
+		return nil
+	}
+	var ttl time.Duration
+	if configured := os.Getenv(envToolCatalogTTL); configured != "" {
+		parsed, err := time.ParseDuration(configured)
+		if err != nil {
+			logger.Warn("invalid tool catalog ttl, using default", "value", configured, "default", DefaultToolCatalogTTL, "error", err)
+		}
+		ttl = parsed
+	}
+	return NewToolCatalog(logger, catalogURL, ttl)
+}
+
+// getEntries returns the cached catalog, fetching it once the ttl has passed. A failed fetch keeps the previous
+// catalog until the ttl passes again so an unavailable catalog does not slow down every tools/list
+func (c *ToolCatalog) getEntries(ctx context.Context) map[toolCatalogKey]map[string]any {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.fetchedAt.IsZero() && c.now().Sub(c.fetchedAt) < c.CacheTTL {
+		return c.entries
+	}
+	c.fetchedAt = c.now()
+	entries, err := c.fetch(ctx)
+	if err != nil {
+		c.Logger.Warn("failed to fetch tool catalog, listing tools with the metadata last fetched", "url", c.URL, "error", err)
+		return c.entries
+	}
+	c.entries = entries
+	return entries
+}
+
+func (c *ToolCatalog) fetch(ctx context.Context) (map[toolCatalogKey]map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxToolCatalogBytes))
+	if err != nil {
+		return nil, err
+	}
+	var doc toolCatalogDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid tool catalog: %w", err)
+	}
+	entries := make(map[toolCatalogKey]map[string]any, len(doc.Tools))
+	for _, entry := range doc.Tools {
+		if entry.Server == "" || entry.Tool == "" || len(entry.Meta) == 0 {
+			continue
+		}
+		entries[toolCatalogKey{server: entry.Server, tool: entry.Tool}] = entry.Meta
+	}
+	c.Logger.Debug("fetched tool catalog", "url", c.URL, "tools", len(entries))
+	return entries, nil
+}
+
+// applyToolCatalog adds the catalog metadata of each tool to its _meta. Fields the gateway sets, such as the server
+// id, are not overwritten
+func (broker *mcpBrokerImpl) applyToolCatalog(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if broker.toolCatalog == nil || len(tools) == 0 {
+		return tools
+	}
+	// fetched before taking the lock so a slow catalog does not hold up config changes
+	entries := broker.toolCatalog.getEntries(ctx)
+	if len(entries) == 0 {
+		return tools
+	}
+	broker.mcpLock.RLock()
+	defer broker.mcpLock.RUnlock()
+	for i, tool := range tools {
+		for _, upstream := range broker.mcpServers {
+			upstreamName, ok := upstream.UpstreamToolName(tool.Name)
+			if !ok {
+				continue
+			}
+			catalogMeta, ok := entries[toolCatalogKey{server: upstream.MCPName(), tool: upstreamName}]
+			if !ok {
+				break
+			}
+			// the meta is shared with the registered tool so copy before enriching
+			meta := &mcp.Meta{AdditionalFields: map[string]any{}}
+			if tool.Meta != nil {
+				meta.ProgressToken = tool.Meta.ProgressToken
+				maps.Copy(meta.AdditionalFields, tool.Meta.AdditionalFields)
+			}
+			for key, value := range catalogMeta {
+				if _, ok := meta.AdditionalFields[key]; !ok {
+					meta.AdditionalFields[key] = value
+				}
+			}
+			tools[i].Meta = meta
+			break
+		}
+	}
+	return tools
+}
@@ -0,0 +1,132 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// newCatalog returns a test catalog endpoint, a count of the requests made to it and a switch that makes it fail
+func newCatalog(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+	var requests atomic.Int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"tools": []map[string]any{
+				{"server": "mcp-test/server1", "tool": "tool1", "meta": map[string]any{"owner": "team-a", "id": "catalog"}},
+				{"server": "mcp-test/server2", "tool": "tool1", "meta": map[string]any{"compliance": "pci"}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &failing
+}
+
+// listCatalogTools lists the tools of the broker's managers and returns the _meta of each by name
+func listCatalogTools(t *testing.T, mcpBroker *mcpBrokerImpl, registeredMeta *mcp.Meta) map[string]map[string]any {
+	t.Helper()
+	result := &mcp.ListToolsResult{}
+	for _, manager := range mcpBroker.mcpServers {
+		for _, tool := range manager.GetManagedTools() {
+			result.Tools = append(result.Tools, mcp.Tool{Name: manager.MCP.GetPrefix() + tool.Name, Meta: registeredMeta})
+		}
+	}
+	mcpBroker.FilterTools(context.Background(), 1, &mcp.ListToolsRequest{Header: http.Header{}}, result)
+	metas := map[string]map[string]any{}
+	for _, tool := range result.Tools {
+		metas[tool.Name] = tool.Meta.AdditionalFields
+	}
+	return metas
+}
+
+func TestToolCatalogEnrichment(t *testing.T) {
+	srv, requests, _ := newCatalog(t)
+	now := time.Now()
+	catalog := NewToolCatalog(slog.Default(), srv.URL, time.Minute)
+	catalog.now = func() time.Time { return now }
+	mcpBroker := &mcpBrokerImpl{
+		mcpServers: map[config.UpstreamMCPID]*upstream.MCPManager{
+			"s1": createTestManager(t, "mcp-test/server1", "s1_", []mcp.Tool{{Name: "tool1"}, {Name: "tool2"}}),
+			"s2": createTestManager(t, "mcp-test/server2", "s2_", []mcp.Tool{{Name: "tool1"}}),
+		},
+		logger:      slog.Default(),
+		toolCatalog: catalog,
+	}
+	registeredMeta := mcp.NewMetaFromMap(map[string]any{"id": "registered"})
+
+	metas := listCatalogTools(t, mcpBroker, registeredMeta)
+	require.Equal(t, map[string]any{"id": "registered", "owner": "team-a"}, metas["s1_tool1"])
+	require.Equal(t, map[string]any{"id": "registered"}, metas["s1_tool2"])
+	require.Equal(t, map[string]any{"id": "registered", "compliance": "pci"}, metas["s2_tool1"])
+	// the registered tool meta must not be modified
+	require.Equal(t, map[string]any{"id": "registered"}, registeredMeta.AdditionalFields)
+
+	// the catalog is cached until the ttl passes
+	listCatalogTools(t, mcpBroker, registeredMeta)
+	require.EqualValues(t, 1, requests.Load())
+	now = now.Add(2 * time.Minute)
+	listCatalogTools(t, mcpBroker, registeredMeta)
+	require.EqualValues(t, 2, requests.Load())
+}
+
+func TestToolCatalogUnavailable(t *testing.T) {
+	srv, requests, failing := newCatalog(t)
+	failing.Store(true)
+	now := time.Now()
+	catalog := NewToolCatalog(slog.Default(), srv.URL, time.Minute)
+	catalog.now = func() time.Time { return now }
+	mcpBroker := &mcpBrokerImpl{
+		mcpServers: map[config.UpstreamMCPID]*upstream.MCPManager{
+			"s1": createTestManager(t, "mcp-test/server1", "s1_", []mcp.Tool{{Name: "tool1"}}),
+		},
+		logger:      slog.Default(),
+		toolCatalog: catalog,
+	}
+	registeredMeta := mcp.NewMetaFromMap(map[string]any{"id": "registered"})
+
+	// tools are listed without enrichment and the catalog is not retried on every list
+	require.Equal(t, map[string]map[string]any{"s1_tool1": {"id": "registered"}}, listCatalogTools(t, mcpBroker, registeredMeta))
+	listCatalogTools(t, mcpBroker, registeredMeta)
+	require.EqualValues(t, 1, requests.Load())
+
+	failing.Store(false)
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, "team-a", listCatalogTools(t, mcpBroker, registeredMeta)["s1_tool1"]["owner"])
+
+	// the metadata last fetched is kept while the catalog is unavailable
+	failing.Store(true)
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, "team-a", listCatalogTools(t, mcpBroker, registeredMeta)["s1_tool1"]["owner"])
+	require.EqualValues(t, 3, requests.Load())
+}
+
+func TestToolCatalogUnreachable(t *testing.T) {
+	srv, _, _ := newCatalog(t)
+	srv.Close()
+	mcpBroker := &mcpBrokerImpl{
+		mcpServers: map[config.UpstreamMCPID]*upstream.MCPManager{
+			"s1": createTestManager(t, "mcp-test/server1", "s1_", []mcp.Tool{{Name: "tool1"}}),
+		},
+		logger:      slog.Default(),
+		toolCatalog: NewToolCatalog(slog.Default(), srv.URL, 0),
+	}
+	registeredMeta := mcp.NewMetaFromMap(map[string]any{"id": "registered"})
+	require.Equal(t, map[string]map[string]any{"s1_tool1": {"id": "registered"}}, listCatalogTools(t, mcpBroker, registeredMeta))
+}
@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolManifestPath is the path of the internal endpoint serving a static manifest of the federated tools
+const ToolManifestPath = "/tools/manifest"
+
+// ToolManifest describes the tools the gateway federates for consumers that do not speak MCP
+type ToolManifest struct {
+	Tools []ToolManifestEntry `json:"tools"`
+}
+
+// ToolManifestEntry describes a federated tool. Server is the namespace/name of the MCPServer providing it
+type ToolManifestEntry struct {
+	Name         string             `json:"name"`
+	Description  string             `json:"description,omitempty"`
+	Server       string             `json:"server,omitempty"`
+	InputSchema  json.RawMessage    `json:"inputSchema"`
+	OutputSchema json.RawMessage    `json:"outputSchema,omitempty"`
+	Annotations  mcp.ToolAnnotation `json:"annotations"`
+}
+
+// ToolManifestHandler serves GET /tools/manifest with the name, description and schemas of every tool the gateway
+// federates. The manifest is rendered from the registered tools on each request so it follows tool changes. As it
+// is not filtered by the client's permissions requests must carry the router key as a bearer token.
+type ToolManifestHandler struct {
+	broker MCPBroker
+	apiKey string
+	logger *slog.Logger
+}
+
+// NewToolManifestHandler returns a handler for the tool manifest endpoint. An empty apiKey rejects every request
+func NewToolManifestHandler(broker MCPBroker, apiKey string, logger *slog.Logger) *ToolManifestHandler {
+	return &ToolManifestHandler{
+		broker: broker,
+		apiKey: apiKey,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *ToolManifestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: GET")
+		return
+	}
+	if !hasBearerToken(r, h.apiKey) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	manifest, err := h.manifest()
+	if err != nil {
+		h.logger.Error("failed to render tool manifest", "error", err)
+		h.sendError(w, http.StatusInternalServerError, "failed to render tool manifest")
+		return
+	}
+	h.sendJSON(w, http.StatusOK, manifest)
+}
+
+func (h *ToolManifestHandler) manifest() (ToolManifest, error) {
+	serverNames := map[string]string{}
+	for id, manager := range h.broker.RegisteredMCPServers() {
+		serverNames[string(id)] = manager.MCPName()
+	}
+	manifest := ToolManifest{Tools: []ToolManifestEntry{}}
+	for _, tool := range h.broker.MCPServer().ListTools() {
+		inputSchema, err := toolSchema(tool.Tool.RawInputSchema, tool.Tool.InputSchema)
+		if err != nil {
+			return manifest, err
+		}
+		entry := ToolManifestEntry{
+			Name:        tool.Tool.Name,
+			Description: tool.Tool.Description,
+			Server:      serverNames[toolServerID(*tool)],
+			InputSchema: inputSchema,
+			Annotations: tool.Tool.Annotations,
+		}
+		if tool.Tool.RawOutputSchema != nil || tool.Tool.OutputSchema.Type != "" {
+			if entry.OutputSchema, err = toolSchema(tool.Tool.RawOutputSchema, tool.Tool.OutputSchema); err != nil {
+				return manifest, err
+			}
+		}
+		manifest.Tools = append(manifest.Tools, entry)
+	}
+	slices.SortFunc(manifest.Tools, func(a, b ToolManifestEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return manifest, nil
+}
+
+// toolSchema returns the schema as the upstream sent it when available
+func toolSchema(raw json.RawMessage, schema any) (json.RawMessage, error) {
+	if raw != nil {
+		return raw, nil
+	}
+	return json.Marshal(schema)
+}
+
+func (h *ToolManifestHandler) sendJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to encode tool manifest response", "error", err)
+	}
+}
+
+func (h *ToolManifestHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendJSON(w, statusCode, map[string]string{"error": message})
+}
@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolManifestHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger)
+	brokerImpl, ok := mcpBroker.(*mcpBrokerImpl)
+	require.True(t, ok)
+	m := createTestManagerForStatus(t, "mcp-test/server1", nil)
+	brokerImpl.mcpServers[m.MCP.ID()] = m
+	weather := mcp.NewTool("test_weather",
+		mcp.WithDescription("Get the weather for a city"),
+		mcp.WithString("city", mcp.Required(), mcp.Description("name of the city")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	weather.Meta = mcp.NewMetaFromMap(map[string]any{"id": string(m.MCP.ID())})
+	raw := mcp.NewToolWithRawSchema("test_raw", "", json.RawMessage(`{"type":"object","properties":{"query":{"type":"string"}}}`))
+	raw.Meta = mcp.NewMetaFromMap(map[string]any{"id": string(m.MCP.ID())})
+	brokerImpl.toolBudget.AddTools(server.ServerTool{Tool: weather}, server.ServerTool{Tool: raw})
+	handler := NewToolManifestHandler(mcpBroker, "secret", logger)
+
+	getManifest := func(t *testing.T) ToolManifest {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, ToolManifestPath, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var manifest ToolManifest
+		require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&manifest))
+		return manifest
+	}
+
+	manifest := getManifest(t)
+	require.Len(t, manifest.Tools, 2)
+	require.Equal(t, "test_raw", manifest.Tools[0].Name)
+	require.JSONEq(t, `{"type":"object","properties":{"query":{"type":"string"}}}`, string(manifest.Tools[0].InputSchema))
+	require.Empty(t, manifest.Tools[0].OutputSchema)
+
+	tool := manifest.Tools[1]
+	require.Equal(t, "test_weather", tool.Name)
+	require.Equal(t, "Get the weather for a city", tool.Description)
+	require.Equal(t, "mcp-test/server1", tool.Server)
+	require.True(t, *tool.Annotations.ReadOnlyHint)
+	var schema struct {
+		Type       string                    `json:"type"`
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+	}
+	require.NoError(t, json.Unmarshal(tool.InputSchema, &schema))
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, map[string]any{"type": "string", "description": "name of the city"}, schema.Properties["city"])
+	require.Equal(t, []string{"city"}, schema.Required)
+
+	// the manifest follows tool changes
+	brokerImpl.toolBudget.DeleteTools("test_raw")
+	manifest = getManifest(t)
+	require.Len(t, manifest.Tools, 1)
+	require.Equal(t, "test_weather", manifest.Tools[0].Name)
+}
+
+func TestToolManifestHandlerRejectsRequests(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	testCases := []struct {
+		Name         string
+		Method       string
+		APIKey       string
+		Token        string
+		ExpectStatus int
+	}{
+		{Name: "missing token", Method: http.MethodGet, APIKey: "secret", ExpectStatus: http.StatusUnauthorized},
+		{Name: "wrong token", Method: http.MethodGet, APIKey: "secret", Token: "not-the-secret", ExpectStatus: http.StatusUnauthorized},
+		{Name: "no key configured", Method: http.MethodGet, ExpectStatus: http.StatusUnauthorized},
+		{Name: "not get", Method: http.MethodPost, APIKey: "secret", Token: "secret", ExpectStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			handler := NewToolManifestHandler(NewBroker(logger), tc.APIKey, logger)
+			req := httptest.NewRequest(tc.Method, ToolManifestPath, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.Token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tc.ExpectStatus, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolsPath is the path of the internal endpoint listing the tools the gateway advertises for an MCP server
+const ToolsPath = "/tools"
+
+// ServerToolsResponse lists the tools the gateway advertises for a single MCP server
+type ServerToolsResponse struct {
+	Server string     `json:"server"`
+	Tools  []mcp.Tool `json:"tools"`
+}
+
+// ToolsHandler serves GET /tools?server=namespace/name so operators can check the tools federated from one
+// MCP server without paging through the whole tools/list. Requests must carry the router key as a bearer token.
+type ToolsHandler struct {
+	broker MCPBroker
+	apiKey string
+	logger *slog.Logger
+}
+
+// NewToolsHandler returns a handler for the tools endpoint. An empty apiKey rejects every request
+func NewToolsHandler(broker MCPBroker, apiKey string, logger *slog.Logger) *ToolsHandler {
+	return &ToolsHandler{
+		broker: broker,
+		apiKey: apiKey,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *ToolsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed. Supported methods: GET")
+		return
+	}
+	if !hasBearerToken(r, h.apiKey) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	serverName := r.URL.Query().Get("server")
+	if serverName == "" {
+		h.sendError(w, http.StatusBadRequest, "the server query parameter is required. Use format 'namespace/name'")
+		return
+	}
+
+	// a server can be registered more than once with different prefixes or hostnames so every match is included
+	serverIDs := map[string]struct{}{}
+	for id, manager := range h.broker.RegisteredMCPServers() {
+		if manager.MCPName() == serverName {
+			serverIDs[string(id)] = struct{}{}
+		}
+	}
+	if len(serverIDs) == 0 {
+		h.sendError(w, http.StatusNotFound, fmt.Sprintf("Server '%s' not found. Use format 'namespace/name' or check available servers at /status", serverName))
+		return
+	}
+
+	response := ServerToolsResponse{Server: serverName, Tools: []mcp.Tool{}}
+	for _, tool := range h.broker.MCPServer().ListTools() {
+		if _, ok := serverIDs[toolServerID(*tool)]; ok {
+			response.Tools = append(response.Tools, tool.Tool)
+		}
+	}
+	slices.SortFunc(response.Tools, func(a, b mcp.Tool) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	h.sendJSON(w, http.StatusOK, response)
+}
+
+// hasBearerToken checks the bearer token of the request matches the key. An empty key matches no request
+func hasBearerToken(r *http.Request, key string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
+
+func (h *ToolsHandler) sendJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to encode tools response", "error", err)
+	}
+}
+
+func (h *ToolsHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendJSON(w, statusCode, map[string]string{"error": message})
+}
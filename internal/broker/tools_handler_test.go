@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolsHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mcpBroker := NewBroker(logger)
+	brokerImpl, ok := mcpBroker.(*mcpBrokerImpl)
+	require.True(t, ok)
+	for _, manager := range []struct {
+		name  string
+		tools []string
+	}{
+		{name: "mcp-test/server1", tools: []string{"test_b", "test_a"}},
+		{name: "mcp-test/server2", tools: []string{"test_c"}},
+	} {
+		m := createTestManagerForStatus(t, manager.name, nil)
+		brokerImpl.mcpServers[m.MCP.ID()] = m
+		brokerImpl.toolBudget.AddTools(budgetTestTools(string(m.MCP.ID()), manager.tools...)...)
+	}
+	handler := NewToolsHandler(mcpBroker, "secret", logger)
+
+	testCases := []struct {
+		Name         string
+		Method       string
+		Target       string
+		Token        string
+		ExpectStatus int
+		ExpectTools  []string
+	}{
+		{
+			Name:         "tools of a single server",
+			Method:       http.MethodGet,
+			Target:       "/tools?server=mcp-test/server1",
+			Token:        "secret",
+			ExpectStatus: http.StatusOK,
+			ExpectTools:  []string{"test_a", "test_b"},
+		},
+		{
+			Name:         "unknown server",
+			Method:       http.MethodGet,
+			Target:       "/tools?server=mcp-test/missing",
+			Token:        "secret",
+			ExpectStatus: http.StatusNotFound,
+		},
+		{
+			Name:         "server is required",
+			Method:       http.MethodGet,
+			Target:       "/tools",
+			Token:        "secret",
+			ExpectStatus: http.StatusBadRequest,
+		},
+		{
+			Name:         "missing token",
+			Method:       http.MethodGet,
+			Target:       "/tools?server=mcp-test/server1",
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:         "wrong token",
+			Method:       http.MethodGet,
+			Target:       "/tools?server=mcp-test/server1",
+			Token:        "not-the-secret",
+			ExpectStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:         "not get",
+			Method:       http.MethodPost,
+			Target:       "/tools?server=mcp-test/server1",
+			Token:        "secret",
+			ExpectStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.Method, tc.Target, nil)
+			if tc.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.Token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			res := w.Result()
+			require.Equal(t, tc.ExpectStatus, res.StatusCode)
+			if tc.ExpectStatus != http.StatusOK {
+				return
+			}
+			var response ServerToolsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+			require.Equal(t, "mcp-test/server1", response.Server)
+			var names []string
+			for _, tool := range response.Tools {
+				names = append(names, tool.Name)
+			}
+			require.Equal(t, tc.ExpectTools, names)
+		})
+	}
+}
+
+func TestToolsHandlerWithoutKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := NewToolsHandler(NewBroker(logger), "", logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/tools?server=mcp-test/server1", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+}
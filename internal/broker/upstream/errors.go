@@ -0,0 +1,163 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ErrorKind is the category of a failure talking to an upstream MCP server. Kinds are reported to clients in the
+// data of JSON-RPC errors and in the broker's status so they can be acted on without parsing messages
+type ErrorKind string
+
+const (
+	// ErrorKindUnreachable is a failure to connect to the upstream or establish a session with it
+	ErrorKindUnreachable ErrorKind = "unreachable"
+	// ErrorKindProtocolMismatch is an upstream that negotiated a protocol version the gateway does not support
+	ErrorKindProtocolMismatch ErrorKind = "protocol-mismatch"
+	// ErrorKindAuthFailed is an upstream that refused the credential it was sent
+	ErrorKindAuthFailed ErrorKind = "auth-failed"
+	// ErrorKindTimeout is an upstream that did not respond in time
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindToolNotFound is a tool call to a tool no upstream provides
+	ErrorKindToolNotFound ErrorKind = "tool-not-found"
+	// ErrorKindRateLimited is an upstream that is rate limiting requests. It is retryable
+	ErrorKindRateLimited ErrorKind = "rate-limited"
+	// ErrorKindQuotaExceeded is a client that has used up its tool call quota, so the call was not sent to the
+	// upstream. It is retryable once the quota window resets
+	ErrorKindQuotaExceeded ErrorKind = "quota-exceeded"
+	// ErrorKindResponseTooLarge is an upstream response larger than the maximum response size of its server, so it was
+	// not passed on to the client
+	ErrorKindResponseTooLarge ErrorKind = "response-too-large"
+)
+
+// JSON-RPC error codes of each kind. The codes are part of the gateway's API and must not change. Codes other than
+// tool not found are in the range JSON-RPC reserves for implementation defined server errors
+const (
+	ErrorCodeUnreachable      = -32001
+	ErrorCodeProtocolMismatch = -32002
+	ErrorCodeAuthFailed       = -32003
+	ErrorCodeTimeout          = -32004
+	ErrorCodeRateLimited      = -32005
+	ErrorCodeQuotaExceeded    = -32006
+	ErrorCodeResponseTooLarge = -32007
+	ErrorCodeToolNotFound     = mcp.METHOD_NOT_FOUND
+)
+
+// JSONRPCCode returns the JSON-RPC error code of the kind. Unknown kinds are internal errors
+func (k ErrorKind) JSONRPCCode() int {
+	switch k {
+	case ErrorKindUnreachable:
+		return ErrorCodeUnreachable
+	case ErrorKindProtocolMismatch:
+		return ErrorCodeProtocolMismatch
+	case ErrorKindAuthFailed:
+		return ErrorCodeAuthFailed
+	case ErrorKindTimeout:
+		return ErrorCodeTimeout
+	case ErrorKindRateLimited:
+		return ErrorCodeRateLimited
+	case ErrorKindQuotaExceeded:
+		return ErrorCodeQuotaExceeded
+	case ErrorKindResponseTooLarge:
+		return ErrorCodeResponseTooLarge
+	case ErrorKindToolNotFound:
+		return ErrorCodeToolNotFound
+	}
+	return mcp.INTERNAL_ERROR
+}
+
+// HTTPStatus returns the HTTP status of a response failed with the kind. A tool that is not found is a 200 as MCP
+// clients treat a 404 as their session having ended
+func (k ErrorKind) HTTPStatus() int {
+	switch k {
+	case ErrorKindUnreachable:
+		return http.StatusServiceUnavailable
+	case ErrorKindProtocolMismatch, ErrorKindAuthFailed, ErrorKindResponseTooLarge:
+		return http.StatusBadGateway
+	case ErrorKindTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorKindRateLimited, ErrorKindQuotaExceeded:
+		return http.StatusTooManyRequests
+	case ErrorKindToolNotFound:
+		return http.StatusOK
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a failure talking to an upstream MCP server with its kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewError returns an Error of the given kind wrapping err
+func NewError(kind ErrorKind, err error) *Error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Kind)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WrapError returns err as an Error with the kind given by ErrorKindOf so the message of err is kept. It returns nil
+// for a nil err
+func WrapError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	return NewError(ErrorKindOf(err), err)
+}
+
+// ErrorKindOf returns the kind of an error from the upstream. An Error keeps its kind, otherwise the kind is worked
+// out from the error and any failure that is not recognised is treated as the upstream being unreachable. A nil err
+// has no kind
+func ErrorKindOf(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	var upstreamErr *Error
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.Kind
+	}
+	if errors.Is(err, mcp.UnsupportedProtocolVersionError{}) {
+		return ErrorKindProtocolMismatch
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorKindTimeout
+	}
+	var oauthErr *transport.OAuthAuthorizationRequiredError
+	if errors.As(err, &oauthErr) {
+		return ErrorKindAuthFailed
+	}
+	// without an OAuth handler the transport only reports the status in the message
+	msg := err.Error()
+	if strings.Contains(msg, fmt.Sprintf("status %d", http.StatusTooManyRequests)) {
+		return ErrorKindRateLimited
+	}
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		if strings.Contains(msg, fmt.Sprintf("status %d", status)) {
+			return ErrorKindAuthFailed
+		}
+	}
+	return ErrorKindUnreachable
+}
@@ -0,0 +1,101 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorKindCodes(t *testing.T) {
+	testCases := []struct {
+		Kind         ErrorKind
+		ExpectCode   int
+		ExpectStatus int
+	}{
+		{Kind: ErrorKindUnreachable, ExpectCode: -32001, ExpectStatus: http.StatusServiceUnavailable},
+		{Kind: ErrorKindProtocolMismatch, ExpectCode: -32002, ExpectStatus: http.StatusBadGateway},
+		{Kind: ErrorKindAuthFailed, ExpectCode: -32003, ExpectStatus: http.StatusBadGateway},
+		{Kind: ErrorKindTimeout, ExpectCode: -32004, ExpectStatus: http.StatusGatewayTimeout},
+		{Kind: ErrorKindRateLimited, ExpectCode: -32005, ExpectStatus: http.StatusTooManyRequests},
+		{Kind: ErrorKindQuotaExceeded, ExpectCode: -32006, ExpectStatus: http.StatusTooManyRequests},
+		{Kind: ErrorKindResponseTooLarge, ExpectCode: -32007, ExpectStatus: http.StatusBadGateway},
+		{Kind: ErrorKindToolNotFound, ExpectCode: -32601, ExpectStatus: http.StatusOK},
+		{Kind: "unknown", ExpectCode: -32603, ExpectStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.Kind), func(t *testing.T) {
+			require.Equal(t, tc.ExpectCode, tc.Kind.JSONRPCCode())
+			require.Equal(t, tc.ExpectStatus, tc.Kind.HTTPStatus())
+		})
+	}
+}
+
+func TestErrorKindOf(t *testing.T) {
+	testCases := []struct {
+		Name       string
+		Err        error
+		ExpectKind ErrorKind
+	}{
+		{
+			Name: "no error",
+		},
+		{
+			Name:       "connection refused",
+			Err:        errors.New("dial tcp 10.0.0.1:80: connect: connection refused"),
+			ExpectKind: ErrorKindUnreachable,
+		},
+		{
+			Name:       "unsupported protocol version",
+			Err:        fmt.Errorf("failed to create client: %w", mcp.UnsupportedProtocolVersionError{Version: "2020-01-01"}),
+			ExpectKind: ErrorKindProtocolMismatch,
+		},
+		{
+			Name:       "unauthorized",
+			Err:        errors.New("initialize request failed: request failed with status 401: unauthorized"),
+			ExpectKind: ErrorKindAuthFailed,
+		},
+		{
+			Name:       "forbidden",
+			Err:        errors.New("initialize request failed: request failed with status 403: forbidden"),
+			ExpectKind: ErrorKindAuthFailed,
+		},
+		{
+			Name:       "too many requests",
+			Err:        errors.New("initialize request failed: request failed with status 429: slow down"),
+			ExpectKind: ErrorKindRateLimited,
+		},
+		{
+			Name:       "oauth authorization required",
+			Err:        fmt.Errorf("initialize request failed: %w", &transport.OAuthAuthorizationRequiredError{}),
+			ExpectKind: ErrorKindAuthFailed,
+		},
+		{
+			Name:       "deadline exceeded",
+			Err:        fmt.Errorf("initialize request failed: %w", context.DeadlineExceeded),
+			ExpectKind: ErrorKindTimeout,
+		},
+		{
+			Name:       "kind is kept",
+			Err:        fmt.Errorf("ping failed: %w", NewError(ErrorKindTimeout, errors.New("no response"))),
+			ExpectKind: ErrorKindTimeout,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.ExpectKind, ErrorKindOf(tc.Err))
+			if tc.Err == nil {
+				require.Nil(t, WrapError(tc.Err))
+				return
+			}
+			wrapped := WrapError(tc.Err)
+			require.Equal(t, tc.ExpectKind, wrapped.Kind)
+			require.ErrorIs(t, wrapped, tc.Err)
+		})
+	}
+}
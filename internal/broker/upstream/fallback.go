@@ -0,0 +1,83 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// FallbackToolMetaKey is set in the _meta of a tool advertised from the fallback tools of its server's config while
+// the server is unavailable
+const FallbackToolMetaKey = "fallback"
+
+// ServingFallbackTools returns true while the upstream is unavailable and the fallback tools of its config are
+// advertised in place of its tools
+func (man *MCPManager) ServingFallbackTools() bool {
+	man.toolsLock.RLock()
+	defer man.toolsLock.RUnlock()
+	return man.fallback
+}
+
+// toolsUnavailable removes the upstream's tools from the gateway when it cannot be connected to, or advertises its
+// fallback tools in their place when it has any. Fallback tools already advertised are left as they are so clients
+// are not sent a tool list change on each failed health check
+func (man *MCPManager) toolsUnavailable(ctx context.Context) {
+	if man.ServingFallbackTools() {
+		return
+	}
+	man.removeTools()
+	man.serveFallbackTools(ctx)
+}
+
+// serveFallbackTools advertises the fallback tools of the upstream's config. They are prefixed and renamed like the
+// tools the upstream lists and calls to them that reach the broker are answered with an error. It is only called
+// from the Start loop
+func (man *MCPManager) serveFallbackTools(ctx context.Context) {
+	configured := man.MCP.GetConfig().FallbackTools
+	if len(configured) == 0 {
+		return
+	}
+	tools := make([]mcp.Tool, 0, len(configured))
+	for _, fallbackTool := range configured {
+		tool, err := fallbackTool.MCPTool()
+		if err != nil {
+			man.logger.Error("ignoring invalid fallback tool", "upstream mcp server", man.MCP.ID(), "tool", fallbackTool.Name, "error", err)
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	if err := man.findRenameConflicts(tools); err != nil {
+		man.logger.Error("not advertising fallback tools", "upstream mcp server", man.MCP.ID(), "error", err)
+		return
+	}
+	unavailable := func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError(fmt.Sprintf("mcp server %s is temporarily unavailable, retry later", man.MCP.GetName())), nil
+	}
+	serverTools := make([]server.ServerTool, 0, len(tools))
+	toolsMap := make(map[string]mcp.Tool, len(tools))
+	upstreamNames := make(map[string]string, len(tools))
+	for _, tool := range tools {
+		toolsMap[tool.Name] = tool
+		for _, serverTool := range man.toolToServerTools(tool) {
+			serverTool.Tool.Meta.AdditionalFields[FallbackToolMetaKey] = true
+			serverTool.Handler = unavailable
+			upstreamNames[serverTool.Tool.Name] = tool.Name
+			serverTools = append(serverTools, serverTool)
+		}
+	}
+	if err := man.findToolConflicts(ctx, serverTools); err != nil {
+		man.logger.Error("not advertising fallback tools", "upstream mcp server", man.MCP.ID(), "error", err)
+		return
+	}
+	man.gatewayServer.AddTools(serverTools...)
+	man.toolsLock.Lock()
+	man.tools = tools
+	man.serverTools = serverTools
+	man.toolsMap = toolsMap
+	man.upstreamNames = upstreamNames
+	man.fallback = true
+	man.toolsLock.Unlock()
+	man.logger.Info("advertising fallback tools while the upstream is unavailable", "upstream mcp server", man.MCP.ID(), "tools", len(tools))
+}
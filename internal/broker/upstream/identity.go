@@ -0,0 +1,57 @@
+package upstream
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// IdentityChangeLog logs an upstream reporting a different serverInfo when it is reconnected and otherwise
+	// carries on as before
+	IdentityChangeLog = "log"
+	// IdentityChangeReregister treats an upstream reporting a different serverInfo as a new server. Its tools are
+	// discovered again from scratch and the identity changed handler is called so the upstream sessions held with
+	// the server it replaced are dropped
+	IdentityChangeReregister = "reregister"
+)
+
+// SetIdentityChangeBehavior sets how the manager reacts to the upstream reporting a different serverInfo name or
+// version when it is reconnected, IdentityChangeLog or IdentityChangeReregister. It defaults to IdentityChangeLog.
+// With IdentityChangeReregister onChange, when set, is called with the server's name. It must be set before Start
+func (man *MCPManager) SetIdentityChangeBehavior(behavior string, onChange func(ctx context.Context, serverName string)) {
+	man.identityChangeBehavior = behavior
+	man.identityChanged = onChange
+}
+
+// checkIdentity compares the serverInfo the upstream sent in its last initialize with the one it sent before. A
+// different name or version means another server has replaced it behind the same URL. It is only called from the
+// Start loop after a new connection is made
+func (man *MCPManager) checkIdentity(ctx context.Context) {
+	info := man.MCP.ProtocolInfo()
+	if info == nil {
+		return
+	}
+	previous := man.serverInfo
+	current := info.ServerInfo
+	man.serverInfo = &current
+	if previous == nil || sameServerInfo(*previous, current) {
+		return
+	}
+	reregister := man.identityChangeBehavior == IdentityChangeReregister
+	man.logger.Warn("upstream mcp server identity changed", "upstream mcp server", man.MCP.ID(),
+		"previous name", previous.Name, "previous version", previous.Version,
+		"name", current.Name, "version", current.Version, "reregister", reregister)
+	if !reregister {
+		return
+	}
+	// the tools are listed again further on in manage as none are held
+	man.removeTools()
+	if man.identityChanged != nil {
+		man.identityChanged(ctx, man.MCP.GetName())
+	}
+}
+
+func sameServerInfo(a, b mcp.Implementation) bool {
+	return a.Name == b.Name && a.Version == b.Version
+}
@@ -0,0 +1,51 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const notificationInitialized = "notifications/initialized"
+
+// InitializeSession performs the MCP initialize handshake over the transport and then sends notifications/initialized.
+// The session exists once initialize succeeds, so a server that rejects the notification or handles it out of order
+// is logged rather than treated as a failure. Clients on the transport should be created with client.WithSession.
+func InitializeSession(ctx context.Context, trans transport.Interface, params mcp.InitializeParams) (*mcp.InitializeResult, error) {
+	resp, err := trans.SendRequest(ctx, transport.JSONRPCRequest{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      mcp.NewRequestId(int64(0)),
+		Method:  string(mcp.MethodInitialize),
+		Params:  params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initialize request failed: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("initialize request failed: %d %s", resp.Error.Code, resp.Error.Message)
+	}
+
+	result := &mcp.InitializeResult{}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal initialize result: %w", err)
+	}
+	if !slices.Contains(mcp.ValidProtocolVersions, result.ProtocolVersion) {
+		return nil, mcp.UnsupportedProtocolVersionError{Version: result.ProtocolVersion}
+	}
+	if httpConn, ok := trans.(transport.HTTPConnection); ok {
+		httpConn.SetProtocolVersion(result.ProtocolVersion)
+	}
+
+	if err := trans.SendNotification(ctx, mcp.JSONRPCNotification{
+		JSONRPC:      mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{Method: notificationInitialized},
+	}); err != nil {
+		slog.Warn("upstream did not accept notifications/initialized, continuing with the initialized session", "error", err)
+	}
+	return result, nil
+}
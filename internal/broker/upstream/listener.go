@@ -0,0 +1,184 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ListenerBackoff controls how the notification listener reconnects when its stream from the upstream drops. It is
+// separate from the manager's health checks so tool change notifications recover within seconds of a dropped stream
+type ListenerBackoff struct {
+	// InitialDelay is the wait before the first reconnect. It doubles with each failed attempt
+	InitialDelay time.Duration
+	// MaxDelay caps the wait between reconnects
+	MaxDelay time.Duration
+	// MaxAttempts is the number of reconnects tried in a row before the connection is reported lost and left to the
+	// manager's next health check. 0 retries until the manager disconnects
+	MaxAttempts int
+}
+
+// DefaultListenerBackoff is used for servers without their own reconnection parameters
+var DefaultListenerBackoff = ListenerBackoff{
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+	MaxAttempts:  10,
+}
+
+// delay returns the wait before the reconnect attempt, counting from 1
+func (b ListenerBackoff) delay(attempt int) time.Duration {
+	delay := b.InitialDelay
+	if delay <= 0 {
+		delay = DefaultListenerBackoff.InitialDelay
+	}
+	maxDelay := b.MaxDelay
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// errListeningNotAllowed is returned when the upstream does not offer a stream for notifications outside of requests
+var errListeningNotAllowed = errors.New("upstream does not allow listening for notifications")
+
+// notificationListener holds the GET stream the upstream sends notifications on outside of requests. The stream is
+// reopened with backoff whenever it drops until its context is cancelled
+type notificationListener struct {
+	url        string
+	httpClient *http.Client
+	headers    func() http.Header
+	backoff    ListenerBackoff
+	logger     *slog.Logger
+	// notify is called with each notification received
+	notify func(mcp.JSONRPCNotification)
+	// reconnected is called when the stream is opened again after it dropped, as notifications may have been missed
+	reconnected func()
+	// lost is called when MaxAttempts reconnects have failed in a row and the listener has given up
+	lost func(error)
+}
+
+// listen opens the stream and reopens it whenever it drops until ctx is cancelled or the listener gives up
+func (l *notificationListener) listen(ctx context.Context) {
+	attempt := 0
+	dropped := false
+	for {
+		opened, err := l.stream(ctx, func() {
+			if dropped {
+				l.logger.Info("notification stream reopened", "attempts", attempt)
+				if l.reconnected != nil {
+					l.reconnected()
+				}
+			}
+			attempt = 0
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errListeningNotAllowed) {
+			l.logger.Debug("upstream does not offer a notification stream, only notifications sent with responses are received")
+			return
+		}
+		dropped = dropped || opened
+		attempt++
+		if l.backoff.MaxAttempts > 0 && attempt > l.backoff.MaxAttempts {
+			if err == nil {
+				err = fmt.Errorf("notification stream closed")
+			}
+			err = fmt.Errorf("gave up reopening the notification stream after %d attempts: %w", l.backoff.MaxAttempts, err)
+			l.logger.Error("notification stream lost", "error", err)
+			if l.lost != nil {
+				l.lost(err)
+			}
+			return
+		}
+		delay := l.backoff.delay(attempt)
+		l.logger.Debug("notification stream dropped, reopening", "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// stream opens the stream and reads notifications from it until it ends. opened is called once the upstream accepts
+// the stream and the returned bool reports whether it did
+func (l *notificationListener) stream(ctx context.Context, opened func()) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header = l.headers()
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return false, errListeningNotAllowed
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d opening notification stream", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		return false, fmt.Errorf("unexpected content type %q opening notification stream", contentType)
+	}
+	opened()
+	return true, l.read(resp.Body)
+}
+
+// read dispatches the notifications in the event stream until it ends
+func (l *notificationListener) read(body io.Reader) error {
+	reader := bufio.NewReader(body)
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && data.Len() > 0:
+			l.dispatch(data.String())
+			data.Reset()
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (l *notificationListener) dispatch(data string) {
+	var message struct {
+		mcp.JSONRPCNotification
+		ID any `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		l.logger.Debug("ignoring malformed message on notification stream", "error", err)
+		return
+	}
+	if message.ID != nil || message.Method == "" {
+		// requests from the upstream, such as sampling, are not supported by the broker
+		l.logger.Debug("ignoring message on notification stream that is not a notification", "method", message.Method)
+		return
+	}
+	l.notify(message.JSONRPCNotification)
+}
@@ -5,10 +5,13 @@ package upstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/config"
@@ -26,12 +29,22 @@ type ToolsAdderDeleter interface {
 
 	// ListTools will list all tools currently registered with the gateway
 	ListTools() map[string]*server.ServerTool
+
+	// GetTool returns the tool registered with the gateway under the name or nil if there is none
+	GetTool(name string) *server.ServerTool
 }
 
 const (
 	notificationToolsListChanged = "notifications/tools/list_changed"
+	notificationResourcesUpdated = "notifications/resources/updated"
 )
 
+// ErrResourceSubscribeUnsupported is returned when subscribing to a resource on a server that does not support resources/subscribe
+var ErrResourceSubscribeUnsupported = errors.New("upstream does not support resource subscriptions")
+
+// ErrManagerStopped is returned for requests made to a manager that has been stopped
+var ErrManagerStopped = errors.New("manager stopped")
+
 // ServerValidationStatus contains the validation results for an upstream MCP server
 type ServerValidationStatus struct {
 	ID            string    `json:"id"`
@@ -39,9 +52,56 @@ type ServerValidationStatus struct {
 	LastValidated time.Time `json:"lastValidated"`
 	Message       string    `json:"message"`
 	Ready         bool      `json:"ready"`
-	TotalTools    int       `json:"totalTools"`
+	// Reachable is true when an MCP session could be established with the server
+	Reachable bool `json:"reachable"`
+	// ProtocolValid is true when the server negotiated a supported protocol version. It is only meaningful when the server is reachable
+	ProtocolValid bool `json:"protocolValid"`
+	// ErrorKind is the kind of the failure to connect to or ping the server
+	ErrorKind      ErrorKind `json:"errorKind,omitempty"`
+	TotalTools     int       `json:"totalTools"`
+	TruncatedTools int       `json:"truncatedTools,omitempty"`
+	// AdvertisedTools is the number of the server's tools the gateway lists. Fallback tools and tools left out
+	// because the broker's tool limit was reached are not counted
+	AdvertisedTools int `json:"advertisedTools"`
+	// DroppedTools are the names of the tools not advertised because the broker's tool limit was reached
+	DroppedTools []string `json:"droppedTools,omitempty"`
+	// ReadOnly is true when the server is configured as read-only
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// HiddenTools is the number of tools not advertised because the server is read-only and they are not annotated as read-only
+	HiddenTools int `json:"hiddenTools,omitempty"`
+	// ConnectionState tells a server that has never been connected apart from one that lost its connection
+	ConnectionState ConnectionState `json:"connectionState"`
+	// FailedAttempts is the number of connection attempts that have failed in a row
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+	// ToolsPolling is true when the server does not send tool list changed notifications so its tools are listed
+	// again on each poll rather than when they change
+	ToolsPolling bool `json:"toolsPolling,omitempty"`
+	// FallbackTools is true while the server is unavailable and its fallback tools are advertised in its place
+	FallbackTools bool `json:"fallbackTools,omitempty"`
 }
 
+// ConnectionState is the state of the manager's connection to the upstream
+type ConnectionState string
+
+const (
+	// ConnectionStateNeverConnected is set until a session is first established with the upstream
+	ConnectionStateNeverConnected ConnectionState = "NeverConnected"
+	// ConnectionStateConnected is set while the upstream is connected
+	ConnectionStateConnected ConnectionState = "Connected"
+	// ConnectionStateReconnecting is set once a connection that was established is lost and is being retried
+	ConnectionStateReconnecting ConnectionState = "Reconnecting"
+	// ConnectionStateFailed is set when reconnecting has failed reconnectAttemptsBeforeFailed times in a row, or
+	// when an upstream with a startup probe has not connected within the probe's failure threshold. The manager
+	// keeps retrying on each tick
+	ConnectionStateFailed ConnectionState = "Failed"
+)
+
+// reconnectAttemptsBeforeFailed is the number of failed attempts to reconnect after which the connection is failed
+const reconnectAttemptsBeforeFailed = 3
+
+// pingTimeout bounds the manager's ping of the upstream on each health check
+var pingTimeout = 10 * time.Second
+
 // MCP defines the interface for the manager to interact with an MCP server
 type MCP interface {
 	GetName() string
@@ -49,13 +109,40 @@ type MCP interface {
 	GetConfig() config.MCPServer
 	ID() config.UpstreamMCPID
 	GetPrefix() string
+	ToolName(upstreamName string) string
+	ToolNames(upstreamName string) []string
 	Connect(context.Context, func()) error
 	Disconnect() error
 	ListTools(context.Context, mcp.ListToolsRequest) (*mcp.ListToolsResult, error)
 	OnNotification(func(notification mcp.JSONRPCNotification))
 	OnConnectionLost(func(err error))
+	OnListenerReconnected(func())
 	Ping(context.Context) error
 	ProtocolInfo() *mcp.InitializeResult
+	SupportsResources() bool
+	ListResourceTemplates(context.Context, mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, error)
+	SupportsResourceSubscribe() bool
+	SubscribeResource(ctx context.Context, uri string) error
+	UnsubscribeResource(ctx context.Context, uri string) error
+}
+
+// ToolOwnerStore records which server owns each gateway tool name. A name advertised by more than one server stays
+// with its owner across restarts and config reloads rather than going to whichever server is registered first. The
+// store is shared by the broker's replicas
+type ToolOwnerStore interface {
+	// ToolOwners returns the name of the server owning each gateway tool name that has an owner
+	ToolOwners(ctx context.Context) (map[string]string, error)
+	// ClaimToolOwner makes the server the owner of the tool name unless another server owns it. It returns the owner
+	ClaimToolOwner(ctx context.Context, toolName, serverName string) (string, error)
+	// ReleaseToolOwner forgets the server as the owner of the tool name
+	ReleaseToolOwner(ctx context.Context, toolName, serverName string) error
+}
+
+// subscriptionRequest is a resource subscribe or unsubscribe handled by the Start loop
+type subscriptionRequest struct {
+	uri       string
+	subscribe bool
+	result    chan error
 }
 
 // MCPManager manages a single backend MCPServer for the broker. It does not act on behalf of clients. It is the only thing that should be connecting to the MCP Server for the broker. It handles tools updates, disconnection, notifications, liveness checks and updating the status for the MCP server. It is responsible for adding and removing tools to the broker. It is intended to be long lived and have 1:1 relationship with a backend MCP server.
@@ -65,20 +152,75 @@ type MCPManager struct {
 	ticker *time.Ticker
 	// tickerInterval is the interval between backend health checks
 	tickerInterval time.Duration
-	gatewayServer  ToolsAdderDeleter
-	// serverTools contains the managed MCP's tools with prefixed names. It is these that are externally available via the gateway
+	// toolPollInterval is the interval tools are listed at for servers that do not send tool list changed
+	// notifications. 0 lists them on each health check
+	toolPollInterval time.Duration
+	// descriptionSuffix is appended to the description of each tool advertised by the gateway
+	descriptionSuffix string
+	gatewayServer     ToolsAdderDeleter
+	// serverTools contains the managed MCP's tools with their gateway names. It is these that are externally available via the gateway
 	serverTools []server.ServerTool
 	// tools is the original set from MCP server with no prefix
 	tools    []mcp.Tool
 	toolsMap map[string]mcp.Tool
-	// toolsLock protects tools, serverTools
+	// upstreamNames maps the gateway name of each tool to its upstream name. Tool renames are not required to be
+	// invertible so the mapping is kept rather than derived from the gateway name
+	upstreamNames map[string]string
+	// resourceTemplates are the upstream's resource templates as they are advertised by the gateway
+	resourceTemplates []mcp.ResourceTemplate
+	// fallback is set while the tools advertised are the fallback tools of the config rather than those the
+	// upstream lists
+	fallback bool
+	// toolsLock protects tools, serverTools, toolsMap, upstreamNames, resourceTemplates and fallback
 	toolsLock sync.RWMutex
 
 	logger *slog.Logger
 
 	stopOnce sync.Once     // ensures Stop() is only executed once
 	done     chan struct{} // triggers the exit of the select and routine
-	status   ServerValidationStatus
+	// finished is closed once Start has returned and the connection to the upstream has been torn down
+	finished chan struct{}
+	// discovered is closed once the first attempt to connect and discover the upstream's tools has finished
+	discovered chan struct{}
+	// lifecycleLock protects running and stopped
+	lifecycleLock sync.Mutex
+	running       bool
+	stopped       bool
+	// toolsChanged is signalled by a tools list changed notification so tools are synced by the Start loop rather
+	// than the notification callback. This keeps manage to a single goroutine.
+	toolsChanged chan struct{}
+	// connectionDropped is set when the connection to the upstream is lost so the next tick makes a new one
+	connectionDropped atomic.Bool
+	// probes carries on demand checks of the upstream to the Start loop. The channel sent is closed once the check is done
+	probes chan chan struct{}
+	// subscriptions carries resource subscription changes to the Start loop so only that goroutine uses the connection
+	subscriptions chan subscriptionRequest
+	// subscribedResources is the set of resource uris subscribed to on the upstream. Only used by the Start loop
+	subscribedResources map[string]struct{}
+	// reconnected is set when a new connection is made so subscriptions are renewed. Only used by the Start loop
+	reconnected bool
+	// hiddenTools is the number of the upstream's tools left out because the server is read-only. Only used by the Start loop
+	hiddenTools int
+	// serverInfo is the serverInfo the upstream sent in its last initialize. Only used by the Start loop
+	serverInfo *mcp.Implementation
+	// identityChangeBehavior is how a change of serverInfo between connections is handled
+	identityChangeBehavior string
+	// identityChanged is called when the upstream is reregistered after its serverInfo changed
+	identityChanged func(ctx context.Context, serverName string)
+	// resourceUpdated is called with the uri of each notifications/resources/updated received from the upstream
+	resourceUpdated func(id config.UpstreamMCPID, uri string)
+	// toolOwners when set records the server owning each tool name so conflicts are settled the same way each time
+	toolOwners ToolOwnerStore
+	// serverConfigured reports whether a server with the name is configured. Names owned by a server that is not are
+	// taken over
+	serverConfigured func(serverName string) bool
+	status           ServerValidationStatus
+	// everConnected is set once a session has been established with the upstream
+	everConnected bool
+	// capabilities are what the upstream advertised in its last successful initialize
+	capabilities mcp.ServerCapabilities
+	// statusLock protects status, everConnected and capabilities
+	statusLock sync.RWMutex
 }
 
 // DefaultTickerInterval is the default interval for backend health checks
@@ -93,12 +235,20 @@ func NewUpstreamMCPManager(upstream MCP, gatewaySever ToolsAdderDeleter, logger
 	}
 
 	return &MCPManager{
-		MCP:            upstream,
-		gatewayServer:  gatewaySever,
-		tickerInterval: tickerInterval,
-		logger:         logger,
-		done:           make(chan struct{}),
-		toolsMap:       map[string]mcp.Tool{},
+		MCP:                 upstream,
+		gatewayServer:       gatewaySever,
+		tickerInterval:      tickerInterval,
+		logger:              logger,
+		done:                make(chan struct{}),
+		finished:            make(chan struct{}),
+		discovered:          make(chan struct{}),
+		toolsChanged:        make(chan struct{}, 1),
+		toolsMap:            map[string]mcp.Tool{},
+		upstreamNames:       map[string]string{},
+		subscriptions:       make(chan subscriptionRequest),
+		probes:              make(chan chan struct{}),
+		subscribedResources: map[string]struct{}{},
+		status:              ServerValidationStatus{ConnectionState: ConnectionStateNeverConnected},
 	}
 }
 
@@ -110,88 +260,308 @@ func (man *MCPManager) MCPName() string {
 // Start begins the management loop for the upstream MCP server. It connects to
 // the server, discovers tools, and periodically validates the connection. It also
 // registers notification callbacks to handle tool list changes. This method blocks
-// until Stop is called or the context is cancelled.
+// until Stop is called or the context is cancelled. The connection, including the
+// client's listening goroutine, is bound to a context that is cancelled when the
+// manager stops and is torn down before Start returns.
 func (man *MCPManager) Start(ctx context.Context) {
-	man.ticker = time.NewTicker(man.tickerInterval)
+	man.lifecycleLock.Lock()
+	if man.stopped || man.running {
+		man.lifecycleLock.Unlock()
+		return
+	}
+	man.running = true
+	man.lifecycleLock.Unlock()
+	defer close(man.finished)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-man.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	interval := man.healthCheckInterval()
+	man.ticker = time.NewTicker(interval)
+	defer man.ticker.Stop()
+	// a nil channel never fires so servers are only polled on the health check unless a poll interval is set
+	var poll <-chan time.Time
+	if man.toolPollInterval > 0 {
+		pollTicker := time.NewTicker(man.toolPollInterval)
+		defer pollTicker.Stop()
+		poll = pollTicker.C
+	}
+	defer man.teardown()
 	man.manage(ctx)
+	close(man.discovered)
 
 	for {
+		// the startup probe's period only applies until the upstream has started
+		if next := man.healthCheckInterval(); next != interval {
+			interval = next
+			man.ticker.Reset(interval)
+		}
 		select {
 		case <-ctx.Done():
-			man.Stop()
+			man.logger.Debug("shutting down manager", "upstream mcp server", man.MCP.ID())
+			return
 		case <-man.ticker.C:
 			man.logger.Debug("health check tick", "upstream mcp server", man.MCP.ID())
 			man.manage(ctx)
-		case <-man.done:
-			man.logger.Debug("shutting down manager", "upstream mcp server", man.MCP.ID())
-			return
+		case <-man.toolsChanged:
+			man.manage(ctx)
+		case <-poll:
+			// servers that send change notifications are synced when they do
+			if !man.MCP.SupportsToolsListChanged() {
+				man.logger.Debug("polling tools", "upstream mcp server", man.MCP.ID())
+				man.manage(ctx)
+			}
+		case req := <-man.subscriptions:
+			req.result <- man.updateSubscription(ctx, req)
+		case done := <-man.probes:
+			man.logger.Debug("probing upstream", "upstream mcp server", man.MCP.ID())
+			// list the tools even when the server sends change notifications so the probe reports the current set
+			man.toolsLock.Lock()
+			man.serverTools = []server.ServerTool{}
+			man.toolsLock.Unlock()
+			man.manage(ctx)
+			close(done)
 		}
 	}
 }
 
-// Stop gracefully shuts down the manager. It stops the ticker, removes all tools
-// from the gateway, disconnects from the upstream server, and waits for the Start
-// goroutine to complete. Safe to call multiple times.
+// Probe checks the connection to the upstream and lists its tools now rather than on the next tick. It returns once
+// the status has been updated with the result
+func (man *MCPManager) Probe(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case man.probes <- done:
+	case <-man.done:
+		return ErrManagerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Discovered returns a channel that is closed once the first attempt to connect to the upstream and discover its
+// tools has finished, whether or not it succeeded, or the manager was stopped before it started
+func (man *MCPManager) Discovered() <-chan struct{} {
+	return man.discovered
+}
+
+// Stop gracefully shuts down the manager. It removes all tools from the gateway,
+// disconnects from the upstream server, and waits for the Start goroutine to
+// complete. Safe to call multiple times.
 func (man *MCPManager) Stop() {
 	man.stopOnce.Do(func() {
-		if man.ticker != nil {
-			man.ticker.Stop()
-		}
-		man.removeTools()
-		if err := man.MCP.Disconnect(); err != nil {
-			man.logger.Error("failed to disconnect during stop", "upstream mcp server", man.MCP.ID(), "error", err)
-		}
+		man.lifecycleLock.Lock()
+		man.stopped = true
+		running := man.running
+		man.lifecycleLock.Unlock()
 		close(man.done)
+		if running {
+			// Start owns the connection so it is torn down there once the in flight manage has returned
+			<-man.finished
+		} else {
+			man.teardown()
+			// Start will not run so there is no discovery to wait for
+			close(man.discovered)
+		}
 		man.logger.Debug("manager stopped", "upstream mcp server", man.MCP.ID())
 	})
 }
 
+// teardown removes the tools from the gateway and closes the connection to the upstream
+func (man *MCPManager) teardown() {
+	man.removeTools()
+	if err := man.MCP.Disconnect(); err != nil {
+		man.logger.Error("failed to disconnect during stop", "upstream mcp server", man.MCP.ID(), "error", err)
+	}
+}
+
+// SetToolPollInterval sets how often tools are listed for a server that does not send tool list changed
+// notifications. 0, the default, lists them on each health check. It must be set before Start
+func (man *MCPManager) SetToolPollInterval(interval time.Duration) {
+	man.toolPollInterval = interval
+}
+
+// SetToolDescriptionSuffix sets a suffix appended to the description of each tool advertised by the gateway, for
+// example to name the server the tool comes from. It must be set before Start
+func (man *MCPManager) SetToolDescriptionSuffix(suffix string) {
+	man.descriptionSuffix = suffix
+}
+
+// SetToolOwners sets the store recording the server that owns each tool name. A tool name owned by another server
+// that is configured conflicts even while that server is not registered, so the owner keeps the name whichever server
+// connects first. configured reports whether a server with the name is configured. It must be set before Start
+func (man *MCPManager) SetToolOwners(store ToolOwnerStore, configured func(serverName string) bool) {
+	man.toolOwners = store
+	man.serverConfigured = configured
+}
+
+// OnResourceUpdated sets the handler called for each notifications/resources/updated received from the upstream.
+// It must be set before Start and must not block as it is called as notifications are read.
+func (man *MCPManager) OnResourceUpdated(handler func(id config.UpstreamMCPID, uri string)) {
+	man.resourceUpdated = handler
+}
+
+// SubscribeResource subscribes to updates of the resource on the upstream. The subscription is renewed whenever
+// the manager reconnects.
+func (man *MCPManager) SubscribeResource(ctx context.Context, uri string) error {
+	return man.requestSubscription(ctx, subscriptionRequest{uri: uri, subscribe: true})
+}
+
+// UnsubscribeResource removes the subscription to updates of the resource on the upstream
+func (man *MCPManager) UnsubscribeResource(ctx context.Context, uri string) error {
+	return man.requestSubscription(ctx, subscriptionRequest{uri: uri, subscribe: false})
+}
+
+func (man *MCPManager) requestSubscription(ctx context.Context, req subscriptionRequest) error {
+	req.result = make(chan error, 1)
+	select {
+	case man.subscriptions <- req:
+	case <-man.done:
+		return ErrManagerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateSubscription applies a subscription request to the upstream. It is only called from the Start loop
+func (man *MCPManager) updateSubscription(ctx context.Context, req subscriptionRequest) error {
+	if !req.subscribe {
+		delete(man.subscribedResources, req.uri)
+		return man.MCP.UnsubscribeResource(ctx, req.uri)
+	}
+	if !man.MCP.SupportsResourceSubscribe() {
+		return ErrResourceSubscribeUnsupported
+	}
+	if err := man.MCP.SubscribeResource(ctx, req.uri); err != nil {
+		return err
+	}
+	man.subscribedResources[req.uri] = struct{}{}
+	return nil
+}
+
+// renewSubscriptions subscribes again to every resource after a new connection is made to the upstream
+func (man *MCPManager) renewSubscriptions(ctx context.Context) {
+	if !man.reconnected {
+		return
+	}
+	man.reconnected = false
+	for uri := range man.subscribedResources {
+		if err := man.MCP.SubscribeResource(ctx, uri); err != nil {
+			man.logger.Error("failed to renew resource subscription", "upstream mcp server", man.MCP.ID(), "uri", uri, "error", err)
+		}
+	}
+}
+
 func (man *MCPManager) registerCallbacks(ctx context.Context) func() {
 	man.logger.Debug("registering callbacks", "upstream mcp server", man.MCP.ID())
 	return func() {
+		man.reconnected = true
 		man.MCP.OnNotification(func(notification mcp.JSONRPCNotification) {
+			if notification.Method == notificationResourcesUpdated {
+				uri, _ := notification.Params.AdditionalFields["uri"].(string)
+				man.logger.Debug("received resource updated notification", "upstream mcp server", man.MCP.ID(), "uri", uri)
+				if uri != "" && man.resourceUpdated != nil {
+					man.resourceUpdated(man.MCP.ID(), uri)
+				}
+				return
+			}
 			if notification.Method == notificationToolsListChanged {
 				man.logger.Debug("received notification", "upstream mcp server", man.MCP.ID(), "notification", notification)
-				man.toolsLock.Lock()
-				man.serverTools = []server.ServerTool{}
-				man.toolsLock.Unlock()
-				man.manage(ctx)
+				man.resyncTools()
 				return
 			}
 		})
 
+		man.MCP.OnListenerReconnected(func() {
+			// a tools list changed notification may have been sent while the stream was down
+			man.logger.Debug("notification stream reopened, syncing tools", "upstream mcp server", man.MCP.ID())
+			man.resyncTools()
+		})
+
 		man.MCP.OnConnectionLost(func(err error) {
-			// just logging for visibility as will be re-connected on next tick
+			// the connection is made again on the next tick
 			man.logger.Error("connection lost", "upstream mcp server", man.MCP.ID(), "error", err)
+			man.connectionDropped.Store(true)
+			man.connectionLost()
 		})
 	}
 }
 
+// resyncTools clears the tools fetched from the upstream and signals the Start loop to list them again
+func (man *MCPManager) resyncTools() {
+	man.toolsLock.Lock()
+	man.serverTools = []server.ServerTool{}
+	man.toolsLock.Unlock()
+	// the notification may arrive on the stream of an in flight request so don't block here
+	select {
+	case man.toolsChanged <- struct{}{}:
+	default:
+	}
+}
+
 // manage should be the only entry point that triggers changes to tools
 func (man *MCPManager) manage(ctx context.Context) {
 	man.logger.Debug("managing connection", "upstream mcp server", man.MCP.ID())
 	var numberOfTools = 0
+	if man.connectionDropped.Swap(false) {
+		// the existing client would be reused by Connect so close it to make a new connection
+		_ = man.MCP.Disconnect()
+	}
 	// during connect the client will validate the protocol. So we don't have a separate validate requirement currently. If a client already exists it will be re-used.
 	man.logger.Debug("attempting to connect", "upstream mcp server", man.MCP.ID())
 	if err := man.MCP.Connect(ctx, man.registerCallbacks(ctx)); err != nil {
-		err = fmt.Errorf("failed to connect to upstream mcp %s removing tools : %w", man.MCP.ID(), err)
-		man.removeTools()
+		err = WrapError(fmt.Errorf("failed to connect to upstream mcp %s removing tools : %w", man.MCP.ID(), err))
+		man.toolsUnavailable(ctx)
 		// we call disconnect here as we may have connected but failed to initialize
 		_ = man.MCP.Disconnect()
 		man.setStatus(err, numberOfTools)
 		return
 	}
-	// there may be an active client so we also ping
-	if err := man.MCP.Ping(ctx); err != nil {
-		err = fmt.Errorf("upstream mcp failed to ping server %s removing tools : %w", man.MCP.ID(), err)
+	// there may be an active client so we also ping. The ping has its own deadline so an upstream that accepts the
+	// request but never answers does not hold up the manager's loop. It is sent on the manager's connection and is
+	// unrelated to pings from clients, which the gateway answers itself
+	timeout := pingTimeout
+	if probe, starting := man.startupProbe(); starting {
+		timeout = probe.Timeout
+	}
+	pingCtx, cancelPing := context.WithTimeout(ctx, timeout)
+	err := man.MCP.Ping(pingCtx)
+	cancelPing()
+	if err != nil {
+		err = WrapError(fmt.Errorf("upstream mcp failed to ping server %s removing tools : %w", man.MCP.ID(), err))
 		man.logger.Error("ping failed", "upstream mcp server", man.MCP.ID(), "error", err)
-		man.removeTools()
+		man.toolsUnavailable(ctx)
 		_ = man.MCP.Disconnect()
 		man.setStatus(err, numberOfTools)
 		return
 	}
 
-	if man.hasTools() && man.MCP.SupportsToolsListChanged() {
+	if man.reconnected {
+		man.checkIdentity(ctx)
+	}
+	man.renewSubscriptions(ctx)
+	man.syncResourceTemplates(ctx)
+
+	fallback := man.ServingFallbackTools()
+	if man.hasTools() && man.MCP.SupportsToolsListChanged() && !fallback {
 		man.logger.Debug("tools already registered, waiting for change notification", "upstream mcp server", man.MCP.ID())
 		return
 	}
@@ -204,8 +574,19 @@ func (man *MCPManager) manage(ctx context.Context) {
 		man.setStatus(err, numberOfTools)
 		return
 	}
+	fetched, man.hiddenTools = man.readOnlyTools(fetched)
+	if err := man.findRenameConflicts(fetched); err != nil {
+		err = fmt.Errorf("upstream mcp failed to add tools to gateway %s : %w", man.MCP.ID(), err)
+		man.logger.Error("tool rename conflict detected", "upstream mcp server", man.MCP.ID(), "error", err)
+		man.setStatus(err, numberOfTools)
+		return
+	}
 	toAdd, toRemove := man.diffTools(current, fetched)
-	if err := man.findToolConflicts(toAdd); err != nil {
+	if fallback {
+		// every listed tool is added so a fallback tool of the same name is replaced by the server's definition
+		toAdd, _ = man.diffTools(nil, fetched)
+	}
+	if err := man.findToolConflicts(ctx, toAdd); err != nil {
 		err = fmt.Errorf("upstream mcp failed to add tools to gateway %s : %w", man.MCP.ID(), err)
 		man.logger.Error("tool conflict detected", "upstream mcp server", man.MCP.ID(), "error", err)
 		man.setStatus(err, numberOfTools)
@@ -216,22 +597,39 @@ func (man *MCPManager) manage(ctx context.Context) {
 	man.gatewayServer.AddTools(toAdd...)
 	man.toolsLock.Lock()
 	man.tools = fetched
+	man.fallback = false
 	numberOfTools = len(fetched)
-	// set a tools map for quick look up by other functions
+	// serverTools and toolsMap hold the full set rather than what changed so removeTools and lookups stay accurate
+	man.serverTools = make([]server.ServerTool, 0, len(fetched))
+	man.toolsMap = make(map[string]mcp.Tool, len(fetched))
+	man.upstreamNames = make(map[string]string, len(fetched))
 	for _, newTool := range fetched {
 		man.toolsMap[newTool.Name] = newTool
+		for _, serverTool := range man.toolToServerTools(newTool) {
+			man.upstreamNames[serverTool.Tool.Name] = newTool.Name
+			man.serverTools = append(man.serverTools, serverTool)
+		}
 	}
-	man.serverTools = toAdd
 	man.toolsLock.Unlock()
+	man.releaseToolOwners(ctx)
 	man.setStatus(nil, numberOfTools)
 }
 
 // GetStatus returns the current status of the MCP Server
-// no locking is done here as it is expected to be called multiple times
 func (man *MCPManager) GetStatus() ServerValidationStatus {
+	man.statusLock.RLock()
+	defer man.statusLock.RUnlock()
 	return man.status
 }
 
+// Capabilities returns the capabilities the upstream advertised when it was initialized. ok is false while the
+// server is not ready
+func (man *MCPManager) Capabilities() (mcp.ServerCapabilities, bool) {
+	man.statusLock.RLock()
+	defer man.statusLock.RUnlock()
+	return man.capabilities, man.status.Ready
+}
+
 func (man *MCPManager) hasTools() bool {
 	man.toolsLock.RLock()
 	defer man.toolsLock.RUnlock()
@@ -239,9 +637,23 @@ func (man *MCPManager) hasTools() bool {
 }
 
 func (man *MCPManager) setStatus(err error, toolCount int) {
+	fallback := man.ServingFallbackTools()
+	man.statusLock.Lock()
+	defer man.statusLock.Unlock()
+	man.status.FallbackTools = fallback
 	man.status.ID = string(man.MCP.ID())
 	man.status.LastValidated = time.Now()
 	man.status.Name = man.MCPName()
+	// tool listing and conflict errors happen after a session was established with a supported protocol version so
+	// only connect and ping failures have a kind
+	var upstreamErr *Error
+	man.status.ErrorKind = ""
+	if errors.As(err, &upstreamErr) {
+		man.status.ErrorKind = upstreamErr.Kind
+	}
+	man.status.Reachable = man.status.ErrorKind == "" || man.status.ErrorKind == ErrorKindProtocolMismatch
+	man.status.ProtocolValid = man.status.Reachable && man.status.ErrorKind != ErrorKindProtocolMismatch
+	man.setConnectionState(err == nil || man.status.ProtocolValid)
 	if err != nil {
 		man.status.Message = err.Error()
 		man.status.Ready = false
@@ -249,40 +661,241 @@ func (man *MCPManager) setStatus(err error, toolCount int) {
 	}
 	man.status.TotalTools = toolCount
 	man.status.Ready = true
-	man.status.Message = fmt.Sprintf("server added successfully. Total tools added %d", len(man.serverTools))
+	if info := man.MCP.ProtocolInfo(); info != nil {
+		man.capabilities = info.Capabilities
+	}
+	man.status.ReadOnly = man.MCP.GetConfig().ReadOnly
+	man.status.HiddenTools = man.hiddenTools
+	man.status.Message = fmt.Sprintf("server added successfully. Total tools added %d", toolCount)
+	if man.hiddenTools > 0 {
+		man.status.Message += fmt.Sprintf(". %d tools not annotated as read-only are hidden", man.hiddenTools)
+	}
+	man.status.ToolsPolling = !man.MCP.SupportsToolsListChanged()
+	if man.status.ToolsPolling {
+		man.status.Message += ". The server does not send tool list changed notifications so its tools are polled"
+	}
+}
+
+// setConnectionState moves the connection state on after a connection attempt. Failing to list or add the tools
+// after a session was established still counts as connected. It must be called with the status lock held
+func (man *MCPManager) setConnectionState(connected bool) {
+	if connected {
+		man.everConnected = true
+		man.status.FailedAttempts = 0
+		man.status.ConnectionState = ConnectionStateConnected
+		return
+	}
+	man.status.FailedAttempts++
+	probe := man.MCP.GetConfig().StartupProbe
+	switch {
+	case !man.everConnected && probe != nil && man.status.FailedAttempts >= probe.WithDefaults().FailureThreshold:
+		man.status.ConnectionState = ConnectionStateFailed
+	case !man.everConnected:
+		man.status.ConnectionState = ConnectionStateNeverConnected
+	case man.status.FailedAttempts >= reconnectAttemptsBeforeFailed:
+		man.status.ConnectionState = ConnectionStateFailed
+	default:
+		man.status.ConnectionState = ConnectionStateReconnecting
+	}
+}
+
+// startupProbe returns the upstream's startup probe with its defaults. starting is false once the upstream has
+// connected or failed to start within the probe's failure threshold, and when no probe is configured
+func (man *MCPManager) startupProbe() (probe config.StartupProbe, starting bool) {
+	configured := man.MCP.GetConfig().StartupProbe
+	if configured == nil {
+		return probe, false
+	}
+	probe = configured.WithDefaults()
+	man.statusLock.RLock()
+	defer man.statusLock.RUnlock()
+	return probe, !man.everConnected && man.status.FailedAttempts < probe.FailureThreshold
+}
+
+// healthCheckInterval returns the interval between health checks of the upstream. It is the startup probe's period
+// while the upstream is starting
+func (man *MCPManager) healthCheckInterval() time.Duration {
+	if probe, starting := man.startupProbe(); starting {
+		return probe.Period
+	}
+	return man.tickerInterval
+}
+
+// connectionLost marks a connected upstream as reconnecting as soon as the client reports the connection dropped
+// rather than waiting for the next tick to notice
+func (man *MCPManager) connectionLost() {
+	man.statusLock.Lock()
+	defer man.statusLock.Unlock()
+	if man.status.ConnectionState == ConnectionStateConnected {
+		man.status.ConnectionState = ConnectionStateReconnecting
+	}
+}
+
+// readOnlyTools leaves out the tools not annotated as read-only when the server is configured as read-only.
+// It returns the tools to advertise and the number left out
+func (man *MCPManager) readOnlyTools(tools []mcp.Tool) ([]mcp.Tool, int) {
+	if !man.MCP.GetConfig().ReadOnly {
+		return tools, 0
+	}
+	readOnly := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if config.IsReadOnly(tool.Annotations) {
+			readOnly = append(readOnly, tool)
+			continue
+		}
+		man.logger.Debug("hiding tool from read-only server", "upstream mcp server", man.MCP.ID(), "tool", tool.Name)
+	}
+	return readOnly, len(tools) - len(readOnly)
 }
 
-func (man *MCPManager) findToolConflicts(mcpTools []server.ServerTool) error {
-	gatewayServerTools := man.gatewayServer.ListTools()
+// findToolConflicts returns an error if a tool registered with the gateway by another server, or owned by another
+// server in the tool owner store, has the name of one of the tools. Each tool is looked up by name so the check does
+// not grow with the number of tools the gateway has. The server is made the owner of the names once there is no conflict
+func (man *MCPManager) findToolConflicts(ctx context.Context, mcpTools []server.ServerTool) error {
+	owners := man.recordedToolOwners(ctx)
 	var conflictingToolNames []string
 	for _, tool := range mcpTools {
-		for existingToolName, existingToolInfo := range gatewayServerTools {
-			existingTool := existingToolInfo.Tool
-			// TODO revisit as this is in the tool definition
-			existingToolID, ok := existingTool.Meta.AdditionalFields["id"]
-			if !ok {
-				// should never happen as we are adding every time
-				man.logger.Error("unable to check conflict, tool id is missing", "upstream mcp server", man.MCP.ID())
-				continue
-			}
-			toolID, is := existingToolID.(string)
-			if !is {
-				// also should never happen
-				man.logger.Error("unable to check conflict, tool id is not a string", "upstream mcp server", man.MCP.ID(), "type", reflect.TypeOf(existingToolID))
+		if owner := man.otherToolOwner(owners, tool.Tool.GetName()); owner != "" {
+			man.logger.Debug("tool name owned by another server", "upstream mcp server", man.MCP.ID(), "tool", tool.Tool.GetName(), "owner", owner)
+			conflictingToolNames = append(conflictingToolNames, owner)
+			continue
+		}
+		existingTool := man.gatewayServer.GetTool(tool.Tool.GetName())
+		if existingTool == nil {
+			continue
+		}
+		// TODO revisit as this is in the tool definition
+		existingToolID, ok := existingTool.Tool.Meta.AdditionalFields["id"]
+		if !ok {
+			// should never happen as we are adding every time
+			man.logger.Error("unable to check conflict, tool id is missing", "upstream mcp server", man.MCP.ID())
+			continue
+		}
+		toolID, is := existingToolID.(string)
+		if !is {
+			// also should never happen
+			man.logger.Error("unable to check conflict, tool id is not a string", "upstream mcp server", man.MCP.ID(), "type", reflect.TypeOf(existingToolID))
+			continue
+		}
+		if toolID != string(man.MCP.ID()) {
+			man.logger.Debug("tool name conflict found", "upstream mcp server", man.MCP.ID(), "existing", existingTool.Tool.GetName(), "new", tool.Tool.GetName(), "conflicting server", toolID)
+			conflictingToolNames = append(conflictingToolNames, toolID)
+		}
+	}
+	if len(conflictingToolNames) == 0 {
+		// another replica may have claimed a name since the owners were read
+		conflictingToolNames = man.claimToolOwners(ctx, owners, mcpTools)
+	}
+	if len(conflictingToolNames) > 0 {
+		return fmt.Errorf("conflicting tools discovered. conflicting tool names %v", conflictingToolNames)
+	}
+
+	return nil
+}
+
+// recordedToolOwners returns the owner of each tool name in the tool owner store. Conflicts are only checked against
+// the registered tools when there is no store or it cannot be read
+func (man *MCPManager) recordedToolOwners(ctx context.Context) map[string]string {
+	if man.toolOwners == nil {
+		return nil
+	}
+	owners, err := man.toolOwners.ToolOwners(ctx)
+	if err != nil {
+		man.logger.Error("failed to read tool owners, checking conflicts with registered tools only", "upstream mcp server", man.MCP.ID(), "error", err)
+		return nil
+	}
+	return owners
+}
+
+// otherToolOwner returns the configured server other than this one that owns the tool name, empty when there is none
+func (man *MCPManager) otherToolOwner(owners map[string]string, toolName string) string {
+	owner := owners[toolName]
+	if owner == "" || owner == man.MCP.GetName() || (man.serverConfigured != nil && !man.serverConfigured(owner)) {
+		return ""
+	}
+	return owner
+}
+
+// claimToolOwners makes the server the owner of the tool names it does not own yet, taking over those owned by a
+// server that is no longer configured. It returns the owners of the names another server claimed first
+func (man *MCPManager) claimToolOwners(ctx context.Context, owners map[string]string, mcpTools []server.ServerTool) []string {
+	if man.toolOwners == nil {
+		return nil
+	}
+	var claimedByOthers []string
+	for _, tool := range mcpTools {
+		name := tool.Tool.GetName()
+		previous := owners[name]
+		if previous == man.MCP.GetName() {
+			continue
+		}
+		if previous != "" {
+			man.logger.Info("taking over tool name of a server that is no longer configured", "upstream mcp server", man.MCP.ID(), "tool", name, "previous owner", previous)
+			if err := man.toolOwners.ReleaseToolOwner(ctx, name, previous); err != nil {
+				man.logger.Error("failed to release tool name", "upstream mcp server", man.MCP.ID(), "tool", name, "error", err)
 				continue
 			}
+		}
+		owner, err := man.toolOwners.ClaimToolOwner(ctx, name, man.MCP.GetName())
+		if err != nil {
+			man.logger.Error("failed to claim tool name", "upstream mcp server", man.MCP.ID(), "tool", name, "error", err)
+			continue
+		}
+		if owner != "" && owner != man.MCP.GetName() {
+			claimedByOthers = append(claimedByOthers, owner)
+		}
+	}
+	return claimedByOthers
+}
 
-			if existingToolName == tool.Tool.GetName() && toolID != string(man.MCP.ID()) {
-				man.logger.Debug("tool name conflict found", "upstream mcp server", man.MCP.ID(), "existing", existingToolName, "new", tool.Tool.GetName(), "conflicting server", toolID)
-				conflictingToolNames = append(conflictingToolNames, toolID)
-			}
+// releaseToolOwners gives up the tool names the server owns but no longer advertises, such as tools the upstream
+// removed or renamed, so other servers may use them. Names are kept while the upstream is unavailable
+func (man *MCPManager) releaseToolOwners(ctx context.Context) {
+	owners := man.recordedToolOwners(ctx)
+	if len(owners) == 0 {
+		return
+	}
+	man.toolsLock.RLock()
+	advertised := make(map[string]struct{}, len(man.serverTools))
+	for _, tool := range man.serverTools {
+		advertised[tool.Tool.GetName()] = struct{}{}
+	}
+	man.toolsLock.RUnlock()
+	for name, owner := range owners {
+		if _, ok := advertised[name]; ok || owner != man.MCP.GetName() {
+			continue
+		}
+		if err := man.toolOwners.ReleaseToolOwner(ctx, name, owner); err != nil {
+			man.logger.Error("failed to release tool name", "upstream mcp server", man.MCP.ID(), "tool", name, "error", err)
+		}
+	}
+}
 
+// findRenameConflicts returns an error if the tool renames, or the prefix aliases, give more than one of the upstream's
+// tools the same name or leave the tool prefix separator in a tool's name
+func (man *MCPManager) findRenameConflicts(tools []mcp.Tool) error {
+	serverConfig := man.MCP.GetConfig()
+	upstreamNames := make(map[string]string, len(tools))
+	var conflicts, withSeparator []string
+	for _, tool := range tools {
+		renamed := strings.TrimPrefix(man.MCP.ToolName(tool.Name), serverConfig.ToolNamePrefixes()[0])
+		if separator := serverConfig.ToolPrefixSeparator; separator != "" && strings.Contains(renamed, separator) {
+			withSeparator = append(withSeparator, tool.Name)
+		}
+		for _, gatewayName := range man.MCP.ToolNames(tool.Name) {
+			if existing, ok := upstreamNames[gatewayName]; ok && existing != tool.Name {
+				conflicts = append(conflicts, fmt.Sprintf("%s and %s renamed to %s", existing, tool.Name, gatewayName))
+				continue
+			}
+			upstreamNames[gatewayName] = tool.Name
 		}
 	}
-	if len(conflictingToolNames) > 0 {
-		return fmt.Errorf("conflicting tools discovered. conflicting tool names %v", conflictingToolNames)
+	if len(conflicts) > 0 {
+		return fmt.Errorf("tool renames produce conflicting tool names %v", conflicts)
+	}
+	if len(withSeparator) > 0 {
+		return fmt.Errorf("tool names %v contain the tool prefix separator %q, rename them with toolRenames", withSeparator, serverConfig.ToolPrefixSeparator)
 	}
-
 	return nil
 }
 
@@ -322,6 +935,34 @@ func (man *MCPManager) GetManagedTool(toolName string) *mcp.Tool {
 	return nil
 }
 
+// GatewayToolName returns the name the upstream tool is advertised as by the gateway
+func (man *MCPManager) GatewayToolName(upstreamName string) string {
+	return man.MCP.ToolName(upstreamName)
+}
+
+// GatewayToolDescription returns the description an upstream tool is advertised with by the gateway. The suffix is
+// not added again to a description that already ends with it, such as one from an upstream that is itself a gateway
+func (man *MCPManager) GatewayToolDescription(upstreamDescription string) string {
+	if man.descriptionSuffix == "" || strings.HasSuffix(upstreamDescription, man.descriptionSuffix) {
+		return upstreamDescription
+	}
+	return upstreamDescription + man.descriptionSuffix
+}
+
+// GatewayToolNames returns every name the upstream tool is advertised as by the gateway, one for the prefix and one
+// for each prefix alias
+func (man *MCPManager) GatewayToolNames(upstreamName string) []string {
+	return man.MCP.ToolNames(upstreamName)
+}
+
+// UpstreamToolName returns the upstream name of a tool advertised by the gateway. ok is false if this managed MCP server does not advertise a tool with that name
+func (man *MCPManager) UpstreamToolName(gatewayName string) (string, bool) {
+	man.toolsLock.RLock()
+	defer man.toolsLock.RUnlock()
+	name, ok := man.upstreamNames[gatewayName]
+	return name, ok
+}
+
 // SetToolsForTesting sets the tools directly for testing purposes.
 // This bypasses the normal tool discovery flow and should only be used in tests.
 // TODO look to remove the need for this
@@ -329,11 +970,19 @@ func (man *MCPManager) SetToolsForTesting(tools []mcp.Tool) {
 	man.toolsLock.Lock()
 	defer man.toolsLock.Unlock()
 	man.tools = tools
+	for _, tool := range tools {
+		man.toolsMap[tool.Name] = tool
+		for _, name := range man.MCP.ToolNames(tool.Name) {
+			man.upstreamNames[name] = tool.Name
+		}
+	}
 }
 
 // SetStatusForTesting sets the status directly for testing purposes.
 // This bypasses the normal status update flow and should only be used in tests.
 func (man *MCPManager) SetStatusForTesting(status ServerValidationStatus) {
+	man.statusLock.Lock()
+	defer man.statusLock.Unlock()
 	man.status = status
 }
 
@@ -346,21 +995,47 @@ func (man *MCPManager) removeTools() {
 	}
 	man.serverTools = nil
 	man.tools = nil
+	man.fallback = false
+	man.toolsMap = map[string]mcp.Tool{}
+	man.upstreamNames = map[string]string{}
+	man.resourceTemplates = nil
 	man.gatewayServer.DeleteTools(toolsToRemove...)
 	man.logger.Debug("removed all tools", "upstream mcp server", man.MCP.ID(), "count", len(toolsToRemove))
 }
 
-func (man *MCPManager) toolToServerTool(newTool mcp.Tool) server.ServerTool {
-	newTool.Name = prefixedName(man.MCP.GetPrefix(), newTool.Name)
-	newTool.Meta = mcp.NewMetaFromMap(map[string]any{
-		"id": string(man.MCP.ID()),
-	})
-	return server.ServerTool{
-		Tool: newTool,
-		Handler: func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// ServerToolMetaKey is set in the _meta of each advertised tool to the namespace/name of the MCPServer providing it so
+// clients can group and attribute tools
+const ServerToolMetaKey = "server"
+
+// toolToServerTools returns the tool as it is advertised by the gateway, once under the prefix and once under each
+// prefix alias
+func (man *MCPManager) toolToServerTools(newTool mcp.Tool) []server.ServerTool {
+	names := man.MCP.ToolNames(newTool.Name)
+	serverTools := make([]server.ServerTool, 0, len(names))
+	for _, name := range names {
+		tool := newTool
+		tool.Name = name
+		tool.Description = man.GatewayToolDescription(newTool.Description)
+		tool.Meta = mcp.NewMetaFromMap(map[string]any{
+			"id":              string(man.MCP.ID()),
+			ServerToolMetaKey: man.MCP.GetName(),
+		})
+		handler := func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			return mcp.NewToolResultError("Kagenti MCP Broker doesn't forward tool calls"), nil
-		},
+		}
+		// calls to the tools of upstreams the broker serves itself are answered here rather than routed by the router
+		if toolServer, ok := man.MCP.(ToolServer); ok {
+			upstreamName := newTool.Name
+			handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return toolServer.ServeToolCall(ctx, upstreamName, request)
+			}
+		}
+		serverTools = append(serverTools, server.ServerTool{
+			Tool:    tool,
+			Handler: handler,
+		})
 	}
+	return serverTools
 }
 
 func (man *MCPManager) diffTools(oldTools, newTools []mcp.Tool) ([]server.ServerTool, []string) {
@@ -378,7 +1053,7 @@ func (man *MCPManager) diffTools(oldTools, newTools []mcp.Tool) ([]server.Server
 	for _, newTool := range newToolMap {
 		_, ok := oldToolMap[newTool.Name]
 		if !ok {
-			addedTools = append(addedTools, man.toolToServerTool(newTool))
+			addedTools = append(addedTools, man.toolToServerTools(newTool)...)
 		}
 	}
 
@@ -386,7 +1061,7 @@ func (man *MCPManager) diffTools(oldTools, newTools []mcp.Tool) ([]server.Server
 	for _, oldTool := range oldToolMap {
 		_, ok := newToolMap[oldTool.Name]
 		if !ok {
-			removedTools = append(removedTools, prefixedName(man.MCP.GetPrefix(), oldTool.Name))
+			removedTools = append(removedTools, man.MCP.ToolNames(oldTool.Name)...)
 		}
 	}
 
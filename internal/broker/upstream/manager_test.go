@@ -4,27 +4,43 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/config"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MockMCP implements the MCP interface for testing
 type MockMCP struct {
-	name            string
-	prefix          string
-	id              config.UpstreamMCPID
-	cfg             *config.MCPServer
-	connectErr      error
-	pingErr         error
-	tools           []mcp.Tool
-	listToolsErr    error
-	protocolVersion string
-	hasToolsCap     bool
-	connected       bool
+	name       string
+	prefix     string
+	id         config.UpstreamMCPID
+	cfg        *config.MCPServer
+	connectErr error
+	pingErr    error
+	// pingBlocks when set makes Ping wait until its context is done, as for an upstream that never answers
+	pingBlocks   bool
+	tools        []mcp.Tool
+	listToolsErr error
+	// resourceTemplates when set are listed and the resources capability is advertised
+	resourceTemplates []mcp.ResourceTemplate
+	listTemplatesErr  error
+	protocolVersion   string
+	// serverInfo is reported in the result of each initialize
+	serverInfo     mcp.Implementation
+	hasToolsCap    bool
+	connected      bool
+	connectionLost func(err error)
 }
 
 func (m *MockMCP) GetName() string {
@@ -43,6 +59,18 @@ func (m *MockMCP) GetPrefix() string {
 	return m.prefix
 }
 
+func (m *MockMCP) ToolName(upstreamName string) string {
+	return prefixedName(m.prefix, upstreamName)
+}
+
+func (m *MockMCP) ToolNames(upstreamName string) []string {
+	names := []string{m.ToolName(upstreamName)}
+	for _, alias := range m.cfg.ToolPrefixAliases {
+		names = append(names, prefixedName(alias, upstreamName))
+	}
+	return names
+}
+
 func (m *MockMCP) Connect(_ context.Context, onConnected func()) error {
 	if m.connectErr != nil {
 		return m.connectErr
@@ -70,11 +98,42 @@ func (m *MockMCP) ListTools(_ context.Context, _ mcp.ListToolsRequest) (*mcp.Lis
 	return &mcp.ListToolsResult{Tools: m.tools}, nil
 }
 
+func (m *MockMCP) SupportsResources() bool {
+	return m.resourceTemplates != nil || m.listTemplatesErr != nil
+}
+
+func (m *MockMCP) ListResourceTemplates(_ context.Context, _ mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, error) {
+	if m.listTemplatesErr != nil {
+		return nil, m.listTemplatesErr
+	}
+	return &mcp.ListResourceTemplatesResult{ResourceTemplates: m.resourceTemplates}, nil
+}
+
+func (m *MockMCP) SupportsResourceSubscribe() bool {
+	return false
+}
+
+func (m *MockMCP) SubscribeResource(_ context.Context, _ string) error {
+	return fmt.Errorf("not supported")
+}
+
+func (m *MockMCP) UnsubscribeResource(_ context.Context, _ string) error {
+	return fmt.Errorf("not supported")
+}
+
 func (m *MockMCP) OnNotification(_ func(notification mcp.JSONRPCNotification)) {}
 
-func (m *MockMCP) OnConnectionLost(_ func(err error)) {}
+func (m *MockMCP) OnListenerReconnected(_ func()) {}
+
+func (m *MockMCP) OnConnectionLost(handler func(err error)) {
+	m.connectionLost = handler
+}
 
-func (m *MockMCP) Ping(_ context.Context) error {
+func (m *MockMCP) Ping(ctx context.Context) error {
+	if m.pingBlocks {
+		<-ctx.Done()
+		return ctx.Err()
+	}
 	return m.pingErr
 }
 
@@ -82,6 +141,7 @@ func (m *MockMCP) ProtocolInfo() *mcp.InitializeResult {
 	result := &mcp.InitializeResult{
 		ProtocolVersion: m.protocolVersion,
 		Capabilities:    mcp.ServerCapabilities{},
+		ServerInfo:      m.serverInfo,
 	}
 	if m.hasToolsCap {
 		result.Capabilities.Tools = &struct {
@@ -198,3 +258,719 @@ func TestDiffTools(t *testing.T) {
 		})
 	}
 }
+
+func TestManageKeepsFullToolSet(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("test-server", "test_")
+	// without tools list changed support every tick re-syncs the tools
+	mock.hasToolsCap = false
+	mock.tools = []mcp.Tool{{Name: "tool1"}, {Name: "tool2"}}
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+
+	manager.manage(context.Background())
+	manager.manage(context.Background())
+	assert.Len(t, gatewayServer.ListTools(), 2)
+	assert.True(t, manager.hasTools())
+
+	mock.tools = []mcp.Tool{{Name: "tool1"}}
+	manager.manage(context.Background())
+	assert.Len(t, gatewayServer.ListTools(), 1)
+	assert.Nil(t, manager.GetManagedTool("tool2"))
+	assert.NotNil(t, manager.GetManagedTool("tool1"))
+
+	manager.Stop()
+	assert.Empty(t, gatewayServer.ListTools())
+	assert.Nil(t, manager.GetManagedTool("tool1"))
+}
+
+func TestManageToolPrefixAliases(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("test-server", "new_")
+	mock.hasToolsCap = false
+	mock.cfg.ToolPrefixAliases = []string{"old_"}
+	mock.tools = []mcp.Tool{{Name: "tool1"}, {Name: "tool2"}}
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+
+	manager.manage(context.Background())
+	require.Len(t, gatewayServer.ListTools(), 4)
+	for _, name := range []string{"new_tool1", "old_tool1"} {
+		upstreamName, ok := manager.UpstreamToolName(name)
+		require.True(t, ok, name)
+		require.Equal(t, "tool1", upstreamName)
+	}
+	require.Equal(t, 2, manager.GetStatus().TotalTools)
+
+	// removing an upstream tool removes it under every prefix
+	mock.tools = []mcp.Tool{{Name: "tool1"}}
+	manager.manage(context.Background())
+	tools := gatewayServer.ListTools()
+	require.Len(t, tools, 2)
+	require.Contains(t, tools, "new_tool1")
+	require.Contains(t, tools, "old_tool1")
+
+	manager.Stop()
+	require.Empty(t, gatewayServer.ListTools())
+}
+
+func TestManageResourceTemplates(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		Mutate            func(m *MockMCP)
+		ExpectTemplates   []string
+		ExpectUpstreamURI string
+	}{
+		{
+			Name: "templates are advertised with the prefix",
+			Mutate: func(m *MockMCP) {
+				m.resourceTemplates = []mcp.ResourceTemplate{mcp.NewResourceTemplate("file:///{name}", "file")}
+			},
+			ExpectTemplates:   []string{"test_file:///{name}"},
+			ExpectUpstreamURI: "file:///readme.md",
+		},
+		{
+			Name: "server with resources but without templates",
+			Mutate: func(m *MockMCP) {
+				m.listTemplatesErr = fmt.Errorf("%w: resource templates not supported", mcp.ErrMethodNotFound)
+			},
+			ExpectTemplates: []string{},
+		},
+		{
+			Name:            "server without resources",
+			Mutate:          func(_ *MockMCP) {},
+			ExpectTemplates: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			mock := newMockMCP("test-server", "test_")
+			tc.Mutate(mock)
+			gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+			manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+			manager.manage(context.Background())
+			defer manager.Stop()
+
+			// the server is ready whether or not it has templates
+			require.True(t, manager.GetStatus().Ready)
+			templates := []string{}
+			for _, template := range manager.ResourceTemplates() {
+				templates = append(templates, template.URITemplate.Raw())
+			}
+			require.Equal(t, tc.ExpectTemplates, templates)
+			upstreamURI, ok := manager.UpstreamResourceURI("test_file:///readme.md")
+			require.Equal(t, tc.ExpectUpstreamURI != "", ok)
+			require.Equal(t, tc.ExpectUpstreamURI, upstreamURI)
+		})
+	}
+}
+
+func TestManagedToolsCarryServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("mcp-test/test-server", "test_")
+	mock.tools = []mcp.Tool{{Name: "tool1"}, {Name: "tool2", Meta: mcp.NewMetaFromMap(map[string]any{"server": "upstream"})}}
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+	manager.manage(context.Background())
+	defer manager.Stop()
+
+	tools := gatewayServer.ListTools()
+	require.Len(t, tools, 2)
+	for name, tool := range tools {
+		require.NotNil(t, tool.Tool.Meta, name)
+		require.Equal(t, "mcp-test/test-server", tool.Tool.Meta.AdditionalFields[ServerToolMetaKey], name)
+		require.Equal(t, string(mock.ID()), tool.Tool.Meta.AdditionalFields["id"], name)
+	}
+}
+
+func TestManageToolDescriptionSuffix(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("test-server", "test_")
+	mock.hasToolsCap = false
+	mock.tools = []mcp.Tool{
+		{Name: "tool1", Description: "Does one thing"},
+		{Name: "tool2", Description: "Does another thing (via test-server)"},
+	}
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+	manager.SetToolDescriptionSuffix(" (via test-server)")
+	defer manager.Stop()
+
+	manager.manage(context.Background())
+	// a changed upstream tool is advertised again and must not get the suffix twice
+	mock.tools[0].InputSchema.Type = "object"
+	manager.manage(context.Background())
+
+	tools := gatewayServer.ListTools()
+	require.Len(t, tools, 2)
+	require.Equal(t, "Does one thing (via test-server)", tools["test_tool1"].Tool.Description)
+	require.Equal(t, "Does another thing (via test-server)", tools["test_tool2"].Tool.Description)
+	// the managed tools keep the upstream description
+	require.Equal(t, "Does one thing", manager.GetManagedTools()[0].Description)
+}
+
+func TestManageStatusReachableAndProtocolValid(t *testing.T) {
+	defer func(timeout time.Duration) { pingTimeout = timeout }(pingTimeout)
+	pingTimeout = 50 * time.Millisecond
+	testCases := []struct {
+		Name                string
+		Mutate              func(m *MockMCP)
+		ExpectReady         bool
+		ExpectReachable     bool
+		ExpectProtocolValid bool
+		ExpectErrorKind     ErrorKind
+	}{
+		{
+			Name:                "ready",
+			ExpectReady:         true,
+			ExpectReachable:     true,
+			ExpectProtocolValid: true,
+		},
+		{
+			Name:            "connection refused",
+			Mutate:          func(m *MockMCP) { m.connectErr = fmt.Errorf("dial tcp: connection refused") },
+			ExpectErrorKind: ErrorKindUnreachable,
+		},
+		{
+			Name:            "credential refused",
+			Mutate:          func(m *MockMCP) { m.connectErr = fmt.Errorf("request failed with status 401: unauthorized") },
+			ExpectErrorKind: ErrorKindAuthFailed,
+		},
+		{
+			Name:            "ping failed",
+			Mutate:          func(m *MockMCP) { m.pingErr = fmt.Errorf("ping timeout") },
+			ExpectErrorKind: ErrorKindUnreachable,
+		},
+		{
+			Name:            "ping never answered",
+			Mutate:          func(m *MockMCP) { m.pingBlocks = true },
+			ExpectErrorKind: ErrorKindTimeout,
+		},
+		{
+			Name: "unsupported protocol version",
+			Mutate: func(m *MockMCP) {
+				m.connectErr = fmt.Errorf("failed to initialize client: %w", mcp.UnsupportedProtocolVersionError{Version: "2021-11-05"})
+			},
+			ExpectReachable: true,
+			ExpectErrorKind: ErrorKindProtocolMismatch,
+		},
+		{
+			Name:                "list tools failed",
+			Mutate:              func(m *MockMCP) { m.listToolsErr = fmt.Errorf("internal error") },
+			ExpectReachable:     true,
+			ExpectProtocolValid: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			mock := newMockMCP("test-server", "test_")
+			if tc.Mutate != nil {
+				tc.Mutate(mock)
+			}
+			gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+			manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+
+			manager.manage(context.Background())
+			status := manager.GetStatus()
+			assert.Equal(t, tc.ExpectReady, status.Ready)
+			assert.Equal(t, tc.ExpectReachable, status.Reachable)
+			assert.Equal(t, tc.ExpectProtocolValid, status.ProtocolValid)
+			assert.Equal(t, tc.ExpectErrorKind, status.ErrorKind)
+		})
+	}
+}
+
+func TestManageConnectionState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("test-server", "test_")
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+	ctx := context.Background()
+	requireState := func(state ConnectionState, failedAttempts int) {
+		t.Helper()
+		status := manager.GetStatus()
+		require.Equal(t, state, status.ConnectionState)
+		require.Equal(t, failedAttempts, status.FailedAttempts)
+	}
+	requireState(ConnectionStateNeverConnected, 0)
+
+	// failures before the first connection are not reconnects
+	mock.connectErr = fmt.Errorf("dial tcp: connection refused")
+	for attempt := 1; attempt <= reconnectAttemptsBeforeFailed; attempt++ {
+		manager.manage(ctx)
+		requireState(ConnectionStateNeverConnected, attempt)
+	}
+
+	mock.connectErr = nil
+	manager.manage(ctx)
+	requireState(ConnectionStateConnected, 0)
+
+	// the client reports the connection dropped before the next tick
+	require.NotNil(t, mock.connectionLost)
+	mock.connectionLost(fmt.Errorf("stream closed"))
+	requireState(ConnectionStateReconnecting, 0)
+
+	mock.pingErr = fmt.Errorf("ping timeout")
+	for attempt := 1; attempt < reconnectAttemptsBeforeFailed; attempt++ {
+		manager.manage(ctx)
+		requireState(ConnectionStateReconnecting, attempt)
+	}
+	manager.manage(ctx)
+	requireState(ConnectionStateFailed, reconnectAttemptsBeforeFailed)
+
+	// a lost connection callback does not hide the failure
+	mock.connectionLost(fmt.Errorf("stream closed"))
+	requireState(ConnectionStateFailed, reconnectAttemptsBeforeFailed)
+
+	// listing tools failing after reconnecting still counts as connected
+	mock.pingErr = nil
+	mock.tools = nil
+	mock.listToolsErr = fmt.Errorf("internal error")
+	manager.manage(ctx)
+	requireState(ConnectionStateConnected, 0)
+	require.False(t, manager.GetStatus().Ready)
+
+	// an unsupported protocol version is not a connection
+	mock.connectErr = fmt.Errorf("failed to initialize client: %w", mcp.UnsupportedProtocolVersionError{Version: "2021-11-05"})
+	manager.manage(ctx)
+	requireState(ConnectionStateReconnecting, 1)
+}
+
+func TestManageIdentityChange(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Behavior       string
+		ChangeName     bool
+		ChangeVersion  bool
+		ExpectFlushed  []string
+		ExpectToolName string
+	}{
+		{
+			Name:           "same identity",
+			Behavior:       IdentityChangeReregister,
+			ExpectToolName: "test_old_tool",
+		},
+		{
+			Name:           "name changed and logged",
+			Behavior:       IdentityChangeLog,
+			ChangeName:     true,
+			ExpectToolName: "test_old_tool",
+		},
+		{
+			Name:           "name changed and reregistered",
+			Behavior:       IdentityChangeReregister,
+			ChangeName:     true,
+			ExpectFlushed:  []string{"test-server"},
+			ExpectToolName: "test_new_tool",
+		},
+		{
+			Name:           "version changed and reregistered",
+			Behavior:       IdentityChangeReregister,
+			ChangeVersion:  true,
+			ExpectFlushed:  []string{"test-server"},
+			ExpectToolName: "test_new_tool",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			mock := newMockMCP("test-server", "test_")
+			mock.serverInfo = mcp.Implementation{Name: "weather", Version: "1.0.0"}
+			mock.tools = []mcp.Tool{{Name: "old_tool"}}
+			gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+			manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+			var flushed []string
+			manager.SetIdentityChangeBehavior(tc.Behavior, func(_ context.Context, serverName string) {
+				flushed = append(flushed, serverName)
+			})
+			ctx := context.Background()
+			manager.manage(ctx)
+			require.Contains(t, gatewayServer.ListTools(), "test_old_tool")
+
+			// another server is deployed behind the url and the connection is made again
+			if tc.ChangeName {
+				mock.serverInfo.Name = "calendar"
+			}
+			if tc.ChangeVersion {
+				mock.serverInfo.Version = "2.0.0"
+			}
+			mock.tools = []mcp.Tool{{Name: "new_tool"}}
+			require.NotNil(t, mock.connectionLost)
+			mock.connectionLost(fmt.Errorf("stream closed"))
+			manager.manage(ctx)
+
+			require.Equal(t, tc.ExpectFlushed, flushed)
+			tools := gatewayServer.ListTools()
+			require.Len(t, tools, 1)
+			require.Contains(t, tools, tc.ExpectToolName)
+
+			// the identity is only reacted to once
+			mock.connectionLost(fmt.Errorf("stream closed"))
+			manager.manage(ctx)
+			require.Equal(t, tc.ExpectFlushed, flushed)
+		})
+	}
+}
+
+func TestManageFallbackTools(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	mock := newMockMCP("test-server", "test_")
+	mock.cfg.FallbackTools = []config.FallbackTool{
+		{Name: "forecast", Description: "the forecast", InputSchema: `{"type":"object","properties":{"city":{"type":"string"}}}`},
+		{Name: "alerts"},
+	}
+	mock.tools = []mcp.Tool{{Name: "forecast", Description: "today's forecast"}, {Name: "radar"}}
+	mock.connectErr = fmt.Errorf("dial tcp: connection refused")
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	manager := NewUpstreamMCPManager(mock, gatewayServer, logger, 0)
+	ctx := context.Background()
+	requireTools := func(fallback bool, descriptions map[string]string) {
+		t.Helper()
+		tools := gatewayServer.ListTools()
+		require.Len(t, tools, len(descriptions))
+		for name, description := range descriptions {
+			require.Contains(t, tools, name)
+			require.Equal(t, description, tools[name].Tool.Description)
+			_, marked := tools[name].Tool.Meta.AdditionalFields[FallbackToolMetaKey]
+			require.Equal(t, fallback, marked)
+		}
+		require.Equal(t, fallback, manager.ServingFallbackTools())
+		require.Equal(t, fallback, manager.GetStatus().FallbackTools)
+	}
+
+	// the fallback tools are listed while the server has never been reached
+	manager.manage(ctx)
+	requireTools(true, map[string]string{"test_forecast": "the forecast", "test_alerts": ""})
+	require.False(t, manager.GetStatus().Ready)
+	upstreamName, ok := manager.UpstreamToolName("test_forecast")
+	require.True(t, ok)
+	require.Equal(t, "forecast", upstreamName)
+	result, err := gatewayServer.ListTools()["test_alerts"].Handler(ctx, mcp.CallToolRequest{})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+
+	// further failed health checks leave them in place
+	advertised := gatewayServer.ListTools()["test_forecast"]
+	manager.manage(ctx)
+	require.Same(t, advertised.Tool.Meta, gatewayServer.ListTools()["test_forecast"].Tool.Meta)
+
+	// the tools the server lists replace them once it is back
+	mock.connectErr = nil
+	manager.manage(ctx)
+	requireTools(false, map[string]string{"test_forecast": "today's forecast", "test_radar": ""})
+	require.True(t, manager.GetStatus().Ready)
+
+	// and they are listed again when the server goes down
+	mock.pingErr = fmt.Errorf("ping timeout")
+	manager.manage(ctx)
+	requireTools(true, map[string]string{"test_forecast": "the forecast", "test_alerts": ""})
+
+	manager.Stop()
+	require.Empty(t, gatewayServer.ListTools())
+}
+
+func TestManageStartupProbe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+	newManager := func() (*MCPManager, *MockMCP) {
+		mock := newMockMCP("test-server", "test_")
+		mock.cfg.StartupProbe = &config.StartupProbe{Period: time.Second, FailureThreshold: 5}
+		gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+		return NewUpstreamMCPManager(mock, gatewayServer, logger, time.Minute), mock
+	}
+
+	t.Run("slow start is not failed", func(t *testing.T) {
+		manager, mock := newManager()
+		require.Equal(t, time.Second, manager.healthCheckInterval())
+
+		// more failures than a reconnect allows are tolerated while the server starts
+		mock.connectErr = fmt.Errorf("dial tcp: connection refused")
+		for attempt := 1; attempt < 5; attempt++ {
+			manager.manage(ctx)
+			require.Equal(t, ConnectionStateNeverConnected, manager.GetStatus().ConnectionState)
+		}
+
+		mock.connectErr = nil
+		manager.manage(ctx)
+		require.Equal(t, ConnectionStateConnected, manager.GetStatus().ConnectionState)
+		require.Equal(t, time.Minute, manager.healthCheckInterval())
+
+		// once the server has been up the normal health check applies
+		mock.pingErr = fmt.Errorf("ping timeout")
+		for attempt := 1; attempt <= reconnectAttemptsBeforeFailed; attempt++ {
+			manager.manage(ctx)
+		}
+		require.Equal(t, ConnectionStateFailed, manager.GetStatus().ConnectionState)
+		require.Equal(t, time.Minute, manager.healthCheckInterval())
+	})
+
+	t.Run("server that does not start is failed", func(t *testing.T) {
+		manager, mock := newManager()
+		mock.connectErr = fmt.Errorf("dial tcp: connection refused")
+		for attempt := 1; attempt <= 5; attempt++ {
+			manager.manage(ctx)
+		}
+		status := manager.GetStatus()
+		require.Equal(t, ConnectionStateFailed, status.ConnectionState)
+		require.Equal(t, 5, status.FailedAttempts)
+		require.Equal(t, time.Minute, manager.healthCheckInterval())
+	})
+
+	t.Run("startup ping timeout", func(t *testing.T) {
+		defer func(timeout time.Duration) { pingTimeout = timeout }(pingTimeout)
+		pingTimeout = 10 * time.Millisecond
+		manager, mock := newManager()
+		mock.cfg.StartupProbe.Timeout = 200 * time.Millisecond
+		mock.pingBlocks = true
+
+		start := time.Now()
+		manager.manage(ctx)
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+		require.Equal(t, ConnectionStateNeverConnected, manager.GetStatus().ConnectionState)
+	})
+}
+
+func TestFindRenameConflicts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	upstream := NewUpstreamMCP(&config.MCPServer{
+		Name:        "upstream",
+		ToolPrefix:  "test_",
+		ToolRenames: []config.ToolRename{{Match: "_v[0-9]+$", Replace: ""}},
+	})
+	manager := NewUpstreamMCPManager(upstream, nil, logger, 0)
+	assert.Equal(t, "test_search", manager.GatewayToolName("search_v2"))
+
+	assert.NoError(t, manager.findRenameConflicts([]mcp.Tool{{Name: "search_v2"}, {Name: "fetch_v1"}}))
+	err := manager.findRenameConflicts([]mcp.Tool{{Name: "search_v1"}, {Name: "search_v2"}, {Name: "fetch_v1"}})
+	assert.ErrorContains(t, err, "search_v1 and search_v2 renamed to test_search")
+
+	upstream = NewUpstreamMCP(&config.MCPServer{
+		Name:                "upstream",
+		ToolPrefix:          "test",
+		ToolPrefixAliases:   []string{"t"},
+		ToolPrefixSeparator: "__",
+		ToolRenames:         []config.ToolRename{{Match: "^fixed__", Replace: "fixed_"}},
+	})
+	manager = NewUpstreamMCPManager(upstream, nil, logger, 0)
+	assert.Equal(t, []string{"test__search", "t__search"}, manager.GatewayToolNames("search"))
+	assert.NoError(t, manager.findRenameConflicts([]mcp.Tool{{Name: "search"}, {Name: "fixed__list"}}), "renames may remove the separator")
+	err = manager.findRenameConflicts([]mcp.Tool{{Name: "search"}, {Name: "list__all"}})
+	assert.ErrorContains(t, err, `tool names [list__all] contain the tool prefix separator "__"`)
+}
+
+// gatewayWithServers returns a gateway server with the tools of the given number of servers registered, each with
+// toolsPerServer tools
+func gatewayWithServers(servers, toolsPerServer int) *server.MCPServer {
+	logger := slog.New(slog.DiscardHandler)
+	gateway := server.NewMCPServer("gateway", "0.0.1")
+	for i := range servers {
+		mock := newMockMCP(fmt.Sprintf("server-%d", i), fmt.Sprintf("s%d_", i))
+		manager := NewUpstreamMCPManager(mock, gateway, logger, 0)
+		for j := range toolsPerServer {
+			gateway.AddTools(manager.toolToServerTools(mcp.Tool{Name: fmt.Sprintf("tool_%d", j)})...)
+		}
+	}
+	return gateway
+}
+
+func TestFindToolConflicts(t *testing.T) {
+	gateway := gatewayWithServers(3, 5)
+	logger := slog.New(slog.DiscardHandler)
+
+	// a server registered again with the same id does not conflict with its own tools
+	manager := NewUpstreamMCPManager(newMockMCP("server-1", "s1_"), gateway, logger, 0)
+	assert.NoError(t, manager.findToolConflicts(context.Background(), manager.toolToServerTools(mcp.Tool{Name: "tool_1"})))
+
+	// another server using the same prefix does
+	manager = NewUpstreamMCPManager(newMockMCP("other", "s1_"), gateway, logger, 0)
+	assert.NoError(t, manager.findToolConflicts(context.Background(), manager.toolToServerTools(mcp.Tool{Name: "tool_new"})))
+	err := manager.findToolConflicts(context.Background(), manager.toolToServerTools(mcp.Tool{Name: "tool_1"}))
+	assert.ErrorContains(t, err, "server-1:s1_:http://mock/mcp")
+}
+
+// toolOwnerStore is a ToolOwnerStore that outlives the managers using it, as the shared session cache does
+type toolOwnerStore struct {
+	lock   sync.Mutex
+	owners map[string]string
+}
+
+func (s *toolOwnerStore) ToolOwners(_ context.Context) (map[string]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return maps.Clone(s.owners), nil
+}
+
+func (s *toolOwnerStore) ClaimToolOwner(_ context.Context, toolName, serverName string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if owner, ok := s.owners[toolName]; ok {
+		return owner, nil
+	}
+	s.owners[toolName] = serverName
+	return serverName, nil
+}
+
+func (s *toolOwnerStore) ReleaseToolOwner(_ context.Context, toolName, serverName string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.owners[toolName] == serverName {
+		delete(s.owners, toolName)
+	}
+	return nil
+}
+
+func TestToolOwnersSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	store := &toolOwnerStore{owners: map[string]string{}}
+	configured := map[string]bool{"server-a": true, "server-b": true}
+
+	// register starts a gateway and registers the servers with it in order, as a broker starting up does. Every
+	// server shares the s_ prefix and lists the tools given for it
+	register := func(servers []string, tools map[string][]string) (*server.MCPServer, map[string]*MCPManager) {
+		gateway := server.NewMCPServer("gateway", "0.0.1")
+		managers := map[string]*MCPManager{}
+		for _, name := range servers {
+			mock := newMockMCP(name, "s_")
+			mock.tools = nil
+			for _, tool := range tools[name] {
+				mock.tools = append(mock.tools, mcp.Tool{Name: tool})
+			}
+			manager := NewUpstreamMCPManager(mock, gateway, logger, 0)
+			manager.SetToolOwners(store, func(serverName string) bool { return configured[serverName] })
+			manager.manage(ctx)
+			managers[name] = manager
+		}
+		return gateway, managers
+	}
+	toolServer := func(gateway *server.MCPServer, name string) string {
+		tool := gateway.GetTool(name)
+		require.NotNil(t, tool)
+		id, ok := tool.Tool.Meta.AdditionalFields["id"].(string)
+		require.True(t, ok)
+		return id
+	}
+	tools := map[string][]string{"server-a": {"search"}, "server-b": {"search", "fetch"}}
+
+	gateway, managers := register([]string{"server-a", "server-b"}, tools)
+	require.True(t, managers["server-a"].GetStatus().Ready)
+	require.False(t, managers["server-b"].GetStatus().Ready)
+	require.Equal(t, string(managers["server-a"].MCP.ID()), toolServer(gateway, "s_search"))
+
+	// after a restart the owner keeps the name although the other server is registered first
+	gateway, managers = register([]string{"server-b", "server-a"}, tools)
+	require.False(t, managers["server-b"].GetStatus().Ready)
+	require.Contains(t, managers["server-b"].GetStatus().Message, "server-a")
+	require.True(t, managers["server-a"].GetStatus().Ready)
+	require.Equal(t, string(managers["server-a"].MCP.ID()), toolServer(gateway, "s_search"))
+	require.Nil(t, gateway.GetTool("s_fetch"), "none of the tools of a server with a conflict are registered")
+
+	// a name the owner no longer lists is released
+	_, managers = register([]string{"server-a", "server-b"}, map[string][]string{"server-a": {"list"}, "server-b": tools["server-b"]})
+	require.True(t, managers["server-b"].GetStatus().Ready)
+	owners, err := store.ToolOwners(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"s_list": "server-a", "s_search": "server-b", "s_fetch": "server-b"}, owners)
+
+	// names owned by a server that is no longer configured are taken over
+	configured["server-b"] = false
+	gateway, managers = register([]string{"server-a"}, tools)
+	require.True(t, managers["server-a"].GetStatus().Ready)
+	require.Equal(t, string(managers["server-a"].MCP.ID()), toolServer(gateway, "s_search"))
+}
+
+// BenchmarkFindToolConflicts measures checking the tools of a server being added against a gateway that already
+// federates many servers
+func BenchmarkFindToolConflicts(b *testing.B) {
+	for _, servers := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("%d servers", servers), func(b *testing.B) {
+			gateway := gatewayWithServers(servers, 20)
+			manager := NewUpstreamMCPManager(newMockMCP("new", "new_"), gateway, slog.New(slog.DiscardHandler), 0)
+			var tools []server.ServerTool
+			for j := range 20 {
+				tools = append(tools, manager.toolToServerTools(mcp.Tool{Name: fmt.Sprintf("tool_%d", j)})...)
+			}
+			b.ResetTimer()
+			for range b.N {
+				if err := manager.findToolConflicts(context.Background(), tools); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestManagerStartStopDoesNotLeakGoroutines(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(true))
+	upstreamServer.AddTool(mcp.NewTool("tool1"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	mcpHandler := server.NewStreamableHTTPServer(upstreamServer)
+	// slow the upstream down so some stops land while the initial connection is still in flight
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cycle := func(waitForReady bool) {
+		gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+		manager := NewUpstreamMCPManager(NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: srv.URL + "/mcp"}), gatewayServer, logger, 0)
+		started := make(chan struct{})
+		go func() {
+			close(started)
+			manager.Start(context.Background())
+		}()
+		<-started
+		if waitForReady {
+			require.Eventually(t, func() bool { return manager.GetStatus().Ready }, 5*time.Second, 10*time.Millisecond)
+		}
+		manager.Stop()
+		require.Empty(t, gatewayServer.ListTools())
+	}
+
+	baseline := runtime.NumGoroutine()
+	for i := range 20 {
+		// stop while the initial connection may still be in flight as well as after tools are registered
+		cycle(i%2 == 0)
+	}
+	// idle keep-alive connections are not owned by the manager so close them before counting
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	srv.CloseClientConnections()
+	require.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= baseline+2
+	}, 5*time.Second, 50*time.Millisecond, "goroutines grew from %d to %d", baseline, runtime.NumGoroutine())
+}
+
+func TestManagerPollsToolsWithoutListChanged(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	// the upstream advertises tools but not list changed so it never notifies the manager of new tools
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	handler := func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	}
+	upstreamServer.AddTool(mcp.NewTool("tool1"), handler)
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer srv.Close()
+
+	gatewayServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	// the health check is too slow to pick up the change within the test so only the poll can
+	manager := NewUpstreamMCPManager(NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: srv.URL + "/mcp"}), gatewayServer, logger, time.Hour)
+	manager.SetToolPollInterval(20 * time.Millisecond)
+	go manager.Start(context.Background())
+	defer manager.Stop()
+
+	require.Eventually(t, func() bool { return manager.GetStatus().Ready }, 5*time.Second, 10*time.Millisecond)
+	status := manager.GetStatus()
+	require.True(t, status.ToolsPolling)
+	require.Contains(t, status.Message, "tools are polled")
+	require.Len(t, gatewayServer.ListTools(), 1)
+
+	upstreamServer.AddTool(mcp.NewTool("tool2"), handler)
+	require.Eventually(t, func() bool { return len(gatewayServer.ListTools()) == 2 }, 5*time.Second, 10*time.Millisecond)
+}
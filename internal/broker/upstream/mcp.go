@@ -2,7 +2,13 @@ package upstream
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/config"
 	"github.com/mark3labs/mcp-go/client"
@@ -10,6 +16,13 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// DefaultInitializeAttempts is the number of times initialize is sent to the upstream before connecting fails
+const DefaultInitializeAttempts = 3
+
+// initializeRetryInterval is the wait between initialize attempts. It is short as it only covers momentary
+// unavailability, longer outages are retried by the manager on its next tick
+var initializeRetryInterval = 500 * time.Millisecond
+
 // MCPServer represents a connection to an upstream MCP server. It wraps the
 // configuration and client, managing the connection lifecycle and storing
 // initialization state from the MCP handshake.
@@ -18,21 +31,37 @@ type MCPServer struct {
 	*client.Client
 	headers map[string]string
 	init    *mcp.InitializeResult
+	// toolRenames are compiled once as they are applied to every tool listed
+	toolRenames []config.CompiledToolRename
+	// InitializeAttempts is the number of times initialize is sent before Connect fails. Values below 1 send it once
+	InitializeAttempts int
+	// ListenerBackoff controls how the stream the upstream sends notifications on is reopened when it drops
+	ListenerBackoff ListenerBackoff
+	// the handlers are registered for each connection and passed to its notification listener
+	notificationHandlers   []func(notification mcp.JSONRPCNotification)
+	connectionLostHandlers []func(err error)
+	reconnectedHandlers    []func()
+	// stopListening stops the notification listener of the connection
+	stopListening context.CancelFunc
 }
 
 // NewUpstreamMCP creates a new MCPServer instance from the provided configuration.
 // It sets up default headers including user-agent and gateway-server-id, and adds
-// an Authorization header if credentials are configured.
+// the credential header if a credential is configured to be sent in a header.
+// Tool renames with an invalid expression are reported when the config is loaded and are ignored here.
 func NewUpstreamMCP(config *config.MCPServer) *MCPServer {
 	up := &MCPServer{
-		MCPServer: config,
+		MCPServer:          config,
+		InitializeAttempts: DefaultInitializeAttempts,
+		ListenerBackoff:    DefaultListenerBackoff,
 	}
+	up.toolRenames, _ = config.CompileToolRenames()
 	up.headers = map[string]string{
 		"user-agent":        "mcp-broker",
 		"gateway-server-id": string(up.ID()),
 	}
-	if up.Credential != "" {
-		up.headers["Authorization"] = up.Credential
+	for name, value := range up.CredentialHeaders() {
+		up.headers[name] = value
 	}
 	return up
 }
@@ -41,12 +70,21 @@ func NewUpstreamMCP(config *config.MCPServer) *MCPServer {
 func (up *MCPServer) GetConfig() config.MCPServer {
 	// return a copy rather than the original
 	return config.MCPServer{
-		Name:       up.Name,
-		URL:        up.URL,
-		ToolPrefix: up.ToolPrefix,
-		Enabled:    up.Enabled,
-		Hostname:   up.Hostname,
-		Credential: up.Credential,
+		Name:                  up.Name,
+		URL:                   up.URL,
+		ToolPrefix:            up.ToolPrefix,
+		ToolPrefixAliases:     up.ToolPrefixAliases,
+		ToolPrefixSeparator:   up.ToolPrefixSeparator,
+		Enabled:               up.Enabled,
+		Hostname:              up.Hostname,
+		Credential:            up.Credential,
+		TLS:                   up.TLS,
+		CredentialLocation:    up.CredentialLocation,
+		AdditionalCredentials: up.AdditionalCredentials,
+		ToolRenames:           up.ToolRenames,
+		ReadOnly:              up.ReadOnly,
+		FallbackTools:         up.FallbackTools,
+		SyntheticTools:        up.SyntheticTools,
 	}
 }
 
@@ -60,6 +98,22 @@ func (up *MCPServer) GetPrefix() string {
 	return up.ToolPrefix
 }
 
+// ToolName returns the name the upstream tool is advertised as by the gateway. The tool renames are applied and then the prefix is added
+func (up *MCPServer) ToolName(upstreamName string) string {
+	return prefixedName(up.ToolNamePrefixes()[0], config.RenameTool(up.toolRenames, upstreamName))
+}
+
+// ToolNames returns every name the upstream tool is advertised as by the gateway. The first is the name with the
+// prefix followed by a name for each of the prefix aliases
+func (up *MCPServer) ToolNames(upstreamName string) []string {
+	renamed := config.RenameTool(up.toolRenames, upstreamName)
+	names := make([]string, 0, 1+len(up.ToolPrefixAliases))
+	for _, prefix := range up.ToolNamePrefixes() {
+		names = append(names, prefixedName(prefix, renamed))
+	}
+	return names
+}
+
 // GetName returns the name of the MCP Server
 func (up *MCPServer) GetName() string {
 	return up.Name
@@ -67,15 +121,49 @@ func (up *MCPServer) GetName() string {
 
 // SupportsToolsListChanged validates the mcp server supports tools/list_changed notifications
 func (up *MCPServer) SupportsToolsListChanged() bool {
-	if up.init == nil {
+	if up.init == nil || up.init.Capabilities.Tools == nil {
 		return false
 	}
 	return up.init.Capabilities.Tools.ListChanged
 }
 
+// SupportsResources validates the mcp server advertises the resources capability
+func (up *MCPServer) SupportsResources() bool {
+	return up.init != nil && up.init.Capabilities.Resources != nil
+}
+
+// SupportsResourceSubscribe validates the mcp server supports resources/subscribe
+func (up *MCPServer) SupportsResourceSubscribe() bool {
+	if up.init == nil || up.init.Capabilities.Resources == nil {
+		return false
+	}
+	return up.init.Capabilities.Resources.Subscribe
+}
+
+// SubscribeResource asks the mcp server to send notifications/resources/updated when the resource changes
+func (up *MCPServer) SubscribeResource(ctx context.Context, uri string) error {
+	if up.Client == nil {
+		return fmt.Errorf("not connected to upstream %s", up.ID())
+	}
+	req := mcp.SubscribeRequest{}
+	req.Params.URI = uri
+	return up.Subscribe(ctx, req)
+}
+
+// UnsubscribeResource asks the mcp server to stop sending notifications/resources/updated for the resource
+func (up *MCPServer) UnsubscribeResource(ctx context.Context, uri string) error {
+	if up.Client == nil {
+		return fmt.Errorf("not connected to upstream %s", up.ID())
+	}
+	req := mcp.UnsubscribeRequest{}
+	req.Params.URI = uri
+	return up.Unsubscribe(ctx, req)
+}
+
 // Connect establishes a connection to the upstream MCP server. It creates a
-// streamable HTTP client, starts it for continuous listening, and performs
-// the MCP initialization handshake. If already connected, this is a no-op.
+// streamable HTTP client and performs the MCP initialization handshake using InitializeSession.
+// Once initialized a notification listener keeps a stream open for the notifications the upstream sends outside
+// of requests. It stops when ctx is cancelled or the server is disconnected. If already connected, this is a no-op.
 // The initialization result is stored for later validation of protocol version
 // and capabilities.
 func (up *MCPServer) Connect(ctx context.Context, onConnection func()) error {
@@ -84,51 +172,125 @@ func (up *MCPServer) Connect(ctx context.Context, onConnection func()) error {
 		return nil
 	}
 	options := []transport.StreamableHTTPCOption{
-		transport.WithContinuousListening(),
 		transport.WithHTTPHeaders(up.headers),
 	}
+	httpClient := http.DefaultClient
+	if up.TLS != nil {
+		tlsClient, err := newTLSHTTPClient(up.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to configure tls for upstream %s : %w", up.ID(), err)
+		}
+		httpClient = tlsClient
+		options = append(options, transport.WithHTTPBasicClient(tlsClient))
+	}
 
-	httpClient, err := client.NewStreamableHttpClient(up.URL, options...)
+	mcpURL, err := up.WithCredentialQuery(up.URL)
+	if err != nil {
+		return fmt.Errorf("failed to add credential to url for upstream %s : %w", up.ID(), err)
+	}
+	trans, err := transport.NewStreamableHTTP(mcpURL, options...)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
-	up.Client = httpClient
+	// the handshake is done by InitializeSession so the client is created as already initialized
+	mcpClient := client.NewClient(trans, client.WithSession())
+	up.Client = mcpClient
+	up.notificationHandlers, up.connectionLostHandlers, up.reconnectedHandlers = nil, nil, nil
 	// call on connection to register handlers etc
 	onConnection()
 
-	// Start the client before initialize to listen for notifications
-	err = httpClient.Start(ctx)
+	// Start the client before initialize to receive notifications sent with responses
+	err = mcpClient.Start(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start streamable client: %w", err)
 	}
-	initResp, err := httpClient.Initialize(ctx, mcp.InitializeRequest{
-		Params: mcp.InitializeParams{
-			ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
-			Capabilities: mcp.ClientCapabilities{
-				Roots: &struct {
-					ListChanged bool `json:"listChanged,omitempty"`
-				}{
-					ListChanged: true,
-				},
-			},
-			ClientInfo: mcp.Implementation{
-				Name:    "mcp-broker",
-				Version: "0.0.1",
+	initResp, err := up.initialize(ctx, trans, mcp.InitializeParams{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		Capabilities: mcp.ClientCapabilities{
+			Roots: &struct {
+				ListChanged bool `json:"listChanged,omitempty"`
+			}{
+				ListChanged: true,
 			},
 		},
+		ClientInfo: mcp.Implementation{
+			Name:    "mcp-broker",
+			Version: "0.0.1",
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize client for upstream %s : %w", up.ID(), err)
 	}
 	// whenever we do an init store the response and session id for validation a future use
 	up.init = initResp
+	up.listen(ctx, mcpURL, httpClient, trans.GetSessionId(), initResp.ProtocolVersion)
 
 	return nil
 }
 
+// listen starts the notification listener of the connection with the handlers registered for it
+func (up *MCPServer) listen(ctx context.Context, mcpURL string, httpClient *http.Client, sessionID, protocolVersion string) {
+	ctx, cancel := context.WithCancel(ctx)
+	up.stopListening = cancel
+	notificationHandlers, connectionLostHandlers, reconnectedHandlers := up.notificationHandlers, up.connectionLostHandlers, up.reconnectedHandlers
+	listener := &notificationListener{
+		url:        mcpURL,
+		httpClient: httpClient,
+		headers: func() http.Header {
+			headers := http.Header{}
+			for name, value := range up.headers {
+				headers.Set(name, value)
+			}
+			headers.Set("Mcp-Session-Id", sessionID)
+			headers.Set("Mcp-Protocol-Version", protocolVersion)
+			return headers
+		},
+		backoff: up.ListenerBackoff,
+		logger:  slog.Default().With("upstream", up.ID()),
+		notify: func(notification mcp.JSONRPCNotification) {
+			for _, handler := range notificationHandlers {
+				handler(notification)
+			}
+		},
+		reconnected: func() {
+			for _, handler := range reconnectedHandlers {
+				handler()
+			}
+		},
+		lost: func(err error) {
+			for _, handler := range connectionLostHandlers {
+				handler(err)
+			}
+		},
+	}
+	go listener.listen(ctx)
+}
+
+// initialize sends initialize to the upstream until it succeeds or InitializeAttempts is reached so an upstream
+// that is momentarily unavailable, such as one responding 503 while it starts, does not wait for the next tick.
+// An unsupported protocol version is not retried
+func (up *MCPServer) initialize(ctx context.Context, trans transport.Interface, params mcp.InitializeParams) (*mcp.InitializeResult, error) {
+	for attempt := 1; ; attempt++ {
+		initResp, err := InitializeSession(ctx, trans, params)
+		if err == nil || attempt >= up.InitializeAttempts || errors.Is(err, mcp.UnsupportedProtocolVersionError{}) {
+			return initResp, err
+		}
+		slog.Debug("initialize failed, retrying", "upstream", up.ID(), "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(initializeRetryInterval):
+		}
+	}
+}
+
 // Disconnect closes the connection to the upstream MCP server. If no client
 // connection exists, this is a no-op and returns nil. It will unset the the client if it exists
 func (up *MCPServer) Disconnect() error {
+	if up.stopListening != nil {
+		up.stopListening()
+		up.stopListening = nil
+	}
 	if up.Client != nil {
 		if err := up.Close(); err != nil {
 			up.Client = nil
@@ -139,16 +301,63 @@ func (up *MCPServer) Disconnect() error {
 	return nil
 }
 
-// OnNotification allows registering a notification handler func with the client
+// OnNotification allows registering a notification handler func with the client. It receives the notifications
+// sent with responses and on the notification stream. Handlers are registered for each connection
 func (up *MCPServer) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
 	if up.Client != nil {
 		up.Client.OnNotification(handler)
+		up.notificationHandlers = append(up.notificationHandlers, handler)
 	}
 }
 
-// OnConnectionLost allows registering a connection lost handler with the client
+// OnConnectionLost allows registering a connection lost handler with the client. It is also called when the
+// notification stream cannot be reopened
 func (up *MCPServer) OnConnectionLost(handler func(err error)) {
 	if up.Client != nil {
 		up.Client.OnConnectionLost(handler)
+		up.connectionLostHandlers = append(up.connectionLostHandlers, handler)
+	}
+}
+
+// OnListenerReconnected allows registering a handler called when the notification stream is reopened after it
+// dropped. Notifications sent while it was down are lost
+func (up *MCPServer) OnListenerReconnected(handler func()) {
+	if up.Client != nil {
+		up.reconnectedHandlers = append(up.reconnectedHandlers, handler)
 	}
 }
+
+// newTLSHTTPClient returns an http client that verifies the upstream using the configured CA and server name. With a
+// host configured requests are sent with it as their Host header
+func newTLSHTTPClient(conf *config.TLSConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: conf.ServerName,
+	}
+	if conf.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(conf.CACert)) {
+			return nil, fmt.Errorf("no valid certificates found in CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if conf.Host != "" {
+		return &http.Client{Transport: &hostTransport{host: conf.Host, next: transport}}, nil
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// hostTransport sends requests with its host as their Host header rather than the host of their URL
+type hostTransport struct {
+	host string
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = t.host
+	return t.next.RoundTrip(req)
+}
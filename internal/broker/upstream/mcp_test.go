@@ -0,0 +1,313 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectCredentialLocation(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Location    string
+		Additional  []config.AdditionalCredential
+		ExpectCheck func(t *testing.T, r *http.Request)
+	}{
+		{
+			Name: "default authorization header",
+			ExpectCheck: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "1234", r.Header.Get("Authorization"))
+			},
+		},
+		{
+			Name:     "bearer",
+			Location: config.CredentialLocationBearer,
+			ExpectCheck: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "Bearer 1234", r.Header.Get("Authorization"))
+			},
+		},
+		{
+			Name:     "named header",
+			Location: "header:X-Api-Key",
+			ExpectCheck: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "1234", r.Header.Get("X-Api-Key"))
+				require.Empty(t, r.Header.Get("Authorization"))
+			},
+		},
+		{
+			Name:     "query parameter",
+			Location: "query:api_key",
+			ExpectCheck: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "1234", r.URL.Query().Get("api_key"))
+				require.Empty(t, r.Header.Get("Authorization"))
+			},
+		},
+		{
+			Name:     "additional credentials",
+			Location: "header:X-Api-Key",
+			Additional: []config.AdditionalCredential{
+				{Value: "5678", Location: "header:X-Api-Secret"},
+				{Value: "acme", Location: "query:tenant"},
+			},
+			ExpectCheck: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "1234", r.Header.Get("X-Api-Key"))
+				require.Equal(t, "5678", r.Header.Get("X-Api-Secret"))
+				require.Equal(t, "acme", r.URL.Query().Get("tenant"))
+				require.Empty(t, r.Header.Get("Authorization"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mcpHandler := server.NewStreamableHTTPServer(server.NewMCPServer("upstream", "0.0.1"))
+			var lock sync.Mutex
+			var requests []*http.Request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				requests = append(requests, r.Clone(context.Background()))
+				lock.Unlock()
+				mcpHandler.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			up := NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: srv.URL + "/mcp", Credential: "1234", CredentialLocation: tc.Location, AdditionalCredentials: tc.Additional})
+			require.NoError(t, up.Connect(context.Background(), func() {}))
+			defer func() { _ = up.Disconnect() }()
+
+			lock.Lock()
+			defer lock.Unlock()
+			require.NotEmpty(t, requests)
+			for _, r := range requests {
+				tc.ExpectCheck(t, r)
+			}
+		})
+	}
+}
+
+func TestConnectTLSServerName(t *testing.T) {
+	mcpHandler := server.NewStreamableHTTPServer(server.NewMCPServer("upstream", "0.0.1"))
+	var lock sync.Mutex
+	var serverNames, hosts []string
+	// the test certificate is for example.com and 127.0.0.1, not localhost the upstream is reached by
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hosts = append(hosts, r.Host)
+		lock.Unlock()
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		lock.Lock()
+		serverNames = append(serverNames, hello.ServerName)
+		lock.Unlock()
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	mcpURL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/mcp"
+
+	testCases := []struct {
+		Name        string
+		TLS         *config.TLSConfig
+		ExpectError bool
+		ExpectSNI   string
+		ExpectHost  string
+	}{
+		{
+			Name:        "certificate not for the url's host",
+			TLS:         &config.TLSConfig{CACert: caCert},
+			ExpectError: true,
+		},
+		{
+			Name:       "server name verifies the certificate",
+			TLS:        &config.TLSConfig{CACert: caCert, ServerName: "example.com"},
+			ExpectSNI:  "example.com",
+			ExpectHost: strings.TrimPrefix(strings.TrimSuffix(mcpURL, "/mcp"), "https://"),
+		},
+		{
+			Name:       "host is sent with the server name",
+			TLS:        &config.TLSConfig{CACert: caCert, ServerName: "example.com", Host: "example.com"},
+			ExpectSNI:  "example.com",
+			ExpectHost: "example.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			lock.Lock()
+			serverNames, hosts = nil, nil
+			lock.Unlock()
+			up := NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: mcpURL, TLS: tc.TLS})
+			up.InitializeAttempts = 1
+			err := up.Connect(context.Background(), func() {})
+			if tc.ExpectError {
+				require.ErrorContains(t, err, "certificate")
+				return
+			}
+			require.NoError(t, err)
+			defer func() { _ = up.Disconnect() }()
+
+			lock.Lock()
+			defer lock.Unlock()
+			require.NotEmpty(t, serverNames)
+			for _, serverName := range serverNames {
+				require.Equal(t, tc.ExpectSNI, serverName)
+			}
+			require.NotEmpty(t, hosts)
+			for _, host := range hosts {
+				require.Equal(t, tc.ExpectHost, host)
+			}
+		})
+	}
+}
+
+func TestConnectRetriesInitialize(t *testing.T) {
+	initializeRetryInterval = time.Millisecond
+	defer func() { initializeRetryInterval = 500 * time.Millisecond }()
+
+	testCases := []struct {
+		Name              string
+		Attempts          int
+		ExpectErr         bool
+		ExpectInitializes int
+	}{
+		{Name: "transient failure is retried", Attempts: 3, ExpectInitializes: 2},
+		{Name: "retries disabled", Attempts: 1, ExpectErr: true, ExpectInitializes: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mcpHandler := server.NewStreamableHTTPServer(server.NewMCPServer("upstream", "0.0.1"))
+			var lock sync.Mutex
+			initializes := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// initialize is the only request sent before the upstream assigns a session
+				if r.Method == http.MethodPost && r.Header.Get("Mcp-Session-Id") == "" {
+					lock.Lock()
+					initializes++
+					first := initializes == 1
+					lock.Unlock()
+					if first {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+				}
+				mcpHandler.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			up := NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: srv.URL + "/mcp"})
+			up.InitializeAttempts = tc.Attempts
+			err := up.Connect(context.Background(), func() {})
+			defer func() { _ = up.Disconnect() }()
+			if tc.ExpectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, up.ProtocolInfo())
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			require.Equal(t, tc.ExpectInitializes, initializes)
+		})
+	}
+}
+
+func TestNotificationListenerReconnects(t *testing.T) {
+	mcpServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(true))
+	mcpHandler := server.NewStreamableHTTPServer(mcpServer)
+	var lock sync.Mutex
+	streams := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			lock.Lock()
+			streams++
+			first := streams == 1
+			lock.Unlock()
+			if first {
+				// drop the first notification stream shortly after it opens
+				ctx, cancel := context.WithTimeout(r.Context(), 50*time.Millisecond)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+		}
+		mcpHandler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	up := NewUpstreamMCP(&config.MCPServer{Name: "upstream", URL: srv.URL + "/mcp"})
+	up.ListenerBackoff = ListenerBackoff{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, MaxAttempts: 5}
+	reconnected := make(chan struct{}, 1)
+	toolsChanged := make(chan struct{}, 1)
+	require.NoError(t, up.Connect(context.Background(), func() {
+		up.OnNotification(func(notification mcp.JSONRPCNotification) {
+			if notification.Method == notificationToolsListChanged {
+				select {
+				case toolsChanged <- struct{}{}:
+				default:
+				}
+			}
+		})
+		up.OnListenerReconnected(func() {
+			select {
+			case reconnected <- struct{}{}:
+			default:
+			}
+		})
+	}))
+	defer func() { _ = up.Disconnect() }()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification stream was not reopened")
+	}
+	// the upstream registers the session of the stream after responding so keep changing tools until one is received
+	require.Eventually(t, func() bool {
+		mcpServer.AddTool(mcp.NewTool(fmt.Sprintf("tool-%d", time.Now().UnixNano())), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+		select {
+		case <-toolsChanged:
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, 2, streams)
+}
+
+func TestListenerBackoffDelay(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Backoff     ListenerBackoff
+		Attempt     int
+		ExpectDelay time.Duration
+	}{
+		{Name: "first attempt waits the initial delay", Backoff: ListenerBackoff{InitialDelay: time.Second, MaxDelay: time.Minute}, Attempt: 1, ExpectDelay: time.Second},
+		{Name: "delay doubles with each attempt", Backoff: ListenerBackoff{InitialDelay: time.Second, MaxDelay: time.Minute}, Attempt: 4, ExpectDelay: 8 * time.Second},
+		{Name: "delay is capped", Backoff: ListenerBackoff{InitialDelay: time.Second, MaxDelay: 5 * time.Second}, Attempt: 10, ExpectDelay: 5 * time.Second},
+		{Name: "max delay below initial delay", Backoff: ListenerBackoff{InitialDelay: time.Second, MaxDelay: time.Millisecond}, Attempt: 3, ExpectDelay: time.Second},
+		{Name: "unset initial delay uses the default", Backoff: ListenerBackoff{MaxDelay: time.Minute}, Attempt: 1, ExpectDelay: DefaultListenerBackoff.InitialDelay},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.ExpectDelay, tc.Backoff.delay(tc.Attempt))
+		})
+	}
+}
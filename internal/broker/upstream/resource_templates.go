@@ -0,0 +1,84 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/yosida95/uritemplate/v3"
+)
+
+// syncResourceTemplates lists the resource templates of an upstream that advertises the resources capability. A
+// server may support templates without concrete resources or the other way around, so a server that does not
+// implement resources/templates/list has no templates rather than a failed status. A failure to list keeps the
+// templates from the last successful list
+func (man *MCPManager) syncResourceTemplates(ctx context.Context) {
+	if !man.MCP.SupportsResources() {
+		man.setResourceTemplates(nil)
+		return
+	}
+	res, err := man.MCP.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+	if errors.Is(err, mcp.ErrMethodNotFound) {
+		man.logger.Debug("upstream does not support resource templates", "upstream mcp server", man.MCP.ID())
+		man.setResourceTemplates(nil)
+		return
+	}
+	if err != nil {
+		man.logger.Error("failed to list resource templates", "upstream mcp server", man.MCP.ID(), "error", err)
+		return
+	}
+	templates := make([]mcp.ResourceTemplate, 0, len(res.ResourceTemplates))
+	for _, template := range res.ResourceTemplates {
+		gateway, err := man.gatewayResourceTemplate(template)
+		if err != nil {
+			man.logger.Error("skipping resource template", "upstream mcp server", man.MCP.ID(), "template", template.Name, "error", err)
+			continue
+		}
+		templates = append(templates, gateway)
+	}
+	man.setResourceTemplates(templates)
+}
+
+func (man *MCPManager) setResourceTemplates(templates []mcp.ResourceTemplate) {
+	man.toolsLock.Lock()
+	defer man.toolsLock.Unlock()
+	man.resourceTemplates = templates
+}
+
+// gatewayResourceTemplate returns the template as it is advertised by the gateway. The tool prefix is added to the
+// front of the uri template so resources read through the gateway are routed to the server the same way tools are
+func (man *MCPManager) gatewayResourceTemplate(template mcp.ResourceTemplate) (mcp.ResourceTemplate, error) {
+	if template.URITemplate == nil || template.URITemplate.Template == nil {
+		return mcp.ResourceTemplate{}, fmt.Errorf("no uri template set")
+	}
+	uriTemplate, err := uritemplate.New(man.MCP.GetPrefix() + template.URITemplate.Raw())
+	if err != nil {
+		return mcp.ResourceTemplate{}, fmt.Errorf("invalid uri template with prefix: %w", err)
+	}
+	template.URITemplate = &mcp.URITemplate{Template: uriTemplate}
+	return template, nil
+}
+
+// ResourceTemplates returns the upstream's resource templates as they are advertised by the gateway
+func (man *MCPManager) ResourceTemplates() []mcp.ResourceTemplate {
+	man.toolsLock.RLock()
+	defer man.toolsLock.RUnlock()
+	templates := make([]mcp.ResourceTemplate, len(man.resourceTemplates))
+	copy(templates, man.resourceTemplates)
+	return templates
+}
+
+// UpstreamResourceURI returns the uri to read from the upstream for a uri that matches one of the resource
+// templates advertised by the gateway. ok is false if no template of this server matches
+func (man *MCPManager) UpstreamResourceURI(uri string) (string, bool) {
+	man.toolsLock.RLock()
+	defer man.toolsLock.RUnlock()
+	for _, template := range man.resourceTemplates {
+		if template.URITemplate.Regexp().MatchString(uri) {
+			return strings.TrimPrefix(uri, man.MCP.GetPrefix()), true
+		}
+	}
+	return "", false
+}
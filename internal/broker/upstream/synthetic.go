@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolServer is implemented by upstreams whose tool calls are answered by the broker rather than routed to a server
+type ToolServer interface {
+	// ServeToolCall answers a call to the tool with the upstream name
+	ServeToolCall(ctx context.Context, upstreamName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
+// errSyntheticNotConnected is returned for requests to a synthetic upstream that is not connected
+var errSyntheticNotConnected = errors.New("synthetic upstream not connected")
+
+// SyntheticMCP is an upstream served in-process from the synthetic tools of its config. It is never connected to a
+// real server, its tools are listed from the config and calls to them return their canned responses. It is named
+// like any other upstream so its tools are prefixed and renamed the same way
+type SyntheticMCP struct {
+	*MCPServer
+}
+
+var _ MCP = &SyntheticMCP{}
+var _ ToolServer = &SyntheticMCP{}
+
+// NewSyntheticMCP creates a synthetic upstream from the provided configuration
+func NewSyntheticMCP(config *config.MCPServer) *SyntheticMCP {
+	return &SyntheticMCP{MCPServer: NewUpstreamMCP(config)}
+}
+
+// Connect marks the upstream as connected. The tools of a synthetic upstream only change with its config, which
+// starts a new upstream, so it reports it sends tool list changed notifications to not be polled
+func (up *SyntheticMCP) Connect(_ context.Context, onConnection func()) error {
+	if up.init != nil {
+		return nil
+	}
+	onConnection()
+	up.init = &mcp.InitializeResult{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		Capabilities: mcp.ServerCapabilities{
+			Tools: &struct {
+				ListChanged bool `json:"listChanged,omitempty"`
+			}{
+				ListChanged: true,
+			},
+		},
+		ServerInfo: mcp.Implementation{Name: up.Name, Version: "synthetic"},
+	}
+	return nil
+}
+
+// Disconnect marks the upstream as not connected
+func (up *SyntheticMCP) Disconnect() error {
+	up.init = nil
+	return nil
+}
+
+// Ping succeeds while the upstream is connected
+func (up *SyntheticMCP) Ping(_ context.Context) error {
+	if up.init == nil {
+		return errSyntheticNotConnected
+	}
+	return nil
+}
+
+// ListTools lists the synthetic tools of the config
+func (up *SyntheticMCP) ListTools(_ context.Context, _ mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	if up.init == nil {
+		return nil, errSyntheticNotConnected
+	}
+	tools := make([]mcp.Tool, 0, len(up.SyntheticTools))
+	for _, syntheticTool := range up.SyntheticTools {
+		tool, err := syntheticTool.MCPTool()
+		if err != nil {
+			return nil, fmt.Errorf("invalid synthetic tool %s: %w", syntheticTool.Name, err)
+		}
+		tools = append(tools, tool)
+	}
+	return &mcp.ListToolsResult{Tools: tools}, nil
+}
+
+// ServeToolCall returns the canned response of the synthetic tool
+func (up *SyntheticMCP) ServeToolCall(_ context.Context, upstreamName string, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	for _, syntheticTool := range up.SyntheticTools {
+		if syntheticTool.Name == upstreamName {
+			return syntheticTool.Result(), nil
+		}
+	}
+	return mcp.NewToolResultError(fmt.Sprintf("tool %s not found", upstreamName)), nil
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// VirtualServerPathPrefix is the path prefix used to select a virtual server by path rather than header
+const VirtualServerPathPrefix = "/mcp/vs/"
+
+// VirtualServerHandler selects a virtual server from the request path /mcp/vs/{namespace}/{name}.
+// It is intended for clients that cannot set the x-mcp-virtualserver header. The selected virtual server
+// is set as the x-mcp-virtualserver header so the same filtering logic applies to both mechanisms.
+type VirtualServerHandler struct {
+	next   http.Handler
+	logger *slog.Logger
+}
+
+// NewVirtualServerHandler returns a handler that selects a virtual server based on path before passing the request to next
+func NewVirtualServerHandler(next http.Handler, logger *slog.Logger) *VirtualServerHandler {
+	return &VirtualServerHandler{
+		next:   next,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler interface
+func (h *VirtualServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	virtualServer, ok := VirtualServerFromPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "invalid virtual server path. Use /mcp/vs/{namespace}/{name}", http.StatusNotFound)
+		return
+	}
+	h.logger.DebugContext(r.Context(), "selected virtual server from path", "virtualServer", virtualServer, "path", r.URL.Path)
+	// the path is more specific than a header so it takes precedence
+	req := r.Clone(r.Context())
+	req.Header.Set(virtualMCPHeader, virtualServer)
+	h.next.ServeHTTP(w, req)
+}
+
+// VirtualServerFromPath extracts namespace/name from /mcp/vs/{namespace}/{name}. ok is false for any other path
+func VirtualServerFromPath(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, VirtualServerPathPrefix)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0] + "/" + parts[1], true
+}
@@ -0,0 +1,146 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualServerFromPath(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Path     string
+		Expected string
+		OK       bool
+	}{
+		{Name: "valid path", Path: "/mcp/vs/mcp-test/my-vs", Expected: "mcp-test/my-vs", OK: true},
+		{Name: "valid path with trailing slash", Path: "/mcp/vs/mcp-test/my-vs/", Expected: "mcp-test/my-vs", OK: true},
+		{Name: "missing name", Path: "/mcp/vs/mcp-test", OK: false},
+		{Name: "too many segments", Path: "/mcp/vs/mcp-test/my-vs/extra", OK: false},
+		{Name: "not a virtual server path", Path: "/mcp", OK: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			vs, ok := VirtualServerFromPath(tc.Path)
+			require.Equal(t, tc.OK, ok)
+			require.Equal(t, tc.Expected, vs)
+		})
+	}
+}
+
+func TestVirtualServerHandlerMatchesHeaderSelection(t *testing.T) {
+	mcpBroker := &mcpBrokerImpl{
+		virtualServers: map[string]*config.VirtualServer{
+			"mcp-test/my-vs": {
+				Name:  "mcp-test/my-vs",
+				Tools: []string{"server1_tool1", "server2_tool1"},
+			},
+		},
+		logger: slog.Default(),
+	}
+	allTools := func() *mcp.ListToolsResult {
+		return &mcp.ListToolsResult{Tools: []mcp.Tool{
+			{Name: "server1_tool1"},
+			{Name: "server1_tool2"},
+			{Name: "server2_tool1"},
+		}}
+	}
+
+	// header selected
+	headerResult := allTools()
+	headerReq := &mcp.ListToolsRequest{Header: http.Header{virtualMCPHeader: []string{"mcp-test/my-vs"}}}
+	mcpBroker.FilterTools(context.TODO(), 1, headerReq, headerResult)
+
+	// path selected
+	var pathHeaders http.Header
+	handler := NewVirtualServerHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		pathHeaders = r.Header
+	}), slog.Default())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp/vs/mcp-test/my-vs", nil))
+	require.NotNil(t, pathHeaders)
+	pathResult := allTools()
+	mcpBroker.FilterTools(context.TODO(), 1, &mcp.ListToolsRequest{Header: pathHeaders}, pathResult)
+
+	require.Len(t, headerResult.Tools, 2)
+	require.Equal(t, headerResult.Tools, pathResult.Tools)
+}
+
+func TestVirtualServerHandlerInvalidPath(t *testing.T) {
+	called := false
+	handler := NewVirtualServerHandler(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		called = true
+	}), slog.Default())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp/vs/only-namespace", nil))
+	require.False(t, called)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestInitializeReturnsVirtualServerInfo(t *testing.T) {
+	ctx := context.Background()
+	mcpBroker := NewBroker(logger)
+	defer func() { _ = mcpBroker.Shutdown(ctx) }()
+	brokerImpl, ok := mcpBroker.(*mcpBrokerImpl)
+	require.True(t, ok)
+	brokerImpl.virtualServers = map[string]*config.VirtualServer{
+		"mcp-test/described": {
+			Name:        "mcp-test/described",
+			Tools:       []string{"server1_tool1"},
+			Title:       "Weather Tools",
+			Description: "Tools for looking up weather forecasts",
+		},
+		"mcp-test/plain": {Name: "mcp-test/plain", Tools: []string{"server1_tool1"}},
+	}
+	mcpHandler := server.NewStreamableHTTPServer(brokerImpl.MCPServer())
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", mcpHandler)
+	mux.Handle(VirtualServerPathPrefix, NewVirtualServerHandler(mcpHandler, logger))
+	gateway := httptest.NewServer(mux)
+	defer gateway.Close()
+
+	testCases := []struct {
+		Name               string
+		VirtualServer      string
+		ExpectTitle        string
+		ExpectInstructions string
+	}{
+		{Name: "virtual server with description", VirtualServer: "mcp-test/described", ExpectTitle: "Weather Tools", ExpectInstructions: "Tools for looking up weather forecasts"},
+		{Name: "virtual server without description", VirtualServer: "mcp-test/plain"},
+		{Name: "unknown virtual server", VirtualServer: "mcp-test/unknown"},
+		{Name: "no virtual server"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tc.VirtualServer != "" {
+				headers["x-mcp-virtualserver"] = tc.VirtualServer
+			}
+			mcpClient, err := client.NewStreamableHttpClient(gateway.URL+"/mcp", transport.WithHTTPHeaders(headers))
+			require.NoError(t, err)
+			defer func() { _ = mcpClient.Close() }()
+			result, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+			require.NoError(t, err)
+			require.Equal(t, "Kagenti MCP Broker", result.ServerInfo.Name)
+			require.Equal(t, tc.ExpectTitle, result.ServerInfo.Title)
+			require.Equal(t, tc.ExpectInstructions, result.Instructions)
+		})
+	}
+
+	// selecting the virtual server by path returns the same
+	mcpClient, err := client.NewStreamableHttpClient(gateway.URL + VirtualServerPathPrefix + "mcp-test/described")
+	require.NoError(t, err)
+	defer func() { _ = mcpClient.Close() }()
+	result, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "Tools for looking up weather forecasts", result.Instructions)
+}
@@ -6,7 +6,9 @@ package clients
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	"github.com/kagenti/mcp-gateway/internal/config"
 	mcprouter "github.com/kagenti/mcp-gateway/internal/mcp-router"
 	"github.com/mark3labs/mcp-go/client"
@@ -28,24 +30,37 @@ func Initialize(ctx context.Context, gatewayHost, routerKey string, conf *config
 	}
 
 	url := fmt.Sprintf("http://%s%s", gatewayHost, mcpPath)
+	// as with tool calls the credential replaces the client's header unless the server forwards it
+	for name, value := range conf.RouterCredentialHeaders() {
+		for key := range passThroughHeaders {
+			if strings.EqualFold(key, name) {
+				delete(passThroughHeaders, key)
+			}
+		}
+		passThroughHeaders[name] = value
+	}
+	if url, err = conf.WithCredentialQuery(url); err != nil {
+		return nil, err
+	}
 
-	httpClient, err := client.NewStreamableHttpClient(url, transport.WithHTTPHeaders(passThroughHeaders))
+	trans, err := transport.NewStreamableHTTP(url, transport.WithHTTPHeaders(passThroughHeaders))
 	if err != nil {
 		return nil, err
 	}
+	httpClient := client.NewClient(trans, client.WithSession())
 	if err := httpClient.Start(ctx); err != nil {
 		return nil, err
 	}
-	if _, err := httpClient.Initialize(ctx, mcp.InitializeRequest{
-		Params: mcp.InitializeParams{
-			ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
-			Capabilities:    mcp.ClientCapabilities{},
-			ClientInfo: mcp.Implementation{
-				Name:    "mcp-gateway",
-				Version: "0.0.1",
-			},
+	// this sends both initialize and notifications/initialized to the upstream
+	if _, err := upstream.InitializeSession(ctx, trans, mcp.InitializeParams{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		Capabilities:    mcp.ClientCapabilities{},
+		ClientInfo: mcp.Implementation{
+			Name:    "mcp-gateway",
+			Version: "0.0.1",
 		},
 	}); err != nil {
+		_ = httpClient.Close()
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
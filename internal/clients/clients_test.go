@@ -0,0 +1,96 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+// initializeRecorder is a mock upstream that records the methods it receives and the session they were sent with
+type initializeRecorder struct {
+	lock               sync.Mutex
+	methods            []string
+	initializedSession string
+	rejectInitialized  bool
+}
+
+func (rec *initializeRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	msg := struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec.lock.Lock()
+	rec.methods = append(rec.methods, msg.Method)
+	rec.lock.Unlock()
+
+	switch msg.Method {
+	case "initialize":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("mcp-session-id", "upstream-session")
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%v,"result":{"protocolVersion":%q,"capabilities":{},"serverInfo":{"name":"mock","version":"0.0.1"}}}`,
+			msg.ID, mcp.LATEST_PROTOCOL_VERSION)
+	case "notifications/initialized":
+		rec.lock.Lock()
+		rec.initializedSession = r.Header.Get("mcp-session-id")
+		rec.lock.Unlock()
+		if rec.rejectInitialized {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestInitializeSendsInitialized(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		RejectInitialized bool
+	}{
+		{
+			Name: "initialized sent after initialize",
+		},
+		{
+			Name:              "rejected initialized does not fail the session",
+			RejectInitialized: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := &initializeRecorder{rejectInitialized: tc.RejectInitialized}
+			srv := httptest.NewServer(rec)
+			defer srv.Close()
+
+			conf := &config.MCPServer{Name: "mock", URL: "http://mock.mcp.local/mcp", Hostname: "mock.mcp.local"}
+			httpClient, err := Initialize(context.Background(), strings.TrimPrefix(srv.URL, "http://"), "router-key", conf, map[string]string{})
+			require.NoError(t, err)
+			defer func() { _ = httpClient.Close() }()
+
+			require.Equal(t, "upstream-session", httpClient.GetSessionId())
+			rec.lock.Lock()
+			defer rec.lock.Unlock()
+			require.Equal(t, []string{"initialize", "notifications/initialized"}, rec.methods)
+			// the notification must belong to the session created by initialize
+			require.Equal(t, "upstream-session", rec.initializedSession)
+		})
+	}
+}
@@ -3,9 +3,14 @@ package config_test
 import (
 	"errors"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/api/equality"
 )
 
@@ -41,6 +46,46 @@ func TestConfig_StripServerPrefix(t *testing.T) {
 			Input:  "other_tool",
 			Output: "other_tool",
 		},
+		{
+			Name: "strips prefix alias",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{
+						ToolPrefix:        "prefix_",
+						ToolPrefixAliases: []string{"old_"},
+					},
+				},
+			},
+			Input:  "old_tool",
+			Output: "tool",
+		},
+		{
+			Name: "strips prefix and separator",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{
+						ToolPrefix:          "prefix",
+						ToolPrefixAliases:   []string{"old"},
+						ToolPrefixSeparator: "__",
+					},
+				},
+			},
+			Input:  "old__tool_name",
+			Output: "tool_name",
+		},
+		{
+			Name: "doesn't strip prefix without separator",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{
+						ToolPrefix:          "prefix",
+						ToolPrefixSeparator: "__",
+					},
+				},
+			},
+			Input:  "prefix_tool",
+			Output: "prefix_tool",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -110,6 +155,31 @@ func TestConfig_GetServerInfo(t *testing.T) {
 			Tool:   "not_some",
 			Expect: nil,
 		},
+		{
+			Name: "test get service info matches a prefix alias",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{
+						ToolPrefix:        "server1_",
+						ToolPrefixAliases: []string{"legacy_"},
+						Name:              "test/server1",
+						Enabled:           true,
+					},
+					{
+						ToolPrefix: "server2_",
+						Name:       "test/server2",
+						Enabled:    true,
+					},
+				},
+			},
+			Tool: "legacy_some",
+			Expect: &config.MCPServer{
+				ToolPrefix:        "server1_",
+				ToolPrefixAliases: []string{"legacy_"},
+				Name:              "test/server1",
+				Enabled:           true,
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -144,6 +214,15 @@ func TestConfig_MCPServerPath(t *testing.T) {
 			Error: &url.Error{},
 			Out:   "",
 		},
+		{
+			Name: "test get mcp server path when rewritten",
+			Server: &config.MCPServer{
+				URL:         "http://mcp-api-key-server.mcp-test.svc.cluster.local:9090/mcp",
+				PathRewrite: "/proxy/team-a/mcp",
+			},
+			Error: nil,
+			Out:   "/proxy/team-a/mcp",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -164,3 +243,843 @@ func TestConfig_MCPServerPath(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_MCPServerCredentialLocation(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Credential   string
+		Location     string
+		ExpectHeader string
+		ExpectValue  string
+		ExpectURL    string
+	}{
+		{
+			Name:         "default sends the credential unchanged in the authorization header",
+			Credential:   "Bearer 1234",
+			ExpectHeader: "Authorization",
+			ExpectValue:  "Bearer 1234",
+			ExpectURL:    "http://localhost:9090/mcp",
+		},
+		{
+			Name:         "bearer adds the prefix",
+			Credential:   "1234",
+			Location:     config.CredentialLocationBearer,
+			ExpectHeader: "Authorization",
+			ExpectValue:  "Bearer 1234",
+			ExpectURL:    "http://localhost:9090/mcp",
+		},
+		{
+			Name:         "bearer keeps an existing prefix",
+			Credential:   "bearer 1234",
+			Location:     config.CredentialLocationBearer,
+			ExpectHeader: "Authorization",
+			ExpectValue:  "bearer 1234",
+			ExpectURL:    "http://localhost:9090/mcp",
+		},
+		{
+			Name:         "named header",
+			Credential:   "1234",
+			Location:     "header:X-Api-Key",
+			ExpectHeader: "X-Api-Key",
+			ExpectValue:  "1234",
+			ExpectURL:    "http://localhost:9090/mcp",
+		},
+		{
+			Name:       "query parameter",
+			Credential: "12 34&",
+			Location:   "query:api_key",
+			ExpectURL:  "http://localhost:9090/mcp?api_key=12+34%26",
+		},
+		{
+			Name:      "no credential",
+			Location:  "query:api_key",
+			ExpectURL: "http://localhost:9090/mcp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &config.MCPServer{URL: "http://localhost:9090/mcp", Credential: tc.Credential, CredentialLocation: tc.Location}
+			name, value, ok := server.CredentialHeader()
+			require.Equal(t, tc.ExpectHeader != "", ok)
+			require.Equal(t, tc.ExpectHeader, name)
+			require.Equal(t, tc.ExpectValue, value)
+			mcpURL, err := server.WithCredentialQuery(server.URL)
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectURL, mcpURL)
+		})
+	}
+}
+
+func TestConfig_MCPServerRouterCredentialHeader(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Location             string
+		ForwardAuthorization bool
+		ExpectHeader         string
+		ExpectValue          string
+	}{
+		{Name: "credential replaces the authorization header", ExpectHeader: "Authorization", ExpectValue: "1234"},
+		{Name: "bearer credential replaces the authorization header", Location: config.CredentialLocationBearer, ExpectHeader: "Authorization", ExpectValue: "Bearer 1234"},
+		{Name: "forwarded authorization is not replaced", ForwardAuthorization: true},
+		{Name: "forwarded authorization is not replaced by a bearer credential", Location: config.CredentialLocationBearer, ForwardAuthorization: true},
+		{Name: "named header is set when authorization is forwarded", Location: "header:X-Api-Key", ForwardAuthorization: true, ExpectHeader: "X-Api-Key", ExpectValue: "1234"},
+		{Name: "named authorization header is not set when authorization is forwarded", Location: "header:authorization", ForwardAuthorization: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &config.MCPServer{Credential: "1234", CredentialLocation: tc.Location, ForwardAuthorization: tc.ForwardAuthorization}
+			name, value, ok := server.RouterCredentialHeader()
+			require.Equal(t, tc.ExpectHeader != "", ok)
+			require.Equal(t, tc.ExpectHeader, name)
+			require.Equal(t, tc.ExpectValue, value)
+		})
+	}
+}
+
+func TestConfig_MCPServerRouterRemovesAuthorization(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Credential           string
+		Location             string
+		Additional           []config.AdditionalCredential
+		ForwardAuthorization bool
+		Expected             bool
+	}{
+		{Name: "no credential"},
+		{Name: "credential replaces the authorization header", Credential: "1234"},
+		{Name: "bearer credential replaces the authorization header", Credential: "1234", Location: config.CredentialLocationBearer},
+		{Name: "credential in a named header", Credential: "1234", Location: "header:X-Api-Key", Expected: true},
+		{Name: "credential in a query parameter", Credential: "1234", Location: "query:api_key", Expected: true},
+		{Name: "additional credential only", Additional: []config.AdditionalCredential{{Value: "acme", Location: "query:tenant"}}, Expected: true},
+		{Name: "forwarded authorization", Credential: "1234", Location: "header:X-Api-Key", ForwardAuthorization: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &config.MCPServer{Credential: tc.Credential, CredentialLocation: tc.Location, AdditionalCredentials: tc.Additional, ForwardAuthorization: tc.ForwardAuthorization}
+			require.Equal(t, tc.Expected, server.RouterRemovesAuthorization())
+		})
+	}
+}
+
+func TestConfig_MCPServerAdditionalCredentials(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Location             string
+		ForwardAuthorization bool
+		Additional           []config.AdditionalCredential
+		ExpectHeaders        map[string]string
+		ExpectRouterHeaders  map[string]string
+		ExpectURL            string
+	}{
+		{
+			Name:                "key and secret in separate headers",
+			Location:            "header:X-Api-Key",
+			Additional:          []config.AdditionalCredential{{Value: "5678", Location: "header:X-Api-Secret"}},
+			ExpectHeaders:       map[string]string{"X-Api-Key": "1234", "X-Api-Secret": "5678"},
+			ExpectRouterHeaders: map[string]string{"X-Api-Key": "1234", "X-Api-Secret": "5678"},
+			ExpectURL:           "http://localhost:9090/mcp",
+		},
+		{
+			Name:                "bearer token and query parameter",
+			Location:            config.CredentialLocationBearer,
+			Additional:          []config.AdditionalCredential{{Value: "acme", Location: "query:tenant"}},
+			ExpectHeaders:       map[string]string{"Authorization": "Bearer 1234"},
+			ExpectRouterHeaders: map[string]string{"Authorization": "Bearer 1234"},
+			ExpectURL:           "http://localhost:9090/mcp?tenant=acme",
+		},
+		{
+			Name:     "key and secret as query parameters",
+			Location: "query:key",
+			Additional: []config.AdditionalCredential{
+				{Value: "5678", Location: "query:secret"},
+			},
+			ExpectHeaders:       map[string]string{},
+			ExpectRouterHeaders: map[string]string{},
+			ExpectURL:           "http://localhost:9090/mcp?key=1234&secret=5678",
+		},
+		{
+			Name:                 "additional authorization header is not set when authorization is forwarded",
+			Location:             "header:X-Api-Key",
+			ForwardAuthorization: true,
+			Additional:           []config.AdditionalCredential{{Value: "5678", Location: "header:Authorization"}},
+			ExpectHeaders:        map[string]string{"X-Api-Key": "1234", "Authorization": "5678"},
+			ExpectRouterHeaders:  map[string]string{"X-Api-Key": "1234"},
+			ExpectURL:            "http://localhost:9090/mcp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &config.MCPServer{
+				URL:                   "http://localhost:9090/mcp",
+				Credential:            "1234",
+				CredentialLocation:    tc.Location,
+				AdditionalCredentials: tc.Additional,
+				ForwardAuthorization:  tc.ForwardAuthorization,
+			}
+			require.Equal(t, tc.ExpectHeaders, server.CredentialHeaders())
+			require.Equal(t, tc.ExpectRouterHeaders, server.RouterCredentialHeaders())
+			mcpURL, err := server.WithCredentialQuery(server.URL)
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectURL, mcpURL)
+		})
+	}
+}
+
+func TestConfig_MCPServerDefaultArguments(t *testing.T) {
+	server := &config.MCPServer{ToolDefaultArguments: map[string]string{
+		"forecast":   `{"region":"eu-west-1","days":3}`,
+		"getweather": `{"units":"metric"}`,
+		"broken":     `[1]`,
+	}}
+	testCases := []struct {
+		Name      string
+		Tool      string
+		Expect    map[string]any
+		ExpectErr bool
+	}{
+		{Name: "tool with defaults", Tool: "forecast", Expect: map[string]any{"region": "eu-west-1", "days": float64(3)}},
+		{Name: "tool name keys are lower cased by the config loader", Tool: "getWeather", Expect: map[string]any{"units": "metric"}},
+		{Name: "tool without defaults", Tool: "time"},
+		{Name: "defaults that are not an object", Tool: "broken", ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			defaults, err := server.DefaultArguments(tc.Tool)
+			if tc.ExpectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.Expect, defaults)
+		})
+	}
+}
+
+func TestCheckArguments(t *testing.T) {
+	schema := mcp.ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"region":  map[string]any{"type": "string"},
+			"days":    map[string]any{"type": "integer"},
+			"verbose": map[string]any{"type": []any{"boolean", "null"}},
+			"filter":  map[string]any{},
+		},
+	}
+	testCases := []struct {
+		Name      string
+		Arguments map[string]any
+		Schema    mcp.ToolInputSchema
+		ExpectErr string
+	}{
+		{Name: "matching arguments", Arguments: map[string]any{"region": "eu", "days": float64(3), "verbose": nil, "filter": []any{"a"}}, Schema: schema},
+		{Name: "argument not in schema", Arguments: map[string]any{"zone": "a"}, Schema: schema, ExpectErr: "argument zone is not in the tool's input schema"},
+		{Name: "argument of the wrong type", Arguments: map[string]any{"region": float64(1)}, Schema: schema, ExpectErr: "argument region is not of type string"},
+		{Name: "number that is not an integer", Arguments: map[string]any{"days": 1.5}, Schema: schema, ExpectErr: "argument days is not of type integer"},
+		{Name: "schema without properties", Arguments: map[string]any{"anything": true}, Schema: mcp.ToolInputSchema{Type: "object"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := config.CheckArguments(tc.Arguments, tc.Schema)
+			if tc.ExpectErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.ExpectErr)
+		})
+	}
+}
+
+func TestClientToolFilterMatches(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Filter  config.ClientToolFilter
+		Client  string
+		Version string
+		Expect  bool
+	}{
+		{Name: "exact name any version", Filter: config.ClientToolFilter{ClientName: "admin-cli"}, Client: "admin-cli", Version: "2.1.0", Expect: true},
+		{Name: "name pattern", Filter: config.ClientToolFilter{ClientName: "admin-*"}, Client: "admin-cli", Expect: true},
+		{Name: "name mismatch", Filter: config.ClientToolFilter{ClientName: "admin-*"}, Client: "claude-ai", Expect: false},
+		{Name: "version pattern", Filter: config.ClientToolFilter{ClientName: "*", ClientVersion: "1.*"}, Client: "any", Version: "1.4.2", Expect: true},
+		{Name: "version mismatch", Filter: config.ClientToolFilter{ClientName: "*", ClientVersion: "1.*"}, Client: "any", Version: "2.0.0", Expect: false},
+		{Name: "catch all matches unknown client", Filter: config.ClientToolFilter{ClientName: "*"}, Expect: true},
+		{Name: "invalid pattern", Filter: config.ClientToolFilter{ClientName: "[admin"}, Client: "[admin", Expect: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expect, tc.Filter.Matches(tc.Client, tc.Version))
+		})
+	}
+}
+
+func TestTenancyVisible(t *testing.T) {
+	tenancy := &config.Tenancy{
+		Enabled: true,
+		SharedTools: []*config.SharedTools{
+			{Server: "team-a/weather", Tools: []string{"weather_forecast"}, Tenants: []string{"team-b"}},
+			{Server: "platform/docs", Tenants: []string{config.AllTenants}},
+		},
+	}
+	testCases := []struct {
+		Name         string
+		ClientTenant string
+		ServerName   string
+		ServerTenant string
+		Tool         string
+		Expect       bool
+	}{
+		{Name: "own tenant", ClientTenant: "team-a", ServerName: "team-a/weather", ServerTenant: "team-a", Tool: "weather_alerts", Expect: true},
+		{Name: "other tenant denied", ClientTenant: "team-c", ServerName: "team-a/weather", ServerTenant: "team-a", Tool: "weather_forecast", Expect: false},
+		{Name: "shared tool", ClientTenant: "team-b", ServerName: "team-a/weather", ServerTenant: "team-a", Tool: "weather_forecast", Expect: true},
+		{Name: "tool not in share", ClientTenant: "team-b", ServerName: "team-a/weather", ServerTenant: "team-a", Tool: "weather_alerts", Expect: false},
+		{Name: "shared with all tenants", ClientTenant: "team-c", ServerName: "platform/docs", ServerTenant: "platform", Tool: "docs_search", Expect: true},
+		{Name: "no client tenant sees tools shared with all", ServerName: "platform/docs", ServerTenant: "platform", Tool: "docs_search", Expect: true},
+		{Name: "no client tenant denied", ServerName: "team-a/weather", ServerTenant: "team-a", Tool: "weather_forecast", Expect: false},
+		{Name: "server without tenant denied", ServerName: "default/legacy", Tool: "legacy_tool", Expect: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expect, tenancy.Visible(tc.ClientTenant, tc.ServerName, tc.ServerTenant, tc.Tool))
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	validServer := func() *config.MCPServer {
+		return &config.MCPServer{Name: "mcp-test/server1", URL: "http://server1.mcp-test.svc.cluster.local:9090/mcp", ToolPrefix: "s1_", Hostname: "server1.mcp.local", Enabled: true}
+	}
+	testCases := []struct {
+		Name   string
+		Config *config.MCPServersConfig
+		Expect config.ValidationErrors
+	}{
+		{
+			Name: "valid config",
+			Config: &config.MCPServersConfig{
+				Servers:        []*config.MCPServer{validServer()},
+				VirtualServers: []*config.VirtualServer{{Name: "mcp-test/vs", Tools: []string{"s1_tool"}, UnavailableBehavior: config.UnavailableBehaviorDegraded}},
+			},
+		},
+		{
+			Name: "bad url and missing hostname",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					validServer(),
+					{Name: "mcp-test/server2", URL: "server2:9090/mcp", ToolPrefix: "s2_"},
+				},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[1].hostname", Message: "hostname is required"},
+				{Field: "servers[1].url", Value: "server2:9090/mcp", Message: "url must use the http or https scheme"},
+			},
+		},
+		{
+			Name: "missing name and url",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{{Hostname: "server1.mcp.local"}},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].name", Message: "name is required"},
+				{Field: "servers[0].url", Message: "url is required"},
+			},
+		},
+		{
+			Name: "duplicate server id",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{validServer(), validServer()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[1]", Value: "mcp-test/server1:s1_:server1.mcp.local", Message: "duplicate server id, also used by servers[0]"},
+			},
+		},
+		{
+			Name: "invalid path rewrite and credential location",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.PathRewrite = "proxy/mcp"
+					s.CredentialLocation = "cookie:session"
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].pathRewrite", Value: "proxy/mcp", Message: "pathRewrite must be an absolute path"},
+				{Field: "servers[0].credentialLocation", Value: "cookie:session", Message: "credentialLocation must be bearer, header:<Name> or query:<name>"},
+			},
+		},
+		{
+			Name: "invalid tool prefix aliases",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.ToolPrefixAliases = []string{"old_", "", "s1_", "old_"}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].toolPrefixAliases", Value: "4", Message: "at most 3 tool prefix aliases are allowed"},
+				{Field: "servers[0].toolPrefixAliases[1]", Message: "tool prefix alias must not be empty"},
+				{Field: "servers[0].toolPrefixAliases[2]", Value: "s1_", Message: "tool prefix alias duplicates the tool prefix or another alias"},
+				{Field: "servers[0].toolPrefixAliases[3]", Value: "old_", Message: "tool prefix alias duplicates the tool prefix or another alias"},
+			},
+		},
+		{
+			Name: "invalid tool renames",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.ToolRenames = []config.ToolRename{{Match: "^get_(.*)$", Replace: "fetch_${1}"}, {Replace: "x"}, {Match: "get_(", Replace: "x"}}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].toolRenames[1].match", Message: "match is required"},
+				{Field: "servers[0].toolRenames[2].match", Value: "get_(", Message: "match is not a valid regular expression: error parsing regexp: missing closing ): `get_(`"},
+			},
+		},
+		{
+			Name: "invalid tool timeouts",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.ToolTimeouts = map[string]time.Duration{"slow": 5 * time.Minute, "time": 0, "headers": -time.Second}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].toolTimeouts.headers", Value: "-1s", Message: "timeout must be greater than 0"},
+				{Field: "servers[0].toolTimeouts.time", Value: "0s", Message: "timeout must be greater than 0"},
+			},
+		},
+		{
+			Name: "invalid tool default arguments",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.ToolDefaultArguments = map[string]string{"forecast": `{"region":"eu"}`, "time": `"utc"`, "headers": `{`}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].toolDefaultArguments.headers", Value: "{", Message: "default arguments must be a JSON object: unexpected end of JSON input"},
+				{Field: "servers[0].toolDefaultArguments.time", Value: `"utc"`, Message: "default arguments must be a JSON object: json: cannot unmarshal string into Go value of type map[string]interface {}"},
+			},
+		},
+		{
+			Name: "invalid upstream session limit",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.MaxUpstreamSessions = -1
+					s.UpstreamSessionLimitBehavior = "Queue"
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].maxUpstreamSessions", Value: "-1", Message: "maxUpstreamSessions must not be negative"},
+				{Field: "servers[0].upstreamSessionLimitBehavior", Value: "Queue", Message: "upstreamSessionLimitBehavior must be Reject or Reuse"},
+			},
+		},
+		{
+			Name: "negative tool call concurrency limit",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.MaxConcurrentToolCalls = -1
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].maxConcurrentToolCalls", Value: "-1", Message: "maxConcurrentToolCalls must not be negative"},
+			},
+		},
+		{
+			Name: "negative max response size",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.MaxResponseBytes = -1
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].maxResponseBytes", Value: "-1", Message: "maxResponseBytes must not be negative"},
+			},
+		},
+		{
+			Name: "invalid tool call meta",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.ToolCallMeta = &config.ToolCallMeta{
+						Mode: "Rewrite",
+						Inject: []config.MetaField{
+							{Name: "tenant", Value: "team-a"},
+							{Name: "", Value: "x"},
+							{Name: "progressToken", Value: "1"},
+							{Name: "tenant", Value: "team-b"},
+						},
+					}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].toolCallMeta.mode", Value: "Rewrite", Message: "mode must be PassThrough or StripGatewayFields"},
+				{Field: "servers[0].toolCallMeta.inject[1].name", Message: "name is required"},
+				{Field: "servers[0].toolCallMeta.inject[2].name", Value: "progressToken", Message: "progressToken is set by the client and cannot be injected"},
+				{Field: "servers[0].toolCallMeta.inject[3].name", Value: "tenant", Message: "field is already injected by inject[0]"},
+			},
+		},
+		{
+			Name: "negative upstream session max age",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.UpstreamSessionMaxAge = -time.Minute
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].upstreamSessionMaxAge", Value: "-1m0s", Message: "upstreamSessionMaxAge must not be negative"},
+			},
+		},
+		{
+			Name: "negative startup probe settings",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.StartupProbe = &config.StartupProbe{Period: -time.Second, Timeout: -time.Second, FailureThreshold: -1}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].startupProbe.period", Value: "-1s", Message: "period must not be negative"},
+				{Field: "servers[0].startupProbe.timeout", Value: "-1s", Message: "timeout must not be negative"},
+				{Field: "servers[0].startupProbe.failureThreshold", Value: "-1", Message: "failureThreshold must not be negative"},
+			},
+		},
+		{
+			Name: "invalid virtual servers",
+			Config: &config.MCPServersConfig{
+				VirtualServers: []*config.VirtualServer{
+					{Name: "mcp-test/vs"},
+					{Name: "mcp-test/vs", UnavailableBehavior: "Fail"},
+					{},
+				},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "virtualServers[1].unavailableBehavior", Value: "Fail", Message: "unavailableBehavior must be Empty or Degraded"},
+				{Field: "virtualServers[1].name", Value: "mcp-test/vs", Message: "duplicate virtual server name, also used by virtualServers[0]"},
+				{Field: "virtualServers[2].name", Message: "name is required"},
+			},
+		},
+		{
+			Name: "invalid tool bindings",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{validServer()},
+				VirtualServers: []*config.VirtualServer{{
+					Name:  "mcp-test/vs",
+					Tools: []string{"s1_tool", "other_tool"},
+					ToolBindings: []config.ToolBinding{
+						{Tool: "s1_tool", Server: "mcp-test/server1"},
+						{Tool: "s1_tool", Server: "mcp-test/server1"},
+						{Server: "mcp-test/server1"},
+						{Tool: "s1_missing", Server: "mcp-test/server1"},
+						{Tool: "other_tool", Server: "mcp-test/server1"},
+						{Tool: "s1_tool2", Server: "mcp-test/unknown"},
+					},
+				}},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "virtualServers[0].toolBindings[1].tool", Value: "s1_tool", Message: "tool is already bound by toolBindings[0]"},
+				{Field: "virtualServers[0].toolBindings[2].tool", Message: "tool is required"},
+				{Field: "virtualServers[0].toolBindings[3].tool", Value: "s1_missing", Message: "tool is not one of the virtual server's tools"},
+				{Field: "virtualServers[0].toolBindings[4].server", Value: "mcp-test/server1", Message: "no tool prefix of the server matches tool other_tool"},
+				{Field: "virtualServers[0].toolBindings[5].tool", Value: "s1_tool2", Message: "tool is not one of the virtual server's tools"},
+				{Field: "virtualServers[0].toolBindings[5].server", Value: "mcp-test/unknown", Message: "server is not configured"},
+			},
+		},
+		{
+			Name: "synthetic servers need no url or hostname",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{Name: "mcp-test/mock", ToolPrefix: "mock_", Enabled: true, SyntheticTools: []config.SyntheticTool{{Name: "weather", InputSchema: `{"type":"object"}`, Response: "sunny"}}},
+				},
+			},
+		},
+		{
+			Name: "invalid synthetic tools",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{
+					{Name: "mcp-test/mock", ToolPrefix: "mock_", Enabled: true, SyntheticTools: []config.SyntheticTool{
+						{Name: "weather", Response: "sunny"},
+						{Response: "no name"},
+						{Name: "weather", InputSchema: `["not", "an", "object"]`},
+					}},
+				},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].syntheticTools[1].name", Message: "name is required"},
+				{Field: "servers[0].syntheticTools[2].name", Value: "weather", Message: "duplicate tool name, also used by syntheticTools[0]"},
+				{Field: "servers[0].syntheticTools[2].inputSchema", Value: `["not", "an", "object"]`, Message: "inputSchema must be a JSON object: json: cannot unmarshal array into Go value of type map[string]interface {}"},
+			},
+		},
+		{
+			Name: "invalid fallback tools",
+			Config: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{func() *config.MCPServer {
+					s := validServer()
+					s.FallbackTools = []config.FallbackTool{
+						{Name: "forecast", InputSchema: `{"type":"object"}`},
+						{Description: "no name"},
+						{Name: "forecast", InputSchema: `"string"`},
+					}
+					return s
+				}()},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "servers[0].fallbackTools[1].name", Message: "name is required"},
+				{Field: "servers[0].fallbackTools[2].name", Value: "forecast", Message: "duplicate tool name, also used by fallbackTools[0]"},
+				{Field: "servers[0].fallbackTools[2].inputSchema", Value: `"string"`, Message: "inputSchema must be a JSON object: json: cannot unmarshal string into Go value of type map[string]interface {}"},
+			},
+		},
+		{
+			Name: "invalid client tool filters",
+			Config: &config.MCPServersConfig{
+				ClientToolFilters: []*config.ClientToolFilter{
+					{ClientName: "admin-*", ClientVersion: "1.*", Tools: []string{"s1_tool"}},
+					{ClientVersion: "1.0"},
+					{ClientName: "[admin", ClientVersion: "[1"},
+				},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "clientToolFilters[1].clientName", Message: "clientName is required"},
+				{Field: "clientToolFilters[2].clientName", Value: "[admin", Message: "clientName is not a valid pattern"},
+				{Field: "clientToolFilters[2].clientVersion", Value: "[1", Message: "clientVersion is not a valid pattern"},
+			},
+		},
+		{
+			Name: "invalid tenancy shared tools",
+			Config: &config.MCPServersConfig{
+				Tenancy: &config.Tenancy{
+					Enabled: true,
+					SharedTools: []*config.SharedTools{
+						{Server: "mcp-test/server1", Tenants: []string{config.AllTenants}},
+						{Tools: []string{"s1_tool"}},
+						nil,
+					},
+				},
+			},
+			Expect: config.ValidationErrors{
+				{Field: "tenancy.sharedTools[1].server", Message: "server is required"},
+				{Field: "tenancy.sharedTools[1].tenants", Message: "at least one tenant is required"},
+				{Field: "tenancy.sharedTools[2]", Message: "shared tools must not be empty"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			errs := tc.Config.Validate()
+			require.Equal(t, tc.Expect, errs)
+			if len(tc.Expect) > 0 {
+				require.Contains(t, errs.Error(), tc.Expect[0].Field+": "+tc.Expect[0].Message)
+			}
+		})
+	}
+}
+
+func TestRenameTool(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Renames      []config.ToolRename
+		Tool         string
+		Expected     string
+		ExpectErrors int
+	}{
+		{
+			Name:     "no renames",
+			Tool:     "get_weather",
+			Expected: "get_weather",
+		},
+		{
+			Name:     "capture group",
+			Renames:  []config.ToolRename{{Match: "^get_(.*)$", Replace: "fetch_${1}"}},
+			Tool:     "get_weather",
+			Expected: "fetch_weather",
+		},
+		{
+			Name:     "renames are applied in order",
+			Renames:  []config.ToolRename{{Match: "-", Replace: "_"}, {Match: "^(.*)_v1$", Replace: "${1}"}},
+			Tool:     "list-repos-v1",
+			Expected: "list_repos",
+		},
+		{
+			Name:     "no match leaves the name unchanged",
+			Renames:  []config.ToolRename{{Match: "^get_", Replace: "fetch_"}},
+			Tool:     "set_weather",
+			Expected: "set_weather",
+		},
+		{
+			Name:         "invalid renames are skipped",
+			Renames:      []config.ToolRename{{Match: "get_(", Replace: "x"}, {Match: "^get_", Replace: "fetch_"}},
+			Tool:         "get_weather",
+			Expected:     "fetch_weather",
+			ExpectErrors: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &config.MCPServer{ToolRenames: tc.Renames}
+			renames, errs := server.CompileToolRenames()
+			require.Len(t, errs, tc.ExpectErrors)
+			require.Equal(t, tc.Expected, config.RenameTool(renames, tc.Tool))
+		})
+	}
+}
+
+func TestToolNamePrefixes(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		Server    *config.MCPServer
+		Expected  []string
+		ExpectErr bool
+	}{
+		{
+			Name:     "no separator",
+			Server:   &config.MCPServer{ToolPrefix: "weather_", ToolPrefixAliases: []string{"w_"}},
+			Expected: []string{"weather_", "w_"},
+		},
+		{
+			Name:     "separator follows each prefix",
+			Server:   &config.MCPServer{ToolPrefix: "weather", ToolPrefixAliases: []string{"w"}, ToolPrefixSeparator: "__"},
+			Expected: []string{"weather__", "w__"},
+		},
+		{
+			Name:     "no separator without a prefix",
+			Server:   &config.MCPServer{ToolPrefixSeparator: "__"},
+			Expected: []string{""},
+		},
+		{
+			Name:      "separator with a character tool names may not contain",
+			Server:    &config.MCPServer{ToolPrefix: "weather", ToolPrefixSeparator: "::"},
+			Expected:  []string{"weather::"},
+			ExpectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, tc.Server.ToolNamePrefixes())
+			require.Equal(t, []string{tc.Server.ToolPrefix}, tc.Server.ToolPrefixes()[:1], "the prefix itself is unchanged")
+			err := config.ValidateToolPrefixSeparator(tc.Server.ToolPrefixSeparator)
+			require.Equal(t, tc.ExpectErr, err != nil)
+		})
+	}
+}
+
+func TestLoadServers(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+servers:
+  - name: mcp-test/weather
+    url: http://weather.mcp.local/mcp
+    hostname: weather.mcp.local
+    toolPrefix: weather_
+    enabled: true
+    toolTimeouts:
+      forecast: 5m
+    upstreamSessionMaxAge: 30m
+    startupProbe:
+      period: 5s
+      failureThreshold: 12
+    toolCallMeta:
+      mode: StripGatewayFields
+      inject:
+        - name: tenantId
+          value: Team-A
+  - name: mcp-test/broken
+    url: http://broken.mcp.local/mcp
+    hostname: broken.mcp.local
+    enabled: not-a-bool
+  - name: mcp-test/no-url
+    hostname: no-url.mcp.local
+  - name: mcp-test/time
+    url: http://time.mcp.local/mcp
+    hostname: time.mcp.local
+    toolPrefix: time_
+    enabled: true
+  - name: mcp-test/weather
+    url: http://weather.mcp.local/mcp
+    hostname: weather.mcp.local
+    toolPrefix: weather_
+  - name: mcp-test/repos
+    url: https://repos.mcp.local/mcp
+    hostname: repos.mcp.local
+    toolPrefix: repos_
+    enabled: true
+    credential: key-1234
+    credentialLocation: header:X-Api-Key
+    additionalCredentials:
+      - value: secret-5678
+        location: header:X-Api-Secret
+  - name: mcp-test/bearer-secret
+    url: https://bearer.mcp.local/mcp
+    hostname: bearer.mcp.local
+    additionalCredentials:
+      - value: secret-5678
+        location: bearer
+  - name: mcp-test/mock
+    toolPrefix: mock_
+    enabled: true
+    syntheticTools:
+      - name: weather
+        description: the weather
+        inputSchema: '{"type":"object"}'
+        response: sunny
+      - name: broken
+        response: the tool is broken
+        isError: true
+`)))
+	entries, ok := v.Get("servers").([]any)
+	require.True(t, ok)
+
+	servers, skipped := config.LoadServers(entries)
+	names := []string{}
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	require.Equal(t, []string{"mcp-test/weather", "mcp-test/time", "mcp-test/repos", "mcp-test/mock"}, names)
+	require.Equal(t, 5*time.Minute, servers[0].ToolTimeouts["forecast"])
+	require.Equal(t, 30*time.Minute, servers[0].UpstreamSessionMaxAge)
+	require.Equal(t, &config.StartupProbe{Period: 5 * time.Second, FailureThreshold: 12}, servers[0].StartupProbe)
+	require.Equal(t, config.StartupProbe{Period: 5 * time.Second, Timeout: config.DefaultStartupProbeTimeout, FailureThreshold: 12}, servers[0].StartupProbe.WithDefaults())
+	require.Equal(t, &config.ToolCallMeta{Mode: config.ToolCallMetaStripGatewayFields, Inject: []config.MetaField{{Name: "tenantId", Value: "Team-A"}}}, servers[0].ToolCallMeta)
+	require.Nil(t, servers[1].StartupProbe)
+	require.True(t, servers[1].Enabled)
+	require.Equal(t, []config.AdditionalCredential{{Value: "secret-5678", Location: "header:X-Api-Secret"}}, servers[2].AdditionalCredentials)
+	require.True(t, servers[3].IsSynthetic())
+	require.Equal(t, []config.SyntheticTool{
+		{Name: "weather", Description: "the weather", InputSchema: `{"type":"object"}`, Response: "sunny"},
+		{Name: "broken", Response: "the tool is broken", IsError: true},
+	}, servers[3].SyntheticTools)
+
+	fields := []string{}
+	for _, fieldErr := range skipped {
+		fields = append(fields, fieldErr.Field)
+	}
+	require.Equal(t, []string{"servers[1]", "servers[2].url", "servers[4]", "servers[6].additionalCredentials[0].location"}, fields)
+	require.Equal(t, "mcp-test/broken", skipped[0].Value)
+	require.Contains(t, skipped[0].Message, "server could not be decoded")
+	require.Equal(t, "duplicate server id, also used by servers[0]", skipped[2].Message)
+
+	t.Run("no servers", func(t *testing.T) {
+		servers, skipped := config.LoadServers(nil)
+		require.Empty(t, servers)
+		require.Empty(t, skipped)
+	})
+}
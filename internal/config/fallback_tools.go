@@ -0,0 +1,18 @@
+package config
+
+import "github.com/mark3labs/mcp-go/mcp"
+
+// FallbackTool is the definition of one of a server's tools advertised in place of the tools the server lists while
+// the broker cannot connect to it, so clients keep seeing its tools during an outage
+type FallbackTool struct {
+	// Name is the upstream name of the tool. It is prefixed and renamed like the tools the server lists
+	Name        string
+	Description string
+	// InputSchema is the JSON schema of the tool's arguments as a JSON object. Empty accepts any arguments
+	InputSchema string
+}
+
+// MCPTool returns the tool as it is listed while the server is unavailable
+func (tool FallbackTool) MCPTool() (mcp.Tool, error) {
+	return newMCPTool(tool.Name, tool.Description, tool.InputSchema)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// LoadServers decodes the entries of the servers list of the config file. An entry that cannot be decoded, is invalid
+// or has the id of an earlier server is left out and reported with its index in the list, so one bad server does not
+// stop the others from being applied
+func LoadServers(entries []any) ([]*MCPServer, ValidationErrors) {
+	var (
+		servers []*MCPServer
+		skipped ValidationErrors
+	)
+	serverIDs := map[UpstreamMCPID]int{}
+	for i, entry := range entries {
+		field := fmt.Sprintf("servers[%d]", i)
+		server, err := decodeServer(entry)
+		if err != nil {
+			skipped = append(skipped, FieldError{Field: field, Value: entryName(entry), Message: fmt.Sprintf("server could not be decoded: %v", err)})
+			continue
+		}
+		if errs := validateServer(field, server); len(errs) > 0 {
+			skipped = append(skipped, errs...)
+			continue
+		}
+		if first, ok := serverIDs[server.ID()]; ok {
+			skipped = append(skipped, FieldError{Field: field, Value: string(server.ID()), Message: fmt.Sprintf("duplicate server id, also used by servers[%d]", first)})
+			continue
+		}
+		serverIDs[server.ID()] = i
+		servers = append(servers, server)
+	}
+	return servers, skipped
+}
+
+// decodeServer decodes a server entry the way viper decodes the rest of the config
+func decodeServer(entry any) (*MCPServer, error) {
+	if entry == nil {
+		return nil, fmt.Errorf("server must not be empty")
+	}
+	server := &MCPServer{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           server,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(entry); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// entryName returns the name of a server entry that could not be decoded, if it has one, to help find it
+func entryName(entry any) string {
+	fields, ok := entry.(map[string]any)
+	if !ok {
+		return ""
+	}
+	name, _ := fields["name"].(string)
+	return name
+}
@@ -6,7 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // UpstreamMCPID is used as type for identifying individual upstreams
@@ -16,6 +22,13 @@ type UpstreamMCPID string
 type MCPServersConfig struct {
 	Servers        []*MCPServer
 	VirtualServers []*VirtualServer
+	// ClientToolFilters are applied in order, the first filter matching a client decides the tools it is listed. They
+	// do not restrict the tools a client may call
+	ClientToolFilters []*ClientToolFilter
+	// Tenancy if enabled restricts each client to the tools of its own tenant's servers
+	Tenancy *Tenancy
+	// SkippedServers are the problems with the server entries left out when the config was loaded
+	SkippedServers ValidationErrors
 	observers      []Observer
 	//MCPGatewayExternalHostname is the accessible host of the gateway listener
 	MCPGatewayExternalHostname string
@@ -43,9 +56,11 @@ func (config *MCPServersConfig) StripServerPrefix(toolName string) string {
 
 	// strip matching prefix
 	for _, server := range config.Servers {
-		if strippedToolName, ok := strings.CutPrefix(toolName, server.ToolPrefix); ok {
-			slog.Info("Stripped tool name", "tool", strippedToolName, "originalPrefix", server.ToolPrefix)
-			return strippedToolName
+		for _, prefix := range server.ToolNamePrefixes() {
+			if strippedToolName, ok := strings.CutPrefix(toolName, prefix); ok {
+				slog.Debug("Stripped tool name", "tool", strippedToolName, "originalPrefix", prefix)
+				return strippedToolName
+			}
 		}
 	}
 	return toolName
@@ -57,16 +72,46 @@ func (config *MCPServersConfig) GetServerInfo(toolName string) *MCPServer {
 
 	// find server by prefix
 	for _, server := range config.Servers {
-		if server.Enabled && strings.HasPrefix(toolName, server.ToolPrefix) {
-			slog.Info("[EXT-PROC] Found matching server",
-				"toolName", toolName,
-				"serverPrefix", server.ToolPrefix,
-				"serverName", server.Name)
-			return server
+		if !server.Enabled {
+			continue
+		}
+		for _, prefix := range server.ToolNamePrefixes() {
+			if strings.HasPrefix(toolName, prefix) {
+				slog.Debug("[EXT-PROC] Found matching server",
+					"toolName", toolName,
+					"serverPrefix", prefix,
+					"serverName", server.Name)
+				return server
+			}
 		}
 	}
 
-	slog.Info("Tool name doesn't match any configured server prefix", "tool", toolName)
+	slog.Debug("Tool name doesn't match any configured server prefix", "tool", toolName)
+	return nil
+}
+
+// GetBoundServerInfo returns the server calls to the tool through the virtual server are bound to. It returns nil when
+// the virtual server has no binding for the tool or the bound server is not enabled
+func (config *MCPServersConfig) GetBoundServerInfo(virtualServer, toolName string) *MCPServer {
+	if config == nil || virtualServer == "" {
+		return nil
+	}
+	for _, vs := range config.VirtualServers {
+		if vs == nil || vs.Name != virtualServer {
+			continue
+		}
+		for _, binding := range vs.ToolBindings {
+			if binding.Tool != toolName {
+				continue
+			}
+			server := config.GetServerConfigByName(binding.Server)
+			if server == nil || !server.Enabled {
+				return nil
+			}
+			return server
+		}
+		return nil
+	}
 	return nil
 }
 
@@ -80,14 +125,232 @@ func (config *MCPServersConfig) GetServerConfigByName(serverName string) *MCPSer
 	return nil
 }
 
+// RouterRemovesAuthorizationForHost reports whether the router removes the client's Authorization header from requests
+// it forwards to the servers with the hostname. It is only removed when it is removed for every server with the hostname
+func (config *MCPServersConfig) RouterRemovesAuthorizationForHost(hostname string) bool {
+	found := false
+	for _, server := range config.Servers {
+		if server.Hostname != hostname {
+			continue
+		}
+		if !server.RouterRemovesAuthorization() {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
 // MCPServer represents a server
 type MCPServer struct {
 	Name       string
 	URL        string
 	ToolPrefix string
-	Enabled    bool
-	Hostname   string
-	Credential string // env var name for auth
+	// ToolPrefixAliases are further prefixes the server's tools are advertised and routed under. At most
+	// MaxToolPrefixAliases are allowed
+	ToolPrefixAliases []string
+	// ToolPrefixSeparator if set is put between the prefix and the tool name, e.g. __ advertises the tool get of the
+	// server with prefix weather as weather__get. Tool names must not contain it so stripping the prefix is unambiguous
+	ToolPrefixSeparator string
+	Enabled             bool
+	Hostname            string
+	Credential          string // env var name for auth
+	TLS                 *TLSConfig
+	// CredentialLocation is where the credential is sent: bearer, header:<Name> or query:<name>. Empty sends it unchanged in the Authorization header
+	CredentialLocation string
+	// AdditionalCredentials are sent with the credential for upstreams that need more than one credential component
+	AdditionalCredentials []AdditionalCredential
+	// PathRewrite if set is the path used for requests to the server instead of the path in the URL
+	PathRewrite string
+	// Priority orders servers when the broker limits the number of advertised tools
+	Priority int
+	// ToolWeights order the server's tools when the broker limits the number of advertised tools, keyed by the upstream tool name
+	ToolWeights map[string]int
+	// ToolRenames rewrite the upstream tool names before the prefix is added. They are applied in order
+	ToolRenames []ToolRename
+	// ToolTimeouts override the timeout of tool calls to individual tools, keyed by the upstream tool name
+	ToolTimeouts map[string]time.Duration
+	// ToolDefaultArguments are the arguments, as a JSON object, added to calls to individual tools when the client
+	// does not send them, keyed by the upstream tool name
+	ToolDefaultArguments map[string]string
+	// Tenant owns the server. With tenancy enabled only clients of the same tenant are listed its tools unless they are shared
+	Tenant string
+	// MaxUpstreamSessions caps the upstream sessions the router holds with the server. 0 is no limit
+	MaxUpstreamSessions int
+	// UpstreamSessionLimitBehavior is what happens to new gateway sessions when MaxUpstreamSessions is reached
+	UpstreamSessionLimitBehavior string
+	// UpstreamSessionMaxAge is how long the router uses an upstream session before initializing a new one. 0 is no maximum
+	UpstreamSessionMaxAge time.Duration
+	// MaxConcurrentToolCalls caps the tool calls the router has in flight to the server. 0 uses the router's default
+	MaxConcurrentToolCalls int
+	// MaxResponseBytes caps the size of the server's responses to tool calls. 0 is no limit
+	MaxResponseBytes int64
+	// ToolCallMeta if set changes the _meta of the tool calls the router forwards to the server
+	ToolCallMeta *ToolCallMeta
+	// ReadOnly only advertises and allows calls to the server's tools annotated as read-only
+	ReadOnly bool
+	// Cordoned stops the router creating new upstream sessions with the server. Existing sessions keep being used
+	Cordoned bool
+	// ForwardAuthorization forwards the client's Authorization header to the server instead of replacing it with the credential
+	ForwardAuthorization bool
+	// StartupProbe if set is how the broker checks the server until it first connects to it. It only applies to new
+	// connections so changing it does not reconnect the server
+	StartupProbe *StartupProbe
+	// FallbackTools are advertised in place of the server's tools while the broker cannot connect to it. Calls to
+	// them are rejected as the server is unavailable
+	FallbackTools []FallbackTool
+	// SyntheticTools if set make the server synthetic. The broker lists and answers calls to the tools itself with
+	// their canned responses and no upstream is connected, so clients can be tested against a predictable gateway
+	SyntheticTools []SyntheticTool
+}
+
+// Defaults of the settings of a startup probe that are not set
+const (
+	DefaultStartupProbePeriod           = 10 * time.Second
+	DefaultStartupProbeTimeout          = 30 * time.Second
+	DefaultStartupProbeFailureThreshold = 30
+)
+
+// StartupProbe is how the broker checks a server until it first connects to it. Settings that are not set use the
+// defaults
+type StartupProbe struct {
+	// Period is the interval between connection attempts during startup
+	Period time.Duration
+	// Timeout bounds the health check of each connection attempt during startup
+	Timeout time.Duration
+	// FailureThreshold is the number of failed attempts after which the server is failed rather than starting
+	FailureThreshold int
+}
+
+// WithDefaults returns the probe with the settings that are not set replaced by their defaults
+func (probe StartupProbe) WithDefaults() StartupProbe {
+	if probe.Period <= 0 {
+		probe.Period = DefaultStartupProbePeriod
+	}
+	if probe.Timeout <= 0 {
+		probe.Timeout = DefaultStartupProbeTimeout
+	}
+	if probe.FailureThreshold <= 0 {
+		probe.FailureThreshold = DefaultStartupProbeFailureThreshold
+	}
+	return probe
+}
+
+// MaxToolPrefixAliases is the most prefix aliases a server may have. Every alias advertises another copy of each of
+// the server's tools
+const MaxToolPrefixAliases = 3
+
+// StripToolPrefix returns the tool name without the longest of the server's prefixes it starts with. ok is false when
+// it starts with none of them
+func (mcpServer *MCPServer) StripToolPrefix(toolName string) (string, bool) {
+	stripped, ok := "", false
+	for _, prefix := range mcpServer.ToolNamePrefixes() {
+		if name, found := strings.CutPrefix(toolName, prefix); found && (!ok || len(name) < len(stripped)) {
+			stripped, ok = name, true
+		}
+	}
+	return stripped, ok
+}
+
+// ToolPrefixes returns the prefix of the server followed by its aliases
+func (mcpServer *MCPServer) ToolPrefixes() []string {
+	return append([]string{mcpServer.ToolPrefix}, mcpServer.ToolPrefixAliases...)
+}
+
+// ToolNamePrefixes returns what the names of the server's tools start with for the prefix and each of its aliases:
+// the prefix followed by the separator. An empty prefix is not followed by the separator
+func (mcpServer *MCPServer) ToolNamePrefixes() []string {
+	prefixes := mcpServer.ToolPrefixes()
+	if mcpServer.ToolPrefixSeparator == "" {
+		return prefixes
+	}
+	for i, prefix := range prefixes {
+		if prefix != "" {
+			prefixes[i] = prefix + mcpServer.ToolPrefixSeparator
+		}
+	}
+	return prefixes
+}
+
+// toolPrefixSeparatorPattern is what a separator may contain. Tool names are limited to these characters
+var toolPrefixSeparatorPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// ValidateToolPrefixSeparator returns an error if the separator has characters tool names may not contain
+func ValidateToolPrefixSeparator(separator string) error {
+	if !toolPrefixSeparatorPattern.MatchString(separator) {
+		return fmt.Errorf("tool prefix separator %q may only contain letters, digits, '_', '.' and '-'", separator)
+	}
+	return nil
+}
+
+// IsReadOnly returns true if the tool annotations declare the tool read-only. Tools without the hint are not read-only
+func IsReadOnly(annotations mcp.ToolAnnotation) bool {
+	return annotations.ReadOnlyHint != nil && *annotations.ReadOnlyHint
+}
+
+// ToolRename rewrites the parts of a tool name matching a regular expression, e.g. Match "^get_(.*)$" and
+// Replace "fetch_${1}" advertises the upstream tool get_weather as fetch_weather
+type ToolRename struct {
+	// Match is a regular expression matched against the tool name
+	Match string
+	// Replace is the replacement for each match. It may refer to capture groups as in regexp.Regexp.ReplaceAllString
+	Replace string
+}
+
+// ToolTimeout returns the timeout for calls to the upstream tool. ok is false when no timeout is set for the tool
+// and the timeout of the gateway's route applies
+func (mcpServer *MCPServer) ToolTimeout(upstreamToolName string) (time.Duration, bool) {
+	timeout, ok := mcpServer.ToolTimeouts[upstreamToolName]
+	if !ok || timeout <= 0 {
+		return 0, false
+	}
+	return timeout, true
+}
+
+// CompiledToolRename is a ToolRename with its expression compiled
+type CompiledToolRename struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// CompileToolRenames compiles the server's tool renames. Renames with an invalid expression are returned as errors and left out
+func (mcpServer *MCPServer) CompileToolRenames() ([]CompiledToolRename, []error) {
+	var compiled []CompiledToolRename
+	var errs []error
+	for i, rename := range mcpServer.ToolRenames {
+		match, err := regexp.Compile(rename.Match)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("toolRenames[%d]: %w", i, err))
+			continue
+		}
+		compiled = append(compiled, CompiledToolRename{match: match, replace: rename.Replace})
+	}
+	return compiled, errs
+}
+
+// RenameTool applies the renames in order to the tool name
+func RenameTool(renames []CompiledToolRename, name string) string {
+	for _, rename := range renames {
+		name = rename.match.ReplaceAllString(name, rename.replace)
+	}
+	return name
+}
+
+// TLSConfig holds the TLS settings used when connecting to an upstream MCP server
+type TLSConfig struct {
+	// CACert is a PEM encoded CA bundle used to verify the upstream. If empty the system pool is used
+	CACert string
+	// ServerName is the SNI and verification hostname for the upstream
+	ServerName string
+	// Host if set is sent as the Host header instead of the host of the upstream's URL
+	Host string
+}
+
+// AdditionalCredential is a credential value sent to the server with its main credential
+type AdditionalCredential struct {
+	Value string
+	// Location is where the value is sent: header:<Name> or query:<name>
+	Location string
 }
 
 // ID returns a unique id for the a registered server
@@ -96,16 +359,37 @@ func (mcpServer *MCPServer) ID() UpstreamMCPID {
 }
 
 // ConfigChanged checks if a server's config has changed in a way that will affect the gateway.
-// This means having a different name, prefix, hostname, or credential variable.
+// This means having a different name, url, prefix, prefix aliases, hostname, credential variable, credential location, additional credentials, TLS settings, tool renames or read-only setting.
+// Settings only used when routing tool calls, such as the path rewrite, tool timeouts, default arguments, cordon or concurrency limit, are read from the config by the router and are not compared.
 func (mcpServer *MCPServer) ConfigChanged(existingConfig MCPServer) bool {
 	return existingConfig.Name != mcpServer.Name ||
+		existingConfig.URL != mcpServer.URL ||
 		existingConfig.ToolPrefix != mcpServer.ToolPrefix ||
+		!slices.Equal(existingConfig.ToolPrefixAliases, mcpServer.ToolPrefixAliases) ||
 		existingConfig.Hostname != mcpServer.Hostname ||
-		existingConfig.Credential != mcpServer.Credential
+		existingConfig.Credential != mcpServer.Credential ||
+		existingConfig.CredentialLocation != mcpServer.CredentialLocation ||
+		!slices.Equal(existingConfig.AdditionalCredentials, mcpServer.AdditionalCredentials) ||
+		!existingConfig.TLS.Equal(mcpServer.TLS) ||
+		!slices.Equal(existingConfig.ToolRenames, mcpServer.ToolRenames) ||
+		existingConfig.ReadOnly != mcpServer.ReadOnly ||
+		!slices.Equal(existingConfig.SyntheticTools, mcpServer.SyntheticTools) ||
+		!slices.Equal(existingConfig.FallbackTools, mcpServer.FallbackTools)
 }
 
-// Path returns the path part of the mcp url
+// Equal reports whether two TLS configs are the same. Nil configs are only equal to each other
+func (tlsConfig *TLSConfig) Equal(other *TLSConfig) bool {
+	if tlsConfig == nil || other == nil {
+		return tlsConfig == other
+	}
+	return *tlsConfig == *other
+}
+
+// Path returns the path requests should be sent to. This is the path rewrite when set otherwise the path part of the mcp url
 func (mcpServer *MCPServer) Path() (string, error) {
+	if mcpServer.PathRewrite != "" {
+		return mcpServer.PathRewrite, nil
+	}
 	parsedURL, err := url.Parse(mcpServer.URL)
 	if err != nil {
 		return "", err
@@ -117,9 +401,262 @@ func (mcpServer *MCPServer) Path() (string, error) {
 type VirtualServer struct {
 	Name  string
 	Tools []string
+	// UnavailableBehavior is how tools/list responds when all of the servers backing the tools are unhealthy
+	UnavailableBehavior string
+	// Title and Description are returned to clients selecting the virtual server when they initialize
+	Title       string
+	Description string
+	// ToolBindings route calls to tools made through the virtual server to a specific server
+	ToolBindings []ToolBinding
+}
+
+// ToolBinding routes calls to a virtual server's tool to the named server rather than the server its prefix matches
+type ToolBinding struct {
+	Tool   string
+	Server string
+}
+
+// ClientToolFilter limits the tools listed to downstream clients whose initialize clientInfo matches.
+// Patterns use path.Match syntax, e.g. "admin-*". The filter only changes what tools/list advertises, tools/call is
+// not checked against it as clientInfo is self-reported by the client and so cannot authorize a call.
+type ClientToolFilter struct {
+	// ClientName is matched against the client name
+	ClientName string
+	// ClientVersion is matched against the client version. Empty matches any version
+	ClientVersion string
+	// Tools are the gateway tool names, including any prefix, listed to matching clients
+	Tools []string
+}
+
+// Matches returns true if the client name and version match the filter's patterns. Invalid patterns never match
+func (f *ClientToolFilter) Matches(name, version string) bool {
+	if ok, _ := path.Match(f.ClientName, name); !ok {
+		return false
+	}
+	if f.ClientVersion == "" {
+		return true
+	}
+	ok, _ := path.Match(f.ClientVersion, version)
+	return ok
+}
+
+// DefaultTenantClaim is the claim of the tenant header JWT holding the client's tenant when no claim is configured
+const DefaultTenantClaim = "tenant"
+
+// AllTenants in the tenants of a tool share matches every tenant, including clients without one
+const AllTenants = "*"
+
+// Tenancy isolates the tools of servers owned by different tenants. Tools are only listed to clients of the tenant
+// owning their server unless they are shared. Clients without a tenant are only listed tools shared with all tenants.
+type Tenancy struct {
+	// Enabled turns on tenant isolation
+	Enabled bool
+	// Claim is the claim of the signed x-mcp-tenant header holding the client's tenant. Defaults to DefaultTenantClaim
+	Claim string
+	// SharedTools lists tools visible to clients of tenants other than the one owning the server
+	SharedTools []*SharedTools
+}
+
+// SharedTools shares tools of a server with other tenants
+type SharedTools struct {
+	// Server is the name of the server, namespace/name, providing the tools
+	Server string
+	// Tools are the gateway tool names, including any prefix, that are shared. Empty shares every tool of the server
+	Tools []string
+	// Tenants the tools are shared with. AllTenants shares them with every client
+	Tenants []string
+}
+
+// TenantClaim returns the claim holding the client's tenant
+func (t *Tenancy) TenantClaim() string {
+	if t.Claim == "" {
+		return DefaultTenantClaim
+	}
+	return t.Claim
+}
+
+// Visible returns true if a client of clientTenant may be listed the tool of a server owned by serverTenant.
+// An empty client tenant never matches a server's tenant, so servers without a tenant are only visible when shared.
+func (t *Tenancy) Visible(clientTenant, serverName, serverTenant, toolName string) bool {
+	if clientTenant != "" && clientTenant == serverTenant {
+		return true
+	}
+	for _, share := range t.SharedTools {
+		if share.Server != serverName {
+			continue
+		}
+		if len(share.Tools) > 0 && !slices.Contains(share.Tools, toolName) {
+			continue
+		}
+		if slices.Contains(share.Tenants, AllTenants) || (clientTenant != "" && slices.Contains(share.Tenants, clientTenant)) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// UpstreamSessionLimitReject fails the tool calls of gateway sessions that would exceed the upstream session limit
+	UpstreamSessionLimitReject = "Reject"
+	// UpstreamSessionLimitReuse shares an existing upstream session with gateway sessions that would exceed the limit
+	UpstreamSessionLimitReuse = "Reuse"
+)
+
+const (
+	// ToolCallMetaPassThrough forwards the _meta of a tool call as the client sent it
+	ToolCallMetaPassThrough = "PassThrough"
+	// ToolCallMetaStripGatewayFields removes the fields the gateway sets in the _meta of listed tools from the _meta
+	// of a tool call
+	ToolCallMetaStripGatewayFields = "StripGatewayFields"
+	// ProgressTokenMetaField is the field of _meta a client asks for progress notifications with. It is always
+	// forwarded as the client sent it
+	ProgressTokenMetaField = "progressToken"
+)
+
+// ToolCallMeta is how the _meta of tool calls is forwarded to a server
+type ToolCallMeta struct {
+	// Mode is ToolCallMetaPassThrough or ToolCallMetaStripGatewayFields. Empty is ToolCallMetaPassThrough
+	Mode string
+	// Inject are fields set in the _meta of every tool call, replacing those sent by the client
+	Inject []MetaField
 }
 
+// MetaField is a field set in the _meta of a tool call
+type MetaField struct {
+	Name  string
+	Value string
+}
+
+const (
+	// UnavailableBehaviorEmpty returns no tools when every backing server is unhealthy
+	UnavailableBehaviorEmpty = "Empty"
+	// UnavailableBehaviorDegraded returns the tools marked as degraded when every backing server is unhealthy
+	UnavailableBehaviorDegraded = "Degraded"
+)
+
 // Observer provides an interface to implement in order to register as an Observer of config changes
 type Observer interface {
 	OnConfigChange(ctx context.Context, config *MCPServersConfig)
 }
+
+const (
+	// CredentialLocationBearer sends the credential in the Authorization header with a Bearer prefix
+	CredentialLocationBearer = "bearer"
+	// CredentialLocationHeaderPrefix prefixes the name of the header the credential is sent in
+	CredentialLocationHeaderPrefix = "header:"
+	// CredentialLocationQueryPrefix prefixes the name of the query parameter the credential is sent as
+	CredentialLocationQueryPrefix = "query:"
+)
+
+// CredentialHeader returns the header name and value the credential is sent in.
+// ok is false when there is no credential or it is sent as a query parameter.
+func (mcpServer *MCPServer) CredentialHeader() (name, value string, ok bool) {
+	if mcpServer.Credential == "" {
+		return "", "", false
+	}
+	location := mcpServer.CredentialLocation
+	switch {
+	case location == "":
+		return "Authorization", mcpServer.Credential, true
+	case location == CredentialLocationBearer:
+		if len(mcpServer.Credential) > 7 && strings.EqualFold(mcpServer.Credential[:7], "bearer ") {
+			return "Authorization", mcpServer.Credential, true
+		}
+		return "Authorization", "Bearer " + mcpServer.Credential, true
+	case strings.HasPrefix(location, CredentialLocationHeaderPrefix):
+		name = strings.TrimPrefix(location, CredentialLocationHeaderPrefix)
+		return name, mcpServer.Credential, name != ""
+	}
+	return "", "", false
+}
+
+// RouterCredentialHeader returns the header name and value the router sets on requests it forwards to the server.
+// The credential replaces the client's Authorization header unless the server forwards it. ok is false when the
+// router sets no credential header.
+func (mcpServer *MCPServer) RouterCredentialHeader() (name, value string, ok bool) {
+	name, value, ok = mcpServer.CredentialHeader()
+	if ok && mcpServer.ForwardAuthorization && strings.EqualFold(name, "Authorization") {
+		return "", "", false
+	}
+	return name, value, ok
+}
+
+// CredentialHeaders returns the headers the credential and the additional credentials are sent in, keyed by header name
+func (mcpServer *MCPServer) CredentialHeaders() map[string]string {
+	headers := map[string]string{}
+	if name, value, ok := mcpServer.CredentialHeader(); ok {
+		headers[name] = value
+	}
+	for name, value := range mcpServer.additionalCredentialHeaders() {
+		headers[name] = value
+	}
+	return headers
+}
+
+// RouterCredentialHeaders returns the credential headers the router sets on requests it forwards to the server. As
+// with RouterCredentialHeader, none replace the client's Authorization header when the server forwards it.
+func (mcpServer *MCPServer) RouterCredentialHeaders() map[string]string {
+	headers := map[string]string{}
+	if name, value, ok := mcpServer.RouterCredentialHeader(); ok {
+		headers[name] = value
+	}
+	for name, value := range mcpServer.additionalCredentialHeaders() {
+		if mcpServer.ForwardAuthorization && strings.EqualFold(name, "Authorization") {
+			continue
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// RouterRemovesAuthorization reports whether the router removes the client's Authorization header from requests it
+// forwards to the server. A server with a credential is not sent the client's token unless it forwards it. A
+// credential sent in the Authorization header replaces the client's header so it is not removed.
+func (mcpServer *MCPServer) RouterRemovesAuthorization() bool {
+	if mcpServer.ForwardAuthorization || (mcpServer.Credential == "" && len(mcpServer.AdditionalCredentials) == 0) {
+		return false
+	}
+	for name := range mcpServer.RouterCredentialHeaders() {
+		if strings.EqualFold(name, "Authorization") {
+			return false
+		}
+	}
+	return true
+}
+
+func (mcpServer *MCPServer) additionalCredentialHeaders() map[string]string {
+	headers := map[string]string{}
+	for _, credential := range mcpServer.AdditionalCredentials {
+		if name, ok := strings.CutPrefix(credential.Location, CredentialLocationHeaderPrefix); ok && name != "" && credential.Value != "" {
+			headers[name] = credential.Value
+		}
+	}
+	return headers
+}
+
+// WithCredentialQuery returns the url or path with the credential and additional credentials sent as query
+// parameters added. Otherwise it is returned unchanged.
+func (mcpServer *MCPServer) WithCredentialQuery(rawURL string) (string, error) {
+	params := map[string]string{}
+	if name, ok := strings.CutPrefix(mcpServer.CredentialLocation, CredentialLocationQueryPrefix); ok && name != "" && mcpServer.Credential != "" {
+		params[name] = mcpServer.Credential
+	}
+	for _, credential := range mcpServer.AdditionalCredentials {
+		if name, ok := strings.CutPrefix(credential.Location, CredentialLocationQueryPrefix); ok && name != "" && credential.Value != "" {
+			params[name] = credential.Value
+		}
+	}
+	if len(params) == 0 {
+		return rawURL, nil
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsedURL.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), nil
+}
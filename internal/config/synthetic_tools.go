@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SyntheticTool is a tool served by the broker itself that returns a canned response to every call
+type SyntheticTool struct {
+	Name        string
+	Description string
+	// InputSchema is the JSON schema of the tool's arguments as a JSON object. Empty accepts any arguments
+	InputSchema string
+	// Response is the text returned by every call to the tool
+	Response string
+	// IsError returns the response as a tool error rather than a result
+	IsError bool
+}
+
+// IsSynthetic reports whether the server is served in-process by the broker from its synthetic tools rather than by
+// a real upstream. Synthetic servers need no url or hostname
+func (mcpServer *MCPServer) IsSynthetic() bool {
+	return len(mcpServer.SyntheticTools) > 0
+}
+
+// MCPTool returns the tool as it is listed by the server
+func (tool SyntheticTool) MCPTool() (mcp.Tool, error) {
+	return newMCPTool(tool.Name, tool.Description, tool.InputSchema)
+}
+
+// newMCPTool returns a tool defined in config. An empty inputSchema accepts any arguments
+func newMCPTool(name, description, inputSchema string) (mcp.Tool, error) {
+	if inputSchema == "" {
+		return mcp.NewTool(name, mcp.WithDescription(description)), nil
+	}
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(inputSchema), &schema); err != nil {
+		return mcp.Tool{}, fmt.Errorf("inputSchema must be a JSON object: %w", err)
+	}
+	if schema == nil {
+		return mcp.Tool{}, fmt.Errorf("inputSchema must be a JSON object")
+	}
+	return mcp.NewToolWithRawSchema(name, description, json.RawMessage(inputSchema)), nil
+}
+
+// Result returns the canned result of a call to the tool
+func (tool SyntheticTool) Result() *mcp.CallToolResult {
+	if tool.IsError {
+		return mcp.NewToolResultError(tool.Response)
+	}
+	return mcp.NewToolResultText(tool.Response)
+}
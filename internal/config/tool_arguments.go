@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultArguments returns the arguments added to calls to the upstream tool when the client does not send them.
+// Tool names are matched ignoring case as the keys of the config are lower cased when it is loaded
+func (mcpServer *MCPServer) DefaultArguments(upstreamToolName string) (map[string]any, error) {
+	raw, ok := mcpServer.ToolDefaultArguments[upstreamToolName]
+	if !ok {
+		for tool, arguments := range mcpServer.ToolDefaultArguments {
+			if strings.EqualFold(tool, upstreamToolName) {
+				raw, ok = arguments, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return parseArguments(raw)
+}
+
+// parseArguments decodes default arguments, which must be a JSON object
+func parseArguments(raw string) (map[string]any, error) {
+	var arguments map[string]any
+	if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+		return nil, fmt.Errorf("default arguments must be a JSON object: %w", err)
+	}
+	if arguments == nil {
+		return nil, fmt.Errorf("default arguments must be a JSON object")
+	}
+	return arguments, nil
+}
+
+// CheckArguments returns an error if an argument is not a property of the tool's input schema or does not have the
+// property's type. Schemas that declare no properties accept any argument
+func CheckArguments(arguments map[string]any, schema mcp.ToolInputSchema) error {
+	if len(schema.Properties) == 0 {
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(arguments)) {
+		property, ok := schema.Properties[name]
+		if !ok {
+			return fmt.Errorf("argument %s is not in the tool's input schema", name)
+		}
+		propertySchema, _ := property.(map[string]any)
+		if !matchesType(arguments[name], propertySchema["type"]) {
+			return fmt.Errorf("argument %s is not of type %v", name, propertySchema["type"])
+		}
+	}
+	return nil
+}
+
+// matchesType reports whether a decoded JSON value has the JSON schema type, which may be a name or a list of names.
+// A missing type matches any value
+func matchesType(value any, schemaType any) bool {
+	switch t := schemaType.(type) {
+	case nil:
+		return true
+	case string:
+		return valueHasType(value, t)
+	case []any:
+		for _, name := range t {
+			if name, ok := name.(string); ok && valueHasType(value, name) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func valueHasType(value any, name string) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case string:
+		return name == "string"
+	case bool:
+		return name == "boolean"
+	case float64:
+		return name == "number" || (name == "integer" && v == math.Trunc(v))
+	case map[string]any:
+		return name == "object"
+	case []any:
+		return name == "array"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,316 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var credentialLocationPattern = regexp.MustCompile(`^(bearer|header:[A-Za-z0-9-]+|query:[A-Za-z0-9_.~-]+)$`)
+
+// additionalCredentialLocationPattern matches where an additional credential may be sent. Only the main credential
+// is sent as a bearer token
+var additionalCredentialLocationPattern = regexp.MustCompile(`^(header:[A-Za-z0-9-]+|query:[A-Za-z0-9_.~-]+)$`)
+
+// FieldError is a single problem found in the config. Field is the path to the offending value, e.g. servers[1].url
+type FieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors holds every problem found in the config
+type ValidationErrors []FieldError
+
+// Error implements the error interface
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks the servers, virtual servers and client tool filters and returns every problem found rather than stopping at the first.
+// It returns nil when the config is valid.
+func (config *MCPServersConfig) Validate() ValidationErrors {
+	var errs ValidationErrors
+	serverIDs := map[UpstreamMCPID]int{}
+	for i, server := range config.Servers {
+		field := fmt.Sprintf("servers[%d]", i)
+		if server == nil {
+			errs = append(errs, FieldError{Field: field, Message: "server must not be empty"})
+			continue
+		}
+		errs = append(errs, validateServer(field, server)...)
+		if first, ok := serverIDs[server.ID()]; ok {
+			errs = append(errs, FieldError{Field: field, Value: string(server.ID()), Message: fmt.Sprintf("duplicate server id, also used by servers[%d]", first)})
+		} else {
+			serverIDs[server.ID()] = i
+		}
+	}
+
+	virtualServerNames := map[string]int{}
+	for i, vs := range config.VirtualServers {
+		field := fmt.Sprintf("virtualServers[%d]", i)
+		if vs == nil {
+			errs = append(errs, FieldError{Field: field, Message: "virtual server must not be empty"})
+			continue
+		}
+		switch vs.UnavailableBehavior {
+		case "", UnavailableBehaviorEmpty, UnavailableBehaviorDegraded:
+		default:
+			errs = append(errs, FieldError{Field: field + ".unavailableBehavior", Value: vs.UnavailableBehavior, Message: fmt.Sprintf("unavailableBehavior must be %s or %s", UnavailableBehaviorEmpty, UnavailableBehaviorDegraded)})
+		}
+		errs = append(errs, config.validateToolBindings(field, vs)...)
+		if vs.Name == "" {
+			errs = append(errs, FieldError{Field: field + ".name", Message: "name is required"})
+			continue
+		}
+		if first, ok := virtualServerNames[vs.Name]; ok {
+			errs = append(errs, FieldError{Field: field + ".name", Value: vs.Name, Message: fmt.Sprintf("duplicate virtual server name, also used by virtualServers[%d]", first)})
+		} else {
+			virtualServerNames[vs.Name] = i
+		}
+	}
+
+	for i, filter := range config.ClientToolFilters {
+		field := fmt.Sprintf("clientToolFilters[%d]", i)
+		if filter == nil {
+			errs = append(errs, FieldError{Field: field, Message: "client tool filter must not be empty"})
+			continue
+		}
+		if filter.ClientName == "" {
+			errs = append(errs, FieldError{Field: field + ".clientName", Message: "clientName is required"})
+		} else if _, err := path.Match(filter.ClientName, ""); err != nil {
+			errs = append(errs, FieldError{Field: field + ".clientName", Value: filter.ClientName, Message: "clientName is not a valid pattern"})
+		}
+		if _, err := path.Match(filter.ClientVersion, ""); err != nil {
+			errs = append(errs, FieldError{Field: field + ".clientVersion", Value: filter.ClientVersion, Message: "clientVersion is not a valid pattern"})
+		}
+	}
+
+	if config.Tenancy != nil {
+		for i, share := range config.Tenancy.SharedTools {
+			field := fmt.Sprintf("tenancy.sharedTools[%d]", i)
+			if share == nil {
+				errs = append(errs, FieldError{Field: field, Message: "shared tools must not be empty"})
+				continue
+			}
+			if share.Server == "" {
+				errs = append(errs, FieldError{Field: field + ".server", Message: "server is required"})
+			}
+			if len(share.Tenants) == 0 {
+				errs = append(errs, FieldError{Field: field + ".tenants", Message: "at least one tenant is required"})
+			}
+		}
+	}
+	return errs
+}
+
+// validateServer returns the problems with a single server. Duplicate ids are checked across all servers by the caller
+func validateServer(field string, server *MCPServer) ValidationErrors {
+	var errs ValidationErrors
+	if server.Name == "" {
+		errs = append(errs, FieldError{Field: field + ".name", Message: "name is required"})
+	}
+	// synthetic servers are served by the broker so have no upstream to address
+	if server.Hostname == "" && !server.IsSynthetic() {
+		errs = append(errs, FieldError{Field: field + ".hostname", Message: "hostname is required"})
+	}
+	if err := validateServerURL(server.URL); err != "" && !server.IsSynthetic() {
+		errs = append(errs, FieldError{Field: field + ".url", Value: server.URL, Message: err})
+	}
+	syntheticToolNames := map[string]int{}
+	for j, tool := range server.SyntheticTools {
+		toolField := fmt.Sprintf("%s.syntheticTools[%d]", field, j)
+		if tool.Name == "" {
+			errs = append(errs, FieldError{Field: toolField + ".name", Message: "name is required"})
+		} else if first, ok := syntheticToolNames[tool.Name]; ok {
+			errs = append(errs, FieldError{Field: toolField + ".name", Value: tool.Name, Message: fmt.Sprintf("duplicate tool name, also used by syntheticTools[%d]", first)})
+		} else {
+			syntheticToolNames[tool.Name] = j
+		}
+		if _, err := tool.MCPTool(); err != nil {
+			errs = append(errs, FieldError{Field: toolField + ".inputSchema", Value: tool.InputSchema, Message: err.Error()})
+		}
+	}
+	fallbackToolNames := map[string]int{}
+	for j, tool := range server.FallbackTools {
+		toolField := fmt.Sprintf("%s.fallbackTools[%d]", field, j)
+		if tool.Name == "" {
+			errs = append(errs, FieldError{Field: toolField + ".name", Message: "name is required"})
+		} else if first, ok := fallbackToolNames[tool.Name]; ok {
+			errs = append(errs, FieldError{Field: toolField + ".name", Value: tool.Name, Message: fmt.Sprintf("duplicate tool name, also used by fallbackTools[%d]", first)})
+		} else {
+			fallbackToolNames[tool.Name] = j
+		}
+		if _, err := tool.MCPTool(); err != nil {
+			errs = append(errs, FieldError{Field: toolField + ".inputSchema", Value: tool.InputSchema, Message: err.Error()})
+		}
+	}
+	if server.PathRewrite != "" && !strings.HasPrefix(server.PathRewrite, "/") {
+		errs = append(errs, FieldError{Field: field + ".pathRewrite", Value: server.PathRewrite, Message: "pathRewrite must be an absolute path"})
+	}
+	if server.CredentialLocation != "" && !credentialLocationPattern.MatchString(server.CredentialLocation) {
+		errs = append(errs, FieldError{Field: field + ".credentialLocation", Value: server.CredentialLocation, Message: "credentialLocation must be bearer, header:<Name> or query:<name>"})
+	}
+	for j, credential := range server.AdditionalCredentials {
+		credentialField := fmt.Sprintf("%s.additionalCredentials[%d]", field, j)
+		if credential.Value == "" {
+			errs = append(errs, FieldError{Field: credentialField + ".value", Message: "value is required"})
+		}
+		if !additionalCredentialLocationPattern.MatchString(credential.Location) {
+			errs = append(errs, FieldError{Field: credentialField + ".location", Value: credential.Location, Message: "location must be header:<Name> or query:<name>"})
+		}
+	}
+	if len(server.ToolPrefixAliases) > MaxToolPrefixAliases {
+		errs = append(errs, FieldError{Field: field + ".toolPrefixAliases", Value: strconv.Itoa(len(server.ToolPrefixAliases)), Message: fmt.Sprintf("at most %d tool prefix aliases are allowed", MaxToolPrefixAliases)})
+	}
+	for j, alias := range server.ToolPrefixAliases {
+		aliasField := fmt.Sprintf("%s.toolPrefixAliases[%d]", field, j)
+		switch {
+		case alias == "":
+			errs = append(errs, FieldError{Field: aliasField, Message: "tool prefix alias must not be empty"})
+		// the alias is at j+1 in the tool prefixes so finding it earlier means it repeats the prefix or another alias
+		case slices.Index(server.ToolPrefixes(), alias) <= j:
+			errs = append(errs, FieldError{Field: aliasField, Value: alias, Message: "tool prefix alias duplicates the tool prefix or another alias"})
+		}
+	}
+	for j, rename := range server.ToolRenames {
+		renameField := fmt.Sprintf("%s.toolRenames[%d].match", field, j)
+		if rename.Match == "" {
+			errs = append(errs, FieldError{Field: renameField, Message: "match is required"})
+		} else if _, err := regexp.Compile(rename.Match); err != nil {
+			errs = append(errs, FieldError{Field: renameField, Value: rename.Match, Message: fmt.Sprintf("match is not a valid regular expression: %v", err)})
+		}
+	}
+	for _, tool := range slices.Sorted(maps.Keys(server.ToolTimeouts)) {
+		if timeout := server.ToolTimeouts[tool]; timeout <= 0 {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("%s.toolTimeouts.%s", field, tool), Value: timeout.String(), Message: "timeout must be greater than 0"})
+		}
+	}
+	for _, tool := range slices.Sorted(maps.Keys(server.ToolDefaultArguments)) {
+		if _, err := parseArguments(server.ToolDefaultArguments[tool]); err != nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("%s.toolDefaultArguments.%s", field, tool), Value: server.ToolDefaultArguments[tool], Message: err.Error()})
+		}
+	}
+	if server.MaxUpstreamSessions < 0 {
+		errs = append(errs, FieldError{Field: field + ".maxUpstreamSessions", Value: strconv.Itoa(server.MaxUpstreamSessions), Message: "maxUpstreamSessions must not be negative"})
+	}
+	if server.UpstreamSessionMaxAge < 0 {
+		errs = append(errs, FieldError{Field: field + ".upstreamSessionMaxAge", Value: server.UpstreamSessionMaxAge.String(), Message: "upstreamSessionMaxAge must not be negative"})
+	}
+	if server.MaxConcurrentToolCalls < 0 {
+		errs = append(errs, FieldError{Field: field + ".maxConcurrentToolCalls", Value: strconv.Itoa(server.MaxConcurrentToolCalls), Message: "maxConcurrentToolCalls must not be negative"})
+	}
+	if server.MaxResponseBytes < 0 {
+		errs = append(errs, FieldError{Field: field + ".maxResponseBytes", Value: strconv.FormatInt(server.MaxResponseBytes, 10), Message: "maxResponseBytes must not be negative"})
+	}
+	if probe := server.StartupProbe; probe != nil {
+		if probe.Period < 0 {
+			errs = append(errs, FieldError{Field: field + ".startupProbe.period", Value: probe.Period.String(), Message: "period must not be negative"})
+		}
+		if probe.Timeout < 0 {
+			errs = append(errs, FieldError{Field: field + ".startupProbe.timeout", Value: probe.Timeout.String(), Message: "timeout must not be negative"})
+		}
+		if probe.FailureThreshold < 0 {
+			errs = append(errs, FieldError{Field: field + ".startupProbe.failureThreshold", Value: strconv.Itoa(probe.FailureThreshold), Message: "failureThreshold must not be negative"})
+		}
+	}
+	if meta := server.ToolCallMeta; meta != nil {
+		errs = append(errs, validateToolCallMeta(field+".toolCallMeta", meta)...)
+	}
+	switch server.UpstreamSessionLimitBehavior {
+	case "", UpstreamSessionLimitReject, UpstreamSessionLimitReuse:
+	default:
+		errs = append(errs, FieldError{Field: field + ".upstreamSessionLimitBehavior", Value: server.UpstreamSessionLimitBehavior, Message: fmt.Sprintf("upstreamSessionLimitBehavior must be %s or %s", UpstreamSessionLimitReject, UpstreamSessionLimitReuse)})
+	}
+	return errs
+}
+
+// validateToolCallMeta checks the mode is known and each injected field has a name of its own. The progress token
+// belongs to the client so it cannot be injected
+func validateToolCallMeta(field string, meta *ToolCallMeta) []FieldError {
+	var errs []FieldError
+	switch meta.Mode {
+	case "", ToolCallMetaPassThrough, ToolCallMetaStripGatewayFields:
+	default:
+		errs = append(errs, FieldError{Field: field + ".mode", Value: meta.Mode, Message: fmt.Sprintf("mode must be %s or %s", ToolCallMetaPassThrough, ToolCallMetaStripGatewayFields)})
+	}
+	injected := map[string]int{}
+	for i, metaField := range meta.Inject {
+		nameField := fmt.Sprintf("%s.inject[%d].name", field, i)
+		if first, ok := injected[metaField.Name]; ok {
+			errs = append(errs, FieldError{Field: nameField, Value: metaField.Name, Message: fmt.Sprintf("field is already injected by inject[%d]", first)})
+			continue
+		}
+		injected[metaField.Name] = i
+		switch metaField.Name {
+		case "":
+			errs = append(errs, FieldError{Field: nameField, Message: "name is required"})
+		case ProgressTokenMetaField:
+			errs = append(errs, FieldError{Field: nameField, Value: metaField.Name, Message: "progressToken is set by the client and cannot be injected"})
+		}
+	}
+	return errs
+}
+
+// validateServerURL returns a description of what is wrong with the url or an empty string if it is valid
+func validateServerURL(rawURL string) string {
+	if rawURL == "" {
+		return "url is required"
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Sprintf("url is invalid: %v", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "url must use the http or https scheme"
+	}
+	if parsedURL.Host == "" {
+		return "url must include a host"
+	}
+	return ""
+}
+
+// validateToolBindings checks each of the virtual server's tool bindings is for one of its tools and names a
+// configured server whose prefix matches the tool
+func (config *MCPServersConfig) validateToolBindings(field string, vs *VirtualServer) []FieldError {
+	var errs []FieldError
+	bound := map[string]int{}
+	for i, binding := range vs.ToolBindings {
+		bindingField := fmt.Sprintf("%s.toolBindings[%d]", field, i)
+		if binding.Tool == "" {
+			errs = append(errs, FieldError{Field: bindingField + ".tool", Message: "tool is required"})
+			continue
+		}
+		if first, ok := bound[binding.Tool]; ok {
+			errs = append(errs, FieldError{Field: bindingField + ".tool", Value: binding.Tool, Message: fmt.Sprintf("tool is already bound by toolBindings[%d]", first)})
+			continue
+		}
+		bound[binding.Tool] = i
+		if !slices.Contains(vs.Tools, binding.Tool) {
+			errs = append(errs, FieldError{Field: bindingField + ".tool", Value: binding.Tool, Message: "tool is not one of the virtual server's tools"})
+		}
+		server := config.GetServerConfigByName(binding.Server)
+		if server == nil {
+			errs = append(errs, FieldError{Field: bindingField + ".server", Value: binding.Server, Message: "server is not configured"})
+			continue
+		}
+		if _, ok := server.StripToolPrefix(binding.Tool); !ok {
+			errs = append(errs, FieldError{Field: bindingField + ".server", Value: binding.Server, Message: fmt.Sprintf("no tool prefix of the server matches tool %s", binding.Tool)})
+		}
+	}
+	return errs
+}
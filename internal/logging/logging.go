@@ -0,0 +1,37 @@
+// Package logging sets up the slog logger shared by the broker, router and controller so that
+// --log-format and --log-level behave the same for every component
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// FormatText writes logs as key=value text
+	FormatText = "txt"
+	// FormatJSON writes logs as structured JSON
+	FormatJSON = "json"
+)
+
+// New returns a logger writing to w in the given format. The level follows slog so 0=info, 4=warn, 8=error and -4=debug.
+// Records written with a context carrying a request id include it
+func New(w io.Writer, format string, level int) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: slog.Level(level)}
+	switch format {
+	case FormatText, "":
+		return slog.New(requestIDHandler{slog.NewTextHandler(w, opts)}), nil
+	case FormatJSON:
+		return slog.New(requestIDHandler{slog.NewJSONHandler(w, opts)}), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q: must be %s or %s", format, FormatText, FormatJSON)
+	}
+}
+
+// Logr adapts the logger for controller-runtime which logs through logr
+func Logr(logger *slog.Logger) logr.Logger {
+	return logr.FromSlogHandler(logger.Handler())
+}
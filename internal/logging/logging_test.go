@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Format      string
+		Level       int
+		ExpectJSON  bool
+		ExpectDebug bool
+		ExpectError bool
+	}{
+		{
+			Name:   "text at info",
+			Format: FormatText,
+			Level:  int(slog.LevelInfo),
+		},
+		{
+			Name:        "default format at debug",
+			Format:      "",
+			Level:       int(slog.LevelDebug),
+			ExpectDebug: true,
+		},
+		{
+			Name:       "json at info",
+			Format:     FormatJSON,
+			Level:      int(slog.LevelInfo),
+			ExpectJSON: true,
+		},
+		{
+			Name:        "unknown format",
+			Format:      "yaml",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			logger, err := New(out, tc.Format, tc.Level)
+			if tc.ExpectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			logger.Debug("debug message")
+			logger.Info("info message", "key", "value")
+			require.Equal(t, tc.ExpectDebug, strings.Contains(out.String(), "debug message"))
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			last := lines[len(lines)-1]
+			if tc.ExpectJSON {
+				entry := map[string]any{}
+				require.NoError(t, json.Unmarshal([]byte(last), &entry))
+				require.Equal(t, "info message", entry["msg"])
+				require.Equal(t, "value", entry["key"])
+				return
+			}
+			require.Contains(t, last, `msg="info message" key=value`)
+		})
+	}
+}
+
+func TestLogr(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(out, FormatJSON, int(slog.LevelInfo))
+	require.NoError(t, err)
+
+	Logr(logger).WithName("controller").Info("reconciled", "name", "server")
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, "reconciled", entry["msg"])
+	require.Equal(t, "server", entry["name"])
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the id that correlates the logs of the broker, router and upstream MCP servers for a request.
+// Envoy sets it on requests that arrive without one
+const RequestIDHeader = "x-request-id"
+
+// requestIDKey is the attribute request ids are logged under
+const requestIDKey = "request_id"
+
+type requestIDContextKey struct{}
+
+// NewRequestID returns a new request id for a request that arrived without one
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ContextWithRequestID returns a context whose log records carry the request id
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id of the context or "" if it has none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// RequestIDHandler adopts the request id sent by the client, or mints one, adds it to the request's context so logs
+// written with the context carry it, and returns it to the client in the response headers
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), requestID)))
+	})
+}
+
+// requestIDHandler adds the request id of the context to log records written with one
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		record = record.Clone()
+		record.AddAttrs(slog.String(requestIDKey, requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
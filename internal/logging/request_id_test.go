@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		RequestID       string
+		ExpectRequestID string
+	}{
+		{Name: "adopts the client's request id", RequestID: "client-request", ExpectRequestID: "client-request"},
+		{Name: "mints a request id"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			logger, err := New(out, FormatJSON, int(slog.LevelInfo))
+			require.NoError(t, err)
+			var forwarded string
+			handler := RequestIDHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Get(RequestIDHeader)
+				logger.InfoContext(r.Context(), "handled request")
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tc.RequestID != "" {
+				req.Header.Set(RequestIDHeader, tc.RequestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			requestID := w.Result().Header.Get(RequestIDHeader)
+			require.NotEmpty(t, requestID)
+			if tc.ExpectRequestID != "" {
+				require.Equal(t, tc.ExpectRequestID, requestID)
+			}
+			require.Equal(t, requestID, forwarded)
+			entry := map[string]any{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+			require.Equal(t, requestID, entry["request_id"])
+		})
+	}
+}
+
+func TestRequestIDLogged(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := New(out, FormatText, int(slog.LevelInfo))
+	require.NoError(t, err)
+	logger = logger.With("component", "router")
+
+	logger.InfoContext(ContextWithRequestID(context.Background(), "abc123"), "routing tool call")
+	require.Contains(t, out.String(), "component=router request_id=abc123")
+
+	out.Reset()
+	logger.InfoContext(context.Background(), "routing tool call")
+	require.NotContains(t, out.String(), "request_id")
+}
@@ -0,0 +1,116 @@
+package mcprouter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cancellationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_cancellations_total",
+	Help: "notifications/cancelled sent by clients, by whether they were forwarded to the MCP server handling the cancelled tool call or sent to the broker as it was not in flight",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(cancellationsTotal)
+}
+
+// inFlightToolCallsKey is the session cache key holding the server handling each tool call of the gateway session
+// that has not completed, keyed by JSON-RPC id. It is kept in the shared cache so a cancellation is forwarded by
+// whichever router replica receives it
+func inFlightToolCallsKey(gatewaySession string) string {
+	return "tool-calls-in-flight:" + gatewaySession
+}
+
+// trackToolCall records the server handling the tool call until the returned untrack is called. Each call is stored
+// with a token so untrack may be called more than once and does not remove a later call reusing the same id. A call
+// that cannot be recorded is not tracked and its cancellation is sent to the broker
+func (s *ExtProcServer) trackToolCall(ctx context.Context, gatewaySession string, id int, serverName string) func() {
+	ctx = context.WithoutCancel(ctx)
+	key := inFlightToolCallsKey(gatewaySession)
+	field := strconv.Itoa(id)
+	value := serverName + " " + uuid.NewString()
+	if _, err := s.SessionCache.AddSession(ctx, key, field, value); err != nil {
+		s.Logger.ErrorContext(ctx, "failed to record tool call in flight, its cancellation will not be forwarded", "session id", gatewaySession, "request id", id, "error", err)
+		return func() {}
+	}
+	return func() {
+		calls, err := s.SessionCache.GetSession(ctx, key)
+		if err != nil || calls[field] != value {
+			return
+		}
+		if err := s.SessionCache.RemoveServerSession(ctx, key, field); err != nil {
+			s.Logger.DebugContext(ctx, "failed to remove tool call in flight", "session id", gatewaySession, "request id", id, "error", err)
+		}
+	}
+}
+
+// inFlightToolCallServer returns the name of the server handling the tool call of the session with the id
+func (s *ExtProcServer) inFlightToolCallServer(ctx context.Context, gatewaySession string, id int) (string, bool) {
+	calls, err := s.SessionCache.GetSession(ctx, inFlightToolCallsKey(gatewaySession))
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to get tool calls in flight from cache", "session id", gatewaySession, "error", err)
+		return "", false
+	}
+	serverName, _, ok := strings.Cut(calls[strconv.Itoa(id)], " ")
+	return serverName, ok
+}
+
+// CancelledRequestID returns the id of the request a notifications/cancelled cancels. ok is false when it is not an
+// integer, the router only tracks tool calls with integer ids
+func (mr *MCPRequest) CancelledRequestID() (int, bool) {
+	id, ok := mr.Params["requestId"].(float64)
+	if !ok || id != float64(int(id)) {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// HandleCancelled forwards a client's notifications/cancelled to the server handling the tool call it cancels, in the
+// upstream session the call was sent in, so the server can stop working on it. Cancellations of requests that are
+// not tool calls in flight, such as calls that have already completed, are sent to the broker which accepts and
+// ignores them as the protocol allows
+func (s *ExtProcServer) HandleCancelled(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	if !s.ForwardCancellations {
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	id, ok := mcpReq.CancelledRequestID()
+	if !ok {
+		cancellationsTotal.WithLabelValues("not_in_flight").Inc()
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	serverName, ok := s.inFlightToolCallServer(ctx, mcpReq.GetSessionID(), id)
+	if !ok {
+		s.Logger.DebugContext(ctx, "cancelled request is not a tool call in flight, sending to the broker", "session id", mcpReq.GetSessionID(), "request id", id)
+		cancellationsTotal.WithLabelValues("not_in_flight").Inc()
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	// the broker does not see the notification so the session is validated here
+	if rejected := s.rejectInvalidSession(ctx, mcpReq); rejected != nil {
+		return rejected
+	}
+	serverInfo := s.RoutingConfig.GetServerConfigByName(serverName)
+	if serverInfo == nil {
+		cancellationsTotal.WithLabelValues("not_in_flight").Inc()
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	// a cancellation is only worth sending in the upstream session the call was sent in, a new one is never created
+	sessions, err := s.SessionCache.GetSession(ctx, mcpReq.GetSessionID())
+	if _, held := sessions[serverName]; err != nil || !held {
+		s.Logger.DebugContext(ctx, "no upstream session to forward cancellation in, sending to the broker", "server", serverName, "request id", id, "error", err)
+		cancellationsTotal.WithLabelValues("not_in_flight").Inc()
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	mcpReq.serverName = serverName
+	headers := NewHeaders().WithMCPMethod(mcpReq.Method).WithMCPServerName(serverName)
+	responses, routed := s.routeToServer(ctx, mcpReq, serverInfo, headers)
+	if routed {
+		s.Logger.InfoContext(ctx, "forwarding cancellation of tool call", "server", serverName, "request id", id, "session id", mcpReq.GetSessionID())
+		cancellationsTotal.WithLabelValues("forwarded").Inc()
+	}
+	return responses
+}
@@ -0,0 +1,230 @@
+package mcprouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	gosdk "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestInFlightToolCalls(t *testing.T) {
+	ctx := context.Background()
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	router := &ExtProcServer{Logger: slog.New(slog.NewTextHandler(os.Stdout, nil)), SessionCache: cache}
+	// another replica sharing the session cache
+	replica := &ExtProcServer{Logger: router.Logger, SessionCache: cache}
+
+	remove := router.trackToolCall(ctx, "session-a", 1, "mcp-test/slow")
+	server, ok := replica.inFlightToolCallServer(ctx, "session-a", 1)
+	require.True(t, ok)
+	require.Equal(t, "mcp-test/slow", server)
+	_, ok = replica.inFlightToolCallServer(ctx, "session-b", 1)
+	require.False(t, ok, "calls are tracked per gateway session")
+
+	// a later call reusing the id is not removed by the earlier call completing
+	removeLater := replica.trackToolCall(ctx, "session-a", 1, "mcp-test/other")
+	remove()
+	server, ok = router.inFlightToolCallServer(ctx, "session-a", 1)
+	require.True(t, ok)
+	require.Equal(t, "mcp-test/other", server)
+	removeLater()
+	removeLater()
+	_, ok = router.inFlightToolCallServer(ctx, "session-a", 1)
+	require.False(t, ok)
+
+	// closing the gateway session forgets its calls
+	router.trackToolCall(ctx, "session-a", 2, "mcp-test/slow")
+	router.CloseGatewaySession(ctx, "session-a")
+	_, ok = replica.inFlightToolCallServer(ctx, "session-a", 2)
+	require.False(t, ok)
+}
+
+func TestHandleCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// the upstream uses the official SDK, which cancels the context of a call when it is sent notifications/cancelled
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	type slowArgs struct {
+		Seconds int `json:"seconds"`
+	}
+	upstreamServer := gosdk.NewServer(&gosdk.Implementation{Name: "slow upstream", Version: "1.0.0"}, nil)
+	gosdk.AddTool(upstreamServer, &gosdk.Tool{Name: "slow", Description: "delay N seconds"}, func(ctx context.Context, _ *gosdk.ServerSession, params *gosdk.CallToolParamsFor[slowArgs]) (*gosdk.CallToolResultFor[struct{}], error) {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.Err()
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(params.Arguments.Seconds) * time.Second):
+			stopped <- nil
+			return &gosdk.CallToolResultFor[struct{}]{Content: []gosdk.Content{&gosdk.TextContent{Text: "done"}}}, nil
+		}
+	})
+	upstreamSrv := httptest.NewServer(gosdk.NewStreamableHTTPHandler(func(*http.Request) *gosdk.Server { return upstreamServer }, nil))
+	defer upstreamSrv.Close()
+	defer upstreamSrv.CloseClientConnections()
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	newRouter := func(forward bool) *ExtProcServer {
+		return &ExtProcServer{
+			RoutingConfig: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{{
+					Name:       "mcp-test/slow",
+					URL:        upstreamSrv.URL + "/mcp",
+					ToolPrefix: "s_",
+					Enabled:    true,
+					Hostname:   "slow.mcp.local",
+				}},
+			},
+			JWTManager:   jwtManager,
+			Logger:       logger,
+			SessionCache: cache,
+			InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+				c, err := client.NewStreamableHttpClient(conf.URL)
+				if err != nil {
+					return nil, err
+				}
+				if err := c.Start(ctx); err != nil {
+					return nil, err
+				}
+				_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+				return c, err
+			},
+			ForwardCancellations: forward,
+		}
+	}
+	sessionHeaders := func(gatewaySession string) *corev3.HeaderMap {
+		return &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}}
+	}
+	// routed returns the headers set on a request routed to a server and its body
+	routed := func(t *testing.T, resp []*eppb.ProcessingResponse) (map[string]string, []byte) {
+		t.Helper()
+		require.Len(t, resp, 1)
+		rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+		require.True(t, ok)
+		setHeaders := map[string]string{}
+		for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+			setHeaders[h.Header.Key] = string(h.Header.RawValue)
+		}
+		return setHeaders, rb.RequestBody.Response.BodyMutation.GetBody()
+	}
+	// send sends a routed request on to the upstream as envoy would
+	send := func(ctx context.Context, setHeaders map[string]string, body []byte) (*http.Response, error) {
+		upstreamReq, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamSrv.URL+setHeaders[pathHeader], bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		upstreamReq.Header.Set("Content-Type", "application/json")
+		upstreamReq.Header.Set("Accept", "application/json, text/event-stream")
+		upstreamReq.Header.Set("Mcp-Session-Id", setHeaders[sessionHeader])
+		return http.DefaultClient.Do(upstreamReq)
+	}
+	cancelled := func(gatewaySession string, requestID any) *MCPRequest {
+		return &MCPRequest{
+			JSONRPC: "2.0",
+			Method:  methodCancelled,
+			Params:  map[string]any{"requestId": requestID, "reason": "user cancelled"},
+			Headers: sessionHeaders(gatewaySession),
+		}
+	}
+	requireSentToBroker := func(t *testing.T, resp []*eppb.ProcessingResponse) {
+		t.Helper()
+		setHeaders, _ := routed(t, resp)
+		require.Equal(t, "mcpBroker", setHeaders[mcpServerNameHeader])
+	}
+
+	router := newRouter(true)
+	gatewaySession := jwtManager.Generate(ctx)
+	toolCall := &MCPRequest{
+		ID:      ptr.To(7),
+		JSONRPC: "2.0",
+		Method:  methodToolCall,
+		Params:  map[string]any{"name": "s_slow", "arguments": map[string]any{"seconds": 30}},
+		Headers: sessionHeaders(gatewaySession),
+	}
+	callHeaders, callBody := routed(t, router.RouteMCPRequest(ctx, toolCall))
+	require.Equal(t, "mcp-test/slow", callHeaders[mcpServerNameHeader])
+	callCtx, callCancel := context.WithCancel(ctx)
+	defer callCancel()
+	go func() {
+		if resp, err := send(callCtx, callHeaders, callBody); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow tool was not called")
+	}
+
+	t.Run("cancellation of a call from another session is sent to the broker", func(t *testing.T) {
+		requireSentToBroker(t, router.RouteMCPRequest(ctx, cancelled(jwtManager.Generate(ctx), float64(7))))
+	})
+
+	t.Run("cancellation with a string id is sent to the broker", func(t *testing.T) {
+		requireSentToBroker(t, router.RouteMCPRequest(ctx, cancelled(gatewaySession, "7")))
+	})
+
+	t.Run("cancellation is not forwarded when disabled", func(t *testing.T) {
+		requireSentToBroker(t, newRouter(false).RouteMCPRequest(ctx, cancelled(gatewaySession, float64(7))))
+	})
+
+	t.Run("cancellation processed by another replica is forwarded", func(t *testing.T) {
+		cancelHeaders, _ := routed(t, newRouter(true).RouteMCPRequest(ctx, cancelled(gatewaySession, float64(7))))
+		require.Equal(t, "mcp-test/slow", cancelHeaders[mcpServerNameHeader])
+		require.Equal(t, callHeaders[sessionHeader], cancelHeaders[sessionHeader])
+	})
+
+	t.Run("cancellation of a call in flight stops the upstream", func(t *testing.T) {
+		cancelHeaders, cancelBody := routed(t, router.RouteMCPRequest(ctx, cancelled(gatewaySession, float64(7))))
+		require.Equal(t, "mcp-test/slow", cancelHeaders[mcpServerNameHeader])
+		require.Equal(t, methodCancelled, cancelHeaders[methodHeader])
+		require.Equal(t, "slow.mcp.local", cancelHeaders[authorityHeader])
+		require.Equal(t, callHeaders[sessionHeader], cancelHeaders[sessionHeader], "the cancellation is sent in the upstream session of the call")
+		var body struct {
+			Params struct {
+				RequestID int `json:"requestId"`
+			} `json:"params"`
+		}
+		require.NoError(t, json.Unmarshal(cancelBody, &body))
+		require.Equal(t, 7, body.Params.RequestID)
+
+		resp, err := send(ctx, cancelHeaders, cancelBody)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		select {
+		case err := <-stopped:
+			require.True(t, errors.Is(err, context.Canceled), "the slow tool stopped early")
+		case <-time.After(5 * time.Second):
+			t.Fatal("the slow tool was not cancelled")
+		}
+	})
+
+	t.Run("cancellation of a completed call is sent to the broker", func(t *testing.T) {
+		toolCall.endToolCall()
+		requireSentToBroker(t, router.RouteMCPRequest(ctx, cancelled(gatewaySession, float64(7))))
+	})
+}
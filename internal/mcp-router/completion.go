@@ -0,0 +1,95 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	completionRefPrompt   = "ref/prompt"
+	completionRefResource = "ref/resource"
+)
+
+// CompletionRef returns the type of the reference in a completion/complete request and the prompt name or resource
+// uri it refers to. The type is empty if the request has no valid reference
+func (mr *MCPRequest) CompletionRef() (string, string) {
+	if mr.Method != methodComplete {
+		return "", ""
+	}
+	ref, ok := mr.Params["ref"].(map[string]any)
+	if !ok {
+		return "", ""
+	}
+	refType, _ := ref["type"].(string)
+	switch refType {
+	case completionRefPrompt:
+		name, _ := ref["name"].(string)
+		return refType, name
+	case completionRefResource:
+		uri, _ := ref["uri"].(string)
+		return refType, uri
+	}
+	return "", ""
+}
+
+// HandleComplete routes a completion/complete to the server of the prompt or resource it references. Prompts and
+// resource templates are advertised with the prefix of their server so, as for tool calls, the server is found from
+// the prefix and the prefix is removed from the reference sent to it
+func (s *ExtProcServer) HandleComplete(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	refType, target := mcpReq.CompletionRef()
+	if refType == "" || target == "" {
+		return s.invalidParamsResponse(mcpReq, "completion/complete needs a ref/prompt with a name or a ref/resource with a uri")
+	}
+	// This request wont go through the broker so needs to be validated
+	if rejected := s.rejectInvalidSession(ctx, mcpReq); rejected != nil {
+		return rejected
+	}
+	serverInfo := s.RoutingConfig.GetServerInfo(target)
+	if serverInfo == nil || serverInfo.IsSynthetic() {
+		s.Logger.InfoContext(ctx, "completion reference doesn't match any configured server prefix", "ref", refType, "target", target)
+		if refType == completionRefPrompt {
+			return s.invalidParamsResponse(mcpReq, fmt.Sprintf("prompt %s not found", target))
+		}
+		return s.invalidParamsResponse(mcpReq, fmt.Sprintf("resource %s not found", target))
+	}
+	upstreamTarget, _ := serverInfo.StripToolPrefix(target)
+	if ref, ok := mcpReq.Params["ref"].(map[string]any); ok {
+		if refType == completionRefPrompt {
+			ref["name"] = upstreamTarget
+		} else {
+			ref["uri"] = upstreamTarget
+		}
+	}
+	headers := NewHeaders()
+	headers.WithMCPMethod(mcpReq.Method)
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		headers.WithCustomHeader(logging.RequestIDHeader, requestID)
+	}
+	headers.WithMCPServerName(serverInfo.Name)
+	mcpReq.serverName = serverInfo.Name
+	responses, routed := s.routeToServer(ctx, mcpReq, serverInfo, headers)
+	if routed {
+		s.logRequest(ctx, "routing completion", "server", serverInfo.Name, "ref", refType, "target", upstreamTarget, "session id", mcpReq.GetSessionID())
+	}
+	return responses
+}
+
+// invalidParamsResponse answers the request with a JSON-RPC invalid params error. The HTTP status is 200 as MCP
+// clients treat a 404 as their session having ended
+func (s *ExtProcServer) invalidParamsResponse(mcpReq *MCPRequest, message string) []*eppb.ProcessingResponse {
+	var id any
+	if mcpReq.ID != nil {
+		id = *mcpReq.ID
+	}
+	body, err := json.Marshal(mcp.NewJSONRPCError(mcp.NewRequestId(id), mcp.INVALID_PARAMS, message, nil))
+	if err != nil {
+		s.Logger.Error("failed to marshal invalid params error", "error", err)
+		return NewResponse().WithImmediateResponse(400, message).Build()
+	}
+	return NewResponse().WithImmediateJSONResponse(200, body).Build()
+}
@@ -0,0 +1,188 @@
+package mcprouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+// completingUpstream answers completion/complete with the prompt name or resource uri it was asked to complete so
+// tests can see the reference that reached it. Other requests are served by an MCP server
+func completingUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	mcpServer := server.NewStreamableHTTPServer(server.NewMCPServer("upstream", "0.0.1", server.WithPromptCapabilities(false)))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req struct {
+			ID     any                `json:"id"`
+			Method string             `json:"method"`
+			Params mcp.CompleteParams `json:"params"`
+		}
+		if json.Unmarshal(body, &req) != nil || req.Method != methodComplete {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			mcpServer.ServeHTTP(w, r)
+			return
+		}
+		ref, _ := req.Params.Ref.(map[string]any)
+		result := mcp.CompleteResult{}
+		for _, key := range []string{"name", "uri"} {
+			if value, ok := ref[key].(string); ok {
+				result.Completion.Values = append(result.Completion.Values, value+"/"+req.Params.Argument.Value)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(mcp.NewJSONRPCResultResponse(mcp.NewRequestId(req.ID), result)))
+	}))
+}
+
+func TestHandleComplete(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	upstreamSrv := completingUpstream(t)
+	defer upstreamSrv.Close()
+
+	testCases := []struct {
+		Name         string
+		Ref          any
+		ExpectValues []string
+		ExpectError  string
+	}{
+		{
+			Name:         "prompt",
+			Ref:          map[string]any{"type": "ref/prompt", "name": "code_review"},
+			ExpectValues: []string{"review/go"},
+		},
+		{
+			Name:         "prompt through a prefix alias",
+			Ref:          map[string]any{"type": "ref/prompt", "name": "old_code_review"},
+			ExpectValues: []string{"review/go"},
+		},
+		{
+			Name:         "resource template",
+			Ref:          map[string]any{"type": "ref/resource", "uri": "code_file:///{path}"},
+			ExpectValues: []string{"file:///{path}/go"},
+		},
+		{
+			Name:        "prompt of no server",
+			Ref:         map[string]any{"type": "ref/prompt", "name": "weather_forecast"},
+			ExpectError: "prompt weather_forecast not found",
+		},
+		{
+			Name:        "resource of no server",
+			Ref:         map[string]any{"type": "ref/resource", "uri": "file:///{path}"},
+			ExpectError: "resource file:///{path} not found",
+		},
+		{
+			Name:        "unknown reference type",
+			Ref:         map[string]any{"type": "ref/tool", "name": "code_review"},
+			ExpectError: "completion/complete needs a ref/prompt with a name or a ref/resource with a uri",
+		},
+		{
+			Name:        "no reference",
+			ExpectError: "completion/complete needs a ref/prompt with a name or a ref/resource with a uri",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cache, err := session.NewCache(ctx)
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{
+						Name:              "mcp-test/code",
+						URL:               upstreamSrv.URL + "/mcp",
+						ToolPrefix:        "code_",
+						ToolPrefixAliases: []string{"old_code_"},
+						Enabled:           true,
+						Hostname:          "code.mcp.local",
+					}},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+				InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					c, err := client.NewStreamableHttpClient(conf.URL)
+					if err != nil {
+						return nil, err
+					}
+					if err := c.Start(ctx); err != nil {
+						return nil, err
+					}
+					_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+					return c, err
+				},
+			}
+			params := map[string]any{"argument": map[string]any{"name": "language", "value": "go"}}
+			if tc.Ref != nil {
+				params["ref"] = tc.Ref
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "completion/complete",
+				Params:  params,
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(jwtManager.Generate(ctx))}}},
+			})
+			require.Len(t, resp, 1)
+
+			if tc.ExpectError != "" {
+				immediate := resp[0].GetImmediateResponse()
+				require.NotNil(t, immediate)
+				require.EqualValues(t, 200, immediate.Status.Code)
+				var body struct {
+					Error struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal(immediate.Body, &body))
+				require.Equal(t, mcp.INVALID_PARAMS, body.Error.Code)
+				require.Equal(t, tc.ExpectError, body.Error.Message)
+				return
+			}
+
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, "mcp-test/code", setHeaders[mcpServerNameHeader])
+			require.Equal(t, methodComplete, setHeaders[methodHeader])
+			require.Equal(t, "code.mcp.local", setHeaders[authorityHeader])
+			require.NotEmpty(t, setHeaders[sessionHeader])
+			// send the routed request on to the upstream as envoy would
+			upstreamReq, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamSrv.URL+setHeaders[pathHeader], bytes.NewReader(rb.RequestBody.Response.BodyMutation.GetBody()))
+			require.NoError(t, err)
+			upstreamReq.Header.Set("Content-Type", "application/json")
+			upstreamReq.Header.Set("Mcp-Session-Id", setHeaders[sessionHeader])
+			upstreamResp, err := http.DefaultClient.Do(upstreamReq)
+			require.NoError(t, err)
+			defer func() { _ = upstreamResp.Body.Close() }()
+			var result struct {
+				Result mcp.CompleteResult `json:"result"`
+			}
+			require.NoError(t, json.NewDecoder(upstreamResp.Body).Decode(&result))
+			require.Equal(t, tc.ExpectValues, result.Result.Completion.Values)
+		})
+	}
+}
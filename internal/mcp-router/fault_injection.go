@@ -0,0 +1,134 @@
+package mcprouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const (
+	envFaultInjectionMode    = "MCP_FAULT_INJECTION_MODE"
+	envFaultInjectionPercent = "MCP_FAULT_INJECTION_PERCENT"
+	envFaultInjectionSeed    = "MCP_FAULT_INJECTION_SEED"
+)
+
+var errFaultInjectionDisabled = errors.New("fault injection is not available in this build, build with -tags faultinjection to enable it")
+
+// FaultMode is the failure injected in place of routing a tool call to its upstream
+type FaultMode string
+
+const (
+	// FaultModeTimeout responds as envoy does when the upstream does not respond within the route timeout
+	FaultModeTimeout FaultMode = "timeout"
+	// FaultModeUnavailable responds as envoy does when no upstream host is available
+	FaultModeUnavailable FaultMode = "unavailable"
+	// FaultModeSession invalidates the upstream session and responds as an upstream that no longer knows the session
+	FaultModeSession FaultMode = "session"
+)
+
+// FaultInjector fails a percentage of tool calls so the retry and session recovery paths of clients can be
+// exercised in CI. It can only be created in builds with the faultinjection build tag
+type FaultInjector struct {
+	mode    FaultMode
+	percent float64
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// NewFaultInjector returns an injector failing percent (0-100) of tool calls with the given mode. The seed makes
+// the sequence of failed calls repeatable
+func NewFaultInjector(mode FaultMode, percent float64, seed uint64) (*FaultInjector, error) {
+	if !faultInjectionEnabled {
+		return nil, errFaultInjectionDisabled
+	}
+	return newFaultInjector(mode, percent, seed)
+}
+
+func newFaultInjector(mode FaultMode, percent float64, seed uint64) (*FaultInjector, error) {
+	switch mode {
+	case FaultModeTimeout, FaultModeUnavailable, FaultModeSession:
+	default:
+		return nil, fmt.Errorf("unknown fault injection mode %q, expected one of %s, %s or %s", mode, FaultModeTimeout, FaultModeUnavailable, FaultModeSession)
+	}
+	if percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("fault injection percent must be greater than 0 and at most 100, got %v", percent)
+	}
+	return &FaultInjector{
+		mode:    mode,
+		percent: percent,
+		rand:    rand.New(rand.NewPCG(seed, seed)),
+	}, nil
+}
+
+// NewFaultInjectorFromEnv returns an injector configured from environment variables or nil if no mode is set.
+// All tool calls are failed unless a percent is set
+func NewFaultInjectorFromEnv() (*FaultInjector, error) {
+	mode := os.Getenv(envFaultInjectionMode)
+	if mode == "" {
+		return nil, nil
+	}
+	if !faultInjectionEnabled {
+		return nil, errFaultInjectionDisabled
+	}
+	percent := 100.0
+	if configured := os.Getenv(envFaultInjectionPercent); configured != "" {
+		parsed, err := strconv.ParseFloat(configured, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envFaultInjectionPercent, err)
+		}
+		percent = parsed
+	}
+	seed := uint64(time.Now().UnixNano())
+	if configured := os.Getenv(envFaultInjectionSeed); configured != "" {
+		parsed, err := strconv.ParseUint(configured, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envFaultInjectionSeed, err)
+		}
+		seed = parsed
+	}
+	return NewFaultInjector(FaultMode(mode), percent, seed)
+}
+
+// String describes the injected faults
+func (f *FaultInjector) String() string {
+	return fmt.Sprintf("%s on %v%% of tool calls", f.mode, f.percent)
+}
+
+// shouldInject reports whether the next tool call should fail
+func (f *FaultInjector) shouldInject() bool {
+	if f == nil || f.rand == nil {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.rand.Float64()*100 < f.percent
+}
+
+// injectFault returns the response for a tool call failed by the fault injector or nil if the call should be routed as normal
+func (s *ExtProcServer) injectFault(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	if !s.FaultInjector.shouldInject() {
+		return nil
+	}
+	s.Logger.Warn("injecting fault into tool call", "mode", s.FaultInjector.mode, "server", mcpReq.serverName, "tool", mcpReq.ToolName(), "session id", mcpReq.GetSessionID())
+	response := NewResponse()
+	switch s.FaultInjector.mode {
+	case FaultModeTimeout:
+		return response.WithImmediateResponse(504, "upstream request timeout").Build()
+	case FaultModeUnavailable:
+		return response.WithImmediateResponse(503, "no healthy upstream").Build()
+	default:
+		// the same as an upstream responding with a 404 so the next call initializes a new upstream session
+		if err := s.SessionCache.RemoveServerSession(ctx, mcpReq.GetSessionID(), mcpReq.serverName); err != nil {
+			s.Logger.Error("failed to remove server session ", "server", mcpReq.serverName, "session", mcpReq.GetSessionID(), "error", err)
+		}
+		return response.WithImmediateResponse(404, "session not found").Build()
+	}
+}
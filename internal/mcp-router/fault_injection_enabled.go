@@ -0,0 +1,6 @@
+//go:build faultinjection
+
+package mcprouter
+
+// faultInjectionEnabled is set by the faultinjection build tag. Fault injection is never available in release builds
+const faultInjectionEnabled = true
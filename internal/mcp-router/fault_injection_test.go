@@ -0,0 +1,184 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestHandleToolCallFaultInjection(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Mode          FaultMode
+		ExpectStatus  int32
+		ExpectBody    string
+		ExpectSession bool
+	}{
+		{
+			Name:          "upstream timeout",
+			Mode:          FaultModeTimeout,
+			ExpectStatus:  504,
+			ExpectBody:    "upstream request timeout",
+			ExpectSession: true,
+		},
+		{
+			Name:          "upstream unavailable",
+			Mode:          FaultModeUnavailable,
+			ExpectStatus:  503,
+			ExpectBody:    "no healthy upstream",
+			ExpectSession: true,
+		},
+		{
+			Name:         "upstream session invalidated",
+			Mode:         FaultModeSession,
+			ExpectStatus: 404,
+			ExpectBody:   "session not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+			faultInjector, err := newFaultInjector(tc.Mode, 100, 1)
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost"},
+					},
+				},
+				JWTManager:    jwtManager,
+				Logger:        logger,
+				SessionCache:  cache,
+				FaultInjector: faultInjector,
+			}
+
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s_mytool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			ir, ok := resp[0].Response.(*eppb.ProcessingResponse_ImmediateResponse)
+			require.True(t, ok)
+			require.Equal(t, tc.ExpectStatus, int32(ir.ImmediateResponse.Status.Code))
+			require.Equal(t, tc.ExpectBody, string(ir.ImmediateResponse.Body))
+
+			sessions, err := cache.GetSession(context.Background(), gatewaySession)
+			require.NoError(t, err)
+			_, hasSession := sessions["dummy"]
+			require.Equal(t, tc.ExpectSession, hasSession)
+		})
+	}
+}
+
+func TestFaultInjectorPercent(t *testing.T) {
+	// the same seed fails the same calls so CI runs are repeatable
+	sample := func(percent float64, seed uint64) []bool {
+		faultInjector, err := newFaultInjector(FaultModeUnavailable, percent, seed)
+		require.NoError(t, err)
+		injected := make([]bool, 1000)
+		for i := range injected {
+			injected[i] = faultInjector.shouldInject()
+		}
+		return injected
+	}
+	count := func(injected []bool) int {
+		n := 0
+		for _, i := range injected {
+			if i {
+				n++
+			}
+		}
+		return n
+	}
+
+	require.Equal(t, sample(25, 42), sample(25, 42))
+	require.InDelta(t, 250, count(sample(25, 42)), 50)
+	require.Equal(t, 1000, count(sample(100, 42)))
+
+	var disabled *FaultInjector
+	require.False(t, disabled.shouldInject())
+	require.False(t, (&FaultInjector{mode: FaultModeTimeout, percent: 100}).shouldInject())
+}
+
+func TestNewFaultInjectorFromEnv(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		Env       map[string]string
+		ExpectNil bool
+		ExpectErr string
+	}{
+		{
+			Name:      "not configured",
+			ExpectNil: true,
+		},
+		{
+			Name: "mode only",
+			Env:  map[string]string{envFaultInjectionMode: "timeout"},
+		},
+		{
+			Name: "mode percent and seed",
+			Env:  map[string]string{envFaultInjectionMode: "session", envFaultInjectionPercent: "12.5", envFaultInjectionSeed: "7"},
+		},
+		{
+			Name:      "unknown mode",
+			Env:       map[string]string{envFaultInjectionMode: "crash"},
+			ExpectErr: "unknown fault injection mode",
+		},
+		{
+			Name:      "percent out of range",
+			Env:       map[string]string{envFaultInjectionMode: "timeout", envFaultInjectionPercent: "150"},
+			ExpectErr: "percent must be greater than 0 and at most 100",
+		},
+		{
+			Name:      "invalid seed",
+			Env:       map[string]string{envFaultInjectionMode: "timeout", envFaultInjectionSeed: "abc"},
+			ExpectErr: "invalid " + envFaultInjectionSeed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			for _, env := range []string{envFaultInjectionMode, envFaultInjectionPercent, envFaultInjectionSeed} {
+				t.Setenv(env, tc.Env[env])
+			}
+			faultInjector, err := NewFaultInjectorFromEnv()
+			if tc.ExpectNil {
+				require.NoError(t, err)
+				require.Nil(t, faultInjector)
+				return
+			}
+			if !faultInjectionEnabled {
+				// release builds can never enable fault injection
+				require.ErrorContains(t, err, "not available in this build")
+				require.Nil(t, faultInjector)
+				return
+			}
+			if tc.ExpectErr != "" {
+				require.ErrorContains(t, err, tc.ExpectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, faultInjector)
+		})
+	}
+}
@@ -2,6 +2,9 @@ package mcprouter
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	basepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 )
@@ -11,10 +14,21 @@ const (
 	toolAnnotationsHeader = "x-mcp-annotation-hints"
 	toolHeader            = "x-mcp-toolname"
 	methodHeader          = "x-mcp-method"
-	sessionHeader         = "mcp-session-id"
+	sessionHeader         = "mcp-session-id" // the spec's Mcp-Session-Id, envoy uses header names in lower case
 	authorityHeader       = ":authority"
 	authorizationHeader   = "authorization"
 	mcpTarget             = "mcp-target"
+	// upstreamTimeoutHeader overrides the timeout of the route for the request
+	upstreamTimeoutHeader = "x-envoy-upstream-rq-timeout-ms"
+	// clientTimeoutHeader is how long in milliseconds the client waits for the response to its request
+	clientTimeoutHeader = "x-mcp-timeout-ms"
+	// debugUpstreamSessionHeader pins the upstream session id used for a tool call. Only honored in debug mode
+	debugUpstreamSessionHeader = "x-mcp-debug-upstream-session"
+	// virtualServerHeader selects the virtual server, as namespace/name, the client uses
+	virtualServerHeader = "x-mcp-virtualserver"
+	// quotaRemainingHeader tells the client how many tool calls it has left in the current quota window
+	quotaRemainingHeader = "x-mcp-quota-remaining"
+	pathHeader           = ":path"
 	// RoutingKey is an internal header used to authenticate a request from the router
 	RoutingKey = "router-key"
 )
@@ -31,6 +45,36 @@ func getSingleValueHeader(headers *basepb.HeaderMap, name string) string {
 	return ""
 }
 
+// isSessionHeader reports whether the header carries an MCP session id. Besides any casing of the spec's
+// Mcp-Session-Id some clients and servers send variants such as mcp-sessionid or mcp_session_id
+func isSessionHeader(name string) bool {
+	return strings.EqualFold(strings.NewReplacer("-", "", "_", "").Replace(name), "mcpsessionid")
+}
+
+// getSessionHeader returns the session id in the headers. The spec's header is preferred over its variants
+func getSessionHeader(headers *basepb.HeaderMap) string {
+	if session := getSingleValueHeader(headers, sessionHeader); session != "" {
+		return session
+	}
+	for _, hk := range headers.GetHeaders() {
+		if hk != nil && isSessionHeader(hk.Key) {
+			return string(hk.RawValue)
+		}
+	}
+	return ""
+}
+
+// sessionHeaderVariants returns the names of the headers carrying a session id under a name other than sessionHeader
+func sessionHeaderVariants(headers *basepb.HeaderMap) []string {
+	var variants []string
+	for _, hk := range headers.GetHeaders() {
+		if hk != nil && hk.Key != sessionHeader && isSessionHeader(hk.Key) {
+			variants = append(variants, hk.Key)
+		}
+	}
+	return variants
+}
+
 // HeadersBuilder builds headers to add to the request or response
 type HeadersBuilder struct {
 	headers []*basepb.HeaderValueOption
@@ -136,6 +180,17 @@ func (hb *HeadersBuilder) WithToolAnnotations(annotations string) *HeadersBuilde
 	return hb
 }
 
+// WithUpstreamTimeout will set the x-envoy-upstream-rq-timeout-ms header so envoy uses the timeout for the request instead of the route's
+func (hb *HeadersBuilder) WithUpstreamTimeout(timeout time.Duration) *HeadersBuilder {
+	hb.headers = append(hb.headers, &basepb.HeaderValueOption{
+		Header: &basepb.HeaderValue{
+			Key:      upstreamTimeoutHeader,
+			RawValue: []byte(strconv.FormatInt(timeout.Milliseconds(), 10)),
+		},
+	})
+	return hb
+}
+
 // WithCustomHeader will set key with value in the headers
 func (hb *HeadersBuilder) WithCustomHeader(key, value string) *HeadersBuilder {
 	hb.headers = append(hb.headers, &basepb.HeaderValueOption{
@@ -2,6 +2,9 @@ package mcprouter
 
 import (
 	"testing"
+
+	basepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Headers(t *testing.T) {
@@ -42,3 +45,41 @@ func Test_Headers(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionHeaderVariants(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Key           string
+		ExpectVariant bool
+	}{
+		{Name: "spec header", Key: "mcp-session-id"},
+		{Name: "spec casing", Key: "Mcp-Session-Id", ExpectVariant: true},
+		{Name: "upper case", Key: "MCP-SESSION-ID", ExpectVariant: true},
+		{Name: "no separator", Key: "mcp-sessionid", ExpectVariant: true},
+		{Name: "no separators", Key: "mcpsessionid", ExpectVariant: true},
+		{Name: "underscores", Key: "mcp_session_id", ExpectVariant: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			headers := &basepb.HeaderMap{Headers: []*basepb.HeaderValue{
+				{Key: ":authority", RawValue: []byte("mcp.local")},
+				{Key: tc.Key, RawValue: []byte("session-1")},
+			}}
+			require.True(t, isSessionHeader(tc.Key))
+			require.Equal(t, "session-1", getSessionHeader(headers))
+			if tc.ExpectVariant {
+				require.Equal(t, []string{tc.Key}, sessionHeaderVariants(headers))
+			} else {
+				require.Empty(t, sessionHeaderVariants(headers))
+			}
+		})
+	}
+
+	require.False(t, isSessionHeader("mcp-session"))
+	require.False(t, isSessionHeader("x-mcp-session-id"))
+	// the spec header wins over a variant
+	require.Equal(t, "spec", getSessionHeader(&basepb.HeaderMap{Headers: []*basepb.HeaderValue{
+		{Key: "mcp-sessionid", RawValue: []byte("variant")},
+		{Key: sessionHeader, RawValue: []byte("spec")},
+	}}))
+}
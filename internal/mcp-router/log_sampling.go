@@ -0,0 +1,36 @@
+package mcprouter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+const envRequestLogSampleRate = "MCP_ROUTER_REQUEST_LOG_SAMPLE_RATE"
+
+// RequestLogSampleRateFromEnv returns the sample rate of the per-request router logs. 0, the default, logs requests
+// at debug only
+func RequestLogSampleRateFromEnv() (uint64, error) {
+	configured := os.Getenv(envRequestLogSampleRate)
+	if configured == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseUint(configured, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", envRequestLogSampleRate, err)
+	}
+	return rate, nil
+}
+
+// logRequest logs a routed request at info for one in every RequestLogSampleRate requests and at debug otherwise.
+// Errors are logged separately and never sampled
+func (s *ExtProcServer) logRequest(ctx context.Context, msg string, args ...any) {
+	level := slog.LevelDebug
+	// the first request is always logged so a single request shows up when testing
+	if s.RequestLogSampleRate > 0 && (s.requestLogs.Add(1)-1)%s.RequestLogSampleRate == 0 {
+		level = slog.LevelInfo
+	}
+	s.Logger.Log(ctx, level, msg, args...)
+}
@@ -5,11 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // ErrInvalidRequest is an error for an invalid request
@@ -19,6 +27,8 @@ var ErrInvalidRequest = fmt.Errorf("MCP Request is invalid")
 type RouterError struct {
 	StatusCode int32
 	Err        error
+	// RetryAfter when set tells the client how long to wait before retrying
+	RetryAfter time.Duration
 }
 
 // Error implements the error interface
@@ -56,9 +66,13 @@ func NewRouterErrorf(code int32, format string, args ...any) *RouterError {
 }
 
 const (
-	methodToolCall    = "tools/call"
-	methodInitialize  = "initialize"
-	methodInitialized = "notification/initialized"
+	methodToolCall     = "tools/call"
+	methodInitialize   = "initialize"
+	methodInitialized  = "notifications/initialized"
+	methodPing         = "ping"
+	methodResourceRead = "resources/read"
+	methodComplete     = "completion/complete"
+	methodCancelled    = "notifications/cancelled"
 )
 
 // MCPRequest encapsulates a mcp protocol request to the gateway
@@ -71,6 +85,20 @@ type MCPRequest struct {
 	Streaming  bool              `json:"-"`
 	sessionID  string            `json:"-"`
 	serverName string            `json:"-"`
+	// toolCallDone frees the tool call's concurrency slot. It is set once the call is routed to its server
+	toolCallDone func()
+	// resultCacheKey is set for a call to a cacheable tool whose result was not cached so the result is cached from
+	// the upstream's response
+	resultCacheKey string
+	// landFlight completes the flight led by a call to a cacheable tool, releasing the identical calls waiting on it
+	// with its result or nil if it has none to share
+	landFlight func(result json.RawMessage)
+	// quotaRemaining is the number of tool calls the subject of a call counted against a quota has left in the window
+	quotaRemaining *int64
+	// maxResponseBytes caps the size of the response of a call routed to a server with a maximum response size
+	maxResponseBytes int64
+	// responseBytes counts the bytes of the response received so far
+	responseBytes int64
 }
 
 // GetSingleHeaderValue returns a single header value
@@ -81,11 +109,35 @@ func (mr *MCPRequest) GetSingleHeaderValue(key string) string {
 // GetSessionID returns the mcp session id
 func (mr *MCPRequest) GetSessionID() string {
 	if mr.sessionID == "" {
-		mr.sessionID = getSingleValueHeader(mr.Headers, sessionHeader)
+		mr.sessionID = getSessionHeader(mr.Headers)
 	}
 	return mr.sessionID
 }
 
+// VirtualServer returns the virtual server, as namespace/name, selected by the request's /mcp/vs/ path or its
+// x-mcp-virtualserver header. The path takes precedence as it does for the broker. It is empty if none is selected
+func (mr *MCPRequest) VirtualServer() string {
+	path, _, _ := strings.Cut(mr.GetSingleHeaderValue(pathHeader), "?")
+	if virtualServer, ok := broker.VirtualServerFromPath(path); ok {
+		return virtualServer
+	}
+	return mr.GetSingleHeaderValue(virtualServerHeader)
+}
+
+// endToolCall frees the concurrency slot of a routed tool call and releases the identical calls waiting on it. It is
+// safe to call on any request and more than once
+func (mr *MCPRequest) endToolCall() {
+	if mr == nil {
+		return
+	}
+	if mr.toolCallDone != nil {
+		mr.toolCallDone()
+	}
+	if mr.landFlight != nil {
+		mr.landFlight(nil)
+	}
+}
+
 // Validate validates the mcp request
 func (mr *MCPRequest) Validate() (bool, error) {
 	if mr.JSONRPC != "2.0" {
@@ -105,6 +157,11 @@ func (mr *MCPRequest) isNotificationRequest() bool {
 	return strings.HasPrefix(mr.Method, "notifications")
 }
 
+// correlatesResponse returns true if the request was routed to an upstream and expects a response with a matching id
+func (mr *MCPRequest) correlatesResponse() bool {
+	return mr != nil && mr.ID != nil && mr.serverName != ""
+}
+
 // isToolCall will check if the request is a tool call request
 func (mr *MCPRequest) isToolCall() bool {
 	return mr.Method == "tools/call"
@@ -112,7 +169,7 @@ func (mr *MCPRequest) isToolCall() bool {
 
 // isInitializeRequest returns true if the method is initialize or initialized
 func (mr *MCPRequest) isInitializeRequest() bool {
-	return mr.Method == "initialize" || mr.Method == "notifications/initialized"
+	return mr.Method == methodInitialize || mr.Method == methodInitialized
 }
 
 // ToolName returns the tool name in a tools/call request
@@ -137,26 +194,78 @@ func (mr *MCPRequest) ReWriteToolName(actualTool string) {
 	mr.Params["name"] = actualTool
 }
 
+// ResourceURI returns the uri in a resources/read request
+func (mr *MCPRequest) ResourceURI() string {
+	if mr.Method != methodResourceRead {
+		return ""
+	}
+	uri, _ := mr.Params["uri"].(string)
+	return uri
+}
+
 // ToBytes marshals the data ready to send on
 func (mr *MCPRequest) ToBytes() ([]byte, error) {
 	return json.Marshal(mr)
 }
 
-// HandleRequestHeaders handles request headers minimally.
-func (s *ExtProcServer) HandleRequestHeaders(_ *eppb.HttpHeaders) ([]*eppb.ProcessingResponse, error) {
-	s.Logger.Info("Request Handler: HandleRequestHeaders called")
+// HandleRequestHeaders handles request headers minimally. A session id sent under a variant of the session header
+// is moved to the spec's header so the broker and upstreams find it. A request without a request id is given one,
+// which is added to headers so the rest of the request is logged with it
+func (s *ExtProcServer) HandleRequestHeaders(headers *eppb.HttpHeaders) ([]*eppb.ProcessingResponse, error) {
+	s.Logger.Debug("Request Handler: HandleRequestHeaders called")
 	requestHeaders := NewHeaders()
 	response := NewResponse()
 	requestHeaders.WithAuthority(s.RoutingConfig.MCPGatewayExternalHostname)
-	return response.WithRequestHeadersReponse(requestHeaders.Build()).Build(), nil
+	if headers.GetHeaders() != nil && getSingleValueHeader(headers.GetHeaders(), logging.RequestIDHeader) == "" {
+		requestID := logging.NewRequestID()
+		headers.Headers.Headers = append(headers.Headers.Headers, &corev3.HeaderValue{Key: logging.RequestIDHeader, RawValue: []byte(requestID)})
+		requestHeaders.WithCustomHeader(logging.RequestIDHeader, requestID)
+	}
+	remove := sessionHeaderVariants(headers.GetHeaders())
+	if len(remove) > 0 {
+		requestHeaders.WithMCPSession(getSessionHeader(headers.GetHeaders()))
+	}
+	remove = append(remove, s.subjectHeaderToRemove(headers.GetHeaders())...)
+	response.WithRequestHeadersReponse(requestHeaders.Build()).WithoutRequestHeaders(remove)
+	if !requestBodyNeeded(headers.GetHeaders()) {
+		s.Logger.Debug("Request Handler: request carries no JSON-RPC message, skipping the request body", "method", getSingleValueHeader(headers.GetHeaders(), ":method"))
+		response.WithoutRequestBody()
+	}
+	return response.Build(), nil
+}
+
+// requestBodyNeeded reports whether the router needs the request body. The JSON-RPC method deciding how a request is
+// routed is only sent in the body so every POST that may carry JSON is read. Requests such as the GET opening a
+// notification stream or the DELETE ending a session carry no JSON-RPC message and are sent on without buffering
+func requestBodyNeeded(headers *corev3.HeaderMap) bool {
+	if getSingleValueHeader(headers, ":method") != http.MethodPost {
+		return false
+	}
+	contentType := getSingleValueHeader(headers, "content-type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
 }
 
 // RouteMCPRequest handles request bodies for MCP requests.
 func (s *ExtProcServer) RouteMCPRequest(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
-	s.Logger.Debug("HandleMCPRequest ", "session id", mcpReq.GetSessionID())
+	s.Logger.DebugContext(ctx, "HandleMCPRequest ", "session id", mcpReq.GetSessionID())
 	switch mcpReq.Method {
 	case methodToolCall:
 		return s.HandleToolCall(ctx, mcpReq)
+	case methodPing:
+		return s.HandlePing(ctx, mcpReq)
+	case methodResourceRead:
+		return s.HandleResourceRead(ctx, mcpReq)
+	case methodComplete:
+		return s.HandleComplete(ctx, mcpReq)
+	case methodCancelled:
+		return s.HandleCancelled(ctx, mcpReq)
 	default:
 		return s.HandleNoneToolCall(mcpReq)
 	}
@@ -168,33 +277,43 @@ func (s *ExtProcServer) HandleToolCall(ctx context.Context, mcpReq *MCPRequest)
 	// handle tools call
 	toolName := mcpReq.ToolName()
 	if toolName == "" {
-		s.Logger.Error("[EXT-PROC] HandleRequestBody no tool name set in tools/call")
+		s.Logger.ErrorContext(ctx, "[EXT-PROC] HandleRequestBody no tool name set in tools/call")
 		calculatedResponse.WithImmediateResponse(400, "no tool name set")
 		return calculatedResponse.Build()
 	}
-	if mcpReq.GetSessionID() == "" {
-		s.Logger.Info("No mcp-session-id found in headers")
-		calculatedResponse.WithImmediateResponse(400, "no session ID found")
-		return calculatedResponse.Build()
-	}
 	// This request wont go through the broker so needs to be validated
-	isInvalidSession, err := s.JWTManager.Validate(mcpReq.GetSessionID())
-	if err != nil {
-		s.Logger.Error("failed to validate session", "session", mcpReq.GetSessionID(), "error ", err)
-		calculatedResponse.WithImmediateResponse(404, "session no longer valid")
-		return calculatedResponse.Build()
+	if rejected := s.rejectInvalidSession(ctx, mcpReq); rejected != nil {
+		return rejected
 	}
-	if isInvalidSession {
-		s.Logger.Debug("invalid session ", "session", mcpReq.GetSessionID())
-		calculatedResponse.WithImmediateResponse(404, "session no longer valid")
-		return calculatedResponse.Build()
+	// a binding in the selected virtual server decides the server when the prefixes of more than one may match
+	serverInfo := s.RoutingConfig.GetBoundServerInfo(mcpReq.VirtualServer(), toolName)
+	bound := serverInfo != nil
+	if !bound {
+		serverInfo = s.RoutingConfig.GetServerInfo(toolName)
 	}
-	serverInfo := s.RoutingConfig.GetServerInfo(toolName)
 	if serverInfo == nil {
-		s.Logger.Info("Tool name doesn't match any configured server prefix", "tool", toolName)
-		calculatedResponse.WithImmediateResponse(404, "not found")
+		s.Logger.DebugContext(ctx, "Tool name doesn't match any configured server prefix", "tool", toolName)
+		return s.unknownToolResponse(mcpReq, toolName)
+	}
+	// tools of other tenants are not listed to the client so calls to them are answered as if the tool did not exist
+	if !s.toolVisibleToSession(ctx, mcpReq.GetSessionID(), serverInfo, toolName) {
+		s.Logger.InfoContext(ctx, "rejecting call to tool of another tenant", "server", serverInfo.Name, "tool", toolName)
+		return s.unknownToolResponse(mcpReq, toolName)
+	}
+	if !s.waitForDiscovery(ctx, serverInfo) {
+		s.Logger.InfoContext(ctx, "mcp server is still being discovered, rejecting tool call", "server", serverInfo.Name, "tool", toolName)
+		calculatedResponse.WithImmediateRetryResponse(503, fmt.Sprintf("mcp server %s is still being discovered, retry shortly", serverInfo.Name), time.Second)
 		return calculatedResponse.Build()
 	}
+	if s.Broker != nil && s.Broker.ServingFallbackTools(serverInfo.ID()) {
+		s.Logger.InfoContext(ctx, "mcp server is unavailable and its fallback tools are advertised, rejecting tool call", "server", serverInfo.Name, "tool", toolName)
+		return s.upstreamErrorResponse(mcpReq, 503, upstream.ErrorKindUnreachable, fmt.Sprintf("mcp server %s is temporarily unavailable, retry later", serverInfo.Name))
+	}
+	if serverInfo.IsSynthetic() {
+		// the broker answers calls to the tools of synthetic servers itself so there is no upstream to route to
+		s.logRequest(ctx, "forwarding call to synthetic tool to the broker", "server", serverInfo.Name, "tool", toolName, "session id", mcpReq.GetSessionID())
+		return s.HandleNoneToolCall(mcpReq)
+	}
 	// Get tool annotations from broker and set headers
 	headers := NewHeaders()
 	if s.Broker != nil {
@@ -222,84 +341,300 @@ func (s *ExtProcServer) HandleToolCall(ctx context.Context, mcpReq *MCPRequest)
 	}
 
 	headers.WithMCPMethod(mcpReq.Method)
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		headers.WithCustomHeader(logging.RequestIDHeader, requestID)
+	}
 	mcpReq.serverName = serverInfo.Name
+	mcpReq.maxResponseBytes = serverInfo.MaxResponseBytes
 	upstreamToolName := s.RoutingConfig.StripServerPrefix(toolName)
+	if bound {
+		upstreamToolName, _ = serverInfo.StripToolPrefix(toolName)
+	}
+	if s.Broker != nil {
+		// tool renames may not be invertible so the broker's mapping from the advertised name is used when it has one
+		if name, ok := s.Broker.UpstreamToolName(serverInfo.ID(), toolName); ok {
+			upstreamToolName = name
+		}
+	}
+	if serverInfo.ReadOnly && !s.isReadOnlyTool(serverInfo, upstreamToolName) {
+		s.Logger.InfoContext(ctx, "rejecting call to tool that is not read-only on read-only server", "server", serverInfo.Name, "tool", upstreamToolName)
+		calculatedResponse.WithImmediateResponse(403, fmt.Sprintf("mcp server %s is read-only and tool %s is not read-only", serverInfo.Name, toolName))
+		return calculatedResponse.Build()
+	}
 	headers.WithMCPToolName(upstreamToolName)
+	if timeout, ok := s.toolCallTimeout(mcpReq, serverInfo, upstreamToolName); ok {
+		headers.WithUpstreamTimeout(timeout)
+	}
 	mcpReq.ReWriteToolName(upstreamToolName)
+	s.applyDefaultArguments(mcpReq, serverInfo, upstreamToolName)
+	applyToolCallMeta(mcpReq, serverInfo)
 	headers.WithMCPServerName(serverInfo.Name)
+	if faultResponse := s.injectFault(ctx, mcpReq); faultResponse != nil {
+		return faultResponse
+	}
+	// calls answered from the cache or by an identical call in flight are counted like those routed to the server
+	if exceeded := s.chargeToolCallQuota(ctx, mcpReq); exceeded != nil {
+		return exceeded
+	}
+	if body, ok := s.cachedToolResult(ctx, mcpReq, serverInfo, upstreamToolName); ok {
+		s.logRequest(ctx, "answering tool call from the tool result cache", "server", serverInfo.Name, "tool", upstreamToolName, "session id", mcpReq.GetSessionID())
+		return calculatedResponse.WithImmediateJSONResponse(200, body).Build()
+	}
+	if body, ok := s.coalescedToolResult(ctx, mcpReq, serverInfo); ok {
+		s.logRequest(ctx, "answering tool call with the result of an identical call in flight", "server", serverInfo.Name, "tool", upstreamToolName, "session id", mcpReq.GetSessionID())
+		return calculatedResponse.WithImmediateJSONResponse(200, body).Build()
+	}
+
+	limit := serverInfo.MaxConcurrentToolCalls
+	if limit <= 0 {
+		limit = s.MaxConcurrentToolCalls
+	}
+	queueTimeout := s.ToolCallQueueTimeout
+	if queueTimeout <= 0 {
+		queueTimeout = DefaultToolCallQueueTimeout
+	}
+	release, err := s.toolCalls.acquire(ctx, serverInfo.Name, limit, queueTimeout)
+	if err != nil {
+		s.Logger.InfoContext(ctx, "tool call concurrency limit reached, rejecting call", "server", serverInfo.Name, "limit", limit, "tool", upstreamToolName, "error", err)
+		calculatedResponse.WithImmediateResponse(429, fmt.Sprintf("mcp server %s has reached its limit of %d concurrent tool calls", serverInfo.Name, limit))
+		return calculatedResponse.Build()
+	}
+	// the slot is held until the response completes unless the call is not routed
+	defer func() {
+		if mcpReq.toolCallDone == nil {
+			release()
+		}
+	}()
+
+	responses, routed := s.routeToServer(ctx, mcpReq, serverInfo, headers)
+	if routed {
+		s.logRequest(ctx, "routing tool call", "server", serverInfo.Name, "tool", upstreamToolName, "session id", mcpReq.GetSessionID())
+		mcpReq.toolCallDone = release
+		if s.ForwardCancellations && mcpReq.ID != nil {
+			untrack := s.trackToolCall(ctx, mcpReq.GetSessionID(), *mcpReq.ID, serverInfo.Name)
+			mcpReq.toolCallDone = func() {
+				release()
+				untrack()
+			}
+		}
+	}
+	return responses
+}
 
+// HandleResourceRead routes a resources/read of a uri matching the resource template of a server to that server, with
+// the server's prefix removed from the uri. Other resources are not federated so their reads go to the broker
+func (s *ExtProcServer) HandleResourceRead(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	uri := mcpReq.ResourceURI()
+	if s.Broker == nil || uri == "" {
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	serverName, upstreamURI, ok := s.Broker.ResourceTemplateServer(uri)
+	if !ok {
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	serverInfo := s.RoutingConfig.GetServerConfigByName(serverName)
+	if serverInfo == nil || !serverInfo.Enabled {
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	if rejected := s.rejectInvalidSession(ctx, mcpReq); rejected != nil {
+		return rejected
+	}
+	headers := NewHeaders()
+	headers.WithMCPMethod(mcpReq.Method)
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		headers.WithCustomHeader(logging.RequestIDHeader, requestID)
+	}
+	headers.WithMCPServerName(serverInfo.Name)
+	mcpReq.serverName = serverInfo.Name
+	mcpReq.Params["uri"] = upstreamURI
+	responses, routed := s.routeToServer(ctx, mcpReq, serverInfo, headers)
+	if routed {
+		s.logRequest(ctx, "routing resource read", "server", serverInfo.Name, "uri", upstreamURI, "session id", mcpReq.GetSessionID())
+	}
+	return responses
+}
+
+// routeToServer sends the request on to the server in the client's session with it, creating the session if needed.
+// routed is false when an immediate response is returned instead
+func (s *ExtProcServer) routeToServer(ctx context.Context, mcpReq *MCPRequest, serverInfo *config.MCPServer, headers *HeadersBuilder) ([]*eppb.ProcessingResponse, bool) {
+	if responses, heldBack := s.heldBackByRateLimit(ctx, mcpReq, serverInfo.Name); heldBack {
+		return responses, false
+	}
+	calculatedResponse := NewResponse()
 	// create a new session with backend mcp if one doesn't exist
 	exists, err := s.SessionCache.GetSession(ctx, mcpReq.GetSessionID())
 	if err != nil {
-		s.Logger.Error("failed to get session from cache", "error", err)
+		s.Logger.ErrorContext(ctx, "failed to get session from cache", "error", err)
 		calculatedResponse.WithImmediateResponse(500, "internal error")
-		return calculatedResponse.Build()
+		return calculatedResponse.Build(), false
 	}
 	var remoteMCPSeverSession string
-	if id, ok := exists[mcpReq.serverName]; ok {
-		s.Logger.Debug("found session in cache", "session id", mcpReq.GetSessionID(), "for server", serverInfo.Name, "remote session", id)
+	if pinned := s.debugUpstreamSession(mcpReq); pinned != "" {
+		remoteMCPSeverSession = pinned
+	} else if id, ok := exists[mcpReq.serverName]; ok {
+		s.Logger.DebugContext(ctx, "found session in cache", "session id", mcpReq.GetSessionID(), "for server", serverInfo.Name, "remote session", id)
 		remoteMCPSeverSession = id
 	}
-	if remoteMCPSeverSession == "" {
-		id, err := s.initializeMCPSeverSession(ctx, mcpReq)
+	// clients of a cordoned server keep the session they have as a new one would be refused
+	expired := remoteMCPSeverSession != "" && !serverInfo.Cordoned && s.upstreamSessionExpired(ctx, mcpReq.GetSessionID(), mcpReq.serverName, serverInfo.UpstreamSessionMaxAge)
+	if remoteMCPSeverSession == "" || expired {
+		initialize := s.initializeMCPSeverSession
+		if expired {
+			initialize = func(ctx context.Context, mcpReq *MCPRequest) (string, error) {
+				return s.refreshMCPServerSession(ctx, mcpReq, remoteMCPSeverSession)
+			}
+		}
+		id, err := initialize(ctx, mcpReq)
 		if err != nil {
+			s.Logger.ErrorContext(ctx, "failed to get remote mcp server session id ", "error ", err)
 			var routerErr *RouterError
-			if errors.As(err, &routerErr) {
+			var upstreamErr *upstream.Error
+			if errors.As(err, &routerErr) && errors.As(err, &upstreamErr) {
+				return s.upstreamErrorResponse(mcpReq, routerErr.Code(), upstreamErr.Kind, routerErr.Error()), false
+			}
+			if errors.As(err, &routerErr) && routerErr.RetryAfter > 0 {
+				calculatedResponse.WithImmediateRetryResponse(routerErr.Code(), routerErr.Error(), routerErr.RetryAfter)
+			} else if errors.As(err, &routerErr) {
 				calculatedResponse.WithImmediateResponse(routerErr.Code(), routerErr.Error())
 			} else {
 				calculatedResponse.WithImmediateResponse(500, "internal error")
 			}
-			s.Logger.Error("failed to get remote mcp server session id ", "error ", err)
-			return calculatedResponse.Build()
+			return calculatedResponse.Build(), false
 		}
 		remoteMCPSeverSession = id
 	}
 	headers.WithMCPSession(remoteMCPSeverSession)
-	// reset the host name now we have identified the correct tool and backend
+	// reset the host name now we have identified the correct backend
 	headers.WithAuthority(serverInfo.Hostname)
 	// prepare request body for MCP Backend
 	body, err := mcpReq.ToBytes()
 	if err != nil {
-		s.Logger.Error("failed to marshal body to bytes ", "error ", err)
+		s.Logger.ErrorContext(ctx, "failed to marshal body to bytes ", "error ", err)
 		calculatedResponse.WithImmediateResponse(500, "internal error")
-		return calculatedResponse.Build()
+		return calculatedResponse.Build(), false
 	}
 	path, err := serverInfo.Path()
 	if err != nil {
-		s.Logger.Error("failed to parse url for backend ", "error ", err)
+		s.Logger.ErrorContext(ctx, "failed to parse url for backend ", "error ", err)
 		calculatedResponse.WithImmediateResponse(500, "internal error")
-		return calculatedResponse.Build()
+		return calculatedResponse.Build(), false
+	}
+	// a configured credential replaces the client's token unless the server is trusted with the client's Authorization header
+	for name, value := range serverInfo.RouterCredentialHeaders() {
+		headers.WithCustomHeader(strings.ToLower(name), value)
+	}
+	path, err = serverInfo.WithCredentialQuery(path)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to add credential to path for backend ", "error ", err)
+		calculatedResponse.WithImmediateResponse(500, "internal error")
+		return calculatedResponse.Build(), false
 	}
 	headers.WithPath(path)
 	headers.WithContentLength(len(body))
+	// the client's token is not sent on to a server with its own credential unless the server forwards it
+	var removed []string
+	if serverInfo.RouterRemovesAuthorization() {
+		removed = append(removed, "authorization")
+	}
 	if mcpReq.Streaming {
-		s.Logger.Debug("returning streaming response")
-		calculatedResponse.WithStreamingResponse(headers.Build(), body)
+		s.Logger.DebugContext(ctx, "returning streaming response")
+		calculatedResponse.WithStreamingResponse(headers.Build(), body).WithoutRequestBodyHeaders(removed)
+		return calculatedResponse.Build(), true
+	}
+	calculatedResponse.WithRequestBodyHeadersAndBodyReponse(headers.Build(), body).WithoutRequestBodyHeaders(removed)
+	return calculatedResponse.Build(), true
+}
+
+// rejectInvalidSession returns an immediate response when the request has no valid gateway session. Requests routed
+// straight to an upstream do not go through the broker so the session is validated here. It returns nil for a
+// valid session
+func (s *ExtProcServer) rejectInvalidSession(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	calculatedResponse := NewResponse()
+	if mcpReq.GetSessionID() == "" {
+		s.Logger.InfoContext(ctx, "No mcp-session-id found in headers")
+		calculatedResponse.WithImmediateResponse(400, "no session ID found")
 		return calculatedResponse.Build()
 	}
-	calculatedResponse.WithRequestBodyHeadersAndBodyReponse(headers.Build(), body)
-	return calculatedResponse.Build()
+	isInvalidSession, err := s.JWTManager.Validate(ctx, mcpReq.GetSessionID())
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to validate session", "session", mcpReq.GetSessionID(), "error ", err)
+		calculatedResponse.WithImmediateResponse(404, "session no longer valid")
+		return calculatedResponse.Build()
+	}
+	if isInvalidSession {
+		s.Logger.DebugContext(ctx, "invalid session ", "session", mcpReq.GetSessionID())
+		calculatedResponse.WithImmediateResponse(404, "session no longer valid")
+		return calculatedResponse.Build()
+	}
+	return nil
+}
+
+// isReadOnlyTool returns true if the broker knows the server's tool and it is annotated as read-only. The broker does
+// not advertise other tools of read-only servers so a tool it does not know is not read-only
+func (s *ExtProcServer) isReadOnlyTool(serverInfo *config.MCPServer, upstreamToolName string) bool {
+	if s.Broker == nil {
+		return false
+	}
+	annotations, ok := s.Broker.ToolAnnotations(serverInfo.ID(), upstreamToolName)
+	return ok && config.IsReadOnly(annotations)
+}
+
+// debugUpstreamSession returns the upstream session pinned by the debug header. The header is ignored unless debug mode is enabled
+func (s *ExtProcServer) debugUpstreamSession(mcpReq *MCPRequest) string {
+	pinned := mcpReq.GetSingleHeaderValue(debugUpstreamSessionHeader)
+	if pinned == "" {
+		return ""
+	}
+	if !s.DebugUpstreamSession {
+		s.Logger.Debug("ignoring debug upstream session header as debug mode is disabled", "server", mcpReq.serverName)
+		return ""
+	}
+	s.Logger.Warn("using debug pinned upstream session", "session id", mcpReq.GetSessionID(), "server", mcpReq.serverName, "remote session", pinned)
+	return pinned
 }
 
 // initializeMCPSeverSession will create a new session and connection with the backend MCP server
-// This connection is kept open for the life of the gateway session.
+// This connection is kept open for the life of the gateway session. Concurrent calls for the same gateway session
+// and server share a single upstream session.
 // TODO when we receive a 404 from a backend MCP Server we should have a way to close the connection at that point also currently when we receive a 404 we remove the session from cache and will open a new connection. They will all be closed once the gateway session expires or the client sends a delete but it is a source of potential leaks
 func (s *ExtProcServer) initializeMCPSeverSession(ctx context.Context, mcpReq *MCPRequest) (string, error) {
+	id, err, _ := s.sessionInits.Do(mcpReq.GetSessionID()+"/"+mcpReq.serverName, func() (any, error) {
+		return s.createMCPServerSession(ctx, mcpReq)
+	})
+	if err != nil {
+		return "", err
+	}
+	return id.(string), nil
+}
+
+func (s *ExtProcServer) createMCPServerSession(ctx context.Context, mcpReq *MCPRequest) (string, error) {
 	mcpServerConfig := s.RoutingConfig.GetServerConfigByName(mcpReq.serverName)
 	exists, err := s.SessionCache.GetSession(ctx, mcpReq.GetSessionID())
 	if err != nil {
 		return "", NewRouterErrorf(500, "failed to check for existing session: %w", err)
 	}
 	if id, ok := exists[mcpReq.serverName]; ok {
-		s.Logger.Debug("found session in cache", "session id", mcpReq.GetSessionID(), "for server", mcpServerConfig.Name, "remote session", id)
+		s.Logger.DebugContext(ctx, "found session in cache", "session id", mcpReq.GetSessionID(), "for server", mcpServerConfig.Name, "remote session", id)
 		return id, nil
 	}
+	if mcpServerConfig.Cordoned {
+		// clients with a session keep using it above, only new sessions are refused
+		s.Logger.InfoContext(ctx, "mcp server is cordoned, rejecting new session", "server", mcpServerConfig.Name, "session", mcpReq.GetSessionID())
+		return "", NewRouterErrorf(503, "mcp server %s is cordoned and not accepting new sessions", mcpServerConfig.Name)
+	}
+	if wait := s.sessionBackoff.remaining(mcpServerConfig.Name); wait > 0 {
+		s.Logger.InfoContext(ctx, "mcp server keeps losing upstream sessions, backing off new session", "server", mcpServerConfig.Name, "retry after", wait, "session", mcpReq.GetSessionID())
+		sessionReinitBackoffTotal.WithLabelValues(mcpServerConfig.Name).Inc()
+		routerErr := NewRouterErrorf(503, "mcp server %s keeps losing sessions, retry in %s", mcpServerConfig.Name, wait.Round(time.Millisecond))
+		routerErr.RetryAfter = wait
+		return "", routerErr
+	}
 	passThroughHeaders := map[string]string{}
 	if mcpReq.Headers != nil {
 		// We don't want to pass through any sudo routing headers :authority, :path etc or the mcp-session-id from the gateway. The mcp-session-id will be
 		// set by the client based on the target backend. otherwise pass through everything from the client in case of custom headers
 		for _, h := range mcpReq.Headers.Headers {
-			if !strings.HasPrefix(strings.ToLower(h.Key), ":") && strings.ToLower(h.Key) != "mcp-session-id" {
+			if !strings.HasPrefix(strings.ToLower(h.Key), ":") && !isSessionHeader(h.Key) {
 				passThroughHeaders[h.Key] = string(h.RawValue)
 			}
 		}
@@ -309,35 +644,45 @@ func (s *ExtProcServer) initializeMCPSeverSession(ctx context.Context, mcpReq *M
 		passThroughHeaders["x-mcp-toolname"] = mcpReq.ToolName()
 		passThroughHeaders["user-agent"] = "mcp-router"
 	}
-	s.Logger.Debug("initializing target as no mcp-session-id found for client", "server ", mcpReq.serverName, "with passthrough headers", passThroughHeaders)
-
-	clientHandle, err := s.InitForClient(ctx, s.RoutingConfig.MCPGatewayInternalHostname, s.RoutingConfig.RouterAPIKey, mcpServerConfig, passThroughHeaders)
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		passThroughHeaders[logging.RequestIDHeader] = requestID
+	}
+	reuse := mcpServerConfig.UpstreamSessionLimitBehavior == config.UpstreamSessionLimitReuse
+	reserved, err := s.upstreamSessions.reserve(mcpServerConfig.Name, mcpServerConfig.MaxUpstreamSessions, reuse)
 	if err != nil {
-		s.Logger.Error("failed to get remote session ", "error", err)
-		return "", NewRouterErrorf(500, "failed to create session for mcp server: %w", err)
+		s.Logger.InfoContext(ctx, "upstream session limit reached, rejecting session", "server", mcpServerConfig.Name, "limit", mcpServerConfig.MaxUpstreamSessions, "session", mcpReq.GetSessionID())
+		return "", NewRouterErrorf(503, "mcp server %s has reached its limit of %d sessions", mcpServerConfig.Name, mcpServerConfig.MaxUpstreamSessions)
 	}
-	var sessionCloser = func() {
-		s.Logger.Debug("gateway session expired closing client", "Session ", mcpReq.GetSessionID())
-		if err := clientHandle.Close(); err != nil {
-			s.Logger.Debug("failed to close client connection", "err", err)
-		}
-		if err := s.SessionCache.DeleteSessions(ctx, mcpReq.GetSessionID()); err != nil {
-			s.Logger.Debug("failed to delete session", "session", mcpReq.GetSessionID(), "err", err)
+	if reserved != nil {
+		s.Logger.DebugContext(ctx, "upstream session limit reached, reusing upstream session", "server", mcpServerConfig.Name, "limit", mcpServerConfig.MaxUpstreamSessions, "remote session", reserved.id)
+	} else {
+		s.Logger.DebugContext(ctx, "initializing target as no mcp-session-id found for client", "server ", mcpReq.serverName, "with passthrough headers", passThroughHeaders)
+		clientHandle, err := s.InitForClient(ctx, s.RoutingConfig.MCPGatewayInternalHostname, s.RoutingConfig.RouterAPIKey, mcpServerConfig, passThroughHeaders)
+		if err != nil {
+			s.upstreamSessions.cancel(mcpServerConfig.Name)
+			upstreamErr := upstream.WrapError(err)
+			s.Logger.ErrorContext(ctx, "failed to get remote session ", "error", err, "kind", upstreamErr.Kind)
+			return "", NewRouterError(int32(upstreamErr.Kind.HTTPStatus()), fmt.Errorf("failed to create session for mcp server: %w", upstreamErr))
 		}
+		reserved = s.upstreamSessions.add(mcpServerConfig.Name, clientHandle.GetSessionId(), clientHandle)
 	}
+	s.gatewaySessions.add(mcpReq.GetSessionID(), func() { s.upstreamSessions.release(mcpServerConfig.Name, reserved) })
 	// close connection with remote backend and delete any sessions when our gateway session expires
-	expiresAt, err := s.JWTManager.GetExpiresIn(mcpReq.GetSessionID())
+	expiresAt, err := s.JWTManager.GetExpiresIn(ctx, mcpReq.GetSessionID())
 	if err != nil {
 		// this err would be caused by an invalid token so force a re-initialize
-		s.Logger.Error("failed to get expires in value. Forcing session reset", "err", err)
-		sessionCloser()
+		s.Logger.ErrorContext(ctx, "failed to get expires in value. Forcing session reset", "err", err)
+		s.CloseGatewaySession(ctx, mcpReq.GetSessionID())
 		return "", NewRouterError(404, fmt.Errorf("invalid session"))
 	}
-	time.AfterFunc(time.Until(expiresAt), sessionCloser)
-	remoteSessionID := clientHandle.GetSessionId()
-	s.Logger.Debug("got remote session id ", "mcp server", mcpServerConfig.Name, "session", remoteSessionID)
-	if _, err := s.SessionCache.AddSession(ctx, mcpReq.GetSessionID(), mcpServerConfig.Name, remoteSessionID); err != nil {
-		s.Logger.Error("failed to add remote session to cache", "error", err)
+	time.AfterFunc(time.Until(expiresAt), func() {
+		s.Logger.Debug("gateway session expired releasing upstream session", "Session ", mcpReq.GetSessionID())
+		s.CloseGatewaySession(context.Background(), mcpReq.GetSessionID())
+	})
+	remoteSessionID := reserved.id
+	s.Logger.DebugContext(ctx, "got remote session id ", "mcp server", mcpServerConfig.Name, "session", remoteSessionID)
+	if err := s.addUpstreamSession(ctx, mcpReq.GetSessionID(), mcpServerConfig.Name, remoteSessionID, reserved.created); err != nil {
+		s.Logger.ErrorContext(ctx, "failed to add remote session to cache", "error", err)
 		// again if this fails it is likely terminal due to a network connection error
 		return "", NewRouterError(500, fmt.Errorf("internal error"))
 	}
@@ -345,6 +690,145 @@ func (s *ExtProcServer) initializeMCPSeverSession(ctx context.Context, mcpReq *M
 
 }
 
+// applyDefaultArguments adds the server's default arguments for the tool that the client did not send. Arguments the
+// client sent are kept. Defaults that do not match the tool's input schema known to the broker are not applied
+func (s *ExtProcServer) applyDefaultArguments(mcpReq *MCPRequest, serverInfo *config.MCPServer, upstreamToolName string) {
+	defaults, err := serverInfo.DefaultArguments(upstreamToolName)
+	if err != nil {
+		s.Logger.Error("ignoring invalid default arguments", "server", serverInfo.Name, "tool", upstreamToolName, "error", err)
+		return
+	}
+	if len(defaults) == 0 {
+		return
+	}
+	if s.Broker != nil {
+		if schema, ok := s.Broker.ToolInputSchema(serverInfo.ID(), upstreamToolName); ok {
+			if err := config.CheckArguments(defaults, schema); err != nil {
+				s.Logger.Error("default arguments do not match the tool's input schema, not applying them", "server", serverInfo.Name, "tool", upstreamToolName, "error", err)
+				return
+			}
+		}
+	}
+	arguments, ok := mcpReq.Params["arguments"].(map[string]any)
+	if !ok {
+		if mcpReq.Params["arguments"] != nil {
+			// the upstream rejects arguments that are not an object, adding to them would hide the client's error
+			return
+		}
+		arguments = map[string]any{}
+	}
+	for name, value := range defaults {
+		if _, sent := arguments[name]; !sent {
+			arguments[name] = value
+		}
+	}
+	mcpReq.Params["arguments"] = arguments
+}
+
+// waitForDiscovery waits up to DiscoveryWaitTimeout for the broker to finish discovering the server's tools, so a
+// call made while the gateway starts is not routed before its tool's annotations and upstream name are known. It
+// returns false if discovery is still in progress after the timeout
+func (s *ExtProcServer) waitForDiscovery(ctx context.Context, serverInfo *config.MCPServer) bool {
+	if s.Broker == nil {
+		return true
+	}
+	timeout := s.DiscoveryWaitTimeout
+	if timeout <= 0 {
+		timeout = DefaultDiscoveryWaitTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return s.Broker.WaitForDiscovery(waitCtx, serverInfo.ID())
+}
+
+// toolCallTimeout returns the upstream timeout of a call to the tool. It is the tool's own timeout or ToolCallTimeout,
+// shortened to the client's deadline so the MCP server can stop working on a call the client no longer waits for.
+// ok is false when neither is set and the timeout of the gateway's route applies
+func (s *ExtProcServer) toolCallTimeout(mcpReq *MCPRequest, serverInfo *config.MCPServer, upstreamToolName string) (time.Duration, bool) {
+	timeout, ok := serverInfo.ToolTimeout(upstreamToolName)
+	if !ok && s.ToolCallTimeout > 0 {
+		timeout, ok = s.ToolCallTimeout, true
+	}
+	value := mcpReq.GetSingleHeaderValue(clientTimeoutHeader)
+	if value == "" {
+		return timeout, ok
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || millis <= 0 {
+		s.Logger.Debug("ignoring invalid client timeout", "header", clientTimeoutHeader, "value", value)
+		return timeout, ok
+	}
+	if clientTimeout := time.Duration(millis) * time.Millisecond; !ok || clientTimeout < timeout {
+		return clientTimeout, true
+	}
+	return timeout, ok
+}
+
+// unknownToolResponse answers a tools/call to a tool no server provides with a tool not found error. The HTTP
+// status is UnknownToolStatus. A 404 is avoided by default as MCP clients treat it as their session having ended
+func (s *ExtProcServer) unknownToolResponse(mcpReq *MCPRequest, toolName string) []*eppb.ProcessingResponse {
+	status := s.UnknownToolStatus
+	if status == 0 {
+		status = DefaultUnknownToolStatus
+	}
+	return s.upstreamErrorResponse(mcpReq, int32(status), upstream.ErrorKindToolNotFound, fmt.Sprintf("tool %s not found", toolName))
+}
+
+// upstreamErrorData is the data of the JSON-RPC error for an upstream failure. It carries the kind of failure so
+// clients can act on it without parsing the message
+type upstreamErrorData struct {
+	Kind upstream.ErrorKind `json:"kind"`
+	// RetryAfter is the number of seconds to wait before retrying a retryable failure
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+// upstreamErrorResponse answers the request with the JSON-RPC error of the kind of upstream failure
+func (s *ExtProcServer) upstreamErrorResponse(mcpReq *MCPRequest, status int32, kind upstream.ErrorKind, message string) []*eppb.ProcessingResponse {
+	body, err := upstreamErrorBody(mcpReq, message, upstreamErrorData{Kind: kind})
+	if err != nil {
+		s.Logger.Error("failed to marshal upstream error", "kind", kind, "error", err)
+		return NewResponse().WithImmediateResponse(status, message).Build()
+	}
+	return NewResponse().WithImmediateJSONResponse(status, body).Build()
+}
+
+// upstreamErrorBody returns the JSON-RPC error answering the request with the code of the kind in data
+func upstreamErrorBody(mcpReq *MCPRequest, message string, data upstreamErrorData) ([]byte, error) {
+	var id any
+	if mcpReq.ID != nil {
+		id = *mcpReq.ID
+	}
+	return json.Marshal(mcp.NewJSONRPCError(mcp.NewRequestId(id), data.Kind.JSONRPCCode(), message, data))
+}
+
+// pingResponse is the JSON-RPC response to a ping. The result of a ping is always empty
+type pingResponse struct {
+	JSONRPC string   `json:"jsonrpc"`
+	ID      *int     `json:"id"`
+	Result  struct{} `json:"result"`
+}
+
+// HandlePing answers a ping from the router without a hop to the broker. The response only depends on the gateway
+// session being valid, which the router can check itself. Pings without a valid session are forwarded to the broker
+// so the client gets the same error as for any other request.
+func (s *ExtProcServer) HandlePing(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	if mcpReq.GetSessionID() == "" || s.JWTManager == nil {
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	isInvalidSession, err := s.JWTManager.Validate(ctx, mcpReq.GetSessionID())
+	if err != nil || isInvalidSession {
+		s.Logger.DebugContext(ctx, "ping for invalid session, forwarding to broker", "session", mcpReq.GetSessionID(), "error", err)
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	body, err := json.Marshal(pingResponse{JSONRPC: "2.0", ID: mcpReq.ID})
+	if err != nil {
+		s.Logger.Error("failed to marshal ping response, forwarding to broker", "error", err)
+		return s.HandleNoneToolCall(mcpReq)
+	}
+	s.Logger.Debug("answered ping from the router", "session", mcpReq.GetSessionID())
+	return NewResponse().WithImmediateJSONResponse(200, body).Build()
+}
+
 // HandleNoneToolCall handles none tools calls such as initialize. The majority of these requests will be forwarded to the broker
 func (s *ExtProcServer) HandleNoneToolCall(mcpReq *MCPRequest) []*eppb.ProcessingResponse {
 	s.Logger.Debug("HandleMCPBrokerRequest", "HTTP Method", mcpReq.GetSingleHeaderValue(":method"), "mcp method", mcpReq.Method, "session", mcpReq.sessionID)
@@ -363,7 +847,11 @@ func (s *ExtProcServer) HandleNoneToolCall(mcpReq *MCPRequest) []*eppb.Processin
 			s.Logger.Debug("HandleMCPBrokerRequest initialize request", "target", remoteInitializeTarget, "call", mcpReq.Method)
 			headers.WithAuthority(remoteInitializeTarget)
 			// ensure we unset the router specific headers so they are not sent to the backend
-			return response.WithRequestBodySetUnsetHeadersResponse(headers.Build(), []string{"mcp-init-host", RoutingKey}).Build()
+			unset := []string{"mcp-init-host", RoutingKey}
+			if s.RoutingConfig.RouterRemovesAuthorizationForHost(remoteInitializeTarget) {
+				unset = append(unset, "authorization")
+			}
+			return response.WithRequestBodySetUnsetHeadersResponse(headers.Build(), unset).Build()
 		}
 
 	}
@@ -1,8 +1,14 @@
 package mcprouter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	"k8s.io/utils/ptr"
@@ -10,12 +16,19 @@ import (
 	"errors"
 	"log/slog"
 	"os"
+	"strings"
 	"testing"
 
+	filterpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/logging"
 	"github.com/kagenti/mcp-gateway/internal/session"
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/require"
 )
 
@@ -168,7 +181,7 @@ func TestHandleRequestBody(t *testing.T) {
 	require.NoError(t, err)
 
 	// Generate a valid JWT token
-	validToken := jwtManager.Generate()
+	validToken := jwtManager.Generate(context.Background())
 
 	// Pre-populate the session cache so InitForClient won't be called
 	// This simulates the case where the session already exists
@@ -276,6 +289,10 @@ func TestHandleRequestHeaders(t *testing.T) {
 							Key:      ":authority",
 							RawValue: []byte("original.host.com"),
 						},
+						{
+							Key:      "x-request-id",
+							RawValue: []byte("envoy-request-id"),
+						},
 					},
 				},
 			}
@@ -299,3 +316,1873 @@ func TestHandleRequestHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleRequestHeadersSkipsBody(t *testing.T) {
+	server := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{MCPGatewayExternalHostname: "mcp.local"},
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+	testCases := []struct {
+		Name        string
+		Method      string
+		ContentType string
+		ExpectBody  bool
+	}{
+		{Name: "json-rpc post", Method: http.MethodPost, ContentType: "application/json", ExpectBody: true},
+		{Name: "json-rpc post with charset", Method: http.MethodPost, ContentType: "application/json; charset=utf-8", ExpectBody: true},
+		{Name: "post without content type", Method: http.MethodPost, ExpectBody: true},
+		{Name: "notification stream", Method: http.MethodGet, ContentType: "text/event-stream"},
+		{Name: "session termination", Method: http.MethodDelete},
+		{Name: "form post", Method: http.MethodPost, ContentType: "application/x-www-form-urlencoded"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			headers := []*corev3.HeaderValue{{Key: ":method", RawValue: []byte(tc.Method)}, {Key: "x-request-id", RawValue: []byte("request")}}
+			if tc.ContentType != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "content-type", RawValue: []byte(tc.ContentType)})
+			}
+			responses, err := server.HandleRequestHeaders(&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}})
+			require.NoError(t, err)
+			require.Len(t, responses, 1)
+			require.NotNil(t, responses[0].GetRequestHeaders())
+			if tc.ExpectBody {
+				require.Nil(t, responses[0].ModeOverride)
+				return
+			}
+			require.NotNil(t, responses[0].ModeOverride)
+			require.Equal(t, filterpb.ProcessingMode_NONE, responses[0].ModeOverride.RequestBodyMode)
+			require.Equal(t, filterpb.ProcessingMode_SEND, responses[0].ModeOverride.ResponseHeaderMode)
+		})
+	}
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger, err := logging.New(logs, logging.FormatText, int(slog.LevelDebug))
+	require.NoError(t, err)
+	cache, err := session.NewCache(context.Background())
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(context.Background())
+	_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+	require.NoError(t, err)
+	server := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			MCPGatewayExternalHostname: "mcp.local",
+			Servers: []*config.MCPServer{
+				{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost"},
+			},
+		},
+		JWTManager:   jwtManager,
+		Logger:       logger,
+		SessionCache: cache,
+	}
+
+	t.Run("incoming request id is forwarded upstream and logged", func(t *testing.T) {
+		logs.Reset()
+		headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: "mcp-session-id", RawValue: []byte(gatewaySession)},
+			{Key: "x-request-id", RawValue: []byte("client-request-id")},
+		}}
+		responses, err := server.HandleRequestHeaders(&eppb.HttpHeaders{Headers: headers})
+		require.NoError(t, err)
+		for _, h := range responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			require.NotEqual(t, "x-request-id", h.Header.Key, "the incoming request id is kept")
+		}
+
+		ctx := logging.ContextWithRequestID(context.Background(), "client-request-id")
+		resp := server.RouteMCPRequest(ctx, &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": "s_time"},
+			Headers: headers,
+		})
+		require.Len(t, resp, 1)
+		rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+		require.True(t, ok)
+		setHeaders := map[string]string{}
+		for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+			setHeaders[h.Header.Key] = string(h.Header.RawValue)
+		}
+		require.Equal(t, "client-request-id", setHeaders["x-request-id"])
+		require.Contains(t, logs.String(), "request_id=client-request-id")
+	})
+
+	t.Run("request without an id is given one", func(t *testing.T) {
+		headers := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: "mcp-session-id", RawValue: []byte(gatewaySession)},
+		}}}
+		responses, err := server.HandleRequestHeaders(headers)
+		require.NoError(t, err)
+		setHeaders := map[string]string{}
+		for _, h := range responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			setHeaders[h.Header.Key] = string(h.Header.RawValue)
+		}
+		require.NotEmpty(t, setHeaders["x-request-id"])
+		require.Equal(t, setHeaders["x-request-id"], getSingleValueHeader(headers.Headers, "x-request-id"))
+	})
+}
+
+func TestHandleToolCallDebugUpstreamSession(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		DebugEnabled  bool
+		PinnedSession string
+		ExpectSession string
+	}{
+		{
+			Name:          "header ignored when debug disabled",
+			PinnedSession: "pinned-session",
+			ExpectSession: "cached-session",
+		},
+		{
+			Name:          "header honored when debug enabled",
+			DebugEnabled:  true,
+			PinnedSession: "pinned-session",
+			ExpectSession: "pinned-session",
+		},
+		{
+			Name:          "cached session used when debug enabled without header",
+			DebugEnabled:  true,
+			ExpectSession: "cached-session",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost"},
+					},
+				},
+				JWTManager:           jwtManager,
+				Logger:               logger,
+				SessionCache:         cache,
+				DebugUpstreamSession: tc.DebugEnabled,
+			}
+
+			headers := []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}
+			if tc.PinnedSession != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "x-mcp-debug-upstream-session", RawValue: []byte(tc.PinnedSession)})
+			}
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s_mytool"},
+				Headers: &corev3.HeaderMap{Headers: headers},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			var upstreamSession string
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				if h.Header.Key == sessionHeader {
+					upstreamSession = string(h.Header.RawValue)
+				}
+			}
+			require.Equal(t, tc.ExpectSession, upstreamSession)
+		})
+	}
+}
+
+func TestHandleToolCallBackendPathRewrite(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		PathRewrite string
+		ExpectPath  string
+	}{
+		{
+			Name:       "path from server url",
+			ExpectPath: "/mcp",
+		},
+		{
+			Name:        "rewritten path",
+			PathRewrite: "/proxy/team-a/mcp",
+			ExpectPath:  "/proxy/team-a/mcp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost", PathRewrite: tc.PathRewrite},
+					},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+			}
+
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s_mytool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			var path string
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				if h.Header.Key == ":path" {
+					path = string(h.Header.RawValue)
+				}
+			}
+			require.Equal(t, tc.ExpectPath, path)
+		})
+	}
+}
+
+func TestHandleToolCallCredentialLocation(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Location             string
+		ForwardAuthorization bool
+		Additional           []config.AdditionalCredential
+		ExpectHeaders        map[string]string
+		ExpectPath           string
+		// ExpectRemoveAuth is true when the client's authorization header is removed rather than forwarded
+		ExpectRemoveAuth bool
+	}{
+		{
+			Name:          "no location replaces the client's authorization header",
+			ExpectHeaders: map[string]string{"authorization": "1234"},
+			ExpectPath:    "/mcp",
+		},
+		{
+			Name:          "bearer",
+			Location:      "bearer",
+			ExpectHeaders: map[string]string{"authorization": "Bearer 1234"},
+			ExpectPath:    "/mcp",
+		},
+		{
+			Name:             "named header",
+			Location:         "header:X-Api-Key",
+			ExpectHeaders:    map[string]string{"x-api-key": "1234"},
+			ExpectPath:       "/mcp",
+			ExpectRemoveAuth: true,
+		},
+		{
+			Name:             "query parameter",
+			Location:         "query:api_key",
+			ExpectPath:       "/mcp?api_key=1234",
+			ExpectRemoveAuth: true,
+		},
+		{
+			Name:                 "forwarded authorization is not replaced",
+			ForwardAuthorization: true,
+			ExpectPath:           "/mcp",
+		},
+		{
+			Name:                 "forwarded authorization is not replaced by a bearer credential",
+			Location:             "bearer",
+			ForwardAuthorization: true,
+			ExpectPath:           "/mcp",
+		},
+		{
+			Name:                 "credential in another header is set alongside the forwarded authorization",
+			Location:             "header:X-Api-Key",
+			ForwardAuthorization: true,
+			ExpectHeaders:        map[string]string{"x-api-key": "1234"},
+			ExpectPath:           "/mcp",
+		},
+		{
+			Name:     "additional credentials are sent with the credential",
+			Location: "header:X-Api-Key",
+			Additional: []config.AdditionalCredential{
+				{Value: "5678", Location: "header:X-Api-Secret"},
+				{Value: "acme", Location: "query:tenant"},
+			},
+			ExpectHeaders:    map[string]string{"x-api-key": "1234", "x-api-secret": "5678"},
+			ExpectPath:       "/mcp?tenant=acme",
+			ExpectRemoveAuth: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost", Credential: "1234", CredentialLocation: tc.Location, AdditionalCredentials: tc.Additional, ForwardAuthorization: tc.ForwardAuthorization},
+					},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+			}
+
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s_mytool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: "mcp-session-id", RawValue: []byte(gatewaySession)},
+					{Key: "authorization", RawValue: []byte("Bearer user-token")},
+				}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, tc.ExpectPath, setHeaders[":path"])
+			for key, value := range tc.ExpectHeaders {
+				require.Equal(t, value, setHeaders[key])
+			}
+			if _, ok := tc.ExpectHeaders["authorization"]; !ok {
+				// the client's authorization header is forwarded as it is or removed
+				require.NotContains(t, setHeaders, "authorization")
+			}
+			if tc.ExpectRemoveAuth {
+				require.Contains(t, rb.RequestBody.Response.HeaderMutation.RemoveHeaders, "authorization")
+			} else {
+				require.NotContains(t, rb.RequestBody.Response.HeaderMutation.RemoveHeaders, "authorization")
+			}
+		})
+	}
+}
+
+func TestHandleToolCallTLSHost(t *testing.T) {
+	testCases := []struct {
+		Name string
+		TLS  *config.TLSConfig
+	}{
+		{
+			Name: "server without tls",
+		},
+		{
+			Name: "tls server name",
+			TLS:  &config.TLSConfig{ServerName: "mcp.example.com"},
+		},
+		{
+			Name: "host override",
+			TLS:  &config.TLSConfig{ServerName: "mcp.example.com", Host: "mcp.example.com"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.DiscardHandler)
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "https://dummy.svc:8443/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "dummy.mcp.local", TLS: tc.TLS},
+					},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+			}
+
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s_mytool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			setHeaders := map[string]string{}
+			for _, h := range resp[0].GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			// the upstream's host and sni are set at the backend, the route is still selected by the hostname
+			require.Equal(t, "dummy.mcp.local", setHeaders[":authority"])
+		})
+	}
+}
+
+func TestHandleNoneToolCallInitializeRemovesAuthorization(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		Server           *config.MCPServer
+		ExpectRemoveAuth bool
+	}{
+		{
+			Name:   "server without a credential is sent the client's authorization",
+			Server: &config.MCPServer{Name: "dummy", Hostname: "dummy.mcp.local"},
+		},
+		{
+			Name:             "server with a credential in another header is not sent the client's authorization",
+			Server:           &config.MCPServer{Name: "dummy", Hostname: "dummy.mcp.local", Credential: "1234", CredentialLocation: "header:X-Api-Key"},
+			ExpectRemoveAuth: true,
+		},
+		{
+			Name:             "server with a credential in a query parameter is not sent the client's authorization",
+			Server:           &config.MCPServer{Name: "dummy", Hostname: "dummy.mcp.local", Credential: "1234", CredentialLocation: "query:api_key"},
+			ExpectRemoveAuth: true,
+		},
+		{
+			Name:   "server that forwards authorization is sent the client's authorization",
+			Server: &config.MCPServer{Name: "dummy", Hostname: "dummy.mcp.local", Credential: "1234", CredentialLocation: "header:X-Api-Key", ForwardAuthorization: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{RouterAPIKey: "secret", Servers: []*config.MCPServer{tc.Server}},
+				Logger:        slog.New(slog.DiscardHandler),
+			}
+			resp := server.HandleNoneToolCall(&MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "initialize",
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: "mcp-init-host", RawValue: []byte("dummy.mcp.local")},
+					{Key: RoutingKey, RawValue: []byte("secret")},
+					{Key: "authorization", RawValue: []byte("Bearer user-token")},
+				}},
+			})
+			require.Len(t, resp, 1)
+			removed := resp[0].GetRequestBody().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+			require.Contains(t, removed, "mcp-init-host")
+			if tc.ExpectRemoveAuth {
+				require.Contains(t, removed, "authorization")
+			} else {
+				require.NotContains(t, removed, "authorization")
+			}
+		})
+	}
+}
+
+func TestHandleToolCallToolTimeout(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Tool           string
+		Timeouts       map[string]time.Duration
+		DefaultTimeout time.Duration
+		ClientTimeout  string
+		ExpectTimeout  string
+	}{
+		{
+			Name: "no timeouts configured",
+			Tool: "s_slow",
+		},
+		{
+			Name:          "tool with a timeout",
+			Tool:          "s_slow",
+			Timeouts:      map[string]time.Duration{"slow": 5 * time.Minute, "time": 2 * time.Second},
+			ExpectTimeout: "300000",
+		},
+		{
+			Name:          "each tool uses its own timeout",
+			Tool:          "s_time",
+			Timeouts:      map[string]time.Duration{"slow": 5 * time.Minute, "time": 2 * time.Second},
+			ExpectTimeout: "2000",
+		},
+		{
+			Name:     "tool without a timeout uses the route timeout",
+			Tool:     "s_headers",
+			Timeouts: map[string]time.Duration{"slow": 5 * time.Minute},
+		},
+		{
+			Name:           "tool without a timeout uses the default",
+			Tool:           "s_headers",
+			Timeouts:       map[string]time.Duration{"slow": 5 * time.Minute},
+			DefaultTimeout: 30 * time.Second,
+			ExpectTimeout:  "30000",
+		},
+		{
+			Name:           "client deadline shorter than the default",
+			Tool:           "s_headers",
+			DefaultTimeout: 30 * time.Second,
+			ClientTimeout:  "1500",
+			ExpectTimeout:  "1500",
+		},
+		{
+			Name:          "client deadline shorter than a long running tool",
+			Tool:          "s_slow",
+			Timeouts:      map[string]time.Duration{"slow": 5 * time.Minute},
+			ClientTimeout: "10000",
+			ExpectTimeout: "10000",
+		},
+		{
+			Name:           "client deadline longer than the tool's is capped",
+			Tool:           "s_time",
+			Timeouts:       map[string]time.Duration{"time": 2 * time.Second},
+			DefaultTimeout: 30 * time.Second,
+			ClientTimeout:  "60000",
+			ExpectTimeout:  "2000",
+		},
+		{
+			Name:          "client deadline without a server timeout",
+			Tool:          "s_headers",
+			ClientTimeout: "1500",
+			ExpectTimeout: "1500",
+		},
+		{
+			Name:           "invalid client deadline is ignored",
+			Tool:           "s_headers",
+			DefaultTimeout: 30 * time.Second,
+			ClientTimeout:  "soon",
+			ExpectTimeout:  "30000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(context.Background())
+			_, err = cache.AddSession(context.Background(), gatewaySession, "dummy", "cached-session")
+			require.NoError(t, err)
+
+			server := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost", ToolTimeouts: tc.Timeouts},
+					},
+				},
+				JWTManager:      jwtManager,
+				Logger:          logger,
+				SessionCache:    cache,
+				ToolCallTimeout: tc.DefaultTimeout,
+			}
+
+			headers := []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}
+			if tc.ClientTimeout != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: clientTimeoutHeader, RawValue: []byte(tc.ClientTimeout)})
+			}
+			resp := server.RouteMCPRequest(context.Background(), &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tc.Tool},
+				Headers: &corev3.HeaderMap{Headers: headers},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			if tc.ExpectTimeout == "" {
+				require.NotContains(t, setHeaders, upstreamTimeoutHeader)
+				return
+			}
+			require.Equal(t, tc.ExpectTimeout, setHeaders[upstreamTimeoutHeader])
+		})
+	}
+}
+
+func TestHandleToolCallRenamedTool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	for _, name := range []string{"get_weather", "list-repos-v1", "echo"} {
+		upstreamServer.AddTool(mcp.NewTool(name), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name), nil
+		})
+	}
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "dummy",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "s_",
+			Enabled:    true,
+			Hostname:   "localhost",
+			ToolRenames: []config.ToolRename{
+				{Match: "^get_(.*)$", Replace: "fetch_${1}"},
+				{Match: "-", Replace: "_"},
+				// not invertible, the "_v1" suffix cannot be recovered from the advertised name
+				{Match: "_v1$", Replace: ""},
+			},
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[serverID]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	advertised := []string{}
+	for name := range mcpBroker.MCPServer().ListTools() {
+		advertised = append(advertised, name)
+	}
+	require.ElementsMatch(t, []string{"s_fetch_weather", "s_list_repos", "s_echo"}, advertised)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "dummy", "cached-session")
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+		Broker:        mcpBroker,
+	}
+
+	testCases := []struct {
+		Tool             string
+		ExpectedUpstream string
+	}{
+		{Tool: "s_fetch_weather", ExpectedUpstream: "get_weather"},
+		{Tool: "s_list_repos", ExpectedUpstream: "list-repos-v1"},
+		{Tool: "s_echo", ExpectedUpstream: "echo"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Tool, func(t *testing.T) {
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tc.Tool},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, tc.ExpectedUpstream, setHeaders[toolHeader])
+			var body struct {
+				Params struct {
+					Name string `json:"name"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, tc.ExpectedUpstream, body.Params.Name)
+		})
+	}
+}
+
+func TestHandleToolCallToolPrefixAliases(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTool(mcp.NewTool("echo"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:              "dummy",
+			URL:               upstreamSrv.URL + "/mcp",
+			ToolPrefix:        "new_",
+			ToolPrefixAliases: []string{"old_"},
+			Enabled:           true,
+			Hostname:          "dummy.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[serverID]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	advertised := []string{}
+	for name := range mcpBroker.MCPServer().ListTools() {
+		advertised = append(advertised, name)
+	}
+	require.ElementsMatch(t, []string{"new_echo", "old_echo"}, advertised)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "dummy", "cached-session")
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+		Broker:        mcpBroker,
+	}
+
+	for _, tool := range []string{"new_echo", "old_echo"} {
+		t.Run(tool, func(t *testing.T) {
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tool},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			// both prefixes reach the same upstream with the prefix stripped
+			require.Equal(t, "echo", setHeaders[toolHeader])
+			require.Equal(t, "dummy.mcp.local", setHeaders[authorityHeader])
+			var body struct {
+				Params struct {
+					Name string `json:"name"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, "echo", body.Params.Name)
+		})
+	}
+}
+
+func TestHandleToolCallToolPrefixSeparator(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTool(mcp.NewTool("get_forecast"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("sunny"), nil
+	})
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:                "weather",
+			URL:                 upstreamSrv.URL + "/mcp",
+			ToolPrefix:          "weather",
+			ToolPrefixAliases:   []string{"w"},
+			ToolPrefixSeparator: "__",
+			Enabled:             true,
+			Hostname:            "weather.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[serverID]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	advertised := []string{}
+	for name := range mcpBroker.MCPServer().ListTools() {
+		advertised = append(advertised, name)
+	}
+	require.ElementsMatch(t, []string{"weather__get_forecast", "w__get_forecast"}, advertised)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "weather", "cached-session")
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+		Broker:        mcpBroker,
+	}
+
+	// every advertised name is routed back to the upstream tool with the prefix and separator removed
+	for _, tool := range advertised {
+		t.Run(tool, func(t *testing.T) {
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tool},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, "get_forecast", setHeaders[toolHeader])
+			require.Equal(t, "weather.mcp.local", setHeaders[authorityHeader])
+			var body struct {
+				Params struct {
+					Name string `json:"name"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, "get_forecast", body.Params.Name)
+		})
+	}
+}
+
+func TestHandleToolCallFallbackTools(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// the upstream is down so the broker lists its fallback tools
+	upstreamSrv := httptest.NewServer(http.NotFoundHandler())
+	upstreamSrv.Close()
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:          "dummy",
+			URL:           upstreamSrv.URL + "/mcp",
+			ToolPrefix:    "s_",
+			Enabled:       true,
+			Hostname:      "dummy.mcp.local",
+			FallbackTools: []config.FallbackTool{{Name: "echo"}},
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		return mcpBroker.ServingFallbackTools(serverID)
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Contains(t, mcpBroker.MCPServer().ListTools(), "s_echo")
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+		Broker:        mcpBroker,
+	}
+	resp := router.RouteMCPRequest(ctx, &MCPRequest{
+		ID:      ptr.To(1),
+		JSONRPC: "2.0",
+		Method:  "tools/call",
+		Params:  map[string]any{"name": "s_echo"},
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(jwtManager.Generate(ctx))}}},
+	})
+	require.Len(t, resp, 1)
+	immediate := resp[0].GetImmediateResponse()
+	require.NotNil(t, immediate)
+	require.EqualValues(t, 503, immediate.Status.Code)
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Kind string `json:"kind"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(immediate.Body, &body))
+	require.Equal(t, upstream.ErrorKindUnreachable.JSONRPCCode(), body.Error.Code)
+	require.Equal(t, string(upstream.ErrorKindUnreachable), body.Error.Data.Kind)
+	require.Contains(t, body.Error.Message, "temporarily unavailable")
+}
+
+func TestHandleToolCallVirtualServerToolBindings(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	// the prefixes of both servers match weather_eu_forecast. Without a binding the first configured server is used
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{
+			{Name: "mcp-test/weather-eu", URL: "http://weather-eu.mcp.local/mcp", ToolPrefix: "weather_eu_", Enabled: true, Hostname: "weather-eu.mcp.local"},
+			{Name: "mcp-test/weather", URL: "http://weather.mcp.local/mcp", ToolPrefix: "weather_", Enabled: true, Hostname: "weather.mcp.local"},
+		},
+		VirtualServers: []*config.VirtualServer{{
+			Name:         "mcp-test/global",
+			Tools:        []string{"weather_eu_forecast"},
+			ToolBindings: []config.ToolBinding{{Tool: "weather_eu_forecast", Server: "mcp-test/weather"}},
+		}},
+	}
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	for _, server := range routingConfig.Servers {
+		_, err = cache.AddSession(ctx, gatewaySession, server.Name, server.Name+"-session")
+		require.NoError(t, err)
+	}
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+	}
+
+	testCases := []struct {
+		Name           string
+		Headers        map[string]string
+		ExpectServer   string
+		ExpectUpstream string
+	}{
+		{
+			Name:           "no virtual server",
+			ExpectServer:   "mcp-test/weather-eu",
+			ExpectUpstream: "forecast",
+		},
+		{
+			Name:           "virtual server selected by header",
+			Headers:        map[string]string{"x-mcp-virtualserver": "mcp-test/global"},
+			ExpectServer:   "mcp-test/weather",
+			ExpectUpstream: "eu_forecast",
+		},
+		{
+			Name:           "virtual server selected by path",
+			Headers:        map[string]string{":path": "/mcp/vs/mcp-test/global?client=test"},
+			ExpectServer:   "mcp-test/weather",
+			ExpectUpstream: "eu_forecast",
+		},
+		{
+			Name:           "virtual server without the binding",
+			Headers:        map[string]string{"x-mcp-virtualserver": "mcp-test/other"},
+			ExpectServer:   "mcp-test/weather-eu",
+			ExpectUpstream: "forecast",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}}
+			for key, value := range tc.Headers {
+				headers.Headers = append(headers.Headers, &corev3.HeaderValue{Key: key, RawValue: []byte(value)})
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "weather_eu_forecast"},
+				Headers: headers,
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, tc.ExpectServer, setHeaders[mcpServerNameHeader])
+			require.Equal(t, tc.ExpectUpstream, setHeaders[toolHeader])
+			require.Equal(t, tc.ExpectServer+"-session", setHeaders[sessionHeader])
+		})
+	}
+}
+
+func TestHandleResourceRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false), server.WithResourceCapabilities(false, false))
+	upstreamServer.AddTool(mcp.NewTool("echo"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("echo"), nil
+	})
+	upstreamServer.AddResourceTemplate(mcp.NewResourceTemplate("file:///{name}", "file"), func(_ context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, Text: "content"}}, nil
+	})
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/files",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "files_",
+			Enabled:    true,
+			Hostname:   "files.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[serverID]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/files", "cached-session")
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: routingConfig,
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+		Broker:        mcpBroker,
+	}
+
+	testCases := []struct {
+		Name              string
+		URI               string
+		ExpectUpstreamURI string
+	}{
+		{Name: "uri matching a template is routed to its server", URI: "files_file:///readme.md", ExpectUpstreamURI: "file:///readme.md"},
+		{Name: "other uris are read from the broker", URI: "file:///readme.md"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "resources/read",
+				Params:  map[string]any{"uri": tc.URI},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			setHeaders := map[string]string{}
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				setHeaders[h.Header.Key] = string(h.Header.RawValue)
+			}
+			if tc.ExpectUpstreamURI == "" {
+				require.Equal(t, "mcpBroker", setHeaders[mcpServerNameHeader])
+				require.Nil(t, rb.RequestBody.Response.BodyMutation)
+				return
+			}
+			require.Equal(t, "mcp-test/files", setHeaders[mcpServerNameHeader])
+			require.Equal(t, "files.mcp.local", setHeaders[authorityHeader])
+			require.Equal(t, "cached-session", setHeaders[sessionHeader])
+			var body struct {
+				Params struct {
+					URI string `json:"uri"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, tc.ExpectUpstreamURI, body.Params.URI)
+		})
+	}
+}
+
+func TestHandleToolCallDefaultArguments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTools(
+		server.ServerTool{Tool: mcp.NewTool("forecast", mcp.WithString("region"), mcp.WithNumber("days"))},
+		server.ServerTool{Tool: mcp.NewTool("alerts", mcp.WithString("region"))},
+	)
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/weather",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "w_",
+			Enabled:    true,
+			Hostname:   "weather.mcp.local",
+			ToolDefaultArguments: map[string]string{
+				"forecast": `{"region":"eu-west-1","days":3}`,
+				// alerts has no zone argument so its defaults are not applied
+				"alerts": `{"zone":"a"}`,
+			},
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(time.Minute))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	require.True(t, mcpBroker.WaitForDiscovery(ctx, routingConfig.Servers[0].ID()))
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/weather", "cached-session")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name            string
+		Tool            string
+		Arguments       any
+		ExpectArguments map[string]any
+	}{
+		{Name: "defaults added to a call without arguments", Tool: "w_forecast", ExpectArguments: map[string]any{"region": "eu-west-1", "days": float64(3)}},
+		{Name: "defaults only fill missing arguments", Tool: "w_forecast", Arguments: map[string]any{"days": float64(7)}, ExpectArguments: map[string]any{"region": "eu-west-1", "days": float64(7)}},
+		{Name: "client values win", Tool: "w_forecast", Arguments: map[string]any{"region": "us-east-1", "days": float64(1)}, ExpectArguments: map[string]any{"region": "us-east-1", "days": float64(1)}},
+		{Name: "defaults not matching the schema are not applied", Tool: "w_alerts", Arguments: map[string]any{"region": "eu"}, ExpectArguments: map[string]any{"region": "eu"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: routingConfig,
+				JWTManager:    jwtManager,
+				Logger:        logger,
+				SessionCache:  cache,
+				Broker:        mcpBroker,
+			}
+			params := map[string]any{"name": tc.Tool}
+			if tc.Arguments != nil {
+				params["arguments"] = tc.Arguments
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  params,
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			var body struct {
+				Params struct {
+					Arguments map[string]any `json:"arguments"`
+				} `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, tc.ExpectArguments, body.Params.Arguments)
+		})
+	}
+}
+
+func TestRouteMCPRequestShortCircuitsPing(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(context.Background())
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	validSession := jwtManager.Generate(context.Background())
+
+	server := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{},
+		JWTManager:    jwtManager,
+		Logger:        logger,
+		SessionCache:  cache,
+	}
+
+	testCases := []struct {
+		Name            string
+		Method          string
+		Session         string
+		ExpectImmediate bool
+	}{
+		{Name: "ping with valid session is answered by the router", Method: "ping", Session: validSession, ExpectImmediate: true},
+		{Name: "ping without session reaches the broker", Method: "ping"},
+		{Name: "ping with invalid session reaches the broker", Method: "ping", Session: "not-a-session"},
+		{Name: "initialize reaches the broker", Method: "initialize"},
+		{Name: "tools/list reaches the broker", Method: "tools/list", Session: validSession},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mcpReq := &MCPRequest{
+				ID:      ptr.To(3),
+				JSONRPC: "2.0",
+				Method:  tc.Method,
+				Headers: &corev3.HeaderMap{},
+			}
+			if tc.Session != "" {
+				mcpReq.Headers.Headers = append(mcpReq.Headers.Headers, &corev3.HeaderValue{Key: "mcp-session-id", RawValue: []byte(tc.Session)})
+			}
+
+			resp := server.RouteMCPRequest(context.Background(), mcpReq)
+			require.Len(t, resp, 1)
+			if tc.ExpectImmediate {
+				immediate := resp[0].GetImmediateResponse()
+				require.NotNil(t, immediate)
+				require.EqualValues(t, 200, immediate.Status.Code)
+				require.Equal(t, "content-type", immediate.Headers.SetHeaders[0].Header.Key)
+				require.Equal(t, []byte("application/json"), immediate.Headers.SetHeaders[0].Header.RawValue)
+				require.JSONEq(t, `{"jsonrpc":"2.0","id":3,"result":{}}`, string(immediate.Body))
+				return
+			}
+			require.Nil(t, resp[0].GetImmediateResponse())
+			serverName := ""
+			for _, header := range resp[0].GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+				if header.Header.Key == "x-mcp-servername" {
+					serverName = string(header.Header.RawValue)
+				}
+			}
+			require.Equal(t, "mcpBroker", serverName)
+		})
+	}
+}
+
+func TestHandleToolCallReadOnlyServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// mirrors server2's mix of read-only and destructive tools
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTools(
+		server.ServerTool{Tool: mcp.NewTool("time", mcp.WithReadOnlyHintAnnotation(true), mcp.WithDestructiveHintAnnotation(false))},
+		server.ServerTool{Tool: mcp.NewTool("set_time", mcp.WithReadOnlyHintAnnotation(false), mcp.WithDestructiveHintAnnotation(true))},
+		server.ServerTool{Tool: mcp.NewTool("unannotated")},
+	)
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/server2",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "s2_",
+			Enabled:    true,
+			Hostname:   "server2.mcp.local",
+			ReadOnly:   true,
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	serverID := routingConfig.Servers[0].ID()
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[serverID]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/server2", "cached-session")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name         string
+		Tool         string
+		Broker       broker.MCPBroker
+		ExpectReject bool
+	}{
+		{Name: "read-only tool", Tool: "s2_time", Broker: mcpBroker},
+		{Name: "destructive tool", Tool: "s2_set_time", Broker: mcpBroker, ExpectReject: true},
+		{Name: "tool without read-only hint", Tool: "s2_unannotated", Broker: mcpBroker, ExpectReject: true},
+		{Name: "unknown tool", Tool: "s2_delete_everything", Broker: mcpBroker, ExpectReject: true},
+		{Name: "no broker to check annotations", Tool: "s2_time", ExpectReject: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: routingConfig,
+				JWTManager:    jwtManager,
+				Logger:        logger,
+				SessionCache:  cache,
+				Broker:        tc.Broker,
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tc.Tool},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			immediate := resp[0].GetImmediateResponse()
+			if !tc.ExpectReject {
+				require.Nil(t, immediate)
+				return
+			}
+			require.NotNil(t, immediate)
+			require.EqualValues(t, 403, immediate.Status.Code)
+			require.Contains(t, string(immediate.Body), "mcp server mcp-test/server2 is read-only")
+		})
+	}
+}
+
+func TestHandleToolCallDuringDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// the upstream does not answer the broker until released so its discovery stays in progress
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	releaseUpstream := func() { releaseOnce.Do(func() { close(release) }) }
+	defer releaseUpstream()
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTool(mcp.NewTool("time"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("now"), nil
+	})
+	upstreamHandler := server.NewStreamableHTTPServer(upstreamServer)
+	upstreamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		upstreamHandler.ServeHTTP(w, r)
+	}))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/server1",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "s1_",
+			Enabled:    true,
+			Hostname:   "server1.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(time.Minute))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/server1", "cached-session")
+	require.NoError(t, err)
+	toolCall := func(waitTimeout time.Duration) []*eppb.ProcessingResponse {
+		router := &ExtProcServer{
+			RoutingConfig:        routingConfig,
+			JWTManager:           jwtManager,
+			Logger:               logger,
+			SessionCache:         cache,
+			Broker:               mcpBroker,
+			DiscoveryWaitTimeout: waitTimeout,
+		}
+		return router.RouteMCPRequest(ctx, &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": "s1_time"},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		})
+	}
+
+	// a call that gives up waiting gets a retryable error rather than a not found
+	resp := toolCall(50 * time.Millisecond)
+	require.Len(t, resp, 1)
+	immediate := resp[0].GetImmediateResponse()
+	require.NotNil(t, immediate)
+	require.EqualValues(t, 503, immediate.Status.Code)
+	require.Contains(t, string(immediate.Body), "still being discovered")
+	require.Equal(t, "retry-after", immediate.GetHeaders().GetSetHeaders()[0].GetHeader().GetKey())
+
+	// a call waiting for discovery is routed once it completes
+	routed := make(chan []*eppb.ProcessingResponse, 1)
+	go func() {
+		routed <- toolCall(5 * time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	releaseUpstream()
+	select {
+	case resp = <-routed:
+		require.Len(t, resp, 1)
+		require.Nil(t, resp[0].GetImmediateResponse())
+	case <-time.After(10 * time.Second):
+		t.Fatal("tool call was not routed after discovery completed")
+	}
+	require.True(t, mcpBroker.RegisteredMCPServers()[routingConfig.Servers[0].ID()].GetStatus().Ready)
+}
+
+func TestHandleToolCallCordonedServer(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	existingSession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, existingSession, "mcp-test/server1", "cached-session")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name         string
+		Session      string
+		ExpectReject bool
+	}{
+		{Name: "existing session keeps routing", Session: existingSession},
+		{Name: "new session is refused", Session: jwtManager.Generate(ctx), ExpectReject: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{
+						Name:       "mcp-test/server1",
+						URL:        "http://server1.mcp.local/mcp",
+						ToolPrefix: "s1_",
+						Enabled:    true,
+						Hostname:   "server1.mcp.local",
+						Cordoned:   true,
+					}},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+				InitForClient: func(_ context.Context, _, _ string, _ *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					t.Fatal("no upstream session should be created for a cordoned server")
+					return nil, nil
+				},
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s1_time"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(tc.Session)}}},
+			})
+			require.Len(t, resp, 1)
+			immediate := resp[0].GetImmediateResponse()
+			if !tc.ExpectReject {
+				require.Nil(t, immediate)
+				var upstreamSession string
+				for _, h := range resp[0].GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+					if h.Header.Key == sessionHeader {
+						upstreamSession = string(h.Header.RawValue)
+					}
+				}
+				require.Equal(t, "cached-session", upstreamSession)
+				return
+			}
+			require.NotNil(t, immediate)
+			require.EqualValues(t, 503, immediate.Status.Code)
+			require.Contains(t, string(immediate.Body), "mcp server mcp-test/server1 is cordoned")
+		})
+	}
+}
+
+func TestHandleToolCallSyntheticServer(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{{
+				Name:           "mcp-test/mock",
+				ToolPrefix:     "mock_",
+				Enabled:        true,
+				SyntheticTools: []config.SyntheticTool{{Name: "weather", Response: "sunny"}},
+			}},
+		},
+		JWTManager:   jwtManager,
+		Logger:       logger,
+		SessionCache: cache,
+		InitForClient: func(_ context.Context, _, _ string, _ *config.MCPServer, _ map[string]string) (*client.Client, error) {
+			t.Fatal("no upstream session should be created for a synthetic server")
+			return nil, nil
+		},
+	}
+	mcpReq := &MCPRequest{
+		ID:      ptr.To(1),
+		JSONRPC: "2.0",
+		Method:  "tools/call",
+		Params:  map[string]any{"name": "mock_weather"},
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(jwtManager.Generate(ctx))}}},
+	}
+	resp := router.RouteMCPRequest(ctx, mcpReq)
+	require.Len(t, resp, 1)
+	require.Nil(t, resp[0].GetImmediateResponse())
+
+	// the call reaches the broker, which answers it, with the tool name the broker advertises
+	serverName := ""
+	for _, header := range resp[0].GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		require.NotEqual(t, ":authority", header.Header.Key)
+		if header.Header.Key == "x-mcp-servername" {
+			serverName = string(header.Header.RawValue)
+		}
+	}
+	require.Equal(t, "mcpBroker", serverName)
+	require.Equal(t, "mock_weather", mcpReq.ToolName())
+}
+
+func TestHandleToolCallUnknownTool(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name         string
+		Status       int
+		ExpectStatus int32
+	}{
+		{Name: "default status", ExpectStatus: 200},
+		{Name: "configured status", Status: 404, ExpectStatus: 404},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local"}},
+				},
+				JWTManager:        jwtManager,
+				Logger:            logger,
+				SessionCache:      cache,
+				UnknownToolStatus: tc.Status,
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(7),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "other_tool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(jwtManager.Generate(ctx))}}},
+			})
+			require.Len(t, resp, 1)
+			immediate := resp[0].GetImmediateResponse()
+			require.NotNil(t, immediate)
+			require.EqualValues(t, tc.ExpectStatus, immediate.Status.Code)
+			require.Equal(t, "content-type", immediate.GetHeaders().GetSetHeaders()[0].GetHeader().GetKey())
+			require.Equal(t, "application/json", string(immediate.GetHeaders().GetSetHeaders()[0].GetHeader().GetRawValue()))
+			require.JSONEq(t, `{"jsonrpc":"2.0","id":7,"error":{"code":-32601,"message":"tool other_tool not found","data":{"kind":"tool-not-found"}}}`, string(immediate.Body))
+		})
+	}
+}
+
+func TestHandleToolCallUpstreamErrors(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name         string
+		InitErr      error
+		ExpectStatus int32
+		ExpectCode   int
+		ExpectKind   string
+	}{
+		{
+			Name:         "unreachable",
+			InitErr:      errors.New("dial tcp 10.0.0.1:80: connect: connection refused"),
+			ExpectStatus: 503,
+			ExpectCode:   -32001,
+			ExpectKind:   "unreachable",
+		},
+		{
+			Name:         "protocol mismatch",
+			InitErr:      fmt.Errorf("failed to create client: %w", mcp.UnsupportedProtocolVersionError{Version: "2020-01-01"}),
+			ExpectStatus: 502,
+			ExpectCode:   -32002,
+			ExpectKind:   "protocol-mismatch",
+		},
+		{
+			Name:         "auth failed",
+			InitErr:      errors.New("initialize request failed: request failed with status 401: unauthorized"),
+			ExpectStatus: 502,
+			ExpectCode:   -32003,
+			ExpectKind:   "auth-failed",
+		},
+		{
+			Name:         "timeout",
+			InitErr:      fmt.Errorf("initialize request failed: %w", context.DeadlineExceeded),
+			ExpectStatus: 504,
+			ExpectCode:   -32004,
+			ExpectKind:   "timeout",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local"}},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+				InitForClient: func(_ context.Context, _, _ string, _ *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					return nil, tc.InitErr
+				},
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(3),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "s1_tool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(jwtManager.Generate(ctx))}}},
+			})
+			require.Len(t, resp, 1)
+			immediate := resp[0].GetImmediateResponse()
+			require.NotNil(t, immediate)
+			require.EqualValues(t, tc.ExpectStatus, immediate.Status.Code)
+			var body struct {
+				ID    int `json:"id"`
+				Error struct {
+					Code int `json:"code"`
+					Data struct {
+						Kind string `json:"kind"`
+					} `json:"data"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(immediate.Body, &body))
+			require.Equal(t, 3, body.ID)
+			require.Equal(t, tc.ExpectCode, body.Error.Code)
+			require.Equal(t, tc.ExpectKind, body.Error.Data.Kind)
+		})
+	}
+}
+
+func TestHandleToolCallSessionIDStrategies(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	opaqueManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache, session.WithOpaqueSessionIDs(cache))
+	require.NoError(t, err)
+	otherKeyManager, err := session.NewJWTManager("other-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Manager *session.JWTManager
+		// Revoke makes a session id generated by Manager invalid
+		Revoke func(t *testing.T, sessionID string) string
+	}{
+		{
+			Name:    "jwt",
+			Manager: jwtManager,
+			Revoke: func(_ *testing.T, _ string) string {
+				return otherKeyManager.Generate(ctx)
+			},
+		},
+		{
+			Name:    "opaque",
+			Manager: opaqueManager,
+			Revoke: func(t *testing.T, sessionID string) string {
+				_, err := opaqueManager.Terminate(ctx, sessionID)
+				require.NoError(t, err)
+				return sessionID
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local"}},
+				},
+				JWTManager:   tc.Manager,
+				Logger:       logger,
+				SessionCache: cache,
+			}
+			toolCall := func(sessionID string) []*eppb.ProcessingResponse {
+				return router.RouteMCPRequest(ctx, &MCPRequest{
+					ID:      ptr.To(1),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": "s1_tool"},
+					Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(sessionID)}}},
+				})
+			}
+			gatewaySession := tc.Manager.Generate(ctx)
+			require.NotEmpty(t, gatewaySession)
+			_, err := cache.AddSession(ctx, gatewaySession, "mcp-test/server1", "cached-session")
+			require.NoError(t, err)
+
+			resp := toolCall(gatewaySession)
+			require.Len(t, resp, 1)
+			require.Nil(t, resp[0].GetImmediateResponse())
+
+			resp = toolCall(tc.Revoke(t, gatewaySession))
+			require.Len(t, resp, 1)
+			require.NotNil(t, resp[0].GetImmediateResponse())
+			require.EqualValues(t, 404, resp[0].GetImmediateResponse().Status.Code)
+		})
+	}
+}
+
+func TestHandleToolCallTenancy(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	tenancy := &config.Tenancy{
+		Enabled:     true,
+		SharedTools: []*config.SharedTools{{Server: "team-a/server1", Tools: []string{"s1_shared"}, Tenants: []string{"team-c"}}},
+	}
+
+	testCases := []struct {
+		Name         string
+		Tenancy      *config.Tenancy
+		Tenant       string
+		Tool         string
+		ExpectReject bool
+	}{
+		{Name: "same tenant", Tenancy: tenancy, Tenant: "team-a", Tool: "s1_search"},
+		{Name: "other tenant", Tenancy: tenancy, Tenant: "team-b", Tool: "s1_search", ExpectReject: true},
+		{Name: "no tenant", Tenancy: tenancy, Tool: "s1_search", ExpectReject: true},
+		{Name: "tool shared with the tenant", Tenancy: tenancy, Tenant: "team-c", Tool: "s1_shared"},
+		{Name: "tool not shared with the tenant", Tenancy: tenancy, Tenant: "team-c", Tool: "s1_search", ExpectReject: true},
+		{Name: "tenancy disabled", Tenancy: &config.Tenancy{}, Tenant: "team-b", Tool: "s1_search"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			gatewaySession := jwtManager.Generate(ctx)
+			_, err := cache.AddSession(ctx, gatewaySession, "team-a/server1", "upstream-session")
+			require.NoError(t, err)
+			if tc.Tenant != "" {
+				require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, session.IdentityTenant, tc.Tenant))
+			}
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{Name: "team-a/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local", Tenant: "team-a"}},
+					Tenancy: tc.Tenancy,
+				},
+				JWTManager:        jwtManager,
+				Logger:            logger,
+				SessionCache:      cache,
+				SessionIdentities: cache,
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(7),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": tc.Tool},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			immediate := resp[0].GetImmediateResponse()
+			if !tc.ExpectReject {
+				require.Nil(t, immediate, "the call is routed to the server")
+				return
+			}
+			require.NotNil(t, immediate)
+			require.EqualValues(t, DefaultUnknownToolStatus, immediate.Status.Code)
+			require.JSONEq(t, fmt.Sprintf(`{"jsonrpc":"2.0","id":7,"error":{"code":-32601,"message":"tool %s not found","data":{"kind":"tool-not-found"}}}`, tc.Tool), string(immediate.Body))
+		})
+	}
+}
+
+func TestHandleToolCallRequestLogSampling(t *testing.T) {
+	ctx := context.Background()
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, slog.New(slog.DiscardHandler), cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "dummy", "cached-session")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name            string
+		SampleRate      uint64
+		ExpectInfoLines int
+	}{
+		{Name: "sampling disabled", SampleRate: 0, ExpectInfoLines: 0},
+		{Name: "every request", SampleRate: 1, ExpectInfoLines: 9},
+		{Name: "one in three requests", SampleRate: 3, ExpectInfoLines: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+			// the routing config logs to the default logger
+			defaultLogger := slog.Default()
+			slog.SetDefault(logger)
+			defer slog.SetDefault(defaultLogger)
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "dummy", URL: "http://localhost:8080/mcp", ToolPrefix: "s_", Enabled: true, Hostname: "localhost"},
+					},
+				},
+				JWTManager:           jwtManager,
+				Logger:               logger,
+				SessionCache:         cache,
+				RequestLogSampleRate: tc.SampleRate,
+			}
+			callTool := func(session, tool string) {
+				router.RouteMCPRequest(ctx, &MCPRequest{
+					ID:      ptr.To(1),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": tool},
+					Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(session)}}},
+				})
+			}
+			toolCall := func(session string) { callTool(session, "s_mytool") }
+			for range 9 {
+				toolCall(gatewaySession)
+			}
+			require.Equal(t, tc.ExpectInfoLines, strings.Count(logs.String(), "routing tool call"))
+			require.Equal(t, tc.ExpectInfoLines, strings.Count(logs.String(), "level=INFO"), "only the sampled lines are logged at info")
+
+			// calls to unknown tools are answered by the router and are not logged at info
+			for range 3 {
+				callTool(gatewaySession, "other_tool")
+			}
+			require.Equal(t, tc.ExpectInfoLines, strings.Count(logs.String(), "level=INFO"))
+
+			// errors are not sampled
+			for range 3 {
+				toolCall("not-a-session")
+			}
+			require.Equal(t, 3, strings.Count(logs.String(), "failed to validate session"))
+		})
+	}
+}
@@ -2,8 +2,11 @@ package mcprouter
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	basepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filterpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	typepb "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 )
@@ -30,6 +33,65 @@ func (rb *ResponseBuilder) WithRequestHeadersReponse(headers []*basepb.HeaderVal
 	return rb
 }
 
+// WithoutRequestHeaders removes the named headers from the request in the request headers responses already added
+func (rb *ResponseBuilder) WithoutRequestHeaders(names []string) *ResponseBuilder {
+	if len(names) == 0 {
+		return rb
+	}
+	for _, resp := range rb.response {
+		headersResponse := resp.GetRequestHeaders()
+		if headersResponse == nil {
+			continue
+		}
+		if headersResponse.Response == nil {
+			headersResponse.Response = &eppb.CommonResponse{}
+		}
+		if headersResponse.Response.HeaderMutation == nil {
+			headersResponse.Response.HeaderMutation = &eppb.HeaderMutation{}
+		}
+		headersResponse.Response.HeaderMutation.RemoveHeaders = append(headersResponse.Response.HeaderMutation.RemoveHeaders, names...)
+	}
+	return rb
+}
+
+// WithoutRequestBodyHeaders removes the named headers from the request in the request body responses already added
+func (rb *ResponseBuilder) WithoutRequestBodyHeaders(names []string) *ResponseBuilder {
+	if len(names) == 0 {
+		return rb
+	}
+	for _, resp := range rb.response {
+		bodyResponse := resp.GetRequestBody()
+		if bodyResponse == nil {
+			continue
+		}
+		if bodyResponse.Response == nil {
+			bodyResponse.Response = &eppb.CommonResponse{}
+		}
+		if bodyResponse.Response.HeaderMutation == nil {
+			bodyResponse.Response.HeaderMutation = &eppb.HeaderMutation{}
+		}
+		bodyResponse.Response.HeaderMutation.RemoveHeaders = append(bodyResponse.Response.HeaderMutation.RemoveHeaders, names...)
+	}
+	return rb
+}
+
+// WithoutRequestBody overrides the processing mode in the request headers responses already added so envoy sends the
+// request straight on without sending its body to the processor. Response headers are still sent
+func (rb *ResponseBuilder) WithoutRequestBody() *ResponseBuilder {
+	for _, resp := range rb.response {
+		if resp.GetRequestHeaders() == nil {
+			continue
+		}
+		resp.ModeOverride = &filterpb.ProcessingMode{
+			ResponseHeaderMode:  filterpb.ProcessingMode_SEND,
+			RequestBodyMode:     filterpb.ProcessingMode_NONE,
+			RequestTrailerMode:  filterpb.ProcessingMode_SKIP,
+			ResponseTrailerMode: filterpb.ProcessingMode_SKIP,
+		}
+	}
+	return rb
+}
+
 // WithRequestBodyHeadersAndBodyReponse adds request body response with header and body mutations, clears route cache
 func (rb *ResponseBuilder) WithRequestBodyHeadersAndBodyReponse(headers []*basepb.HeaderValueOption, body []byte) *ResponseBuilder {
 	rb.response = append(rb.response, &eppb.ProcessingResponse{
@@ -106,6 +168,70 @@ func (rb *ResponseBuilder) WithImmediateResponse(statusCode int32, message strin
 	return rb
 }
 
+// retryAfterSeconds returns the retry-after value of a delay. retry-after is in whole seconds so the delay is rounded up
+// to not retry early
+func retryAfterSeconds(delay time.Duration) int64 {
+	return int64((delay + time.Second - 1) / time.Second)
+}
+
+// WithImmediateRetryResponse adds an immediate error response that tells the client to retry after the delay
+func (rb *ResponseBuilder) WithImmediateRetryResponse(statusCode int32, message string, retryAfter time.Duration) *ResponseBuilder {
+	seconds := retryAfterSeconds(retryAfter)
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &eppb.ImmediateResponse{
+				Status: &typepb.HttpStatus{
+					Code: typepb.StatusCode(statusCode),
+				},
+				Headers: &eppb.HeaderMutation{
+					SetHeaders: NewHeaders().WithCustomHeader("retry-after", strconv.FormatInt(seconds, 10)).Build(),
+				},
+				Body:    []byte(message),
+				Details: fmt.Sprintf("ext-proc error: %s", message),
+			},
+		},
+	})
+	return rb
+}
+
+// WithImmediateJSONResponse adds an immediate response with a JSON body that terminates request processing.
+// It is used when the router can answer a request itself
+func (rb *ResponseBuilder) WithImmediateJSONResponse(statusCode int32, body []byte) *ResponseBuilder {
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &eppb.ImmediateResponse{
+				Status: &typepb.HttpStatus{
+					Code: typepb.StatusCode(statusCode),
+				},
+				Headers: &eppb.HeaderMutation{
+					SetHeaders: NewHeaders().WithCustomHeader("content-type", "application/json").Build(),
+				},
+				Body: body,
+			},
+		},
+	})
+	return rb
+}
+
+// WithImmediateJSONRetryResponse adds an immediate response with a JSON body that tells the client to retry after the
+// retry-after value, which is sent as given
+func (rb *ResponseBuilder) WithImmediateJSONRetryResponse(statusCode int32, body []byte, retryAfter string) *ResponseBuilder {
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &eppb.ImmediateResponse{
+				Status: &typepb.HttpStatus{
+					Code: typepb.StatusCode(statusCode),
+				},
+				Headers: &eppb.HeaderMutation{
+					SetHeaders: NewHeaders().WithCustomHeader("content-type", "application/json").WithCustomHeader("retry-after", retryAfter).Build(),
+				},
+				Body: body,
+			},
+		},
+	})
+	return rb
+}
+
 // WithStreamingResponse adds a streaming request body response with headers
 func (rb *ResponseBuilder) WithStreamingResponse(headers []*basepb.HeaderValueOption, body []byte) *ResponseBuilder {
 	rb.response = append(rb.response, &eppb.ProcessingResponse{
@@ -173,6 +299,83 @@ func (rb *ResponseBuilder) WithResponseHeaderResponse(headers []*basepb.HeaderVa
 	return rb
 }
 
+// WithStreamingResponseHeaderResponse sets the passed headers in the response and overrides the processing
+// mode so that the response body is streamed straight to the client rather than sent to the processor
+func (rb *ResponseBuilder) WithStreamingResponseHeaderResponse(headers []*basepb.HeaderValueOption) *ResponseBuilder {
+	return rb.WithResponseBodyModeResponseHeaderResponse(headers, filterpb.ProcessingMode_NONE)
+}
+
+// WithResponseBodyModeResponseHeaderResponse sets the passed headers in the response and overrides the response body
+// processing mode for the remainder of the stream
+func (rb *ResponseBuilder) WithResponseBodyModeResponseHeaderResponse(headers []*basepb.HeaderValueOption, mode filterpb.ProcessingMode_BodySendMode) *ResponseBuilder {
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ResponseHeaders{
+			ResponseHeaders: &eppb.HeadersResponse{
+				Response: &eppb.CommonResponse{
+					HeaderMutation: &eppb.HeaderMutation{
+						SetHeaders: headers,
+					},
+				},
+			},
+		},
+		ModeOverride: &filterpb.ProcessingMode{
+			ResponseBodyMode:    mode,
+			ResponseTrailerMode: filterpb.ProcessingMode_SKIP,
+		},
+	})
+	return rb
+}
+
+// WithoutResponseHeaders removes the named headers in the response headers responses built so far
+func (rb *ResponseBuilder) WithoutResponseHeaders(names []string) *ResponseBuilder {
+	if len(names) == 0 {
+		return rb
+	}
+	for _, resp := range rb.response {
+		headersResponse := resp.GetResponseHeaders()
+		if headersResponse == nil {
+			continue
+		}
+		if headersResponse.Response == nil {
+			headersResponse.Response = &eppb.CommonResponse{}
+		}
+		if headersResponse.Response.HeaderMutation == nil {
+			headersResponse.Response.HeaderMutation = &eppb.HeaderMutation{}
+		}
+		headersResponse.Response.HeaderMutation.RemoveHeaders = append(headersResponse.Response.HeaderMutation.RemoveHeaders, names...)
+	}
+	return rb
+}
+
+// WithDoNothingResponseBodyResponse will return a processing response that makes no changes to the response body
+func (rb *ResponseBuilder) WithDoNothingResponseBodyResponse() *ResponseBuilder {
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ResponseBody{
+			ResponseBody: &eppb.BodyResponse{},
+		},
+	})
+	return rb
+}
+
+// WithResponseBodyReplacement will return a processing response that replaces the response body, or the chunk of it
+// being processed when the body is streamed, with the passed body
+func (rb *ResponseBuilder) WithResponseBodyReplacement(body []byte) *ResponseBuilder {
+	rb.response = append(rb.response, &eppb.ProcessingResponse{
+		Response: &eppb.ProcessingResponse_ResponseBody{
+			ResponseBody: &eppb.BodyResponse{
+				Response: &eppb.CommonResponse{
+					BodyMutation: &eppb.BodyMutation{
+						Mutation: &eppb.BodyMutation_Body{
+							Body: body,
+						},
+					},
+				},
+			},
+		},
+	})
+	return rb
+}
+
 // Build returns the accumulated processing responses
 func (rb *ResponseBuilder) Build() []*eppb.ProcessingResponse {
 	return rb.response
@@ -2,6 +2,7 @@ package mcprouter
 
 import (
 	"testing"
+	"time"
 
 	basepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
@@ -259,3 +260,21 @@ func TestResponseBuilder_EmptyBody(t *testing.T) {
 	rbody := responses[0].Response.(*eppb.ProcessingResponse_RequestBody)
 	require.Equal(t, emptyBody, rbody.RequestBody.Response.BodyMutation.GetBody())
 }
+
+func TestRetryAfterSeconds(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Delay    time.Duration
+		Expected int64
+	}{
+		{Name: "no delay", Delay: 0, Expected: 0},
+		{Name: "part of a second is rounded up", Delay: 100 * time.Millisecond, Expected: 1},
+		{Name: "whole seconds are kept", Delay: 2 * time.Second, Expected: 2},
+		{Name: "just over a second is rounded up", Delay: time.Second + time.Nanosecond, Expected: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, retryAfterSeconds(tc.Delay))
+		})
+	}
+}
@@ -1,37 +1,176 @@
 package mcprouter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
 
+	filterpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 )
 
+// ErrResponseIDMismatch is returned when an upstream response does not carry the id of the request it answers
+var ErrResponseIDMismatch = errors.New("upstream response id does not match request id")
+
 // HandleResponseHeaders handles response headers for session ID reverse mapping
 func (s *ExtProcServer) HandleResponseHeaders(ctx context.Context, responseHeaders *eppb.HttpHeaders, requestHeaders *eppb.HttpHeaders, req *MCPRequest) ([]*eppb.ProcessingResponse, error) {
 	response := NewResponse()
 	responseHeaderBuilder := NewHeaders()
 	slog.Debug("[EXT-PROC] HandleResponseHeaders response headers for session mapping...", "responseHeaders", responseHeaders)
 
-	slog.Debug("[EXT-PROC] HandleResponseHeaders ", "mcp-session-id", getSingleValueHeader(responseHeaders.Headers, "mcp-sessionid"))
+	slog.Debug("[EXT-PROC] HandleResponseHeaders ", "mcp-session-id", getSessionHeader(responseHeaders.Headers))
 	//"gateway session id"
-	gatewaySessionID := getSingleValueHeader(requestHeaders.Headers, sessionHeader)
+	gatewaySessionID := getSessionHeader(requestHeaders.Headers)
 	// we always want to respond with the original mcp-session-id to the client
 	if gatewaySessionID != "" {
 		responseHeaderBuilder.WithMCPSession(gatewaySessionID)
 	}
 
+	if req != nil && req.quotaRemaining != nil {
+		responseHeaderBuilder.WithCustomHeader(quotaRemainingHeader, strconv.FormatInt(*req.quotaRemaining, 10))
+	}
+
 	// intercept 404 from backend MCP Server as this means the clients mcp-session-id is invalid. We remove the session. The client can re-initialize with the gateway or they could re-invoke the tool as we will then lazily acquire a new session
 	status := getSingleValueHeader(responseHeaders.Headers, ":status")
 
 	if status == "404" && req != nil {
 		slog.Info("received 404 from backend MCP ", "method", req.Method, "server", req.serverName)
-		if err := s.SessionCache.RemoveServerSession(ctx, req.GetSessionID(), req.serverName); err != nil {
+		// the upstream session is gone so it no longer counts against the server's session limit or can be reused.
+		// A server that keeps losing sessions has new ones backed off
+		if sessions, err := s.SessionCache.GetSession(ctx, req.GetSessionID()); err == nil {
+			if created := s.upstreamSessions.invalidate(req.serverName, sessions[req.serverName]); !created.IsZero() {
+				s.sessionBackoff.sessionLost(req.serverName, created, s.SessionReinitBackoff)
+			}
+		}
+		if err := s.removeUpstreamSession(ctx, req.GetSessionID(), req.serverName); err != nil {
 			// not much we can do here log and continue
-			s.Logger.Error("failed to remove server session ", "server", req.serverName, "session", req.GetSessionID())
+			s.Logger.ErrorContext(ctx, "failed to remove server session ", "server", req.serverName, "session", req.GetSessionID())
 		}
 	}
 
-	return response.WithResponseHeaderResponse(responseHeaderBuilder.Build()).Build(), nil
+	// a rate limited request is answered with a retryable JSON-RPC error rather than the server's own response
+	if status == "429" && req != nil && req.serverName != "" {
+		return s.upstreamRateLimited(ctx, req, getSingleValueHeader(responseHeaders.Headers, "retry-after")), nil
+	}
+
+	// initialize requests hairpinned by the router to create an upstream session carry the mcp-init-host header and are not warmed again
+	if status == "200" && len(s.WarmUpstreamSessions) > 0 && req != nil && req.Method == methodInitialize && req.GetSingleHeaderValue("mcp-init-host") == "" {
+		if gatewaySession := getSessionHeader(responseHeaders.Headers); gatewaySession != "" {
+			s.warmUpstreamSessions(ctx, req, gatewaySession)
+		}
+	}
+
+	// the session id only reaches the client under the spec's header. A variant from an upstream would carry the
+	// upstream session id rather than the gateway's
+	remove := sessionHeaderVariants(responseHeaders.Headers)
+	if gatewaySessionID == "" && len(remove) > 0 {
+		responseHeaderBuilder.WithMCPSession(getSessionHeader(responseHeaders.Headers))
+	}
+	// only responses from MCP servers are filtered. The broker's responses are the gateway's own
+	if req != nil && req.serverName != "" {
+		for _, name := range s.responseHeadersToRemove(responseHeaders.Headers) {
+			if !slices.Contains(remove, name) {
+				remove = append(remove, name)
+			}
+		}
+	}
+
+	// a response known to be over its server's maximum response size is rejected before its body is read
+	if status == "200" {
+		if responses, tooLarge := s.responseTooLargeByLength(ctx, req, getSingleValueHeader(responseHeaders.Headers, "content-length")); tooLarge {
+			return responses, nil
+		}
+	}
+
+	eventStream := isEventStream(getSingleValueHeader(responseHeaders.Headers, "content-type"))
+	// response bodies are only sent to the router when it needs them. Event streams are sent to the processor chunk
+	// by chunk so they are still not collapsed into a single body
+	if status == "200" && s.inspectsResponseBody(req) {
+		mode := filterpb.ProcessingMode_BUFFERED
+		if eventStream {
+			mode = filterpb.ProcessingMode_STREAMED
+		}
+		return response.WithResponseBodyModeResponseHeaderResponse(responseHeaderBuilder.Build(), mode).WithoutResponseHeaders(remove).Build(), nil
+	}
+
+	// SSE responses (such as tool calls sending progress notifications) must reach the client event by event.
+	// Ensure envoy never buffers these regardless of the response body mode configured on the filter
+	if eventStream {
+		slog.Debug("[EXT-PROC] HandleResponseHeaders streaming event stream response to client")
+		return response.WithStreamingResponseHeaderResponse(responseHeaderBuilder.Build()).WithoutResponseHeaders(remove).Build(), nil
+	}
+
+	return response.WithResponseHeaderResponse(responseHeaderBuilder.Build()).WithoutResponseHeaders(remove).Build(), nil
 
 }
+
+// isEventStream returns true if the content type is a server sent event stream
+func isEventStream(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "text/event-stream")
+}
+
+// inspectsResponseBody returns true if the body of the response to a request routed to an upstream is sent to the
+// router. It is needed to check the JSON-RPC id with VerifyResponseIDs, to cache the result of a cacheable tool call
+// and to limit the size of the response. Otherwise the body goes straight to the client
+func (s *ExtProcServer) inspectsResponseBody(req *MCPRequest) bool {
+	if !req.correlatesResponse() {
+		return false
+	}
+	return s.VerifyResponseIDs || req.resultCacheKey != "" || req.maxResponseBytes > 0
+}
+
+// HandleResponseBody checks the upstream response answers the request it was routed for. The body is only modified
+// when it is larger than the maximum response size of its server.
+// Mismatched ids are logged as clients multiplexing requests would otherwise mis-match responses. Results of
+// cacheable tool calls are cached from JSON responses with a matching id, event streams are not cached
+func (s *ExtProcServer) HandleResponseBody(responseBody *eppb.HttpBody, req *MCPRequest, eventStream bool) []*eppb.ProcessingResponse {
+	if responses, tooLarge := s.limitResponseSize(responseBody, req, eventStream); tooLarge {
+		return responses
+	}
+	if req.correlatesResponse() && (s.VerifyResponseIDs || req.resultCacheKey != "") {
+		err := validateResponseID(responseBody.GetBody(), eventStream, *req.ID)
+		if err != nil {
+			s.Logger.Error("[EXT-PROC] HandleResponseBody upstream returned an unexpected response id", "server", req.serverName, "method", req.Method, "error", err)
+		}
+		if err == nil && req.resultCacheKey != "" && !eventStream && responseBody.GetEndOfStream() {
+			s.cacheToolResult(responseBody.GetBody(), req)
+		}
+	}
+	return NewResponse().WithDoNothingResponseBodyResponse().Build()
+}
+
+// validateResponseID checks every JSON-RPC response in the body carries the expected id.
+// Requests and notifications sent by the upstream within an event stream are ignored as are
+// events that are split across chunks and so cannot be parsed
+func validateResponseID(body []byte, eventStream bool, id int) error {
+	messages := [][]byte{body}
+	if eventStream {
+		messages = nil
+		for line := range bytes.Lines(body) {
+			if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+				messages = append(messages, data)
+			}
+		}
+	}
+
+	expected := strconv.Itoa(id)
+	for _, message := range messages {
+		var rpc struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.Unmarshal(message, &rpc); err != nil || rpc.Method != "" {
+			continue
+		}
+		if got := string(bytes.TrimSpace(rpc.ID)); got != expected {
+			return fmt.Errorf("%w: expected %s got %q", ErrResponseIDMismatch, expected, got)
+		}
+	}
+	return nil
+}
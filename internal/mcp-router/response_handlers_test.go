@@ -1,6 +1,7 @@
 package mcprouter
 
 import (
+	"bytes"
 	"context"
 	"log/slog"
 	"os"
@@ -8,8 +9,10 @@ import (
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
 	"github.com/kagenti/mcp-gateway/internal/session"
 	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
 )
 
 func TestHandleResponseHeaders_ReturnsGatewaySessionID(t *testing.T) {
@@ -354,3 +357,328 @@ func TestHandleResponseHeaders_SuccessStatusDoesNotRemoveSession(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleResponseHeaders_StreamingModeByContentType(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		ContentType    string
+		ExpectOverride bool
+	}{
+		{
+			Name:           "event stream response is streamed",
+			ContentType:    "text/event-stream",
+			ExpectOverride: true,
+		},
+		{
+			Name:           "event stream with parameters is streamed",
+			ContentType:    "Text/Event-Stream; charset=utf-8",
+			ExpectOverride: true,
+		},
+		{
+			Name:           "json response is unchanged",
+			ContentType:    "application/json",
+			ExpectOverride: false,
+		},
+		{
+			Name:           "no content type is unchanged",
+			ExpectOverride: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cache, err := session.NewCache(context.Background())
+			require.NoError(t, err)
+			server := &ExtProcServer{
+				Logger:       slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				SessionCache: cache,
+			}
+			requestHeaders := &eppb.HttpHeaders{
+				Headers: &corev3.HeaderMap{
+					Headers: []*corev3.HeaderValue{
+						{Key: "mcp-session-id", RawValue: []byte("gateway-session-123")},
+					},
+				},
+			}
+			headers := []*corev3.HeaderValue{{Key: ":status", RawValue: []byte("200")}}
+			if tc.ContentType != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "content-type", RawValue: []byte(tc.ContentType)})
+			}
+			responseHeaders := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}}
+
+			responses, err := server.HandleResponseHeaders(context.Background(), responseHeaders, requestHeaders, nil)
+			require.NoError(t, err)
+			require.Len(t, responses, 1)
+			rh, ok := responses[0].Response.(*eppb.ProcessingResponse_ResponseHeaders)
+			require.True(t, ok)
+			// the session header must be returned in both modes
+			require.Len(t, rh.ResponseHeaders.Response.HeaderMutation.SetHeaders, 1)
+			if !tc.ExpectOverride {
+				require.Nil(t, responses[0].ModeOverride)
+				return
+			}
+			require.NotNil(t, responses[0].ModeOverride)
+			require.Equal(t, "NONE", responses[0].ModeOverride.ResponseBodyMode.String())
+		})
+	}
+}
+
+func TestValidateResponseID(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Body        string
+		EventStream bool
+		ExpectErr   bool
+	}{
+		{
+			Name: "json response with matching id",
+			Body: `{"jsonrpc":"2.0","id":7,"result":{"content":[]}}`,
+		},
+		{
+			Name:      "json response with wrong id",
+			Body:      `{"jsonrpc":"2.0","id":8,"result":{"content":[]}}`,
+			ExpectErr: true,
+		},
+		{
+			Name:      "json response with id as string",
+			Body:      `{"jsonrpc":"2.0","id":"7","result":{"content":[]}}`,
+			ExpectErr: true,
+		},
+		{
+			Name:      "json response without id",
+			Body:      `{"jsonrpc":"2.0","result":{"content":[]}}`,
+			ExpectErr: true,
+		},
+		{
+			Name:        "event stream with notifications and matching id",
+			Body:        "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{}}\n\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":7,\"result\":{}}\n\n",
+			EventStream: true,
+		},
+		{
+			Name:        "event stream with wrong id",
+			Body:        "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{}}\n\n",
+			EventStream: true,
+			ExpectErr:   true,
+		},
+		{
+			Name:        "event stream chunk split mid event is ignored",
+			Body:        "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":1,\"res",
+			EventStream: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := validateResponseID([]byte(tc.Body), tc.EventStream, 7)
+			if tc.ExpectErr {
+				require.ErrorIs(t, err, ErrResponseIDMismatch)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHandleResponseBody_FlagsMismatchedID(t *testing.T) {
+	var logs bytes.Buffer
+	server := &ExtProcServer{
+		Logger:            slog.New(slog.NewTextHandler(&logs, nil)),
+		VerifyResponseIDs: true,
+	}
+	id := 3
+	req := &MCPRequest{ID: &id, Method: "tools/call", serverName: "test-server"}
+
+	// a mock upstream that answers with the wrong id
+	responses := server.HandleResponseBody(&eppb.HttpBody{Body: []byte(`{"jsonrpc":"2.0","id":4,"result":{}}`)}, req, false)
+	require.Len(t, responses, 1)
+	require.IsType(t, &eppb.ProcessingResponse_ResponseBody{}, responses[0].Response)
+	// the body must be passed through unmodified
+	require.Nil(t, responses[0].GetResponseBody().GetResponse())
+	require.Contains(t, logs.String(), ErrResponseIDMismatch.Error())
+
+	logs.Reset()
+	server.HandleResponseBody(&eppb.HttpBody{Body: []byte(`{"jsonrpc":"2.0","id":3,"result":{}}`)}, req, false)
+	require.Empty(t, logs.String())
+}
+
+func TestHandleResponseHeaders_RoutedRequestInspectsBody(t *testing.T) {
+	cache, err := session.NewCache(context.Background())
+	require.NoError(t, err)
+	requestHeaders := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{}}
+
+	testCases := []struct {
+		Name              string
+		VerifyResponseIDs bool
+		Request           *MCPRequest
+		// ExpectModes is the response body mode for each content type, NONE when the body is not sent to the router
+		ExpectModes map[string]string
+	}{
+		{
+			Name:        "body is not inspected by default",
+			Request:     &MCPRequest{ID: ptr.To(1), Method: "tools/call", serverName: "test-server"},
+			ExpectModes: map[string]string{"application/json": "NONE", "text/event-stream": "NONE"},
+		},
+		{
+			Name:              "body is inspected to verify response ids",
+			VerifyResponseIDs: true,
+			Request:           &MCPRequest{ID: ptr.To(1), Method: "tools/call", serverName: "test-server"},
+			ExpectModes:       map[string]string{"application/json": "BUFFERED", "text/event-stream": "STREAMED"},
+		},
+		{
+			Name:        "body is inspected to cache the result",
+			Request:     &MCPRequest{ID: ptr.To(1), Method: "tools/call", serverName: "test-server", resultCacheKey: "key"},
+			ExpectModes: map[string]string{"application/json": "BUFFERED", "text/event-stream": "STREAMED"},
+		},
+		{
+			Name:        "body is inspected to limit its size",
+			Request:     &MCPRequest{ID: ptr.To(1), Method: "tools/call", serverName: "test-server", maxResponseBytes: 1024},
+			ExpectModes: map[string]string{"application/json": "BUFFERED", "text/event-stream": "STREAMED"},
+		},
+		{
+			Name:              "body of a request to the broker is not inspected",
+			VerifyResponseIDs: true,
+			Request:           &MCPRequest{ID: ptr.To(1), Method: "tools/list"},
+			ExpectModes:       map[string]string{"application/json": "NONE", "text/event-stream": "NONE"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &ExtProcServer{
+				Logger:            slog.New(slog.DiscardHandler),
+				SessionCache:      cache,
+				VerifyResponseIDs: tc.VerifyResponseIDs,
+			}
+			for contentType, expectMode := range tc.ExpectModes {
+				responseHeaders := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":status", RawValue: []byte("200")},
+					{Key: "content-type", RawValue: []byte(contentType)},
+				}}}
+				responses, err := server.HandleResponseHeaders(context.Background(), responseHeaders, requestHeaders, tc.Request)
+				require.NoError(t, err)
+				require.Len(t, responses, 1)
+				// a JSON response that is not inspected keeps the mode of the filter, which is NONE
+				mode := responses[0].GetModeOverride().GetResponseBodyMode().String()
+				require.Equal(t, expectMode, mode, contentType)
+			}
+		})
+	}
+}
+
+func TestHandleResponseHeaders_PropagatesAllowedHeaders(t *testing.T) {
+	cache, err := session.NewCache(context.Background())
+	require.NoError(t, err)
+	upstreamHeaders := []*corev3.HeaderValue{
+		{Key: ":status", RawValue: []byte("200")},
+		{Key: "content-type", RawValue: []byte("text/event-stream")},
+		{Key: "mcp-session-id", RawValue: []byte("upstream-session")},
+		{Key: "cache-control", RawValue: []byte("no-store")},
+		{Key: "x-ratelimit-remaining", RawValue: []byte("10")},
+		{Key: "x-ratelimit-reset", RawValue: []byte("60")},
+		{Key: "x-internal-trace", RawValue: []byte("abc")},
+		{Key: "connection", RawValue: []byte("keep-alive, x-upstream-hop")},
+		{Key: "keep-alive", RawValue: []byte("timeout=5")},
+		{Key: "x-upstream-hop", RawValue: []byte("1")},
+		{Key: "upgrade", RawValue: []byte("h2c")},
+	}
+
+	testCases := []struct {
+		Name         string
+		Allowlist    []string
+		Request      *MCPRequest
+		ExpectRemove []string
+	}{
+		{
+			Name:         "no allowlist only removes hop-by-hop headers",
+			Request:      &MCPRequest{Method: "tools/call", serverName: "test-server"},
+			ExpectRemove: []string{"connection", "keep-alive", "x-upstream-hop", "upgrade"},
+		},
+		{
+			Name:         "allowlist removes every other header",
+			Allowlist:    []string{"Cache-Control", "x-ratelimit-*"},
+			Request:      &MCPRequest{Method: "tools/call", serverName: "test-server"},
+			ExpectRemove: []string{"x-internal-trace", "connection", "keep-alive", "x-upstream-hop", "upgrade"},
+		},
+		{
+			Name:         "hop-by-hop headers cannot be allowed",
+			Allowlist:    []string{"*"},
+			Request:      &MCPRequest{Method: "tools/call", serverName: "test-server"},
+			ExpectRemove: []string{"connection", "keep-alive", "x-upstream-hop", "upgrade"},
+		},
+		{
+			Name:      "broker responses are not filtered",
+			Allowlist: []string{"cache-control"},
+			Request:   &MCPRequest{Method: "tools/list"},
+		},
+		{
+			Name:      "no request",
+			Allowlist: []string{"cache-control"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := &ExtProcServer{
+				Logger:                   slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				SessionCache:             cache,
+				PropagateResponseHeaders: tc.Allowlist,
+			}
+			requestHeaders := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: "mcp-session-id", RawValue: []byte("gateway-session")},
+			}}}
+			responses, err := server.HandleResponseHeaders(context.Background(), &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: upstreamHeaders}}, requestHeaders, tc.Request)
+			require.NoError(t, err)
+			require.Len(t, responses, 1)
+			mutation := responses[0].GetResponseHeaders().GetResponse().GetHeaderMutation()
+			require.ElementsMatch(t, tc.ExpectRemove, mutation.GetRemoveHeaders())
+			// the gateway session replaces the upstream session rather than the header being removed
+			require.Equal(t, "mcp-session-id", mutation.GetSetHeaders()[0].Header.Key)
+			require.Equal(t, "gateway-session", string(mutation.GetSetHeaders()[0].Header.RawValue))
+		})
+	}
+}
+
+func TestSessionHeaderVariantsAreNormalized(t *testing.T) {
+	server := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{MCPGatewayExternalHostname: "mcp.local"},
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+	for _, variant := range []string{"Mcp-Session-Id", "mcp-sessionid", "mcp_session_id"} {
+		t.Run(variant, func(t *testing.T) {
+			headers := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: variant, RawValue: []byte("gateway-session")},
+			}}}
+
+			// requests carry the session id under the spec's header
+			responses, err := server.HandleRequestHeaders(headers)
+			require.NoError(t, err)
+			mutation := responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation()
+			require.Equal(t, []string{variant}, mutation.GetRemoveHeaders())
+			set := map[string]string{}
+			for _, h := range mutation.GetSetHeaders() {
+				set[h.Header.Key] = string(h.Header.RawValue)
+			}
+			require.Equal(t, "gateway-session", set[sessionHeader])
+			require.Equal(t, "gateway-session", (&MCPRequest{Headers: headers.Headers}).GetSessionID())
+
+			// responses only carry the gateway session id under the spec's header
+			responseHeaders := &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":status", RawValue: []byte("200")},
+				{Key: variant, RawValue: []byte("upstream-session")},
+			}}}
+			responses, err = server.HandleResponseHeaders(context.Background(), responseHeaders, headers, nil)
+			require.NoError(t, err)
+			mutation = responses[0].GetResponseHeaders().GetResponse().GetHeaderMutation()
+			require.Equal(t, []string{variant}, mutation.GetRemoveHeaders())
+			require.Len(t, mutation.GetSetHeaders(), 1)
+			require.Equal(t, sessionHeader, mutation.GetSetHeaders()[0].Header.Key)
+			require.Equal(t, "gateway-session", string(mutation.GetSetHeaders()[0].Header.RawValue))
+
+			// a session created without a gateway session, such as an initialize, is returned under the spec's header
+			responses, err = server.HandleResponseHeaders(context.Background(), responseHeaders, &eppb.HttpHeaders{Headers: &corev3.HeaderMap{}}, nil)
+			require.NoError(t, err)
+			mutation = responses[0].GetResponseHeaders().GetResponse().GetHeaderMutation()
+			require.Equal(t, []string{variant}, mutation.GetRemoveHeaders())
+			require.Equal(t, "upstream-session", string(mutation.GetSetHeaders()[0].Header.RawValue))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package mcprouter
+
+import (
+	"slices"
+	"strings"
+
+	basepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// hopByHopHeaders only apply to a single connection so are never forwarded from an upstream to the client.
+// transfer-encoding is left to envoy as it frames the response for the downstream connection itself
+var hopByHopHeaders = map[string]struct{}{
+	"connection":          {},
+	"keep-alive":          {},
+	"proxy-authenticate":  {},
+	"proxy-authorization": {},
+	"proxy-connection":    {},
+	"te":                  {},
+	"trailer":             {},
+	"upgrade":             {},
+}
+
+// protocolResponseHeaders are needed by clients to use the response so are always forwarded. The upstream session id
+// is replaced with the gateway session id rather than removed
+var protocolResponseHeaders = map[string]struct{}{
+	"content-type":         {},
+	"content-length":       {},
+	"content-encoding":     {},
+	sessionHeader:          {},
+	"mcp-protocol-version": {},
+}
+
+// responseHeadersToRemove returns the upstream response headers that must not reach the client. Hop-by-hop headers,
+// including those listed in the connection header, are always removed. When an allowlist is configured every other
+// header that is not on it is removed too. Pseudo headers cannot be changed so are never returned
+func (s *ExtProcServer) responseHeadersToRemove(headers *basepb.HeaderMap) []string {
+	connectionHeaders := map[string]struct{}{}
+	for option := range strings.SplitSeq(getSingleValueHeader(headers, "connection"), ",") {
+		if option = strings.ToLower(strings.TrimSpace(option)); option != "" {
+			connectionHeaders[option] = struct{}{}
+		}
+	}
+
+	var remove []string
+	for _, header := range headers.GetHeaders() {
+		name := strings.ToLower(header.Key)
+		if _, ok := protocolResponseHeaders[name]; ok || strings.HasPrefix(name, ":") || slices.Contains(remove, name) {
+			continue
+		}
+		_, hopByHop := hopByHopHeaders[name]
+		_, connectionOption := connectionHeaders[name]
+		if hopByHop || connectionOption || (len(s.PropagateResponseHeaders) > 0 && !s.propagatesResponseHeader(name)) {
+			remove = append(remove, name)
+		}
+	}
+	return remove
+}
+
+// propagatesResponseHeader is true when the header matches the allowlist. An entry ending in * matches any header
+// starting with the rest of the entry
+func (s *ExtProcServer) propagatesResponseHeader(name string) bool {
+	for _, allowed := range s.PropagateResponseHeaders {
+		allowed = strings.ToLower(allowed)
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(name, prefix) {
+			return true
+		}
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
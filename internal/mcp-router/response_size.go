@@ -0,0 +1,80 @@
+package mcprouter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var responseTooLargeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_response_too_large_total",
+	Help: "Responses from MCP servers replaced with an error because they were larger than the server's maximum response size",
+}, []string{"server", "mode"})
+
+func init() {
+	prometheus.MustRegister(responseTooLargeTotal)
+}
+
+// responseTooLargeByLength rejects a response whose content-length is larger than the maximum response size of its
+// server before its body is read. ok is false when the response is not known to be too large
+func (s *ExtProcServer) responseTooLargeByLength(ctx context.Context, req *MCPRequest, contentLength string) ([]*eppb.ProcessingResponse, bool) {
+	if req == nil || req.maxResponseBytes <= 0 || contentLength == "" {
+		return nil, false
+	}
+	length, err := strconv.ParseInt(contentLength, 10, 64)
+	if err != nil || length <= req.maxResponseBytes {
+		return nil, false
+	}
+	responseTooLargeTotal.WithLabelValues(req.serverName, "buffered").Inc()
+	s.Logger.InfoContext(ctx, "mcp server response is larger than the maximum response size, rejecting response", "server", req.serverName, "method", req.Method, "size", length, "limit", req.maxResponseBytes)
+	return s.responseTooLargeResponse(req), true
+}
+
+// limitResponseSize counts the bytes of the response as they are received and replaces a response that grows larger
+// than the maximum response size of its server. A buffered response is answered with a JSON-RPC error instead. The
+// headers of an event stream have already reached the client, so the chunk that crosses the limit is replaced with an
+// error event and the rest of the stream is dropped. ok is false while the response is within the limit
+func (s *ExtProcServer) limitResponseSize(responseBody *eppb.HttpBody, req *MCPRequest, eventStream bool) ([]*eppb.ProcessingResponse, bool) {
+	if req == nil || req.maxResponseBytes <= 0 {
+		return nil, false
+	}
+	alreadyExceeded := req.responseBytes > req.maxResponseBytes
+	req.responseBytes += int64(len(responseBody.GetBody()))
+	if req.responseBytes <= req.maxResponseBytes {
+		return nil, false
+	}
+	if alreadyExceeded {
+		return NewResponse().WithResponseBodyReplacement([]byte{}).Build(), true
+	}
+	mode := "buffered"
+	if eventStream {
+		mode = "streamed"
+	}
+	responseTooLargeTotal.WithLabelValues(req.serverName, mode).Inc()
+	s.Logger.Info("mcp server response is larger than the maximum response size, replacing response", "server", req.serverName, "method", req.Method, "mode", mode, "limit", req.maxResponseBytes)
+	if !eventStream {
+		return s.responseTooLargeResponse(req), true
+	}
+	body, err := upstreamErrorBody(req, s.responseTooLargeMessage(req), upstreamErrorData{Kind: upstream.ErrorKindResponseTooLarge})
+	if err != nil {
+		s.Logger.Error("failed to marshal response too large error", "error", err)
+		return NewResponse().WithResponseBodyReplacement([]byte{}).Build(), true
+	}
+	// the blank lines end any event left incomplete by the chunks already sent so the error is parsed as its own event
+	event := fmt.Appendf(nil, "\n\nevent: message\ndata: %s\n\n", body)
+	return NewResponse().WithResponseBodyReplacement(event).Build(), true
+}
+
+// responseTooLargeResponse is the JSON-RPC error answering a request whose response was too large
+func (s *ExtProcServer) responseTooLargeResponse(req *MCPRequest) []*eppb.ProcessingResponse {
+	kind := upstream.ErrorKindResponseTooLarge
+	return s.upstreamErrorResponse(req, int32(kind.HTTPStatus()), kind, s.responseTooLargeMessage(req))
+}
+
+func (s *ExtProcServer) responseTooLargeMessage(req *MCPRequest) string {
+	return fmt.Sprintf("response from mcp server %s is larger than its maximum response size of %d bytes", req.serverName, req.maxResponseBytes)
+}
@@ -0,0 +1,155 @@
+package mcprouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// toolCall routes a tool call to a server with the maximum response size
+	toolCall := func(t *testing.T, maxResponseBytes int64) (*ExtProcServer, *MCPRequest) {
+		t.Helper()
+		cache, err := session.NewCache(ctx)
+		require.NoError(t, err)
+		jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+		require.NoError(t, err)
+		gatewaySession := jwtManager.Generate(ctx)
+		_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/server1", "upstream-session")
+		require.NoError(t, err)
+		router := &ExtProcServer{
+			RoutingConfig: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local", MaxResponseBytes: maxResponseBytes}},
+			},
+			JWTManager:   jwtManager,
+			Logger:       logger,
+			SessionCache: cache,
+		}
+		req := &MCPRequest{
+			ID:      ptr.To(5),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": "s1_tool"},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		}
+		resp := router.RouteMCPRequest(ctx, req)
+		require.Len(t, resp, 1)
+		require.Nil(t, resp[0].GetImmediateResponse())
+		return router, req
+	}
+
+	responseHeaders := func(router *ExtProcServer, req *MCPRequest, contentType, contentLength string) []*eppb.ProcessingResponse {
+		headers := []*corev3.HeaderValue{{Key: ":status", RawValue: []byte("200")}, {Key: "content-type", RawValue: []byte(contentType)}}
+		if contentLength != "" {
+			headers = append(headers, &corev3.HeaderValue{Key: "content-length", RawValue: []byte(contentLength)})
+		}
+		responses, err := router.HandleResponseHeaders(ctx, &eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}}, &eppb.HttpHeaders{Headers: req.Headers}, req)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+		return responses
+	}
+
+	requireTooLargeError := func(t *testing.T, body []byte) {
+		t.Helper()
+		var rpc struct {
+			ID    int `json:"id"`
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Data    struct {
+					Kind string `json:"kind"`
+				} `json:"data"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(body, &rpc))
+		require.Equal(t, 5, rpc.ID)
+		require.Equal(t, -32007, rpc.Error.Code)
+		require.Equal(t, "response-too-large", rpc.Error.Data.Kind)
+		require.Contains(t, rpc.Error.Message, "100 bytes")
+	}
+
+	result := []byte(`{"jsonrpc":"2.0","id":5,"result":{"content":[{"type":"text","text":"ok"}]}}`)
+	largeResult := []byte(`{"jsonrpc":"2.0","id":5,"result":{"content":[{"type":"text","text":"` + strings.Repeat("a", 200) + `"}]}}`)
+
+	t.Run("response under the limit is passed through", func(t *testing.T) {
+		router, req := toolCall(t, 100)
+		responses := responseHeaders(router, req, "application/json", "75")
+		require.Nil(t, responses[0].GetImmediateResponse())
+		responses = router.HandleResponseBody(&eppb.HttpBody{Body: result, EndOfStream: true}, req, false)
+		require.Len(t, responses, 1)
+		require.Nil(t, responses[0].GetResponseBody().GetResponse())
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		router, req := toolCall(t, 0)
+		responses := responseHeaders(router, req, "application/json", "1000000")
+		require.Nil(t, responses[0].GetImmediateResponse())
+		responses = router.HandleResponseBody(&eppb.HttpBody{Body: largeResult, EndOfStream: true}, req, false)
+		require.Len(t, responses, 1)
+		require.Nil(t, responses[0].GetResponseBody().GetResponse())
+	})
+
+	t.Run("response with a content-length over the limit is rejected", func(t *testing.T) {
+		router, req := toolCall(t, 100)
+		responses := responseHeaders(router, req, "application/json", "1000000")
+		immediate := responses[0].GetImmediateResponse()
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 502, immediate.Status.Code)
+		requireTooLargeError(t, immediate.Body)
+	})
+
+	t.Run("buffered response over the limit is rejected", func(t *testing.T) {
+		router, req := toolCall(t, 100)
+		responses := responseHeaders(router, req, "application/json", "")
+		require.Nil(t, responses[0].GetImmediateResponse())
+		responses = router.HandleResponseBody(&eppb.HttpBody{Body: largeResult, EndOfStream: true}, req, false)
+		require.Len(t, responses, 1)
+		immediate := responses[0].GetImmediateResponse()
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 502, immediate.Status.Code)
+		requireTooLargeError(t, immediate.Body)
+	})
+
+	t.Run("event stream is counted as it flows and ended with an error", func(t *testing.T) {
+		router, req := toolCall(t, 100)
+		responses := responseHeaders(router, req, "text/event-stream", "")
+		require.Equal(t, "STREAMED", responses[0].ModeOverride.ResponseBodyMode.String())
+
+		chunkBody := func(chunk string) *eppb.BodyMutation {
+			responses := router.HandleResponseBody(&eppb.HttpBody{Body: []byte(chunk)}, req, true)
+			require.Len(t, responses, 1)
+			return responses[0].GetResponseBody().GetResponse().GetBodyMutation()
+		}
+		// chunks under the limit in total are passed through
+		require.Nil(t, chunkBody("event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n"))
+		// the chunk crossing the limit is replaced with an error event
+		mutation := chunkBody("event: message\ndata: " + string(largeResult))
+		require.NotNil(t, mutation)
+		var data []byte
+		for line := range bytes.Lines(mutation.GetBody()) {
+			if event, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+				data = event
+			}
+		}
+		requireTooLargeError(t, data)
+		require.True(t, bytes.HasSuffix(mutation.GetBody(), []byte("\n\n")))
+		// the rest of the stream is dropped
+		mutation = chunkBody("\n\n")
+		require.NotNil(t, mutation)
+		require.Empty(t, mutation.GetBody())
+	})
+}
@@ -6,25 +6,44 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
 
 	extProcV3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/kagenti/mcp-gateway/internal/broker"
 	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/logging"
 	"github.com/kagenti/mcp-gateway/internal/session"
 	"github.com/mark3labs/mcp-go/client"
+	"golang.org/x/sync/singleflight"
 )
 
 var _ config.Observer = &ExtProcServer{}
 
+// DefaultUnknownToolStatus is the HTTP status of the JSON-RPC error returned for a tools/call to an unknown tool
+const DefaultUnknownToolStatus = http.StatusOK
+
+// DefaultDiscoveryWaitTimeout is how long a tool call waits for the broker to finish discovering its server's tools
+const DefaultDiscoveryWaitTimeout = 5 * time.Second
+
 // SessionCache defines how the router interacts with a store to store and retrieves sessions
 type SessionCache interface {
 	GetSession(ctx context.Context, key string) (map[string]string, error)
 	AddSession(ctx context.Context, key, mcpID, mcpSession string) (bool, error)
 	DeleteSessions(ctx context.Context, key ...string) error
 	RemoveServerSession(ctx context.Context, key, mcpServerID string) error
+	RemoveServerSessions(ctx context.Context, mcpServerID string) error
 	KeyExists(ctx context.Context, key string) (bool, error)
 }
 
+// SessionIdentityStore holds the verified identities the broker stored for each gateway session when its client
+// initialized, such as its subject and tenant
+type SessionIdentityStore interface {
+	// SessionIdentity returns the identities stored for the gateway session keyed by kind
+	SessionIdentity(ctx context.Context, id string) (map[string]string, error)
+}
+
 // InitForClient defines a function for initializing an MCP server for a client
 type InitForClient func(ctx context.Context, gatewayHost, routerKey string, conf *config.MCPServer, passThroughHeaders map[string]string) (*client.Client, error)
 
@@ -37,6 +56,84 @@ type ExtProcServer struct {
 	SessionCache  SessionCache
 	//TODO this should not be needed
 	Broker broker.MCPBroker
+	// DebugUpstreamSession when set allows the x-mcp-debug-upstream-session header to override the upstream session
+	// used for a tool call. This is intended for reproducing issues and must not be enabled in production
+	DebugUpstreamSession bool
+	// FaultInjector when set fails a percentage of tool calls instead of routing them. Only available in test builds
+	FaultInjector *FaultInjector
+	// WarmUpstreamSessions are the names of the servers an upstream session is created for as soon as a client
+	// initializes rather than on the first tool call. WarmAllUpstreamSessions warms every server
+	WarmUpstreamSessions []string
+	// PropagateResponseHeaders when set are the only upstream response headers, besides those MCP needs, forwarded to
+	// clients for requests routed to an MCP server. Hop-by-hop headers are never forwarded
+	PropagateResponseHeaders []string
+	// VerifyResponseIDs has the body of every response from an MCP server sent to the router to log responses whose
+	// JSON-RPC id does not match the request. Otherwise response bodies are only sent to the router when a feature
+	// such as the result cache or a maximum response size needs them
+	VerifyResponseIDs bool
+	// RequestLogSampleRate logs one in every RequestLogSampleRate routed tool calls at info. The rest are logged at
+	// debug. 0 logs them all at debug
+	RequestLogSampleRate uint64
+	// MaxConcurrentToolCalls caps the tool calls in flight to each server without its own limit. 0 is no limit
+	MaxConcurrentToolCalls int
+	// ToolCallQueueTimeout is how long a tool call over its server's concurrency limit waits before being rejected
+	ToolCallQueueTimeout time.Duration
+	// ToolCallTimeout is the upstream timeout of tool calls to tools without their own timeout. It also caps the
+	// deadline a client sets in the x-mcp-timeout-ms header. 0 uses the timeout of the gateway's route
+	ToolCallTimeout time.Duration
+	// SessionReinitBackoff is the first delay before a new upstream session is created with a server that keeps
+	// losing them. The delay doubles with each further loss. 0 disables the backoff
+	SessionReinitBackoff time.Duration
+	// DiscoveryWaitTimeout is how long a tool call to a server whose tools the broker is still discovering, for
+	// example while the gateway starts, waits for discovery before being rejected with a retryable 503.
+	// 0 uses DefaultDiscoveryWaitTimeout
+	DiscoveryWaitTimeout time.Duration
+	// UnknownToolStatus is the HTTP status of the JSON-RPC error returned for a tools/call to a tool no server
+	// provides. 0 uses DefaultUnknownToolStatus
+	UnknownToolStatus int
+	// ToolResultCacheTTL is how long results of tools annotated as read-only and idempotent are answered from a
+	// cache rather than their server. 0 disables the cache
+	ToolResultCacheTTL time.Duration
+	// ForwardCancellations sends notifications/cancelled for a tool call in flight to the server handling it rather
+	// than the broker
+	ForwardCancellations bool
+	// UpstreamRateLimitBackpressure when set answers requests to a server that rate limited a request with a retryable
+	// error until the retry-after the server sent has passed, rather than sending them on
+	UpstreamRateLimitBackpressure bool
+	// ToolCallQuota is the number of tool calls each subject or tenant may make in each ToolCallQuotaWindow. Calls are
+	// counted in QuotaStore against the identity SessionIdentities holds for their session. 0 disables the quota
+	ToolCallQuota int64
+	// ToolCallQuotaWindow is the window tool call quotas are counted over. 0 uses DefaultToolCallQuotaWindow
+	ToolCallQuotaWindow time.Duration
+	// ToolCallQuotaHeader is the request header the gateway's authentication sets to the subject of the client. The
+	// router removes it from client requests. Empty uses DefaultToolCallQuotaHeader
+	ToolCallQuotaHeader string
+	// ToolCallQuotaPer is the identity each quota belongs to, ToolCallQuotaPerSubject or ToolCallQuotaPerTenant.
+	// Empty uses ToolCallQuotaPerSubject
+	ToolCallQuotaPer string
+	// QuotaStore counts the tool calls of each subject or tenant against ToolCallQuota
+	QuotaStore QuotaStore
+	// SessionIdentities holds the verified identities tool calls are counted against and tool results are cached for
+	SessionIdentities SessionIdentityStore
+
+	// sessionInits ensures a single upstream session is created when a tool call races a warming session
+	sessionInits singleflight.Group
+	// upstreamSessions tracks the upstream sessions held for each server to apply their session limits
+	upstreamSessions upstreamSessions
+	// gatewaySessions hold the releases of the upstream sessions used by each gateway session
+	gatewaySessions gatewaySessionReleases
+	// toolCalls limits the tool calls in flight to each server
+	toolCalls toolCallLimiter
+	// sessionBackoff delays new upstream sessions with servers that keep losing them
+	sessionBackoff sessionBackoff
+	// toolResults caches the results of calls to read-only, idempotent tools
+	toolResults toolResultCache
+	// toolCallFlights coalesces concurrent identical calls to read-only, idempotent tools
+	toolCallFlights toolCallFlights
+	// rateLimits holds back requests to servers that rate limited a request
+	rateLimits upstreamRateLimits
+	// requestLogs counts the routed tool calls to sample their logs
+	requestLogs atomic.Uint64
 }
 
 // OnConfigChange is used to register the router for config changes
@@ -48,10 +145,13 @@ func (s *ExtProcServer) OnConfigChange(_ context.Context, newConfig *config.MCPS
 func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer) error {
 	var (
 		localRequestHeaders *extProcV3.HttpHeaders
-		requestID           string
+		ctx                 = stream.Context()
 		streaming           = false
+		eventStreamResponse = false
 		mcpRequest          *MCPRequest
 	)
+	// the stream ends once the response has been sent to the client so the tool call is no longer in flight
+	defer func() { mcpRequest.endToolCall() }()
 	for {
 		req, err := stream.Recv()
 
@@ -68,10 +168,11 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 			}
 			localRequestHeaders = r.RequestHeaders
 			responses, _ := s.HandleRequestHeaders(r.RequestHeaders)
-			requestID = getSingleValueHeader(localRequestHeaders.Headers, "x-request-id")
+			// the rest of the request is logged with its request id to correlate the logs of the broker, router and upstreams
+			ctx = logging.ContextWithRequestID(stream.Context(), getSingleValueHeader(localRequestHeaders.Headers, logging.RequestIDHeader))
 			path := getSingleValueHeader(localRequestHeaders.Headers, ":path")
 			method := getSingleValueHeader(localRequestHeaders.Headers, ":method")
-			s.Logger.Debug("[ext_proc ] Process: ProcessingRequest_RequestHeaders", "request id:", requestID, "path", path, "method", method)
+			s.Logger.DebugContext(ctx, "[ext_proc ] Process: ProcessingRequest_RequestHeaders", "path", path, "method", method)
 			for _, response := range responses {
 				s.Logger.Debug(fmt.Sprintf("Sending header processing instructions to Envoy: %+v", response))
 				if err := stream.Send(response); err != nil {
@@ -93,7 +194,7 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 					}
 				}
 			}
-			s.Logger.Debug("[ext_proc ] Process: ProcessingRequest_RequestBody", "request id:", requestID)
+			s.Logger.DebugContext(ctx, "[ext_proc ] Process: ProcessingRequest_RequestBody")
 			if len(r.RequestBody.Body) > 0 {
 				if err := json.Unmarshal(r.RequestBody.Body, &mcpRequest); err != nil {
 					s.Logger.Error(fmt.Sprintf("Error unmarshalling request body: %v", err))
@@ -105,7 +206,7 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 					}
 				}
 				if _, err := mcpRequest.Validate(); err != nil {
-					s.Logger.Error("Invalid MCPRequest", "error", err)
+					s.Logger.ErrorContext(ctx, "Invalid MCPRequest", "error", err)
 					resp := responseBuilder.WithImmediateResponse(400, "invalid mcp request").Build()
 					for _, res := range resp {
 						if err := stream.Send(res); err != nil {
@@ -119,7 +220,7 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 			// GET /mcp would come through here
 			mcpRequest.Headers = localRequestHeaders.Headers
 			mcpRequest.Streaming = streaming
-			responses = s.RouteMCPRequest(stream.Context(), mcpRequest)
+			responses = s.RouteMCPRequest(ctx, mcpRequest)
 			for _, response := range responses {
 				s.Logger.Debug(fmt.Sprintf("Sending MCP body routing instructions to Envoy: %+v", response))
 				if err := stream.Send(response); err != nil {
@@ -133,8 +234,9 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 			if r.ResponseHeaders == nil || localRequestHeaders == nil {
 				return fmt.Errorf("no response headers or request headers")
 			}
-			s.Logger.Debug("[ext_proc ] Process: ProcessingRequest_ResponseHeaders", "request id:", requestID)
-			responses, _ := s.HandleResponseHeaders(stream.Context(), r.ResponseHeaders, localRequestHeaders, mcpRequest)
+			s.Logger.DebugContext(ctx, "[ext_proc ] Process: ProcessingRequest_ResponseHeaders")
+			eventStreamResponse = isEventStream(getSingleValueHeader(r.ResponseHeaders.Headers, "content-type"))
+			responses, _ := s.HandleResponseHeaders(ctx, r.ResponseHeaders, localRequestHeaders, mcpRequest)
 			for _, response := range responses {
 				s.Logger.Debug(fmt.Sprintf("Sending response header processing instructions to Envoy: %+v", response))
 				if err := stream.Send(response); err != nil {
@@ -144,22 +246,14 @@ func (s *ExtProcServer) Process(stream extProcV3.ExternalProcessor_ProcessServer
 			}
 			continue
 		case *extProcV3.ProcessingRequest_ResponseBody:
-			// This should never be called as response_body_mode is set to NONE in the EnvoyFilter.
-			// If this is called, it indicates a configuration issue or Envoy bug.
-			s.Logger.Error("[EXT-PROC] Unexpected response body processing request received",
-				"size", len(r.ResponseBody.GetBody()),
-				"end_of_stream", r.ResponseBody.GetEndOfStream(),
-				"note", "response_body_mode is set to NONE in EnvoyFilter - this should not occur",
-				"request-id", requestID)
-			// Return empty response to satisfy the interface
-			response := &extProcV3.ProcessingResponse{
-				Response: &extProcV3.ProcessingResponse_ResponseBody{
-					ResponseBody: &extProcV3.BodyResponse{},
-				},
-			}
-			if err := stream.Send(response); err != nil {
-				s.Logger.Error(fmt.Sprintf("Error sending response: %v", err))
-				return err
+			// only sent when HandleResponseHeaders overrides the response body mode to check the response id
+			s.Logger.DebugContext(ctx, "[ext_proc ] Process: ProcessingRequest_ResponseBody",
+				"size", len(r.ResponseBody.GetBody()), "end_of_stream", r.ResponseBody.GetEndOfStream())
+			for _, response := range s.HandleResponseBody(r.ResponseBody, mcpRequest, eventStreamResponse) {
+				if err := stream.Send(response); err != nil {
+					s.Logger.Error(fmt.Sprintf("Error sending response: %v", err))
+					return err
+				}
 			}
 			continue
 		}
@@ -0,0 +1,90 @@
+package mcprouter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultSessionReinitBackoff is the first delay before a server that keeps losing upstream sessions is sent
+	// another initialize
+	DefaultSessionReinitBackoff = time.Second
+	// maxSessionReinitBackoff caps the delay. A server that loses no sessions for this long after its last delay
+	// starts again without one
+	maxSessionReinitBackoff = 30 * time.Second
+)
+
+var sessionReinitBackoffTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_session_reinit_backoff_total",
+	Help: "Tool calls rejected because their MCP server kept losing upstream sessions and new sessions were backed off",
+}, []string{"server"})
+
+func init() {
+	prometheus.MustRegister(sessionReinitBackoffTotal)
+}
+
+// serverBackoff is the session loss history of a single server
+type serverBackoff struct {
+	// losses is the number of losses in a row, each of a session created after the one before
+	losses   int
+	lastLoss time.Time
+	until    time.Time
+}
+
+// sessionBackoff delays new upstream sessions with servers that keep losing them, for example a flapping server that
+// answers with a 404 soon after each initialize, so they are not sent a storm of initialize requests. The first loss
+// is not delayed so a server restarting once is not affected. Losses of sessions created before the previous loss are
+// part of the same event, such as every session being lost in a restart, and are not counted again.
+// The zero value is ready to use
+type sessionBackoff struct {
+	lock    sync.Mutex
+	servers map[string]*serverBackoff
+}
+
+// sessionLost records the loss of an upstream session to the server created at created. base is the delay after the
+// second loss in a row, doubling with each further loss. A base of 0 or less disables the backoff
+func (b *sessionBackoff) sessionLost(serverName string, created time.Time, base time.Duration) {
+	if base <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.servers == nil {
+		b.servers = map[string]*serverBackoff{}
+	}
+	server, ok := b.servers[serverName]
+	if !ok {
+		server = &serverBackoff{}
+		b.servers[serverName] = server
+	}
+	now := time.Now()
+	if server.losses > 0 && now.Sub(server.until) > maxSessionReinitBackoff {
+		server.losses = 0
+	}
+	if server.losses > 0 && !created.After(server.lastLoss) {
+		return
+	}
+	server.losses++
+	server.lastLoss = now
+	server.until = now
+	if server.losses > 1 {
+		delay := maxSessionReinitBackoff
+		if shift := server.losses - 2; shift < 16 {
+			delay = min(base<<shift, maxSessionReinitBackoff)
+		}
+		server.until = now.Add(delay)
+	}
+}
+
+// remaining returns how long new upstream sessions with the server are delayed for. 0 allows a new session
+func (b *sessionBackoff) remaining(serverName string) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	server, ok := b.servers[serverName]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(server.until), 0)
+}
@@ -0,0 +1,149 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestSessionBackoff(t *testing.T) {
+	t.Run("first loss is not delayed", func(t *testing.T) {
+		var backoff sessionBackoff
+		backoff.sessionLost("mcp-test/a", time.Now(), time.Minute)
+		require.Zero(t, backoff.remaining("mcp-test/a"))
+	})
+
+	t.Run("repeated losses double the delay", func(t *testing.T) {
+		var backoff sessionBackoff
+		for _, expected := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second} {
+			backoff.sessionLost("mcp-test/a", time.Now(), time.Second)
+			require.InDelta(t, expected, backoff.remaining("mcp-test/a"), float64(100*time.Millisecond))
+		}
+		// other servers are not delayed
+		require.Zero(t, backoff.remaining("mcp-test/b"))
+	})
+
+	t.Run("the delay is capped", func(t *testing.T) {
+		var backoff sessionBackoff
+		for range 40 {
+			backoff.sessionLost("mcp-test/a", time.Now(), time.Second)
+		}
+		require.InDelta(t, maxSessionReinitBackoff, backoff.remaining("mcp-test/a"), float64(100*time.Millisecond))
+	})
+
+	t.Run("sessions created before the last loss are the same event", func(t *testing.T) {
+		var backoff sessionBackoff
+		created := time.Now()
+		for range 10 {
+			backoff.sessionLost("mcp-test/a", created, time.Minute)
+		}
+		require.Zero(t, backoff.remaining("mcp-test/a"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var backoff sessionBackoff
+		for range 3 {
+			backoff.sessionLost("mcp-test/a", time.Now(), 0)
+		}
+		require.Zero(t, backoff.remaining("mcp-test/a"))
+	})
+}
+
+func TestHandleToolCallSessionReinitBackoff(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	initialized := 0
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{
+				{Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true},
+			},
+		},
+		JWTManager:           jwtManager,
+		Logger:               logger,
+		SessionCache:         cache,
+		SessionReinitBackoff: 200 * time.Millisecond,
+		InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+			initialized++
+			c, err := client.NewStreamableHttpClient(conf.URL)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Start(ctx); err != nil {
+				return nil, err
+			}
+			_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+			return c, err
+		},
+	}
+	gatewaySession := jwtManager.Generate(ctx)
+	headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}}
+	toolCall := func() (*MCPRequest, *eppb.ProcessingResponse) {
+		req := &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": "a_tool"},
+			Headers: headers,
+		}
+		resp := router.RouteMCPRequest(ctx, req)
+		require.Len(t, resp, 1)
+		return req, resp[0]
+	}
+	// the upstream answers the tool call with a 404 as it no longer knows the session
+	sessionLost := func(req *MCPRequest) {
+		_, err := router.HandleResponseHeaders(ctx,
+			&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: ":status", RawValue: []byte("404")}}}},
+			&eppb.HttpHeaders{Headers: headers}, req)
+		require.NoError(t, err)
+	}
+
+	req, resp := toolCall()
+	require.Nil(t, resp.GetImmediateResponse())
+	sessionLost(req)
+
+	// the first loss is re-initialized straight away
+	req, resp = toolCall()
+	require.Nil(t, resp.GetImmediateResponse())
+	require.Equal(t, 2, initialized)
+	sessionLost(req)
+
+	// the session was lost again so new sessions are backed off
+	for range 5 {
+		_, resp = toolCall()
+		immediate := resp.GetImmediateResponse()
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 503, immediate.Status.Code)
+		require.Contains(t, string(immediate.Body), "mcp-test/a keeps losing sessions")
+		require.Len(t, immediate.Headers.GetSetHeaders(), 1)
+		require.Equal(t, "retry-after", immediate.Headers.GetSetHeaders()[0].Header.Key)
+		require.Equal(t, "1", string(immediate.Headers.GetSetHeaders()[0].Header.RawValue))
+	}
+	require.Equal(t, 2, initialized)
+
+	require.Eventually(t, func() bool {
+		_, resp = toolCall()
+		return resp.GetImmediateResponse() == nil
+	}, 2*time.Second, 20*time.Millisecond)
+	require.Equal(t, 3, initialized)
+}
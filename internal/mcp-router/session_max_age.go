@@ -0,0 +1,85 @@
+package mcprouter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var upstreamSessionRefreshTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_upstream_session_refresh_total",
+	Help: "Upstream sessions replaced with a new session as they reached the upstreamSessionMaxAge of their MCP server",
+}, []string{"server"})
+
+func init() {
+	prometheus.MustRegister(upstreamSessionRefreshTotal)
+}
+
+// upstreamSessionsCreatedKey is the session cache key holding when each upstream session of a gateway session was
+// created, keyed by server. It is kept apart from the upstream session ids so every router replica knows their age
+func upstreamSessionsCreatedKey(gatewaySession string) string {
+	return "upstream-session-created:" + gatewaySession
+}
+
+// addUpstreamSession stores the upstream session used by the gateway session for the server and when it was created
+func (s *ExtProcServer) addUpstreamSession(ctx context.Context, gatewaySession, serverName, upstreamSession string, created time.Time) error {
+	if _, err := s.SessionCache.AddSession(ctx, gatewaySession, serverName, upstreamSession); err != nil {
+		return err
+	}
+	_, err := s.SessionCache.AddSession(ctx, upstreamSessionsCreatedKey(gatewaySession), serverName, strconv.FormatInt(created.UnixNano(), 10))
+	return err
+}
+
+// removeUpstreamSession forgets the upstream session used by the gateway session for the server
+func (s *ExtProcServer) removeUpstreamSession(ctx context.Context, gatewaySession, serverName string) error {
+	if err := s.SessionCache.RemoveServerSession(ctx, gatewaySession, serverName); err != nil {
+		return err
+	}
+	return s.SessionCache.RemoveServerSession(ctx, upstreamSessionsCreatedKey(gatewaySession), serverName)
+}
+
+// upstreamSessionExpired reports whether the upstream session of the gateway session with the server has reached
+// maxAge. Sessions stored without a creation time, such as those stored by an older router, never expire
+func (s *ExtProcServer) upstreamSessionExpired(ctx context.Context, gatewaySession, serverName string, maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	created, err := s.SessionCache.GetSession(ctx, upstreamSessionsCreatedKey(gatewaySession))
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to get upstream session creation time from cache", "error", err)
+		return false
+	}
+	nanos, err := strconv.ParseInt(created[serverName], 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.Unix(0, nanos)) >= maxAge
+}
+
+// refreshMCPServerSession replaces an upstream session that reached its server's max age with a new one. The old
+// session is closed so it no longer counts against the server's session limit. A concurrent request that already
+// replaced it gets the new session
+func (s *ExtProcServer) refreshMCPServerSession(ctx context.Context, mcpReq *MCPRequest, expired string) (string, error) {
+	id, err, _ := s.sessionInits.Do(mcpReq.GetSessionID()+"/"+mcpReq.serverName, func() (any, error) {
+		sessions, err := s.SessionCache.GetSession(ctx, mcpReq.GetSessionID())
+		if err != nil {
+			return "", NewRouterErrorf(500, "failed to check for existing session: %w", err)
+		}
+		if current := sessions[mcpReq.serverName]; current != "" && current != expired {
+			return current, nil
+		}
+		s.Logger.InfoContext(ctx, "upstream session reached its max age, initializing a new session", "server", mcpReq.serverName, "session id", mcpReq.GetSessionID(), "remote session", expired)
+		upstreamSessionRefreshTotal.WithLabelValues(mcpReq.serverName).Inc()
+		s.upstreamSessions.invalidate(mcpReq.serverName, expired)
+		if err := s.removeUpstreamSession(ctx, mcpReq.GetSessionID(), mcpReq.serverName); err != nil {
+			return "", NewRouterErrorf(500, "failed to remove expired session: %w", err)
+		}
+		return s.createMCPServerSession(ctx, mcpReq)
+	})
+	if err != nil {
+		return "", err
+	}
+	return id.(string), nil
+}
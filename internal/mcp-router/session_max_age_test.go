@@ -0,0 +1,137 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestHandleToolCallUpstreamSessionMaxAge(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	const maxAge = 200 * time.Millisecond
+	testCases := []struct {
+		Name          string
+		Cordoned      bool
+		ExpectRefresh bool
+	}{
+		{Name: "sessions older than the max age are refreshed", ExpectRefresh: true},
+		{Name: "cordoned servers keep their sessions", Cordoned: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			logger := slog.New(slog.DiscardHandler)
+			cache, err := session.NewCache(ctx)
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			serverConfig := &config.MCPServer{
+				Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true,
+				UpstreamSessionMaxAge: maxAge,
+			}
+			initialized := 0
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{Servers: []*config.MCPServer{serverConfig}},
+				JWTManager:    jwtManager,
+				Logger:        logger,
+				SessionCache:  cache,
+				InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					initialized++
+					c, err := client.NewStreamableHttpClient(conf.URL)
+					if err != nil {
+						return nil, err
+					}
+					if err := c.Start(ctx); err != nil {
+						return nil, err
+					}
+					_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+					return c, err
+				},
+			}
+			gatewaySession := jwtManager.Generate(ctx)
+			toolCall := func() string {
+				resp := router.RouteMCPRequest(ctx, &MCPRequest{
+					ID:      ptr.To(1),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": "a_tool"},
+					Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+				})
+				require.Len(t, resp, 1)
+				return upstreamSessionOf(resp[0])
+			}
+
+			first := toolCall()
+			require.NotEmpty(t, first)
+			// a session younger than the max age is used again
+			require.Equal(t, first, toolCall())
+			require.Equal(t, 1, initialized)
+
+			serverConfig.Cordoned = tc.Cordoned
+			time.Sleep(maxAge)
+			refreshed := toolCall()
+			require.NotEmpty(t, refreshed)
+			if !tc.ExpectRefresh {
+				require.Equal(t, first, refreshed)
+				require.Equal(t, 1, initialized)
+				return
+			}
+			require.NotEqual(t, first, refreshed)
+			require.Equal(t, 2, initialized)
+			// the expired session is closed rather than held alongside the new one
+			require.Equal(t, 1, router.upstreamSessions.count("mcp-test/a"))
+			sessions, err := cache.GetSession(ctx, gatewaySession)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"mcp-test/a": refreshed}, sessions)
+			// the new session gets the full max age
+			require.Equal(t, refreshed, toolCall())
+
+			router.CloseGatewaySession(ctx, gatewaySession)
+			created, err := cache.GetSession(ctx, upstreamSessionsCreatedKey(gatewaySession))
+			require.NoError(t, err)
+			require.Empty(t, created)
+		})
+	}
+}
+
+func TestUpstreamSessionExpiredWithoutCreationTime(t *testing.T) {
+	ctx := context.Background()
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	router := &ExtProcServer{Logger: slog.New(slog.DiscardHandler), SessionCache: cache}
+
+	// sessions stored by a router without max age support have no creation time
+	_, err = cache.AddSession(ctx, "gateway-session", "mcp-test/a", "upstream-session")
+	require.NoError(t, err)
+	require.False(t, router.upstreamSessionExpired(ctx, "gateway-session", "mcp-test/a", time.Nanosecond))
+
+	require.NoError(t, router.addUpstreamSession(ctx, "gateway-session", "mcp-test/a", "upstream-session", time.Now().Add(-time.Minute)))
+	require.True(t, router.upstreamSessionExpired(ctx, "gateway-session", "mcp-test/a", time.Second))
+	require.False(t, router.upstreamSessionExpired(ctx, "gateway-session", "mcp-test/a", time.Hour))
+	require.False(t, router.upstreamSessionExpired(ctx, "gateway-session", "mcp-test/a", 0))
+}
+
+// upstreamSessionOf returns the upstream session a routed request is sent with
+func upstreamSessionOf(resp *eppb.ProcessingResponse) string {
+	for _, h := range resp.GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		if h.Header.Key == sessionHeader {
+			return string(h.Header.RawValue)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package mcprouter
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+const (
+	// WarmAllUpstreamSessions warms the upstream sessions of every server
+	WarmAllUpstreamSessions = "*"
+
+	// warmSessionTimeout bounds the time spent initializing each upstream session in the background
+	warmSessionTimeout = 30 * time.Second
+)
+
+// warmsUpstreamSession reports whether an upstream session is created for the server as soon as a client initializes
+func (s *ExtProcServer) warmsUpstreamSession(serverName string) bool {
+	return slices.Contains(s.WarmUpstreamSessions, WarmAllUpstreamSessions) || slices.Contains(s.WarmUpstreamSessions, serverName)
+}
+
+// warmUpstreamSessions creates the upstream sessions for a gateway session the broker has just initialized so the
+// first tool call to each server does not wait for the upstream initialize. The sessions are created in the
+// background with the headers of the client's initialize request as they would be for a tool call
+func (s *ExtProcServer) warmUpstreamSessions(ctx context.Context, initReq *MCPRequest, gatewaySession string) {
+	// the initialize response is not held up so the sessions outlive the request
+	ctx = context.WithoutCancel(ctx)
+	for _, server := range s.RoutingConfig.Servers {
+		if server == nil || !server.Enabled || server.Cordoned || !s.warmsUpstreamSession(server.Name) {
+			continue
+		}
+		warmReq := &MCPRequest{
+			JSONRPC:    initReq.JSONRPC,
+			Method:     initReq.Method,
+			Headers:    initReq.Headers,
+			sessionID:  gatewaySession,
+			serverName: server.Name,
+		}
+		go func() {
+			warmCtx, cancel := context.WithTimeout(ctx, warmSessionTimeout)
+			defer cancel()
+			start := time.Now()
+			if _, err := s.initializeMCPSeverSession(warmCtx, warmReq); err != nil {
+				s.Logger.Warn("failed to warm upstream session, it will be created on the first tool call", "server", warmReq.serverName, "session id", gatewaySession, "error", err)
+				return
+			}
+			s.Logger.Debug("warmed upstream session", "server", warmReq.serverName, "session id", gatewaySession, "duration", time.Since(start))
+		}()
+	}
+}
@@ -0,0 +1,227 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestWarmUpstreamSessions(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	testCases := []struct {
+		Name         string
+		Warm         []string
+		InitHeaders  []*corev3.HeaderValue
+		ExpectWarmed []string
+	}{
+		{
+			Name:         "configured servers are warmed",
+			Warm:         []string{"mcp-test/a", "mcp-test/b"},
+			ExpectWarmed: []string{"mcp-test/a", "mcp-test/b"},
+		},
+		{
+			Name:         "all servers are warmed",
+			Warm:         []string{WarmAllUpstreamSessions},
+			ExpectWarmed: []string{"mcp-test/a", "mcp-test/b", "mcp-test/c"},
+		},
+		{
+			Name: "disabled",
+		},
+		{
+			Name:        "initialize hairpinned by the router is not warmed",
+			Warm:        []string{WarmAllUpstreamSessions},
+			InitHeaders: []*corev3.HeaderValue{{Key: "mcp-init-host", RawValue: []byte("a.mcp.local")}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(ctx)
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(ctx)
+
+			var lock sync.Mutex
+			initialized := map[string]int{}
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{
+						{Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true},
+						{Name: "mcp-test/b", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "b_", Hostname: "b.mcp.local", Enabled: true},
+						{Name: "mcp-test/c", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "c_", Hostname: "c.mcp.local", Enabled: true},
+						{Name: "mcp-test/disabled", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "d_", Hostname: "d.mcp.local"},
+						{Name: "mcp-test/cordoned", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "e_", Hostname: "e.mcp.local", Enabled: true, Cordoned: true},
+					},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+				InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					lock.Lock()
+					initialized[conf.Name]++
+					lock.Unlock()
+					c, err := client.NewStreamableHttpClient(conf.URL)
+					if err != nil {
+						return nil, err
+					}
+					if err := c.Start(ctx); err != nil {
+						return nil, err
+					}
+					_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+					return c, err
+				},
+				WarmUpstreamSessions: tc.Warm,
+			}
+
+			initReq := &MCPRequest{
+				ID:      ptr.To(0),
+				JSONRPC: "2.0",
+				Method:  "initialize",
+				Headers: &corev3.HeaderMap{Headers: tc.InitHeaders},
+			}
+			_, err = router.HandleResponseHeaders(ctx,
+				&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":status", RawValue: []byte("200")},
+					{Key: "mcp-session-id", RawValue: []byte(gatewaySession)},
+				}}},
+				&eppb.HttpHeaders{Headers: initReq.Headers},
+				initReq,
+			)
+			require.NoError(t, err)
+
+			require.Eventually(t, func() bool {
+				sessions, err := cache.GetSession(ctx, gatewaySession)
+				return err == nil && len(sessions) == len(tc.ExpectWarmed)
+			}, 5*time.Second, 10*time.Millisecond)
+			sessions, err := cache.GetSession(ctx, gatewaySession)
+			require.NoError(t, err)
+			warmed := []string{}
+			for name, upstreamSession := range sessions {
+				require.NotEmpty(t, upstreamSession)
+				warmed = append(warmed, name)
+			}
+			require.ElementsMatch(t, tc.ExpectWarmed, warmed)
+			if len(tc.ExpectWarmed) == 0 {
+				// give any unexpected warming a chance to show up
+				time.Sleep(50 * time.Millisecond)
+				lock.Lock()
+				require.Empty(t, initialized)
+				lock.Unlock()
+				return
+			}
+
+			// the first tool call uses the warmed session rather than initializing another
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  map[string]any{"name": "a_tool"},
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			var upstreamSession string
+			for _, h := range rb.RequestBody.Response.HeaderMutation.SetHeaders {
+				if h.Header.Key == sessionHeader {
+					upstreamSession = string(h.Header.RawValue)
+				}
+			}
+			require.Equal(t, sessions["mcp-test/a"], upstreamSession)
+			lock.Lock()
+			defer lock.Unlock()
+			for _, name := range tc.ExpectWarmed {
+				require.Equal(t, 1, initialized[name], name)
+			}
+		})
+	}
+}
+
+func TestInitializeMCPServerSessionSharesConcurrentInitialize(t *testing.T) {
+	ctx := context.Background()
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+
+	release := make(chan struct{})
+	var lock sync.Mutex
+	calls := 0
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{{Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true}},
+		},
+		JWTManager:   jwtManager,
+		Logger:       logger,
+		SessionCache: cache,
+		InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+			lock.Lock()
+			calls++
+			lock.Unlock()
+			// hold the initialize open so the other callers arrive while it is in flight
+			<-release
+			c, err := client.NewStreamableHttpClient(conf.URL)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Start(ctx); err != nil {
+				return nil, err
+			}
+			_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+			return c, err
+		},
+	}
+
+	results := make(chan string, 3)
+	for range 3 {
+		go func() {
+			id, err := router.initializeMCPSeverSession(ctx, &MCPRequest{sessionID: gatewaySession, serverName: "mcp-test/a"})
+			if err != nil {
+				id = "error: " + err.Error()
+			}
+			results <- id
+		}()
+	}
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls == 1
+	}, time.Second, 5*time.Millisecond)
+	// let the other callers join the in flight initialize
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	first := <-results
+	require.NotEmpty(t, first)
+	require.NotContains(t, first, "error")
+	require.Equal(t, first, <-results)
+	require.Equal(t, first, <-results)
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,113 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var toolCallsCoalescedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_tool_calls_coalesced_total",
+	Help: "Calls to cacheable tools that waited for an identical call in flight to the same MCP server rather than being routed",
+}, []string{"server"})
+
+func init() {
+	prometheus.MustRegister(toolCallsCoalescedTotal)
+}
+
+// toolCallFlight is a call to a cacheable tool routed to its server that identical calls wait on
+type toolCallFlight struct {
+	// done is closed once the call has completed
+	done chan struct{}
+	// result is the result of the call, nil if it did not return one that can be shared. It is set before done is closed
+	result json.RawMessage
+	// followers is the number of identical calls that joined the flight
+	followers int
+}
+
+// toolCallFlights tracks the calls to cacheable tools in flight keyed by their result cache key so concurrent
+// identical calls are routed once. The zero value is ready to use
+type toolCallFlights struct {
+	lock    sync.Mutex
+	flights map[string]*toolCallFlight
+}
+
+// join returns the flight of the key and true if the caller leads it. The leader routes its call and must land the
+// flight, the others wait for it to be done
+func (f *toolCallFlights) join(key string) (*toolCallFlight, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if flight, ok := f.flights[key]; ok {
+		flight.followers++
+		return flight, false
+	}
+	if f.flights == nil {
+		f.flights = map[string]*toolCallFlight{}
+	}
+	flight := &toolCallFlight{done: make(chan struct{})}
+	f.flights[key] = flight
+	return flight, true
+}
+
+// waiting returns the number of calls waiting on the flight of the key
+func (f *toolCallFlights) waiting(key string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if flight, ok := f.flights[key]; ok {
+		return flight.followers
+	}
+	return 0
+}
+
+// land completes the flight with the result and releases the calls waiting on it. It returns the number of calls
+// released. It may be called more than once, only the first call has any effect
+func (f *toolCallFlights) land(key string, flight *toolCallFlight, result json.RawMessage) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.flights[key] != flight {
+		return 0
+	}
+	delete(f.flights, key)
+	flight.result = result
+	close(flight.done)
+	return flight.followers
+}
+
+// coalescedToolResult answers a call to a cacheable tool whose result was not cached with the result of an identical
+// call already in flight to its server. When there is no such call this call leads a flight the calls that follow
+// wait on. A follower whose leader returns no result that can be shared, such as an error or an event stream, is
+// routed to its server as usual and is not counted as coalesced. Calls only share a flight when they share a result
+// cache key, so only calls by the same subject and tenant are coalesced, and each has been counted against the tool
+// call quota before it joins
+func (s *ExtProcServer) coalescedToolResult(ctx context.Context, mcpReq *MCPRequest, serverInfo *config.MCPServer) ([]byte, bool) {
+	key := mcpReq.resultCacheKey
+	if key == "" {
+		return nil, false
+	}
+	flight, leader := s.toolCallFlights.join(key)
+	if leader {
+		mcpReq.landFlight = func(result json.RawMessage) {
+			if released := s.toolCallFlights.land(key, flight, result); released > 0 {
+				s.Logger.Debug("released tool calls waiting on an identical call", "server", serverInfo.Name, "calls", released, "shared", result != nil)
+			}
+		}
+		return nil, false
+	}
+	select {
+	case <-flight.done:
+	case <-ctx.Done():
+		return nil, false
+	}
+	if flight.result == nil {
+		return nil, false
+	}
+	body, err := toolResultResponse(*mcpReq.ID, flight.result)
+	if err != nil {
+		return nil, false
+	}
+	toolCallsCoalescedTotal.WithLabelValues(serverInfo.Name).Inc()
+	return body, true
+}
@@ -0,0 +1,276 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestToolCallFlights(t *testing.T) {
+	var flights toolCallFlights
+	leaderFlight, leader := flights.join("key")
+	require.True(t, leader)
+	followerFlight, leader := flights.join("key")
+	require.False(t, leader)
+	require.Same(t, leaderFlight, followerFlight)
+	require.Equal(t, 1, flights.waiting("key"))
+	_, leader = flights.join("other")
+	require.True(t, leader, "calls with another key lead their own flight")
+
+	require.Equal(t, 1, flights.land("key", leaderFlight, json.RawMessage(`{"content":[]}`)))
+	require.Zero(t, flights.waiting("key"))
+	<-followerFlight.done
+	require.JSONEq(t, `{"content":[]}`, string(followerFlight.result))
+	// landing again does not change the result or end a later flight with the same key
+	nextFlight, leader := flights.join("key")
+	require.True(t, leader)
+	flights.land("key", leaderFlight, nil)
+	require.JSONEq(t, `{"content":[]}`, string(leaderFlight.result))
+	select {
+	case <-nextFlight.done:
+		t.Fatal("a later flight was landed by an earlier leader")
+	default:
+	}
+}
+
+func TestHandleToolCallCoalescing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.DiscardHandler)
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTools(
+		server.ServerTool{Tool: mcp.NewTool("search", mcp.WithReadOnlyHintAnnotation(true), mcp.WithIdempotentHintAnnotation(true))},
+		server.ServerTool{Tool: mcp.NewTool("time", mcp.WithReadOnlyHintAnnotation(true), mcp.WithIdempotentHintAnnotation(false))},
+	)
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/coalesce",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "c_",
+			Enabled:    true,
+			Hostname:   "coalesce.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[routingConfig.Servers[0].ID()]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	// newSession starts a gateway session with the subject the broker recorded when its client initialized
+	newSession := func(subject string) string {
+		gatewaySession := jwtManager.Generate(ctx)
+		_, err := cache.AddSession(ctx, gatewaySession, "mcp-test/coalesce", "upstream-session")
+		require.NoError(t, err)
+		require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, session.IdentitySubject, subject))
+		return gatewaySession
+	}
+	gatewaySession := newSession("alice")
+
+	const (
+		calls      = 10
+		resultBody = `{"content":[{"type":"text","text":"found"}]}`
+	)
+	coalesced := func() float64 {
+		return testutil.ToFloat64(toolCallsCoalescedTotal.WithLabelValues("mcp-test/coalesce"))
+	}
+	// callConcurrentlyIn sends identical calls to the tool at once, each in the gateway session sessionOf returns for
+	// its id. Calls routed to the upstream are sent on routed and calls answered by the router on answered
+	callConcurrentlyIn := func(router *ExtProcServer, tool string, sessionOf func(id int) string) (chan *MCPRequest, chan *eppb.ImmediateResponse) {
+		routed := make(chan *MCPRequest, calls)
+		answered := make(chan *eppb.ImmediateResponse, calls)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for id := 1; id <= calls; id++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := &MCPRequest{
+					ID:      ptr.To(id),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": tool, "arguments": map[string]any{"query": "mcp"}},
+					Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(sessionOf(id))}}},
+				}
+				<-start
+				resp := router.RouteMCPRequest(ctx, req)
+				if immediate := resp[0].GetImmediateResponse(); immediate != nil {
+					answered <- immediate
+					return
+				}
+				routed <- req
+			}()
+		}
+		close(start)
+		go func() {
+			wg.Wait()
+			close(routed)
+			close(answered)
+		}()
+		return routed, answered
+	}
+	callConcurrently := func(router *ExtProcServer, tool string) (chan *MCPRequest, chan *eppb.ImmediateResponse) {
+		return callConcurrentlyIn(router, tool, func(int) string { return gatewaySession })
+	}
+	// respond answers a routed call from the upstream with the result
+	respond := func(router *ExtProcServer, req *MCPRequest, result string) {
+		body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *req.ID, "result": json.RawMessage(result)})
+		require.NoError(t, err)
+		router.HandleResponseBody(&eppb.HttpBody{Body: body, EndOfStream: true}, req, false)
+		req.endToolCall()
+	}
+	newRouter := func() *ExtProcServer {
+		return &ExtProcServer{
+			RoutingConfig:      routingConfig,
+			JWTManager:         jwtManager,
+			Logger:             logger,
+			SessionCache:       cache,
+			Broker:             mcpBroker,
+			ToolResultCacheTTL: time.Minute,
+			SessionIdentities:  cache,
+		}
+	}
+
+	t.Run("identical calls are routed once", func(t *testing.T) {
+		router := newRouter()
+		before := coalesced()
+		routed, answered := callConcurrently(router, "c_search")
+		leader := <-routed
+		require.Eventually(t, func() bool { return router.toolCallFlights.waiting(leader.resultCacheKey) == calls-1 }, 5*time.Second, 10*time.Millisecond)
+		respond(router, leader, resultBody)
+
+		ids := map[int]bool{*leader.ID: true}
+		for immediate := range answered {
+			require.EqualValues(t, 200, immediate.Status.Code)
+			var response struct {
+				ID     int             `json:"id"`
+				Result json.RawMessage `json:"result"`
+			}
+			require.NoError(t, json.Unmarshal(immediate.Body, &response))
+			require.JSONEq(t, resultBody, string(response.Result))
+			ids[response.ID] = true
+		}
+		require.Len(t, ids, calls, "every call is answered with its own id")
+		require.Empty(t, routed, "only one call reached the upstream")
+		require.Equal(t, float64(calls-1), coalesced()-before)
+	})
+
+	t.Run("calls waiting on an error are routed", func(t *testing.T) {
+		router := newRouter()
+		before := coalesced()
+		routed, answered := callConcurrently(router, "c_search")
+		leader := <-routed
+		require.Eventually(t, func() bool { return router.toolCallFlights.waiting(leader.resultCacheKey) == calls-1 }, 5*time.Second, 10*time.Millisecond)
+		respond(router, leader, `{"content":[{"type":"text","text":"upstream down"}],"isError":true}`)
+
+		followers := 0
+		for req := range routed {
+			followers++
+			respond(router, req, resultBody)
+		}
+		require.Equal(t, calls-1, followers)
+		require.Empty(t, answered)
+		require.Zero(t, coalesced()-before, "calls routed after waiting are not coalesced")
+	})
+
+	t.Run("calls by different subjects are not coalesced", func(t *testing.T) {
+		router := newRouter()
+		before := coalesced()
+		carol, dave := newSession("carol"), newSession("dave")
+		routed, answered := callConcurrentlyIn(router, "c_search", func(id int) string {
+			if id%2 == 0 {
+				return carol
+			}
+			return dave
+		})
+		leaders := []*MCPRequest{<-routed, <-routed}
+		require.NotEqual(t, leaders[0].resultCacheKey, leaders[1].resultCacheKey, "each subject leads its own flight")
+		for _, leader := range leaders {
+			require.Eventually(t, func() bool { return router.toolCallFlights.waiting(leader.resultCacheKey) == calls/2-1 }, 5*time.Second, 10*time.Millisecond)
+			respond(router, leader, resultBody)
+		}
+
+		answeredCalls := 0
+		for immediate := range answered {
+			require.EqualValues(t, 200, immediate.Status.Code)
+			answeredCalls++
+		}
+		require.Equal(t, calls-2, answeredCalls)
+		require.Empty(t, routed)
+		require.Equal(t, float64(calls-2), coalesced()-before)
+	})
+
+	t.Run("waiting calls are counted against the quota", func(t *testing.T) {
+		router := newRouter()
+		router.ToolCallQuota = calls - 1
+		router.QuotaStore = cache
+		erin := newSession("erin")
+		routed, answered := callConcurrentlyIn(router, "c_search", func(int) string { return erin })
+		leader := <-routed
+		require.Eventually(t, func() bool { return router.toolCallFlights.waiting(leader.resultCacheKey) == calls-2 }, 5*time.Second, 10*time.Millisecond)
+		respond(router, leader, resultBody)
+
+		statuses := map[int32]int{}
+		for immediate := range answered {
+			statuses[int32(immediate.Status.Code)]++
+		}
+		require.Equal(t, map[int32]int{200: calls - 2, 429: 1}, statuses, "the call over the quota is refused rather than joining the flight")
+		require.Empty(t, routed)
+	})
+
+	t.Run("calls to tools that are not idempotent are not coalesced", func(t *testing.T) {
+		router := newRouter()
+		before := coalesced()
+		routed, _ := callConcurrently(router, "c_time")
+		routedCalls := 0
+		for req := range routed {
+			routedCalls++
+			respond(router, req, resultBody)
+		}
+		require.Equal(t, calls, routedCalls)
+		require.Zero(t, coalesced()-before)
+	})
+
+	t.Run("a waiting call is routed once its context is done", func(t *testing.T) {
+		router := newRouter()
+		key, err := toolResultCacheKey("mcp-test/coalesce", "search", nil, map[string]any{"query": "mcp"})
+		require.NoError(t, err)
+		leader := &MCPRequest{ID: ptr.To(1), resultCacheKey: key}
+		_, ok := router.coalescedToolResult(ctx, leader, routingConfig.Servers[0])
+		require.False(t, ok)
+		require.NotNil(t, leader.landFlight)
+		defer leader.endToolCall()
+
+		followerCtx, followerCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer followerCancel()
+		follower := &MCPRequest{ID: ptr.To(2), resultCacheKey: key}
+		_, ok = router.coalescedToolResult(followerCtx, follower, routingConfig.Servers[0])
+		require.False(t, ok)
+		require.Nil(t, follower.landFlight, "the follower does not lead a flight")
+	})
+}
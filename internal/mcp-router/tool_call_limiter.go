@@ -0,0 +1,86 @@
+package mcprouter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultToolCallQueueTimeout is how long a tool call over its server's concurrency limit waits for a slot
+const DefaultToolCallQueueTimeout = time.Second
+
+var toolCallsInFlightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "mcp_gateway_router_tool_calls_in_flight",
+	Help: "Tool calls routed to each MCP server that have not completed",
+}, []string{"server"})
+
+var toolCallLimitRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_tool_call_limit_rejected_total",
+	Help: "Tool calls rejected because their MCP server was at its concurrency limit",
+}, []string{"server"})
+
+func init() {
+	prometheus.MustRegister(toolCallsInFlightGauge, toolCallLimitRejectedTotal)
+}
+
+// errToolCallLimit is returned when no slot became free for a tool call within the queue timeout
+var errToolCallLimit = errors.New("tool call concurrency limit reached")
+
+// toolCallLimiter caps the tool calls in flight to each server. The zero value is ready to use
+type toolCallLimiter struct {
+	lock sync.Mutex
+	// slots hold a value for each tool call in flight to a server with a limit
+	slots map[string]chan struct{}
+}
+
+// serverSlots returns the slots of the server. A changed limit replaces the slots, calls in flight under the old
+// limit free their slots in the old ones
+func (l *toolCallLimiter) serverSlots(server string, limit int) chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.slots == nil {
+		l.slots = map[string]chan struct{}{}
+	}
+	slots, ok := l.slots[server]
+	if !ok || cap(slots) != limit {
+		slots = make(chan struct{}, limit)
+		l.slots[server] = slots
+	}
+	return slots
+}
+
+// acquire admits a tool call to the server. Once limit calls are in flight it waits up to timeout for one of them to
+// complete. A limit of 0 or less admits every call. The returned release frees the slot and may be called more than once
+func (l *toolCallLimiter) acquire(ctx context.Context, server string, limit int, timeout time.Duration) (func(), error) {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = l.serverSlots(server, limit)
+		select {
+		case slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				toolCallLimitRejectedTotal.WithLabelValues(server).Inc()
+				return nil, errToolCallLimit
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	toolCallsInFlightGauge.WithLabelValues(server).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			toolCallsInFlightGauge.WithLabelValues(server).Dec()
+			if slots != nil {
+				<-slots
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,136 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestToolCallLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no limit", func(t *testing.T) {
+		var limiter toolCallLimiter
+		for range 5 {
+			_, err := limiter.acquire(ctx, "mcp-test/a", 0, time.Millisecond)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("admitted under the limit and rejected over it", func(t *testing.T) {
+		var limiter toolCallLimiter
+		first, err := limiter.acquire(ctx, "mcp-test/a", 2, time.Millisecond)
+		require.NoError(t, err)
+		_, err = limiter.acquire(ctx, "mcp-test/a", 2, time.Millisecond)
+		require.NoError(t, err)
+		_, err = limiter.acquire(ctx, "mcp-test/a", 2, time.Millisecond)
+		require.ErrorIs(t, err, errToolCallLimit)
+		// other servers have their own slots
+		_, err = limiter.acquire(ctx, "mcp-test/b", 2, time.Millisecond)
+		require.NoError(t, err)
+
+		// releasing more than once frees a single slot
+		first()
+		first()
+		_, err = limiter.acquire(ctx, "mcp-test/a", 2, time.Millisecond)
+		require.NoError(t, err)
+		_, err = limiter.acquire(ctx, "mcp-test/a", 2, time.Millisecond)
+		require.ErrorIs(t, err, errToolCallLimit)
+	})
+
+	t.Run("queued call is admitted when a slot is freed", func(t *testing.T) {
+		var limiter toolCallLimiter
+		release, err := limiter.acquire(ctx, "mcp-test/a", 1, time.Millisecond)
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			release()
+		}()
+		_, err = limiter.acquire(ctx, "mcp-test/a", 1, 5*time.Second)
+		require.NoError(t, err)
+	})
+
+	t.Run("queued call gives up when the request is cancelled", func(t *testing.T) {
+		var limiter toolCallLimiter
+		_, err := limiter.acquire(ctx, "mcp-test/a", 1, time.Millisecond)
+		require.NoError(t, err)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = limiter.acquire(cancelled, "mcp-test/a", 1, 5*time.Second)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestHandleToolCallConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/limited", "cached-session")
+	require.NoError(t, err)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/default", "cached-session")
+	require.NoError(t, err)
+
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{
+				{Name: "mcp-test/limited", URL: "http://limited.mcp.local/mcp", ToolPrefix: "l_", Enabled: true, Hostname: "limited.mcp.local", MaxConcurrentToolCalls: 2},
+				{Name: "mcp-test/default", URL: "http://default.mcp.local/mcp", ToolPrefix: "d_", Enabled: true, Hostname: "default.mcp.local"},
+			},
+		},
+		JWTManager:             jwtManager,
+		Logger:                 logger,
+		SessionCache:           cache,
+		MaxConcurrentToolCalls: 1,
+		ToolCallQueueTimeout:   time.Millisecond,
+	}
+	toolCall := func(tool string) (*MCPRequest, []*eppb.ProcessingResponse) {
+		req := &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": tool},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		}
+		return req, router.RouteMCPRequest(ctx, req)
+	}
+	requireRejected := func(t *testing.T, resp []*eppb.ProcessingResponse) {
+		t.Helper()
+		require.Len(t, resp, 1)
+		require.NotNil(t, resp[0].GetImmediateResponse())
+		require.EqualValues(t, 429, resp[0].GetImmediateResponse().Status.Code)
+	}
+
+	// the server's own limit overrides the default
+	first, resp := toolCall("l_tool")
+	require.Nil(t, resp[0].GetImmediateResponse())
+	_, resp = toolCall("l_tool")
+	require.Nil(t, resp[0].GetImmediateResponse())
+	_, resp = toolCall("l_tool")
+	requireRejected(t, resp)
+
+	// a completed call frees its slot
+	first.endToolCall()
+	_, resp = toolCall("l_tool")
+	require.Nil(t, resp[0].GetImmediateResponse())
+
+	// servers without a limit use the default
+	defaultCall, resp := toolCall("d_tool")
+	require.Nil(t, resp[0].GetImmediateResponse())
+	_, resp = toolCall("d_tool")
+	requireRejected(t, resp)
+	defaultCall.endToolCall()
+	_, resp = toolCall("d_tool")
+	require.Nil(t, resp[0].GetImmediateResponse())
+}
@@ -0,0 +1,43 @@
+package mcprouter
+
+import (
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/config"
+)
+
+// gatewayMetaFields are the fields the gateway sets in the _meta of the tools it lists. Clients may echo them back in
+// the _meta of their tool calls
+var gatewayMetaFields = []string{upstream.ServerToolMetaKey, upstream.FallbackToolMetaKey, broker.DegradedToolMetaKey}
+
+// applyToolCallMeta changes the _meta of a tool call as configured for its server. The progress token is never removed
+// or replaced so the upstream's progress notifications still reach the client
+func applyToolCallMeta(mcpReq *MCPRequest, serverInfo *config.MCPServer) {
+	metaConfig := serverInfo.ToolCallMeta
+	if metaConfig == nil {
+		return
+	}
+	sent := mcpReq.Params["_meta"]
+	meta, ok := sent.(map[string]any)
+	if !ok {
+		if sent != nil {
+			// the upstream rejects a _meta that is not an object, changing it would hide the client's error
+			return
+		}
+		meta = map[string]any{}
+	}
+	if metaConfig.Mode == config.ToolCallMetaStripGatewayFields {
+		for _, name := range gatewayMetaFields {
+			delete(meta, name)
+		}
+	}
+	for _, field := range metaConfig.Inject {
+		if field.Name == config.ProgressTokenMetaField {
+			continue
+		}
+		meta[field.Name] = field.Value
+	}
+	if len(meta) > 0 || sent != nil {
+		mcpReq.Params["_meta"] = meta
+	}
+}
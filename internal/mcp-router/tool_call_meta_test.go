@@ -0,0 +1,125 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestHandleToolCallMeta(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+	_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/weather", "cached-session")
+	require.NoError(t, err)
+
+	inject := []config.MetaField{
+		{Name: "tenant", Value: "team-a"},
+		// the client's progress token is never replaced
+		{Name: config.ProgressTokenMetaField, Value: "injected"},
+	}
+	testCases := []struct {
+		Name       string
+		Meta       *config.ToolCallMeta
+		SentMeta   any
+		ExpectMeta any
+	}{
+		{
+			Name:       "not configured",
+			SentMeta:   map[string]any{"progressToken": "p1", "server": "mcp-test/weather"},
+			ExpectMeta: map[string]any{"progressToken": "p1", "server": "mcp-test/weather"},
+		},
+		{
+			Name:       "pass through",
+			Meta:       &config.ToolCallMeta{Mode: config.ToolCallMetaPassThrough},
+			SentMeta:   map[string]any{"progressToken": "p1", "server": "mcp-test/weather", "degraded": true, "trace": "t1"},
+			ExpectMeta: map[string]any{"progressToken": "p1", "server": "mcp-test/weather", "degraded": true, "trace": "t1"},
+		},
+		{
+			Name:       "strip gateway fields",
+			Meta:       &config.ToolCallMeta{Mode: config.ToolCallMetaStripGatewayFields},
+			SentMeta:   map[string]any{"progressToken": "p1", "server": "mcp-test/weather", "degraded": true, "trace": "t1"},
+			ExpectMeta: map[string]any{"progressToken": "p1", "trace": "t1"},
+		},
+		{
+			Name:       "strip leaves a call without _meta unchanged",
+			Meta:       &config.ToolCallMeta{Mode: config.ToolCallMetaStripGatewayFields},
+			ExpectMeta: nil,
+		},
+		{
+			Name:       "inject into a call without _meta",
+			Meta:       &config.ToolCallMeta{Inject: inject},
+			ExpectMeta: map[string]any{"tenant": "team-a"},
+		},
+		{
+			Name:       "inject replaces client fields",
+			Meta:       &config.ToolCallMeta{Inject: inject},
+			SentMeta:   map[string]any{"progressToken": float64(7), "tenant": "team-b", "trace": "t1"},
+			ExpectMeta: map[string]any{"progressToken": float64(7), "tenant": "team-a", "trace": "t1"},
+		},
+		{
+			Name:       "strip and inject",
+			Meta:       &config.ToolCallMeta{Mode: config.ToolCallMetaStripGatewayFields, Inject: inject},
+			SentMeta:   map[string]any{"progressToken": "p1", "server": "mcp-test/weather"},
+			ExpectMeta: map[string]any{"progressToken": "p1", "tenant": "team-a"},
+		},
+		{
+			Name:       "_meta that is not an object is left for the upstream to reject",
+			Meta:       &config.ToolCallMeta{Mode: config.ToolCallMetaStripGatewayFields, Inject: inject},
+			SentMeta:   "not-an-object",
+			ExpectMeta: "not-an-object",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{
+						Name:         "mcp-test/weather",
+						URL:          "http://weather.mcp.local/mcp",
+						ToolPrefix:   "w_",
+						Enabled:      true,
+						Hostname:     "weather.mcp.local",
+						ToolCallMeta: tc.Meta,
+					}},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+			}
+			params := map[string]any{"name": "w_forecast"}
+			if tc.SentMeta != nil {
+				params["_meta"] = tc.SentMeta
+			}
+			resp := router.RouteMCPRequest(ctx, &MCPRequest{
+				ID:      ptr.To(1),
+				JSONRPC: "2.0",
+				Method:  "tools/call",
+				Params:  params,
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+			})
+			require.Len(t, resp, 1)
+			rb, ok := resp[0].Response.(*eppb.ProcessingResponse_RequestBody)
+			require.True(t, ok)
+			var body struct {
+				Params map[string]any `json:"params"`
+			}
+			require.NoError(t, json.Unmarshal(rb.RequestBody.Response.BodyMutation.GetBody(), &body))
+			require.Equal(t, "forecast", body.Params["name"])
+			require.Equal(t, tc.ExpectMeta, body.Params["_meta"])
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package mcprouter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultToolCallQuotaWindow is the window tool call quotas are counted over when none is configured
+	DefaultToolCallQuotaWindow = 24 * time.Hour
+	// DefaultToolCallQuotaHeader is the request header the gateway's authentication sets to the subject of a client
+	// when none is configured
+	DefaultToolCallQuotaHeader = "x-mcp-subject"
+	// ToolCallQuotaPerSubject gives each subject its own tool call quota
+	ToolCallQuotaPerSubject = session.IdentitySubject
+	// ToolCallQuotaPerTenant gives each tenant a tool call quota shared by its subjects
+	ToolCallQuotaPerTenant = session.IdentityTenant
+	// anonymousQuotaBucket is the quota shared by the sessions without the identity tool calls are counted against
+	anonymousQuotaBucket = "anonymous"
+)
+
+var toolCallQuotaExceededTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_tool_call_quota_exceeded_total",
+	Help: "Tool calls rejected because their subject had used up its tool call quota",
+}, []string{"server"})
+
+func init() {
+	prometheus.MustRegister(toolCallQuotaExceededTotal)
+}
+
+// QuotaStore counts the tool calls of each subject in fixed windows. The store is shared by the gateway's replicas so
+// a subject has one quota however its calls are spread
+type QuotaStore interface {
+	// IncrementQuota counts a call by the subject and returns the calls counted in the current window, including
+	// this one, and when the window ends
+	IncrementQuota(ctx context.Context, subject string, window time.Duration) (int64, time.Time, error)
+}
+
+// toolCallQuotaWindow returns the window tool call quotas are counted over
+func (s *ExtProcServer) toolCallQuotaWindow() time.Duration {
+	if s.ToolCallQuotaWindow <= 0 {
+		return DefaultToolCallQuotaWindow
+	}
+	return s.ToolCallQuotaWindow
+}
+
+// toolCallQuotaHeader returns the request header holding the subject a tool call is counted against
+func (s *ExtProcServer) toolCallQuotaHeader() string {
+	if s.ToolCallQuotaHeader == "" {
+		return DefaultToolCallQuotaHeader
+	}
+	return s.ToolCallQuotaHeader
+}
+
+// toolCallQuotaPer returns the kind of identity each tool call quota belongs to
+func (s *ExtProcServer) toolCallQuotaPer() string {
+	if s.ToolCallQuotaPer == "" {
+		return ToolCallQuotaPerSubject
+	}
+	return s.ToolCallQuotaPer
+}
+
+// subjectHeaderToRemove returns the subject header when the request carries it in any casing and the subject is used,
+// to count tool calls or to cache their results. The subject is only trusted when the gateway's authentication sets
+// it, which happens after the router, so the header a client sends is removed
+func (s *ExtProcServer) subjectHeaderToRemove(headers *corev3.HeaderMap) []string {
+	if s.ToolCallQuota <= 0 && s.ToolResultCacheTTL <= 0 {
+		return nil
+	}
+	for _, h := range headers.GetHeaders() {
+		if strings.EqualFold(h.GetKey(), s.toolCallQuotaHeader()) {
+			return []string{strings.ToLower(s.toolCallQuotaHeader())}
+		}
+	}
+	return nil
+}
+
+// sessionIdentity returns the verified identities stored for the gateway session keyed by kind. It is empty when the
+// session has none or no store is set
+func (s *ExtProcServer) sessionIdentity(ctx context.Context, gatewaySession string) (map[string]string, error) {
+	if s.SessionIdentities == nil {
+		return map[string]string{}, nil
+	}
+	return s.SessionIdentities.SessionIdentity(ctx, gatewaySession)
+}
+
+// toolCallQuotaBucket returns the quota a tool call in the gateway session is counted against. It is the quota of the
+// subject or tenant the broker stored for the session when its client initialized. The headers of the call are not
+// used as the client sets them. Sessions without the identity share one quota
+func (s *ExtProcServer) toolCallQuotaBucket(ctx context.Context, gatewaySession string) (string, error) {
+	identity, err := s.sessionIdentity(ctx, gatewaySession)
+	if err != nil {
+		return "", err
+	}
+	kind := s.toolCallQuotaPer()
+	if value := identity[kind]; value != "" {
+		return kind + "/" + value, nil
+	}
+	return anonymousQuotaBucket, nil
+}
+
+// chargeToolCallQuota counts the tool call against the quota of its session's subject or tenant and keeps the quota
+// left on the request so it is returned to the client. It returns a quota exceeded error once the quota is used up for
+// the window. Calls made while the store cannot be reached are not limited so an outage of the store does not stop
+// every tool call
+func (s *ExtProcServer) chargeToolCallQuota(ctx context.Context, mcpReq *MCPRequest) []*eppb.ProcessingResponse {
+	if s.ToolCallQuota <= 0 || s.QuotaStore == nil {
+		return nil
+	}
+	subject, err := s.toolCallQuotaBucket(ctx, mcpReq.GetSessionID())
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to get session identity for quota, allowing call", "session", mcpReq.GetSessionID(), "error", err)
+		return nil
+	}
+	count, resetAt, err := s.QuotaStore.IncrementQuota(ctx, subject, s.toolCallQuotaWindow())
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to count tool call against quota, allowing call", "subject", subject, "error", err)
+		return nil
+	}
+	remaining := max(s.ToolCallQuota-count, 0)
+	mcpReq.quotaRemaining = &remaining
+	if count <= s.ToolCallQuota {
+		return nil
+	}
+	toolCallQuotaExceededTotal.WithLabelValues(mcpReq.serverName).Inc()
+	s.Logger.InfoContext(ctx, "tool call quota exceeded, rejecting call", "subject", subject, "quota", s.ToolCallQuota, "resets at", resetAt)
+	return s.quotaExceededResponse(mcpReq, resetAt)
+}
+
+// quotaExceededResponse is the retryable JSON-RPC error of a tool call over its subject's quota. The client is told to
+// retry once the quota window resets
+func (s *ExtProcServer) quotaExceededResponse(mcpReq *MCPRequest, resetAt time.Time) []*eppb.ProcessingResponse {
+	kind := upstream.ErrorKindQuotaExceeded
+	status := int32(kind.HTTPStatus())
+	seconds := retryAfterSeconds(time.Until(resetAt))
+	message := fmt.Sprintf("tool call quota of %d calls per %s exceeded, retry after %s", s.ToolCallQuota, s.toolCallQuotaWindow(), time.Duration(seconds)*time.Second)
+	body, err := upstreamErrorBody(mcpReq, message, upstreamErrorData{Kind: kind, RetryAfter: seconds})
+	if err != nil {
+		s.Logger.Error("failed to marshal quota exceeded error", "error", err)
+		return NewResponse().WithImmediateResponse(status, message).Build()
+	}
+	responses := NewResponse().WithImmediateJSONRetryResponse(status, body, strconv.FormatInt(seconds, 10)).Build()
+	immediate := responses[0].GetImmediateResponse()
+	immediate.Headers.SetHeaders = append(immediate.Headers.SetHeaders, NewHeaders().WithCustomHeader(quotaRemainingHeader, "0").Build()...)
+	return responses
+}
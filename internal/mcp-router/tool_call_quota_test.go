@@ -0,0 +1,211 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestToolCallQuota(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	headerValue := func(headers []*corev3.HeaderValueOption, name string) string {
+		for _, h := range headers {
+			if h.GetHeader().GetKey() == name {
+				return string(h.GetHeader().GetRawValue())
+			}
+		}
+		return ""
+	}
+
+	newRouter := func(t *testing.T, quota int64, window time.Duration) *ExtProcServer {
+		t.Helper()
+		cache, err := session.NewCache(ctx)
+		require.NoError(t, err)
+		jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+		require.NoError(t, err)
+		return &ExtProcServer{
+			RoutingConfig: &config.MCPServersConfig{
+				Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local"}},
+			},
+			JWTManager:          jwtManager,
+			Logger:              logger,
+			SessionCache:        cache,
+			ToolCallQuota:       quota,
+			ToolCallQuotaWindow: window,
+			QuotaStore:          cache,
+			SessionIdentities:   cache,
+		}
+	}
+
+	// newSession starts a gateway session with the identities the broker records when its client initializes
+	newSession := func(t *testing.T, router *ExtProcServer, identity map[string]string) string {
+		t.Helper()
+		gatewaySession := router.JWTManager.Generate(ctx)
+		_, err := router.SessionCache.AddSession(ctx, gatewaySession, "mcp-test/server1", "upstream-session")
+		require.NoError(t, err)
+		cache, ok := router.QuotaStore.(*session.Cache)
+		require.True(t, ok)
+		for kind, value := range identity {
+			require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, kind, value))
+		}
+		return gatewaySession
+	}
+
+	// toolCall calls a tool in the session, with any subject header the client sends, and returns the quota the client
+	// is told it has left, or the immediate response when the call was not routed
+	toolCall := func(t *testing.T, router *ExtProcServer, gatewaySession, clientSubject string) (string, *eppb.ImmediateResponse) {
+		t.Helper()
+		headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}}
+		if clientSubject != "" {
+			headers.Headers = append(headers.Headers, &corev3.HeaderValue{Key: DefaultToolCallQuotaHeader, RawValue: []byte(clientSubject)})
+		}
+		req := &MCPRequest{
+			ID:      ptr.To(5),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": "s1_tool"},
+			Headers: headers,
+		}
+		resp := router.RouteMCPRequest(ctx, req)
+		require.Len(t, resp, 1)
+		if immediate := resp[0].GetImmediateResponse(); immediate != nil {
+			return "", immediate
+		}
+		responses, err := router.HandleResponseHeaders(ctx,
+			&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: ":status", RawValue: []byte("200")}}}},
+			&eppb.HttpHeaders{Headers: headers}, req)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+		return headerValue(responses[0].GetResponseHeaders().GetResponse().GetHeaderMutation().GetSetHeaders(), quotaRemainingHeader), nil
+	}
+
+	requireQuotaExceeded := func(t *testing.T, immediate *eppb.ImmediateResponse) {
+		t.Helper()
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 429, immediate.Status.Code)
+		require.Equal(t, "0", headerValue(immediate.GetHeaders().GetSetHeaders(), quotaRemainingHeader))
+		require.NotEmpty(t, headerValue(immediate.GetHeaders().GetSetHeaders(), "retry-after"))
+		var body struct {
+			ID    int `json:"id"`
+			Error struct {
+				Code int `json:"code"`
+				Data struct {
+					Kind       string `json:"kind"`
+					RetryAfter int    `json:"retryAfter"`
+				} `json:"data"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(immediate.Body, &body))
+		require.Equal(t, 5, body.ID)
+		require.Equal(t, -32006, body.Error.Code)
+		require.Equal(t, "quota-exceeded", body.Error.Data.Kind)
+		require.Positive(t, body.Error.Data.RetryAfter)
+	}
+
+	t.Run("each call decrements the quota until it is exhausted", func(t *testing.T) {
+		router := newRouter(t, 3, 24*time.Hour)
+		alice := newSession(t, router, map[string]string{session.IdentitySubject: "alice"})
+		for _, expectRemaining := range []string{"2", "1", "0"} {
+			remaining, immediate := toolCall(t, router, alice, "")
+			require.Nil(t, immediate)
+			require.Equal(t, expectRemaining, remaining)
+		}
+		_, immediate := toolCall(t, router, alice, "")
+		requireQuotaExceeded(t, immediate)
+
+		// other sessions of the subject share its quota
+		_, immediate = toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "alice"}), "")
+		requireQuotaExceeded(t, immediate)
+
+		// other subjects have their own quota
+		remaining, immediate := toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "bob"}), "")
+		require.Nil(t, immediate)
+		require.Equal(t, "2", remaining)
+	})
+
+	t.Run("the subject header a client sends is ignored", func(t *testing.T) {
+		router := newRouter(t, 1, 24*time.Hour)
+		alice := newSession(t, router, map[string]string{session.IdentitySubject: "alice"})
+		remaining, immediate := toolCall(t, router, alice, "")
+		require.Nil(t, immediate)
+		require.Equal(t, "0", remaining)
+		_, immediate = toolCall(t, router, alice, "someone-else")
+		requireQuotaExceeded(t, immediate)
+	})
+
+	t.Run("sessions without an identity share one quota", func(t *testing.T) {
+		router := newRouter(t, 2, 24*time.Hour)
+		remaining, immediate := toolCall(t, router, newSession(t, router, nil), "alice")
+		require.Nil(t, immediate)
+		require.Equal(t, "1", remaining)
+		remaining, immediate = toolCall(t, router, newSession(t, router, nil), "bob")
+		require.Nil(t, immediate)
+		require.Equal(t, "0", remaining)
+		_, immediate = toolCall(t, router, newSession(t, router, nil), "carol")
+		requireQuotaExceeded(t, immediate)
+	})
+
+	t.Run("per tenant quotas are shared by the tenant's subjects", func(t *testing.T) {
+		router := newRouter(t, 2, 24*time.Hour)
+		router.ToolCallQuotaPer = ToolCallQuotaPerTenant
+		for _, expectRemaining := range []string{"1", "0"} {
+			remaining, immediate := toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "alice-" + expectRemaining, session.IdentityTenant: "team-a"}), "")
+			require.Nil(t, immediate)
+			require.Equal(t, expectRemaining, remaining)
+		}
+		_, immediate := toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "bob", session.IdentityTenant: "team-a"}), "")
+		requireQuotaExceeded(t, immediate)
+
+		remaining, immediate := toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "bob", session.IdentityTenant: "team-b"}), "")
+		require.Nil(t, immediate)
+		require.Equal(t, "1", remaining)
+	})
+
+	t.Run("no quota", func(t *testing.T) {
+		router := newRouter(t, 0, 24*time.Hour)
+		remaining, immediate := toolCall(t, router, newSession(t, router, map[string]string{session.IdentitySubject: "alice"}), "")
+		require.Nil(t, immediate)
+		require.Empty(t, remaining)
+	})
+
+	t.Run("the client's subject header is removed", func(t *testing.T) {
+		router := newRouter(t, 1, 24*time.Hour)
+		responses, err := router.HandleRequestHeaders(&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: "mcp-session-id", RawValue: []byte(newSession(t, router, nil))},
+			{Key: "X-MCP-Subject", RawValue: []byte("alice")},
+		}}})
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+		require.Contains(t, responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders(), DefaultToolCallQuotaHeader)
+	})
+
+	t.Run("the quota resets with the window", func(t *testing.T) {
+		window := 500 * time.Millisecond
+		router := newRouter(t, 1, window)
+		gatewaySession := newSession(t, router, map[string]string{session.IdentitySubject: "alice"})
+		// start at the beginning of a window so both calls fall in it
+		time.Sleep(time.Until(time.Now().Truncate(window).Add(window)))
+		remaining, immediate := toolCall(t, router, gatewaySession, "")
+		require.Nil(t, immediate)
+		require.Equal(t, "0", remaining)
+		_, immediate = toolCall(t, router, gatewaySession, "")
+		requireQuotaExceeded(t, immediate)
+
+		require.Eventually(t, func() bool {
+			remaining, immediate := toolCall(t, router, gatewaySession, "")
+			return immediate == nil && remaining == "0"
+		}, 2*time.Second, 50*time.Millisecond)
+	})
+}
@@ -0,0 +1,24 @@
+package mcprouter
+
+import (
+	"context"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+)
+
+// toolVisibleToSession returns true if the tool may be called in the gateway session under the same tenant isolation
+// the broker applies when listing tools. The tenant is the one the broker stored for the session when its client
+// initialized, as the router runs before the gateway's authentication. A session whose identity cannot be read is
+// treated as having no tenant so it may only call tools shared with all tenants
+func (s *ExtProcServer) toolVisibleToSession(ctx context.Context, gatewaySession string, serverInfo *config.MCPServer, toolName string) bool {
+	tenancy := s.RoutingConfig.Tenancy
+	if tenancy == nil || !tenancy.Enabled {
+		return true
+	}
+	identity, err := s.sessionIdentity(ctx, gatewaySession)
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "failed to get session identity for tenant isolation, only allowing tools shared with all tenants", "session", gatewaySession, "error", err)
+	}
+	return tenancy.Visible(identity[session.IdentityTenant], serverInfo.Name, serverInfo.Tenant, toolName)
+}
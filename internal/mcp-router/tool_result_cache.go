@@ -0,0 +1,167 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxToolResultCacheEntries caps the results held by the cache. Results are not cached while it is full of
+	// results that have not expired
+	maxToolResultCacheEntries = 1000
+	// maxToolResultCacheEntrySize is the largest result, in bytes, that is cached
+	maxToolResultCacheEntrySize = 1 << 20
+)
+
+var toolResultCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_tool_result_cache_total",
+	Help: "Calls to cacheable tools answered from the tool result cache (hit) or routed to their MCP server (miss)",
+}, []string{"server", "result"})
+
+func init() {
+	prometheus.MustRegister(toolResultCacheTotal)
+}
+
+type toolResultCacheEntry struct {
+	result  json.RawMessage
+	expires time.Time
+}
+
+// toolResultCache holds the results of calls to read-only, idempotent tools keyed by server, tool and arguments.
+// The zero value is ready to use
+type toolResultCache struct {
+	lock    sync.Mutex
+	entries map[string]toolResultCacheEntry
+}
+
+// get returns the result cached under the key if it has not expired
+func (c *toolResultCache) get(key string) (json.RawMessage, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// put caches the result under the key for ttl
+func (c *toolResultCache) put(key string, result json.RawMessage, ttl time.Duration) {
+	if len(result) > maxToolResultCacheEntrySize {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]toolResultCacheEntry{}
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxToolResultCacheEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxToolResultCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = toolResultCacheEntry{result: result, expires: time.Now().Add(ttl)}
+}
+
+// toolResultCacheKey returns the key the result of a call to the tool by the identity is cached under. Results may
+// differ for each subject or tenant so the verified identity of the caller's session is part of the key. Arguments
+// and identities are marshalled with sorted keys so calls with the same arguments in a different order share a result
+func toolResultCacheKey(serverName, upstreamToolName string, identity map[string]string, arguments any) (string, error) {
+	canonical, err := json.Marshal(arguments)
+	if err != nil {
+		return "", err
+	}
+	key, err := json.Marshal([]any{serverName, upstreamToolName, identity, json.RawMessage(canonical)})
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// isCacheableTool returns true if results of the tool may be cached. The broker must know the tool and it must be
+// annotated as both read-only and idempotent. Servers called with the client's own Authorization may return
+// different results to each client so their results are never cached
+func (s *ExtProcServer) isCacheableTool(serverInfo *config.MCPServer, upstreamToolName string) bool {
+	if s.ToolResultCacheTTL <= 0 || s.Broker == nil || serverInfo.ForwardAuthorization {
+		return false
+	}
+	annotations, ok := s.Broker.ToolAnnotations(serverInfo.ID(), upstreamToolName)
+	return ok && config.IsReadOnly(annotations) && annotations.IdempotentHint != nil && *annotations.IdempotentHint
+}
+
+// cachedToolResult answers a tool call from the tool result cache. When the result is not cached the key is kept on
+// the request so the result can be cached from the upstream's response
+func (s *ExtProcServer) cachedToolResult(ctx context.Context, mcpReq *MCPRequest, serverInfo *config.MCPServer, upstreamToolName string) ([]byte, bool) {
+	if mcpReq.ID == nil || !s.isCacheableTool(serverInfo, upstreamToolName) {
+		return nil, false
+	}
+	identity, err := s.sessionIdentity(ctx, mcpReq.GetSessionID())
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "not caching tool result as the session identity cannot be read", "tool", upstreamToolName, "error", err)
+		return nil, false
+	}
+	key, err := toolResultCacheKey(serverInfo.Name, upstreamToolName, identity, mcpReq.Params["arguments"])
+	if err != nil {
+		s.Logger.DebugContext(ctx, "not caching tool result as its arguments cannot be marshalled", "tool", upstreamToolName, "error", err)
+		return nil, false
+	}
+	result, ok := s.toolResults.get(key)
+	if !ok {
+		toolResultCacheTotal.WithLabelValues(serverInfo.Name, "miss").Inc()
+		mcpReq.resultCacheKey = key
+		return nil, false
+	}
+	body, err := toolResultResponse(*mcpReq.ID, result)
+	if err != nil {
+		return nil, false
+	}
+	toolResultCacheTotal.WithLabelValues(serverInfo.Name, "hit").Inc()
+	return body, true
+}
+
+// toolResultResponse returns the JSON-RPC response with the id answering a tool call with the result
+func toolResultResponse(id int, result json.RawMessage) ([]byte, error) {
+	return json.Marshal(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      int             `json:"id"`
+		Result  json.RawMessage `json:"result"`
+	}{JSONRPC: mcp.JSONRPC_VERSION, ID: id, Result: result})
+}
+
+// cacheToolResult caches the result in an upstream's JSON response to a cacheable tool call and shares it with the
+// identical calls waiting on it. Errors and results flagged with isError are not cached
+func (s *ExtProcServer) cacheToolResult(body []byte, req *MCPRequest) {
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Result) == 0 || len(response.Error) > 0 {
+		return
+	}
+	var result struct {
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(response.Result, &result); err != nil || result.IsError {
+		return
+	}
+	s.toolResults.put(req.resultCacheKey, response.Result, s.ToolResultCacheTTL)
+	if req.landFlight != nil {
+		req.landFlight(response.Result)
+	}
+}
@@ -0,0 +1,218 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestToolResultCacheKey(t *testing.T) {
+	alice := map[string]string{session.IdentitySubject: "alice", session.IdentityTenant: "acme"}
+	a, err := toolResultCacheKey("mcp-test/a", "search", alice, map[string]any{"query": "mcp", "limit": 10.0})
+	require.NoError(t, err)
+	b, err := toolResultCacheKey("mcp-test/a", "search", map[string]string{session.IdentityTenant: "acme", session.IdentitySubject: "alice"}, map[string]any{"limit": 10.0, "query": "mcp"})
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	for _, other := range []struct {
+		server, tool string
+		identity     map[string]string
+		arguments    any
+	}{
+		{"mcp-test/a", "search", alice, map[string]any{"query": "mcp", "limit": 20.0}},
+		{"mcp-test/a", "lookup", alice, map[string]any{"query": "mcp", "limit": 10.0}},
+		{"mcp-test/b", "search", alice, map[string]any{"query": "mcp", "limit": 10.0}},
+		{"mcp-test/a", "search", alice, nil},
+		{"mcp-test/a", "search", map[string]string{session.IdentitySubject: "bob", session.IdentityTenant: "acme"}, map[string]any{"query": "mcp", "limit": 10.0}},
+		{"mcp-test/a", "search", map[string]string{session.IdentitySubject: "alice", session.IdentityTenant: "other"}, map[string]any{"query": "mcp", "limit": 10.0}},
+		{"mcp-test/a", "search", nil, map[string]any{"query": "mcp", "limit": 10.0}},
+	} {
+		key, err := toolResultCacheKey(other.server, other.tool, other.identity, other.arguments)
+		require.NoError(t, err)
+		require.NotEqual(t, a, key)
+	}
+}
+
+func TestToolResultCacheExpiry(t *testing.T) {
+	var cache toolResultCache
+	cache.put("key", json.RawMessage(`{"content":[]}`), 50*time.Millisecond)
+	result, ok := cache.get("key")
+	require.True(t, ok)
+	require.JSONEq(t, `{"content":[]}`, string(result))
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.get("key")
+	require.False(t, ok)
+
+	// a full cache makes room by dropping expired results but does not evict live ones
+	for i := range maxToolResultCacheEntries {
+		cache.put(strconv.Itoa(i), json.RawMessage(`{}`), time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	cache.put("new", json.RawMessage(`{}`), time.Hour)
+	_, ok = cache.get("new")
+	require.True(t, ok)
+}
+
+func TestHandleToolCallResultCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := slog.New(slog.DiscardHandler)
+
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamServer.AddTools(
+		server.ServerTool{Tool: mcp.NewTool("search", mcp.WithReadOnlyHintAnnotation(true), mcp.WithIdempotentHintAnnotation(true))},
+		server.ServerTool{Tool: mcp.NewTool("time", mcp.WithReadOnlyHintAnnotation(true), mcp.WithIdempotentHintAnnotation(false))},
+		server.ServerTool{Tool: mcp.NewTool("set_time", mcp.WithReadOnlyHintAnnotation(false), mcp.WithIdempotentHintAnnotation(true))},
+	)
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	routingConfig := &config.MCPServersConfig{
+		Servers: []*config.MCPServer{{
+			Name:       "mcp-test/a",
+			URL:        upstreamSrv.URL + "/mcp",
+			ToolPrefix: "a_",
+			Enabled:    true,
+			Hostname:   "a.mcp.local",
+		}},
+	}
+	mcpBroker := broker.NewBroker(logger, broker.WithManagerTickerInterval(50*time.Millisecond))
+	defer func() { _ = mcpBroker.Shutdown(context.Background()) }()
+	mcpBroker.OnConfigChange(ctx, routingConfig)
+	require.Eventually(t, func() bool {
+		man, ok := mcpBroker.RegisteredMCPServers()[routingConfig.Servers[0].ID()]
+		return ok && man.GetStatus().Ready
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+	// newSession starts a gateway session with the subject the broker recorded when its client initialized
+	newSession := func(subject string) string {
+		gatewaySession := jwtManager.Generate(ctx)
+		_, err := cache.AddSession(ctx, gatewaySession, "mcp-test/a", "upstream-session")
+		require.NoError(t, err)
+		require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, session.IdentitySubject, subject))
+		return gatewaySession
+	}
+	gatewaySession := newSession("alice")
+
+	const resultBody = `{"content":[{"type":"text","text":"found"}]}`
+	newRouter := func(ttl time.Duration) *ExtProcServer {
+		return &ExtProcServer{
+			RoutingConfig:      routingConfig,
+			JWTManager:         jwtManager,
+			Logger:             logger,
+			SessionCache:       cache,
+			Broker:             mcpBroker,
+			ToolResultCacheTTL: ttl,
+			SessionIdentities:  cache,
+		}
+	}
+	// callIn sends a tool call in the gateway session and, when it is routed, answers it from the upstream with result
+	callIn := func(router *ExtProcServer, gatewaySession string, id int, tool string, arguments map[string]any, result string) *eppb.ImmediateResponse {
+		req := &MCPRequest{
+			ID:      ptr.To(id),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": tool, "arguments": arguments},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		}
+		resp := router.RouteMCPRequest(ctx, req)
+		require.Len(t, resp, 1)
+		if immediate := resp[0].GetImmediateResponse(); immediate != nil {
+			return immediate
+		}
+		body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "result": json.RawMessage(result)})
+		require.NoError(t, err)
+		router.HandleResponseBody(&eppb.HttpBody{Body: body, EndOfStream: true}, req, false)
+		req.endToolCall()
+		return nil
+	}
+	call := func(router *ExtProcServer, id int, tool string, arguments map[string]any, result string) *eppb.ImmediateResponse {
+		return callIn(router, gatewaySession, id, tool, arguments, result)
+	}
+	requireCached := func(immediate *eppb.ImmediateResponse, id int) {
+		t.Helper()
+		require.NotNil(t, immediate, "expected the call to be answered from the cache")
+		require.EqualValues(t, 200, immediate.Status.Code)
+		require.JSONEq(t, `{"jsonrpc":"2.0","id":`+strconv.Itoa(id)+`,"result":`+resultBody+`}`, string(immediate.Body))
+	}
+
+	t.Run("identical read-only idempotent calls are cached", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		require.Nil(t, call(router, 1, "a_search", map[string]any{"query": "mcp", "limit": 10}, resultBody))
+		requireCached(call(router, 2, "a_search", map[string]any{"limit": 10, "query": "mcp"}, resultBody), 2)
+	})
+
+	t.Run("results are cached for each subject", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		require.Nil(t, call(router, 1, "a_search", nil, resultBody))
+		bob := newSession("bob")
+		require.Nil(t, callIn(router, bob, 2, "a_search", nil, resultBody), "a result is not shared with another subject")
+		requireCached(callIn(router, bob, 3, "a_search", nil, resultBody), 3)
+		requireCached(callIn(router, newSession("alice"), 4, "a_search", nil, resultBody), 4)
+	})
+
+	t.Run("calls answered from the cache are counted against the quota", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		router.ToolCallQuota = 2
+		router.QuotaStore = cache
+		carol := newSession("carol")
+		require.Nil(t, callIn(router, carol, 1, "a_search", nil, resultBody))
+		requireCached(callIn(router, carol, 2, "a_search", nil, resultBody), 2)
+		immediate := callIn(router, carol, 3, "a_search", nil, resultBody)
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 429, immediate.Status.Code)
+	})
+
+	t.Run("calls with different arguments miss", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		require.Nil(t, call(router, 1, "a_search", map[string]any{"query": "mcp"}, resultBody))
+		require.Nil(t, call(router, 2, "a_search", map[string]any{"query": "gateway"}, resultBody))
+		requireCached(call(router, 3, "a_search", map[string]any{"query": "gateway"}, resultBody), 3)
+	})
+
+	t.Run("tools that are not both read-only and idempotent are not cached", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		for _, tool := range []string{"a_time", "a_set_time"} {
+			require.Nil(t, call(router, 1, tool, nil, resultBody))
+			require.Nil(t, call(router, 2, tool, nil, resultBody))
+		}
+	})
+
+	t.Run("error results are not cached", func(t *testing.T) {
+		router := newRouter(time.Minute)
+		require.Nil(t, call(router, 1, "a_search", nil, `{"content":[{"type":"text","text":"upstream down"}],"isError":true}`))
+		require.Nil(t, call(router, 2, "a_search", nil, resultBody))
+		requireCached(call(router, 3, "a_search", nil, resultBody), 3)
+	})
+
+	t.Run("results expire", func(t *testing.T) {
+		router := newRouter(50 * time.Millisecond)
+		require.Nil(t, call(router, 1, "a_search", nil, resultBody))
+		time.Sleep(60 * time.Millisecond)
+		require.Nil(t, call(router, 2, "a_search", nil, resultBody))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		router := newRouter(0)
+		require.Nil(t, call(router, 1, "a_search", nil, resultBody))
+		require.Nil(t, call(router, 2, "a_search", nil, resultBody))
+	})
+}
@@ -0,0 +1,138 @@
+package mcprouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var upstreamRateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_upstream_rate_limited_total",
+	Help: "Requests to an MCP server answered with a rate limited error, either by the server or by the router holding back requests while the server asked for them to be retried later",
+}, []string{"server", "source"})
+
+func init() {
+	prometheus.MustRegister(upstreamRateLimitedTotal)
+}
+
+// upstreamRateLimits holds back requests to servers that rate limited a request until the time they asked to be
+// retried after, so a server that is already overloaded is not sent more requests that will be refused.
+// The zero value is ready to use
+type upstreamRateLimits struct {
+	lock  sync.Mutex
+	until map[string]time.Time
+}
+
+// limited records the server asked for requests to be retried after the delay
+func (l *upstreamRateLimits) limited(serverName string, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.until == nil {
+		l.until = map[string]time.Time{}
+	}
+	if until := time.Now().Add(retryAfter); until.After(l.until[serverName]) {
+		l.until[serverName] = until
+	}
+}
+
+// remaining returns how long requests to the server are still held back. It is 0 once the delay has passed
+func (l *upstreamRateLimits) remaining(serverName string) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	until, ok := l.until[serverName]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(l.until, serverName)
+		return 0
+	}
+	return wait
+}
+
+// parseRetryAfter returns the delay of a retry-after header, which is either a number of seconds or an HTTP date.
+// ok is false for a value that is neither
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
+
+// upstreamRateLimited replaces a 429 from the server with a retryable JSON-RPC error keeping the server's
+// retry-after hint. With UpstreamRateLimitBackpressure set, later requests to the server are answered by the router
+// until the hint has passed
+func (s *ExtProcServer) upstreamRateLimited(ctx context.Context, req *MCPRequest, retryAfter string) []*eppb.ProcessingResponse {
+	upstreamRateLimitedTotal.WithLabelValues(req.serverName, "upstream").Inc()
+	delay, ok := parseRetryAfter(retryAfter, time.Now())
+	if !ok && retryAfter != "" {
+		s.Logger.DebugContext(ctx, "ignoring invalid retry-after from rate limited mcp server", "server", req.serverName, "retry-after", retryAfter)
+		retryAfter = ""
+	}
+	s.Logger.InfoContext(ctx, "mcp server rate limited request", "server", req.serverName, "method", req.Method, "retry-after", retryAfter)
+	if ok && s.UpstreamRateLimitBackpressure {
+		s.rateLimits.limited(req.serverName, delay)
+	}
+	message := fmt.Sprintf("mcp server %s is rate limiting requests", req.serverName)
+	if ok {
+		message = fmt.Sprintf("%s, retry after %s", message, delay.Round(time.Second))
+	}
+	return s.rateLimitedResponse(req, message, retryAfter, delay)
+}
+
+// heldBackByRateLimit answers a request to a server that is being held back after it rate limited a request.
+// ok is false when the server is not held back
+func (s *ExtProcServer) heldBackByRateLimit(ctx context.Context, mcpReq *MCPRequest, serverName string) ([]*eppb.ProcessingResponse, bool) {
+	wait := s.rateLimits.remaining(serverName)
+	if wait <= 0 {
+		return nil, false
+	}
+	upstreamRateLimitedTotal.WithLabelValues(serverName, "router").Inc()
+	s.Logger.InfoContext(ctx, "holding back request to rate limited mcp server", "server", serverName, "method", mcpReq.Method, "retry after", wait)
+	seconds := retryAfterSeconds(wait)
+	message := fmt.Sprintf("mcp server %s is rate limiting requests, retry after %s", serverName, time.Duration(seconds)*time.Second)
+	return s.rateLimitedResponse(mcpReq, message, strconv.FormatInt(seconds, 10), wait), true
+}
+
+// rateLimitedResponse is the retryable JSON-RPC error of a rate limited request. The retry-after header is sent as
+// given and left out when empty
+func (s *ExtProcServer) rateLimitedResponse(mcpReq *MCPRequest, message, retryAfter string, delay time.Duration) []*eppb.ProcessingResponse {
+	kind := upstream.ErrorKindRateLimited
+	status := int32(kind.HTTPStatus())
+	data := upstreamErrorData{Kind: kind}
+	if retryAfter != "" {
+		data.RetryAfter = retryAfterSeconds(delay)
+	}
+	body, err := upstreamErrorBody(mcpReq, message, data)
+	if err != nil {
+		s.Logger.Error("failed to marshal rate limited error", "error", err)
+		return NewResponse().WithImmediateResponse(status, message).Build()
+	}
+	if retryAfter == "" {
+		return NewResponse().WithImmediateJSONResponse(status, body).Build()
+	}
+	return NewResponse().WithImmediateJSONRetryResponse(status, body, retryAfter).Build()
+}
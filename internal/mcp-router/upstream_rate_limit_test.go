@@ -0,0 +1,180 @@
+package mcprouter
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		Name        string
+		Value       string
+		ExpectDelay time.Duration
+		ExpectOK    bool
+	}{
+		{Name: "seconds", Value: "30", ExpectDelay: 30 * time.Second, ExpectOK: true},
+		{Name: "zero", Value: "0", ExpectOK: true},
+		{Name: "http date", Value: "Sat, 01 Mar 2025 12:01:00 GMT", ExpectDelay: time.Minute, ExpectOK: true},
+		{Name: "http date in the past", Value: "Sat, 01 Mar 2025 11:00:00 GMT", ExpectOK: true},
+		{Name: "empty", Value: ""},
+		{Name: "negative", Value: "-5"},
+		{Name: "not a delay", Value: "soon"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			delay, ok := parseRetryAfter(tc.Value, now)
+			require.Equal(t, tc.ExpectOK, ok)
+			require.Equal(t, tc.ExpectDelay, delay)
+		})
+	}
+}
+
+func TestHandleResponseHeadersUpstreamRateLimited(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	type rateLimitedError struct {
+		ID    int `json:"id"`
+		Error struct {
+			Code int `json:"code"`
+			Data struct {
+				Kind       string `json:"kind"`
+				RetryAfter int    `json:"retryAfter"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	requireRateLimited := func(t *testing.T, responses []*eppb.ProcessingResponse, expectRetryAfter string, expectSeconds int) {
+		t.Helper()
+		require.Len(t, responses, 1)
+		immediate := responses[0].GetImmediateResponse()
+		require.NotNil(t, immediate)
+		require.EqualValues(t, 429, immediate.Status.Code)
+		retryAfter := ""
+		for _, h := range immediate.GetHeaders().GetSetHeaders() {
+			if h.GetHeader().GetKey() == "retry-after" {
+				retryAfter = string(h.GetHeader().GetRawValue())
+			}
+		}
+		require.Equal(t, expectRetryAfter, retryAfter)
+		var body rateLimitedError
+		require.NoError(t, json.Unmarshal(immediate.Body, &body))
+		require.Equal(t, 5, body.ID)
+		require.Equal(t, -32005, body.Error.Code)
+		require.Equal(t, "rate-limited", body.Error.Data.Kind)
+		require.Equal(t, expectSeconds, body.Error.Data.RetryAfter)
+	}
+
+	testCases := []struct {
+		Name             string
+		Backpressure     bool
+		RetryAfter       string
+		ExpectRetryAfter string
+		ExpectSeconds    int
+		ExpectHeldBack   bool
+	}{
+		{
+			Name:             "retry-after is preserved",
+			RetryAfter:       "30",
+			ExpectRetryAfter: "30",
+			ExpectSeconds:    30,
+		},
+		{
+			Name:             "backpressure holds back the next call",
+			Backpressure:     true,
+			RetryAfter:       "30",
+			ExpectRetryAfter: "30",
+			ExpectSeconds:    30,
+			ExpectHeldBack:   true,
+		},
+		{
+			Name:         "no retry-after",
+			Backpressure: true,
+		},
+		{
+			Name:         "invalid retry-after is dropped",
+			Backpressure: true,
+			RetryAfter:   "soon",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cache, err := session.NewCache(ctx)
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+			gatewaySession := jwtManager.Generate(ctx)
+			_, err = cache.AddSession(ctx, gatewaySession, "mcp-test/server1", "upstream-session")
+			require.NoError(t, err)
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{Name: "mcp-test/server1", URL: "http://server1.mcp.local/mcp", ToolPrefix: "s1_", Enabled: true, Hostname: "server1.mcp.local"}},
+				},
+				JWTManager:                    jwtManager,
+				Logger:                        logger,
+				SessionCache:                  cache,
+				UpstreamRateLimitBackpressure: tc.Backpressure,
+			}
+			headers := &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}}
+			toolCall := func() (*MCPRequest, []*eppb.ProcessingResponse) {
+				req := &MCPRequest{
+					ID:      ptr.To(5),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": "s1_tool"},
+					Headers: headers,
+				}
+				return req, router.RouteMCPRequest(ctx, req)
+			}
+
+			req, resp := toolCall()
+			require.Len(t, resp, 1)
+			require.Nil(t, resp[0].GetImmediateResponse())
+
+			// the upstream rate limits the call
+			upstreamHeaders := []*corev3.HeaderValue{{Key: ":status", RawValue: []byte("429")}}
+			if tc.RetryAfter != "" {
+				upstreamHeaders = append(upstreamHeaders, &corev3.HeaderValue{Key: "retry-after", RawValue: []byte(tc.RetryAfter)})
+			}
+			responses, err := router.HandleResponseHeaders(ctx,
+				&eppb.HttpHeaders{Headers: &corev3.HeaderMap{Headers: upstreamHeaders}},
+				&eppb.HttpHeaders{Headers: headers}, req)
+			require.NoError(t, err)
+			requireRateLimited(t, responses, tc.ExpectRetryAfter, tc.ExpectSeconds)
+
+			_, resp = toolCall()
+			if !tc.ExpectHeldBack {
+				require.Len(t, resp, 1)
+				require.Nil(t, resp[0].GetImmediateResponse())
+				return
+			}
+			requireRateLimited(t, resp, tc.ExpectRetryAfter, tc.ExpectSeconds)
+		})
+	}
+}
+
+func TestUpstreamRateLimitsExpire(t *testing.T) {
+	var limits upstreamRateLimits
+	require.Zero(t, limits.remaining("mcp-test/server1"))
+
+	limits.limited("mcp-test/server1", 50*time.Millisecond)
+	require.Positive(t, limits.remaining("mcp-test/server1"))
+	require.Zero(t, limits.remaining("mcp-test/server2"))
+
+	// a shorter hint does not cut the delay short
+	limits.limited("mcp-test/server1", time.Millisecond)
+	require.Greater(t, limits.remaining("mcp-test/server1"), 10*time.Millisecond)
+
+	require.Eventually(t, func() bool { return limits.remaining("mcp-test/server1") == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,258 @@
+package mcprouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var upstreamSessionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "mcp_gateway_router_upstream_sessions",
+	Help: "Upstream sessions held by the router for each MCP server",
+}, []string{"server"})
+
+var upstreamSessionLimitTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "mcp_gateway_router_upstream_session_limit_total",
+	Help: "Gateway sessions that reached the upstream session limit of an MCP server and reused a session or were rejected",
+}, []string{"server", "behavior"})
+
+func init() {
+	prometheus.MustRegister(upstreamSessionsGauge, upstreamSessionLimitTotal)
+}
+
+// errUpstreamSessionLimit is returned when a server is at its upstream session limit and no session can be reused
+var errUpstreamSessionLimit = errors.New("upstream session limit reached")
+
+// upstreamSession is an upstream session held by the router. It is shared by more than one gateway session when its
+// server is over the session limit and reuses sessions
+type upstreamSession struct {
+	id     string
+	client io.Closer
+	// refs is the number of gateway sessions using the session
+	refs int
+	// created is when the session was initialized
+	created time.Time
+}
+
+// serverSessions are the upstream sessions held for a single server
+type serverSessions struct {
+	sessions map[*upstreamSession]struct{}
+	// pending is the number of sessions being initialized. They count against the limit
+	pending int
+}
+
+// upstreamSessions tracks the upstream sessions held by this router for each server so a limit can be applied.
+// A session is closed once the last gateway session using it releases it. The zero value is ready to use
+type upstreamSessions struct {
+	lock    sync.Mutex
+	servers map[string]*serverSessions
+}
+
+// server returns the sessions of the server. It must be called with the lock held
+func (u *upstreamSessions) server(name string) *serverSessions {
+	if u.servers == nil {
+		u.servers = map[string]*serverSessions{}
+	}
+	server, ok := u.servers[name]
+	if !ok {
+		server = &serverSessions{sessions: map[*upstreamSession]struct{}{}}
+		u.servers[name] = server
+	}
+	return server
+}
+
+// reserve claims a slot for a new upstream session to the server. When the server is at the limit and reuse is set an
+// existing session is returned instead, otherwise errUpstreamSessionLimit is returned. A limit of 0 or less is no limit.
+// A reserved slot must be filled with add or given up with cancel
+func (u *upstreamSessions) reserve(serverName string, limit int, reuse bool) (*upstreamSession, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	server := u.server(serverName)
+	if limit <= 0 || len(server.sessions)+server.pending < limit {
+		server.pending++
+		return nil, nil
+	}
+	behavior := "Reject"
+	defer func() { upstreamSessionLimitTotal.WithLabelValues(serverName, behavior).Inc() }()
+	if !reuse {
+		return nil, errUpstreamSessionLimit
+	}
+	// spread the gateway sessions across the upstream sessions
+	var least *upstreamSession
+	for session := range server.sessions {
+		if least == nil || session.refs < least.refs || (session.refs == least.refs && session.id < least.id) {
+			least = session
+		}
+	}
+	if least == nil {
+		// every slot is taken by a session still being initialized
+		return nil, errUpstreamSessionLimit
+	}
+	behavior = "Reuse"
+	least.refs++
+	return least, nil
+}
+
+// add fills a slot claimed with reserve with a new upstream session
+func (u *upstreamSessions) add(serverName, id string, client io.Closer) *upstreamSession {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	server := u.server(serverName)
+	server.pending--
+	session := &upstreamSession{id: id, client: client, refs: 1, created: time.Now()}
+	server.sessions[session] = struct{}{}
+	upstreamSessionsGauge.WithLabelValues(serverName).Set(float64(len(server.sessions)))
+	return session
+}
+
+// cancel gives up a slot claimed with reserve when the upstream session could not be created
+func (u *upstreamSessions) cancel(serverName string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.server(serverName).pending--
+}
+
+// release is called when a gateway session stops using the upstream session. The session is closed when it is no
+// longer used. Sessions already invalidated are ignored
+func (u *upstreamSessions) release(serverName string, session *upstreamSession) {
+	u.lock.Lock()
+	server := u.server(serverName)
+	if _, ok := server.sessions[session]; !ok {
+		u.lock.Unlock()
+		return
+	}
+	session.refs--
+	if session.refs > 0 {
+		u.lock.Unlock()
+		return
+	}
+	delete(server.sessions, session)
+	upstreamSessionsGauge.WithLabelValues(serverName).Set(float64(len(server.sessions)))
+	u.lock.Unlock()
+	closeUpstreamSession(serverName, session)
+}
+
+// invalidate closes the upstream sessions with the id, for example when the server no longer recognises it, so they
+// are no longer counted or reused. It returns when the newest of them was created or the zero time if none are held
+func (u *upstreamSessions) invalidate(serverName, id string) time.Time {
+	if id == "" {
+		return time.Time{}
+	}
+	u.lock.Lock()
+	server := u.server(serverName)
+	var invalid []*upstreamSession
+	var created time.Time
+	for session := range server.sessions {
+		if session.id == id {
+			invalid = append(invalid, session)
+			delete(server.sessions, session)
+			if session.created.After(created) {
+				created = session.created
+			}
+		}
+	}
+	upstreamSessionsGauge.WithLabelValues(serverName).Set(float64(len(server.sessions)))
+	u.lock.Unlock()
+	for _, session := range invalid {
+		closeUpstreamSession(serverName, session)
+	}
+	return created
+}
+
+// invalidateServer closes every upstream session held for the server so none are reused. It returns the number closed
+func (u *upstreamSessions) invalidateServer(serverName string) int {
+	u.lock.Lock()
+	server := u.server(serverName)
+	invalid := slices.Collect(maps.Keys(server.sessions))
+	clear(server.sessions)
+	upstreamSessionsGauge.WithLabelValues(serverName).Set(0)
+	u.lock.Unlock()
+	for _, session := range invalid {
+		closeUpstreamSession(serverName, session)
+	}
+	return len(invalid)
+}
+
+// count returns the number of upstream sessions held for the server, not including those being initialized
+func (u *upstreamSessions) count(serverName string) int {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return len(u.server(serverName).sessions)
+}
+
+func closeUpstreamSession(serverName string, session *upstreamSession) {
+	if session.client == nil {
+		return
+	}
+	if err := session.client.Close(); err != nil {
+		slog.Debug("failed to close upstream session", "server", serverName, "session", session.id, "error", err)
+	}
+}
+
+// gatewaySessionReleases hold the releases of the upstream sessions used by each gateway session so they can be
+// released together when the gateway session ends. The zero value is ready to use
+type gatewaySessionReleases struct {
+	lock     sync.Mutex
+	releases map[string][]func()
+}
+
+// add records the release of an upstream session used by the gateway session
+func (g *gatewaySessionReleases) add(gatewaySession string, release func()) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.releases == nil {
+		g.releases = map[string][]func(){}
+	}
+	g.releases[gatewaySession] = append(g.releases[gatewaySession], release)
+}
+
+// take returns and forgets the releases recorded for the gateway session
+func (g *gatewaySessionReleases) take(gatewaySession string) []func() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	releases := g.releases[gatewaySession]
+	delete(g.releases, gatewaySession)
+	return releases
+}
+
+// CloseGatewaySession releases the upstream sessions used by the gateway session and forgets them, for example when
+// it expires or its client is gone. The gateway session stays valid, a later tool call creates new upstream sessions
+func (s *ExtProcServer) CloseGatewaySession(ctx context.Context, gatewaySession string) {
+	releases := s.gatewaySessions.take(gatewaySession)
+	for _, release := range releases {
+		release()
+	}
+	if err := s.SessionCache.DeleteSessions(ctx, gatewaySession, upstreamSessionsCreatedKey(gatewaySession), inFlightToolCallsKey(gatewaySession)); err != nil {
+		s.Logger.Debug("failed to delete session", "session", gatewaySession, "err", err)
+	}
+	s.Logger.Debug("closed gateway session", "session", gatewaySession, "upstream sessions", len(releases))
+}
+
+// UpstreamSessionCount returns the number of upstream sessions this router holds with the server
+func (s *ExtProcServer) UpstreamSessionCount(serverName string) int {
+	return s.upstreamSessions.count(serverName)
+}
+
+// FlushServerSessions forgets the upstream sessions of every gateway session with the server and closes those held by
+// this router, for example after the server was redeployed and its sessions are no longer valid. The next tool call of
+// each gateway session initializes a new upstream session. It returns the number of upstream sessions closed
+func (s *ExtProcServer) FlushServerSessions(ctx context.Context, serverName string) (int, error) {
+	if s.RoutingConfig.GetServerConfigByName(serverName) == nil {
+		return 0, fmt.Errorf("%w: %s", broker.ErrUnknownServer, serverName)
+	}
+	if err := s.SessionCache.RemoveServerSessions(ctx, serverName); err != nil {
+		return 0, fmt.Errorf("failed to remove the sessions of %s: %w", serverName, err)
+	}
+	closed := s.upstreamSessions.invalidateServer(serverName)
+	s.Logger.InfoContext(ctx, "flushed upstream sessions", "server", serverName, "closed", closed)
+	return closed, nil
+}
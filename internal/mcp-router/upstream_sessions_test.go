@@ -0,0 +1,357 @@
+package mcprouter
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	eppb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/kagenti/mcp-gateway/internal/broker"
+	"github.com/kagenti/mcp-gateway/internal/config"
+	"github.com/kagenti/mcp-gateway/internal/session"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+type countingCloser struct {
+	closed int
+}
+
+func (c *countingCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestUpstreamSessions(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		var sessions upstreamSessions
+		for range 3 {
+			shared, err := sessions.reserve("mcp-test/a", 0, false)
+			require.NoError(t, err)
+			require.Nil(t, shared)
+			sessions.add("mcp-test/a", "id", nil)
+		}
+		require.Equal(t, 3, sessions.count("mcp-test/a"))
+	})
+
+	t.Run("reject counts sessions being initialized", func(t *testing.T) {
+		var sessions upstreamSessions
+		_, err := sessions.reserve("mcp-test/a", 2, false)
+		require.NoError(t, err)
+		_, err = sessions.reserve("mcp-test/a", 2, false)
+		require.NoError(t, err)
+		_, err = sessions.reserve("mcp-test/a", 2, false)
+		require.ErrorIs(t, err, errUpstreamSessionLimit)
+
+		// a failed initialize frees its slot
+		sessions.cancel("mcp-test/a")
+		_, err = sessions.reserve("mcp-test/a", 2, false)
+		require.NoError(t, err)
+		// other servers have their own limit
+		_, err = sessions.reserve("mcp-test/b", 2, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("released sessions are closed and free their slot", func(t *testing.T) {
+		var sessions upstreamSessions
+		closer := &countingCloser{}
+		_, err := sessions.reserve("mcp-test/a", 1, false)
+		require.NoError(t, err)
+		upstream := sessions.add("mcp-test/a", "one", closer)
+		_, err = sessions.reserve("mcp-test/a", 1, false)
+		require.ErrorIs(t, err, errUpstreamSessionLimit)
+
+		sessions.release("mcp-test/a", upstream)
+		require.Equal(t, 1, closer.closed)
+		require.Equal(t, 0, sessions.count("mcp-test/a"))
+		_, err = sessions.reserve("mcp-test/a", 1, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("reuse shares the least used session", func(t *testing.T) {
+		var sessions upstreamSessions
+		closers := map[string]*countingCloser{"one": {}, "two": {}}
+		for _, id := range []string{"one", "two"} {
+			_, err := sessions.reserve("mcp-test/a", 2, true)
+			require.NoError(t, err)
+			sessions.add("mcp-test/a", id, closers[id])
+		}
+
+		first, err := sessions.reserve("mcp-test/a", 2, true)
+		require.NoError(t, err)
+		second, err := sessions.reserve("mcp-test/a", 2, true)
+		require.NoError(t, err)
+		require.NotEqual(t, first.id, second.id)
+		require.Equal(t, 2, sessions.count("mcp-test/a"))
+
+		// the session is only closed when the last gateway session releases it
+		sessions.release("mcp-test/a", first)
+		require.Equal(t, 0, closers[first.id].closed)
+		sessions.release("mcp-test/a", first)
+		require.Equal(t, 1, closers[first.id].closed)
+		require.Equal(t, 1, sessions.count("mcp-test/a"))
+	})
+
+	t.Run("reuse with every slot initializing is rejected", func(t *testing.T) {
+		var sessions upstreamSessions
+		_, err := sessions.reserve("mcp-test/a", 1, true)
+		require.NoError(t, err)
+		_, err = sessions.reserve("mcp-test/a", 1, true)
+		require.ErrorIs(t, err, errUpstreamSessionLimit)
+	})
+
+	t.Run("invalidated sessions are closed once", func(t *testing.T) {
+		var sessions upstreamSessions
+		closer := &countingCloser{}
+		_, err := sessions.reserve("mcp-test/a", 1, true)
+		require.NoError(t, err)
+		upstream := sessions.add("mcp-test/a", "one", closer)
+		shared, err := sessions.reserve("mcp-test/a", 1, true)
+		require.NoError(t, err)
+		require.Same(t, upstream, shared)
+
+		sessions.invalidate("mcp-test/a", "one")
+		require.Equal(t, 1, closer.closed)
+		require.Equal(t, 0, sessions.count("mcp-test/a"))
+		sessions.release("mcp-test/a", upstream)
+		sessions.release("mcp-test/a", shared)
+		require.Equal(t, 1, closer.closed)
+	})
+}
+
+func TestHandleToolCallUpstreamSessionLimit(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	testCases := []struct {
+		Name     string
+		Behavior string
+	}{
+		{Name: "reuse", Behavior: config.UpstreamSessionLimitReuse},
+		{Name: "reject", Behavior: config.UpstreamSessionLimitReject},
+		{Name: "reject by default"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			cache, err := session.NewCache(ctx)
+			require.NoError(t, err)
+			jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+			require.NoError(t, err)
+
+			initialized := 0
+			router := &ExtProcServer{
+				RoutingConfig: &config.MCPServersConfig{
+					Servers: []*config.MCPServer{{
+						Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true,
+						MaxUpstreamSessions: 1, UpstreamSessionLimitBehavior: tc.Behavior,
+					}},
+				},
+				JWTManager:   jwtManager,
+				Logger:       logger,
+				SessionCache: cache,
+				InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+					initialized++
+					c, err := client.NewStreamableHttpClient(conf.URL)
+					if err != nil {
+						return nil, err
+					}
+					if err := c.Start(ctx); err != nil {
+						return nil, err
+					}
+					_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+					return c, err
+				},
+			}
+			toolCall := func(gatewaySession string) *eppb.ProcessingResponse {
+				resp := router.RouteMCPRequest(ctx, &MCPRequest{
+					ID:      ptr.To(1),
+					JSONRPC: "2.0",
+					Method:  "tools/call",
+					Params:  map[string]any{"name": "a_tool"},
+					Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+				})
+				require.Len(t, resp, 1)
+				return resp[0]
+			}
+			upstreamSessionOf := func(resp *eppb.ProcessingResponse) string {
+				for _, h := range resp.GetRequestBody().GetResponse().GetHeaderMutation().GetSetHeaders() {
+					if h.Header.Key == sessionHeader {
+						return string(h.Header.RawValue)
+					}
+				}
+				return ""
+			}
+
+			first := upstreamSessionOf(toolCall(jwtManager.Generate(ctx)))
+			require.NotEmpty(t, first)
+
+			resp := toolCall(jwtManager.Generate(ctx))
+			if tc.Behavior == config.UpstreamSessionLimitReuse {
+				require.Equal(t, first, upstreamSessionOf(resp))
+			} else {
+				immediate := resp.GetImmediateResponse()
+				require.NotNil(t, immediate)
+				require.EqualValues(t, 503, immediate.Status.Code)
+				require.Contains(t, string(immediate.Body), "mcp-test/a has reached its limit of 1 sessions")
+			}
+			require.Equal(t, 1, initialized)
+			require.Equal(t, 1, router.upstreamSessions.count("mcp-test/a"))
+		})
+	}
+}
+
+func TestCloseGatewaySession(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	initialized := 0
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{
+				{Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true},
+				{Name: "mcp-test/b", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "b_", Hostname: "b.mcp.local", Enabled: true},
+			},
+		},
+		JWTManager:   jwtManager,
+		Logger:       logger,
+		SessionCache: cache,
+		InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+			initialized++
+			c, err := client.NewStreamableHttpClient(conf.URL)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Start(ctx); err != nil {
+				return nil, err
+			}
+			_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+			return c, err
+		},
+	}
+	toolCall := func(gatewaySession, tool string) {
+		resp := router.RouteMCPRequest(ctx, &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": tool},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		})
+		require.Len(t, resp, 1)
+		require.Nil(t, resp[0].GetImmediateResponse())
+	}
+
+	closed, other := jwtManager.Generate(ctx), jwtManager.Generate(ctx)
+	toolCall(closed, "a_tool")
+	toolCall(closed, "b_tool")
+	toolCall(other, "a_tool")
+	require.Equal(t, 3, initialized)
+	require.Equal(t, 2, router.upstreamSessions.count("mcp-test/a"))
+
+	// every upstream session of the closed gateway session is released and forgotten
+	router.CloseGatewaySession(ctx, closed)
+	require.Equal(t, 1, router.upstreamSessions.count("mcp-test/a"))
+	require.Equal(t, 0, router.upstreamSessions.count("mcp-test/b"))
+	sessions, err := cache.GetSession(ctx, closed)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+	// closing again does not release the sessions twice
+	router.CloseGatewaySession(ctx, closed)
+	require.Equal(t, 1, router.upstreamSessions.count("mcp-test/a"))
+
+	// the gateway session is still valid and gets a new upstream session on its next tool call
+	toolCall(closed, "a_tool")
+	require.Equal(t, 4, initialized)
+	require.Equal(t, 2, router.upstreamSessions.count("mcp-test/a"))
+}
+
+func TestFlushServerSessions(t *testing.T) {
+	upstreamServer := server.NewMCPServer("upstream", "0.0.1", server.WithToolCapabilities(false))
+	upstreamSrv := httptest.NewServer(server.NewStreamableHTTPServer(upstreamServer))
+	defer upstreamSrv.Close()
+
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	cache, err := session.NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := session.NewJWTManager("test-signing-key", 0, logger, cache)
+	require.NoError(t, err)
+
+	initialized := 0
+	router := &ExtProcServer{
+		RoutingConfig: &config.MCPServersConfig{
+			Servers: []*config.MCPServer{
+				{Name: "mcp-test/a", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "a_", Hostname: "a.mcp.local", Enabled: true},
+				{Name: "mcp-test/b", URL: upstreamSrv.URL + "/mcp", ToolPrefix: "b_", Hostname: "b.mcp.local", Enabled: true},
+			},
+		},
+		JWTManager:   jwtManager,
+		Logger:       logger,
+		SessionCache: cache,
+		InitForClient: func(ctx context.Context, _, _ string, conf *config.MCPServer, _ map[string]string) (*client.Client, error) {
+			initialized++
+			c, err := client.NewStreamableHttpClient(conf.URL)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Start(ctx); err != nil {
+				return nil, err
+			}
+			_, err = c.Initialize(ctx, mcp.InitializeRequest{Params: mcp.InitializeParams{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION}})
+			return c, err
+		},
+	}
+	toolCall := func(gatewaySession, tool string) string {
+		resp := router.RouteMCPRequest(ctx, &MCPRequest{
+			ID:      ptr.To(1),
+			JSONRPC: "2.0",
+			Method:  "tools/call",
+			Params:  map[string]any{"name": tool},
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: "mcp-session-id", RawValue: []byte(gatewaySession)}}},
+		})
+		require.Len(t, resp, 1)
+		return upstreamSessionOf(resp[0])
+	}
+
+	first, second := jwtManager.Generate(ctx), jwtManager.Generate(ctx)
+	firstA := toolCall(first, "a_tool")
+	secondA := toolCall(second, "a_tool")
+	firstB := toolCall(first, "b_tool")
+	require.Equal(t, 3, initialized)
+
+	closed, err := router.FlushServerSessions(ctx, "mcp-test/a")
+	require.NoError(t, err)
+	require.Equal(t, 2, closed)
+	require.Equal(t, 0, router.upstreamSessions.count("mcp-test/a"))
+	sessions, err := cache.GetSession(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"mcp-test/b": firstB}, sessions)
+
+	// the next tool call of each gateway session initializes a new session with the flushed server only
+	refreshed := toolCall(first, "a_tool")
+	require.NotEmpty(t, refreshed)
+	require.NotEqual(t, firstA, refreshed)
+	require.NotEqual(t, secondA, toolCall(second, "a_tool"))
+	require.Equal(t, firstB, toolCall(first, "b_tool"))
+	require.Equal(t, 5, initialized)
+	require.Equal(t, 2, router.upstreamSessions.count("mcp-test/a"))
+
+	_, err = router.FlushServerSessions(ctx, "mcp-test/missing")
+	require.ErrorIs(t, err, broker.ErrUnknownServer)
+}
@@ -0,0 +1,272 @@
+// Package replay sends the requests of a recorded MCP session to a gateway and checks the responses against the
+// expectations recorded with them. It turns a captured client session into a deterministic regression test.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Session is a recorded sequence of client requests and the responses expected for them
+type Session struct {
+	// Description says what the session reproduces
+	Description string `json:"description,omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+// Step is a single JSON-RPC message sent by the client
+type Step struct {
+	// Name identifies the step in failures, the request method is used when empty
+	Name string `json:"name,omitempty"`
+	// Headers are added to the request. The mcp-session-id and mcp-protocol-version headers are set by the replay
+	// from the initialize response so a recorded session can be replayed against a new gateway
+	Headers map[string]string `json:"headers,omitempty"`
+	// Request is the JSON-RPC request or notification
+	Request json.RawMessage `json:"request"`
+	Expect  Expectation     `json:"expect,omitempty"`
+}
+
+// Expectation is what the gateway is expected to respond with. Result and Error match when every field they set
+// has the same value in the response, fields they leave out are not checked. Each element of an expected array
+// must match an element of the response's array in any order
+type Expectation struct {
+	// Status is the HTTP status, 200 for requests and 202 for notifications when not set
+	Status int `json:"status,omitempty"`
+	// Result is a subset of the JSON-RPC result. A response with an error fails a step without an expected Error
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error is a subset of the JSON-RPC error, e.g. {"code": -32602}
+	Error json.RawMessage `json:"error,omitempty"`
+}
+
+// Load reads a recorded session from a JSON file
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the session file is chosen by the user running the replay
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
+	}
+	if len(session.Steps) == 0 {
+		return nil, fmt.Errorf("invalid session: no steps")
+	}
+	return session, nil
+}
+
+// Replayer sends recorded sessions to the MCP endpoint of a gateway
+type Replayer struct {
+	// URL is the gateway's MCP endpoint, e.g. http://mcp.127-0-0-1.sslip.io:8001/mcp
+	URL    string
+	Client *http.Client
+}
+
+// Replay sends the steps of the session in order. It returns an error for the first step whose response does not
+// match its expectation
+func (r *Replayer) Replay(ctx context.Context, session *Session) error {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	state := &replayState{}
+	for i, step := range session.Steps {
+		if err := r.replayStep(ctx, client, state, step); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.name(), err)
+		}
+	}
+	return nil
+}
+
+// replayState is carried from one step to the next
+type replayState struct {
+	sessionID       string
+	protocolVersion string
+}
+
+type jsonrpcMessage struct {
+	ID     any             `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+func (s Step) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	request := jsonrpcMessage{}
+	_ = json.Unmarshal(s.Request, &request)
+	return request.Method
+}
+
+func (r *Replayer) replayStep(ctx context.Context, client *http.Client, state *replayState, step Step) error {
+	request := jsonrpcMessage{}
+	if err := json.Unmarshal(step.Request, &request); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(step.Request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for key, value := range step.Headers {
+		req.Header.Set(key, value)
+	}
+	if state.sessionID != "" {
+		req.Header.Set(server.HeaderKeySessionID, state.sessionID)
+	}
+	if state.protocolVersion != "" {
+		req.Header.Set("Mcp-Protocol-Version", state.protocolVersion)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	expectStatus := step.Expect.Status
+	if expectStatus == 0 {
+		expectStatus = http.StatusOK
+		if request.ID == nil {
+			expectStatus = http.StatusAccepted
+		}
+	}
+	if resp.StatusCode != expectStatus {
+		return fmt.Errorf("expected status %d got %d: %s", expectStatus, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if sessionID := resp.Header.Get(server.HeaderKeySessionID); sessionID != "" {
+		state.sessionID = sessionID
+	}
+	// a notification, or a request whose expected status is an HTTP error, has no JSON-RPC response to check
+	if request.ID == nil || (resp.StatusCode >= http.StatusBadRequest && step.Expect.Result == nil && step.Expect.Error == nil) {
+		return nil
+	}
+
+	response, err := findResponse(resp.Header.Get("Content-Type"), body, request.ID)
+	if err != nil {
+		return err
+	}
+	if request.Method == "initialize" && response.Result != nil {
+		initialized := struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}{}
+		if err := json.Unmarshal(response.Result, &initialized); err == nil {
+			state.protocolVersion = initialized.ProtocolVersion
+		}
+	}
+	if step.Expect.Error != nil {
+		if response.Error == nil {
+			return fmt.Errorf("expected an error got result %s", response.Result)
+		}
+		return matchJSON(step.Expect.Error, response.Error)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("unexpected error %s", response.Error)
+	}
+	if step.Expect.Result != nil {
+		return matchJSON(step.Expect.Result, response.Result)
+	}
+	return nil
+}
+
+// findResponse returns the JSON-RPC response to the request with the id from a JSON body or an event stream. An
+// event stream may carry notifications and requests from the server before the response
+func findResponse(contentType string, body []byte, id any) (*jsonrpcMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/event-stream" {
+		response := &jsonrpcMessage{}
+		if err := json.Unmarshal(body, response); err != nil {
+			return nil, fmt.Errorf("invalid response %q: %w", body, err)
+		}
+		return response, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		message := &jsonrpcMessage{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), message); err != nil {
+			continue
+		}
+		if message.Method == "" && reflect.DeepEqual(message.ID, id) {
+			return message, nil
+		}
+	}
+	return nil, fmt.Errorf("no response with id %v in event stream", id)
+}
+
+// matchJSON checks that every field set in expected has the same value in actual
+func matchJSON(expected, actual json.RawMessage) error {
+	var want, got any
+	if err := json.Unmarshal(expected, &want); err != nil {
+		return fmt.Errorf("invalid expectation: %w", err)
+	}
+	if err := json.Unmarshal(actual, &got); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return match("$", want, got)
+}
+
+func match(path string, want, got any) error {
+	switch want := want.(type) {
+	case map[string]any:
+		gotObject, ok := got.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object got %v", path, got)
+		}
+		for key, value := range want {
+			gotValue, ok := gotObject[key]
+			if !ok {
+				return fmt.Errorf("%s.%s: missing", path, key)
+			}
+			if err := match(path+"."+key, value, gotValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		gotArray, ok := got.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array got %v", path, got)
+		}
+		for i, value := range want {
+			if !containsMatch(value, gotArray) {
+				return fmt.Errorf("%s[%d]: no element matches %v", path, i, value)
+			}
+		}
+		return nil
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("%s: expected %v got %v", path, want, got)
+		}
+		return nil
+	}
+}
+
+func containsMatch(want any, got []any) bool {
+	for _, value := range got {
+		if match("", want, value) == nil {
+			return true
+		}
+	}
+	return false
+}
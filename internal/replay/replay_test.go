@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newGreetServer(t *testing.T) string {
+	t.Helper()
+	mcpServer := server.NewMCPServer("test", "0.0.1", server.WithToolCapabilities(true))
+	mcpServer.AddTool(mcp.NewTool("test1_greet", mcp.WithString("name")), func(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("Hi " + request.GetString("name", "")), nil
+	})
+	mcpServer.AddTool(mcp.NewTool("test1_time"), func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("noon"), nil
+	})
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/mcp"
+}
+
+func TestReplay(t *testing.T) {
+	url := newGreetServer(t)
+	initialize := Step{
+		Request: json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"replay","version":"0.0.1"}}}`),
+		Expect:  Expectation{Result: json.RawMessage(`{"capabilities":{"tools":{}}}`)},
+	}
+	initialized := Step{Request: json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)}
+	listTools := json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	callGreet := json.RawMessage(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"test1_greet","arguments":{"name":"replay"}}}`)
+	callMissing := json.RawMessage(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"test1_missing"}}`)
+
+	testCases := []struct {
+		Name        string
+		Steps       []Step
+		ExpectError string
+	}{
+		{
+			Name: "responses match",
+			Steps: []Step{initialize, initialized,
+				{Request: listTools, Expect: Expectation{Result: json.RawMessage(`{"tools":[{"name":"test1_time"},{"name":"test1_greet"}]}`)}},
+				{Request: callGreet, Expect: Expectation{Result: json.RawMessage(`{"content":[{"type":"text","text":"Hi replay"}]}`)}},
+				{Request: callMissing, Expect: Expectation{Error: json.RawMessage(`{"code":-32602}`)}},
+			},
+		},
+		{
+			Name: "different result",
+			Steps: []Step{initialize, initialized,
+				{Name: "greet", Request: callGreet, Expect: Expectation{Result: json.RawMessage(`{"content":[{"text":"Hello replay"}]}`)}},
+			},
+			ExpectError: `step 3 (greet): $.content[0]: no element matches`,
+		},
+		{
+			Name: "missing tool",
+			Steps: []Step{initialize, initialized,
+				{Request: listTools, Expect: Expectation{Result: json.RawMessage(`{"tools":[{"name":"test1_headers"}]}`)}},
+			},
+			ExpectError: `step 3 (tools/list): $.tools[0]: no element matches`,
+		},
+		{
+			Name: "unexpected error",
+			Steps: []Step{initialize, initialized,
+				{Request: callMissing},
+			},
+			ExpectError: "step 3 (tools/call): unexpected error",
+		},
+		{
+			Name: "expected error",
+			Steps: []Step{initialize, initialized,
+				{Request: callGreet, Expect: Expectation{Error: json.RawMessage(`{"code":-32602}`)}},
+			},
+			ExpectError: "step 3 (tools/call): expected an error",
+		},
+		{
+			Name:        "no session",
+			Steps:       []Step{{Request: listTools}},
+			ExpectError: "step 1 (tools/list): expected status 200 got 400",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			replayer := &Replayer{URL: url}
+			err := replayer.Replay(context.Background(), &Session{Steps: tc.Steps})
+			if tc.ExpectError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.ExpectError)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Expected    string
+		Actual      string
+		ExpectError string
+	}{
+		{Name: "extra fields are ignored", Expected: `{"a":1}`, Actual: `{"a":1,"b":2}`},
+		{Name: "nested", Expected: `{"a":{"b":"c"}}`, Actual: `{"a":{"b":"c","d":true}}`},
+		{Name: "array in any order", Expected: `[{"n":2},{"n":1}]`, Actual: `[{"n":1,"x":0},{"n":2},{"n":3}]`},
+		{Name: "different value", Expected: `{"a":{"b":"c"}}`, Actual: `{"a":{"b":"d"}}`, ExpectError: "$.a.b: expected c got d"},
+		{Name: "missing field", Expected: `{"a":null}`, Actual: `{}`, ExpectError: "$.a: missing"},
+		{Name: "not an object", Expected: `{"a":{}}`, Actual: `{"a":[]}`, ExpectError: "$.a: expected an object"},
+		{Name: "not an array", Expected: `[]`, Actual: `{}`, ExpectError: "$: expected an array"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := matchJSON(json.RawMessage(tc.Expected), json.RawMessage(tc.Actual))
+			if tc.ExpectError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.ExpectError)
+		})
+	}
+}
+
+func TestFindResponseInEventStream(t *testing.T) {
+	body := "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{}}\n\n" +
+		"event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":7,\"result\":{\"ok\":true}}\n\n"
+	response, err := findResponse("text/event-stream", []byte(body), float64(7))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ok":true}`, string(response.Result))
+
+	_, err = findResponse("text/event-stream", []byte(body), float64(8))
+	require.ErrorContains(t, err, "no response with id 8")
+}
+
+func TestLoadExampleSession(t *testing.T) {
+	session, err := Load("../../tests/replay/greet.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, session.Description)
+	require.Len(t, session.Steps, 5)
+}
@@ -0,0 +1,19 @@
+package replay
+
+import (
+	"testing"
+)
+
+// RequireReplay replays the session recorded in the file against the gateway's MCP endpoint and fails the test if
+// a response does not match
+func RequireReplay(t testing.TB, url, path string) {
+	t.Helper()
+	session, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load session %s: %v", path, err)
+	}
+	replayer := &Replayer{URL: url}
+	if err := replayer.Replay(t.Context(), session); err != nil {
+		t.Fatalf("replay of %s failed: %v", path, err)
+	}
+}
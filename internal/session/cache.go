@@ -2,16 +2,25 @@ package session
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
+var _ IDStore = &Cache{}
+
 // Cache implements a cache
 type Cache struct {
 	connectionString string
 	inmemory         *sync.Map
 	extClient        *redis.Client
+	// toolOwnersLock makes claiming and releasing tool names atomic in memory
+	toolOwnersLock sync.Mutex
 }
 
 // KeyExists checks if a key exists in the cache
@@ -86,6 +95,241 @@ func (c *Cache) RemoveServerSession(ctx context.Context, key, mcpServerID string
 	return c.extClient.HDel(ctx, key, mcpServerID).Err()
 }
 
+// RemoveServerSessions removes the server's session from every key, for example when the server was redeployed and
+// none of its sessions are valid any more
+func (c *Cache) RemoveServerSessions(ctx context.Context, mcpServerID string) error {
+	if c.inmemory != nil {
+		c.inmemory.Range(func(key, val any) bool {
+			session, ok := val.(map[string]string)
+			if !ok {
+				return true
+			}
+			if _, ok := session[mcpServerID]; !ok {
+				return true
+			}
+			// the map is copied as it may be in use by readers of the key
+			remaining := make(map[string]string, len(session))
+			for server, id := range session {
+				if server != mcpServerID {
+					remaining[server] = id
+				}
+			}
+			c.inmemory.Store(key, remaining)
+			return true
+		})
+		return nil
+	}
+	// gateway sessions are hashes, other keys such as opaque session ids are skipped
+	iter := c.extClient.ScanType(ctx, 0, "*", 100, "hash").Iterator()
+	for iter.Next(ctx) {
+		if err := c.extClient.HDel(ctx, iter.Val(), mcpServerID).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// sessionIDKey is the key an opaque gateway session id is stored under, apart from the upstream sessions of the
+// gateway session which are stored under the id itself
+func sessionIDKey(id string) string {
+	return "session-id:" + id
+}
+
+// AddSessionID stores an opaque gateway session id until expiresAt. It returns ErrSessionIDExists when the id is
+// already in use
+func (c *Cache) AddSessionID(ctx context.Context, id string, expiresAt time.Time) error {
+	key := sessionIDKey(id)
+	if c.inmemory != nil {
+		if existing, loaded := c.inmemory.LoadOrStore(key, expiresAt); loaded {
+			// an expired id that has not been removed yet is replaced
+			if time.Now().Before(existing.(time.Time)) || !c.inmemory.CompareAndSwap(key, existing, expiresAt) {
+				return ErrSessionIDExists
+			}
+		}
+		time.AfterFunc(time.Until(expiresAt), func() {
+			c.inmemory.CompareAndDelete(key, expiresAt)
+		})
+		return nil
+	}
+	added, err := c.extClient.SetNX(ctx, key, strconv.FormatInt(expiresAt.Unix(), 10), time.Until(expiresAt)).Result()
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrSessionIDExists
+	}
+	return nil
+}
+
+// SessionIDExpiry returns when an opaque gateway session id expires. found is false when the id is unknown, expired or deleted
+func (c *Cache) SessionIDExpiry(ctx context.Context, id string) (time.Time, bool, error) {
+	key := sessionIDKey(id)
+	if c.inmemory != nil {
+		val, ok := c.inmemory.Load(key)
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		expiresAt := val.(time.Time)
+		return expiresAt, time.Now().Before(expiresAt), nil
+	}
+	val, err := c.extClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	unix, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	expiresAt := time.Unix(unix, 0)
+	return expiresAt, time.Now().Before(expiresAt), nil
+}
+
+// DeleteSessionID deletes an opaque gateway session id so it is no longer valid
+func (c *Cache) DeleteSessionID(ctx context.Context, id string) error {
+	if c.inmemory != nil {
+		c.inmemory.Delete(sessionIDKey(id))
+		return nil
+	}
+	return c.extClient.Del(ctx, sessionIDKey(id)).Err()
+}
+
+const (
+	// IdentitySubject is the kind of the identity holding the subject of a gateway session's client
+	IdentitySubject = "subject"
+	// IdentityTenant is the kind of the identity holding the tenant of a gateway session's client
+	IdentityTenant = "tenant"
+)
+
+// sessionIdentityKey is the key the verified identities of a gateway session are stored under, keyed by kind
+func sessionIdentityKey(id string) string {
+	return "session-identity:" + id
+}
+
+// SetSessionIdentity stores a verified identity of the kind for the gateway session, such as the subject the gateway's
+// authentication set when the client initialized. Every replica reads it from the cache rather than the client's
+// later requests
+func (c *Cache) SetSessionIdentity(ctx context.Context, id, kind, value string) error {
+	_, err := c.AddSession(ctx, sessionIdentityKey(id), kind, value)
+	return err
+}
+
+// SessionIdentity returns the verified identities stored for the gateway session keyed by kind
+func (c *Cache) SessionIdentity(ctx context.Context, id string) (map[string]string, error) {
+	return c.GetSession(ctx, sessionIdentityKey(id))
+}
+
+// toolOwnersKey is the key holding the server that owns each gateway tool name, keyed by tool name
+const toolOwnersKey = "tool-owners"
+
+// ToolOwners returns the server owning each gateway tool name that has an owner
+func (c *Cache) ToolOwners(ctx context.Context) (map[string]string, error) {
+	return c.GetSession(ctx, toolOwnersKey)
+}
+
+// ClaimToolOwner makes the server the owner of the gateway tool name unless another server owns it. It returns the
+// owner of the name
+func (c *Cache) ClaimToolOwner(ctx context.Context, toolName, serverName string) (string, error) {
+	if c.inmemory != nil {
+		c.toolOwnersLock.Lock()
+		defer c.toolOwnersLock.Unlock()
+		owners, err := c.GetSession(ctx, toolOwnersKey)
+		if err != nil {
+			return "", err
+		}
+		if owner, ok := owners[toolName]; ok {
+			return owner, nil
+		}
+		// the map is copied as it may be in use by readers of the key
+		claimed := maps.Clone(owners)
+		claimed[toolName] = serverName
+		c.inmemory.Store(toolOwnersKey, claimed)
+		return serverName, nil
+	}
+	claimed, err := c.extClient.HSetNX(ctx, toolOwnersKey, toolName, serverName).Result()
+	if err != nil {
+		return "", err
+	}
+	if claimed {
+		return serverName, nil
+	}
+	owner, err := c.extClient.HGet(ctx, toolOwnersKey, toolName).Result()
+	if errors.Is(err, redis.Nil) {
+		// released since the claim, it is taken on the next attempt
+		return "", nil
+	}
+	return owner, err
+}
+
+// ReleaseToolOwner forgets the server as the owner of the gateway tool name. A name owned by another server is left
+// as it is
+func (c *Cache) ReleaseToolOwner(ctx context.Context, toolName, serverName string) error {
+	if c.inmemory != nil {
+		c.toolOwnersLock.Lock()
+		defer c.toolOwnersLock.Unlock()
+		owners, err := c.GetSession(ctx, toolOwnersKey)
+		if err != nil {
+			return err
+		}
+		if owners[toolName] != serverName {
+			return nil
+		}
+		released := maps.Clone(owners)
+		delete(released, toolName)
+		c.inmemory.Store(toolOwnersKey, released)
+		return nil
+	}
+	return c.extClient.Watch(ctx, func(tx *redis.Tx) error {
+		owner, err := tx.HGet(ctx, toolOwnersKey, toolName).Result()
+		if errors.Is(err, redis.Nil) || (err == nil && owner != serverName) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, toolOwnersKey, toolName)
+			return nil
+		})
+		return err
+	}, toolOwnersKey)
+}
+
+// quotaKey is the key the calls of a subject in the quota window starting at windowStart are counted under
+func quotaKey(subject string, windowStart time.Time) string {
+	return "quota:" + subject + ":" + strconv.FormatInt(windowStart.UnixMilli(), 10)
+}
+
+// IncrementQuota counts a call by the subject in the current quota window. It returns the calls counted in the window
+// so far and when the window ends. Windows are aligned to multiples of the window since the zero time, so a 24h
+// window ends at midnight UTC. Counts are kept until their window ends
+func (c *Cache) IncrementQuota(ctx context.Context, subject string, window time.Duration) (int64, time.Time, error) {
+	windowStart := time.Now().Truncate(window)
+	resetAt := windowStart.Add(window)
+	key := quotaKey(subject, windowStart)
+	if c.inmemory != nil {
+		val, loaded := c.inmemory.LoadOrStore(key, &atomic.Int64{})
+		if !loaded {
+			time.AfterFunc(time.Until(resetAt), func() {
+				c.inmemory.Delete(key)
+			})
+		}
+		return val.(*atomic.Int64).Add(1), resetAt, nil
+	}
+	var count *redis.IntCmd
+	_, err := c.extClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, key)
+		pipe.ExpireAt(ctx, key, resetAt)
+		return nil
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return count.Val(), resetAt, nil
+}
+
 // Close closes the cache connection
 func (c *Cache) Close() error {
 	if c.inmemory != nil {
@@ -2,7 +2,9 @@ package session
 
 import (
 	"context"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -236,3 +238,161 @@ func TestInMemoryCache_RemoveServerSession_NonExistentGatewaySession(t *testing.
 	err = cache.RemoveServerSession(ctx, "non-existent-gateway", "server1")
 	require.NoError(t, err)
 }
+
+func TestInMemoryCache_RemoveServerSessions(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	require.NoError(t, err)
+
+	for _, gatewaySession := range []string{"gateway-session-1", "gateway-session-2"} {
+		_, err = cache.AddSession(ctx, gatewaySession, "server1", gatewaySession+"-upstream-1")
+		require.NoError(t, err)
+		_, err = cache.AddSession(ctx, gatewaySession, "server2", gatewaySession+"-upstream-2")
+		require.NoError(t, err)
+	}
+	// keys that are not gateway sessions are left alone
+	require.NoError(t, cache.AddSessionID(ctx, "opaque", time.Now().Add(time.Minute)))
+
+	require.NoError(t, cache.RemoveServerSessions(ctx, "server1"))
+	for _, gatewaySession := range []string{"gateway-session-1", "gateway-session-2"} {
+		sessions, err := cache.GetSession(ctx, gatewaySession)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"server2": gatewaySession + "-upstream-2"}, sessions)
+	}
+	_, found, err := cache.SessionIDExpiry(ctx, "opaque")
+	require.NoError(t, err)
+	require.True(t, found)
+}
+
+func TestInMemoryCache_SessionIDs(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, cache.AddSessionID(ctx, "gateway-session-1", expiresAt))
+	got, found, err := cache.SessionIDExpiry(ctx, "gateway-session-1")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.True(t, expiresAt.Equal(got))
+
+	// the id is kept apart from the upstream sessions of the gateway session
+	require.NoError(t, cache.DeleteSessions(ctx, "gateway-session-1"))
+	_, found, err = cache.SessionIDExpiry(ctx, "gateway-session-1")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// an id in use is not replaced
+	require.ErrorIs(t, cache.AddSessionID(ctx, "gateway-session-1", time.Now().Add(time.Minute)), ErrSessionIDExists)
+	got, _, err = cache.SessionIDExpiry(ctx, "gateway-session-1")
+	require.NoError(t, err)
+	require.True(t, expiresAt.Equal(got))
+
+	require.NoError(t, cache.DeleteSessionID(ctx, "gateway-session-1"))
+	_, found, err = cache.SessionIDExpiry(ctx, "gateway-session-1")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// expired ids are not found and are removed
+	require.NoError(t, cache.AddSessionID(ctx, "gateway-session-2", time.Now().Add(10*time.Millisecond)))
+	require.Eventually(t, func() bool {
+		_, ok := cache.inmemory.Load(sessionIDKey("gateway-session-2"))
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	_, found, err = cache.SessionIDExpiry(ctx, "gateway-session-2")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestInMemoryCache_IncrementQuota(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	require.NoError(t, err)
+
+	// a long window so the test does not cross into the next one
+	count, resetAt, err := cache.IncrementQuota(ctx, "alice", 24*time.Hour)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count)
+	require.True(t, resetAt.After(time.Now()))
+	count, _, err = cache.IncrementQuota(ctx, "alice", 24*time.Hour)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, count)
+
+	// subjects are counted apart
+	count, _, err = cache.IncrementQuota(ctx, "bob", 24*time.Hour)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count)
+
+	// the count starts again in the next window and the count of the last one is removed
+	window := 100 * time.Millisecond
+	_, resetAt, err = cache.IncrementQuota(ctx, "carol", window)
+	require.NoError(t, err)
+	previous := quotaKey("carol", resetAt.Add(-window))
+	time.Sleep(time.Until(resetAt))
+	count, _, err = cache.IncrementQuota(ctx, "carol", window)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count)
+	require.Eventually(t, func() bool {
+		_, ok := cache.inmemory.Load(previous)
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestInMemoryCache_SessionIdentity(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	require.NoError(t, err)
+	jwtManager, err := NewJWTManager("test-signing-key", 0, slog.New(slog.DiscardHandler), cache)
+	require.NoError(t, err)
+	gatewaySession := jwtManager.Generate(ctx)
+
+	identity, err := cache.SessionIdentity(ctx, gatewaySession)
+	require.NoError(t, err)
+	require.Empty(t, identity)
+
+	require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, IdentitySubject, "alice"))
+	require.NoError(t, cache.SetSessionIdentity(ctx, gatewaySession, IdentityTenant, "acme"))
+	identity, err = cache.SessionIdentity(ctx, gatewaySession)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{IdentitySubject: "alice", IdentityTenant: "acme"}, identity)
+
+	// the identity is kept apart from the upstream sessions of the gateway session
+	sessions, err := cache.GetSession(ctx, gatewaySession)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// terminating the session removes its identity
+	_, err = jwtManager.Terminate(ctx, gatewaySession)
+	require.NoError(t, err)
+	identity, err = cache.SessionIdentity(ctx, gatewaySession)
+	require.NoError(t, err)
+	require.Empty(t, identity)
+}
+
+func TestInMemoryCache_ToolOwners(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	require.NoError(t, err)
+
+	owner, err := cache.ClaimToolOwner(ctx, "s_search", "mcp-test/a")
+	require.NoError(t, err)
+	require.Equal(t, "mcp-test/a", owner)
+
+	// a name with an owner is not taken by another server
+	owner, err = cache.ClaimToolOwner(ctx, "s_search", "mcp-test/b")
+	require.NoError(t, err)
+	require.Equal(t, "mcp-test/a", owner)
+	owners, err := cache.ToolOwners(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"s_search": "mcp-test/a"}, owners)
+
+	// only the owner releases the name
+	require.NoError(t, cache.ReleaseToolOwner(ctx, "s_search", "mcp-test/b"))
+	owners, err = cache.ToolOwners(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"s_search": "mcp-test/a"}, owners)
+	require.NoError(t, cache.ReleaseToolOwner(ctx, "s_search", "mcp-test/a"))
+	owner, err = cache.ClaimToolOwner(ctx, "s_search", "mcp-test/b")
+	require.NoError(t, err)
+	require.Equal(t, "mcp-test/b", owner)
+}
@@ -1,10 +1,16 @@
-// Package session provides JWT-based session ID generation and validation
+// Package session provides gateway session ID generation and validation, as JWTs or as opaque ids kept in a store
 package session
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
@@ -16,30 +22,82 @@ const (
 	// DefaultSessionDuration is the default duration for session JWTs
 	DefaultSessionDuration = 24 * time.Hour
 	issuer                 = "mcp-gateway"
+
+	fingerprintMessage = "mcp-gateway session signing key fingerprint"
+
+	// StrategyJWT generates self-contained session ids signed with the signing key
+	StrategyJWT = "jwt"
+	// StrategyOpaque generates random session ids that are valid while they are in the session id store
+	StrategyOpaque = "opaque"
+
+	// opaqueIDBytes is the number of random bytes in an opaque session id
+	opaqueIDBytes = 32
+
+	// DuplicateSessionIDShare hands out a generated opaque session id that is already in use, so the clients given it
+	// share the gateway session and its upstream sessions
+	DuplicateSessionIDShare = "share"
+	// DuplicateSessionIDReject fails to create a session when the generated opaque session id is already in use
+	DuplicateSessionIDReject = "reject"
 )
 
+// ErrSessionIDExists is returned by an IDStore adding a session id that is already in use
+var ErrSessionIDExists = errors.New("session id already in use")
+
 // Deleter interface for providing session deletion
 type Deleter interface {
 	DeleteSessions(ctx context.Context, key ...string) error
 }
 
-var _ server.SessionIdManager = &JWTManager{}
+var _ server.SessionIdManagerResolver = &JWTManager{}
+
+// IDStore keeps opaque session ids until they expire or are terminated
+type IDStore interface {
+	// AddSessionID stores the id until expiresAt. It returns ErrSessionIDExists and leaves the id unchanged when the
+	// id is already in use
+	AddSessionID(ctx context.Context, id string, expiresAt time.Time) error
+	// SessionIDExpiry returns when the id expires. found is false when the id is unknown, expired or terminated
+	SessionIDExpiry(ctx context.Context, id string) (expiresAt time.Time, found bool, err error)
+	DeleteSessionID(ctx context.Context, id string) error
+}
 
 // Claims represents the claims in a session JWT
 type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// JWTManager handles JWT generation and validation for session IDs
+// JWTManager handles generation and validation of gateway session IDs. They are JWTs unless WithOpaqueSessionIDs is set
 type JWTManager struct {
 	signingKey     []byte
 	duration       time.Duration
 	logger         *slog.Logger
 	sessionDeleter Deleter
+	// idStore keeps opaque session ids. Session ids are JWTs when it is nil
+	idStore IDStore
+	// duplicateIDBehavior is what happens when a generated opaque session id is already in use
+	duplicateIDBehavior string
+	// randRead fills opaque session ids with random bytes
+	randRead func([]byte) (int, error)
+}
+
+// WithOpaqueSessionIDs generates random session ids kept in the store instead of JWTs. They are smaller and are
+// revoked as soon as they are terminated, but every component validating them must share the store
+func WithOpaqueSessionIDs(store IDStore) func(*JWTManager) {
+	return func(m *JWTManager) {
+		m.idStore = store
+	}
+}
+
+// WithDuplicateSessionIDBehavior sets what happens when a generated opaque session id is already in use,
+// DuplicateSessionIDShare or DuplicateSessionIDReject. It defaults to DuplicateSessionIDShare. JWT session ids are not
+// stored so a duplicate cannot be detected
+func WithDuplicateSessionIDBehavior(behavior string) func(*JWTManager) {
+	return func(m *JWTManager) {
+		m.duplicateIDBehavior = behavior
+	}
 }
 
 // NewJWTManager creates a new JWT manager with the provided signing key
-func NewJWTManager(signingKey string, sessionLength int64, logger *slog.Logger, sessionHandler Deleter) (*JWTManager, error) {
+func NewJWTManager(signingKey string, sessionLength int64, logger *slog.Logger, sessionHandler Deleter, opts ...func(*JWTManager)) (*JWTManager, error) {
 	if signingKey == "" {
 		return nil, fmt.Errorf("no signing key provided")
 	}
@@ -48,16 +106,37 @@ func NewJWTManager(signingKey string, sessionLength int64, logger *slog.Logger,
 		sessionDuration = time.Duration(sessionLength) * time.Minute
 	}
 
-	return &JWTManager{
+	m := &JWTManager{
 		signingKey:     []byte(signingKey),
 		duration:       sessionDuration,
 		logger:         logger,
 		sessionDeleter: sessionHandler,
-	}, nil
+		randRead:       rand.Read,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Strategy returns how session ids are generated, StrategyJWT or StrategyOpaque
+func (m *JWTManager) Strategy() string {
+	if m.idStore != nil {
+		return StrategyOpaque
+	}
+	return StrategyJWT
+}
+
+// KeyFingerprint identifies the signing key without revealing it so components can check they share the same key.
+// It reveals no more about the key than the session ids signed with it
+func (m *JWTManager) KeyFingerprint() string {
+	mac := hmac.New(sha256.New, m.signingKey)
+	mac.Write([]byte(fingerprintMessage))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
 }
 
 // generateSessionJWT creates a JWT token
-func (m *JWTManager) generateSessionJWT() (string, error) {
+func (m *JWTManager) generateSessionJWT(_ context.Context) (string, error) {
 	now := time.Now()
 	claims := Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -74,10 +153,41 @@ func (m *JWTManager) generateSessionJWT() (string, error) {
 	return token.SignedString(m.signingKey)
 }
 
-// Generate returns a session id JWT to fullfil SessionIdManager interface
-func (m *JWTManager) Generate() string {
-	m.logger.Debug("generating session id in jwt session manager")
-	sessID, err := m.generateSessionJWT()
+// generateOpaqueID creates a random session id and adds it to the store
+func (m *JWTManager) generateOpaqueID(ctx context.Context) (string, error) {
+	b := make([]byte, opaqueIDBytes)
+	if _, err := m.randRead(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	err := m.idStore.AddSessionID(ctx, id, time.Now().Add(m.duration))
+	switch {
+	case errors.Is(err, ErrSessionIDExists) && m.duplicateIDBehavior == DuplicateSessionIDReject:
+		return "", fmt.Errorf("generated session id is already in use, rejecting the session: %w", err)
+	case errors.Is(err, ErrSessionIDExists):
+		m.logger.Warn("generated session id is already in use, the session is shared with the clients already using it")
+	case err != nil:
+		return "", fmt.Errorf("failed to store session id: %w", err)
+	}
+	return id, nil
+}
+
+// opaqueIDExpiry returns when an opaque session id expires. found is false when the id is not in the store
+func (m *JWTManager) opaqueIDExpiry(ctx context.Context, id string) (time.Time, bool, error) {
+	if b, err := hex.DecodeString(id); err != nil || len(b) != opaqueIDBytes {
+		return time.Time{}, false, fmt.Errorf("malformed session id")
+	}
+	return m.idStore.SessionIDExpiry(ctx, id)
+}
+
+// Generate returns a new session id. An opaque id is stored with the context
+func (m *JWTManager) Generate(ctx context.Context) string {
+	m.logger.Debug("generating session id in jwt session manager", "strategy", m.Strategy())
+	generate := m.generateSessionJWT
+	if m.idStore != nil {
+		generate = m.generateOpaqueID
+	}
+	sessID, err := generate(ctx)
 	if err != nil {
 		m.logger.Error("failed to generate session id", "error", err)
 		return ""
@@ -85,8 +195,17 @@ func (m *JWTManager) Generate() string {
 	return sessID
 }
 
-// Validate validates a JWT token and fulfils SessionIdManager interface. returns IsInValid as a bool
-func (m *JWTManager) Validate(tokenValue string) (bool, error) {
+// Validate validates a session id. returns IsInValid as a bool. An opaque id that is not in the store, because it
+// expired or was terminated, is invalid without an error
+func (m *JWTManager) Validate(ctx context.Context, tokenValue string) (bool, error) {
+	if m.idStore != nil {
+		m.logger.Debug("validating opaque session")
+		_, found, err := m.opaqueIDExpiry(ctx, tokenValue)
+		if err != nil {
+			return true, fmt.Errorf("failed to look up session id: %w", err)
+		}
+		return !found, nil
+	}
 	m.logger.Debug("validating JWT session")
 	token, err := jwt.ParseWithClaims(tokenValue, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		// verify signing method
@@ -107,7 +226,17 @@ func (m *JWTManager) Validate(tokenValue string) (bool, error) {
 }
 
 // GetExpiresIn returns the time a token will expire
-func (m *JWTManager) GetExpiresIn(tokenValue string) (time.Time, error) {
+func (m *JWTManager) GetExpiresIn(ctx context.Context, tokenValue string) (time.Time, error) {
+	if m.idStore != nil {
+		expiresAt, found, err := m.opaqueIDExpiry(ctx, tokenValue)
+		if err != nil {
+			return time.Now(), fmt.Errorf("failed to look up session id: %w", err)
+		}
+		if !found {
+			return time.Now(), fmt.Errorf("session id not found")
+		}
+		return expiresAt, nil
+	}
 	token, err := jwt.ParseWithClaims(tokenValue, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		// verify signing method
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -126,15 +255,47 @@ func (m *JWTManager) GetExpiresIn(tokenValue string) (time.Time, error) {
 	return nd.Time, nil
 }
 
-// Terminate part of the SessionIDManager interface. Will remove the associated sessions from cache
-func (m *JWTManager) Terminate(sessionID string) (isNotAllowed bool, err error) {
+// Terminate revokes an opaque session id and removes the associated sessions from cache
+func (m *JWTManager) Terminate(ctx context.Context, sessionID string) (isNotAllowed bool, err error) {
 	m.logger.Info("terminate session id in jwt session manager", "sesssion", sessionID)
+	if m.idStore != nil {
+		// revoke the id so it is rejected from now on rather than when it expires
+		if err := m.idStore.DeleteSessionID(ctx, sessionID); err != nil {
+			return false, fmt.Errorf("error revoking session id : %w", err)
+		}
+	}
 	if m.sessionDeleter != nil {
 		// TODO(craig) this method will be invoked by the MCPBroker so we can probably do the cache deletion there rather than in this manager
-		ctx := context.TODO()
-		if err := m.sessionDeleter.DeleteSessions(ctx, sessionID); err != nil {
+		if err := m.sessionDeleter.DeleteSessions(ctx, sessionID, sessionIdentityKey(sessionID)); err != nil {
 			return false, fmt.Errorf("error clearing out associated sessions : %w", err)
 		}
 	}
 	return false, nil
 }
+
+// ResolveSessionIdManager returns the SessionIdManager for the request. It fulfils the SessionIdManagerResolver
+// interface so the session id store is called with the context of the request the session id came with
+func (m *JWTManager) ResolveSessionIdManager(r *http.Request) server.SessionIdManager { //nolint:revive // name of the mcp-go interface method
+	return &requestSessionIDManager{manager: m, ctx: r.Context()}
+}
+
+// requestSessionIDManager fulfils the SessionIdManager interface for one request
+type requestSessionIDManager struct {
+	manager *JWTManager
+	ctx     context.Context
+}
+
+// Generate returns a new session id
+func (r *requestSessionIDManager) Generate() string {
+	return r.manager.Generate(r.ctx)
+}
+
+// Validate validates the session id. returns IsInValid as a bool
+func (r *requestSessionIDManager) Validate(sessionID string) (bool, error) {
+	return r.manager.Validate(r.ctx, sessionID)
+}
+
+// Terminate revokes the session id and removes the associated sessions from cache
+func (r *requestSessionIDManager) Terminate(sessionID string) (bool, error) {
+	return r.manager.Terminate(r.ctx, sessionID)
+}
@@ -1,8 +1,13 @@
 package session
 
 import (
+	"context"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -58,17 +63,18 @@ func TestNewJWTManager(t *testing.T) {
 }
 
 func TestGenerate(t *testing.T) {
+	ctx := context.Background()
 	manager, _ := NewJWTManager("test-key", 0, testLogger(), nil)
 
 	t.Run("generates valid JWT", func(t *testing.T) {
-		token := manager.Generate()
+		token := manager.Generate(ctx)
 
 		if token == "" {
 			t.Error("expected non-empty token")
 		}
 
 		// validate the token can be parsed
-		isNotAllowed, err := manager.Validate(token)
+		isNotAllowed, err := manager.Validate(ctx, token)
 		if err != nil {
 			t.Fatalf("failed to validate token: %v", err)
 		}
@@ -78,7 +84,7 @@ func TestGenerate(t *testing.T) {
 	})
 
 	t.Run("generates tokens that can be validated", func(t *testing.T) {
-		token := manager.Generate()
+		token := manager.Generate(ctx)
 
 		// parse and check claims directly
 		parsedToken, err := jwt.ParseWithClaims(token, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
@@ -109,12 +115,13 @@ func TestGenerate(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
+	ctx := context.Background()
 	manager, _ := NewJWTManager("test-key", 0, testLogger(), nil)
 
 	t.Run("validates correct token", func(t *testing.T) {
-		token := manager.Generate()
+		token := manager.Generate(ctx)
 
-		isNotAllowed, err := manager.Validate(token)
+		isNotAllowed, err := manager.Validate(ctx, token)
 		if err != nil {
 			t.Fatalf("failed to validate valid token: %v", err)
 		}
@@ -125,9 +132,9 @@ func TestValidate(t *testing.T) {
 
 	t.Run("rejects token with wrong signing key", func(t *testing.T) {
 		otherManager, _ := NewJWTManager("different-key", 0, testLogger(), nil)
-		token := otherManager.Generate()
+		token := otherManager.Generate(ctx)
 
-		isNotAllowed, err := manager.Validate(token)
+		isNotAllowed, err := manager.Validate(ctx, token)
 		if err == nil {
 			t.Error("expected error for token signed with different key")
 		}
@@ -137,7 +144,7 @@ func TestValidate(t *testing.T) {
 	})
 
 	t.Run("rejects invalid token format", func(t *testing.T) {
-		isNotAllowed, err := manager.Validate("not-a-jwt-token")
+		isNotAllowed, err := manager.Validate(ctx, "not-a-jwt-token")
 		if err == nil {
 			t.Error("expected error for invalid token format")
 		}
@@ -151,10 +158,10 @@ func TestValidate(t *testing.T) {
 		shortManager, _ := NewJWTManager("test-key", 0, testLogger(), nil)
 		shortManager.duration = 1 * time.Nanosecond
 
-		token := shortManager.Generate()
+		token := shortManager.Generate(ctx)
 		time.Sleep(10 * time.Millisecond)
 
-		isNotAllowed, err := manager.Validate(token)
+		isNotAllowed, err := manager.Validate(ctx, token)
 		if err == nil {
 			t.Error("expected error for expired token")
 		}
@@ -173,7 +180,7 @@ func TestValidate(t *testing.T) {
 		token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
 		tokenString, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
 
-		isNotAllowed, err := manager.Validate(tokenString)
+		isNotAllowed, err := manager.Validate(ctx, tokenString)
 		if err == nil {
 			t.Error("expected error for wrong signing algorithm")
 		}
@@ -184,12 +191,13 @@ func TestValidate(t *testing.T) {
 }
 
 func TestTerminate(t *testing.T) {
+	ctx := context.Background()
 	manager, _ := NewJWTManager("test-key", 0, testLogger(), nil)
 
 	t.Run("terminate returns no error", func(t *testing.T) {
-		token := manager.Generate()
+		token := manager.Generate(ctx)
 
-		isNotAllowed, err := manager.Terminate(token)
+		isNotAllowed, err := manager.Terminate(ctx, token)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
@@ -198,3 +206,244 @@ func TestTerminate(t *testing.T) {
 		}
 	})
 }
+
+func TestKeyFingerprint(t *testing.T) {
+	first, err := NewJWTManager("test-signing-key", 0, testLogger(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	same, err := NewJWTManager("test-signing-key", 0, testLogger(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := NewJWTManager("other-signing-key", 0, testLogger(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.KeyFingerprint() != same.KeyFingerprint() {
+		t.Errorf("expected the same key to have the same fingerprint, got %s and %s", first.KeyFingerprint(), same.KeyFingerprint())
+	}
+	if first.KeyFingerprint() == other.KeyFingerprint() {
+		t.Errorf("expected different keys to have different fingerprints, both got %s", first.KeyFingerprint())
+	}
+	if len(first.KeyFingerprint()) != 16 || strings.Contains(first.KeyFingerprint(), "test-signing-key") {
+		t.Errorf("unexpected fingerprint %s", first.KeyFingerprint())
+	}
+}
+
+func TestOpaqueSessionIDs(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewCache(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manager, err := NewJWTManager("test-key", 0, testLogger(), cache, WithOpaqueSessionIDs(cache))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if manager.Strategy() != StrategyOpaque {
+		t.Errorf("expected strategy %s, got %s", StrategyOpaque, manager.Strategy())
+	}
+
+	t.Run("generates valid id", func(t *testing.T) {
+		id := manager.Generate(ctx)
+		if len(id) != 2*opaqueIDBytes || strings.Count(id, ".") != 0 {
+			t.Errorf("expected an opaque id, got %s", id)
+		}
+		isNotAllowed, err := manager.Validate(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to validate id: %v", err)
+		}
+		if isNotAllowed {
+			t.Error("expected id to be allowed")
+		}
+		expiresAt, err := manager.GetExpiresIn(ctx, id)
+		if err != nil {
+			t.Fatalf("failed to get expiry: %v", err)
+		}
+		if time.Until(expiresAt) <= DefaultSessionDuration-time.Minute {
+			t.Errorf("expected id to expire in %v, expires at %v", DefaultSessionDuration, expiresAt)
+		}
+	})
+
+	t.Run("rejects unknown id", func(t *testing.T) {
+		other, _ := NewJWTManager("test-key", 0, testLogger(), nil, WithOpaqueSessionIDs(&Cache{inmemory: &sync.Map{}}))
+		isNotAllowed, err := manager.Validate(ctx, other.Generate(ctx))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !isNotAllowed {
+			t.Error("expected isNotAllowed to be true for unknown id")
+		}
+		if _, err := manager.GetExpiresIn(ctx, other.Generate(ctx)); err == nil {
+			t.Error("expected error getting expiry of unknown id")
+		}
+	})
+
+	t.Run("rejects jwt and malformed ids", func(t *testing.T) {
+		jwtManager, _ := NewJWTManager("test-key", 0, testLogger(), nil)
+		for _, id := range []string{jwtManager.Generate(ctx), "not-an-id"} {
+			isNotAllowed, err := manager.Validate(ctx, id)
+			if err == nil {
+				t.Errorf("expected error for malformed id %s", id)
+			}
+			if !isNotAllowed {
+				t.Errorf("expected isNotAllowed to be true for malformed id %s", id)
+			}
+		}
+	})
+
+	t.Run("rejects expired id", func(t *testing.T) {
+		shortManager, _ := NewJWTManager("test-key", 0, testLogger(), nil, WithOpaqueSessionIDs(cache))
+		shortManager.duration = 1 * time.Nanosecond
+		id := shortManager.Generate(ctx)
+		time.Sleep(10 * time.Millisecond)
+
+		isNotAllowed, err := manager.Validate(ctx, id)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !isNotAllowed {
+			t.Error("expected isNotAllowed to be true for expired id")
+		}
+	})
+
+	t.Run("terminate revokes id and its sessions", func(t *testing.T) {
+		id := manager.Generate(ctx)
+		if _, err := cache.AddSession(ctx, id, "mcp-test/server", "upstream-session"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := manager.Terminate(ctx, id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		isNotAllowed, err := manager.Validate(ctx, id)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !isNotAllowed {
+			t.Error("expected isNotAllowed to be true for terminated id")
+		}
+		if exists, _ := cache.KeyExists(ctx, id); exists {
+			t.Error("expected upstream sessions of terminated id to be deleted")
+		}
+	})
+}
+
+func TestDuplicateOpaqueSessionIDs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		behavior     string
+		expectShared bool
+	}{
+		{name: "default shares the session", expectShared: true},
+		{name: "share", behavior: DuplicateSessionIDShare, expectShared: true},
+		{name: "reject", behavior: DuplicateSessionIDReject},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache, err := NewCache(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			opts := []func(*JWTManager){WithOpaqueSessionIDs(cache)}
+			if tc.behavior != "" {
+				opts = append(opts, WithDuplicateSessionIDBehavior(tc.behavior))
+			}
+			manager, err := NewJWTManager("test-key", 0, testLogger(), cache, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// every id generated is the same to force a collision
+			manager.randRead = func(b []byte) (int, error) {
+				for i := range b {
+					b[i] = 7
+				}
+				return len(b), nil
+			}
+
+			first := manager.Generate(context.Background())
+			if first == "" {
+				t.Fatal("expected the first id to be generated")
+			}
+			second := manager.Generate(context.Background())
+			if !tc.expectShared {
+				if second != "" {
+					t.Errorf("expected the duplicate id to be rejected, got %s", second)
+				}
+				return
+			}
+			if second != first {
+				t.Errorf("expected the duplicate id %s to be shared, got %s", first, second)
+			}
+			isNotAllowed, err := manager.Validate(context.Background(), second)
+			if err != nil || isNotAllowed {
+				t.Errorf("expected the shared id to be valid, isNotAllowed %v error %v", isNotAllowed, err)
+			}
+		})
+	}
+}
+
+type requestContextKey struct{}
+
+// contextRecordingIDStore records the request context value of each call before passing it to the store
+type contextRecordingIDStore struct {
+	IDStore
+	lock   sync.Mutex
+	values []any
+}
+
+func (s *contextRecordingIDStore) record(ctx context.Context) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values = append(s.values, ctx.Value(requestContextKey{}))
+}
+
+func (s *contextRecordingIDStore) AddSessionID(ctx context.Context, id string, expiresAt time.Time) error {
+	s.record(ctx)
+	return s.IDStore.AddSessionID(ctx, id, expiresAt)
+}
+
+func (s *contextRecordingIDStore) SessionIDExpiry(ctx context.Context, id string) (time.Time, bool, error) {
+	s.record(ctx)
+	return s.IDStore.SessionIDExpiry(ctx, id)
+}
+
+func (s *contextRecordingIDStore) DeleteSessionID(ctx context.Context, id string) error {
+	s.record(ctx)
+	return s.IDStore.DeleteSessionID(ctx, id)
+}
+
+func TestSessionIDManagerResolver(t *testing.T) {
+	cache, err := NewCache(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store := &contextRecordingIDStore{IDStore: cache}
+	manager, err := NewJWTManager("test-key", 0, testLogger(), cache, WithOpaqueSessionIDs(store))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), requestContextKey{}, "request")
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/mcp", nil)
+	resolved := manager.ResolveSessionIdManager(req)
+
+	id := resolved.Generate()
+	if id == "" {
+		t.Fatal("expected an id to be generated")
+	}
+	if isNotAllowed, err := resolved.Validate(id); err != nil || isNotAllowed {
+		t.Errorf("expected the id to be valid, isNotAllowed %v error %v", isNotAllowed, err)
+	}
+	if _, err := resolved.Terminate(id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.values) != 3 {
+		t.Fatalf("expected the store to be called 3 times, got %d", len(store.values))
+	}
+	for i, value := range store.values {
+		if value != "request" {
+			t.Errorf("expected call %d to the store to have the request context, got value %v", i, value)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Based on https://github.com/modelcontextprotocol/go-sdk/blob/5bd02a3c0451110e8e01a56b9fcfeb048c560a92/examples/server/hello/main.go
+
+// Package server1 implements a simple MCP server with the official go-sdk, the counterpart of server2 which uses
+// mcp-go, so the gateway can be tested against both SDKs
+// - The "greet" tool from the library sample
+// - A "time" tool that returns the current time
+// - A "slow" tool that waits N seconds, notifying the client of progress, and stops early when cancelled
+// - A "headers" tool that returns all HTTP headers it received
+// - An "add_tool" tool that adds a tool, notifying clients the tool list changed
+package server1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// StartupFunc is used for functions that will start a server and block until it is finished
+type StartupFunc func() error
+
+// ShutdownFunc is used for functions that stop running servers
+type ShutdownFunc func() error
+
+type contextKey string
+
+// headersKey is used to save HTTP headers in request context, for the "headers" tool
+const headersKey contextKey = "http-headers"
+
+type greetArgs struct {
+	Name string `json:"name" jsonschema:"the name to say hi to"`
+}
+
+type slowArgs struct {
+	Seconds int `json:"seconds" jsonschema:"number of seconds to wait"`
+}
+
+type addToolArgs struct {
+	Name string `json:"name" jsonschema:"the name of the new tool to add"`
+}
+
+// RunServer create a server that can be started and stopped. It is only served over streamable HTTP
+func RunServer(port string) (StartupFunc, ShutdownFunc, error) {
+	s := mcp.NewServer(&mcp.Implementation{Name: "test mcp server 1", Version: "1.0.0"}, nil)
+	mcp.AddTool(s, &mcp.Tool{Name: "greet", Description: "say hi"}, greetHandler)
+	mcp.AddTool(s, &mcp.Tool{Name: "time", Description: "get current time", Annotations: &mcp.ToolAnnotations{Title: "time"}}, timeHandler)
+	mcp.AddTool(s, &mcp.Tool{Name: "slow", Description: "delay N seconds"}, slowHandler)
+	mcp.AddTool(s, &mcp.Tool{Name: "headers", Description: "get headers"}, headersHandler)
+	mcp.AddTool(s, &mcp.Tool{Name: "add_tool", Description: "dynamically add a new tool (triggers notifications/tools/list_changed)"}, addToolHandler(s))
+
+	if port == "" {
+		port = "8080"
+	}
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s }, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), headersKey, req.Header)))
+	}))
+	httpServer := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 3 * time.Second,
+	}
+
+	return func() error {
+			fmt.Printf("Serving HTTPStreamable on http://localhost:%s/mcp\n", port)
+			if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}, func() error {
+			shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 1*time.Second)
+			defer shutdownRelease()
+			return httpServer.Shutdown(shutdownCtx)
+		}, nil
+}
+
+func greetHandler(_ context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[greetArgs]) (*mcp.CallToolResultFor[struct{}], error) {
+	return &mcp.CallToolResultFor[struct{}]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Hi " + params.Arguments.Name}},
+	}, nil
+}
+
+func timeHandler(_ context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[struct{}]) (*mcp.CallToolResultFor[struct{}], error) {
+	return &mcp.CallToolResultFor[struct{}]{
+		Content: []mcp.Content{&mcp.TextContent{Text: time.Now().String()}},
+	}, nil
+}
+
+func headersHandler(ctx context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[struct{}]) (*mcp.CallToolResultFor[struct{}], error) {
+	content := make([]mcp.Content, 0)
+	if headers, ok := ctx.Value(headersKey).(http.Header); ok {
+		for k, v := range headers {
+			content = append(content, &mcp.TextContent{Text: fmt.Sprintf("%s: %v", k, v)})
+		}
+	}
+	return &mcp.CallToolResultFor[struct{}]{Content: content}, nil
+}
+
+func slowHandler(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[slowArgs]) (*mcp.CallToolResultFor[struct{}], error) {
+	var progressToken any
+	if params.Meta != nil {
+		progressToken = params.Meta["progressToken"]
+	}
+	startTime := time.Now()
+	for {
+		waited := int(time.Since(startTime).Seconds())
+		if waited >= params.Arguments.Seconds {
+			break
+		}
+		if progressToken != nil {
+			err := ss.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				Message:       fmt.Sprintf("Waited %d seconds...", waited),
+				ProgressToken: progressToken,
+				Progress:      float64(waited),
+			})
+			if err != nil {
+				log.Printf("NotifyProgress error: %v", err)
+			}
+		}
+		// a call cancelled by the client stops early
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	return &mcp.CallToolResultFor[struct{}]{
+		Content: []mcp.Content{&mcp.TextContent{Text: "done"}},
+	}, nil
+}
+
+// addToolHandler adds a tool to the server, which notifies its clients the tool list changed
+func addToolHandler(s *mcp.Server) mcp.ToolHandlerFor[addToolArgs, struct{}] {
+	return func(_ context.Context, _ *mcp.ServerSession, params *mcp.CallToolParamsFor[addToolArgs]) (*mcp.CallToolResultFor[struct{}], error) {
+		name := params.Arguments.Name
+		mcp.AddTool(s, &mcp.Tool{Name: name, Description: "dynamically added tool"}, func(_ context.Context, _ *mcp.ServerSession, _ *mcp.CallToolParamsFor[struct{}]) (*mcp.CallToolResultFor[struct{}], error) {
+			return &mcp.CallToolResultFor[struct{}]{
+				Content: []mcp.Content{&mcp.TextContent{Text: "I am the dynamically added tool: " + name}},
+			}, nil
+		})
+		return &mcp.CallToolResultFor[struct{}]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Added new tool: " + name}},
+		}, nil
+	}
+}
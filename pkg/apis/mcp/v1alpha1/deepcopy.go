@@ -68,6 +68,113 @@ func (in *MCPServerList) DeepCopyObject() runtime.Object {
 func (in *MCPServerSpec) DeepCopyInto(out *MCPServerSpec) {
 	*out = *in
 	out.TargetRef = in.TargetRef
+	if in.CredentialRef != nil {
+		in, out := &in.CredentialRef, &out.CredentialRef
+		*out = new(SecretReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ToolPrefixAliases != nil {
+		in, out := &in.ToolPrefixAliases, &out.ToolPrefixAliases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ToolRenames != nil {
+		in, out := &in.ToolRenames, &out.ToolRenames
+		*out = make([]ToolRename, len(*in))
+		copy(*out, *in)
+	}
+	if in.ToolTimeouts != nil {
+		in, out := &in.ToolTimeouts, &out.ToolTimeouts
+		*out = make(map[string]metav1.Duration, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ToolDefaultArguments != nil {
+		in, out := &in.ToolDefaultArguments, &out.ToolDefaultArguments
+		*out = make(map[string]runtime.RawExtension, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.ToolWeights != nil {
+		in, out := &in.ToolWeights, &out.ToolWeights
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.UpstreamSessionMaxAge != nil {
+		in, out := &in.UpstreamSessionMaxAge, &out.UpstreamSessionMaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ToolCallMeta != nil {
+		in, out := &in.ToolCallMeta, &out.ToolCallMeta
+		*out = new(ToolCallMeta)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StartupProbe != nil {
+		in, out := &in.StartupProbe, &out.StartupProbe
+		*out = new(StartupProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FallbackTools != nil {
+		in, out := &in.FallbackTools, &out.FallbackTools
+		*out = make([]FallbackTool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HealthThresholds != nil {
+		in, out := &in.HealthThresholds, &out.HealthThresholds
+		*out = new(HealthThresholds)
+		**out = **in
+	}
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *FallbackTool) DeepCopyInto(out *FallbackTool) {
+	*out = *in
+	if in.InputSchema != nil {
+		in, out := &in.InputSchema, &out.InputSchema
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *ToolCallMeta) DeepCopyInto(out *ToolCallMeta) {
+	*out = *in
+	if in.Inject != nil {
+		in, out := &in.Inject, &out.Inject
+		*out = make([]MetaField, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *StartupProbe) DeepCopyInto(out *StartupProbe) {
+	*out = *in
+	if in.Period != nil {
+		in, out := &in.Period, &out.Period
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *SecretReference) DeepCopyInto(out *SecretReference) {
+	*out = *in
+	if in.AdditionalKeys != nil {
+		in, out := &in.AdditionalKeys, &out.AdditionalKeys
+		*out = make([]CredentialKey, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopyInto copies the receiver, writing into out. in must be non-nil.
@@ -88,6 +195,7 @@ func (in *MCPVirtualServer) DeepCopyInto(out *MCPVirtualServer) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy copies the receiver, creating a new MCPVirtualServer.
@@ -143,9 +251,28 @@ func (in *MCPVirtualServerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto copies the receiver, writing into out. in must be non-nil.
 func (in *MCPVirtualServerSpec) DeepCopyInto(out *MCPVirtualServerSpec) {
 	*out = *in
+	if in.ToolBindings != nil {
+		in, out := &in.ToolBindings, &out.ToolBindings
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Tools != nil {
 		in, out := &in.Tools, &out.Tools
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 }
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *MCPVirtualServerStatus) DeepCopyInto(out *MCPVirtualServerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +kubebuilder:object:root=true
@@ -43,6 +44,15 @@ type MCPServerSpec struct {
 	// +kubebuilder:validation:XValidation:rule="self == oldSelf || oldSelf == ''",message="toolPrefix is immutable once set"
 	ToolPrefix string `json:"toolPrefix,omitempty"`
 
+	// ToolPrefixAliases advertise the server's tools under additional prefixes as well as ToolPrefix, so clients
+	// can keep using an old prefix while they move to a new one. Calls through any of the prefixes reach the same
+	// server. Each alias adds a copy of every tool so at most 3 are allowed.
+	// For example, toolPrefix "weather_" with alias "forecast_" advertises both weather_get and forecast_get.
+	// +optional
+	// +kubebuilder:validation:MaxItems=3
+	// +kubebuilder:validation:items:MinLength=1
+	ToolPrefixAliases []string `json:"toolPrefixAliases,omitempty"`
+
 	// Path specifies the URL path where the MCP server endpoint is exposed.
 	// If not specified, defaults to "/mcp".
 	// This allows connecting to MCP servers that use custom paths like "/v1/mcp" or "/api/mcp".
@@ -50,12 +60,239 @@ type MCPServerSpec struct {
 	// +kubebuilder:default="/mcp"
 	Path string `json:"path,omitempty"`
 
+	// BackendPathRewrite overrides the path requests are sent to when the upstream MCP server sits behind a
+	// proxy that rewrites paths. It must be an absolute path and may contain the {path} placeholder which is
+	// replaced with Path, for example "/proxy/team-a{path}".
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/[^?#\s]*$`
+	BackendPathRewrite string `json:"backendPathRewrite,omitempty"`
+
+	// TLSServerName overrides the hostname the broker sends as SNI and verifies the certificate of an HTTPS
+	// upstream against, and the Host header it sends, when they differ from the backend's DNS name. This is common
+	// for ExternalName Services or appProtocol https upstreams whose certificate is for another name. It takes
+	// precedence over the hostname of a BackendTLSPolicy and is ignored for upstreams reached over plain HTTP.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	TLSServerName string `json:"tlsServerName,omitempty"`
+
 	// CredentialRef references a Secret containing authentication credentials for the MCP server.
 	// The Secret should contain a key with the authentication token or credentials.
 	// The controller will aggregate these credentials and make them available to the broker
 	// via environment variables following the pattern: KAGENTI_{MCP_NAME}_CRED
 	// +optional
 	CredentialRef *SecretReference `json:"credentialRef,omitempty"`
+
+	// CredentialLocation sets where the credential from CredentialRef is sent to the MCP server.
+	// "bearer" sends it in the Authorization header with a "Bearer " prefix, "header:<Name>" sends it in the
+	// named header and "query:<name>" sends it as the named query parameter.
+	// When unset the broker sends the credential unchanged in the Authorization header.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(bearer|header:[A-Za-z0-9-]+|query:[A-Za-z0-9_.~-]+)$`
+	CredentialLocation string `json:"credentialLocation,omitempty"`
+
+	// Priority decides which servers keep their tools when the broker limits the number of advertised tools.
+	// Tools from servers with a higher priority are advertised first. Defaults to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ToolWeights decide which of the server's tools are kept when only some of them fit within the broker's tool
+	// limit, keyed by the tool name on the MCP server (without ToolPrefix or renames). Tools with a higher weight are
+	// advertised first and tools without a weight have a weight of 0.
+	// For example, {"search": 10} keeps the search tool ahead of the server's other tools.
+	// +optional
+	ToolWeights map[string]int32 `json:"toolWeights,omitempty"`
+
+	// ToolRenames rewrite the names of the server's tools before ToolPrefix is added. They are applied in order
+	// and tool calls are routed back to the upstream tool by its original name.
+	// For example, match "^get_(.*)$" with replace "fetch_${1}" advertises get_weather as fetch_weather.
+	// +optional
+	ToolRenames []ToolRename `json:"toolRenames,omitempty"`
+
+	// ToolTimeouts set how long calls to individual tools may take, keyed by the tool name on the MCP server
+	// (without ToolPrefix or renames). Tools without a timeout use the timeout of the gateway's route.
+	// For example, {"slow": "5m"} allows the slow tool five minutes.
+	// +optional
+	ToolTimeouts map[string]metav1.Duration `json:"toolTimeouts,omitempty"`
+
+	// ToolDefaultArguments set arguments added to calls to individual tools when the client does not send them,
+	// keyed by the tool name on the MCP server (without ToolPrefix or renames). Arguments sent by the client are
+	// never overridden. Defaults that do not match the tool's input schema are not applied.
+	// For example, {"forecast": {"region": "eu-west-1"}} calls forecast in eu-west-1 unless the client picks a region.
+	// +optional
+	ToolDefaultArguments map[string]runtime.RawExtension `json:"toolDefaultArguments,omitempty"`
+
+	// MaxUpstreamSessions caps the number of sessions each router replica holds with the MCP server.
+	// Each client session otherwise gets its own upstream session. Defaults to no limit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxUpstreamSessions int32 `json:"maxUpstreamSessions,omitempty"`
+
+	// UpstreamSessionLimitBehavior is what happens to a new client session once MaxUpstreamSessions is reached.
+	// "Reject" fails its tool calls to the server. "Reuse" shares an existing upstream session, which is only
+	// safe for servers that keep no per-client state. Defaults to "Reject".
+	// +optional
+	// +kubebuilder:validation:Enum=Reject;Reuse
+	UpstreamSessionLimitBehavior string `json:"upstreamSessionLimitBehavior,omitempty"`
+
+	// UpstreamSessionMaxAge is how long the router uses an upstream session with the MCP server before it
+	// initializes a new one on the next request. Set it below the time after which the server expires sessions so
+	// a client's calls are not failed with a lost session. Defaults to no maximum age.
+	// +optional
+	UpstreamSessionMaxAge *metav1.Duration `json:"upstreamSessionMaxAge,omitempty"`
+
+	// MaxConcurrentToolCalls caps the tool calls each router replica has in flight to the MCP server. Calls over
+	// the limit wait briefly for a slot and are then rejected with a 429. Defaults to the router's
+	// --max-concurrent-tool-calls setting, which is no limit unless set.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxConcurrentToolCalls int32 `json:"maxConcurrentToolCalls,omitempty"`
+
+	// MaxResponseBytes caps the size of the responses the MCP server sends to tool calls routed through the gateway,
+	// so clients are not sent multi-megabyte tool results. A larger response is replaced with an error. An event
+	// stream is counted as it flows and ended with an error once it exceeds the limit. Defaults to no limit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxResponseBytes int64 `json:"maxResponseBytes,omitempty"`
+
+	// ToolCallMeta controls the _meta of the tool calls the gateway forwards to the MCP server. Defaults to
+	// forwarding the _meta sent by the client unchanged. The client's progressToken is always forwarded so progress
+	// notifications keep reaching it.
+	// +optional
+	ToolCallMeta *ToolCallMeta `json:"toolCallMeta,omitempty"`
+
+	// ReadOnly restricts the server to tools annotated with readOnlyHint. Other tools are not advertised and
+	// calls to them are rejected by the gateway. The ReadOnly condition reports how many tools are hidden.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// Cordoned stops new sessions to the server for maintenance. Clients that already have a session with the
+	// server keep using it while new clients get a retryable error. The Cordoned condition reports the state.
+	// +optional
+	Cordoned bool `json:"cordoned,omitempty"`
+
+	// StartupProbe checks the MCP server more often and with a longer timeout until the broker first connects to
+	// it, for servers that take longer to start than the steady-state health check allows. Once connected the
+	// broker's normal health check applies. A server that does not start within the probe's failure threshold is
+	// reported as failed. Defaults to no startup probe.
+	// +optional
+	StartupProbe *StartupProbe `json:"startupProbe,omitempty"`
+
+	// FallbackTools are advertised in place of the server's tools while the broker cannot connect to it, so clients
+	// keep seeing its tools during an outage. Calls to them fail with a retryable error until the server is back,
+	// when the tools it lists replace them. Defaults to advertising none of the server's tools while it is down.
+	// +optional
+	FallbackTools []FallbackTool `json:"fallbackTools,omitempty"`
+
+	// HealthThresholds sets how many of the broker's health checks of a connected server must fail in a row before
+	// the server is reported as degraded and as not ready. Defaults to reporting the server as not ready on the first
+	// failed health check.
+	// +optional
+	HealthThresholds *HealthThresholds `json:"healthThresholds,omitempty"`
+}
+
+// ToolCallMeta configures how the _meta of tool calls is forwarded to an MCP server
+type ToolCallMeta struct {
+	// Mode is how the _meta sent by the client is forwarded. "PassThrough" forwards it unchanged.
+	// "StripGatewayFields" removes the fields the gateway adds to the _meta of the tools it lists, such as server,
+	// which some clients echo back in their calls. Defaults to "PassThrough".
+	// +optional
+	// +kubebuilder:validation:Enum=PassThrough;StripGatewayFields
+	Mode string `json:"mode,omitempty"`
+
+	// Inject sets fields in the _meta of every tool call to the server, replacing a field of the same name sent by
+	// the client. progressToken cannot be injected.
+	// For example, name "tenant" with value "team-a" sends {"_meta": {"tenant": "team-a"}}.
+	// +optional
+	Inject []MetaField `json:"inject,omitempty"`
+}
+
+// MetaField is a field set in the _meta of a tool call
+type MetaField struct {
+	// Name is the name of the field.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Value is the value of the field.
+	Value string `json:"value"`
+}
+
+// FallbackTool is the definition of a tool advertised while its MCP server is unavailable
+type FallbackTool struct {
+	// Name is the name of the tool on the MCP server (without ToolPrefix or renames).
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Description is the description of the tool.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// InputSchema is the JSON schema of the tool's arguments. Defaults to accepting any arguments.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	InputSchema *runtime.RawExtension `json:"inputSchema,omitempty"`
+}
+
+// HealthThresholds configures how failed health checks of a connected MCP server affect its readiness
+type HealthThresholds struct {
+	// DegradedAfter is the number of consecutive failed health checks after which the Degraded condition is set on
+	// the server while it is still ready. A server with a DegradedAfter of at least its UnreadyAfter is never reported
+	// as degraded. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	DegradedAfter int32 `json:"degradedAfter,omitempty"`
+
+	// UnreadyAfter is the number of consecutive failed health checks after which the server is no longer ready.
+	// Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	UnreadyAfter int32 `json:"unreadyAfter,omitempty"`
+}
+
+// WithDefaults returns the degraded and unready thresholds with the ones that are not set replaced by their defaults.
+// A nil HealthThresholds has the defaults
+func (t *HealthThresholds) WithDefaults() (degradedAfter, unreadyAfter int32) {
+	degradedAfter, unreadyAfter = 1, 1
+	if t == nil {
+		return degradedAfter, unreadyAfter
+	}
+	if t.DegradedAfter > 0 {
+		degradedAfter = t.DegradedAfter
+	}
+	if t.UnreadyAfter > 0 {
+		unreadyAfter = t.UnreadyAfter
+	}
+	return degradedAfter, unreadyAfter
+}
+
+// StartupProbe configures how the broker checks an MCP server until it first connects to it
+type StartupProbe struct {
+	// Period is the interval between connection attempts during startup. Defaults to 10s.
+	// +optional
+	Period *metav1.Duration `json:"period,omitempty"`
+
+	// Timeout bounds the health check of each connection attempt during startup. Defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// FailureThreshold is the number of failed connection attempts after which the server is reported as failed
+	// rather than starting. Defaults to 30.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// ToolRename rewrites the parts of a tool name matching a regular expression.
+type ToolRename struct {
+	// Match is a regular expression (RE2 syntax) matched against the tool name.
+	// +kubebuilder:validation:MinLength=1
+	Match string `json:"match"`
+
+	// Replace is the replacement for each match. It may refer to capture groups such as ${1}.
+	// An empty replacement removes the matched text.
+	// +optional
+	Replace string `json:"replace,omitempty"`
 }
 
 // TargetReference identifies an HTTPRoute that points to MCP servers.
@@ -89,6 +326,22 @@ type SecretReference struct {
 	// +kubebuilder:default=token
 	// +optional
 	Key string `json:"key,omitempty"`
+
+	// AdditionalKeys are further keys of the Secret sent to the MCP server with the credential, for upstreams that
+	// need more than one credential component such as a key and a secret.
+	// +optional
+	AdditionalKeys []CredentialKey `json:"additionalKeys,omitempty"`
+}
+
+// CredentialKey is a key of a credential Secret and where its value is sent to the MCP server
+type CredentialKey struct {
+	// Key is the key within the Secret that contains the value.
+	Key string `json:"key"`
+
+	// Location sets where the value is sent. "header:<Name>" sends it in the named header and "query:<name>" sends
+	// it as the named query parameter.
+	// +kubebuilder:validation:Pattern=`^(header:[A-Za-z0-9-]+|query:[A-Za-z0-9_.~-]+)$`
+	Location string `json:"location"`
 }
 
 // MCPServerStatus represents the observed state of the MCPServer resource.
@@ -102,8 +355,29 @@ type MCPServerStatus struct {
 	// DiscoveredTools is the number of tools discovered from this MCPServer
 	// +optional
 	DiscoveredTools int `json:"discoveredTools,omitempty"`
+
+	// ConnectionState is the broker's connection to the server. NeverConnected means a session has never been
+	// established, Reconnecting and Failed mean an established connection was lost.
+	// +optional
+	// +kubebuilder:validation:Enum=NeverConnected;Connected;Reconnecting;Failed
+	ConnectionState ConnectionState `json:"connectionState,omitempty"`
 }
 
+// ConnectionState is the state of the broker's connection to an MCP server
+type ConnectionState string
+
+const (
+	// ConnectionStateNeverConnected means the broker has never established a session with the server
+	ConnectionStateNeverConnected ConnectionState = "NeverConnected"
+	// ConnectionStateConnected means the broker is connected to the server
+	ConnectionStateConnected ConnectionState = "Connected"
+	// ConnectionStateReconnecting means the broker lost its connection to the server and is retrying
+	ConnectionStateReconnecting ConnectionState = "Reconnecting"
+	// ConnectionStateFailed means the broker has repeatedly failed to reconnect to the server, or to connect to it
+	// within its startup probe
+	ConnectionStateFailed ConnectionState = "Failed"
+)
+
 // +kubebuilder:object:root=true
 
 // MCPServerList contains a list of MCPServer
@@ -114,8 +388,10 @@ type MCPServerList struct {
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Namespaced,shortName=mcpvs
 // +kubebuilder:printcolumn:name="Tools",type="integer",JSONPath=".spec.tools.length()"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status",description="Ready status"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MCPVirtualServer defines a virtual server that exposes a specific set of tools.
@@ -125,20 +401,61 @@ type MCPVirtualServer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec MCPVirtualServerSpec `json:"spec,omitempty"`
+	Spec   MCPVirtualServerSpec   `json:"spec,omitempty"`
+	Status MCPVirtualServerStatus `json:"status,omitempty"`
 }
 
 // MCPVirtualServerSpec defines the desired state of MCPVirtualServer.
 // It specifies which tools should be exposed by this virtual server.
 type MCPVirtualServerSpec struct {
 	// Description provides a human-readable description of this virtual server's purpose.
+	// It is returned to clients selecting this virtual server as the instructions of the initialize result.
 	// +optional
 	Description string `json:"description,omitempty"`
 
+	// Title is a human-readable name for this virtual server.
+	// It is returned to clients selecting this virtual server as the title of the initialize serverInfo.
+	// +optional
+	Title string `json:"title,omitempty"`
+
+	// ToolBindings route calls to individual tools to a specific MCPServer, keyed by the tool name as listed in Tools.
+	// The value is the name of an MCPServer in the virtual server's namespace or namespace/name. They settle which
+	// server is called when the prefixes of more than one MCPServer match the tool. The MCPServer's tool prefix or
+	// one of its aliases must match the tool.
+	// For example, {"weather_forecast": "weather-eu"} routes weather_forecast to the weather-eu MCPServer.
+	// +optional
+	ToolBindings map[string]string `json:"toolBindings,omitempty"`
+
 	// Tools specifies the list of tool names to expose through this virtual server.
 	// These tools must be available from the underlying MCP servers configured in the system.
 	// +kubebuilder:validation:MinItems=1
 	Tools []string `json:"tools"`
+
+	// UnavailableBehavior controls what is returned from tools/list when none of the MCP servers
+	// providing this virtual server's tools are healthy. Empty returns no tools. Degraded returns
+	// the tools with the degraded field set in their _meta.
+	// +optional
+	// +kubebuilder:default=Degraded
+	// +kubebuilder:validation:Enum=Empty;Degraded
+	UnavailableBehavior UnavailableBehavior `json:"unavailableBehavior,omitempty"`
+}
+
+// UnavailableBehavior defines how a virtual server responds when all of its backing MCP servers are unavailable
+type UnavailableBehavior string
+
+const (
+	// UnavailableBehaviorEmpty returns an empty tool list
+	UnavailableBehaviorEmpty UnavailableBehavior = "Empty"
+	// UnavailableBehaviorDegraded returns the tools marked as degraded
+	UnavailableBehaviorDegraded UnavailableBehavior = "Degraded"
+)
+
+// MCPVirtualServerStatus represents the observed state of the MCPVirtualServer resource.
+type MCPVirtualServerStatus struct {
+	// Conditions represent the latest available observations of the MCPVirtualServer's state.
+	// The 'Ready' condition reports the aggregate health of the MCP servers providing its tools.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
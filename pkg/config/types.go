@@ -9,13 +9,81 @@ type BrokerConfig struct {
 
 // ServerConfig represents server config
 type ServerConfig struct {
-	Name       string      `json:"name"                 yaml:"name"`
-	URL        string      `json:"url"                  yaml:"url"`
-	Hostname   string      `json:"hostname,omitempty"   yaml:"hostname,omitempty"`
-	ToolPrefix string      `json:"toolPrefix,omitempty" yaml:"toolPrefix,omitempty"`
-	Auth       *AuthConfig `json:"auth,omitempty"       yaml:"auth,omitempty"`
-	Credential string      `json:"credential,omitempty" yaml:"credential,omitempty"`
-	Enabled    bool        `json:"enabled"              yaml:"enabled"`
+	Name                         string               `json:"name"                                   yaml:"name"`
+	URL                          string               `json:"url"                                    yaml:"url"`
+	Hostname                     string               `json:"hostname,omitempty"                     yaml:"hostname,omitempty"`
+	ToolPrefix                   string               `json:"toolPrefix,omitempty"                   yaml:"toolPrefix,omitempty"`
+	ToolPrefixAliases            []string             `json:"toolPrefixAliases,omitempty"            yaml:"toolPrefixAliases,omitempty"`
+	Auth                         *AuthConfig          `json:"auth,omitempty"                         yaml:"auth,omitempty"`
+	Credential                   string               `json:"credential,omitempty"                   yaml:"credential,omitempty"`
+	CredentialLocation           string               `json:"credentialLocation,omitempty"           yaml:"credentialLocation,omitempty"`
+	AdditionalCredentials        []Credential         `json:"additionalCredentials,omitempty"        yaml:"additionalCredentials,omitempty"`
+	Enabled                      bool                 `json:"enabled"                                yaml:"enabled"`
+	TLS                          *TLSConfig           `json:"tls,omitempty"                          yaml:"tls,omitempty"`
+	PathRewrite                  string               `json:"pathRewrite,omitempty"                  yaml:"pathRewrite,omitempty"`
+	Priority                     int                  `json:"priority,omitempty"                     yaml:"priority,omitempty"`
+	ToolRenames                  []ToolRename         `json:"toolRenames,omitempty"                  yaml:"toolRenames,omitempty"`
+	ToolTimeouts                 map[string]string    `json:"toolTimeouts,omitempty"                 yaml:"toolTimeouts,omitempty"`
+	ToolDefaultArguments         map[string]string    `json:"toolDefaultArguments,omitempty"         yaml:"toolDefaultArguments,omitempty"`
+	ToolWeights                  map[string]int       `json:"toolWeights,omitempty"                  yaml:"toolWeights,omitempty"`
+	Tenant                       string               `json:"tenant,omitempty"                       yaml:"tenant,omitempty"`
+	MaxUpstreamSessions          int                  `json:"maxUpstreamSessions,omitempty"          yaml:"maxUpstreamSessions,omitempty"`
+	UpstreamSessionLimitBehavior string               `json:"upstreamSessionLimitBehavior,omitempty" yaml:"upstreamSessionLimitBehavior,omitempty"`
+	UpstreamSessionMaxAge        string               `json:"upstreamSessionMaxAge,omitempty"        yaml:"upstreamSessionMaxAge,omitempty"`
+	MaxConcurrentToolCalls       int                  `json:"maxConcurrentToolCalls,omitempty"       yaml:"maxConcurrentToolCalls,omitempty"`
+	MaxResponseBytes             int64                `json:"maxResponseBytes,omitempty"             yaml:"maxResponseBytes,omitempty"`
+	ToolCallMeta                 *ToolCallMetaConfig  `json:"toolCallMeta,omitempty"                 yaml:"toolCallMeta,omitempty"`
+	ReadOnly                     bool                 `json:"readOnly,omitempty"                     yaml:"readOnly,omitempty"`
+	Cordoned                     bool                 `json:"cordoned,omitempty"                     yaml:"cordoned,omitempty"`
+	ForwardAuthorization         bool                 `json:"forwardAuthorization,omitempty"         yaml:"forwardAuthorization,omitempty"`
+	StartupProbe                 *StartupProbeConfig  `json:"startupProbe,omitempty"                 yaml:"startupProbe,omitempty"`
+	FallbackTools                []FallbackToolConfig `json:"fallbackTools,omitempty"                yaml:"fallbackTools,omitempty"`
+}
+
+// StartupProbeConfig is how the broker checks an upstream until it first connects to it
+type StartupProbeConfig struct {
+	Period           string `json:"period,omitempty"           yaml:"period,omitempty"`
+	Timeout          string `json:"timeout,omitempty"          yaml:"timeout,omitempty"`
+	FailureThreshold int    `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+}
+
+// FallbackToolConfig is a tool advertised while its server is unavailable. InputSchema is a JSON object
+type FallbackToolConfig struct {
+	Name        string `json:"name"                  yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	InputSchema string `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty"`
+}
+
+// ToolCallMetaConfig is how the _meta of tool calls is forwarded to a server. Injected fields are list entries rather
+// than map keys as the config loader lower cases map keys
+type ToolCallMetaConfig struct {
+	Mode   string            `json:"mode,omitempty"   yaml:"mode,omitempty"`
+	Inject []MetaFieldConfig `json:"inject,omitempty" yaml:"inject,omitempty"`
+}
+
+// MetaFieldConfig is a field set in the _meta of a tool call
+type MetaFieldConfig struct {
+	Name  string `json:"name"  yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// ToolRename rewrites the parts of a tool name matching the regular expression in Match with Replace
+type ToolRename struct {
+	Match   string `json:"match"             yaml:"match"`
+	Replace string `json:"replace,omitempty" yaml:"replace,omitempty"`
+}
+
+// Credential is a credential value sent to an upstream with the server's main credential
+type Credential struct {
+	Value    string `json:"value"    yaml:"value"`
+	Location string `json:"location" yaml:"location"`
+}
+
+// TLSConfig holds the TLS settings the broker uses to connect to an upstream
+type TLSConfig struct {
+	CACert     string `json:"caCert,omitempty"     yaml:"caCert,omitempty"`
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	Host       string `json:"host,omitempty"       yaml:"host,omitempty"`
 }
 
 // AuthConfig holds auth configuration
@@ -28,6 +96,18 @@ type AuthConfig struct {
 
 // VirtualServerConfig represents virtual server config
 type VirtualServerConfig struct {
-	Name  string   `json:"name"  yaml:"name"`
-	Tools []string `json:"tools" yaml:"tools"`
+	Name                string   `json:"name"                          yaml:"name"`
+	Tools               []string `json:"tools"                         yaml:"tools"`
+	UnavailableBehavior string   `json:"unavailableBehavior,omitempty" yaml:"unavailableBehavior,omitempty"`
+	Title               string   `json:"title,omitempty"               yaml:"title,omitempty"`
+	Description         string   `json:"description,omitempty"         yaml:"description,omitempty"`
+	// ToolBindings route calls to individual tools to a specific server
+	ToolBindings []ToolBindingConfig `json:"toolBindings,omitempty" yaml:"toolBindings,omitempty"`
+}
+
+// ToolBindingConfig routes calls to a virtual server's tool to the named server. It is a list entry rather than a map
+// key as the config loader lower cases map keys
+type ToolBindingConfig struct {
+	Tool   string `json:"tool"   yaml:"tool"`
+	Server string `json:"server" yaml:"server"`
 }
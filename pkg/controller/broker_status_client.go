@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// BrokerStatus is the part of the broker's /status response the controller uses. It is decoded from the JSON
+// response so the controller does not depend on the broker's types.
+type BrokerStatus struct {
+	Servers []BrokerServerStatus `json:"servers"`
+	// TruncatedServers are the servers with tools left out because the broker's tool limit was reached
+	TruncatedServers []string `json:"truncatedServers,omitempty"`
+}
+
+// BrokerServerStatus is the broker's view of a single upstream MCP server
+type BrokerServerStatus struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Message        string `json:"message"`
+	Ready          bool   `json:"ready"`
+	Reachable      bool   `json:"reachable"`
+	ProtocolValid  bool   `json:"protocolValid"`
+	TotalTools     int    `json:"totalTools"`
+	TruncatedTools int    `json:"truncatedTools,omitempty"`
+	// AdvertisedTools is the number of the server's tools the gateway lists, not counting fallback tools
+	AdvertisedTools int `json:"advertisedTools"`
+	// DroppedTools are the names of the server's tools left out because the broker's tool limit was reached
+	DroppedTools    []string `json:"droppedTools,omitempty"`
+	ReadOnly        bool     `json:"readOnly,omitempty"`
+	HiddenTools     int      `json:"hiddenTools,omitempty"`
+	ConnectionState string   `json:"connectionState"`
+	// FailedAttempts is the number of the broker's connection attempts and health checks of the server that have
+	// failed in a row
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+}
+
+// BrokerStatusClient reads the validation status of the MCP servers from the broker's /status endpoint
+type BrokerStatusClient struct {
+	k8sClient  client.Client
+	httpClient *http.Client
+	namespace  string
+	statusURL  string
+}
+
+// NewBrokerStatusClient creates a client for the broker's /status endpoint. When statusURL is empty the broker
+// pods are discovered from the endpoint slices of the broker service in the NAMESPACE namespace.
+func NewBrokerStatusClient(k8sClient client.Client, statusURL string) *BrokerStatusClient {
+	namespace := os.Getenv("NAMESPACE")
+	if namespace == "" {
+		namespace = "mcp-system"
+	}
+
+	return &BrokerStatusClient{
+		k8sClient: k8sClient,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		namespace: namespace,
+		statusURL: statusURL,
+	}
+}
+
+// Status returns the broker's validation status of the MCP servers
+func (c *BrokerStatusClient) Status(ctx context.Context) (*BrokerStatus, error) {
+	return c.request(ctx, http.MethodGet, "")
+}
+
+// Probe asks the broker to check the server now rather than on its next health check and returns the broker's
+// validation status of the MCP servers once it has
+func (c *BrokerStatusClient) Probe(ctx context.Context, serverID string) (*BrokerStatus, error) {
+	return c.request(ctx, http.MethodPost, "/probe?server="+url.QueryEscape(serverID))
+}
+
+// request sends the request to each broker until one responds with the validation status. The suffix is appended to
+// the /status url
+func (c *BrokerStatusClient) request(ctx context.Context, method, suffix string) (*BrokerStatus, error) {
+	logger := log.FromContext(ctx)
+
+	addresses := []string{c.statusURL}
+	if c.statusURL == "" {
+		var err error
+		addresses, err = c.discoverStatusURLs(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// try each endpoint until we get a successful response
+	for _, addr := range addresses {
+		status, err := c.getStatusFromEndpoint(ctx, method, strings.TrimSuffix(addr, "/")+suffix)
+		if err != nil {
+			logger.Error(err, "Failed to get status from endpoint", "url", addr)
+			continue
+		}
+		logger.V(1).Info("Successfully got status from endpoint", "status", status)
+		return status, nil
+	}
+
+	return nil, fmt.Errorf("failed to get status from any broker endpoint")
+}
+
+// discoverStatusURLs returns the /status url of each ready broker pod
+func (c *BrokerStatusClient) discoverStatusURLs(ctx context.Context) ([]string, error) {
+	logger := log.FromContext(ctx)
+
+	// get endpoint slices for the broker service
+	endpointSliceList := &discoveryv1.EndpointSliceList{}
+	err := c.k8sClient.List(ctx, endpointSliceList, client.InNamespace(c.namespace), client.MatchingLabels{
+		"app.kubernetes.io/component": "mcp-broker",
+	})
+	if err != nil {
+		logger.Error(err, "Failed to get endpoint slices for mcp-broker service")
+		return nil, fmt.Errorf("failed to get endpoint slices: %w", err)
+	}
+
+	// collect all endpoint addresses
+	var addresses []string
+	for _, endpointSlice := range endpointSliceList.Items {
+		for _, endpoint := range endpointSlice.Endpoints {
+			if endpoint.Conditions.Ready != nil && *endpoint.Conditions.Ready {
+				for _, addr := range endpoint.Addresses {
+					// use the status port
+					url := fmt.Sprintf("http://%s/status", net.JoinHostPort(addr, "8080"))
+					addresses = append(addresses, url)
+				}
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		logger.Info("No broker endpoints found, skipping status validation")
+		return nil, fmt.Errorf("no broker endpoints available")
+	}
+	return addresses, nil
+}
+
+func (c *BrokerStatusClient) getStatusFromEndpoint(ctx context.Context, method, endpoint string) (*BrokerStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status %d", resp.StatusCode)
+	}
+
+	var status BrokerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &status, nil
+}
+
+// validationResult is the outcome of the broker's validation for a single MCPServer
+type validationResult struct {
+	// Validated is false until the broker has reported on the server
+	Validated        bool
+	Ready            bool
+	Reachable        bool
+	ProtocolValid    bool
+	Message          string
+	TotalTools       int
+	TruncatedTools   int
+	DroppedTools     []string
+	TruncatedServers []string
+	// AdvertisedTools is the number of the server's tools the gateway lists
+	AdvertisedTools int
+	// ReadOnly is true when the broker enforces the server's read-only setting
+	ReadOnly    bool
+	HiddenTools int
+	// ConnectionState is empty until the broker has reported on the server
+	ConnectionState mcpv1alpha1.ConnectionState
+	// FailedChecks is the number of the broker's health checks of the server that have failed in a row
+	FailedChecks int
+	// Degraded is true when the server is failing health checks but has not yet failed enough of them to be not ready
+	Degraded bool
+}
+
+// evaluateValidationResults finds the server in the broker's status. A server the broker has not validated yet is not ready.
+// A connected server failing its health checks stays ready until the unready threshold of its health thresholds is reached.
+func evaluateValidationResults(status *BrokerStatus, serverID string, thresholds *mcpv1alpha1.HealthThresholds) validationResult {
+	result := validationResult{
+		Message:          "waiting for the broker to validate the server",
+		TruncatedServers: status.TruncatedServers,
+	}
+	for _, server := range status.Servers {
+		if server.ID != serverID {
+			continue
+		}
+		result.Validated = true
+		result.Ready = server.Ready
+		result.Reachable = server.Reachable
+		result.ProtocolValid = server.ProtocolValid
+		result.Message = server.Message
+		result.TotalTools = server.TotalTools
+		result.TruncatedTools = server.TruncatedTools
+		result.DroppedTools = server.DroppedTools
+		result.AdvertisedTools = server.AdvertisedTools
+		result.ReadOnly = server.ReadOnly
+		result.HiddenTools = server.HiddenTools
+		result.ConnectionState = mcpv1alpha1.ConnectionState(server.ConnectionState)
+		result.FailedChecks = server.FailedAttempts
+		break
+	}
+	applyHealthThresholds(&result, thresholds)
+	return result
+}
+
+// applyHealthThresholds keeps a server that lost its connection ready while fewer of its health checks have failed
+// than the unready threshold, and marks it degraded once the degraded threshold is reached. A server that has never
+// connected, or that is not ready for a reason other than failed health checks, is left as it is.
+func applyHealthThresholds(result *validationResult, thresholds *mcpv1alpha1.HealthThresholds) {
+	if result.Ready || result.FailedChecks == 0 {
+		return
+	}
+	if result.ConnectionState != mcpv1alpha1.ConnectionStateReconnecting && result.ConnectionState != mcpv1alpha1.ConnectionStateFailed {
+		return
+	}
+	degradedAfter, unreadyAfter := thresholds.WithDefaults()
+	if result.FailedChecks >= int(unreadyAfter) {
+		return
+	}
+	result.Ready = true
+	result.Degraded = result.FailedChecks >= int(degradedAfter)
+	result.Message = fmt.Sprintf("health checks failing (%d of %d failures before the server is not ready): %s", result.FailedChecks, unreadyAfter, result.Message)
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBrokerStatusClient(t *testing.T) {
+	// the response is shaped like the broker's with fields the controller does not use
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"servers": [
+				{"id": "mcp-test/weather:w_:weather.mcp.local", "name": "mcp-test/weather", "message": "server added successfully. Total tools added 3", "ready": true, "reachable": true, "protocolValid": true, "totalTools": 3, "truncatedTools": 1, "advertisedTools": 2, "droppedTools": ["w_alerts"], "connectionState": "Connected", "failedAttempts": 0, "lastValidated": "2026-01-01T00:00:00Z"},
+				{"id": "mcp-test/broken:b_:broken.mcp.local", "name": "mcp-test/broken", "message": "failed to connect to upstream mcp: unsupported protocol version", "ready": false, "reachable": true, "protocolValid": false, "connectionState": "Reconnecting", "failedAttempts": 1, "lastValidated": "2026-01-01T00:00:00Z"}
+			],
+			"overallValid": false,
+			"totalServers": 2,
+			"truncatedServers": ["mcp-test/weather"],
+			"timestamp": "2026-01-01T00:00:00Z"
+		}`))
+	}))
+	defer stub.Close()
+
+	status, err := NewBrokerStatusClient(fake.NewClientBuilder().WithScheme(testScheme(t)).Build(), stub.URL+"/status").Status(context.Background())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name     string
+		ServerID string
+		Expected validationResult
+	}{
+		{
+			Name:     "ready server with truncated tools",
+			ServerID: "mcp-test/weather:w_:weather.mcp.local",
+			Expected: validationResult{
+				Validated:        true,
+				Ready:            true,
+				Reachable:        true,
+				ProtocolValid:    true,
+				Message:          "server added successfully. Total tools added 3",
+				TotalTools:       3,
+				TruncatedTools:   1,
+				AdvertisedTools:  2,
+				DroppedTools:     []string{"w_alerts"},
+				TruncatedServers: []string{"mcp-test/weather"},
+				ConnectionState:  mcpv1alpha1.ConnectionStateConnected,
+			},
+		},
+		{
+			Name:     "server that failed validation",
+			ServerID: "mcp-test/broken:b_:broken.mcp.local",
+			Expected: validationResult{
+				Validated:        true,
+				Reachable:        true,
+				Message:          "failed to connect to upstream mcp: unsupported protocol version",
+				TruncatedServers: []string{"mcp-test/weather"},
+				ConnectionState:  mcpv1alpha1.ConnectionStateReconnecting,
+				FailedChecks:     1,
+			},
+		},
+		{
+			Name:     "server not yet known to the broker",
+			ServerID: "mcp-test/new:n_:new.mcp.local",
+			Expected: validationResult{
+				Message:          "waiting for the broker to validate the server",
+				TruncatedServers: []string{"mcp-test/weather"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, evaluateValidationResults(status, tc.ServerID, nil))
+		})
+	}
+}
+
+func TestEvaluateValidationResultsHealthThresholds(t *testing.T) {
+	// the same failure pattern is reported differently depending on the server's thresholds
+	failing := func(state mcpv1alpha1.ConnectionState, failedAttempts int) *BrokerStatus {
+		return &BrokerStatus{Servers: []BrokerServerStatus{{
+			ID:              "mcp-test/weather:w_:weather.mcp.local",
+			Message:         "ping failed: connection refused",
+			ConnectionState: string(state),
+			FailedAttempts:  failedAttempts,
+		}}}
+	}
+	testCases := []struct {
+		Name           string
+		Status         *BrokerStatus
+		Thresholds     *mcpv1alpha1.HealthThresholds
+		ExpectReady    bool
+		ExpectDegraded bool
+	}{
+		{
+			Name:   "default thresholds are not ready on the first failure",
+			Status: failing(mcpv1alpha1.ConnectionStateReconnecting, 1),
+		},
+		{
+			Name:        "lenient server stays ready",
+			Status:      failing(mcpv1alpha1.ConnectionStateReconnecting, 2),
+			Thresholds:  &mcpv1alpha1.HealthThresholds{DegradedAfter: 3, UnreadyAfter: 5},
+			ExpectReady: true,
+		},
+		{
+			Name:           "lenient server is degraded",
+			Status:         failing(mcpv1alpha1.ConnectionStateReconnecting, 3),
+			Thresholds:     &mcpv1alpha1.HealthThresholds{DegradedAfter: 3, UnreadyAfter: 5},
+			ExpectReady:    true,
+			ExpectDegraded: true,
+		},
+		{
+			Name:       "lenient server is not ready at its threshold",
+			Status:     failing(mcpv1alpha1.ConnectionStateFailed, 5),
+			Thresholds: &mcpv1alpha1.HealthThresholds{DegradedAfter: 3, UnreadyAfter: 5},
+		},
+		{
+			Name:           "strict server is degraded on the first failure",
+			Status:         failing(mcpv1alpha1.ConnectionStateReconnecting, 1),
+			Thresholds:     &mcpv1alpha1.HealthThresholds{DegradedAfter: 1, UnreadyAfter: 2},
+			ExpectReady:    true,
+			ExpectDegraded: true,
+		},
+		{
+			Name:       "strict server is not ready on the second failure",
+			Status:     failing(mcpv1alpha1.ConnectionStateReconnecting, 2),
+			Thresholds: &mcpv1alpha1.HealthThresholds{DegradedAfter: 1, UnreadyAfter: 2},
+		},
+		{
+			Name:        "unset degraded threshold",
+			Status:      failing(mcpv1alpha1.ConnectionStateReconnecting, 1),
+			Thresholds:  &mcpv1alpha1.HealthThresholds{UnreadyAfter: 3},
+			ExpectReady: true,
+			// the default degraded threshold of 1 applies
+			ExpectDegraded: true,
+		},
+		{
+			Name:       "server that never connected is not ready",
+			Status:     failing(mcpv1alpha1.ConnectionStateNeverConnected, 1),
+			Thresholds: &mcpv1alpha1.HealthThresholds{UnreadyAfter: 5},
+		},
+		{
+			Name:       "server failing for another reason is not ready",
+			Status:     failing(mcpv1alpha1.ConnectionStateConnected, 0),
+			Thresholds: &mcpv1alpha1.HealthThresholds{UnreadyAfter: 5},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			result := evaluateValidationResults(tc.Status, "mcp-test/weather:w_:weather.mcp.local", tc.Thresholds)
+			require.Equal(t, tc.ExpectReady, result.Ready)
+			require.Equal(t, tc.ExpectDegraded, result.Degraded)
+			require.Equal(t, tc.Status.Servers[0].FailedAttempts, result.FailedChecks)
+			require.Contains(t, result.Message, "connection refused")
+		})
+	}
+}
+
+func TestBrokerStatusClientErrors(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	k8sClient := fake.NewClientBuilder().WithScheme(testScheme(t)).Build()
+
+	_, err := NewBrokerStatusClient(k8sClient, unavailable.URL+"/status").Status(context.Background())
+	require.Error(t, err)
+
+	// without a url the broker pods are discovered and there are none
+	_, err = NewBrokerStatusClient(k8sClient, "").Status(context.Background())
+	require.ErrorContains(t, err, "no broker endpoints available")
+}
@@ -3,12 +3,13 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -19,7 +20,13 @@ import (
 	"github.com/kagenti/mcp-gateway/pkg/config"
 )
 
-// ConfigMapWriter writes ConfigMaps
+// ErrConfigOwnedByOther is returned when the aggregated config is managed by a different writer
+var ErrConfigOwnedByOther = errors.New("aggregated config is managed by another owner")
+
+// ConfigMapWriter writes ConfigMaps.
+// The aggregated config has a single owner identified by the SecretManagedByLabel. The writer adopts
+// an unlabelled config but will never overwrite one labelled as managed by a different owner so that
+// two controllers cannot fight over the same config.
 type ConfigMapWriter struct {
 	Client client.Client
 	Scheme *runtime.Scheme
@@ -43,6 +50,7 @@ func (w *ConfigMapWriter) WriteAggregatedConfig(
 			Labels: map[string]string{
 				"app":                        "mcp-gateway",
 				"mcp.kagenti.com/aggregated": "true",
+				SecretManagedByLabel:         SecretManagedByValue,
 			},
 		},
 		StringData: map[string]string{
@@ -60,9 +68,9 @@ func (w *ConfigMapWriter) WriteAggregatedConfig(
 		existing := &corev1.Secret{}
 		err := w.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, existing)
 		if err != nil {
-			if errors.IsNotFound(err) {
+			if apierrors.IsNotFound(err) {
 				err = w.Client.Create(ctx, secret)
-				if errors.IsAlreadyExists(err) {
+				if apierrors.IsAlreadyExists(err) {
 					// Someone else created it, retry
 					return false, nil
 				}
@@ -71,13 +79,17 @@ func (w *ConfigMapWriter) WriteAggregatedConfig(
 			return false, err
 		}
 
+		if owner, ok := existing.Labels[SecretManagedByLabel]; ok && owner != SecretManagedByValue {
+			return false, fmt.Errorf("%w: %s/%s is managed by %q", ErrConfigOwnedByOther, namespace, name, owner)
+		}
+
 		// Only update if data or labels have changed
 		if !equality.Semantic.DeepEqual(existing.StringData, secret.StringData) ||
 			!equality.Semantic.DeepEqual(existing.Labels, secret.Labels) {
 			existing.StringData = secret.StringData
 			existing.Labels = secret.Labels
 			err = w.Client.Update(ctx, existing)
-			if errors.IsConflict(err) {
+			if apierrors.IsConflict(err) {
 				// Resource conflict, retry
 				return false, nil
 			}
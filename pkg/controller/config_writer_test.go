@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/mcp-gateway/pkg/config"
+)
+
+func TestWriteAggregatedConfigOwnership(t *testing.T) {
+	brokerConfig := &config.BrokerConfig{
+		Servers: []config.ServerConfig{{Name: "mcp-test/server", URL: "http://server/mcp", Enabled: true}},
+	}
+	existing := func(labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: ConfigName, Namespace: "mcp-system", Labels: labels},
+			StringData: map[string]string{"config.yaml": "servers: []"},
+		}
+	}
+
+	testCases := []struct {
+		Name        string
+		Existing    []client.Object
+		ExpectErr   error
+		ExpectOwner string
+	}{
+		{
+			Name:        "creates config labelled with owner",
+			ExpectOwner: SecretManagedByValue,
+		},
+		{
+			Name:        "adopts config with no owner",
+			Existing:    []client.Object{existing(map[string]string{"app": "mcp-gateway"})},
+			ExpectOwner: SecretManagedByValue,
+		},
+		{
+			Name:        "updates config it owns",
+			Existing:    []client.Object{existing(map[string]string{SecretManagedByLabel: SecretManagedByValue})},
+			ExpectOwner: SecretManagedByValue,
+		},
+		{
+			Name:        "refuses to overwrite config owned by another writer",
+			Existing:    []client.Object{existing(map[string]string{SecretManagedByLabel: "other-controller"})},
+			ExpectErr:   ErrConfigOwnedByOther,
+			ExpectOwner: "other-controller",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			k8sClient := fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(tc.Existing...).Build()
+			writer := NewSecretWriter(k8sClient, testScheme(t))
+			err := writer.WriteAggregatedConfig(context.Background(), "mcp-system", ConfigName, brokerConfig)
+			if tc.ExpectErr != nil {
+				require.True(t, errors.Is(err, tc.ExpectErr), "expected %v got %v", tc.ExpectErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			secret := &corev1.Secret{}
+			require.NoError(t, k8sClient.Get(context.Background(), types.NamespacedName{Name: ConfigName, Namespace: "mcp-system"}, secret))
+			require.Equal(t, tc.ExpectOwner, secret.Labels[SecretManagedByLabel])
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+)
+
+// ManifestProblem is a misconfiguration found in a set of manifests without a cluster
+type ManifestProblem struct {
+	// Kind and Name identify the object with the problem. Name is namespace/name
+	Kind    string
+	Name    string
+	Message string
+}
+
+func (p ManifestProblem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Name, p.Message)
+}
+
+// ManifestScheme returns a scheme with the types the controller reads
+func ManifestScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := mcpv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// DecodeManifests reads the objects in a multi document YAML stream. Documents that are not Kubernetes objects or are
+// of kinds the controller does not read, such as Gateways, are skipped. Objects without a namespace are put in defaultNamespace as kubectl
+// apply would.
+func DecodeManifests(scheme *runtime.Scheme, r io.Reader, defaultNamespace string) ([]client.Object, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	var objects []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if runtime.IsNotRegisteredError(err) {
+			continue
+		}
+		if runtime.IsMissingKind(err) || runtime.IsMissingVersion(err) {
+			// comments only or a document that is not a kubernetes object, such as a broker config file
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		clientObj, ok := obj.(client.Object)
+		if !ok {
+			continue
+		}
+		if clientObj.GetNamespace() == "" {
+			clientObj.SetNamespace(defaultNamespace)
+		}
+		objects = append(objects, clientObj)
+	}
+}
+
+// ValidateManifests runs the controller's discovery and validation of MCPServers and MCPVirtualServers against the
+// objects without a cluster so misconfigurations are caught before the manifests are applied. The objects the
+// MCPServers reference, such as HTTPRoutes, Services and BackendTLSPolicies, must be among the objects.
+func ValidateManifests(ctx context.Context, scheme *runtime.Scheme, objects []client.Object) ([]ManifestProblem, error) {
+	var (
+		mcpServers        []mcpv1alpha1.MCPServer
+		mcpVirtualServers []mcpv1alpha1.MCPVirtualServer
+		problems          []ManifestProblem
+	)
+	seen := map[string]struct{}{}
+	var unique []client.Object
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%s", gvk.Kind, client.ObjectKeyFromObject(obj))
+		if _, ok := seen[key]; ok {
+			problems = append(problems, ManifestProblem{Kind: gvk.Kind, Name: client.ObjectKeyFromObject(obj).String(), Message: "defined more than once"})
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, obj)
+		switch o := obj.(type) {
+		case *mcpv1alpha1.MCPServer:
+			// the API server would apply the CRD defaults
+			if o.Spec.TargetRef.Group == "" {
+				o.Spec.TargetRef.Group = gatewayv1.GroupName
+			}
+			if o.Spec.TargetRef.Kind == "" {
+				o.Spec.TargetRef.Kind = "HTTPRoute"
+			}
+			mcpServers = append(mcpServers, *o)
+		case *mcpv1alpha1.MCPVirtualServer:
+			mcpVirtualServers = append(mcpVirtualServers, *o)
+		}
+	}
+
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(unique...).Build(),
+		Scheme: scheme,
+	}
+	for i := range mcpServers {
+		if _, err := r.discoverServersFromHTTPRoutes(ctx, &mcpServers[i]); err != nil {
+			problems = append(problems, ManifestProblem{Kind: "MCPServer", Name: client.ObjectKeyFromObject(&mcpServers[i]).String(), Message: err.Error()})
+		}
+	}
+	problems = append(problems, duplicateToolPrefixes(mcpServers)...)
+	for _, mcpVirtualServer := range mcpVirtualServers {
+		_, bindingProblems := virtualServerToolBindings(&mcpVirtualServer, mcpServers)
+		for _, problem := range bindingProblems {
+			problems = append(problems, ManifestProblem{
+				Kind:    "MCPVirtualServer",
+				Name:    client.ObjectKeyFromObject(&mcpVirtualServer).String(),
+				Message: problem,
+			})
+		}
+		for _, tool := range mcpVirtualServer.Spec.Tools {
+			if len(virtualServerBackingServers([]string{tool}, mcpServers)) == 0 {
+				problems = append(problems, ManifestProblem{
+					Kind:    "MCPVirtualServer",
+					Name:    client.ObjectKeyFromObject(&mcpVirtualServer).String(),
+					Message: fmt.Sprintf("tool %s does not match the tool prefix of any MCPServer", tool),
+				})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// duplicateToolPrefixes reports MCPServers sharing a tool prefix or prefix alias. The broker would reject the tools
+// of whichever server registers second if both servers have a tool with the same name
+func duplicateToolPrefixes(mcpServers []mcpv1alpha1.MCPServer) []ManifestProblem {
+	byPrefix := map[string][]types.NamespacedName{}
+	for _, mcpServer := range mcpServers {
+		prefixes := append([]string{mcpServer.Spec.ToolPrefix}, mcpServer.Spec.ToolPrefixAliases...)
+		slices.Sort(prefixes)
+		for _, prefix := range slices.Compact(prefixes) {
+			byPrefix[prefix] = append(byPrefix[prefix], client.ObjectKeyFromObject(&mcpServer))
+		}
+	}
+	var problems []ManifestProblem
+	for _, prefix := range slices.Sorted(maps.Keys(byPrefix)) {
+		names := byPrefix[prefix]
+		if len(names) < 2 {
+			continue
+		}
+		for i, name := range names {
+			others := make([]string, 0, len(names)-1)
+			for j, other := range names {
+				if i != j {
+					others = append(others, other.String())
+				}
+			}
+			problems = append(problems, ManifestProblem{
+				Kind:    "MCPServer",
+				Name:    name.String(),
+				Message: fmt.Sprintf("tool prefix %q is also used by %s so their tools may conflict", prefix, strings.Join(others, ", ")),
+			})
+		}
+	}
+	return problems
+}
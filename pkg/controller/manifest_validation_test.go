@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const validManifests = `
+# the MCP server backing the weather tools
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: weather
+spec:
+  selector:
+    matchLabels:
+      app: weather
+  template:
+    metadata:
+      labels:
+        app: weather
+    spec:
+      containers:
+      - name: weather
+        image: weather:latest
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: weather
+spec:
+  ports:
+  - port: 8080
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: mcp-gateway
+spec:
+  gatewayClassName: istio
+  listeners:
+  - name: mcp
+    port: 8080
+    protocol: HTTP
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: weather
+spec:
+  hostnames:
+  - weather.mcp.local
+  rules:
+  - backendRefs:
+    - name: weather
+      port: 8080
+---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: weather
+spec:
+  toolPrefix: weather_
+  targetRef:
+    name: weather
+---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPVirtualServer
+metadata:
+  name: forecasts
+spec:
+  tools:
+  - weather_forecast
+`
+
+func TestDecodeManifests(t *testing.T) {
+	scheme, err := ManifestScheme()
+	require.NoError(t, err)
+
+	objects, err := DecodeManifests(scheme, strings.NewReader(validManifests+"---\n# nothing here\n---\nservers: []\n"), "mcp-test")
+	require.NoError(t, err)
+	// the comments and broker config documents are skipped
+	require.Len(t, objects, 6)
+	for _, obj := range objects {
+		require.Equal(t, "mcp-test", obj.GetNamespace())
+	}
+
+	_, err = DecodeManifests(scheme, strings.NewReader("apiVersion: v1\nkind: Service\nspec: [\n"), "mcp-test")
+	require.Error(t, err)
+}
+
+func TestValidateManifests(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		Manifests      string
+		ExpectProblems []string
+	}{
+		{
+			Name:      "valid",
+			Manifests: validManifests,
+		},
+		{
+			Name: "missing HTTPRoute",
+			Manifests: `
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: weather
+spec:
+  toolPrefix: weather_
+  targetRef:
+    name: weather
+`,
+			ExpectProblems: []string{"MCPServer mcp-test/weather: HTTPRoute mcp-test/weather not found"},
+		},
+		{
+			Name: "cross namespace target",
+			Manifests: validManifests + `---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: other
+  namespace: other
+spec:
+  toolPrefix: other_
+  targetRef:
+    name: weather
+    namespace: mcp-test
+`,
+			ExpectProblems: []string{"MCPServer other/other: cross-namespace reference to mcp-test/weather not allowed without ReferenceGrant support"},
+		},
+		{
+			Name: "missing Service",
+			Manifests: `
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: weather
+spec:
+  rules:
+  - backendRefs:
+    - name: weather
+      port: 8080
+---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: weather
+spec:
+  toolPrefix: weather_
+  targetRef:
+    name: weather
+`,
+			ExpectProblems: []string{`MCPServer mcp-test/weather: failed to get service weather: services "weather" not found`},
+		},
+		{
+			Name:      "invalid tool rename",
+			Manifests: strings.Replace(validManifests, "  toolPrefix: weather_\n", "  toolPrefix: weather_\n  toolRenames:\n  - match: \"(\"\n    replace: x\n", 1),
+			ExpectProblems: []string{
+				"MCPServer mcp-test/weather: invalid toolRenames[0].match \"(\": error parsing regexp: missing closing ): `(`",
+			},
+		},
+		{
+			Name: "duplicate tool prefix",
+			Manifests: validManifests + `---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: weather-v2
+spec:
+  toolPrefix: weather_
+  targetRef:
+    name: weather
+`,
+			ExpectProblems: []string{
+				`MCPServer mcp-test/weather: tool prefix "weather_" is also used by mcp-test/weather-v2 so their tools may conflict`,
+				`MCPServer mcp-test/weather-v2: tool prefix "weather_" is also used by mcp-test/weather so their tools may conflict`,
+			},
+		},
+		{
+			Name: "tool prefix alias used by another server",
+			Manifests: validManifests + `---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPServer
+metadata:
+  name: forecast
+spec:
+  toolPrefix: forecast_
+  toolPrefixAliases:
+  - weather_
+  targetRef:
+    name: weather
+`,
+			ExpectProblems: []string{
+				`MCPServer mcp-test/forecast: tool prefix "weather_" is also used by mcp-test/weather so their tools may conflict`,
+				`MCPServer mcp-test/weather: tool prefix "weather_" is also used by mcp-test/forecast so their tools may conflict`,
+			},
+		},
+		{
+			Name: "virtual server tool without a server",
+			Manifests: validManifests + `---
+apiVersion: mcp.kagenti.com/v1alpha1
+kind: MCPVirtualServer
+metadata:
+  name: calendar
+spec:
+  tools:
+  - weather_forecast
+  - calendar_list
+`,
+			ExpectProblems: []string{"MCPVirtualServer mcp-test/calendar: tool calendar_list does not match the tool prefix of any MCPServer"},
+		},
+		{
+			Name: "object defined twice",
+			Manifests: validManifests + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: weather
+spec:
+  ports:
+  - port: 9090
+`,
+			ExpectProblems: []string{"Service mcp-test/weather: defined more than once"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			scheme, err := ManifestScheme()
+			require.NoError(t, err)
+			objects, err := DecodeManifests(scheme, strings.NewReader(tc.Manifests), "mcp-test")
+			require.NoError(t, err)
+
+			problems, err := ValidateManifests(context.Background(), scheme, objects)
+			require.NoError(t, err)
+			messages := make([]string, 0, len(problems))
+			for _, problem := range problems {
+				messages = append(messages, problem.String())
+			}
+			require.ElementsMatch(t, tc.ExpectProblems, messages)
+		})
+	}
+}
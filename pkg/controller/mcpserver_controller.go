@@ -3,13 +3,18 @@ package controller
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,7 +26,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
-	"github.com/kagenti/mcp-gateway/internal/broker/upstream"
 	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
 	"github.com/kagenti/mcp-gateway/pkg/config"
 )
@@ -39,8 +43,55 @@ const (
 	CredentialSecretLabel = "mcp.kagenti.com/credential" //nolint:gosec // not a credential, just a label name
 	// CredentialSecretValue is the required value for credential secrets
 	CredentialSecretValue = "true"
+
+	// TenantLabel on an MCPServer sets the tenant owning its tools. Without the label the tenant is the MCPServer's namespace
+	TenantLabel = "mcp.kagenti.com/tenant"
+
+	// ForwardAuthorizationAnnotation set to "true" on an MCPServer forwards the client's Authorization header to the
+	// server instead of replacing it with the configured credential. Only set it for backends trusted with user tokens
+	ForwardAuthorizationAnnotation = "mcp.kagenti.com/forward-authorization"
+
+	// ProbeAnnotation set on an MCPServer makes the controller ask the broker to check the server now rather than on its
+	// next health check. The result is written to the Probed condition and the annotation is then removed
+	ProbeAnnotation = "mcp.kagenti.com/probe"
+
+	// ConditionTooManyTools is set on an MCPServer when some of its tools are not advertised due to the broker tool limit
+	ConditionTooManyTools = "TooManyTools"
+
+	// ConditionReadOnly is set on a read-only MCPServer to report the tools hidden because they are not read-only
+	ConditionReadOnly = "ReadOnly"
+
+	// ConditionCordoned is set on a cordoned MCPServer while new sessions to it are refused
+	ConditionCordoned = "Cordoned"
+
+	// ConditionDegraded is set on an MCPServer that is failing health checks but is still ready under its health thresholds
+	ConditionDegraded = "Degraded"
+
+	// ConditionToolsAvailable is true while the gateway lists at least one of the MCPServer's tools, so
+	// kubectl wait --for=condition=ToolsAvailable blocks until clients can use the server
+	ConditionToolsAvailable = "ToolsAvailable"
+
+	// ConditionProbed reports the result of the last probe requested with the ProbeAnnotation
+	ConditionProbed = "Probed"
+
+	// ConditionProgrammed is set on the parent statuses of an HTTPRoute referenced by an MCPServer
+	ConditionProgrammed = "Programmed"
+	// ConditionMCPBackendReachable is set on the parent statuses of an HTTPRoute when the broker can establish an MCP session with its backend
+	ConditionMCPBackendReachable = "MCPBackendReachable"
+	// ConditionMCPProtocolValid is set on the parent statuses of an HTTPRoute when its backend negotiates a supported MCP protocol version
+	ConditionMCPProtocolValid = "MCPProtocolValid"
 )
 
+// httpRouteConditions are the conditions the controller owns on the parent statuses of an HTTPRoute
+var httpRouteConditions = []string{ConditionProgrammed, ConditionMCPBackendReachable, ConditionMCPProtocolValid}
+
+// failingHealthChecksRequeueDelay is how often a server that is still ready while its health checks fail is checked again
+const failingHealthChecksRequeueDelay = 10 * time.Second
+
+// readyRequeueDelay is how often a ready server is checked again so a server that stops serving its tools is reported
+// without waiting for a change to the MCPServer
+const readyRequeueDelay = 30 * time.Second
+
 // getConfigNamespace returns the namespace for config, using NAMESPACE env var or defaulting to mcp-system
 func getConfigNamespace() string {
 	namespace := os.Getenv("NAMESPACE")
@@ -50,6 +101,36 @@ func getConfigNamespace() string {
 	return namespace
 }
 
+// mcpServerTenant returns the tenant owning the MCPServer's tools
+func mcpServerTenant(mcpServer *mcpv1alpha1.MCPServer) string {
+	if tenant := mcpServer.Labels[TenantLabel]; tenant != "" {
+		return tenant
+	}
+	return mcpServer.Namespace
+}
+
+// startupProbeConfig returns the broker config of the MCPServer's startup probe. Settings that are not set are left
+// for the broker to default
+func startupProbeConfig(probe *mcpv1alpha1.StartupProbe) *config.StartupProbeConfig {
+	probeConfig := &config.StartupProbeConfig{FailureThreshold: int(probe.FailureThreshold)}
+	if probe.Period != nil && probe.Period.Duration > 0 {
+		probeConfig.Period = probe.Period.Duration.String()
+	}
+	if probe.Timeout != nil && probe.Timeout.Duration > 0 {
+		probeConfig.Timeout = probe.Timeout.Duration.String()
+	}
+	return probeConfig
+}
+
+// toolCallMetaConfig returns the broker config of how the MCPServer's tool calls carry _meta
+func toolCallMetaConfig(meta *mcpv1alpha1.ToolCallMeta) *config.ToolCallMetaConfig {
+	metaConfig := &config.ToolCallMetaConfig{Mode: meta.Mode}
+	for _, field := range meta.Inject {
+		metaConfig.Inject = append(metaConfig.Inject, config.MetaFieldConfig{Name: field.Name, Value: field.Value})
+	}
+	return metaConfig
+}
+
 // ServerInfo holds server information
 type ServerInfo struct {
 	ID                 string
@@ -59,6 +140,16 @@ type ServerInfo struct {
 	HTTPRouteName      string
 	HTTPRouteNamespace string
 	Credential         string
+	// TLSServerName and CACert are populated from a BackendTLSPolicy targeting the backend service. The MCPServer's
+	// TLSServerName overrides the policy's hostname
+	TLSServerName string
+	CACert        string
+	// TLSHost is the Host header sent to the upstream. It is set from the MCPServer's TLSServerName
+	TLSHost string
+	// PathRewrite is the expanded BackendPathRewrite of the MCPServer
+	PathRewrite string
+	// ToolRenames are the validated ToolRenames of the MCPServer
+	ToolRenames []config.ToolRename
 }
 
 // MCPReconciler reconciles both MCPServer and MCPVirtualServer resources
@@ -66,13 +157,54 @@ type MCPReconciler struct {
 	client.Client
 	Scheme    *runtime.Scheme
 	APIReader client.Reader // uncached reader for fetching secrets
+	// BrokerStatusURL is the url of the broker's /status endpoint. When empty the broker pods are discovered from the broker service
+	BrokerStatusURL string
+	// ServerSelector when set scopes the reconciler to the MCPServers and MCPVirtualServers with matching labels, so a
+	// broker can be given the servers of a single team or tenant. Other resources are left to other reconcilers
+	ServerSelector labels.Selector
+	// ConfigSecretName is the name of the Secret the aggregated config is written to. Defaults to ConfigName
+	ConfigSecretName string
+	// ConfigSecretNamespace is the namespace of the Secret the aggregated config is written to. Defaults to the
+	// NAMESPACE env var or mcp-system
+	ConfigSecretNamespace string
+}
+
+// selects returns true if the reconciler is responsible for the MCPServer or MCPVirtualServer
+func (r *MCPReconciler) selects(obj client.Object) bool {
+	return r.ServerSelector == nil || r.ServerSelector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// selectorListOptions returns the options listing only the MCPServers and MCPVirtualServers the reconciler is responsible for
+func (r *MCPReconciler) selectorListOptions() []client.ListOption {
+	if r.ServerSelector == nil {
+		return nil
+	}
+	return []client.ListOption{client.MatchingLabelsSelector{Selector: r.ServerSelector}}
+}
+
+// configSecretName returns the name of the Secret the aggregated config is written to
+func (r *MCPReconciler) configSecretName() string {
+	if r.ConfigSecretName == "" {
+		return ConfigName
+	}
+	return r.ConfigSecretName
+}
+
+// configSecretNamespace returns the namespace of the Secret the aggregated config is written to
+func (r *MCPReconciler) configSecretNamespace() string {
+	if r.ConfigSecretNamespace == "" {
+		return getConfigNamespace()
+	}
+	return r.ConfigSecretNamespace
 }
 
 // +kubebuilder:rbac:groups=mcp.kagenti.com,resources=mcpservers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=mcp.kagenti.com,resources=mcpservers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=mcp.kagenti.com,resources=mcpvirtualservers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=mcp.kagenti.com,resources=mcpvirtualservers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=backendtlspolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
@@ -91,6 +223,11 @@ func (r *MCPReconciler) Reconcile(
 	mcpServer := &mcpv1alpha1.MCPServer{}
 	err := r.Get(ctx, req.NamespacedName, mcpServer)
 	if err == nil {
+		if !r.selects(mcpServer) {
+			// the server may have just been deselected so the config is regenerated without changing its status
+			log.V(1).Info("MCPServer not selected, regenerating aggregated config", "name", req.Name, "namespace", req.Namespace)
+			return r.regenerateAggregatedConfig(ctx)
+		}
 		return r.reconcileMCPServer(ctx, mcpServer)
 	}
 	if !errors.IsNotFound(err) {
@@ -102,6 +239,10 @@ func (r *MCPReconciler) Reconcile(
 	mcpVirtualServer := &mcpv1alpha1.MCPVirtualServer{}
 	err = r.Get(ctx, req.NamespacedName, mcpVirtualServer)
 	if err == nil {
+		if !r.selects(mcpVirtualServer) {
+			log.V(1).Info("MCPVirtualServer not selected, regenerating aggregated config", "name", req.Name, "namespace", req.Namespace)
+			return r.regenerateAggregatedConfig(ctx)
+		}
 		return r.reconcileMCPVirtualServer(ctx, mcpVirtualServer)
 	}
 	if !errors.IsNotFound(err) {
@@ -123,6 +264,12 @@ func (r *MCPReconciler) reconcileMCPServer(
 	log := log.FromContext(ctx)
 	log.V(1).Info("Reconciling MCPServer", "name", mcpServer.Name, "namespace", mcpServer.Namespace)
 
+	// the cordon only depends on the spec so it is reported even when the server cannot be validated
+	if err := r.updateCordonedCondition(ctx, mcpServer); err != nil {
+		log.Error(err, "Failed to update Cordoned condition")
+		return reconcile.Result{}, err
+	}
+
 	// validate credential secret if configured
 	if mcpServer.Spec.CredentialRef != nil {
 		if err := r.validateCredentialSecret(ctx, mcpServer); err != nil {
@@ -131,7 +278,11 @@ func (r *MCPReconciler) reconcileMCPServer(
 			if _, configErr := r.regenerateAggregatedConfig(ctx); configErr != nil {
 				log.Error(configErr, "Failed to regenerate config after credential validation error")
 			}
-			return reconcile.Result{}, r.updateStatus(ctx, mcpServer, false, fmt.Sprintf("Credential validation failed: %v", err), 0)
+			message := fmt.Sprintf("Credential validation failed: %v", err)
+			if err := r.updateToolsAvailableCondition(ctx, mcpServer, validationResult{Validated: true, Message: message}); err != nil {
+				log.Error(err, "Failed to update ToolsAvailable condition")
+			}
+			return reconcile.Result{}, r.updateStatus(ctx, mcpServer, false, message, 0)
 		}
 		log.V(1).Info("Credential validation success ", "credential ref", mcpServer.Spec.CredentialRef)
 	}
@@ -143,11 +294,24 @@ func (r *MCPReconciler) reconcileMCPServer(
 		if _, configErr := r.regenerateAggregatedConfig(ctx); configErr != nil {
 			log.Error(configErr, "Failed to regenerate config after discovery error")
 		}
+		if err := r.updateToolsAvailableCondition(ctx, mcpServer, validationResult{Validated: true, Message: err.Error()}); err != nil {
+			log.Error(err, "Failed to update ToolsAvailable condition")
+		}
 		return reconcile.Result{}, r.updateStatus(ctx, mcpServer, false, err.Error(), 0)
 	}
 
-	validator := NewServerValidator(r.Client)
-	statusResponse, err := validator.ValidateServers(ctx)
+	statusClient := NewBrokerStatusClient(r.Client, r.BrokerStatusURL)
+	var statusResponse *BrokerStatus
+	if probeRequested(mcpServer) {
+		if statusResponse, err = r.probe(ctx, statusClient, mcpServer, serverInfo.ID); err != nil {
+			log.Error(err, "Failed to record probe")
+			return reconcile.Result{}, err
+		}
+	}
+	// a failed probe is reported in the Probed condition and the status of the last health check is used instead
+	if statusResponse == nil {
+		statusResponse, err = statusClient.Status(ctx)
+	}
 	if err != nil {
 		log.Error(err, "Failed to validate server status via broker")
 		ready, message := false, fmt.Sprintf("Validation failed: %v", err)
@@ -155,23 +319,46 @@ func (r *MCPReconciler) reconcileMCPServer(
 			log.Error(err, "Failed to update status")
 			return reconcile.Result{}, err
 		}
-		return r.regenerateAggregatedConfig(ctx)
-	}
-
-	var serverStatus upstream.ServerValidationStatus
-	for _, sr := range statusResponse.Servers {
-		if sr.ID == serverInfo.ID {
-			serverStatus = sr
-			break
+		// the broker could not be asked so whether the tools are listed is unknown
+		if err := r.updateToolsAvailableCondition(ctx, mcpServer, validationResult{Message: message}); err != nil {
+			log.Error(err, "Failed to update ToolsAvailable condition")
+			return reconcile.Result{}, err
 		}
+		return r.regenerateAggregatedConfig(ctx)
 	}
 
+	serverStatus := evaluateValidationResults(statusResponse, serverInfo.ID, mcpServer.Spec.HealthThresholds)
 	if err := r.updateStatus(ctx, mcpServer, serverStatus.Ready, serverStatus.Message, serverStatus.TotalTools); err != nil {
 		log.Error(err, "Failed to update status")
 		return reconcile.Result{}, err
 	}
 
-	if err := r.updateHTTPRouteStatus(ctx, mcpServer, true); err != nil {
+	if err := r.updateConnectionState(ctx, mcpServer, serverStatus.ConnectionState); err != nil {
+		log.Error(err, "Failed to update connection state")
+		return reconcile.Result{}, err
+	}
+
+	if err := r.updateDegradedCondition(ctx, mcpServer, serverStatus); err != nil {
+		log.Error(err, "Failed to update Degraded condition")
+		return reconcile.Result{}, err
+	}
+
+	if err := r.updateToolsAvailableCondition(ctx, mcpServer, serverStatus); err != nil {
+		log.Error(err, "Failed to update ToolsAvailable condition")
+		return reconcile.Result{}, err
+	}
+
+	if err := r.updateTooManyToolsCondition(ctx, mcpServer, serverStatus.TruncatedTools, serverStatus.DroppedTools, serverStatus.TruncatedServers); err != nil {
+		log.Error(err, "Failed to update TooManyTools condition")
+		return reconcile.Result{}, err
+	}
+
+	if err := r.updateReadOnlyCondition(ctx, mcpServer, serverStatus); err != nil {
+		log.Error(err, "Failed to update ReadOnly condition")
+		return reconcile.Result{}, err
+	}
+
+	if err := r.updateHTTPRouteStatus(ctx, mcpServer, true, serverStatus); err != nil {
 		log.Error(err, "Failed to update HTTPRoute status")
 	}
 
@@ -233,7 +420,19 @@ func (r *MCPReconciler) reconcileMCPServer(
 		return reconcile.Result{RequeueAfter: retryAfter}, nil
 	}
 
-	return r.regenerateAggregatedConfig(ctx)
+	// a server kept ready while its health checks fail is checked again so it is reported as not ready once it
+	// reaches its unready threshold
+	if serverStatus.FailedChecks > 0 {
+		if _, err := r.regenerateAggregatedConfig(ctx); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: failingHealthChecksRequeueDelay}, nil
+	}
+
+	if _, err := r.regenerateAggregatedConfig(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: readyRequeueDelay}, nil
 }
 
 // reconcileMCPVirtualServer handles MCPVirtualServer reconciliation
@@ -244,8 +443,11 @@ func (r *MCPReconciler) reconcileMCPVirtualServer(
 	log := log.FromContext(ctx)
 	log.V(1).Info("Reconciling MCPVirtualServer", "name", mcpVirtualServer.Name, "namespace", mcpVirtualServer.Namespace)
 
-	// For now, just trigger config regeneration like the existing logic
-	// This keeps the same behavior as before
+	if err := r.updateVirtualServerStatus(ctx, mcpVirtualServer); err != nil {
+		log.Error(err, "Failed to update MCPVirtualServer status")
+		return reconcile.Result{}, err
+	}
+
 	return r.regenerateAggregatedConfig(ctx)
 }
 
@@ -255,19 +457,28 @@ func (r *MCPReconciler) regenerateAggregatedConfig(
 	log := log.FromContext(ctx)
 
 	mcpServerList := &mcpv1alpha1.MCPServerList{}
-	if err := r.List(ctx, mcpServerList); err != nil {
+	if err := r.List(ctx, mcpServerList, r.selectorListOptions()...); err != nil {
 		log.Error(err, "Failed to list MCPServers")
 		return reconcile.Result{}, err
 	}
 
 	mcpVirtualServerList := &mcpv1alpha1.MCPVirtualServerList{}
-	if err := r.List(ctx, mcpVirtualServerList); err != nil {
+	if err := r.List(ctx, mcpVirtualServerList, r.selectorListOptions()...); err != nil {
 		log.Error(err, "Failed to list MCPVirtualServers")
 		return reconcile.Result{}, err
 	}
 
+	// HTTPRoutes referenced by servers other reconcilers are responsible for are not orphaned
+	referencingServers := mcpServerList
+	if r.ServerSelector != nil {
+		referencingServers = &mcpv1alpha1.MCPServerList{}
+		if err := r.List(ctx, referencingServers); err != nil {
+			log.Error(err, "Failed to list MCPServers")
+			return reconcile.Result{}, err
+		}
+	}
 	referencedHTTPRoutes := make(map[string]struct{})
-	for _, mcpServer := range mcpServerList.Items {
+	for _, mcpServer := range referencingServers.Items {
 		targetRef := mcpServer.Spec.TargetRef
 		if targetRef.Kind == "HTTPRoute" {
 			namespace := mcpServer.Namespace
@@ -297,6 +508,8 @@ func (r *MCPReconciler) regenerateAggregatedConfig(
 		VirtualServers: []config.VirtualServerConfig{},
 	}
 
+	// the names the MCPServers are configured with so virtual servers can bind tools to them
+	serverNames := map[types.NamespacedName]string{}
 	for _, mcpServer := range mcpServerList.Items {
 
 		serverInfo, err := r.discoverServersFromHTTPRoutes(ctx, &mcpServer)
@@ -313,11 +526,72 @@ func (r *MCPReconciler) regenerateAggregatedConfig(
 			serverInfo.HTTPRouteName,
 		)
 		serverConfig := config.ServerConfig{
-			Name:       serverName,
-			URL:        serverInfo.Endpoint,
-			Hostname:   serverInfo.Hostname,
-			ToolPrefix: serverInfo.ToolPrefix,
-			Enabled:    true,
+			Name:              serverName,
+			URL:               serverInfo.Endpoint,
+			Hostname:          serverInfo.Hostname,
+			ToolPrefix:        serverInfo.ToolPrefix,
+			ToolPrefixAliases: mcpServer.Spec.ToolPrefixAliases,
+			Enabled:           true,
+			PathRewrite:       serverInfo.PathRewrite,
+			Priority:          int(mcpServer.Spec.Priority),
+			ToolRenames:       serverInfo.ToolRenames,
+			Tenant:            mcpServerTenant(&mcpServer),
+
+			MaxUpstreamSessions:          int(mcpServer.Spec.MaxUpstreamSessions),
+			UpstreamSessionLimitBehavior: mcpServer.Spec.UpstreamSessionLimitBehavior,
+			MaxConcurrentToolCalls:       int(mcpServer.Spec.MaxConcurrentToolCalls),
+			MaxResponseBytes:             mcpServer.Spec.MaxResponseBytes,
+			ReadOnly:                     mcpServer.Spec.ReadOnly,
+			Cordoned:                     mcpServer.Spec.Cordoned,
+			ForwardAuthorization:         mcpServer.Annotations[ForwardAuthorizationAnnotation] == "true",
+		}
+		if maxAge := mcpServer.Spec.UpstreamSessionMaxAge; maxAge != nil && maxAge.Duration > 0 {
+			serverConfig.UpstreamSessionMaxAge = maxAge.Duration.String()
+		}
+		if probe := mcpServer.Spec.StartupProbe; probe != nil {
+			serverConfig.StartupProbe = startupProbeConfig(probe)
+		}
+		for _, tool := range mcpServer.Spec.FallbackTools {
+			fallbackTool := config.FallbackToolConfig{Name: tool.Name, Description: tool.Description}
+			if tool.InputSchema != nil {
+				fallbackTool.InputSchema = string(tool.InputSchema.Raw)
+			}
+			serverConfig.FallbackTools = append(serverConfig.FallbackTools, fallbackTool)
+		}
+		if meta := mcpServer.Spec.ToolCallMeta; meta != nil {
+			serverConfig.ToolCallMeta = toolCallMetaConfig(meta)
+		}
+		for tool, timeout := range mcpServer.Spec.ToolTimeouts {
+			if timeout.Duration <= 0 {
+				log.Info("ignoring tool timeout that is not greater than 0", "name", mcpServer.Name, "tool", tool, "timeout", timeout.Duration)
+				continue
+			}
+			if serverConfig.ToolTimeouts == nil {
+				serverConfig.ToolTimeouts = map[string]string{}
+			}
+			serverConfig.ToolTimeouts[tool] = timeout.Duration.String()
+		}
+		for tool, arguments := range mcpServer.Spec.ToolDefaultArguments {
+			if len(arguments.Raw) == 0 {
+				continue
+			}
+			if serverConfig.ToolDefaultArguments == nil {
+				serverConfig.ToolDefaultArguments = map[string]string{}
+			}
+			serverConfig.ToolDefaultArguments[tool] = string(arguments.Raw)
+		}
+		for tool, weight := range mcpServer.Spec.ToolWeights {
+			if serverConfig.ToolWeights == nil {
+				serverConfig.ToolWeights = map[string]int{}
+			}
+			serverConfig.ToolWeights[tool] = int(weight)
+		}
+		if serverInfo.TLSServerName != "" {
+			serverConfig.TLS = &config.TLSConfig{
+				CACert:     serverInfo.CACert,
+				ServerName: serverInfo.TLSServerName,
+				Host:       serverInfo.TLSHost,
+			}
 		}
 
 		// add credential env var if configured
@@ -338,20 +612,49 @@ func (r *MCPReconciler) regenerateAggregatedConfig(
 				continue
 			}
 			serverConfig.Credential = string(val)
-
+			serverConfig.CredentialLocation = mcpServer.Spec.CredentialLocation
+			for _, additional := range mcpServer.Spec.CredentialRef.AdditionalKeys {
+				val, ok := secret.Data[additional.Key]
+				if !ok {
+					log.V(1).Info("the secret had no additional key ", "specified key", additional.Key)
+					continue
+				}
+				serverConfig.AdditionalCredentials = append(serverConfig.AdditionalCredentials, config.Credential{
+					Value:    string(val),
+					Location: additional.Location,
+				})
+			}
 		}
 
 		brokerConfig.Servers = append(brokerConfig.Servers, serverConfig)
-
+		serverNames[client.ObjectKeyFromObject(&mcpServer)] = serverName
 	}
 
 	// Process MCPVirtualServer resources
 	for _, mcpVirtualServer := range mcpVirtualServerList.Items {
 		virtualServerName := fmt.Sprintf("%s/%s", mcpVirtualServer.Namespace, mcpVirtualServer.Name)
-		brokerConfig.VirtualServers = append(brokerConfig.VirtualServers, config.VirtualServerConfig{
-			Name:  virtualServerName,
-			Tools: mcpVirtualServer.Spec.Tools,
-		})
+		virtualServerConfig := config.VirtualServerConfig{
+			Name:                virtualServerName,
+			Tools:               mcpVirtualServer.Spec.Tools,
+			UnavailableBehavior: string(mcpVirtualServer.Spec.UnavailableBehavior),
+			Title:               mcpVirtualServer.Spec.Title,
+			Description:         mcpVirtualServer.Spec.Description,
+		}
+		// invalid bindings are reported in the virtual server's status and left out
+		bindings, problems := virtualServerToolBindings(&mcpVirtualServer, mcpServerList.Items)
+		for _, problem := range problems {
+			log.Info("ignoring invalid tool binding", "name", virtualServerName, "problem", problem)
+		}
+		for _, tool := range slices.Sorted(maps.Keys(bindings)) {
+			mcpServer := bindings[tool]
+			serverName, ok := serverNames[client.ObjectKeyFromObject(&mcpServer)]
+			if !ok {
+				// the server's endpoint could not be discovered so it is not configured
+				continue
+			}
+			virtualServerConfig.ToolBindings = append(virtualServerConfig.ToolBindings, config.ToolBindingConfig{Tool: tool, Server: serverName})
+		}
+		brokerConfig.VirtualServers = append(brokerConfig.VirtualServers, virtualServerConfig)
 	}
 
 	if err := r.writeAggregatedConfig(ctx, brokerConfig); err != nil {
@@ -375,7 +678,7 @@ func (r *MCPReconciler) writeAggregatedConfig(
 	brokerConfig *config.BrokerConfig,
 ) error {
 	writer := NewSecretWriter(r.Client, r.Scheme)
-	return writer.WriteAggregatedConfig(ctx, getConfigNamespace(), ConfigName, brokerConfig)
+	return writer.WriteAggregatedConfig(ctx, r.configSecretNamespace(), r.configSecretName(), brokerConfig)
 }
 
 func (r *MCPReconciler) discoverServersFromHTTPRoutes(
@@ -524,9 +827,45 @@ func (r *MCPReconciler) discoverServersFromHTTPRoutes(
 		}
 	}
 
+	// a BackendTLSPolicy targeting the service is the authoritative signal that the upstream expects TLS
+	tlsPolicy, err := r.findBackendTLSPolicy(ctx, service, backendRef.Port)
+	if err != nil {
+		return nil, err
+	}
+	var tlsServerName, caCert string
+	if tlsPolicy != nil {
+		protocol = "https"
+		tlsServerName = string(tlsPolicy.Spec.Validation.Hostname)
+		caCert, err = r.backendTLSPolicyCACert(ctx, tlsPolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the override is for upstreams whose certificate is not for the name they are reached by, it means nothing without tls
+	var tlsHost string
+	if mcpServer.Spec.TLSServerName != "" {
+		if protocol == "https" {
+			tlsServerName = mcpServer.Spec.TLSServerName
+			tlsHost = mcpServer.Spec.TLSServerName
+		} else {
+			log.FromContext(ctx).Info("ignoring tlsServerName as the upstream is not reached over https", "MCPServer", mcpServer.Name, "MCPServerNamespace", mcpServer.Namespace)
+		}
+	}
+
 	path := mcpServer.Spec.Path
 	endpoint := fmt.Sprintf("%s://%s%s", protocol, nameAndEndpoint, path)
 
+	pathRewrite, err := expandBackendPathRewrite(mcpServer.Spec.BackendPathRewrite, path)
+	if err != nil {
+		return nil, err
+	}
+
+	toolRenames, err := validateToolRenames(mcpServer.Spec.ToolRenames)
+	if err != nil {
+		return nil, err
+	}
+
 	// external services need actual hostname for routing
 	routingHostname := hostname
 	if isExternal {
@@ -546,10 +885,132 @@ func (r *MCPReconciler) discoverServersFromHTTPRoutes(
 		HTTPRouteName:      targetRef.Name,
 		HTTPRouteNamespace: namespace,
 		Credential:         "",
+		TLSServerName:      tlsServerName,
+		CACert:             caCert,
+		TLSHost:            tlsHost,
+		PathRewrite:        pathRewrite,
+		ToolRenames:        toolRenames,
 	}
 	return &serverInfo, nil
 }
 
+// validateToolRenames checks each match is a valid regular expression as this cannot be checked by the CRD schema
+func validateToolRenames(renames []mcpv1alpha1.ToolRename) ([]config.ToolRename, error) {
+	if len(renames) == 0 {
+		return nil, nil
+	}
+	result := make([]config.ToolRename, 0, len(renames))
+	for i, rename := range renames {
+		if _, err := regexp.Compile(rename.Match); err != nil {
+			return nil, fmt.Errorf("invalid toolRenames[%d].match %q: %w", i, rename.Match, err)
+		}
+		result = append(result, config.ToolRename{Match: rename.Match, Replace: rename.Replace})
+	}
+	return result, nil
+}
+
+// expandBackendPathRewrite replaces the {path} placeholder in the rewrite with the server path
+// and checks the result is usable as an upstream :path header
+func expandBackendPathRewrite(rewrite, path string) (string, error) {
+	if rewrite == "" {
+		return "", nil
+	}
+	expanded := strings.ReplaceAll(rewrite, "{path}", path)
+	if !strings.HasPrefix(expanded, "/") {
+		return "", fmt.Errorf("invalid backendPathRewrite %q: must be an absolute path", rewrite)
+	}
+	if strings.ContainsAny(expanded, "?#{} \t\r\n") {
+		return "", fmt.Errorf(
+			"invalid backendPathRewrite %q: must not contain a query, fragment, whitespace or unknown placeholder",
+			rewrite,
+		)
+	}
+	return expanded, nil
+}
+
+// findBackendTLSPolicy returns the BackendTLSPolicy targeting the given service, if any.
+// A policy with a sectionName only applies when it matches the name of the referenced service port.
+func (r *MCPReconciler) findBackendTLSPolicy(
+	ctx context.Context,
+	service *corev1.Service,
+	port *gatewayv1.PortNumber,
+) (*gatewayv1.BackendTLSPolicy, error) {
+	policyList := &gatewayv1.BackendTLSPolicyList{}
+	if err := r.List(ctx, policyList, client.InNamespace(service.Namespace)); err != nil {
+		if meta.IsNoMatchError(err) {
+			// BackendTLSPolicy CRD is not installed
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list BackendTLSPolicies: %w", err)
+	}
+
+	portName := ""
+	for _, servicePort := range service.Spec.Ports {
+		if port != nil && servicePort.Port == *port {
+			portName = servicePort.Name
+			break
+		}
+	}
+
+	for i := range policyList.Items {
+		policy := &policyList.Items[i]
+		for _, targetRef := range policy.Spec.TargetRefs {
+			if targetRef.Group != "" || targetRef.Kind != "Service" || string(targetRef.Name) != service.Name {
+				continue
+			}
+			if targetRef.SectionName != nil && string(*targetRef.SectionName) != portName {
+				continue
+			}
+			return policy, nil
+		}
+	}
+	return nil, nil
+}
+
+// backendTLSPolicyCACert reads the CA bundle referenced by a BackendTLSPolicy. The certificates of every
+// referenced ConfigMap are combined into one PEM bundle so the upstream may present a certificate issued by any of
+// them. Only ConfigMaps with a ca.crt key are supported. An empty value means the system CA pool should be used.
+func (r *MCPReconciler) backendTLSPolicyCACert(
+	ctx context.Context,
+	policy *gatewayv1.BackendTLSPolicy,
+) (string, error) {
+	caCerts := make([]string, 0, len(policy.Spec.Validation.CACertificateRefs))
+	for _, ref := range policy.Spec.Validation.CACertificateRefs {
+		if ref.Group != "" || ref.Kind != "ConfigMap" {
+			return "", fmt.Errorf(
+				"BackendTLSPolicy %s/%s references unsupported CA certificate kind %q",
+				policy.Namespace,
+				policy.Name,
+				ref.Kind,
+			)
+		}
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Name:      string(ref.Name),
+			Namespace: policy.Namespace,
+		}, configMap); err != nil {
+			return "", fmt.Errorf("failed to get CA certificate ConfigMap %s/%s: %w", policy.Namespace, ref.Name, err)
+		}
+		caCert, ok := configMap.Data["ca.crt"]
+		if !ok {
+			return "", fmt.Errorf("CA certificate ConfigMap %s/%s is missing key ca.crt", policy.Namespace, ref.Name)
+		}
+		caCerts = append(caCerts, caCert)
+	}
+	if len(caCerts) <= 1 {
+		return strings.Join(caCerts, ""), nil
+	}
+	// each bundle ends with a newline so the next one's first certificate starts on its own line
+	var bundle strings.Builder
+	for _, caCert := range caCerts {
+		bundle.WriteString(caCert)
+		if !strings.HasSuffix(caCert, "\n") {
+			bundle.WriteString("\n")
+		}
+	}
+	return bundle.String(), nil
+}
+
 func (r *MCPReconciler) cleanupOrphanedHTTPRoutes(
 	ctx context.Context,
 	referencedHTTPRoutes map[string]struct{},
@@ -568,25 +1029,17 @@ func (r *MCPReconciler) cleanupOrphanedHTTPRoutes(
 			continue
 		}
 
-		hasProgrammedCondition := false
 		updateNeeded := false
-		for i, parentStatus := range httpRoute.Status.Parents {
-			newConditions := []metav1.Condition{}
-			for _, condition := range parentStatus.Conditions {
-				if condition.Type == "Programmed" && condition.Status == metav1.ConditionTrue {
-					hasProgrammedCondition = true
+		for i := range httpRoute.Status.Parents {
+			for _, conditionType := range httpRouteConditions {
+				if meta.RemoveStatusCondition(&httpRoute.Status.Parents[i].Conditions, conditionType) {
 					updateNeeded = true
-				} else {
-					newConditions = append(newConditions, condition)
 				}
 			}
-			if updateNeeded {
-				httpRoute.Status.Parents[i].Conditions = newConditions
-			}
 		}
 
-		if hasProgrammedCondition {
-			log.Info("Cleaning up Programmed condition on orphaned HTTPRoute",
+		if updateNeeded {
+			log.Info("Cleaning up MCP conditions on orphaned HTTPRoute",
 				"HTTPRoute", httpRoute.Name,
 				"namespace", httpRoute.Namespace)
 
@@ -601,10 +1054,14 @@ func (r *MCPReconciler) cleanupOrphanedHTTPRoutes(
 	return nil
 }
 
+// updateHTTPRouteStatus sets the Programmed condition and the MCP conditions from the broker's validation on every
+// parent status of the HTTPRoute targeted by the MCPServer. The MCP conditions describe the route's backend so they
+// are the same whichever MCPServer referencing the route last reconciled.
 func (r *MCPReconciler) updateHTTPRouteStatus(
 	ctx context.Context,
 	mcpServer *mcpv1alpha1.MCPServer,
 	affected bool,
+	validation validationResult,
 ) error {
 	log := log.FromContext(ctx)
 	targetRef := mcpServer.Spec.TargetRef
@@ -631,9 +1088,8 @@ func (r *MCPReconciler) updateHTTPRouteStatus(
 	}
 
 	condition := metav1.Condition{
-		Type:               "Programmed",
+		Type:               ConditionProgrammed,
 		ObservedGeneration: httpRoute.Generation,
-		LastTransitionTime: metav1.Now(),
 	}
 
 	if affected {
@@ -646,33 +1102,37 @@ func (r *MCPReconciler) updateHTTPRouteStatus(
 		condition.Reason = "NotInUse"
 		condition.Message = "HTTPRoute is not referenced by any MCPServer"
 	}
-
-	found := false
-	for i, cond := range httpRoute.Status.Parents {
-		conditionFound := false
-		for j, c := range cond.Conditions {
-			if c.Type == condition.Type {
-				httpRoute.Status.Parents[i].Conditions[j] = condition
-				conditionFound = true
-				break
-			}
-		}
-		if !conditionFound {
-			httpRoute.Status.Parents[i].Conditions = append(
-				httpRoute.Status.Parents[i].Conditions,
-				condition,
-			)
-		}
-		found = true
+	conditions := []metav1.Condition{condition}
+	if affected {
+		conditions = append(conditions, mcpHTTPRouteConditions(validation, httpRoute.Generation)...)
 	}
 
-	if !found {
+	if len(httpRoute.Status.Parents) == 0 {
 		log.Info("HTTPRoute has no parent statuses, skipping condition update",
 			"HTTPRoute", httpRoute.Name,
 			"namespace", httpRoute.Namespace)
 		return nil
 	}
 
+	changed := false
+	for i := range httpRoute.Status.Parents {
+		for _, c := range conditions {
+			if meta.SetStatusCondition(&httpRoute.Status.Parents[i].Conditions, c) {
+				changed = true
+			}
+		}
+		if !affected {
+			for _, conditionType := range []string{ConditionMCPBackendReachable, ConditionMCPProtocolValid} {
+				if meta.RemoveStatusCondition(&httpRoute.Status.Parents[i].Conditions, conditionType) {
+					changed = true
+				}
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+
 	if err := r.Status().Update(ctx, httpRoute); err != nil {
 		return fmt.Errorf("failed to update HTTPRoute status: %w", err)
 	}
@@ -685,6 +1145,49 @@ func (r *MCPReconciler) updateHTTPRouteStatus(
 	return nil
 }
 
+// mcpHTTPRouteConditions mirrors the broker's validation of the route's backend as conditions. The protocol
+// version can only be checked once the backend is reachable so it is unknown until then.
+func mcpHTTPRouteConditions(validation validationResult, generation int64) []metav1.Condition {
+	reachable := metav1.Condition{
+		Type:               ConditionMCPBackendReachable,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Pending",
+		Message:            validation.Message,
+		ObservedGeneration: generation,
+	}
+	protocol := metav1.Condition{
+		Type:               ConditionMCPProtocolValid,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Pending",
+		Message:            "The protocol version is checked once the MCP backend is reachable",
+		ObservedGeneration: generation,
+	}
+	if !validation.Validated {
+		return []metav1.Condition{reachable, protocol}
+	}
+
+	if !validation.Reachable {
+		reachable.Status = metav1.ConditionFalse
+		reachable.Reason = "Unreachable"
+		protocol.Reason = "BackendUnreachable"
+		return []metav1.Condition{reachable, protocol}
+	}
+
+	reachable.Status = metav1.ConditionTrue
+	reachable.Reason = "Reachable"
+	reachable.Message = "The broker established an MCP session with the backend"
+	if validation.ProtocolValid {
+		protocol.Status = metav1.ConditionTrue
+		protocol.Reason = "SupportedProtocolVersion"
+		protocol.Message = "The MCP backend negotiated a supported protocol version"
+	} else {
+		protocol.Status = metav1.ConditionFalse
+		protocol.Reason = "UnsupportedProtocolVersion"
+		protocol.Message = validation.Message
+	}
+	return []metav1.Condition{reachable, protocol}
+}
+
 func serverID(httpRoute *gatewayv1.HTTPRoute, mcpServer *mcpv1alpha1.MCPServer, endpoint string) string {
 	return fmt.Sprintf("%s:%s:%s", fmt.Sprintf("%s/%s", httpRoute.Namespace, httpRoute.Name), mcpServer.Spec.ToolPrefix, endpoint)
 }
@@ -745,6 +1248,173 @@ func (r *MCPReconciler) updateStatus(
 	return r.Status().Update(ctx, mcpServer)
 }
 
+// updateConnectionState records the broker's connection to the server so operators can tell a server that never
+// connected apart from one that lost its connection
+func (r *MCPReconciler) updateConnectionState(
+	ctx context.Context,
+	mcpServer *mcpv1alpha1.MCPServer,
+	state mcpv1alpha1.ConnectionState,
+) error {
+	if mcpServer.Status.ConnectionState == state {
+		return nil
+	}
+	mcpServer.Status.ConnectionState = state
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// updateDegradedCondition reports a server that is failing health checks but is kept ready by its health thresholds.
+// The condition is removed once the server's health checks pass again or it is no longer ready.
+func (r *MCPReconciler) updateDegradedCondition(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer, validation validationResult) error {
+	var changed bool
+	if validation.Degraded {
+		_, unreadyAfter := mcpServer.Spec.HealthThresholds.WithDefaults()
+		changed = meta.SetStatusCondition(&mcpServer.Status.Conditions, metav1.Condition{
+			Type:               ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             "HealthChecksFailing",
+			ObservedGeneration: mcpServer.Generation,
+			Message:            fmt.Sprintf("%d consecutive health checks failed, the server is not ready after %d", validation.FailedChecks, unreadyAfter),
+		})
+	} else {
+		changed = meta.RemoveStatusCondition(&mcpServer.Status.Conditions, ConditionDegraded)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// updateToolsAvailableCondition reports whether the gateway lists any of the server's tools. Ready can be true while
+// no tools are listed, for a server kept ready by its health thresholds or one without tools, so this condition is
+// only true when clients can actually see the server's tools. It is unknown until the broker has reported on the
+// server
+func (r *MCPReconciler) updateToolsAvailableCondition(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer, validation validationResult) error {
+	condition := metav1.Condition{
+		Type:               ConditionToolsAvailable,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: mcpServer.Generation,
+		Message:            validation.Message,
+	}
+	switch {
+	case !validation.Validated:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "Pending"
+	case validation.AdvertisedTools > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ToolsAdvertised"
+		condition.Message = fmt.Sprintf("%d tools are advertised by the gateway", validation.AdvertisedTools)
+	case validation.FailedChecks > 0:
+		condition.Reason = "HealthChecksFailing"
+	case !validation.Ready:
+		condition.Reason = "NotReady"
+	case validation.TruncatedTools > 0:
+		condition.Reason = "ToolLimitReached"
+		condition.Message = "none of the server's tools are advertised because the broker tool limit was reached"
+	default:
+		condition.Reason = "NoTools"
+		condition.Message = "the server does not list any tools that are advertised by the gateway"
+	}
+	if !meta.SetStatusCondition(&mcpServer.Status.Conditions, condition) {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// updateTooManyToolsCondition reports when the broker tool limit stops some of the server's tools being advertised
+// and which tools they are. The condition is removed once all of the server's tools are advertised again.
+func (r *MCPReconciler) updateTooManyToolsCondition(
+	ctx context.Context,
+	mcpServer *mcpv1alpha1.MCPServer,
+	truncatedTools int,
+	droppedTools []string,
+	truncatedServers []string,
+) error {
+	var changed bool
+	if truncatedTools > 0 {
+		message := fmt.Sprintf("%d tools are not advertised because the broker tool limit was reached", truncatedTools)
+		if len(droppedTools) > 0 {
+			message += ": " + strings.Join(droppedTools, ", ")
+		}
+		changed = meta.SetStatusCondition(&mcpServer.Status.Conditions, metav1.Condition{
+			Type:               ConditionTooManyTools,
+			Status:             metav1.ConditionTrue,
+			Reason:             "ToolLimitReached",
+			ObservedGeneration: mcpServer.Generation,
+			Message:            fmt.Sprintf("%s. Truncated servers: %s", message, strings.Join(truncatedServers, ", ")),
+		})
+	} else {
+		changed = meta.RemoveStatusCondition(&mcpServer.Status.Conditions, ConditionTooManyTools)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// updateReadOnlyCondition reports whether the read-only setting is enforced by the broker and how many tools it hides.
+// The condition is removed when the server is not read-only.
+func (r *MCPReconciler) updateReadOnlyCondition(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer, validation validationResult) error {
+	var changed bool
+	switch {
+	case !mcpServer.Spec.ReadOnly:
+		changed = meta.RemoveStatusCondition(&mcpServer.Status.Conditions, ConditionReadOnly)
+	case !validation.Ready || !validation.ReadOnly:
+		changed = meta.SetStatusCondition(&mcpServer.Status.Conditions, metav1.Condition{
+			Type:               ConditionReadOnly,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "Pending",
+			ObservedGeneration: mcpServer.Generation,
+			Message:            "waiting for the broker to list the server's tools as read-only",
+		})
+	default:
+		changed = meta.SetStatusCondition(&mcpServer.Status.Conditions, metav1.Condition{
+			Type:               ConditionReadOnly,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Enforced",
+			ObservedGeneration: mcpServer.Generation,
+			Message:            fmt.Sprintf("only read-only tools are advertised and callable. %d tools not annotated as read-only are hidden", validation.HiddenTools),
+		})
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// updateCordonedCondition reports that new sessions to a cordoned server are refused. The condition is removed when
+// the server is uncordoned.
+func (r *MCPReconciler) updateCordonedCondition(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer) error {
+	var changed bool
+	if mcpServer.Spec.Cordoned {
+		changed = meta.SetStatusCondition(&mcpServer.Status.Conditions, metav1.Condition{
+			Type:               ConditionCordoned,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Cordoned",
+			ObservedGeneration: mcpServer.Generation,
+			Message:            "new sessions to the server are refused. Existing sessions continue to be served",
+		})
+	} else {
+		changed = meta.RemoveStatusCondition(&mcpServer.Status.Conditions, ConditionCordoned)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpServer)
+}
+
+// httpRouteHasProgrammedCondition indexes HTTPRoutes by whether the controller has marked them as programmed
+func httpRouteHasProgrammedCondition(rawObj client.Object) []string {
+	httpRoute := rawObj.(*gatewayv1.HTTPRoute)
+	for _, parentStatus := range httpRoute.Status.Parents {
+		for _, condition := range parentStatus.Conditions {
+			if condition.Type == ConditionProgrammed && condition.Status == metav1.ConditionTrue {
+				return []string{"true"}
+			}
+		}
+	}
+	return []string{"false"}
+}
+
 // SetupWithManager sets up the reconciler
 func (r *MCPReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &mcpv1alpha1.MCPServer{}, "spec.targetRef.httproute", func(rawObj client.Object) []string {
@@ -763,25 +1433,21 @@ func (r *MCPReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &gatewayv1.HTTPRoute{}, "status.hasProgrammedCondition", func(rawObj client.Object) []string {
-		httpRoute := rawObj.(*gatewayv1.HTTPRoute)
-		for _, parentStatus := range httpRoute.Status.Parents {
-			for _, condition := range parentStatus.Conditions {
-				if condition.Type == "Programmed" && condition.Status == metav1.ConditionTrue {
-					return []string{"true"}
-				}
-			}
-		}
-		return []string{"false"}
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &gatewayv1.HTTPRoute{}, "status.hasProgrammedCondition", httpRouteHasProgrammedCondition); err != nil {
 		return err
 	}
 
 	controller := ctrl.NewControllerManagedBy(mgr).
-		For(&mcpv1alpha1.MCPServer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		For(&mcpv1alpha1.MCPServer{}, builder.WithPredicates(predicate.Or[client.Object](predicate.GenerationChangedPredicate{}, probeRequestedPredicate()))).
 		Watches(
 			&mcpv1alpha1.MCPVirtualServer{},
 			&handler.EnqueueRequestForObject{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&mcpv1alpha1.MCPServer{},
+			handler.EnqueueRequestsFromMapFunc(r.findMCPVirtualServersForMCPServer),
+			builder.WithPredicates(mcpServerReadyChangedPredicate()),
 		).
 		Watches(
 			&gatewayv1.HTTPRoute{},
@@ -798,6 +1464,20 @@ func (r *MCPReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			})),
 		)
 
+	// BackendTLSPolicy is optional in many Gateway API installs so only watch it when the CRD is present
+	if _, err := mgr.GetRESTMapper().RESTMapping(gatewayv1.SchemeGroupVersion.WithKind("BackendTLSPolicy").GroupKind(), gatewayv1.SchemeGroupVersion.Version); err == nil {
+		controller = controller.Watches(
+			&gatewayv1.BackendTLSPolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.findMCPServersForBackendTLSPolicy),
+		).Watches(
+			// a rotated, removed or deleted CA is picked up without waiting for the policy to change. Only ConfigMaps
+			// referenced by a BackendTLSPolicy are mapped to MCPServers
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.findMCPServersForCAConfigMap),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		)
+	}
+
 	// Perform startup reconciliation to ensure config exists even with zero MCPServers
 	if err := mgr.Add(&startupReconciler{reconciler: r}); err != nil {
 		return err
@@ -834,6 +1514,51 @@ func (r *MCPReconciler) findMCPServersForHTTPRoute(ctx context.Context, obj clie
 	return requests
 }
 
+// findMCPServersForBackendTLSPolicy finds MCPServers in the namespace of the given BackendTLSPolicy
+func (r *MCPReconciler) findMCPServersForBackendTLSPolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	policy := obj.(*gatewayv1.BackendTLSPolicy)
+	log := log.FromContext(ctx).WithValues("BackendTLSPolicy", policy.Name, "namespace", policy.Namespace)
+
+	// policies target services rather than HTTPRoutes so reconcile every MCPServer in the namespace
+	mcpServerList := &mcpv1alpha1.MCPServerList{}
+	if err := r.List(ctx, mcpServerList, client.InNamespace(policy.Namespace)); err != nil {
+		log.Error(err, "Failed to list MCPServers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mcpServer := range mcpServerList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      mcpServer.Name,
+				Namespace: mcpServer.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// findMCPServersForCAConfigMap finds the MCPServers in the namespace of a ConfigMap referenced as a CA certificate
+// by a BackendTLSPolicy
+func (r *MCPReconciler) findMCPServersForCAConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx).WithValues("ConfigMap", obj.GetName(), "namespace", obj.GetNamespace())
+
+	policyList := &gatewayv1.BackendTLSPolicyList{}
+	if err := r.List(ctx, policyList, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.Error(err, "Failed to list BackendTLSPolicies")
+		return nil
+	}
+	for i := range policyList.Items {
+		policy := &policyList.Items[i]
+		for _, ref := range policy.Spec.Validation.CACertificateRefs {
+			if ref.Group == "" && ref.Kind == "ConfigMap" && string(ref.Name) == obj.GetName() {
+				return r.findMCPServersForBackendTLSPolicy(ctx, policy)
+			}
+		}
+	}
+	return nil
+}
+
 // validates credential secret has required label
 func (r *MCPReconciler) validateCredentialSecret(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer) error {
 	if mcpServer.Spec.CredentialRef == nil {
@@ -867,6 +1592,12 @@ func (r *MCPReconciler) validateCredentialSecret(ctx context.Context, mcpServer
 		return fmt.Errorf("credential secret %s is missing key %s",
 			mcpServer.Spec.CredentialRef.Name, key)
 	}
+	for _, additional := range mcpServer.Spec.CredentialRef.AdditionalKeys {
+		if _, exists := secret.Data[additional.Key]; !exists {
+			return fmt.Errorf("credential secret %s is missing additional key %s",
+				mcpServer.Spec.CredentialRef.Name, additional.Key)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,870 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+	"github.com/kagenti/mcp-gateway/pkg/config"
+)
+
+func testScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, mcpv1alpha1.AddToScheme(scheme))
+	require.NoError(t, gatewayv1.Install(scheme))
+	return scheme
+}
+
+func testMCPServer() *mcpv1alpha1.MCPServer {
+	return &mcpv1alpha1.MCPServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "server", Namespace: "mcp-test"},
+		Spec: mcpv1alpha1.MCPServerSpec{
+			TargetRef: mcpv1alpha1.TargetReference{
+				Group: "gateway.networking.k8s.io",
+				Kind:  "HTTPRoute",
+				Name:  "route",
+			},
+			ToolPrefix: "test_",
+			Path:       "/mcp",
+		},
+	}
+}
+
+func testHTTPRoute() *gatewayv1.HTTPRoute {
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "mcp-test"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			Hostnames: []gatewayv1.Hostname{"server.mcp.local"},
+			Rules: []gatewayv1.HTTPRouteRule{
+				{
+					BackendRefs: []gatewayv1.HTTPBackendRef{
+						{
+							BackendRef: gatewayv1.BackendRef{
+								BackendObjectReference: gatewayv1.BackendObjectReference{
+									Name: "backend",
+									Port: ptr.To(gatewayv1.PortNumber(8443)),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "mcp-test"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "https", Port: 8443}},
+		},
+	}
+}
+
+func TestDiscoverServersFromHTTPRoutesBackendTLSPolicy(t *testing.T) {
+	caConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-ca", Namespace: "mcp-test"},
+		Data:       map[string]string{"ca.crt": "test-ca-bundle"},
+	}
+	policy := func(sectionName *gatewayv1.SectionName) *gatewayv1.BackendTLSPolicy {
+		return &gatewayv1.BackendTLSPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "backend-tls", Namespace: "mcp-test"},
+			Spec: gatewayv1.BackendTLSPolicySpec{
+				TargetRefs: []gatewayv1.LocalPolicyTargetReferenceWithSectionName{
+					{
+						LocalPolicyTargetReference: gatewayv1.LocalPolicyTargetReference{
+							Group: "",
+							Kind:  "Service",
+							Name:  "backend",
+						},
+						SectionName: sectionName,
+					},
+				},
+				Validation: gatewayv1.BackendTLSPolicyValidation{
+					CACertificateRefs: []gatewayv1.LocalObjectReference{
+						{Group: "", Kind: "ConfigMap", Name: "backend-ca"},
+					},
+					Hostname: "backend.example.com",
+				},
+			},
+		}
+	}
+
+	rotatedCAConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-ca-next", Namespace: "mcp-test"},
+		Data:       map[string]string{"ca.crt": "next-ca-bundle\n"},
+	}
+	twoCAPolicy := policy(nil)
+	twoCAPolicy.Spec.Validation.CACertificateRefs = append(twoCAPolicy.Spec.Validation.CACertificateRefs,
+		gatewayv1.LocalObjectReference{Group: "", Kind: "ConfigMap", Name: "backend-ca-next"})
+
+	withTLSServerName := func() *mcpv1alpha1.MCPServer {
+		mcpServer := testMCPServer()
+		mcpServer.Spec.TLSServerName = "mcp.example.com"
+		return mcpServer
+	}
+	httpsService := testService()
+	httpsService.Spec.Ports[0].AppProtocol = ptr.To("https")
+	httpsService.Spec.Type = corev1.ServiceTypeExternalName
+	httpsService.Spec.ExternalName = "backend.example.net"
+
+	testCases := []struct {
+		Name           string
+		MCPServer      *mcpv1alpha1.MCPServer
+		Objects        []client.Object
+		ExpectEndpoint string
+		ExpectTLS      string
+		ExpectCA       string
+		ExpectHost     string
+	}{
+		{
+			Name:           "no policy uses http",
+			Objects:        []client.Object{testMCPServer(), testHTTPRoute(), testService()},
+			ExpectEndpoint: "http://backend.mcp-test.svc.cluster.local:8443/mcp",
+		},
+		{
+			Name:           "policy targeting service enables tls",
+			Objects:        []client.Object{testMCPServer(), testHTTPRoute(), testService(), caConfigMap, policy(nil)},
+			ExpectEndpoint: "https://backend.mcp-test.svc.cluster.local:8443/mcp",
+			ExpectTLS:      "backend.example.com",
+			ExpectCA:       "test-ca-bundle",
+		},
+		{
+			Name:           "policy targeting matching port enables tls",
+			Objects:        []client.Object{testMCPServer(), testHTTPRoute(), testService(), caConfigMap, policy(ptr.To(gatewayv1.SectionName("https")))},
+			ExpectEndpoint: "https://backend.mcp-test.svc.cluster.local:8443/mcp",
+			ExpectTLS:      "backend.example.com",
+			ExpectCA:       "test-ca-bundle",
+		},
+		{
+			Name:           "certificates of every referenced ConfigMap are bundled",
+			Objects:        []client.Object{testMCPServer(), testHTTPRoute(), testService(), caConfigMap, rotatedCAConfigMap, twoCAPolicy},
+			ExpectEndpoint: "https://backend.mcp-test.svc.cluster.local:8443/mcp",
+			ExpectTLS:      "backend.example.com",
+			ExpectCA:       "test-ca-bundle\nnext-ca-bundle\n",
+		},
+		{
+			Name:           "policy targeting other port is ignored",
+			Objects:        []client.Object{testMCPServer(), testHTTPRoute(), testService(), caConfigMap, policy(ptr.To(gatewayv1.SectionName("metrics")))},
+			ExpectEndpoint: "http://backend.mcp-test.svc.cluster.local:8443/mcp",
+		},
+		{
+			Name:           "tls server name overrides the policy hostname",
+			MCPServer:      withTLSServerName(),
+			Objects:        []client.Object{withTLSServerName(), testHTTPRoute(), testService(), caConfigMap, policy(nil)},
+			ExpectEndpoint: "https://backend.mcp-test.svc.cluster.local:8443/mcp",
+			ExpectTLS:      "mcp.example.com",
+			ExpectCA:       "test-ca-bundle",
+			ExpectHost:     "mcp.example.com",
+		},
+		{
+			Name:           "tls server name of an external https service",
+			MCPServer:      withTLSServerName(),
+			Objects:        []client.Object{withTLSServerName(), testHTTPRoute(), httpsService},
+			ExpectEndpoint: "https://backend.example.net:8443/mcp",
+			ExpectTLS:      "mcp.example.com",
+			ExpectHost:     "mcp.example.com",
+		},
+		{
+			Name:           "tls server name is ignored without tls",
+			MCPServer:      withTLSServerName(),
+			Objects:        []client.Object{withTLSServerName(), testHTTPRoute(), testService()},
+			ExpectEndpoint: "http://backend.mcp-test.svc.cluster.local:8443/mcp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := &MCPReconciler{
+				Client: fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(tc.Objects...).Build(),
+			}
+			mcpServer := tc.MCPServer
+			if mcpServer == nil {
+				mcpServer = testMCPServer()
+			}
+			info, err := r.discoverServersFromHTTPRoutes(context.Background(), mcpServer)
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectEndpoint, info.Endpoint)
+			require.Equal(t, tc.ExpectTLS, info.TLSServerName)
+			require.Equal(t, tc.ExpectCA, info.CACert)
+			require.Equal(t, tc.ExpectHost, info.TLSHost)
+		})
+	}
+}
+
+func TestFindMCPServersForCAConfigMap(t *testing.T) {
+	policy := &gatewayv1.BackendTLSPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend-tls", Namespace: "mcp-test"},
+		Spec: gatewayv1.BackendTLSPolicySpec{
+			Validation: gatewayv1.BackendTLSPolicyValidation{
+				CACertificateRefs: []gatewayv1.LocalObjectReference{
+					{Group: "", Kind: "ConfigMap", Name: "backend-ca"},
+					{Group: "", Kind: "ConfigMap", Name: "backend-ca-next"},
+				},
+			},
+		},
+	}
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(testMCPServer(), policy).Build(),
+	}
+	configMap := func(namespace, name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+
+	expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: testMCPServer().Name, Namespace: "mcp-test"}}}
+	require.Equal(t, expected, r.findMCPServersForCAConfigMap(context.Background(), configMap("mcp-test", "backend-ca")))
+	require.Equal(t, expected, r.findMCPServersForCAConfigMap(context.Background(), configMap("mcp-test", "backend-ca-next")))
+	require.Empty(t, r.findMCPServersForCAConfigMap(context.Background(), configMap("mcp-test", "unrelated")))
+	require.Empty(t, r.findMCPServersForCAConfigMap(context.Background(), configMap("other", "backend-ca")))
+}
+
+func TestDiscoverServersFromHTTPRoutesBackendPathRewrite(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Rewrite     string
+		ExpectPath  string
+		ExpectError bool
+	}{
+		{
+			Name: "no rewrite",
+		},
+		{
+			Name:       "exact path",
+			Rewrite:    "/proxy/team-a/mcp",
+			ExpectPath: "/proxy/team-a/mcp",
+		},
+		{
+			Name:       "path placeholder",
+			Rewrite:    "/proxy/team-a{path}",
+			ExpectPath: "/proxy/team-a/mcp",
+		},
+		{
+			Name:        "relative path",
+			Rewrite:     "proxy/mcp",
+			ExpectError: true,
+		},
+		{
+			Name:        "query string",
+			Rewrite:     "/proxy/mcp?team=a",
+			ExpectError: true,
+		},
+		{
+			Name:        "unknown placeholder",
+			Rewrite:     "/proxy/{team}/mcp",
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mcpServer := testMCPServer()
+			mcpServer.Spec.BackendPathRewrite = tc.Rewrite
+			r := &MCPReconciler{
+				Client: fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(mcpServer, testHTTPRoute(), testService()).Build(),
+			}
+			info, err := r.discoverServersFromHTTPRoutes(context.Background(), mcpServer)
+			if tc.ExpectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "http://backend.mcp-test.svc.cluster.local:8443/mcp", info.Endpoint)
+			require.Equal(t, tc.ExpectPath, info.PathRewrite)
+		})
+	}
+}
+
+func TestDiscoverServersFromHTTPRoutesToolRenames(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Renames     []mcpv1alpha1.ToolRename
+		Expect      []config.ToolRename
+		ExpectError bool
+	}{
+		{
+			Name: "no renames",
+		},
+		{
+			Name:    "valid renames",
+			Renames: []mcpv1alpha1.ToolRename{{Match: "^get_(.*)$", Replace: "fetch_${1}"}, {Match: "_v1$"}},
+			Expect:  []config.ToolRename{{Match: "^get_(.*)$", Replace: "fetch_${1}"}, {Match: "_v1$"}},
+		},
+		{
+			Name:        "invalid expression",
+			Renames:     []mcpv1alpha1.ToolRename{{Match: "get_(", Replace: "fetch_"}},
+			ExpectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mcpServer := testMCPServer()
+			mcpServer.Spec.ToolRenames = tc.Renames
+			r := &MCPReconciler{
+				Client: fake.NewClientBuilder().WithScheme(testScheme(t)).WithObjects(mcpServer, testHTTPRoute(), testService()).Build(),
+			}
+			info, err := r.discoverServersFromHTTPRoutes(context.Background(), mcpServer)
+			if tc.ExpectError {
+				require.ErrorContains(t, err, "toolRenames[0].match")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.Expect, info.ToolRenames)
+		})
+	}
+}
+
+func TestMCPServerTenant(t *testing.T) {
+	mcpServer := testMCPServer()
+	require.Equal(t, "mcp-test", mcpServerTenant(mcpServer))
+
+	mcpServer.Labels = map[string]string{TenantLabel: "team-a"}
+	require.Equal(t, "team-a", mcpServerTenant(mcpServer))
+}
+
+func TestUpdateConnectionState(t *testing.T) {
+	mcpServer := testMCPServer()
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+	updated := &mcpv1alpha1.MCPServer{}
+	for _, state := range []mcpv1alpha1.ConnectionState{
+		mcpv1alpha1.ConnectionStateNeverConnected,
+		mcpv1alpha1.ConnectionStateConnected,
+		mcpv1alpha1.ConnectionStateReconnecting,
+		mcpv1alpha1.ConnectionStateFailed,
+		// the broker has not reported on the server
+		"",
+	} {
+		require.NoError(t, r.updateConnectionState(context.Background(), mcpServer, state))
+		require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+		require.Equal(t, state, updated.Status.ConnectionState)
+	}
+}
+
+func TestUpdateTooManyToolsCondition(t *testing.T) {
+	mcpServer := testMCPServer()
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+
+	require.NoError(t, r.updateTooManyToolsCondition(context.Background(), mcpServer, 2, []string{"r_one", "r_two"}, []string{"mcp-test/route", "mcp-test/other"}))
+	updated := &mcpv1alpha1.MCPServer{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, ConditionTooManyTools)
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Contains(t, condition.Message, "mcp-test/route, mcp-test/other")
+	require.Contains(t, condition.Message, "reached: r_one, r_two.")
+
+	require.NoError(t, r.updateTooManyToolsCondition(context.Background(), updated, 0, nil, nil))
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+	require.Nil(t, meta.FindStatusCondition(updated.Status.Conditions, ConditionTooManyTools))
+}
+
+func TestUpdateReadOnlyCondition(t *testing.T) {
+	mcpServer := testMCPServer()
+	mcpServer.Spec.ReadOnly = true
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+	updated := &mcpv1alpha1.MCPServer{}
+	getCondition := func() *metav1.Condition {
+		require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+		return meta.FindStatusCondition(updated.Status.Conditions, ConditionReadOnly)
+	}
+
+	require.NoError(t, r.updateReadOnlyCondition(context.Background(), mcpServer, validationResult{}))
+	condition := getCondition()
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionUnknown, condition.Status)
+
+	require.NoError(t, r.updateReadOnlyCondition(context.Background(), updated, validationResult{Ready: true, ReadOnly: true, HiddenTools: 2}))
+	condition = getCondition()
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Contains(t, condition.Message, "2 tools not annotated as read-only are hidden")
+
+	updated.Spec.ReadOnly = false
+	require.NoError(t, r.updateReadOnlyCondition(context.Background(), updated, validationResult{Ready: true}))
+	require.Nil(t, getCondition())
+}
+
+func TestUpdateCordonedCondition(t *testing.T) {
+	mcpServer := testMCPServer()
+	mcpServer.Spec.Cordoned = true
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+	updated := &mcpv1alpha1.MCPServer{}
+	getCondition := func() *metav1.Condition {
+		require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+		return meta.FindStatusCondition(updated.Status.Conditions, ConditionCordoned)
+	}
+
+	require.NoError(t, r.updateCordonedCondition(context.Background(), mcpServer))
+	condition := getCondition()
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Equal(t, "Cordoned", condition.Reason)
+
+	updated.Spec.Cordoned = false
+	require.NoError(t, r.updateCordonedCondition(context.Background(), updated))
+	require.Nil(t, getCondition())
+}
+
+func TestUpdateDegradedCondition(t *testing.T) {
+	mcpServer := testMCPServer()
+	mcpServer.Spec.HealthThresholds = &mcpv1alpha1.HealthThresholds{DegradedAfter: 2, UnreadyAfter: 4}
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+	updated := &mcpv1alpha1.MCPServer{}
+	getCondition := func() *metav1.Condition {
+		require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+		return meta.FindStatusCondition(updated.Status.Conditions, ConditionDegraded)
+	}
+
+	require.NoError(t, r.updateDegradedCondition(context.Background(), mcpServer, validationResult{Ready: true, FailedChecks: 2, Degraded: true}))
+	condition := getCondition()
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionTrue, condition.Status)
+	require.Equal(t, "HealthChecksFailing", condition.Reason)
+	require.Contains(t, condition.Message, "2 consecutive health checks failed, the server is not ready after 4")
+
+	require.NoError(t, r.updateDegradedCondition(context.Background(), updated, validationResult{Ready: true}))
+	require.Nil(t, getCondition())
+}
+
+func TestUpdateToolsAvailableCondition(t *testing.T) {
+	mcpServer := testMCPServer()
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(mcpServer).
+			WithStatusSubresource(mcpServer).
+			Build(),
+	}
+	updated := mcpServer
+	steps := []struct {
+		Name         string
+		Validation   validationResult
+		ExpectStatus metav1.ConditionStatus
+		ExpectReason string
+	}{
+		{
+			Name:         "not yet validated",
+			Validation:   validationResult{Message: "waiting for the broker to validate the server"},
+			ExpectStatus: metav1.ConditionUnknown,
+			ExpectReason: "Pending",
+		},
+		{
+			Name:         "unreachable",
+			Validation:   validationResult{Validated: true, Message: "connection refused"},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: "NotReady",
+		},
+		{
+			Name:         "ready with its tools advertised",
+			Validation:   validationResult{Validated: true, Ready: true, TotalTools: 3, AdvertisedTools: 3},
+			ExpectStatus: metav1.ConditionTrue,
+			ExpectReason: "ToolsAdvertised",
+		},
+		{
+			Name:         "kept ready by its health thresholds while its tools are removed",
+			Validation:   validationResult{Validated: true, Ready: true, FailedChecks: 1, Message: "health checks failing"},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: "HealthChecksFailing",
+		},
+		{
+			Name:         "ready with every tool left out by the tool limit",
+			Validation:   validationResult{Validated: true, Ready: true, TotalTools: 3, TruncatedTools: 3},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: "ToolLimitReached",
+		},
+		{
+			Name:         "ready without tools",
+			Validation:   validationResult{Validated: true, Ready: true},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: "NoTools",
+		},
+		{
+			Name:         "tools advertised again",
+			Validation:   validationResult{Validated: true, Ready: true, TotalTools: 1, AdvertisedTools: 1},
+			ExpectStatus: metav1.ConditionTrue,
+			ExpectReason: "ToolsAdvertised",
+		},
+	}
+	for _, step := range steps {
+		require.NoError(t, r.updateToolsAvailableCondition(context.Background(), updated, step.Validation), step.Name)
+		updated = &mcpv1alpha1.MCPServer{}
+		require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+		condition := meta.FindStatusCondition(updated.Status.Conditions, ConditionToolsAvailable)
+		require.NotNil(t, condition, step.Name)
+		require.Equal(t, step.ExpectStatus, condition.Status, step.Name)
+		require.Equal(t, step.ExpectReason, condition.Reason, step.Name)
+	}
+}
+
+func TestUpdateHTTPRouteStatusMCPConditions(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		Validation      validationResult
+		ExpectReachable metav1.ConditionStatus
+		ExpectProtocol  metav1.ConditionStatus
+		ExpectReason    string
+	}{
+		{
+			Name:            "not validated by the broker yet",
+			Validation:      validationResult{Message: "waiting for the broker to validate the server"},
+			ExpectReachable: metav1.ConditionUnknown,
+			ExpectProtocol:  metav1.ConditionUnknown,
+			ExpectReason:    "Pending",
+		},
+		{
+			Name:            "backend unreachable",
+			Validation:      validationResult{Validated: true, Message: "connection refused"},
+			ExpectReachable: metav1.ConditionFalse,
+			ExpectProtocol:  metav1.ConditionUnknown,
+			ExpectReason:    "BackendUnreachable",
+		},
+		{
+			Name:            "unsupported protocol version",
+			Validation:      validationResult{Validated: true, Reachable: true, Message: "unsupported protocol version: 2021-11-05"},
+			ExpectReachable: metav1.ConditionTrue,
+			ExpectProtocol:  metav1.ConditionFalse,
+			ExpectReason:    "UnsupportedProtocolVersion",
+		},
+		{
+			Name:            "valid backend",
+			Validation:      validationResult{Validated: true, Ready: true, Reachable: true, ProtocolValid: true},
+			ExpectReachable: metav1.ConditionTrue,
+			ExpectProtocol:  metav1.ConditionTrue,
+			ExpectReason:    "SupportedProtocolVersion",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			httpRoute := testHTTPRoute()
+			httpRoute.Status.Parents = []gatewayv1.RouteParentStatus{
+				{ParentRef: gatewayv1.ParentReference{Name: "gateway"}, ControllerName: "istio.io/gateway-controller"},
+			}
+			r := &MCPReconciler{
+				Client: fake.NewClientBuilder().
+					WithScheme(testScheme(t)).
+					WithObjects(httpRoute).
+					WithStatusSubresource(httpRoute).
+					Build(),
+			}
+
+			require.NoError(t, r.updateHTTPRouteStatus(context.Background(), testMCPServer(), true, tc.Validation))
+			updated := &gatewayv1.HTTPRoute{}
+			require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(httpRoute), updated))
+			conditions := updated.Status.Parents[0].Conditions
+			require.True(t, meta.IsStatusConditionTrue(conditions, ConditionProgrammed))
+			reachable := meta.FindStatusCondition(conditions, ConditionMCPBackendReachable)
+			require.NotNil(t, reachable)
+			require.Equal(t, tc.ExpectReachable, reachable.Status)
+			protocol := meta.FindStatusCondition(conditions, ConditionMCPProtocolValid)
+			require.NotNil(t, protocol)
+			require.Equal(t, tc.ExpectProtocol, protocol.Status)
+			require.Equal(t, tc.ExpectReason, protocol.Reason)
+		})
+	}
+}
+
+func TestCleanupOrphanedHTTPRoutesRemovesMCPConditions(t *testing.T) {
+	newRoute := func(name string) *gatewayv1.HTTPRoute {
+		httpRoute := testHTTPRoute()
+		httpRoute.Name = name
+		httpRoute.Status.Parents = []gatewayv1.RouteParentStatus{
+			{
+				ParentRef:      gatewayv1.ParentReference{Name: "gateway"},
+				ControllerName: "istio.io/gateway-controller",
+				Conditions: []metav1.Condition{
+					{Type: "Accepted", Status: metav1.ConditionTrue, Reason: "Accepted", LastTransitionTime: metav1.Now()},
+				},
+			},
+		}
+		return httpRoute
+	}
+	referenced, orphaned := newRoute("referenced"), newRoute("orphaned")
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(referenced, orphaned).
+			WithStatusSubresource(referenced, orphaned).
+			WithIndex(&gatewayv1.HTTPRoute{}, "status.hasProgrammedCondition", httpRouteHasProgrammedCondition).
+			Build(),
+	}
+	valid := validationResult{Validated: true, Ready: true, Reachable: true, ProtocolValid: true}
+	for _, name := range []string{"referenced", "orphaned"} {
+		mcpServer := testMCPServer()
+		mcpServer.Spec.TargetRef.Name = name
+		require.NoError(t, r.updateHTTPRouteStatus(context.Background(), mcpServer, true, valid))
+	}
+
+	require.NoError(t, r.cleanupOrphanedHTTPRoutes(context.Background(), map[string]struct{}{"mcp-test/referenced": {}}))
+
+	updated := &gatewayv1.HTTPRoute{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(orphaned), updated))
+	conditions := updated.Status.Parents[0].Conditions
+	for _, conditionType := range []string{ConditionProgrammed, ConditionMCPBackendReachable, ConditionMCPProtocolValid} {
+		require.Nil(t, meta.FindStatusCondition(conditions, conditionType), conditionType)
+	}
+	// conditions set by the gateway controller are left alone
+	require.True(t, meta.IsStatusConditionTrue(conditions, "Accepted"))
+
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(referenced), updated))
+	for _, conditionType := range []string{ConditionProgrammed, ConditionMCPBackendReachable, ConditionMCPProtocolValid} {
+		require.True(t, meta.IsStatusConditionTrue(updated.Status.Parents[0].Conditions, conditionType), conditionType)
+	}
+}
+
+func TestRegenerateAggregatedConfigServerSelector(t *testing.T) {
+	newServer := func(name, tenant string) *mcpv1alpha1.MCPServer {
+		mcpServer := testMCPServer()
+		mcpServer.Name = name
+		mcpServer.Labels = map[string]string{TenantLabel: tenant}
+		mcpServer.Spec.ToolPrefix = name + "_"
+		return mcpServer
+	}
+	newVirtualServer := func(name, tenant string) *mcpv1alpha1.MCPVirtualServer {
+		return &mcpv1alpha1.MCPVirtualServer{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "mcp-test", Labels: map[string]string{TenantLabel: tenant}},
+			Spec:       mcpv1alpha1.MCPVirtualServerSpec{Tools: []string{name + "_tool"}},
+		}
+	}
+	selector, err := labels.Parse(TenantLabel + "=team-a")
+	require.NoError(t, err)
+	scheme := testScheme(t)
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newServer("a", "team-a"), newServer("b", "team-b"),
+			newVirtualServer("a", "team-a"), newVirtualServer("b", "team-b"),
+			testHTTPRoute(), testService(),
+		).Build(),
+		Scheme:           scheme,
+		ServerSelector:   selector,
+		ConfigSecretName: "mcp-gateway-config-team-a",
+	}
+
+	_, err = r.regenerateAggregatedConfig(context.Background())
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKey{Name: "mcp-gateway-config-team-a", Namespace: getConfigNamespace()}, secret))
+	brokerConfig := &config.BrokerConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(secret.StringData["config.yaml"]), brokerConfig))
+	require.Len(t, brokerConfig.Servers, 1)
+	require.Equal(t, "a_", brokerConfig.Servers[0].ToolPrefix)
+	require.Equal(t, "team-a", brokerConfig.Servers[0].Tenant)
+	require.Len(t, brokerConfig.VirtualServers, 1)
+	require.Equal(t, "mcp-test/a", brokerConfig.VirtualServers[0].Name)
+
+	// the config of other brokers is left alone
+	err = r.Get(context.Background(), client.ObjectKey{Name: ConfigName, Namespace: getConfigNamespace()}, &corev1.Secret{})
+	require.True(t, errors.IsNotFound(err), "unexpected error %v", err)
+}
+
+func TestRegenerateAggregatedConfigCustomSecret(t *testing.T) {
+	mcpServer := testMCPServer()
+	mcpServer.Spec.CredentialRef = &mcpv1alpha1.SecretReference{Name: "credentials", Key: "key"}
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "credentials",
+			Namespace: "mcp-test",
+			Labels:    map[string]string{CredentialSecretLabel: CredentialSecretValue},
+		},
+		Data: map[string][]byte{"key": []byte("key-1234")},
+	}
+	scheme := testScheme(t)
+	r := &MCPReconciler{
+		Client:                fake.NewClientBuilder().WithScheme(scheme).WithObjects(mcpServer, testHTTPRoute(), testService(), credentials).Build(),
+		Scheme:                scheme,
+		ConfigSecretName:      "mcp-gateway-config-instance-b",
+		ConfigSecretNamespace: "gateway-b",
+	}
+	require.NoError(t, r.validateCredentialSecret(context.Background(), mcpServer))
+
+	_, err := r.regenerateAggregatedConfig(context.Background())
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKey{Name: "mcp-gateway-config-instance-b", Namespace: "gateway-b"}, secret))
+	require.Equal(t, SecretManagedByValue, secret.Labels[SecretManagedByLabel])
+	brokerConfig := &config.BrokerConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(secret.StringData["config.yaml"]), brokerConfig))
+	require.Len(t, brokerConfig.Servers, 1)
+	require.Equal(t, "key-1234", brokerConfig.Servers[0].Credential)
+
+	// the default config, which may belong to another gateway instance, is not written
+	err = r.Get(context.Background(), client.ObjectKey{Name: ConfigName, Namespace: getConfigNamespace()}, &corev1.Secret{})
+	require.True(t, errors.IsNotFound(err), "unexpected error %v", err)
+	err = r.Get(context.Background(), client.ObjectKey{Name: ConfigName, Namespace: "gateway-b"}, &corev1.Secret{})
+	require.True(t, errors.IsNotFound(err), "unexpected error %v", err)
+}
+
+func TestRegenerateAggregatedConfigAdditionalCredentials(t *testing.T) {
+	mcpServer := testMCPServer()
+	mcpServer.Spec.CredentialRef = &mcpv1alpha1.SecretReference{
+		Name: "credentials",
+		Key:  "key",
+		AdditionalKeys: []mcpv1alpha1.CredentialKey{
+			{Key: "secret", Location: "header:X-Api-Secret"},
+			{Key: "tenant", Location: "query:tenant"},
+		},
+	}
+	mcpServer.Spec.CredentialLocation = "header:X-Api-Key"
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "credentials",
+			Namespace: "mcp-test",
+			Labels:    map[string]string{CredentialSecretLabel: CredentialSecretValue},
+		},
+		Data: map[string][]byte{"key": []byte("key-1234"), "secret": []byte("secret-5678"), "tenant": []byte("acme")},
+	}
+	scheme := testScheme(t)
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(mcpServer, testHTTPRoute(), testService(), credentials).Build(),
+		Scheme: scheme,
+	}
+	require.NoError(t, r.validateCredentialSecret(context.Background(), mcpServer))
+
+	_, err := r.regenerateAggregatedConfig(context.Background())
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKey{Name: ConfigName, Namespace: getConfigNamespace()}, secret))
+	brokerConfig := &config.BrokerConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(secret.StringData["config.yaml"]), brokerConfig))
+	require.Len(t, brokerConfig.Servers, 1)
+	require.Equal(t, "key-1234", brokerConfig.Servers[0].Credential)
+	require.Equal(t, "header:X-Api-Key", brokerConfig.Servers[0].CredentialLocation)
+	require.Equal(t, []config.Credential{
+		{Value: "secret-5678", Location: "header:X-Api-Secret"},
+		{Value: "acme", Location: "query:tenant"},
+	}, brokerConfig.Servers[0].AdditionalCredentials)
+
+	// a missing additional key fails the credential validation
+	delete(credentials.Data, "tenant")
+	require.NoError(t, r.Update(context.Background(), credentials))
+	require.ErrorContains(t, r.validateCredentialSecret(context.Background(), mcpServer), "missing additional key tenant")
+}
+
+func TestRegenerateAggregatedConfigToolBindings(t *testing.T) {
+	// the prefix of weather matches the tools of weather-eu too
+	newServer := func(name, prefix string) (*mcpv1alpha1.MCPServer, *gatewayv1.HTTPRoute) {
+		mcpServer := testMCPServer()
+		mcpServer.Name = name
+		mcpServer.Spec.TargetRef.Name = name
+		mcpServer.Spec.ToolPrefix = prefix
+		httpRoute := testHTTPRoute()
+		httpRoute.Name = name
+		httpRoute.Spec.Hostnames = []gatewayv1.Hostname{gatewayv1.Hostname(name + ".mcp.local")}
+		return mcpServer, httpRoute
+	}
+	weather, weatherRoute := newServer("weather", "weather_")
+	weatherEU, weatherEURoute := newServer("weather-eu", "weather_eu_")
+	virtualServer := &mcpv1alpha1.MCPVirtualServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vs", Namespace: "mcp-test"},
+		Spec: mcpv1alpha1.MCPVirtualServerSpec{
+			Tools: []string{"weather_eu_forecast", "weather_alerts"},
+			ToolBindings: map[string]string{
+				"weather_eu_forecast": "mcp-test/weather",
+				"weather_alerts":      "weather-eu",
+			},
+		},
+	}
+	scheme := testScheme(t)
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			weather, weatherRoute, weatherEU, weatherEURoute, virtualServer, testService(),
+		).Build(),
+		Scheme: scheme,
+	}
+
+	_, err := r.regenerateAggregatedConfig(context.Background())
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKey{Name: ConfigName, Namespace: getConfigNamespace()}, secret))
+	brokerConfig := &config.BrokerConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(secret.StringData["config.yaml"]), brokerConfig))
+	require.Len(t, brokerConfig.VirtualServers, 1)
+	// weather-eu's prefix does not match weather_alerts so that binding is left out
+	require.Equal(t, []config.ToolBindingConfig{{Tool: "weather_eu_forecast", Server: "mcp-test/weather"}}, brokerConfig.VirtualServers[0].ToolBindings)
+}
+
+func TestStartupProbeConfig(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Probe  *mcpv1alpha1.StartupProbe
+		Expect *config.StartupProbeConfig
+	}{
+		{
+			Name:   "defaults are left to the broker",
+			Probe:  &mcpv1alpha1.StartupProbe{},
+			Expect: &config.StartupProbeConfig{},
+		},
+		{
+			Name: "all settings",
+			Probe: &mcpv1alpha1.StartupProbe{
+				Period:           &metav1.Duration{Duration: 5 * time.Second},
+				Timeout:          &metav1.Duration{Duration: time.Minute},
+				FailureThreshold: 12,
+			},
+			Expect: &config.StartupProbeConfig{Period: "5s", Timeout: "1m0s", FailureThreshold: 12},
+		},
+		{
+			Name: "zero durations are not set",
+			Probe: &mcpv1alpha1.StartupProbe{
+				Period:  &metav1.Duration{},
+				Timeout: &metav1.Duration{},
+			},
+			Expect: &config.StartupProbeConfig{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expect, startupProbeConfig(tc.Probe))
+		})
+	}
+}
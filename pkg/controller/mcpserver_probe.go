@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// probeRequested reports whether the MCPServer asks for its connectivity to be checked now
+func probeRequested(mcpServer *mcpv1alpha1.MCPServer) bool {
+	_, ok := mcpServer.Annotations[ProbeAnnotation]
+	return ok
+}
+
+// probeRequestedPredicate passes updates that set the probe annotation. Annotations do not change the generation so
+// these updates are otherwise filtered out
+func probeRequestedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			_, requested := e.ObjectNew.GetAnnotations()[ProbeAnnotation]
+			return requested && e.ObjectOld.GetAnnotations()[ProbeAnnotation] != e.ObjectNew.GetAnnotations()[ProbeAnnotation]
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// probe asks the broker to check the server now and records the result. It returns the broker's status once the
+// probe is done, or nil if the probe failed
+func (r *MCPReconciler) probe(ctx context.Context, statusClient *BrokerStatusClient, mcpServer *mcpv1alpha1.MCPServer, serverID string) (*BrokerStatus, error) {
+	log.FromContext(ctx).Info("Probing MCPServer", "server", mcpServer.Name, "serverID", serverID)
+	status, probeErr := statusClient.Probe(ctx, serverID)
+	var validation validationResult
+	if probeErr == nil {
+		validation = evaluateValidationResults(status, serverID, mcpServer.Spec.HealthThresholds)
+	}
+	if err := r.recordProbe(ctx, mcpServer, validation, probeErr); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// recordProbe writes the result of a probe into the Probed condition and then removes the probe annotation so the
+// next probe can be requested by setting it again
+func (r *MCPReconciler) recordProbe(ctx context.Context, mcpServer *mcpv1alpha1.MCPServer, validation validationResult, probeErr error) error {
+	condition := metav1.Condition{
+		Type:               ConditionProbed,
+		ObservedGeneration: mcpServer.Generation,
+	}
+	probedAt := time.Now().UTC().Format(time.RFC3339)
+	switch {
+	case probeErr != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ProbeFailed"
+		condition.Message = fmt.Sprintf("probed at %s: the broker could not probe the server: %v", probedAt, probeErr)
+	default:
+		condition.Status = metav1.ConditionFalse
+		switch {
+		case validation.Ready:
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "Ready"
+		case !validation.Reachable:
+			condition.Reason = "Unreachable"
+		case !validation.ProtocolValid:
+			condition.Reason = "ProtocolInvalid"
+		default:
+			condition.Reason = "NotReady"
+		}
+		condition.Message = fmt.Sprintf("probed at %s: reachable: %t, protocol valid: %t, tools: %d. %s",
+			probedAt, validation.Reachable, validation.ProtocolValid, validation.TotalTools, validation.Message)
+	}
+	meta.SetStatusCondition(&mcpServer.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, mcpServer); err != nil {
+		return fmt.Errorf("failed to record probe result: %w", err)
+	}
+
+	patch := client.MergeFrom(mcpServer.DeepCopy())
+	delete(mcpServer.Annotations, ProbeAnnotation)
+	if err := r.Patch(ctx, mcpServer, patch); err != nil {
+		return fmt.Errorf("failed to remove the %s annotation: %w", ProbeAnnotation, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+)
+
+func TestProbe(t *testing.T) {
+	const serverID = "mcp-test/route:test_:server.mcp.local"
+	testCases := []struct {
+		Name            string
+		BrokerStatus    int
+		BrokerResponse  string
+		ExpectStatus    bool
+		ExpectCondition metav1.ConditionStatus
+		ExpectReason    string
+		ExpectMessage   string
+	}{
+		{
+			Name:            "reachable server",
+			BrokerStatus:    http.StatusOK,
+			BrokerResponse:  `{"servers": [{"id": "` + serverID + `", "message": "server added successfully. Total tools added 3", "ready": true, "reachable": true, "protocolValid": true, "totalTools": 3}]}`,
+			ExpectStatus:    true,
+			ExpectCondition: metav1.ConditionTrue,
+			ExpectReason:    "Ready",
+			ExpectMessage:   "reachable: true, protocol valid: true, tools: 3. server added successfully. Total tools added 3",
+		},
+		{
+			Name:            "unreachable server",
+			BrokerStatus:    http.StatusOK,
+			BrokerResponse:  `{"servers": [{"id": "` + serverID + `", "message": "failed to connect to upstream mcp: connection refused", "ready": false}]}`,
+			ExpectStatus:    true,
+			ExpectCondition: metav1.ConditionFalse,
+			ExpectReason:    "Unreachable",
+			ExpectMessage:   "reachable: false, protocol valid: false, tools: 0. failed to connect to upstream mcp: connection refused",
+		},
+		{
+			Name:            "server unknown to the broker",
+			BrokerStatus:    http.StatusNotFound,
+			BrokerResponse:  `{"error": "not found"}`,
+			ExpectCondition: metav1.ConditionFalse,
+			ExpectReason:    "ProbeFailed",
+			ExpectMessage:   "the broker could not probe the server",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var probed *http.Request
+			broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				probed = r
+				w.WriteHeader(tc.BrokerStatus)
+				_, _ = w.Write([]byte(tc.BrokerResponse))
+			}))
+			defer broker.Close()
+
+			mcpServer := testMCPServer()
+			mcpServer.Annotations = map[string]string{ProbeAnnotation: "true", ForwardAuthorizationAnnotation: "true"}
+			r := &MCPReconciler{
+				Client: fake.NewClientBuilder().
+					WithScheme(testScheme(t)).
+					WithObjects(mcpServer).
+					WithStatusSubresource(mcpServer).
+					Build(),
+			}
+			require.True(t, probeRequested(mcpServer))
+
+			status, err := r.probe(context.Background(), NewBrokerStatusClient(r.Client, broker.URL+"/status"), mcpServer, serverID)
+			require.NoError(t, err)
+			require.Equal(t, tc.ExpectStatus, status != nil)
+			require.Equal(t, http.MethodPost, probed.Method)
+			require.Equal(t, "/status/probe", probed.URL.Path)
+			require.Equal(t, serverID, probed.URL.Query().Get("server"))
+
+			updated := &mcpv1alpha1.MCPServer{}
+			require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(mcpServer), updated))
+			condition := meta.FindStatusCondition(updated.Status.Conditions, ConditionProbed)
+			require.NotNil(t, condition)
+			require.Equal(t, tc.ExpectCondition, condition.Status)
+			require.Equal(t, tc.ExpectReason, condition.Reason)
+			require.Contains(t, condition.Message, tc.ExpectMessage)
+			// the annotation is removed once the result is recorded and other annotations are kept
+			require.False(t, probeRequested(updated))
+			require.Equal(t, "true", updated.Annotations[ForwardAuthorizationAnnotation])
+		})
+	}
+}
+
+func TestProbeRequestedPredicate(t *testing.T) {
+	withAnnotations := func(annotations map[string]string) *mcpv1alpha1.MCPServer {
+		mcpServer := testMCPServer()
+		mcpServer.Annotations = annotations
+		return mcpServer
+	}
+	testCases := []struct {
+		Name   string
+		Old    map[string]string
+		New    map[string]string
+		Expect bool
+	}{
+		{Name: "annotation set", New: map[string]string{ProbeAnnotation: "true"}, Expect: true},
+		{Name: "annotation changed", Old: map[string]string{ProbeAnnotation: "1"}, New: map[string]string{ProbeAnnotation: "2"}, Expect: true},
+		{Name: "annotation unchanged", Old: map[string]string{ProbeAnnotation: "true"}, New: map[string]string{ProbeAnnotation: "true"}},
+		{Name: "annotation removed", Old: map[string]string{ProbeAnnotation: "true"}},
+		{Name: "other annotation set", New: map[string]string{ForwardAuthorizationAnnotation: "true"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expect, probeRequestedPredicate().Update(event.UpdateEvent{
+				ObjectOld: withAnnotations(tc.Old),
+				ObjectNew: withAnnotations(tc.New),
+			}))
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+)
+
+const (
+	// VirtualServerReasonNoBackingServers is set when no MCPServer provides the virtual server's tools
+	VirtualServerReasonNoBackingServers = "NoBackingServers"
+	// VirtualServerReasonAllServersUnavailable is set when every MCPServer providing the virtual server's tools is not ready
+	VirtualServerReasonAllServersUnavailable = "AllServersUnavailable"
+	// VirtualServerReasonInvalidToolBindings is set when a tool binding is not for one of the virtual server's tools or
+	// its MCPServer does not exist or cannot provide the tool
+	VirtualServerReasonInvalidToolBindings = "InvalidToolBindings"
+)
+
+// updateVirtualServerStatus sets the Ready condition of the virtual server based on the MCPServers providing its tools
+func (r *MCPReconciler) updateVirtualServerStatus(ctx context.Context, mcpVirtualServer *mcpv1alpha1.MCPVirtualServer) error {
+	mcpServerList := &mcpv1alpha1.MCPServerList{}
+	if err := r.List(ctx, mcpServerList, r.selectorListOptions()...); err != nil {
+		return fmt.Errorf("failed to list MCPServers: %w", err)
+	}
+
+	condition := virtualServerReadyCondition(mcpVirtualServer, mcpServerList.Items)
+	if !meta.SetStatusCondition(&mcpVirtualServer.Status.Conditions, condition) {
+		return nil
+	}
+	return r.Status().Update(ctx, mcpVirtualServer)
+}
+
+// virtualServerReadyCondition aggregates the Ready condition of the MCPServers backing the virtual server.
+// The virtual server is ready as long as at least one of its backing servers is ready.
+func virtualServerReadyCondition(mcpVirtualServer *mcpv1alpha1.MCPVirtualServer, mcpServers []mcpv1alpha1.MCPServer) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               "Ready",
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: mcpVirtualServer.Generation,
+	}
+
+	bindings, problems := virtualServerToolBindings(mcpVirtualServer, mcpServers)
+	if len(problems) > 0 {
+		condition.Reason = VirtualServerReasonInvalidToolBindings
+		condition.Message = strings.Join(problems, "; ")
+		return condition
+	}
+
+	var unbound []string
+	for _, tool := range mcpVirtualServer.Spec.Tools {
+		if _, ok := bindings[tool]; !ok {
+			unbound = append(unbound, tool)
+		}
+	}
+	backing := virtualServerBackingServers(unbound, mcpServers)
+	for _, mcpServer := range bindings {
+		if !slices.ContainsFunc(backing, func(other mcpv1alpha1.MCPServer) bool {
+			return client.ObjectKeyFromObject(&other) == client.ObjectKeyFromObject(&mcpServer)
+		}) {
+			backing = append(backing, mcpServer)
+		}
+	}
+	if len(backing) == 0 {
+		condition.Reason = VirtualServerReasonNoBackingServers
+		condition.Message = "no MCPServer provides the tools of this virtual server"
+		return condition
+	}
+
+	ready := 0
+	for _, mcpServer := range backing {
+		if meta.IsStatusConditionTrue(mcpServer.Status.Conditions, "Ready") {
+			ready++
+		}
+	}
+	if ready == 0 {
+		condition.Reason = VirtualServerReasonAllServersUnavailable
+		condition.Message = fmt.Sprintf("none of the %d MCPServers providing tools are ready", len(backing))
+		return condition
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "Ready"
+	condition.Message = fmt.Sprintf("%d of %d MCPServers providing tools are ready", ready, len(backing))
+	return condition
+}
+
+// toolPrefixMatch returns the length of the longest of the server's tool prefix and prefix aliases the tool starts
+// with, or -1 if it starts with none of them
+func toolPrefixMatch(tool string, mcpServer mcpv1alpha1.MCPServer) int {
+	longest := -1
+	for _, prefix := range append([]string{mcpServer.Spec.ToolPrefix}, mcpServer.Spec.ToolPrefixAliases...) {
+		if strings.HasPrefix(tool, prefix) && len(prefix) > longest {
+			longest = len(prefix)
+		}
+	}
+	return longest
+}
+
+// virtualServerBackingServers returns the MCPServers whose tool prefix or one of its aliases matches one of the tools.
+// The longest matching prefix wins so a server without a prefix only backs tools no other server claims.
+func virtualServerBackingServers(tools []string, mcpServers []mcpv1alpha1.MCPServer) []mcpv1alpha1.MCPServer {
+	backing := map[types.NamespacedName]mcpv1alpha1.MCPServer{}
+	for _, tool := range tools {
+		longest := -1
+		var matched []mcpv1alpha1.MCPServer
+		for _, mcpServer := range mcpServers {
+			matchLength := toolPrefixMatch(tool, mcpServer)
+			if matchLength < 0 || matchLength < longest {
+				continue
+			}
+			if matchLength > longest {
+				longest = matchLength
+				matched = nil
+			}
+			matched = append(matched, mcpServer)
+		}
+		for _, mcpServer := range matched {
+			backing[client.ObjectKeyFromObject(&mcpServer)] = mcpServer
+		}
+	}
+
+	result := make([]mcpv1alpha1.MCPServer, 0, len(backing))
+	for _, mcpServer := range backing {
+		result = append(result, mcpServer)
+	}
+	return result
+}
+
+// toolBindingServer returns the MCPServer a tool binding names. The name is namespace/name or a name in the virtual
+// server's namespace
+func toolBindingServer(mcpVirtualServer *mcpv1alpha1.MCPVirtualServer, server string) types.NamespacedName {
+	if namespace, name, ok := strings.Cut(server, "/"); ok {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	return types.NamespacedName{Namespace: mcpVirtualServer.Namespace, Name: server}
+}
+
+// virtualServerToolBindings returns the MCPServer each of the virtual server's valid tool bindings routes its tool to,
+// keyed by the tool, and a description of each invalid binding. A binding is valid when the tool is one of the
+// virtual server's tools and the MCPServer exists and has a tool prefix or alias matching the tool
+func virtualServerToolBindings(mcpVirtualServer *mcpv1alpha1.MCPVirtualServer, mcpServers []mcpv1alpha1.MCPServer) (map[string]mcpv1alpha1.MCPServer, []string) {
+	bindings := map[string]mcpv1alpha1.MCPServer{}
+	var problems []string
+	for _, tool := range slices.Sorted(maps.Keys(mcpVirtualServer.Spec.ToolBindings)) {
+		server := toolBindingServer(mcpVirtualServer, mcpVirtualServer.Spec.ToolBindings[tool])
+		if !slices.Contains(mcpVirtualServer.Spec.Tools, tool) {
+			problems = append(problems, fmt.Sprintf("tool binding %s is not one of the virtual server's tools", tool))
+			continue
+		}
+		index := slices.IndexFunc(mcpServers, func(mcpServer mcpv1alpha1.MCPServer) bool {
+			return client.ObjectKeyFromObject(&mcpServer) == server
+		})
+		if index < 0 {
+			problems = append(problems, fmt.Sprintf("tool %s is bound to MCPServer %s which does not exist", tool, server))
+			continue
+		}
+		if toolPrefixMatch(tool, mcpServers[index]) < 0 {
+			problems = append(problems, fmt.Sprintf("tool %s is bound to MCPServer %s whose tool prefix does not match it", tool, server))
+			continue
+		}
+		bindings[tool] = mcpServers[index]
+	}
+	return bindings, problems
+}
+
+// findMCPVirtualServersForMCPServer enqueues every MCPVirtualServer so their aggregate status reflects the MCPServer change
+func (r *MCPReconciler) findMCPVirtualServersForMCPServer(ctx context.Context, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx).WithValues("MCPServer", obj.GetName(), "namespace", obj.GetNamespace())
+
+	mcpVirtualServerList := &mcpv1alpha1.MCPVirtualServerList{}
+	if err := r.List(ctx, mcpVirtualServerList); err != nil {
+		log.Error(err, "Failed to list MCPVirtualServers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mcpVirtualServer := range mcpVirtualServerList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      mcpVirtualServer.Name,
+				Namespace: mcpVirtualServer.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// mcpServerReadyChangedPredicate filters MCPServer events down to those that can change virtual server health
+func mcpServerReadyChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldServer, ok := e.ObjectOld.(*mcpv1alpha1.MCPServer)
+			if !ok {
+				return false
+			}
+			newServer, ok := e.ObjectNew.(*mcpv1alpha1.MCPServer)
+			if !ok {
+				return false
+			}
+			return meta.IsStatusConditionTrue(oldServer.Status.Conditions, "Ready") != meta.IsStatusConditionTrue(newServer.Status.Conditions, "Ready") ||
+				oldServer.Spec.ToolPrefix != newServer.Spec.ToolPrefix ||
+				!slices.Equal(oldServer.Spec.ToolPrefixAliases, newServer.Spec.ToolPrefixAliases)
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
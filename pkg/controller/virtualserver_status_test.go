@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mcpv1alpha1 "github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+)
+
+func testBackingServer(name, prefix string, ready bool) mcpv1alpha1.MCPServer {
+	status := metav1.ConditionFalse
+	if ready {
+		status = metav1.ConditionTrue
+	}
+	return mcpv1alpha1.MCPServer{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "mcp-test"},
+		Spec:       mcpv1alpha1.MCPServerSpec{ToolPrefix: prefix},
+		Status: mcpv1alpha1.MCPServerStatus{
+			Conditions: []metav1.Condition{{Type: "Ready", Status: status, Reason: "Test"}},
+		},
+	}
+}
+
+func testVirtualServer() *mcpv1alpha1.MCPVirtualServer {
+	return &mcpv1alpha1.MCPVirtualServer{
+		ObjectMeta: metav1.ObjectMeta{Name: "vs", Namespace: "mcp-test"},
+		Spec: mcpv1alpha1.MCPVirtualServerSpec{
+			Tools: []string{"s1_tool", "s2_tool"},
+		},
+	}
+}
+
+func TestVirtualServerReadyCondition(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Servers      []mcpv1alpha1.MCPServer
+		ToolBindings map[string]string
+		ExpectStatus metav1.ConditionStatus
+		ExpectReason string
+	}{
+		{
+			Name:         "no backing servers",
+			Servers:      []mcpv1alpha1.MCPServer{testBackingServer("other", "other_", true)},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonNoBackingServers,
+		},
+		{
+			Name: "all backing servers down",
+			Servers: []mcpv1alpha1.MCPServer{
+				testBackingServer("s1", "s1_", false),
+				testBackingServer("s2", "s2_", false),
+				testBackingServer("other", "other_", true),
+			},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonAllServersUnavailable,
+		},
+		{
+			Name: "one backing server up",
+			Servers: []mcpv1alpha1.MCPServer{
+				testBackingServer("s1", "s1_", false),
+				testBackingServer("s2", "s2_", true),
+			},
+			ExpectStatus: metav1.ConditionTrue,
+			ExpectReason: "Ready",
+		},
+		{
+			Name: "unprefixed server does not back tools claimed by a prefix",
+			Servers: []mcpv1alpha1.MCPServer{
+				testBackingServer("s1", "s1_", false),
+				testBackingServer("s2", "s2_", false),
+				testBackingServer("unprefixed", "", true),
+			},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonAllServersUnavailable,
+		},
+		{
+			Name: "bound server backs the tool instead of the longest prefix",
+			Servers: []mcpv1alpha1.MCPServer{
+				testBackingServer("s1", "s1_", false),
+				testBackingServer("s2", "s2_", false),
+				testBackingServer("unprefixed", "", true),
+			},
+			ToolBindings: map[string]string{"s2_tool": "unprefixed"},
+			ExpectStatus: metav1.ConditionTrue,
+			ExpectReason: "Ready",
+		},
+		{
+			Name:         "binding to a server that does not exist",
+			Servers:      []mcpv1alpha1.MCPServer{testBackingServer("s1", "s1_", true)},
+			ToolBindings: map[string]string{"s1_tool": "missing"},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonInvalidToolBindings,
+		},
+		{
+			Name:         "binding to a server whose prefix does not match",
+			Servers:      []mcpv1alpha1.MCPServer{testBackingServer("s1", "s1_", true), testBackingServer("s2", "s2_", true)},
+			ToolBindings: map[string]string{"s1_tool": "mcp-test/s2"},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonInvalidToolBindings,
+		},
+		{
+			Name:         "binding for a tool the virtual server does not list",
+			Servers:      []mcpv1alpha1.MCPServer{testBackingServer("s1", "s1_", true)},
+			ToolBindings: map[string]string{"s1_other": "s1"},
+			ExpectStatus: metav1.ConditionFalse,
+			ExpectReason: VirtualServerReasonInvalidToolBindings,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			virtualServer := testVirtualServer()
+			virtualServer.Spec.ToolBindings = tc.ToolBindings
+			condition := virtualServerReadyCondition(virtualServer, tc.Servers)
+			require.Equal(t, "Ready", condition.Type)
+			require.Equal(t, tc.ExpectStatus, condition.Status)
+			require.Equal(t, tc.ExpectReason, condition.Reason)
+		})
+	}
+}
+
+func TestUpdateVirtualServerStatus(t *testing.T) {
+	s1 := testBackingServer("s1", "s1_", false)
+	s2 := testBackingServer("s2", "s2_", false)
+	vs := testVirtualServer()
+	r := &MCPReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(testScheme(t)).
+			WithObjects(vs, &s1, &s2).
+			WithStatusSubresource(vs).
+			Build(),
+	}
+
+	require.NoError(t, r.updateVirtualServerStatus(context.Background(), vs))
+
+	updated := &mcpv1alpha1.MCPVirtualServer{}
+	require.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(vs), updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, "Ready")
+	require.NotNil(t, condition)
+	require.Equal(t, metav1.ConditionFalse, condition.Status)
+	require.Equal(t, VirtualServerReasonAllServersUnavailable, condition.Reason)
+}
@@ -405,6 +405,18 @@ func IsTrustedHeadersEnabled() bool {
 	return strings.TrimSpace(string(output)) != ""
 }
 
+// IsToolsListChangedNotificationsEnabled checks the gateway sends notifications/tools/list_changed to clients, which
+// is the default unless the broker runs with --tools-list-changed-notifications=false
+func IsToolsListChangedNotificationsEnabled() bool {
+	cmd := exec.Command("kubectl", "get", "deployment", "-n", SystemNamespace,
+		"mcp-broker-router", "-o", "jsonpath={.spec.template.spec.containers[0].command}")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return true
+	}
+	return !strings.Contains(string(output), "--tools-list-changed-notifications=false")
+}
+
 // WithBackendTarget sets the backend service and port for the HTTPRoute
 func (b *MCPServerRegistrationBuilder) WithBackendTarget(backend string, port int32) *MCPServerRegistrationBuilder {
 	if b.httpRoute != nil {
@@ -6,7 +6,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
 	"github.com/mark3labs/mcp-go/mcp"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -52,11 +55,11 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 	It("should register multiple mcp servers with the gateway and make their tools available", func() {
 		By("Creating HTTPRoutes and MCP Servers")
 		// create httproutes for test servers that should already be deployed
-		registration := NewMCPServerRegistration("basic-registration", k8sClient)
+		registration := NewMCPServerRegistration("basic-registration-1", k8sClient)
 		// Important as we need to make sure to clean up
 		testResources = append(testResources, registration.GetObjects()...)
 		registeredServer1 := registration.Register(ctx)
-		registration = NewMCPServerRegistration("basic-registration", k8sClient)
+		registration = NewMCPServerRegistration("basic-registration-2", k8sClient)
 		// Important as we need to make sure to clean up
 		testResources = append(testResources, registration.GetObjects()...)
 		registeredServer2 := registration.Register(ctx)
@@ -78,6 +81,60 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 
 	})
 
+	It("should register mcp servers concurrently and advertise each tool exactly once", func() {
+		const serverCount = 4
+		registrations := make([]*MCPServerRegistrationBuilder, 0, serverCount)
+		for i := range serverCount {
+			registration := NewMCPServerRegistration(fmt.Sprintf("concurrent-registration-%d", i), k8sClient)
+			// Important as we need to make sure to clean up
+			testResources = append(testResources, registration.GetObjects()...)
+			registrations = append(registrations, registration)
+		}
+
+		By("Creating the MCPServers at the same time")
+		registeredServers := make([]*v1alpha1.MCPServer, serverCount)
+		var wg sync.WaitGroup
+		for i, registration := range registrations {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				registeredServers[i] = registration.Register(ctx)
+			}()
+		}
+		wg.Wait()
+
+		By("Verifying MCPServers become ready")
+		Eventually(func(g Gomega) {
+			for _, registeredServer := range registeredServers {
+				g.Expect(VerifyMCPServerReadyWithToolsCount(ctx, k8sClient, registeredServer.Name, registeredServer.Namespace, 5)).To(BeNil())
+			}
+		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
+
+		By("Verifying each tool is advertised exactly once under the prefix of its server")
+		Eventually(func(g Gomega) {
+			toolsList, err := mcpGatewayClient.ListTools(ctx, mcp.ListToolsRequest{})
+			g.Expect(err).Error().NotTo(HaveOccurred())
+			g.Expect(toolsList).NotTo(BeNil())
+			advertised := map[string]int{}
+			for _, tool := range toolsList.Tools {
+				advertised[tool.Name]++
+			}
+			for name, count := range advertised {
+				g.Expect(count).To(Equal(1), "tool %s advertised %d times", name, count)
+			}
+			for _, registeredServer := range registeredServers {
+				prefixed := 0
+				for name := range advertised {
+					if strings.HasPrefix(name, registeredServer.Spec.ToolPrefix) {
+						prefixed++
+					}
+				}
+				g.Expect(prefixed).To(Equal(5), "expected 5 tools with prefix %s", registeredServer.Spec.ToolPrefix)
+			}
+		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
+	})
+
 	It("should unregister mcp servers with the gateway", func() {
 		registration := NewMCPServerRegistration("basic-unregister", k8sClient)
 		// Important as we need to make sure to clean up
@@ -148,6 +205,64 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 		Expect(content.Text).To(Equal("Hello, e2e!"))
 	})
 
+	It("should stream tool progress to the client before the tool result", func() {
+		registration := NewMCPServerRegistration("tools-streaming", k8sClient)
+		testResources = append(testResources, registration.GetObjects()...)
+		registeredServer := registration.Register(ctx)
+
+		By("Ensuring the gateway has registered the server")
+		Eventually(func(g Gomega) {
+			g.Expect(VerifyMCPServerReady(ctx, k8sClient, registeredServer.Name, registeredServer.Namespace)).To(BeNil())
+		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
+
+		By("Creating a client that records when progress notifications arrive")
+		var (
+			mu         sync.Mutex
+			progressAt []time.Time
+		)
+		streamingClient, err := NewMCPGatewayClientWithNotifications(ctx, gatewayURL, func(j mcp.JSONRPCNotification) {
+			if j.Method == "notifications/progress" {
+				mu.Lock()
+				defer mu.Unlock()
+				progressAt = append(progressAt, time.Now())
+			}
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer streamingClient.Close()
+
+		toolName := fmt.Sprintf("%s%s", registeredServer.Spec.ToolPrefix, "slow")
+		By("Verifying the slow tool is present")
+		Eventually(func(g Gomega) {
+			toolsList, err := streamingClient.ListTools(ctx, mcp.ListToolsRequest{})
+			g.Expect(err).Error().NotTo(HaveOccurred())
+			g.Expect(toolsList).NotTo(BeNil())
+			g.Expect(verifyMCPServerToolsPresent(registeredServer.Spec.ToolPrefix, toolsList)).To(BeTrueBecause("%s should exist", registeredServer.Spec.ToolPrefix))
+		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
+
+		By("Invoking a tool that streams progress for several seconds")
+		res, err := streamingClient.CallTool(ctx, mcp.CallToolRequest{
+			Params: mcp.CallToolParams{
+				Name:      toolName,
+				Arguments: map[string]string{"seconds": "3"},
+				Meta:      &mcp.Meta{ProgressToken: "e2e-streaming"},
+			},
+		})
+		resultAt := time.Now()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).NotTo(BeNil())
+		Expect(res.Content).To(HaveLen(1))
+		content, ok := res.Content[0].(mcp.TextContent)
+		Expect(ok).To(BeTrue())
+		Expect(content.Text).To(Equal("done"))
+
+		By("Verifying progress chunks were delivered individually rather than as one buffered body")
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(len(progressAt)).To(BeNumerically(">=", 2), "expected multiple progress notifications")
+		// if the response were buffered every notification would arrive together with the result
+		Expect(resultAt.Sub(progressAt[0])).To(BeNumerically(">=", time.Second))
+	})
+
 	It("should register mcp server with credential with the gateway and make the tools available", func() {
 		cred := BuildCredentialSecret("mcp-credential", "test-api-key-secret-toke")
 		registration := NewMCPServerRegistration("credentials", k8sClient).
@@ -362,6 +477,9 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 	})
 
 	It("should send notifications/tools/list_changed to connected clients when MCPServer is registered", func() {
+		if !IsToolsListChangedNotificationsEnabled() {
+			Skip("tools list changed notifications are disabled - skipping notification test")
+		}
 		// NOTE on notifications. A notification is sent when servers are removed during clean up as this effects tools list also.
 		// as the list_changed notification is broadcast, this can mean clients in other tests receive additional notifications
 		// for that reason we only assert we received at least one rather than a set number
@@ -413,6 +531,9 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 	})
 
 	It("should forward notifications/tools/list_changed from backend MCP server to connected clients", func() {
+		if !IsToolsListChangedNotificationsEnabled() {
+			Skip("tools list changed notifications are disabled - skipping notification test")
+		}
 
 		By("Creating an MCPServer pointing to server1 which has the add_tool feature")
 		registration := NewMCPServerRegistration("backend-notification-test", k8sClient).
@@ -558,10 +679,12 @@ var _ = Describe("MCP Gateway Registration Happy Path", func() {
 			g.Expect(verifyMCPServerToolsPresent(registeredServer.Spec.ToolPrefix, toolsList)).To(BeFalseBecause("%s should be removed when server unavailable", registeredServer.Spec.ToolPrefix))
 		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
 
-		By("Verifying client notification was received")
-		Eventually(func(g Gomega) {
-			g.Expect(receivedNotification).To(BeTrue(), "should have received notifications/tools/list_changed")
-		}, TestTimeoutMedium, TestRetryInterval).To(Succeed())
+		if IsToolsListChangedNotificationsEnabled() {
+			By("Verifying client notification was received")
+			Eventually(func(g Gomega) {
+				g.Expect(receivedNotification).To(BeTrue(), "should have received notifications/tools/list_changed")
+			}, TestTimeoutMedium, TestRetryInterval).To(Succeed())
+		}
 
 		By("Verifying tool call returns error when server unavailable")
 		toolName := fmt.Sprintf("%s%s", registeredServer.Spec.ToolPrefix, "time")
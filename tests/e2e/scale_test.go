@@ -0,0 +1,77 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kagenti/mcp-gateway/pkg/apis/mcp/v1alpha1"
+	"github.com/mark3labs/mcp-go/mcp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scaleServerCount is the number of MCPServers federated by the scale test
+const scaleServerCount = 100
+
+// these specs register many servers so they are left out of the default runs, run them with make test-e2e-scale
+var _ = Describe("MCP Gateway Scale", Label("scale"), func() {
+	var (
+		testResources = []client.Object{}
+	)
+
+	AfterEach(func() {
+		for _, to := range testResources {
+			CleanupResource(ctx, k8sClient, to)
+		}
+	})
+
+	It("should federate many mcp servers and advertise each of their tools exactly once", func() {
+		By(fmt.Sprintf("Creating %d HTTPRoutes and MCP Servers", scaleServerCount))
+		start := time.Now()
+		registeredServers := make([]*v1alpha1.MCPServer, 0, scaleServerCount)
+		for i := range scaleServerCount {
+			// the prefix ends with a separator so no prefix is the start of another
+			registration := NewMCPServerRegistration(fmt.Sprintf("scale-%03d", i), k8sClient).WithToolPrefix(fmt.Sprintf("scale%03d_", i))
+			// Important as we need to make sure to clean up
+			testResources = append(testResources, registration.GetObjects()...)
+			registeredServers = append(registeredServers, registration.Register(ctx))
+		}
+		AddReportEntry("registration time", time.Since(start))
+
+		By("Verifying MCPServers become ready")
+		Eventually(func(g Gomega) {
+			for _, registeredServer := range registeredServers {
+				g.Expect(VerifyMCPServerReadyWithToolsCount(ctx, k8sClient, registeredServer.Name, registeredServer.Namespace, 5)).To(BeNil())
+			}
+		}, TestTimeoutConfigSync, TestRetryInterval).To(Succeed())
+		AddReportEntry("time until every server is ready", time.Since(start))
+
+		By("Verifying each tool is advertised exactly once under the prefix of its server")
+		Eventually(func(g Gomega) {
+			toolsList, err := mcpGatewayClient.ListTools(ctx, mcp.ListToolsRequest{})
+			g.Expect(err).Error().NotTo(HaveOccurred())
+			g.Expect(toolsList).NotTo(BeNil())
+			advertised := map[string]int{}
+			for _, tool := range toolsList.Tools {
+				advertised[tool.Name]++
+			}
+			for name, count := range advertised {
+				g.Expect(count).To(Equal(1), "tool %s advertised %d times", name, count)
+			}
+			for _, registeredServer := range registeredServers {
+				prefixed := 0
+				for name := range advertised {
+					if strings.HasPrefix(name, registeredServer.Spec.ToolPrefix) {
+						prefixed++
+					}
+				}
+				g.Expect(prefixed).To(Equal(5), "expected 5 tools with prefix %s", registeredServer.Spec.ToolPrefix)
+			}
+		}, TestTimeoutLong, TestRetryInterval).To(Succeed())
+		AddReportEntry("time until every tool is listed", time.Since(start))
+	})
+})
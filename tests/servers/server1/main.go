@@ -3,7 +3,7 @@
 // A simple MCP server that implements a few tools
 // - The "hi" tool from the library sample
 // - A "time" tool that returns the current time
-// - A "slow" tool that waits N seconds, notifying the client of progress
+// - A "slow" tool that waits N seconds, notifying the client of progress, and stops early when cancelled
 // - A "headers" tool that returns all HTTP headers it received
 package main
 
@@ -164,7 +164,12 @@ func slowTool(
 			}
 		}
 
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Slow tool cancelled after %d seconds\n", waited)
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 
 	return &mcp.CallToolResultFor[struct{}]{